@@ -143,6 +143,11 @@ type AuditEvent struct {
 	McpID string `json:"mcp_id,omitempty"`
 	Tool  string `json:"tool,omitempty"`
 
+	// RequestID is the X-Request-ID of the frontend request the call was
+	// made for, when the calling service passed it on; it is the request_id
+	// of that request's line in the frontend access log.
+	RequestID string `json:"request_id,omitempty"`
+
 	// Args is the redacted, size-capped call arguments. When ArgsTruncated is
 	// set it holds a JSON *string* containing the truncated prefix rather than
 	// the original object, so the line stays valid JSON either way.
@@ -718,9 +723,11 @@ type AuditQuery struct {
 	// Kind filters on the actor kind, which is how "everything any VM did"
 	// (kind=remote) is asked as one question rather than reconstructed from
 	// which actor fields happen to be set.
-	Kind  string `json:"kind,omitempty"`
-	Text  string `json:"text,omitempty"` // substring over tool, args, error, project name
-	Limit int    `json:"limit,omitempty"`
+	Kind string `json:"kind,omitempty"`
+	// RequestID selects the calls made for one frontend request.
+	RequestID string `json:"request_id,omitempty"`
+	Text      string `json:"text,omitempty"` // substring over tool, args, error, project name
+	Limit     int    `json:"limit,omitempty"`
 	// Deep searches the log file rather than the in-memory ring, for history
 	// older than the ring holds. Bounded by auditTailBudget.
 	Deep bool `json:"deep,omitempty"`
@@ -742,11 +749,14 @@ func (q AuditQuery) matches(ev *AuditEvent) bool {
 	if q.Kind != "" && ev.Actor.Kind != q.Kind {
 		return false
 	}
+	if q.RequestID != "" && ev.RequestID != q.RequestID {
+		return false
+	}
 	if q.Text != "" {
 		needle := strings.ToLower(q.Text)
 		hay := strings.ToLower(strings.Join([]string{
 			ev.Tool, ev.McpID, ev.Error, ev.Actor.ProjectName,
-			ev.Actor.Proc, ev.Actor.Parent, string(ev.Args),
+			ev.Actor.Proc, ev.Actor.Parent, ev.RequestID, string(ev.Args),
 		}, "\x00"))
 		if !strings.Contains(hay, needle) {
 			return false
@@ -47,9 +47,10 @@ func (r *appRouter) beginAudit(ctx context.Context, event string) *auditCall {
 		rec:   r.audit,
 		start: time.Now(),
 		ev: AuditEvent{
-			ID:    newAuditID(),
-			Event: event,
-			Actor: AuditActor{Kind: AuditActorUnknown, Auth: AuditAuthNone},
+			ID:        newAuditID(),
+			Event:     event,
+			Actor:     AuditActor{Kind: AuditActorUnknown, Auth: AuditAuthNone},
+			RequestID: bridge.RequestIDFromContext(ctx),
 		},
 	}
 	// A remote caller's identity is attested by its certificate, which is the
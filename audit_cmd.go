@@ -24,6 +24,7 @@ func runAuditCommand(args []string) {
 	outcome := fs.String("outcome", "", "filter by outcome: ok, error, tool_error, denied, unauthorized, throttled, pending")
 	kind := fs.String("kind", "", "filter by actor kind: project, service, remote, unknown")
 	event := fs.String("event", "", "filter by event kind: call_tool, list_tools, list_skills")
+	requestID := fs.String("request-id", "", "filter by the frontend request's X-Request-ID (see frontend-access.log)")
 	text := fs.String("grep", "", "substring match over tool, MCP, error, project, caller, args")
 	asJSON := fs.Bool("json", false, "emit raw JSONL instead of a table")
 	pathOnly := fs.Bool("path", false, "print the log file path and exit")
@@ -47,6 +48,7 @@ func runAuditCommand(args []string) {
 		Outcome:   *outcome,
 		Kind:      *kind,
 		Event:     *event,
+		RequestID: *requestID,
 		Text:      *text,
 		Limit:     *tail,
 	}
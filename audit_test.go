@@ -215,6 +215,32 @@ func TestAudit_RecordsDirectoryAuth(t *testing.T) {
 	}
 }
 
+// A call made for a frontend request carries its X-Request-ID into the
+// event, where the request_id filter finds it.
+func TestAudit_RecordsRequestID(t *testing.T) {
+	mock := newMockConn("fsmcp", simpleTools("read_file"), okHandler(`{}`))
+	r, rec := auditedRouter(t,
+		map[string]Permission{"fsmcp": PermOn}, nil,
+		map[string]*mockMcpConn{"fsmcp": mock}, nil)
+
+	ctx := bridge.WithRequestID(context.Background(), "eve-42")
+	if _, err := r.CallTool(ctx, "read_file", json.RawMessage(`{}`), testToken); err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if _, err := r.CallTool(context.Background(), "read_file", json.RawMessage(`{}`), testToken); err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+
+	events := readLoggedEvents(t, rec)
+	if len(events) != 2 || events[0].RequestID != "eve-42" || events[1].RequestID != "" {
+		t.Fatalf("request ids = %+v", events)
+	}
+	q := AuditQuery{RequestID: "eve-42"}
+	if !q.matches(&events[0]) || q.matches(&events[1]) {
+		t.Error("request_id filter matched the wrong events")
+	}
+}
+
 // A tool that fails inside the protocol returns a normal result with
 // isError set; without the probe it would be logged as a plain success.
 func TestAudit_RecordsProtocolLevelToolError(t *testing.T) {
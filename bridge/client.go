@@ -13,6 +13,8 @@ type Client struct {
 	sockPath string
 	token    string
 	cwd      string // sent only when token is empty; see BridgeRequest.Cwd
+	// requestID is sent with ListTools and CallTool; see WithRequestID.
+	requestID string
 }
 
 // NewClient creates a Client that will authenticate with the given token.
@@ -33,6 +35,20 @@ func NewClient(token string) *Client {
 	return c
 }
 
+// WithRequestID returns a copy of the client whose ListTools and CallTool
+// calls carry id, the X-Request-ID (RequestIDHeader) of the frontend
+// request they are made for, so relay's audit log names the request. A
+// service handling a proxied request typically does:
+//
+//	client.WithRequestID(r.Header.Get(bridge.RequestIDHeader)).CallTool(...)
+//
+// The receiver is unchanged, so a shared client is safe to derive from.
+func (c *Client) WithRequestID(id string) *Client {
+	cp := *c
+	cp.requestID = id
+	return &cp
+}
+
 // checkError returns an error if the bridge response is an error response.
 func checkError(resp *BridgeResponse) error {
 	if resp.Type == RespError {
@@ -44,9 +60,10 @@ func checkError(resp *BridgeResponse) error {
 // ListTools sends a ListTools request and returns the raw JSON tool array.
 func (c *Client) ListTools() (json.RawMessage, error) {
 	resp, err := c.send(BridgeRequest{
-		Type:  ReqListTools,
-		Token: c.token,
-		Cwd:   c.cwd,
+		Type:      ReqListTools,
+		Token:     c.token,
+		Cwd:       c.cwd,
+		RequestID: c.requestID,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list tools: %w", err)
@@ -73,6 +90,7 @@ func (c *Client) CallToolStreaming(name string, args json.RawMessage, onProgress
 		Arguments: args,
 		Token:     c.token,
 		Cwd:       c.cwd,
+		RequestID: c.requestID,
 	}, onProgress)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call tool %q: %w", name, err)
@@ -215,6 +233,76 @@ func SendReloadService(id, token string) error {
 	return sendAdmin(ReqReloadService, id, token)
 }
 
+// SendRunJob asks the running tray to run the given job now.
+func SendRunJob(id, token string) error {
+	return sendAdmin(ReqRunJob, id, token)
+}
+
+// McpStatus asks the running tray for every external MCP's connection and
+// OAuth state. Admin authentication required (construct with the admin secret).
+func (c *Client) McpStatus() ([]McpStatus, error) {
+	resp, err := c.send(BridgeRequest{
+		Type:  ReqMcpStatus,
+		Token: c.token,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mcp status: %w", err)
+	}
+	if err := checkError(resp); err != nil {
+		return nil, err
+	}
+	var out []McpStatus
+	if err := json.Unmarshal(resp.Data, &out); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return out, nil
+}
+
+// ServiceStatus asks the running tray for every managed service's running
+// state and last exit. Admin authentication required.
+func (c *Client) ServiceStatus() ([]ServiceStatus, error) {
+	resp, err := c.send(BridgeRequest{
+		Type:  ReqServiceStatus,
+		Token: c.token,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service status: %w", err)
+	}
+	if err := checkError(resp); err != nil {
+		return nil, err
+	}
+	var out []ServiceStatus
+	if err := json.Unmarshal(resp.Data, &out); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return out, nil
+}
+
+// ResourceMetrics asks the running tray for the CPU and memory history of
+// the services and MCPs req selects. Admin authentication required.
+func (c *Client) ResourceMetrics(req ResourceMetricsRequest) ([]ResourceMetrics, error) {
+	args, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	resp, err := c.send(BridgeRequest{
+		Type:      ReqResourceMetrics,
+		Arguments: args,
+		Token:     c.token,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("resource metrics: %w", err)
+	}
+	if err := checkError(resp); err != nil {
+		return nil, err
+	}
+	var out []ResourceMetrics
+	if err := json.Unmarshal(resp.Data, &out); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return out, nil
+}
+
 // bridgeTimeout bounds inactivity on a bridge round-trip: it caps connect +
 // write + time-to-first-frame, and is reset on every frame received during a
 // streaming call (see sendStreaming) so it acts as an idle timeout rather than
@@ -10,6 +10,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"relaygo/jsonrpc"
 )
 
 // Contract tests for the bridge wire protocol.
@@ -37,6 +39,7 @@ type stubRouter struct {
 	callToolNames    []string
 	callToolArgs     []json.RawMessage
 	callToolToks     []string
+	callToolReqIDs   []string // correlation ID, as seen through the request context
 	callToolResp     json.RawMessage
 	callToolErr      error
 	callToolProgress []ProgressUpdate // emitted via the ctx sink before the result
@@ -90,6 +93,7 @@ func (s *stubRouter) CallTool(ctx context.Context, name string, args json.RawMes
 	s.callToolNames = append(s.callToolNames, name)
 	s.callToolArgs = append(s.callToolArgs, args)
 	s.callToolToks = append(s.callToolToks, token)
+	s.callToolReqIDs = append(s.callToolReqIDs, RequestIDFromContext(ctx))
 	prog := s.callToolProgress
 	delay := s.callToolProgDly
 	resp, err := s.callToolResp, s.callToolErr
@@ -302,6 +306,44 @@ func TestContract_CallTool(t *testing.T) {
 	}
 }
 
+// A client derived with WithRequestID delivers the frontend request's ID to
+// the router; one that fails ValidRequestID is dropped, and the client it
+// was derived from sends none.
+func TestContract_CallToolCarriesRequestID(t *testing.T) {
+	router := &stubRouter{callToolResp: json.RawMessage(`{}`)}
+	sock := startTestBridge(t, router)
+	c := &Client{sockPath: sock, token: "svc-token"}
+
+	for _, id := range []string{"req-1", "bad id\n", ""} {
+		if _, err := c.WithRequestID(id).CallTool("t", nil); err != nil {
+			t.Fatalf("CallTool(%q): %v", id, err)
+		}
+	}
+	if _, err := c.CallTool("t", nil); err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	want := []string{"req-1", "", "", ""}
+	if strings.Join(router.callToolReqIDs, ",") != strings.Join(want, ",") {
+		t.Fatalf("request ids = %q, want %q", router.callToolReqIDs, want)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"3f0c2a9e-0b7d-4c55-9a55-1c2d3e4f5a6b": true,
+		"eve:42.retry_1":                       true,
+		"":                                     false,
+		"has space":                            false,
+		"quote\"":                              false,
+		strings.Repeat("a", 128):               true,
+		strings.Repeat("a", 129):               false,
+	} {
+		if got := ValidRequestID(id); got != want {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
 func TestContract_CallToolStreamsProgress(t *testing.T) {
 	router := &stubRouter{
 		callToolResp: json.RawMessage(`{"ok":true}`),
@@ -689,3 +731,182 @@ func TestContract_ReloadExternalMcp_SurfacesError(t *testing.T) {
 type errString string
 
 func (e errString) Error() string { return string(e) }
+
+// statusRouter adds the optional McpStatusRouter capability to stubRouter.
+type statusRouter struct {
+	stubRouter
+	statuses []McpStatus
+}
+
+func (s *statusRouter) McpStatus(_ context.Context) ([]McpStatus, error) {
+	return s.statuses, nil
+}
+
+func TestContract_McpStatus(t *testing.T) {
+	router := &statusRouter{statuses: []McpStatus{
+		{ID: "fs", Connected: true},
+		{ID: "linear", Connected: true, AuthState: "needs_reauth"},
+	}}
+	sock := startTestBridge(t, router)
+	c := &Client{sockPath: sock, token: "admin"}
+
+	got, err := c.McpStatus()
+	if err != nil {
+		t.Fatalf("McpStatus: %v", err)
+	}
+	if len(got) != 2 || got[1].ID != "linear" || got[1].AuthState != "needs_reauth" || got[0].AuthState != "" {
+		t.Fatalf("status payload mismatch: %+v", got)
+	}
+	if len(router.validateAdminToks) != 1 || router.validateAdminToks[0] != "admin" {
+		t.Fatalf("McpStatus must be admin-gated; ValidateAdmin saw %v", router.validateAdminToks)
+	}
+}
+
+// A router without the optional capability answers method-not-found rather
+// than failing the connection, so a newer CLI against an older tray degrades.
+func TestContract_McpStatus_UnsupportedRouter(t *testing.T) {
+	sock := startTestBridge(t, &stubRouter{})
+
+	resp := sendRaw(t, sock, BridgeRequest{Type: ReqMcpStatus, Token: "admin"})
+	if resp.Type != RespError || resp.Code != jsonrpc.CodeMethodNotFound {
+		t.Fatalf("expected method-not-found; got %+v", resp)
+	}
+}
+
+// serviceStatusRouter adds the optional ServiceStatusRouter capability.
+type serviceStatusRouter struct {
+	stubRouter
+	statuses []ServiceStatus
+}
+
+func (s *serviceStatusRouter) ServiceStatus(_ context.Context) ([]ServiceStatus, error) {
+	return s.statuses, nil
+}
+
+func TestContract_ServiceStatus(t *testing.T) {
+	router := &serviceStatusRouter{statuses: []ServiceStatus{
+		{ID: "eve", Running: true, PID: 4242},
+		{ID: "indexer", LastExit: "killed: memory limit exceeded", Limit: "memory"},
+	}}
+	sock := startTestBridge(t, router)
+	c := &Client{sockPath: sock, token: "admin"}
+
+	got, err := c.ServiceStatus()
+	if err != nil {
+		t.Fatalf("ServiceStatus: %v", err)
+	}
+	if len(got) != 2 || !got[0].Running || got[0].PID != 4242 || got[1].Limit != "memory" || got[1].Running {
+		t.Fatalf("status payload mismatch: %+v", got)
+	}
+	if len(router.validateAdminToks) != 1 || router.validateAdminToks[0] != "admin" {
+		t.Fatalf("ServiceStatus must be admin-gated; ValidateAdmin saw %v", router.validateAdminToks)
+	}
+}
+
+func TestContract_ServiceStatus_UnsupportedRouter(t *testing.T) {
+	sock := startTestBridge(t, &stubRouter{})
+
+	resp := sendRaw(t, sock, BridgeRequest{Type: ReqServiceStatus, Token: "admin"})
+	if resp.Type != RespError || resp.Code != jsonrpc.CodeMethodNotFound {
+		t.Fatalf("expected method-not-found; got %+v", resp)
+	}
+}
+
+// jobRunnerRouter adds the optional JobRunner capability.
+type jobRunnerRouter struct {
+	stubRouter
+	ran []string
+	err error
+}
+
+func (j *jobRunnerRouter) RunJob(id string) error {
+	j.ran = append(j.ran, id)
+	return j.err
+}
+
+func TestContract_RunJob(t *testing.T) {
+	router := &jobRunnerRouter{}
+	sock := startTestBridge(t, router)
+
+	resp := sendRaw(t, sock, BridgeRequest{Type: ReqRunJob, Name: "backup", Token: "admin"})
+	if resp.Type != RespOK || len(router.ran) != 1 || router.ran[0] != "backup" {
+		t.Fatalf("RunJob = %+v, ran %v", resp, router.ran)
+	}
+	if len(router.validateAdminToks) != 1 || router.validateAdminToks[0] != "admin" {
+		t.Fatalf("RunJob must be admin-gated; ValidateAdmin saw %v", router.validateAdminToks)
+	}
+
+	router.err = errString("job \"backup\" is already running")
+	resp = sendRaw(t, sock, BridgeRequest{Type: ReqRunJob, Name: "backup", Token: "admin"})
+	if resp.Type != RespError || !strings.Contains(resp.Message, "already running") {
+		t.Fatalf("RunJob error not surfaced: %+v", resp)
+	}
+}
+
+func TestContract_RunJob_UnsupportedRouter(t *testing.T) {
+	sock := startTestBridge(t, &stubRouter{})
+
+	resp := sendRaw(t, sock, BridgeRequest{Type: ReqRunJob, Name: "backup", Token: "admin"})
+	if resp.Type != RespError || resp.Code != jsonrpc.CodeMethodNotFound {
+		t.Fatalf("expected method-not-found; got %+v", resp)
+	}
+}
+
+type metricsRouter struct {
+	stubRouter
+	got []ResourceMetricsRequest
+}
+
+func (m *metricsRouter) ResourceMetrics(_ context.Context, req ResourceMetricsRequest) ([]ResourceMetrics, error) {
+	m.got = append(m.got, req)
+	if req.ID == "nope" {
+		return nil, jsonrpc.NewCodedError(jsonrpc.CodeInvalidParams, errString(`no service registered with id "nope"`))
+	}
+	return []ResourceMetrics{{Kind: "service", ID: "web", PID: 42, Running: true,
+		Samples: []ResourceSample{{At: time.Unix(1700000000, 0).UTC(), CPUPercent: 12.5, RSSBytes: 4096, Procs: 2}}}}, nil
+}
+
+func TestContract_ResourceMetrics(t *testing.T) {
+	router := &metricsRouter{}
+	sock := startTestBridge(t, router)
+
+	since := time.Unix(1690000000, 0).UTC()
+	args, _ := json.Marshal(ResourceMetricsRequest{Kind: "service", ID: "web", Since: since})
+	resp := sendRaw(t, sock, BridgeRequest{Type: ReqResourceMetrics, Arguments: args, Token: "admin"})
+	if resp.Type != RespResourceMetrics {
+		t.Fatalf("ResourceMetrics = %+v", resp)
+	}
+	var got []ResourceMetrics
+	if err := json.Unmarshal(resp.Data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].PID != 42 || len(got[0].Samples) != 1 || got[0].Samples[0].RSSBytes != 4096 {
+		t.Fatalf("decoded %+v", got)
+	}
+	if r := router.got[0]; r.Kind != "service" || r.ID != "web" || !r.Since.Equal(since) {
+		t.Fatalf("router saw %+v", r)
+	}
+	if len(router.validateAdminToks) != 1 || router.validateAdminToks[0] != "admin" {
+		t.Fatalf("ResourceMetrics must be admin-gated; ValidateAdmin saw %v", router.validateAdminToks)
+	}
+
+	// No arguments asks for everything.
+	if resp := sendRaw(t, sock, BridgeRequest{Type: ReqResourceMetrics, Token: "admin"}); resp.Type != RespResourceMetrics || router.got[1] != (ResourceMetricsRequest{}) {
+		t.Fatalf("no-argument request = %+v, router saw %+v", resp, router.got[1])
+	}
+
+	args, _ = json.Marshal(ResourceMetricsRequest{ID: "nope"})
+	resp = sendRaw(t, sock, BridgeRequest{Type: ReqResourceMetrics, Arguments: args, Token: "admin"})
+	if resp.Type != RespError || resp.Code != jsonrpc.CodeInvalidParams {
+		t.Fatalf("unknown id not surfaced as invalid params: %+v", resp)
+	}
+}
+
+func TestContract_ResourceMetrics_UnsupportedRouter(t *testing.T) {
+	sock := startTestBridge(t, &stubRouter{})
+
+	resp := sendRaw(t, sock, BridgeRequest{Type: ReqResourceMetrics, Token: "admin"})
+	if resp.Type != RespError || resp.Code != jsonrpc.CodeMethodNotFound {
+		t.Fatalf("expected method-not-found; got %+v", resp)
+	}
+}
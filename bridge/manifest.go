@@ -3,6 +3,7 @@ package bridge
 import (
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -15,10 +16,18 @@ import (
 type Manifest struct {
 	// Routes are the HTTP path prefixes and exact paths the service serves.
 	// Relay's front-door dispatcher uses longest-prefix-match against this
-	// list to pick which service handles an inbound request. WebSocket paths
-	// (e.g. "/ws") are valid entries.
+	// list (and RouteRules) to pick which service handles an inbound
+	// request. WebSocket paths (e.g. "/ws") are valid entries, and so are
+	// "{name}" parameter segments (see RouteDecl).
 	Routes []string `json:"routes"`
 
+	// RouteRules are routes with more to say than a path: the HTTP methods
+	// they take, a rewrite of the path on its way to the service, path
+	// parameters, and a priority over other services' routes. Optional, and
+	// combinable with Routes — a Routes entry is a RouteDecl with only Path
+	// set. A manifest must declare at least one route between the two.
+	RouteRules []RouteDecl `json:"routeRules,omitempty"`
+
 	// Status declares the GET endpoint relay polls to render the service's
 	// status in the settings UI. Optional — services with no status surface
 	// can omit it.
@@ -33,6 +42,367 @@ type Manifest struct {
 	// from. Relay reads and writes the file directly from the tray process —
 	// the service hosts no endpoint for this. Optional.
 	Config *ConfigDecl `json:"config,omitempty"`
+
+	// Events declares an event stream the service publishes for relay to
+	// fan in to its own (GET /api/events on the frontend). Optional.
+	Events *EventsDecl `json:"events,omitempty"`
+
+	// Dispatch tunes how the front door treats the service when it can't
+	// be reached. Optional; without it the defaults apply.
+	Dispatch *DispatchDecl `json:"dispatch,omitempty"`
+
+	// Guards are project rules relay enforces on requests to the service
+	// before they reach it. Optional.
+	Guards []GuardDecl `json:"guards,omitempty"`
+}
+
+// RouteDecl is one route with rules attached.
+//
+// Path has the Routes syntax — a trailing "/" makes it a prefix, anything
+// else an exact path — and may also hold "{name}" segments, each matching
+// exactly one non-empty path segment: "/api/projects/{id}/files/".
+//
+// Across every registered manifest the dispatcher prefers the route with
+// the higher Priority, then the more specific one (more literal
+// characters, so a plain route list keeps its longest-prefix match). Two
+// services may declare the same Path when their Methods don't overlap or
+// their priorities differ; only routes that would tie are refused
+// (RouteDecl.Collides).
+type RouteDecl struct {
+	Path string `json:"path"`
+	// Methods limits the route to these HTTP verbs; empty takes any. A
+	// WebSocket upgrade is a GET. A path whose routes all refuse the verb
+	// is answered 405.
+	Methods []string `json:"methods,omitempty"`
+	// StripPrefix is cut from the front of the request path before it is
+	// forwarded. It must be Path itself or a leading run of its segments,
+	// parameters included ("/v2/{tenant}" of "/v2/{tenant}/llm/").
+	StripPrefix string `json:"stripPrefix,omitempty"`
+	// AddPrefix is put in front of the (stripped) path. A "{name}" segment
+	// in it is replaced by what Path's {name} matched, so a service can be
+	// mounted under a prefix it doesn't know about, or have a parameter
+	// moved to where its own routes expect it.
+	AddPrefix string `json:"addPrefix,omitempty"`
+	// Priority orders this route against others matching the same request;
+	// higher wins. Default 0. Plain Routes entries are priority 0.
+	Priority int `json:"priority,omitempty"`
+}
+
+// AllRoutes returns the manifest's routes as RouteDecls: Routes first, as
+// plain declarations, then RouteRules.
+func (m *Manifest) AllRoutes() []RouteDecl {
+	out := make([]RouteDecl, 0, len(m.Routes)+len(m.RouteRules))
+	for _, r := range m.Routes {
+		out = append(out, RouteDecl{Path: r})
+	}
+	return append(out, m.RouteRules...)
+}
+
+// Collides reports whether d and o could claim the same request with
+// neither preferred: the same path shape (parameter names aside), a method
+// both take, and equal priority. Routes that overlap without colliding —
+// "/api/" and "/api/sessions/", say — are told apart by specificity.
+func (d RouteDecl) Collides(o RouteDecl) bool {
+	if d.Priority != o.Priority || routeShape(d.Path) != routeShape(o.Path) {
+		return false
+	}
+	if len(d.Methods) == 0 || len(o.Methods) == 0 {
+		return true
+	}
+	for _, m := range d.Methods {
+		for _, n := range o.Methods {
+			if strings.EqualFold(m, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// routeShape is a route path with its parameter names erased:
+// "/a/{id}/" and "/a/{name}/" match exactly the same requests.
+func routeShape(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		if _, ok := RouteParam(s); ok {
+			segs[i] = "{}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// RouteParam returns the parameter name of a "{name}" path segment, and
+// false for a literal one.
+func RouteParam(seg string) (string, bool) {
+	if len(seg) < 2 || seg[0] != '{' || seg[len(seg)-1] != '}' {
+		return "", false
+	}
+	return seg[1 : len(seg)-1], true
+}
+
+// routeMethods are the verbs a RouteDecl may restrict itself to.
+var routeMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// validate checks one route declaration and normalizes its methods to
+// upper case in place. label names it in errors.
+func (d *RouteDecl) validate(label string) error {
+	if d.Path == "" {
+		return fmt.Errorf("manifest: %s.path is empty", label)
+	}
+	params, err := routeParams(label+".path", d.Path)
+	if err != nil {
+		return err
+	}
+	for i, m := range d.Methods {
+		m = strings.ToUpper(m)
+		if !slices.Contains(routeMethods, m) {
+			return fmt.Errorf("manifest: %s: method %q is not a supported HTTP verb", label, d.Methods[i])
+		}
+		d.Methods[i] = m
+	}
+	if d.StripPrefix != "" {
+		if strings.HasSuffix(d.StripPrefix, "/") {
+			return fmt.Errorf("manifest: %s: stripPrefix %q must not end with %q", label, d.StripPrefix, "/")
+		}
+		if strings.TrimSuffix(d.Path, "/") != d.StripPrefix && !strings.HasPrefix(d.Path, d.StripPrefix+"/") {
+			return fmt.Errorf("manifest: %s: stripPrefix %q is not a leading part of path %q", label, d.StripPrefix, d.Path)
+		}
+	}
+	if d.AddPrefix != "" {
+		if strings.HasSuffix(d.AddPrefix, "/") {
+			return fmt.Errorf("manifest: %s: addPrefix %q must not end with %q", label, d.AddPrefix, "/")
+		}
+		used, err := routeParams(label+".addPrefix", d.AddPrefix)
+		if err != nil {
+			return err
+		}
+		for _, name := range used {
+			if !slices.Contains(params, name) {
+				return fmt.Errorf("manifest: %s: addPrefix uses {%s}, which path %q does not declare", label, name, d.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// routeParams checks a route path's syntax — a leading "/", parameters
+// only as whole "{name}" segments with distinct identifier names — and
+// returns the parameter names.
+func routeParams(label, p string) ([]string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("manifest: %s %q must start with %q", label, p, "/")
+	}
+	var names []string
+	for _, seg := range strings.Split(p[1:], "/") {
+		name, ok := RouteParam(seg)
+		if !ok {
+			if strings.ContainsAny(seg, "{}") {
+				return nil, fmt.Errorf("manifest: %s %q: a parameter must be a whole segment, as in {name}", label, p)
+			}
+			continue
+		}
+		if !validParamName(name) {
+			return nil, fmt.Errorf("manifest: %s %q: parameter name %q is not an identifier", label, p, name)
+		}
+		if slices.Contains(names, name) {
+			return nil, fmt.Errorf("manifest: %s %q: parameter {%s} is repeated", label, p, name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func validParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// DispatchDecl tunes the front door's circuit breaker for the service and
+// opts it in to retries.
+//
+// After FailureThreshold consecutive requests fail to reach a replica
+// (default 3) its circuit opens: relay answers 503 with Retry-After for
+// OpenSeconds (default 5), then lets one request through to probe it. A
+// success closes the circuit; a failure opens it again for twice as long,
+// up to a minute. A replica that registers its manifest again starts
+// closed.
+//
+// With RetryOnRestart, a GET or HEAD that fails to reach the service is
+// held while the service restarts and sent once more when it has
+// registered again, rather than failing. Only for services whose GETs are
+// safe to repeat.
+type DispatchDecl struct {
+	FailureThreshold int  `json:"failureThreshold,omitempty"`
+	OpenSeconds      int  `json:"openSeconds,omitempty"`
+	RetryOnRestart   bool `json:"retryOnRestart,omitempty"`
+}
+
+// Bounds on DispatchDecl's settings.
+const (
+	maxFailureThreshold = 100
+	maxOpenSeconds      = 300
+)
+
+// validate checks a DispatchDecl's numbers are in range; 0 means the
+// default.
+func (d *DispatchDecl) validate() error {
+	if d.FailureThreshold < 0 || d.FailureThreshold > maxFailureThreshold {
+		return fmt.Errorf("manifest: dispatch.failureThreshold %d is out of range 0–%d", d.FailureThreshold, maxFailureThreshold)
+	}
+	if d.OpenSeconds < 0 || d.OpenSeconds > maxOpenSeconds {
+		return fmt.Errorf("manifest: dispatch.openSeconds %d is out of range 0–%d", d.OpenSeconds, maxOpenSeconds)
+	}
+	return nil
+}
+
+// GuardDecl asks relay to check a request against a project's allowlist
+// before dispatching it: the project a request names and a value it
+// carries, with the value refused unless the project allows it. Only
+// relay knows a project's allowlists, so a service that wants them
+// enforced on its routes declares a guard rather than asking relay over
+// the bridge.
+//
+// Path and Methods select requests the way a RouteDecl does (Methods
+// defaults to POST), matched against the path the client sent, before any
+// rewrite. Project and Value each locate a string: a "{name}" parameter
+// of Path, or a dotted path into the JSON request body ("projectId",
+// "session.model"). Value may also find a list of strings, each of which
+// must be allowed. Allowlist names the project list to check:
+//
+//	models          the project's allowed models
+//	mcps            its allowed MCP IDs
+//	chatTemplates   the IDs of its chat templates
+//	shellTemplates  the IDs of its shell templates
+//
+// A request that names no project, or no value, or a project relay doesn't
+// know, passes — the service decides what those mean — except that a
+// scoped frontend credential must name a project it was granted.
+type GuardDecl struct {
+	Path      string   `json:"path"`
+	Methods   []string `json:"methods,omitempty"`
+	Project   string   `json:"project"`
+	Value     string   `json:"value"`
+	Allowlist string   `json:"allowlist"`
+}
+
+// GuardDecl.Allowlist values.
+const (
+	GuardAllowModels         = "models"
+	GuardAllowMcps           = "mcps"
+	GuardAllowChatTemplates  = "chatTemplates"
+	GuardAllowShellTemplates = "shellTemplates"
+)
+
+// validate checks a guard and defaults its methods to POST, upper-casing
+// them in place. label names it in errors.
+func (g *GuardDecl) validate(label string) error {
+	params, err := routeParams(label+".path", g.Path)
+	if err != nil {
+		return err
+	}
+	if len(g.Methods) == 0 {
+		g.Methods = []string{"POST"}
+	}
+	for i, m := range g.Methods {
+		m = strings.ToUpper(m)
+		if !slices.Contains(routeMethods, m) {
+			return fmt.Errorf("manifest: %s: method %q is not a supported HTTP verb", label, g.Methods[i])
+		}
+		g.Methods[i] = m
+	}
+	for _, field := range []struct{ name, loc string }{{"project", g.Project}, {"value", g.Value}} {
+		if name, ok := RouteParam(field.loc); ok {
+			if !slices.Contains(params, name) {
+				return fmt.Errorf("manifest: %s: %s {%s} is not a parameter of path %q", label, field.name, name, g.Path)
+			}
+			continue
+		}
+		if field.loc == "" || slices.Contains(strings.Split(field.loc, "."), "") {
+			return fmt.Errorf("manifest: %s: %s %q is not a {parameter} or a dotted JSON path", label, field.name, field.loc)
+		}
+	}
+	switch g.Allowlist {
+	case GuardAllowModels, GuardAllowMcps, GuardAllowChatTemplates, GuardAllowShellTemplates:
+	default:
+		return fmt.Errorf("manifest: %s: allowlist %q is not one of %s, %s, %s, %s", label, g.Allowlist,
+			GuardAllowModels, GuardAllowMcps, GuardAllowChatTemplates, GuardAllowShellTemplates)
+	}
+	return nil
+}
+
+// EventsDecl is a Server-Sent Events endpoint on the service's internal
+// listener. Relay holds a GET on it while the service is registered,
+// reconnecting when it drops, and republishes each event with the service's
+// instance ID as its source and the SSE event name as its type ("message"
+// when unnamed). Event data should be JSON; anything else is carried as a
+// string.
+type EventsDecl struct {
+	Path string `json:"path"`
+	// Types lists the event types the service sends. When set, relay drops
+	// any other; empty passes every valid type through.
+	Types []string `json:"types,omitempty"`
+}
+
+// maxEventTypeLen bounds an event type's length.
+const maxEventTypeLen = 64
+
+// ValidEventType reports whether typ can name an event: 1–64 characters
+// from [A-Za-z0-9._-], so it is safe to put on an SSE "event:" line and to
+// filter by prefix.
+func ValidEventType(typ string) bool {
+	if typ == "" || len(typ) > maxEventTypeLen {
+		return false
+	}
+	for _, c := range typ {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// reservedEventNamespaces are the type prefixes of relay's own events.
+var reservedEventNamespaces = []string{"project.", "mcp.", "service.", "stream."}
+
+// ReservedEventType reports whether typ is in one of relay's own event
+// namespaces, which a service may not publish into: a consumer filtering on
+// "project." must only ever get relay's project events.
+func ReservedEventType(typ string) bool {
+	for _, ns := range reservedEventNamespaces {
+		if strings.HasPrefix(typ, ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks an EventsDecl's path and declared types.
+func (e *EventsDecl) validate() error {
+	if !strings.HasPrefix(e.Path, "/") {
+		return fmt.Errorf("manifest: events.path %q must start with %q", e.Path, "/")
+	}
+	for i, typ := range e.Types {
+		if !ValidEventType(typ) {
+			return fmt.Errorf("manifest: events.types[%d] %q is not a valid event type", i, typ)
+		}
+		if ReservedEventType(typ) {
+			return fmt.Errorf("manifest: events.types[%d] %q is in a namespace relay reserves for its own events", i, typ)
+		}
+	}
+	return nil
 }
 
 // StatusDecl is the read-only status endpoint relay polls for the service.
@@ -54,13 +424,36 @@ type ActionDecl struct {
 	// substitutes the row's keys into PathTemplate's {placeholders}.
 	// Empty = single global button with no substitution.
 	ForEach string `json:"forEach,omitempty"`
+
+	// Inputs is a form the UI asks the user to fill in before the action
+	// runs, declared in the config schema's field language (so the same
+	// renderer draws it). The values are sent as the request's JSON body,
+	// one key per field, after relay has checked them against the schema.
+	// Empty = no form and no body. Not allowed on a GET.
+	Inputs []FieldDecl `json:"inputs,omitempty"`
+	// Confirm is a question the UI asks before the action runs ("Drop every
+	// cached model?"). Empty = no question unless Danger is set.
+	Confirm string `json:"confirm,omitempty"`
+	// Danger marks a destructive action: the UI styles it as one and asks
+	// for confirmation even when Confirm is empty.
+	Danger bool `json:"danger,omitempty"`
+}
+
+// NeedsConfirmation reports whether the user must confirm the action before
+// it runs. Relay refuses an unconfirmed dispatch of one, so a UI that forgot
+// to ask fails visibly rather than running it.
+func (a *ActionDecl) NeedsConfirmation() bool {
+	return a.Confirm != "" || a.Danger
 }
 
 // ConfigDecl declares one editable config file plus the schema relay uses to
 // render an editor for it. Carried in the Manifest at RegisterManifest time.
 // Relay reads and writes the file directly (the service hosts no endpoint),
 // treating the bytes as opaque text on the wire; Schema drives the settings-UI
-// form. The service is restarted to apply unless ApplyMode is "live".
+// form. The service is restarted to apply unless ApplyMode is "live"; a live
+// service either watches the file itself or declares Reload, which relay
+// calls after each save (ConfigReloadRequest) and which can refuse the new
+// file — relay then puts the previous version back.
 //
 // Path is validated here as absolute + no ".." segment (schema-level only).
 // Relay re-validates it against an allowed root and a regular-file check at use
@@ -72,9 +465,32 @@ type ConfigDecl struct {
 	Label     string      `json:"label,omitempty"`     // UI header, e.g. "settings.json"
 	Help      string      `json:"help,omitempty"`      // one-line description under the header
 	ApplyMode string      `json:"applyMode,omitempty"` // "restart" (default) | "live"
+	Reload    string      `json:"reload,omitempty"`    // internal path relay POSTs to after a live save; needs applyMode "live"
 	Schema    []FieldDecl `json:"schema"`              // top-level fields of the config object
 }
 
+// ConfigReloadRequest is the JSON body of relay's POST to a ConfigDecl's
+// Reload path, sent once the new file is on disk. Hash is the file's
+// SHA-256 ("sha256:<hex>"), so the service can tell it read the version
+// relay wrote and not one that changed under it.
+//
+// The service answers 2xx once it has applied the file, optionally echoing
+// the hash of what it loaded (ConfigReloadResponse); a different hash is
+// reported as a failed reload. It answers 400, 409 or 422, with Error
+// saying why, when the file is valid JSON but not a config it will run
+// with — relay then restores the previous version. Anything else (another
+// 4xx, a 5xx, no answer) leaves the new file in place and tells the user
+// the reload wasn't confirmed.
+type ConfigReloadRequest struct {
+	Hash string `json:"hash"`
+}
+
+// ConfigReloadResponse is the optional JSON body of a reload's answer.
+type ConfigReloadResponse struct {
+	Hash  string `json:"hash,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
 // FieldDecl describes one node in a config schema. Leaf types render a single
 // input; the recursive types (object/array/map) nest. The same declaration
 // drives both the form layout and the harvest/serialize back to JSON in the UI.
@@ -170,7 +586,7 @@ func (r *RegisterManifestRequest) Validate() error {
 // against other registered manifests is the relay router's job — this only
 // validates the manifest in isolation.
 func (m *Manifest) Validate() error {
-	if len(m.Routes) == 0 {
+	if len(m.Routes) == 0 && len(m.RouteRules) == 0 {
 		return fmt.Errorf("manifest: routes is empty")
 	}
 	seen := make(map[string]bool, len(m.Routes))
@@ -186,6 +602,21 @@ func (m *Manifest) Validate() error {
 		}
 		seen[r] = true
 	}
+	for i := range m.RouteRules {
+		if err := m.RouteRules[i].validate(fmt.Sprintf("routeRules[%d]", i)); err != nil {
+			return err
+		}
+	}
+	// A manifest's own routes follow the rule other services' do: routes
+	// that would tie for a request are refused, whichever list they're in.
+	all := m.AllRoutes()
+	for i := range all {
+		for j := range i {
+			if all[i].Collides(all[j]) {
+				return fmt.Errorf("manifest: route %q collides with route %q", all[i].Path, all[j].Path)
+			}
+		}
+	}
 	if m.Status != nil {
 		if !strings.HasPrefix(m.Status.Path, "/") {
 			return fmt.Errorf("manifest: status.path %q must start with %q", m.Status.Path, "/")
@@ -217,12 +648,37 @@ func (m *Manifest) Validate() error {
 		if !strings.HasPrefix(a.PathTemplate, "/") {
 			return fmt.Errorf("manifest: actions[%d] (%q): pathTemplate %q must start with %q", i, a.ID, a.PathTemplate, "/")
 		}
+		if len(a.Inputs) > 0 {
+			// The inputs travel as the body, and a GET's body is one many
+			// servers and proxies drop without a word.
+			if method == "GET" {
+				return fmt.Errorf("manifest: actions[%d] (%q): a GET action can't take inputs", i, a.ID)
+			}
+			if err := validateFields(fmt.Sprintf("actions[%d].inputs", i), a.Inputs); err != nil {
+				return err
+			}
+		}
 	}
 	if m.Config != nil {
 		if err := m.Config.validate(); err != nil {
 			return err
 		}
 	}
+	if m.Events != nil {
+		if err := m.Events.validate(); err != nil {
+			return err
+		}
+	}
+	if m.Dispatch != nil {
+		if err := m.Dispatch.validate(); err != nil {
+			return err
+		}
+	}
+	for i := range m.Guards {
+		if err := m.Guards[i].validate(fmt.Sprintf("guards[%d]", i)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -251,6 +707,14 @@ func (c *ConfigDecl) validate() error {
 	default:
 		return fmt.Errorf("manifest: config.applyMode %q is not supported", c.ApplyMode)
 	}
+	if c.Reload != "" {
+		if c.ApplyMode != ConfigApplyLive {
+			return fmt.Errorf("manifest: config.reload needs applyMode %q (a restart re-reads the file anyway)", ConfigApplyLive)
+		}
+		if !strings.HasPrefix(c.Reload, "/") {
+			return fmt.Errorf("manifest: config.reload %q must start with %q", c.Reload, "/")
+		}
+	}
 	if len(c.Schema) == 0 {
 		return fmt.Errorf("manifest: config.schema is empty")
 	}
@@ -2,6 +2,7 @@ package bridge
 
 import (
 	"encoding/json"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -17,6 +18,9 @@ func TestActionDecl_JSONRoundTrip_PreservesForEach(t *testing.T) {
 		Method:       "DELETE",
 		PathTemplate: "/api/llama/instances/{alias}",
 		ForEach:      "instances",
+		Inputs:       []FieldDecl{{ID: "reason", Type: FieldTypeText}},
+		Confirm:      "Stop this instance?",
+		Danger:       true,
 	}
 	raw, err := json.Marshal(original)
 	if err != nil {
@@ -27,12 +31,17 @@ func TestActionDecl_JSONRoundTrip_PreservesForEach(t *testing.T) {
 	if !strings.Contains(string(raw), `"forEach":"instances"`) {
 		t.Errorf("forEach not present in JSON: %s", raw)
 	}
+	for _, key := range []string{`"inputs":[`, `"confirm":"Stop this instance?"`, `"danger":true`} {
+		if !strings.Contains(string(raw), key) {
+			t.Errorf("%s not present in JSON: %s", key, raw)
+		}
+	}
 
 	var got ActionDecl
 	if err := json.Unmarshal(raw, &got); err != nil {
 		t.Fatalf("unmarshal: %v", err)
 	}
-	if got != original {
+	if !reflect.DeepEqual(got, original) {
 		t.Errorf("round-trip mismatch:\n got  %+v\n want %+v", got, original)
 	}
 }
@@ -181,6 +190,30 @@ func TestManifestValidate_ConfigRejectsRelativePath(t *testing.T) {
 	}
 }
 
+func TestManifestValidate_ConfigReload(t *testing.T) {
+	decl := func(mode, reload string) *ConfigDecl {
+		return &ConfigDecl{Path: "/srv/app/config.json", ApplyMode: mode, Reload: reload, Schema: []FieldDecl{{ID: "x", Type: FieldTypeText}}}
+	}
+	ok := Manifest{Routes: []string{"/api/"}, Config: decl(ConfigApplyLive, "/admin/reload")}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("live config with reload rejected: %v", err)
+	}
+	for _, tc := range []struct {
+		name string
+		c    *ConfigDecl
+		want string
+	}{
+		{"reload without live", decl(ConfigApplyRestart, "/admin/reload"), "needs applyMode"},
+		{"reload with default mode", decl("", "/admin/reload"), "needs applyMode"},
+		{"relative reload", decl(ConfigApplyLive, "admin/reload"), "must start with"},
+	} {
+		m := Manifest{Routes: []string{"/api/"}, Config: tc.c}
+		if err := m.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tc.name, err, tc.want)
+		}
+	}
+}
+
 func TestManifestValidate_ConfigRejectsDotDotPath(t *testing.T) {
 	m := Manifest{
 		Routes: []string{"/api/"},
@@ -253,3 +286,250 @@ func TestManifestValidate_ConfigRejectsDuplicateSiblingIDs(t *testing.T) {
 		t.Errorf("want duplicate-id error, got %v", err)
 	}
 }
+
+func TestManifestValidate_RouteRules(t *testing.T) {
+	m := Manifest{RouteRules: []RouteDecl{
+		{Path: "/v2/{tenant}/llm/", Methods: []string{"get", "Post"}, StripPrefix: "/v2/{tenant}/llm", AddPrefix: "/api/{tenant}"},
+		{Path: "/api/jobs", Priority: 5},
+	}}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := m.RouteRules[0].Methods; got[0] != "GET" || got[1] != "POST" {
+		t.Errorf("methods not normalized: %v", got)
+	}
+}
+
+// RouteRules alone are enough: Routes may be left out.
+func TestManifestValidate_RouteRulesWithoutRoutes(t *testing.T) {
+	m := Manifest{RouteRules: []RouteDecl{{Path: "/api/"}}}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestManifestValidate_RouteRulesRejected(t *testing.T) {
+	cases := []struct {
+		name string
+		rule RouteDecl
+		want string
+	}{
+		{"empty path", RouteDecl{}, "path is empty"},
+		{"relative path", RouteDecl{Path: "api/"}, "must start with"},
+		{"partial param", RouteDecl{Path: "/api/x{id}/"}, "whole segment"},
+		{"bad param name", RouteDecl{Path: "/api/{1d}/"}, "not an identifier"},
+		{"repeated param", RouteDecl{Path: "/api/{id}/{id}"}, "repeated"},
+		{"unknown method", RouteDecl{Path: "/api/", Methods: []string{"BREW"}}, "not a supported HTTP verb"},
+		{"strip not a prefix", RouteDecl{Path: "/api/x/", StripPrefix: "/other"}, "not a leading part"},
+		{"strip mid-segment", RouteDecl{Path: "/api/xyz/", StripPrefix: "/api/x"}, "not a leading part"},
+		{"strip trailing slash", RouteDecl{Path: "/api/x/", StripPrefix: "/api/"}, "must not end with"},
+		{"add trailing slash", RouteDecl{Path: "/api/x/", AddPrefix: "/v1/"}, "must not end with"},
+		{"add unknown param", RouteDecl{Path: "/api/{id}/", AddPrefix: "/t/{tenant}"}, "does not declare"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := Manifest{RouteRules: []RouteDecl{c.rule}}
+			err := m.Validate()
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("err = %v, want one containing %q", err, c.want)
+			}
+		})
+	}
+}
+
+// Within one manifest, routes that would tie are refused just as they are
+// between services; routes told apart by method or priority are not.
+func TestManifestValidate_RouteCollisions(t *testing.T) {
+	collide := []Manifest{
+		{Routes: []string{"/api/"}, RouteRules: []RouteDecl{{Path: "/api/", Methods: []string{"GET"}}}},
+		{RouteRules: []RouteDecl{{Path: "/p/{id}"}, {Path: "/p/{name}"}}},
+	}
+	for i, m := range collide {
+		if err := m.Validate(); err == nil || !strings.Contains(err.Error(), "collides") {
+			t.Errorf("manifest %d: err = %v, want a collision", i, err)
+		}
+	}
+	distinct := []Manifest{
+		{RouteRules: []RouteDecl{{Path: "/api/", Methods: []string{"GET"}}, {Path: "/api/", Methods: []string{"POST"}}}},
+		{Routes: []string{"/api/"}, RouteRules: []RouteDecl{{Path: "/api/", Priority: 1}}},
+		{RouteRules: []RouteDecl{{Path: "/p/{id}"}, {Path: "/p/{id}/"}}},
+	}
+	for i, m := range distinct {
+		if err := m.Validate(); err != nil {
+			t.Errorf("manifest %d: %v", i, err)
+		}
+	}
+}
+
+func TestRouteDecl_Collides(t *testing.T) {
+	cases := []struct {
+		a, b RouteDecl
+		want bool
+	}{
+		{RouteDecl{Path: "/a/"}, RouteDecl{Path: "/a/"}, true},
+		{RouteDecl{Path: "/a/"}, RouteDecl{Path: "/a"}, false},
+		{RouteDecl{Path: "/a/"}, RouteDecl{Path: "/a/b/"}, false},
+		{RouteDecl{Path: "/a/{x}"}, RouteDecl{Path: "/a/{y}"}, true},
+		{RouteDecl{Path: "/a/{x}"}, RouteDecl{Path: "/a/b"}, false},
+		{RouteDecl{Path: "/a/", Methods: []string{"GET"}}, RouteDecl{Path: "/a/"}, true},
+		{RouteDecl{Path: "/a/", Methods: []string{"GET", "PUT"}}, RouteDecl{Path: "/a/", Methods: []string{"put"}}, true},
+		{RouteDecl{Path: "/a/", Methods: []string{"GET"}}, RouteDecl{Path: "/a/", Methods: []string{"POST"}}, false},
+		{RouteDecl{Path: "/a/", Priority: 1}, RouteDecl{Path: "/a/"}, false},
+	}
+	for _, c := range cases {
+		if got := c.a.Collides(c.b); got != c.want {
+			t.Errorf("%+v.Collides(%+v) = %v, want %v", c.a, c.b, got, c.want)
+		}
+		if got := c.b.Collides(c.a); got != c.want {
+			t.Errorf("Collides is not symmetric for %+v, %+v", c.a, c.b)
+		}
+	}
+}
+
+// Routes keep their JSON name and RouteRules are left out when unset, so a
+// manifest from a service that predates them reads the same either way.
+func TestManifest_RouteRulesOmittedWhenEmpty(t *testing.T) {
+	data, err := json.Marshal(Manifest{Routes: []string{"/api/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "routeRules") {
+		t.Errorf("marshalled %s, want no routeRules", data)
+	}
+	var m Manifest
+	if err := json.Unmarshal([]byte(`{"routes":["/a/"],"routeRules":[{"path":"/b/","methods":["GET"],"stripPrefix":"/b","addPrefix":"/v1","priority":2}]}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	want := RouteDecl{Path: "/b/", Methods: []string{"GET"}, StripPrefix: "/b", AddPrefix: "/v1", Priority: 2}
+	if got := m.AllRoutes(); len(got) != 2 || got[0].Path != "/a/" || got[1].Path != want.Path ||
+		got[1].StripPrefix != want.StripPrefix || got[1].AddPrefix != want.AddPrefix || got[1].Priority != want.Priority {
+		t.Errorf("AllRoutes = %+v", got)
+	}
+}
+
+func TestManifestValidate_Events(t *testing.T) {
+	ok := Manifest{Routes: []string{"/api/"}, Events: &EventsDecl{Path: "/api/events", Types: []string{"session.started", "job_done-2"}}}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("valid events rejected: %v", err)
+	}
+	cases := []struct {
+		name string
+		decl EventsDecl
+		want string
+	}{
+		{"relative path", EventsDecl{Path: "events"}, "must start with"},
+		{"empty type", EventsDecl{Path: "/e", Types: []string{""}}, "not a valid event type"},
+		{"type with space", EventsDecl{Path: "/e", Types: []string{"a b"}}, "not a valid event type"},
+		{"type with newline", EventsDecl{Path: "/e", Types: []string{"a\nevent: x"}}, "not a valid event type"},
+		{"reserved namespace", EventsDecl{Path: "/e", Types: []string{"service.exited"}}, "reserves"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			m := Manifest{Routes: []string{"/api/"}, Events: &c.decl}
+			err := m.Validate()
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("err = %v, want one containing %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestValidEventType(t *testing.T) {
+	for typ, want := range map[string]bool{
+		"message":               true,
+		"session.started":       true,
+		"A_b-9.c":               true,
+		"":                      false,
+		"café":                  false,
+		"a:b":                   false,
+		strings.Repeat("x", 64): true,
+		strings.Repeat("x", 65): false,
+	} {
+		if got := ValidEventType(typ); got != want {
+			t.Errorf("ValidEventType(%q) = %v, want %v", typ, got, want)
+		}
+	}
+	if !ReservedEventType("project.created") || ReservedEventType("projects.created") {
+		t.Error("ReservedEventType must match relay's namespaces by their dotted prefix")
+	}
+}
+
+func TestManifestValidate_Dispatch(t *testing.T) {
+	ok := Manifest{Routes: []string{"/api/"}, Dispatch: &DispatchDecl{FailureThreshold: 5, OpenSeconds: 10, RetryOnRestart: true}}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("valid dispatch rejected: %v", err)
+	}
+	for _, d := range []DispatchDecl{{FailureThreshold: -1}, {FailureThreshold: 101}, {OpenSeconds: -5}, {OpenSeconds: 301}} {
+		m := Manifest{Routes: []string{"/api/"}, Dispatch: &d}
+		if err := m.Validate(); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("%+v: err = %v, want out of range", d, err)
+		}
+	}
+}
+
+func TestManifestValidate_Guards(t *testing.T) {
+	m := Manifest{Routes: []string{"/api/"}, Guards: []GuardDecl{
+		{Path: "/api/chat", Project: "projectId", Value: "options.model", Allowlist: GuardAllowModels},
+		{Path: "/api/run/{project}/{template}", Methods: []string{"get"}, Project: "{project}", Value: "{template}", Allowlist: GuardAllowShellTemplates},
+	}}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("valid guards rejected: %v", err)
+	}
+	if got := m.Guards[0].Methods; len(got) != 1 || got[0] != "POST" {
+		t.Errorf("default methods = %v, want [POST]", got)
+	}
+	if got := m.Guards[1].Methods; got[0] != "GET" {
+		t.Errorf("methods = %v, want upper-cased", got)
+	}
+
+	for _, tc := range []struct {
+		name string
+		g    GuardDecl
+		want string
+	}{
+		{"unknown allowlist", GuardDecl{Path: "/api/chat", Project: "p", Value: "v", Allowlist: "voices"}, "allowlist"},
+		{"param not in path", GuardDecl{Path: "/api/chat/{id}", Project: "{project}", Value: "v", Allowlist: GuardAllowMcps}, "not a parameter"},
+		{"empty segment", GuardDecl{Path: "/api/chat", Project: "p", Value: "options..model", Allowlist: GuardAllowModels}, "dotted JSON path"},
+		{"no project", GuardDecl{Path: "/api/chat", Value: "model", Allowlist: GuardAllowModels}, "dotted JSON path"},
+		{"bad method", GuardDecl{Path: "/api/chat", Methods: []string{"BREW"}, Project: "p", Value: "v", Allowlist: GuardAllowModels}, "HTTP verb"},
+		{"bad path", GuardDecl{Path: "api/chat", Project: "p", Value: "v", Allowlist: GuardAllowModels}, "guards[0]"},
+	} {
+		m := Manifest{Routes: []string{"/api/"}, Guards: []GuardDecl{tc.g}}
+		if err := m.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestManifestValidate_ActionInputs(t *testing.T) {
+	ok := Manifest{Routes: []string{"/api/"}, Actions: []ActionDecl{{
+		ID: "pull", Label: "Pull model", Method: "post", PathTemplate: "/api/models/pull",
+		Inputs:  []FieldDecl{{ID: "name", Type: FieldTypeText, Required: true}, {ID: "quant", Type: FieldTypeSelect, Options: []string{"q4", "q8"}}},
+		Confirm: "Download this model?",
+	}}}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("valid inputs rejected: %v", err)
+	}
+	if !ok.Actions[0].NeedsConfirmation() {
+		t.Error("an action with a confirm question doesn't need confirmation")
+	}
+	if (&ActionDecl{Danger: true}).NeedsConfirmation() != true || (&ActionDecl{}).NeedsConfirmation() {
+		t.Error("NeedsConfirmation: want it for danger alone and not for a plain action")
+	}
+
+	for _, tc := range []struct {
+		name string
+		a    ActionDecl
+		want string
+	}{
+		{"GET with inputs", ActionDecl{ID: "x", Label: "X", Method: "GET", PathTemplate: "/x", Inputs: []FieldDecl{{ID: "a", Type: FieldTypeText}}}, "GET action"},
+		{"bad input type", ActionDecl{ID: "x", Label: "X", Method: "POST", PathTemplate: "/x", Inputs: []FieldDecl{{ID: "a", Type: "colour"}}}, "actions[0].inputs.a"},
+		{"select without options", ActionDecl{ID: "x", Label: "X", Method: "POST", PathTemplate: "/x", Inputs: []FieldDecl{{ID: "a", Type: FieldTypeSelect}}}, "requires options"},
+		{"duplicate input", ActionDecl{ID: "x", Label: "X", Method: "POST", PathTemplate: "/x", Inputs: []FieldDecl{{ID: "a", Type: FieldTypeText}, {ID: "a", Type: FieldTypeBool}}}, "duplicated"},
+	} {
+		m := Manifest{Routes: []string{"/api/"}, Actions: []ActionDecl{tc.a}}
+		if err := m.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want it to mention %q", tc.name, err, tc.want)
+		}
+	}
+}
@@ -144,6 +144,10 @@ var bridgeHandlers = map[string]bridgeHandler{
 	ReqResolvePtyEnv:          {handle: handleResolvePtyEnv},
 	ReqResolveProjectTemplate: {handle: handleResolveProjectTemplate},
 	ReqRegisterManifest:       {handle: handleRegisterManifest},
+	ReqMcpStatus:              {requireAdmin: true, handle: handleMcpStatus},
+	ReqServiceStatus:          {requireAdmin: true, handle: handleServiceStatus},
+	ReqRunJob:                 {requireAdmin: true, handle: handleRunJob},
+	ReqResourceMetrics:        {requireAdmin: true, handle: handleResourceMetrics},
 }
 
 func (s *BridgeServer) handleRequest(ctx context.Context, line string) BridgeResponse {
@@ -170,6 +174,7 @@ func (s *BridgeServer) handleRequest(ctx context.Context, line string) BridgeRes
 	if req.Token == "" {
 		ctx = WithCallerCwd(ctx, req.Cwd)
 	}
+	ctx = WithRequestID(ctx, req.RequestID)
 
 	return h.handle(ctx, &req, s.router)
 }
@@ -286,3 +291,68 @@ func handleRegisterManifest(ctx context.Context, req *BridgeRequest, router Tool
 	}
 	return BridgeResponse{Type: RespOK}
 }
+
+func handleMcpStatus(ctx context.Context, _ *BridgeRequest, router ToolRouter) BridgeResponse {
+	sr, ok := router.(McpStatusRouter)
+	if !ok {
+		return bridgeError(jsonrpc.CodeMethodNotFound, "mcp status not supported by this router")
+	}
+	statuses, err := sr.McpStatus(ctx)
+	if err != nil {
+		return bridgeError(classifyErrorCode(err), err.Error())
+	}
+	data, err := json.Marshal(statuses)
+	if err != nil {
+		return bridgeError(jsonrpc.CodeInternalError, err.Error())
+	}
+	return BridgeResponse{Type: RespMcpStatus, Data: data}
+}
+
+func handleServiceStatus(ctx context.Context, _ *BridgeRequest, router ToolRouter) BridgeResponse {
+	sr, ok := router.(ServiceStatusRouter)
+	if !ok {
+		return bridgeError(jsonrpc.CodeMethodNotFound, "service status not supported by this router")
+	}
+	statuses, err := sr.ServiceStatus(ctx)
+	if err != nil {
+		return bridgeError(classifyErrorCode(err), err.Error())
+	}
+	data, err := json.Marshal(statuses)
+	if err != nil {
+		return bridgeError(jsonrpc.CodeInternalError, err.Error())
+	}
+	return BridgeResponse{Type: RespServiceStatus, Data: data}
+}
+
+func handleRunJob(_ context.Context, req *BridgeRequest, router ToolRouter) BridgeResponse {
+	jr, ok := router.(JobRunner)
+	if !ok {
+		return bridgeError(jsonrpc.CodeMethodNotFound, "running jobs not supported by this router")
+	}
+	if err := jr.RunJob(req.Name); err != nil {
+		return bridgeError(classifyErrorCode(err), err.Error())
+	}
+	return BridgeResponse{Type: RespOK}
+}
+
+func handleResourceMetrics(ctx context.Context, req *BridgeRequest, router ToolRouter) BridgeResponse {
+	mr, ok := router.(ResourceMetricsRouter)
+	if !ok {
+		return bridgeError(jsonrpc.CodeMethodNotFound, "resource metrics not supported by this router")
+	}
+	var r ResourceMetricsRequest
+	if len(req.Arguments) > 0 {
+		if err := json.Unmarshal(req.Arguments, &r); err != nil {
+			return bridgeError(jsonrpc.CodeParseError, "resource_metrics: "+err.Error())
+		}
+	}
+	metrics, err := mr.ResourceMetrics(ctx, r)
+	if err != nil {
+		return bridgeError(classifyErrorCode(err), err.Error())
+	}
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return bridgeError(jsonrpc.CodeInternalError, err.Error())
+	}
+	return BridgeResponse{Type: RespResourceMetrics, Data: data}
+}
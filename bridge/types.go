@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // MaxMessageSize is the maximum line/message size for bridge and MCP wire protocols.
@@ -24,6 +25,10 @@ const (
 	ReqResolvePtyEnv          = "ResolvePtyEnv"
 	ReqResolveProjectTemplate = "ResolveProjectTemplate"
 	ReqRegisterManifest       = "RegisterManifest"
+	ReqMcpStatus              = "McpStatus"
+	ReqServiceStatus          = "ServiceStatus"
+	ReqRunJob                 = "RunJob"
+	ReqResourceMetrics        = "ResourceMetrics"
 )
 
 // Response type constants for the bridge wire protocol.
@@ -36,6 +41,9 @@ const (
 	RespProject         = "Project"
 	RespPtyEnv          = "PtyEnv"
 	RespProjectTemplate = "ProjectTemplate"
+	RespMcpStatus       = "McpStatus"
+	RespServiceStatus   = "ServiceStatus"
+	RespResourceMetrics = "ResourceMetrics"
 	// RespProgress is an intermediate, non-terminal frame emitted zero or more
 	// times during an in-flight CallTool before the terminal Result/Error.
 	// Clients that don't understand it skip it and keep reading.
@@ -63,6 +71,12 @@ const (
 	EnvServiceID      = "RELAY_SERVICE_ID"
 	EnvMcpCommand     = "RELAY_MCP_COMMAND"
 
+	// EnvServiceReplica is the replica index (0, 1, ...) of a service run
+	// as several processes. Each replica still gets the same EnvServiceID
+	// and registers its manifest under it; the index is for picking
+	// per-replica resources such as its internal socket path.
+	EnvServiceReplica = "RELAY_SERVICE_REPLICA"
+
 	// EnvServiceToken carries the ephemeral, full-access service token relay
 	// injects into every spawned service so it can authenticate its own bridge
 	// calls (ResolvePtyEnv, RegisterManifest). It is NOT a project token and
@@ -143,6 +157,13 @@ type BridgeRequest struct {
 	Token     string          `json:"token,omitempty"`      // auth token
 	ProjectID string          `json:"project_id,omitempty"` // for GetProject
 
+	// RequestID ties the call to the frontend request it was made on behalf
+	// of: a service handling a proxied request passes on the X-Request-ID
+	// relay stamped on it, and relay records it in the audit event, so the
+	// frontend access log and the audit log can be joined. Attribution
+	// only; an ID failing ValidRequestID is ignored.
+	RequestID string `json:"request_id,omitempty"`
+
 	// Cwd is the caller's working directory, sent ONLY when no token is set. It
 	// selects a project that has opted into directory auth (Project.AllowCwdAuth);
 	// relay ignores it whenever a token is present, so it can never widen the
@@ -240,6 +261,51 @@ func CallerPIDFromContext(ctx context.Context) int {
 	return pid
 }
 
+// RequestIDHeader is the HTTP header carrying a frontend request's
+// correlation ID. Relay sets it on every request it proxies to a service
+// (honouring one the client sent), and a service passes it back on the
+// bridge calls it makes for that request (BridgeRequest.RequestID).
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen caps a correlation ID; generated ones are 36 bytes.
+const maxRequestIDLen = 128
+
+// ValidRequestID reports whether id is usable as a correlation ID: 1 to 128
+// letters, digits, and '-', '_', '.', ':'. Anything else is replaced (at the
+// front door) or dropped (on the bridge) rather than written into a log.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type requestIDCtxKey struct{}
+
+// WithRequestID returns ctx carrying the frontend correlation ID a call was
+// made under. Carried in the context like the caller pid, and for the same
+// reason. An ID failing ValidRequestID returns ctx unchanged.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if !ValidRequestID(id) {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestIDFromContext returns the correlation ID set by WithRequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
 // ToolRouter handles bridge requests. Implemented by the main app.
 type ToolRouter interface {
 	ListTools(ctx context.Context, token string) (json.RawMessage, error)
@@ -265,6 +331,177 @@ type ToolRouter interface {
 	RegisterManifest(ctx context.Context, req RegisterManifestRequest, token string) error
 }
 
+// McpStatus is one external MCP's runtime state, returned as a JSON array in
+// BridgeResponse.Data for ReqMcpStatus. AuthState is empty for stdio MCPs and
+// otherwise one of "none", "authenticated", "refreshing", "needs_reauth".
+// LastExit is set once a stdio MCP's process has died ("exited: status 1",
+// "killed: memory limit exceeded"); Limit names the resource limit that
+// killed it, if one did.
+type McpStatus struct {
+	ID        string `json:"id"`
+	Connected bool   `json:"connected"`
+	AuthState string `json:"auth_state,omitempty"`
+	LastExit  string `json:"last_exit,omitempty"`
+	Limit     string `json:"limit,omitempty"`
+}
+
+// McpStatusRouter is the optional capability behind ReqMcpStatus. Kept off
+// ToolRouter so routers implemented in other repos don't have to grow a
+// method they have no use for; the server type-asserts and answers
+// method-not-found when it's absent. Admin authentication required.
+type McpStatusRouter interface {
+	McpStatus(ctx context.Context) ([]McpStatus, error)
+}
+
+// ServiceStatus is one managed service's runtime state, returned as a JSON
+// array in BridgeResponse.Data for ReqServiceStatus. LastExit describes how
+// the most recent run ended and is kept until the next one does; Limit names
+// the resource limit that killed it ("memory", "processes"), if one did.
+//
+// The restart fields follow the service's restart policy: Restarts counts
+// automatic restarts since the tray started, NextRestart is set while one is
+// scheduled, CrashLoop once the policy has given up, and RestartHistory
+// lists the most recent restarts, oldest first.
+type ServiceStatus struct {
+	ID       string `json:"id"`
+	Running  bool   `json:"running"`
+	PID      int    `json:"pid,omitempty"`
+	LastExit string `json:"last_exit,omitempty"`
+	Limit    string `json:"limit,omitempty"`
+
+	RestartPolicy  string           `json:"restart_policy,omitempty"`
+	Restarts       int              `json:"restarts,omitempty"`
+	NextRestart    *time.Time       `json:"next_restart,omitempty"`
+	CrashLoop      bool             `json:"crash_loop,omitempty"`
+	RestartHistory []ServiceRestart `json:"restart_history,omitempty"`
+
+	// Health is "starting", "ready" or "unhealthy" for a running service
+	// with a health check, else empty. HealthError is the latest probe
+	// failure, cleared by a pass.
+	Health      string `json:"health,omitempty"`
+	HealthError string `json:"health_error,omitempty"`
+
+	// Kind is "job" for a scheduled or one-shot job, whose Running means a
+	// run is in progress; else empty. Scheduled is set while the job's
+	// schedule is armed, NextRun to when it next fires, and JobRuns lists
+	// its most recent runs, oldest first.
+	Kind      string     `json:"kind,omitempty"`
+	Scheduled bool       `json:"scheduled,omitempty"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	JobRuns   []JobRun   `json:"job_runs,omitempty"`
+
+	// Listening lists the addresses relay holds open for a socket-activated
+	// service ("unix:/path", "tcp:host:port"), in file-descriptor order.
+	// AwaitingConnection is set while an on-demand one waits for its first
+	// connection to start it.
+	Listening          []string `json:"listening,omitempty"`
+	AwaitingConnection bool     `json:"awaiting_connection,omitempty"`
+
+	// Replicas lists each process of a service run as several, by replica
+	// index; empty for a single-process service. Running and PID above
+	// then describe the lowest-numbered running replica.
+	Replicas []ServiceReplica `json:"replicas,omitempty"`
+
+	// Circuit is the front door's circuit breaker for a registered
+	// single-process service: "open" while it fails requests fast,
+	// "half_open" while a probe decides; empty when closed. A replicated
+	// service reports it per replica.
+	Circuit string `json:"circuit,omitempty"`
+}
+
+// ServiceReplica is one process of a replicated service: whether it runs,
+// its readiness, whether it has registered its manifest, and the front
+// door's view of it — requests in flight, whether it is being drained for
+// a rolling restart, and its circuit breaker (as ServiceStatus.Circuit).
+type ServiceReplica struct {
+	Replica    int    `json:"replica"`
+	Running    bool   `json:"running"`
+	PID        int    `json:"pid,omitempty"`
+	Health     string `json:"health,omitempty"`
+	Registered bool   `json:"registered,omitempty"`
+	InFlight   int    `json:"in_flight,omitempty"`
+	Draining   bool   `json:"draining,omitempty"`
+	Circuit    string `json:"circuit,omitempty"`
+}
+
+// ServiceRestart is one automatic restart of a service: when its previous
+// run ended, how, which attempt this was since the last stable run, and the
+// backoff before the new run.
+type ServiceRestart struct {
+	At      time.Time `json:"at"`
+	Exit    string    `json:"exit"`
+	Attempt int       `json:"attempt"`
+	DelayMs int64     `json:"delay_ms"`
+}
+
+// JobRun is one run of a job: when it started, how long it took, its exit
+// code (-1 when there is none: killed by a signal, or it never ran) and how
+// it ended, and what started it ("start", "schedule", "manual", "queued").
+// A run that came due while the previous one was still going and was
+// skipped is listed too, with its Status saying so.
+type JobRun struct {
+	Start      time.Time `json:"start"`
+	DurationMs int64     `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+	Status     string    `json:"status"`
+	Trigger    string    `json:"trigger"`
+}
+
+// ServiceStatusRouter is the optional capability behind ReqServiceStatus;
+// see McpStatusRouter for why it's separate. Admin authentication required.
+type ServiceStatusRouter interface {
+	ServiceStatus(ctx context.Context) ([]ServiceStatus, error)
+}
+
+// JobRunner is the optional capability behind ReqRunJob: run the job named
+// by BridgeRequest.Name now. Admin authentication required.
+type JobRunner interface {
+	RunJob(id string) error
+}
+
+// ResourceMetricsRequest is the payload for ReqResourceMetrics, carried in
+// BridgeRequest.Arguments as JSON; an absent payload asks for everything.
+// Kind is "service" or "mcp" and ID one of that kind's IDs; either may be
+// empty to match all. Samples at or before Since are left out, so a caller
+// graphing usage can poll for just what is new.
+type ResourceMetricsRequest struct {
+	Kind  string    `json:"kind,omitempty"`
+	ID    string    `json:"id,omitempty"`
+	Since time.Time `json:"since,omitzero"`
+}
+
+// ResourceMetrics is one managed service's or stdio MCP's recent CPU and
+// memory history, returned as a JSON array in BridgeResponse.Data for
+// ReqResourceMetrics. The tray samples every running child on each status
+// poll and keeps a bounded window; Running is false once the child has
+// stopped, when the history is kept a while so its last minutes stay
+// visible. PID is the root process of the latest sample.
+type ResourceMetrics struct {
+	Kind    string           `json:"kind"`
+	ID      string           `json:"id"`
+	PID     int              `json:"pid,omitempty"`
+	Running bool             `json:"running"`
+	Samples []ResourceSample `json:"samples"`
+}
+
+// ResourceSample is one point of a ResourceMetrics history, summed over the
+// child's whole process group. CPUPercent is CPU used since the previous
+// sample as a share of one core, so a busy multi-threaded child can exceed
+// 100; it is 0 on a run's first sample.
+type ResourceSample struct {
+	At         time.Time `json:"at"`
+	CPUPercent float64   `json:"cpu_percent"`
+	RSSBytes   uint64    `json:"rss_bytes"`
+	Procs      int       `json:"procs"`
+}
+
+// ResourceMetricsRouter is the optional capability behind
+// ReqResourceMetrics; see McpStatusRouter for why it's separate. Admin
+// authentication required.
+type ResourceMetricsRouter interface {
+	ResourceMetrics(ctx context.Context, req ResourceMetricsRequest) ([]ResourceMetrics, error)
+}
+
 // NewScanner creates a bufio.Scanner configured with the standard bridge buffer
 // size. Used by both server and client to avoid duplicating buffer setup.
 func NewScanner(r io.Reader) *bufio.Scanner {
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"text/tabwriter"
@@ -64,6 +65,27 @@ func addRegisterFlags(fs *flag.FlagSet, opts *registerOpts) {
 	fs.Var(&opts.EnvPairs, "env", "environment KEY=VALUE (repeatable)")
 }
 
+// addLimitFlags adds the resource-limit flags shared by `mcp register` and
+// `service register`. Read the result back with limitsFromFlags.
+func addLimitFlags(fs *flag.FlagSet, l *ResourceLimits) {
+	fs.Int64Var(&l.MemoryMB, "memory-mb", 0, "memory limit in MB for the whole process tree (0 = unlimited)")
+	fs.IntVar(&l.CPUPercent, "cpu-percent", 0, "CPU limit as a percentage of one core (0 = unlimited)")
+	fs.IntVar(&l.OpenFiles, "open-files", 0, "open file descriptor limit per process (0 = unlimited)")
+	fs.IntVar(&l.Processes, "max-procs", 0, "process and thread limit for the whole tree (0 = unlimited)")
+}
+
+// limitsFromFlags returns the limits parsed by addLimitFlags, or nil when
+// none were given. Exits on invalid values.
+func limitsFromFlags(l ResourceLimits) *ResourceLimits {
+	if err := l.validate(); err != nil {
+		exitError("%v", err)
+	}
+	if !l.active() {
+		return nil
+	}
+	return &l
+}
+
 // resolveIDAndEnv validates name, resolves the ID, and parses env pairs.
 // Exits on validation failure.
 func (opts *registerOpts) resolveIDAndEnv() (id string, env map[string]string) {
@@ -197,5 +219,10 @@ func resolveAndRemove(store SettingsStore, entity, id, name string, resolveFn fu
 
 // newTabWriter returns a tabwriter configured for CLI list output.
 func newTabWriter() *tabwriter.Writer {
-	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	return newTabWriterTo(os.Stdout)
+}
+
+// newTabWriterTo is newTabWriter for output a test can capture.
+func newTabWriterTo(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
 }
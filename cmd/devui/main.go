@@ -70,6 +70,7 @@ func buildPage(html string) string {
 		"__RUNNING_IDS_JSON__", fixtureRunningIDs,
 		"__PROJECTS_JSON__", fixtureProjects,
 		"__MCP_TOOL_CACHE_JSON__", fixtureMcpToolCache,
+		"__MCP_AUTH_STATES_JSON__", fixtureMcpAuthStates,
 		"__ENROLMENTS_JSON__", fixtureEnrolments,
 		"__REMOTE_JSON__", fixtureRemote,
 		"__ENROLMENT_BUDGET_DEFAULTS_JSON__", fixtureEnrolmentBudgetDefaults,
@@ -136,6 +137,8 @@ const fixtureMcpToolCache = `{
   ]
 }`
 
+const fixtureMcpAuthStates = `{"krisp":"authenticated"}`
+
 // mockBridgeScript stands in for the WKWebView message bridge. ipc() in the page
 // takes the window.webkit branch, so every IPC posts here; we answer a few op
 // types with canned data and log the rest.
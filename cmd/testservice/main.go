@@ -86,6 +86,7 @@ func main() {
 		_ = json.NewEncoder(w).Encode(map[string]any{
 			"ok":      true,
 			"service": serviceID,
+			"replica": os.Getenv(bridge.EnvServiceReplica),
 			"path":    r.URL.Path,
 		})
 	})
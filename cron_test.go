@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron_Next(t *testing.T) {
+	// Thursday 2026-01-01 12:34:56 UTC.
+	from := time.Date(2026, 1, 1, 12, 34, 56, 0, time.UTC)
+	cases := []struct{ expr, want string }{
+		{"* * * * *", "2026-01-01 12:35"},
+		{"0 3 * * *", "2026-01-02 03:00"},
+		{"*/15 * * * *", "2026-01-01 12:45"},
+		{"0-10/5 13 * * *", "2026-01-01 13:00"},
+		{"5/20 * * * *", "2026-01-01 12:45"},
+		{"30 9 * * mon-fri", "2026-01-02 09:30"},
+		{"0 0 * * 7", "2026-01-04 00:00"},
+		{"0 0 1 jun *", "2026-06-01 00:00"},
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+		// Both day fields restricted: either matches (the 15th, or a Monday).
+		{"0 0 15 * 1", "2026-01-05 00:00"},
+		// One day field is *: both must match.
+		{"0 0 */2 * 1", "2026-01-05 00:00"},
+		{"@hourly", "2026-01-01 13:00"},
+		{"@weekly", "2026-01-04 00:00"},
+		{"@MONTHLY", "2026-02-01 00:00"},
+	}
+	for _, c := range cases {
+		s, err := parseCron(c.expr)
+		if err != nil {
+			t.Errorf("%q: %v", c.expr, err)
+			continue
+		}
+		if got := s.next(from).Format("2006-01-02 15:04"); got != c.want {
+			t.Errorf("%q: next = %s, want %s", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestCron_NextInLocalZone(t *testing.T) {
+	loc := time.FixedZone("IST", 5*3600+1800)
+	s, err := parseCron("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.next(time.Date(2026, 1, 1, 12, 0, 0, 0, loc))
+	if want := time.Date(2026, 1, 2, 3, 0, 0, 0, loc); !got.Equal(want) {
+		t.Fatalf("next = %v, want %v", got, want)
+	}
+}
+
+func TestCron_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"x * * * *",
+		"@fortnightly",
+		"0 0 30 2 *", // never fires
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) accepted", expr)
+		}
+	}
+}
@@ -8,9 +8,11 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"relaygo/bridge"
@@ -24,13 +26,79 @@ import (
 // dispatched HTTP request to this service — it owns a connection-pooling
 // http.Transport, so per-request cost is one map lookup instead of a
 // fresh socket dial.
+//
+// A service run as several replicas (service_replicas.go) has one record
+// per replica, all with the same ServiceID; Replica tells them apart.
 type EnhancedService struct {
 	ServiceID      string
+	Replica        int
 	InternalSocket string
 	InternalToken  string
 	Manifest       bridge.Manifest
 	RegisteredAt   time.Time
 	proxy          *httputil.ReverseProxy
+	// routes are the manifest's routes compiled for Lookup.
+	routes []frontendRoute
+	// guards are the manifest's project guards compiled for the
+	// dispatcher (frontend_guards.go).
+	guards []frontendGuard
+	// stopEvents ends the replica's event feed (service_events.go); a no-op
+	// when its manifest declares no event stream.
+	stopEvents func()
+	// load is the dispatcher's bookkeeping for this replica. Unlike the
+	// rest of the record it is mutable, and shared by a re-registration's
+	// replacement record so requests already in flight stay counted.
+	load *replicaLoad
+}
+
+// replicaLoad counts the requests (and open WebSocket sessions) the
+// dispatcher has in flight to one replica, marks it draining while a
+// rolling restart waits for them to finish, and holds its circuit breaker
+// (frontend_breaker.go).
+type replicaLoad struct {
+	inflight atomic.Int64
+	draining atomic.Bool
+	breaker  circuitBreaker
+}
+
+// instance is the key the record, and its service's readiness, are kept
+// under: the replica's instance ID.
+func (s *EnhancedService) instance() string {
+	return instanceID(s.ServiceID, s.Replica)
+}
+
+// InFlight returns how many dispatched requests are still in flight to
+// this replica.
+func (s *EnhancedService) InFlight() int {
+	return int(s.load.inflight.Load())
+}
+
+// Draining reports whether a rolling restart is draining this replica.
+func (s *EnhancedService) Draining() bool {
+	return s.load.draining.Load()
+}
+
+// acquire counts a dispatched request against the replica, unless it is
+// draining. Counting before checking closes the race with Drain, which
+// marks the replica before reading the count.
+func (s *EnhancedService) acquire() bool {
+	s.load.inflight.Add(1)
+	if s.load.draining.Load() {
+		s.load.inflight.Add(-1)
+		return false
+	}
+	return true
+}
+
+// release ends a request acquire counted.
+func (s *EnhancedService) release() {
+	s.load.inflight.Add(-1)
+}
+
+// Circuit returns the state of the replica's circuit breaker: "open",
+// "half_open", or "" when closed.
+func (s *EnhancedService) Circuit() string {
+	return s.load.breaker.status().String()
 }
 
 // internalUnixHostURL is the placeholder host portion used for all
@@ -64,7 +132,9 @@ func newUnixHTTPTransport(socket string) *http.Transport {
 // newServiceProxy builds the reverse proxy used to forward HTTP requests
 // to this service. Strips inbound Authorization (the frontend's token,
 // already validated) and injects the service-declared internal token.
-func newServiceProxy(serviceID, internalSocket, internalToken string) *httputil.ReverseProxy {
+// report, when set, hears each request's outcome — nil for a response,
+// the transport error otherwise — for the circuit breaker.
+func newServiceProxy(serviceID, internalSocket, internalToken string, report func(context.Context, error)) *httputil.ReverseProxy {
 	rp := httputil.NewSingleHostReverseProxy(dispatcherTargetURL)
 	rp.Transport = newUnixHTTPTransport(internalSocket)
 	rp.FlushInterval = -1
@@ -76,9 +146,42 @@ func newServiceProxy(serviceID, internalSocket, internalToken string) *httputil.
 			req.Header.Set("Authorization", "Bearer "+internalToken)
 		}
 	}
+	// The front door answers CORS for every service (frontendCORS), so a
+	// service's own Access-Control-* headers are dropped; copied through,
+	// they'd duplicate relay's and the browser would reject both. So is a
+	// service's echo of X-Request-ID: the front door has already set it.
+	rp.ModifyResponse = func(resp *http.Response) error {
+		if report != nil {
+			report(resp.Request.Context(), nil)
+		}
+		for name := range resp.Header {
+			if strings.HasPrefix(name, "Access-Control-") {
+				resp.Header.Del(name)
+			}
+		}
+		resp.Header.Del(bridge.RequestIDHeader)
+		return nil
+	}
 	rp.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		// A body that ran over the front door's cap on the way through
+		// (frontendLimits) is the client's fault, not the service's.
+		if bodyTooLarge(err) {
+			frontendAccessFrom(req.Context()).setError(errBodyTooLarge)
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+			return
+		}
+		if report != nil {
+			report(req.Context(), err)
+		}
+		// A request the dispatcher means to retry is left unanswered.
+		if a := dispatchAttemptFrom(req.Context()); a != nil {
+			a.err = err
+			return
+		}
+		frontendAccessFrom(req.Context()).setError(err)
 		slog.Warn("frontend dispatch: upstream error",
-			"service", serviceID, "method", req.Method, "path", req.URL.Path, "error", err)
+			"service", serviceID, "method", req.Method, "path", req.URL.Path,
+			"request_id", req.Header.Get(bridge.RequestIDHeader), "error", err)
 		http.Error(w, "bad gateway", http.StatusBadGateway)
 	}
 	return rp
@@ -93,64 +196,187 @@ func newServiceProxy(serviceID, internalSocket, internalToken string) *httputil.
 // process lifecycle. This registry only concerns the *protocol* side of
 // enhanced services — what they expose, how to reach them.
 type EnhancedServiceRegistry struct {
-	mu       sync.RWMutex
+	mu sync.RWMutex
+	// services is keyed by instance ID (service_replicas.go): the service
+	// ID for a single-process service and a replicated one's replica 0,
+	// "<id>#<n>" for its other replicas.
 	services map[string]*EnhancedService
+	// health is the readiness of services with a health check, published
+	// by ServiceRegistry's monitor (service_health.go). Services without
+	// one have no entry and are always routed to. Kept apart from services
+	// because a service is probed before (and whether or not) it registers
+	// a manifest.
+	health map[string]ServiceHealth
+	// rotation offsets where Lookup starts looking among a service's
+	// replicas, so ties on in-flight count take turns.
+	rotation atomic.Uint64
 
 	// onChange fires after any successful RegisterManifest/Forget. Used by
 	// the front-door dispatcher to refresh its prefix table and by the
 	// settings UI to push status updates.
 	onChange func()
+	// changed is closed, and replaced, by every registration and Forget,
+	// waking whoever waits on changes.
+	changed chan struct{}
+
+	// Events is the bus registrations, unregistrations and health changes
+	// are published on, and service event feeds republish into. Set once
+	// during app initialization; nil publishes nothing and starts no feeds.
+	Events *EventBus
 }
 
 // NewEnhancedServiceRegistry returns an empty registry. onChange may be nil.
 func NewEnhancedServiceRegistry(onChange func()) *EnhancedServiceRegistry {
 	return &EnhancedServiceRegistry{
 		services: make(map[string]*EnhancedService),
+		health:   make(map[string]ServiceHealth),
 		onChange: onChange,
+		changed:  make(chan struct{}),
 	}
 }
 
+// changes returns a channel closed at the next registration or Forget.
+func (r *EnhancedServiceRegistry) changes() <-chan struct{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.changed
+}
+
+// signalChangeLocked wakes the waiters on changes. Caller holds r.mu.
+func (r *EnhancedServiceRegistry) signalChangeLocked() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
 // RegisterManifest stores a service's full record (internal socket + token +
 // manifest) in one shot. Returns an error if any other already-registered
 // service's manifest conflicts on a route. Re-registering the same
 // serviceID is allowed and replaces the prior record — the service is the
 // source of truth for its own routes, address, and token.
 func (r *EnhancedServiceRegistry) RegisterManifest(serviceID, internalSocket, internalToken string, m bridge.Manifest) error {
+	return r.RegisterReplica(serviceID, 0, internalSocket, internalToken, m)
+}
+
+// RegisterReplica is RegisterManifest for one replica of a service run as
+// several. Replicas of one service may declare the same routes; requests
+// for them are balanced across the replicas.
+func (r *EnhancedServiceRegistry) RegisterReplica(serviceID string, replica int, internalSocket, internalToken string, m bridge.Manifest) error {
 	if serviceID == "" {
 		return fmt.Errorf("manifest registry: empty serviceID")
 	}
+	key := instanceID(serviceID, replica)
 	r.mu.Lock()
-	if err := r.checkRouteConflictsLocked(serviceID, m.Routes); err != nil {
+	if err := r.checkRouteConflictsLocked(serviceID, m); err != nil {
 		r.mu.Unlock()
 		return err
 	}
-	r.services[serviceID] = &EnhancedService{
+	load := &replicaLoad{}
+	prev := r.services[key]
+	if prev != nil {
+		load = prev.load
+		load.draining.Store(false)
+	}
+	load.breaker.configure(m.Dispatch)
+	rec := &EnhancedService{
 		ServiceID:      serviceID,
+		Replica:        replica,
 		InternalSocket: internalSocket,
 		InternalToken:  internalToken,
 		Manifest:       m,
 		RegisteredAt:   time.Now(),
-		proxy:          newServiceProxy(serviceID, internalSocket, internalToken),
+		routes:         compileRoutes(m),
+		guards:         compileGuards(m),
+		load:           load,
 	}
+	rec.proxy = newServiceProxy(serviceID, internalSocket, internalToken, func(ctx context.Context, err error) {
+		r.recordDispatch(ctx, rec, err)
+	})
+	rec.stopEvents = r.startEventFeed(rec)
+	r.services[key] = rec
+	r.signalChangeLocked()
 	r.mu.Unlock()
+	if prev != nil {
+		// Outside the lock: stopping waits for the old feed to return.
+		prev.stopEvents()
+	}
+	r.Events.Publish(EventServiceRegistered, eventSourceRelay, "", serviceEventData{
+		Service:  serviceID,
+		Instance: key,
+	})
 	r.fireOnChange()
 	return nil
 }
 
+// serviceEventData is the data of relay's service.* events.
+type serviceEventData struct {
+	Service  string `json:"service"`
+	Instance string `json:"instance"`
+	// Health is set on service.health.
+	Health ServiceHealth `json:"health,omitempty"`
+	// Circuit is set on service.circuit: "open" or "closed".
+	Circuit string `json:"circuit,omitempty"`
+	// Status and Limit are set on service.exited: how the process ended
+	// (its exit status or the signal that killed it) and which of its
+	// resource limits it hit, if any.
+	Status string `json:"status,omitempty"`
+	Limit  string `json:"limit,omitempty"`
+}
+
 // Forget drops a service from the registry. Called when the bridge
-// connection to the service closes or when relay stops the service.
+// connection to the service closes or when relay stops the service. For a
+// replicated service, serviceID is the instance ID of the replica to drop.
 func (r *EnhancedServiceRegistry) Forget(serviceID string) {
 	r.mu.Lock()
-	_, existed := r.services[serviceID]
+	rec, existed := r.services[serviceID]
 	delete(r.services, serviceID)
+	if existed {
+		r.signalChangeLocked()
+	}
 	r.mu.Unlock()
 	if existed {
+		rec.stopEvents()
+		r.Events.Publish(EventServiceUnregistered, eventSourceRelay, "", serviceEventData{
+			Service:  rec.ServiceID,
+			Instance: serviceID,
+		})
 		r.fireOnChange()
 	}
 }
 
-// Get returns the record for one service, or nil if unknown. Records are
-// immutable once registered (re-registration replaces the pointer), so
+// SetHealth records a service's readiness; "" clears it. A change to a new
+// state is published as service.health; clearing one (the service stopped)
+// isn't, since its exit or unregistration says so.
+func (r *EnhancedServiceRegistry) SetHealth(serviceID string, state ServiceHealth) {
+	r.mu.Lock()
+	prev := r.health[serviceID]
+	if state == "" {
+		delete(r.health, serviceID)
+	} else {
+		r.health[serviceID] = state
+	}
+	r.mu.Unlock()
+	if state != "" && state != prev {
+		service, _ := splitInstanceID(serviceID)
+		r.Events.Publish(EventServiceHealth, eventSourceRelay, "", serviceEventData{
+			Service:  service,
+			Instance: serviceID,
+			Health:   state,
+		})
+	}
+}
+
+// Health returns a service's readiness, or "" when it has no health check
+// (or isn't running).
+func (r *EnhancedServiceRegistry) Health(serviceID string) ServiceHealth {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.health[serviceID]
+}
+
+// Get returns the record for one service, or nil if unknown. For a
+// replicated service, serviceID is an instance ID, so the plain service ID
+// finds replica 0. Records are immutable once registered (re-registration
+// replaces the pointer; only the dispatcher's load counters change), so
 // returning the raw pointer is safe and avoids per-call allocation.
 func (r *EnhancedServiceRegistry) Get(serviceID string) *EnhancedService {
 	r.mu.RLock()
@@ -158,64 +384,184 @@ func (r *EnhancedServiceRegistry) Get(serviceID string) *EnhancedService {
 	return r.services[serviceID]
 }
 
-// All returns every service record, sorted by serviceID for stable UI
+// All returns one record per service — a replicated service's
+// lowest-numbered registered replica — sorted by serviceID for stable UI
 // iteration. The slice is freshly allocated but the element pointers are
 // shared with the registry (records are immutable).
 func (r *EnhancedServiceRegistry) All() []*EnhancedService {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	out := make([]*EnhancedService, 0, len(r.services))
+	first := make(map[string]*EnhancedService, len(r.services))
 	for _, rec := range r.services {
+		if cur := first[rec.ServiceID]; cur == nil || rec.Replica < cur.Replica {
+			first[rec.ServiceID] = rec
+		}
+	}
+	out := make([]*EnhancedService, 0, len(first))
+	for _, rec := range first {
 		out = append(out, rec)
 	}
 	sort.Slice(out, func(i, j int) bool { return out[i].ServiceID < out[j].ServiceID })
 	return out
 }
 
-// LookupByPath returns the service whose manifest declares the longest
-// route matching the request path, or nil if none. Routes ending in "/"
-// are treated as prefixes; routes not ending in "/" are exact matches.
-// Hot path — called on every dispatched HTTP/WS request.
+// Replicas returns the registered replicas of one service, by replica
+// index.
+func (r *EnhancedServiceRegistry) Replicas(serviceID string) []*EnhancedService {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*EnhancedService
+	for _, rec := range r.services {
+		if rec.ServiceID == serviceID {
+			out = append(out, rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Replica < out[j].Replica })
+	return out
+}
+
+// LookupByPath is Lookup for a request of any method: method filters are
+// ignored. Kept for callers that only have a path.
 func (r *EnhancedServiceRegistry) LookupByPath(path string) *EnhancedService {
+	svc, _ := r.Lookup("", path)
+	return svc
+}
+
+// Lookup returns the service whose manifest declares the best route for a
+// request, or nil if none does, along with the route and the parameters it
+// matched. Routes ending in "/" are treated as prefixes; routes not ending
+// in "/" are exact matches. Among the routes that match the path and take
+// the method ("" takes any), the best is the one of highest priority, then
+// the most specific — for plain routes, the longest (see compareRank).
+// Hot path — called on every dispatched HTTP/WS request.
+//
+// When nothing matches but routes matching the path refused the method,
+// the returned routeMatch lists the methods they take, for a 405.
+//
+// When that service runs as several replicas, it returns the one to send
+// a new request to: among the replicas declaring the route, the
+// non-draining, ready one whose circuit isn't open (frontend_breaker.go)
+// with the fewest requests in flight, taking turns
+// on a tie so light sequential traffic is spread too. With none eligible it
+// returns the lowest-numbered one anyway, for the dispatcher to answer 503
+// with its state.
+func (r *EnhancedServiceRegistry) Lookup(method, path string) (*EnhancedService, routeMatch) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	var best *EnhancedService
-	bestLen := -1
+	var (
+		candidates []*EnhancedService
+		best       routeMatch
+		bestRank   routeRank
+		allow      []string
+	)
 	for _, rec := range r.services {
-		for _, route := range rec.Manifest.Routes {
-			matched := false
-			if strings.HasSuffix(route, "/") {
-				matched = strings.HasPrefix(path, route)
-			} else {
-				matched = path == route
+		for i := range rec.routes {
+			rt := &rec.routes[i]
+			params, ok := rt.matchPath(path)
+			if !ok {
+				continue
+			}
+			if method != "" && !rt.allowsMethod(method) {
+				for _, m := range rt.Methods {
+					if !slices.Contains(allow, m) {
+						allow = append(allow, m)
+					}
+				}
+				continue
+			}
+			rank := rankOf(rt, rec.ServiceID)
+			c := 1
+			if len(candidates) > 0 {
+				c = compareRank(rank, bestRank)
 			}
-			if matched && len(route) > bestLen {
-				best = rec
-				bestLen = len(route)
+			switch {
+			case c < 0:
+			case c > 0:
+				candidates, bestRank = append(candidates[:0], rec), rank
+				best = routeMatch{route: rt, params: params}
+			case candidates[len(candidates)-1] != rec:
+				// Equal rank is the same route of the same service: replicas.
+				candidates = append(candidates, rec)
 			}
 		}
 	}
-	return best
+	if len(candidates) <= 1 {
+		if len(candidates) == 0 {
+			sort.Strings(allow)
+			return nil, routeMatch{allow: allow}
+		}
+		return candidates[0], best
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Replica < candidates[j].Replica })
+	now := time.Now()
+	var pick *EnhancedService
+	start := int(r.rotation.Add(1) % uint64(len(candidates)))
+	for i := range candidates {
+		rec := candidates[(start+i)%len(candidates)]
+		if rec.Draining() || rec.load.breaker.blocked(now) {
+			continue
+		}
+		if h := r.health[rec.instance()]; h != "" && h != HealthReady {
+			continue
+		}
+		if pick == nil || rec.InFlight() < pick.InFlight() {
+			pick = rec
+		}
+	}
+	if pick == nil {
+		pick = candidates[0]
+	}
+	return pick, best
+}
+
+// drainPollInterval is how often Drain checks a replica's in-flight count.
+// A var so tests can shorten it.
+var drainPollInterval = 50 * time.Millisecond
+
+// Drain stops the dispatcher from sending new requests to one replica (by
+// instance ID) and waits, up to timeout, for those in flight — including
+// open WebSocket sessions — to finish. It reports whether they did. A
+// replica that hasn't registered has nothing to drain. The mark is cleared
+// when the replica registers again.
+func (r *EnhancedServiceRegistry) Drain(instance string, timeout time.Duration) bool {
+	rec := r.Get(instance)
+	if rec == nil {
+		return true
+	}
+	rec.load.draining.Store(true)
+	deadline := time.Now().Add(timeout)
+	for rec.InFlight() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return true
 }
 
 // checkRouteConflictsLocked walks every other service's routes looking for
-// exact-string collisions with the new service's routes. Caller must hold
+// one that collides with a route of the new manifest. Caller must hold
 // r.mu.Lock().
 //
-// V1 conflict policy: any duplicate route string between two distinct
-// serviceIDs is a conflict. Future work could allow finer-grained overlap
-// (e.g. "/api/sessions/active" inside "/api/sessions/"), but for now we
-// keep it simple and predictable.
-func (r *EnhancedServiceRegistry) checkRouteConflictsLocked(serviceID string, routes []string) error {
-	for otherID, other := range r.services {
+// Conflict policy: two distinct serviceIDs may not declare routes that
+// would tie for a request — the same path shape, a method in common and
+// the same priority (bridge.RouteDecl.Collides). Anything short of that is
+// settled per request by Lookup's ranking, so services can share "/api/"
+// with disjoint methods, nest "/api/sessions/active" inside
+// "/api/sessions/", or take over a path with a higher priority. Replicas
+// of one service share theirs.
+func (r *EnhancedServiceRegistry) checkRouteConflictsLocked(serviceID string, m bridge.Manifest) error {
+	routes := m.AllRoutes()
+	for _, other := range r.services {
+		otherID := other.ServiceID
 		if otherID == serviceID {
 			continue
 		}
-		for _, otherRoute := range other.Manifest.Routes {
+		for _, otherRoute := range other.routes {
 			for _, newRoute := range routes {
-				if otherRoute == newRoute {
-					return fmt.Errorf("manifest registry: route %q already claimed by service %q", newRoute, otherID)
+				if otherRoute.Collides(newRoute) {
+					return fmt.Errorf("manifest registry: route %q already claimed by service %q", newRoute.Path, otherID)
 				}
 			}
 		}
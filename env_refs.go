@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"relaygo/bridge"
+)
+
+// Late-bound env references.
+//
+// A service or MCP env value may embed `${secret:<name>}` (an entry in the
+// secret store, see secret_store.go) or `${file:<path>}` (the contents of a
+// file, `~/` expanded), alone or inside a larger string such as
+// "Bearer ${secret:gh}". They are resolved at spawn time — in buildCommand,
+// spawnStdioConn and the TCC permission check — and nowhere else:
+//
+//   - settings.json, the settings UI and the list commands only ever hold
+//     the reference, so none of them can leak the value;
+//   - each spawn re-reads the source, so rotating a key is "update the secret
+//     or the file, restart the service" with no settings edit in between.
+//
+// This differs from the `secret://` references of the secret store itself,
+// which FileSettingsStore resolves when settings are loaded: those are how
+// relay keeps its own credentials off disk, while ${...} is how a user hands
+// a credential to a child without relay ever persisting it.
+//
+// Resolution fails closed. A child is never started with a literal
+// "${secret:...}" or an empty string standing in for a credential it asked
+// for; the spawn errors, naming the variable and the reference (never a
+// value).
+
+// envRefPattern matches one ${secret:…} or ${file:…} reference.
+var envRefPattern = regexp.MustCompile(`\$\{(secret|file):([^}]+)\}`)
+
+// maxEnvFileRefBytes caps a ${file:} read. Env values are for keys and
+// tokens; a reference to anything larger is almost certainly the wrong path.
+const maxEnvFileRefBytes = 64 << 10
+
+// hasEnvRef reports whether v contains a ${secret:} or ${file:} reference.
+func hasEnvRef(v string) bool {
+	return envRefPattern.MatchString(v)
+}
+
+// envRefSource resolves the two reference kinds. Split out so tests can
+// resolve against a temp store without touching the real config dir.
+type envRefSource struct {
+	// openStore opens the secret store on first ${secret:} use; a config
+	// with only ${file:} references never touches the key.
+	openStore func() (*SecretStore, error)
+	store     *SecretStore
+	opened    bool
+}
+
+// defaultEnvRefSource resolves ${secret:} against the store in the live
+// config dir, honouring RELAY_SECRETS_KEY_FILE like NewSettingsStore.
+func defaultEnvRefSource() *envRefSource {
+	return &envRefSource{openStore: func() (*SecretStore, error) {
+		dir := bridge.ConfigDir()
+		return openSecretStore(dir, defaultSecretKeyPath(dir))
+	}}
+}
+
+func (src *envRefSource) secret(name string) (string, error) {
+	if !src.opened {
+		st, err := src.openStore()
+		if err != nil {
+			return "", err
+		}
+		src.store, src.opened = st, true
+	}
+	if src.store == nil {
+		return "", fmt.Errorf("secret store is not enabled (run: relay secrets migrate)")
+	}
+	v, ok := src.store.Get(name)
+	if !ok {
+		return "", fmt.Errorf("no secret named %q", name)
+	}
+	return v, nil
+}
+
+func (src *envRefSource) file(path string) (string, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("expand ~: %w", err)
+		}
+		path = filepath.Join(home, rest)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxEnvFileRefBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxEnvFileRefBytes {
+		return "", fmt.Errorf("%s is larger than %d bytes", path, maxEnvFileRefBytes)
+	}
+	// Key files almost always end in a newline the value must not carry.
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolve expands every reference in v.
+func (src *envRefSource) resolve(v string) (string, error) {
+	var firstErr error
+	out := envRefPattern.ReplaceAllStringFunc(v, func(ref string) string {
+		if firstErr != nil {
+			return ""
+		}
+		m := envRefPattern.FindStringSubmatch(ref)
+		kind, arg := m[1], strings.TrimSpace(m[2])
+		var val string
+		var err error
+		if kind == "secret" {
+			val, err = src.secret(arg)
+		} else {
+			val, err = src.file(arg)
+		}
+		if err != nil {
+			firstErr = fmt.Errorf("%s: %w", ref, err)
+			return ""
+		}
+		if val == "" {
+			firstErr = fmt.Errorf("%s resolved to an empty value", ref)
+		}
+		return val
+	})
+	return out, firstErr
+}
+
+// resolveEnvRefs returns env with every reference expanded. The input map is
+// not modified — it is usually the config held by a manager, which must keep
+// the references for the next spawn. Returns env itself when nothing needs
+// resolving.
+func resolveEnvRefs(env map[string]string) (map[string]string, error) {
+	return resolveEnvRefsFrom(defaultEnvRefSource(), env)
+}
+
+func resolveEnvRefsFrom(src *envRefSource, env map[string]string) (map[string]string, error) {
+	found := false
+	for _, v := range env {
+		if hasEnvRef(v) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return env, nil
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // deterministic "first error"
+	out := make(map[string]string, len(env))
+	for _, k := range keys {
+		v := env[k]
+		if !hasEnvRef(v) {
+			out[k] = v
+			continue
+		}
+		r, err := src.resolve(v)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", k, err)
+		}
+		out[k] = r
+	}
+	return out, nil
+}
+
+// redactedEnvValue is shown in place of a plaintext credential.
+const redactedEnvValue = "<redacted>"
+
+// formatEnvForList renders an env map as sorted KEY=value pairs, for
+// `relay mcp list` and `relay service profile list`. References (${…} and the
+// secret store's secret://) are shown as written — they name a credential
+// without revealing it. Plaintext values under a credential-looking key are
+// redacted. storeRefs maps a field name (prefix+key, as in secretFields) to
+// its secret-store entry for values the settings store already resolved.
+func formatEnvForList(prefix string, env map[string]string, storeRefs map[string]string) string {
+	if len(env) == 0 {
+		return "-"
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+displayEnvValue(prefix+k, k, env[k], storeRefs))
+	}
+	return strings.Join(parts, " ")
+}
+
+// displayEnvValue is how the CLI shows env value v of key k, stored under
+// field (as in secretFields; "" for a value that isn't in settings, such as
+// an env file's): its secret-store reference, a ${…} reference as written,
+// or the value itself unless the key looks like a credential.
+func displayEnvValue(field, k, v string, storeRefs map[string]string) string {
+	switch {
+	case field != "" && storeRefs[field] != "":
+		return secretRef(storeRefs[field])
+	case hasEnvRef(v):
+		return v
+	case looksSecretEnvKey(k):
+		return redactedEnvValue
+	}
+	return v
+}
+
+// listSecretRefs returns the secret-store references behind store's
+// settings, or nil for a store that doesn't track them (test fakes).
+func listSecretRefs(store SettingsStore) map[string]string {
+	if fs, ok := store.(interface{ secretReferences() map[string]string }); ok {
+		return fs.secretReferences()
+	}
+	return nil
+}
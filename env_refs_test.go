@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// envRefTestSource resolves ${secret:} against a fresh store holding entries.
+func envRefTestSource(t *testing.T, entries map[string]string) *envRefSource {
+	t.Helper()
+	dir := t.TempDir()
+	st, err := createSecretStore(dir, filepath.Join(dir, secretKeyFileName))
+	if err != nil {
+		t.Fatalf("createSecretStore: %v", err)
+	}
+	for k, v := range entries {
+		st.Set(k, v)
+	}
+	return &envRefSource{openStore: func() (*SecretStore, error) { return st, nil }}
+}
+
+func TestResolveEnvRefs_SecretAndFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("file-value\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	src := envRefTestSource(t, map[string]string{"telegram_bot_token": "tg-123"})
+	env := map[string]string{
+		"TELEGRAM_TOKEN": "${secret:telegram_bot_token}",
+		"AUTH_HEADER":    "Bearer ${secret:telegram_bot_token}",
+		"KEY":            "${file:" + keyFile + "}",
+		"LOG_LEVEL":      "debug",
+	}
+	got, err := resolveEnvRefsFrom(src, env)
+	if err != nil {
+		t.Fatalf("resolveEnvRefsFrom: %v", err)
+	}
+	want := map[string]string{
+		"TELEGRAM_TOKEN": "tg-123",
+		"AUTH_HEADER":    "Bearer tg-123",
+		"KEY":            "file-value",
+		"LOG_LEVEL":      "debug",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	// The config keeps its references for the next spawn.
+	if env["TELEGRAM_TOKEN"] != "${secret:telegram_bot_token}" {
+		t.Fatal("input env was modified")
+	}
+}
+
+// TestResolveEnvRefs_RereadsFileEachSpawn is the rotation promise: nothing is
+// cached between resolutions.
+func TestResolveEnvRefs_RereadsFileEachSpawn(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	env := map[string]string{"KEY": "${file:" + keyFile + "}"}
+	for _, v := range []string{"one", "two"} {
+		if err := os.WriteFile(keyFile, []byte(v), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := resolveEnvRefs(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["KEY"] != v {
+			t.Fatalf("KEY = %q, want %q", got["KEY"], v)
+		}
+	}
+}
+
+func TestResolveEnvRefs_HomeExpansion(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.WriteFile(filepath.Join(home, "k"), []byte("home-value"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := resolveEnvRefs(map[string]string{"K": "${file:~/k}"})
+	if err != nil || got["K"] != "home-value" {
+		t.Fatalf("got %q, %v", got["K"], err)
+	}
+}
+
+// TestResolveEnvRefs_FailsClosed: an unresolvable reference is an error that
+// names the variable and reference, never a child started with the literal.
+func TestResolveEnvRefs_FailsClosed(t *testing.T) {
+	src := envRefTestSource(t, nil)
+	cases := map[string]string{
+		"missing secret": "${secret:nope}",
+		"missing file":   "${file:" + filepath.Join(t.TempDir(), "absent") + "}",
+	}
+	for name, v := range cases {
+		_, err := resolveEnvRefsFrom(src, map[string]string{"API_KEY": v})
+		if err == nil {
+			t.Errorf("%s: resolved without error", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), "API_KEY") || !strings.Contains(err.Error(), v) {
+			t.Errorf("%s: error %q should name the variable and reference", name, err)
+		}
+	}
+
+	disabled := &envRefSource{openStore: func() (*SecretStore, error) { return nil, nil }}
+	if _, err := resolveEnvRefsFrom(disabled, map[string]string{"K": "${secret:x}"}); err == nil ||
+		!strings.Contains(err.Error(), "not enabled") {
+		t.Fatalf("secret ref without a store: err = %v", err)
+	}
+}
+
+// TestResolveEnvRefs_NoRefsSkipsStore: a config with no ${secret:} never
+// opens the store, so a broken key can't fail an unrelated spawn.
+func TestResolveEnvRefs_NoRefsSkipsStore(t *testing.T) {
+	src := &envRefSource{openStore: func() (*SecretStore, error) {
+		t.Fatal("store opened for an env with no secret references")
+		return nil, nil
+	}}
+	env := map[string]string{"PATH": "/bin"}
+	got, err := resolveEnvRefsFrom(src, env)
+	if err != nil || got["PATH"] != "/bin" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+}
+
+func TestFormatEnvForList_Redacts(t *testing.T) {
+	env := map[string]string{
+		"TELEGRAM_TOKEN": "${secret:telegram_bot_token}",
+		"API_KEY":        "sk-plain",
+		"OPENAI":         "sk-from-store",
+		"LOG_LEVEL":      "debug",
+	}
+	refs := map[string]string{"service/tg/env/OPENAI": "openai"}
+	got := formatEnvForList("service/tg/env/", env, refs)
+	want := "API_KEY=<redacted> LOG_LEVEL=debug OPENAI=secret://openai TELEGRAM_TOKEN=${secret:telegram_bot_token}"
+	if got != want {
+		t.Fatalf("formatEnvForList =\n  %s\nwant\n  %s", got, want)
+	}
+	if strings.Contains(got, "sk-") {
+		t.Fatal("plaintext credential in list output")
+	}
+	if formatEnvForList("x/", nil, nil) != "-" {
+		t.Fatal("empty env should render as -")
+	}
+}
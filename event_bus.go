@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The relay event bus.
+//
+// Relay knows the moment something in the ecosystem changes — a project is
+// edited, an MCP connects or its process dies, a service exits, turns
+// unhealthy or registers its manifest — but until now only the tray window
+// heard about it, and Eve polled. The bus collects those changes as typed
+// RelayEvents and hands them to every subscriber; the frontend server
+// streams them at GET /api/events (event_routes.go).
+//
+// Enhanced services add their own: a manifest may declare an event stream,
+// and relay subscribes to it for as long as the service is registered and
+// republishes what it reads (service_events.go). A consumer gets the whole
+// ecosystem from one subscription.
+//
+// Delivery is best-effort and in order. The bus keeps the last
+// eventBusReplay events, so a subscriber that reconnects with the ID of the
+// last event it saw gets what it missed; one that fell further behind, or
+// whose ID is from before relay restarted, is told so with a stream.gap
+// event and should refetch whatever state it keeps.
+
+// Relay's own event types. A service's events keep the names it gave them,
+// with the service's instance ID as their source.
+const (
+	EventProjectCreated = "project.created"
+	EventProjectUpdated = "project.updated"
+	EventProjectDeleted = "project.deleted"
+
+	EventMcpConnected = "mcp.connected"
+	EventMcpStopped   = "mcp.stopped"
+	EventMcpExited    = "mcp.exited"
+	EventMcpAuthState = "mcp.auth_state"
+
+	EventServiceRegistered   = "service.registered"
+	EventServiceUnregistered = "service.unregistered"
+	EventServiceExited       = "service.exited"
+	EventServiceHealth       = "service.health"
+	EventServiceCircuit      = "service.circuit"
+
+	// EventStreamGap is sent to one subscriber, first, when events it
+	// asked to resume after are no longer held.
+	EventStreamGap = "stream.gap"
+	// EventStreamClosed ends an SSE stream whose credential was revoked
+	// (a WebSocket gets a close frame instead). It carries no ID, so a
+	// client that reconnects with new credentials resumes where it was.
+	EventStreamClosed = "stream.closed"
+)
+
+// eventSourceRelay is the Source of the events relay itself publishes.
+const eventSourceRelay = "relay"
+
+// eventBusReplay is how many recent events the bus holds for subscribers
+// resuming after a reconnect.
+const eventBusReplay = 512
+
+// eventSubscriberBuffer is how many events a subscriber may fall behind
+// before the bus drops it. A stream that can't keep up is closed rather
+// than allowed to hold events in memory; its client reconnects and
+// resumes from the replay buffer.
+const eventSubscriberBuffer = 256
+
+// RelayEvent is one event on the bus, and one message of the event stream.
+type RelayEvent struct {
+	// ID is "<boot>-<seq>": seq counts up from 1 per relay process, and
+	// boot tells one process's IDs from the next's.
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+	// Project is the project the event concerns, when there is one; a
+	// credential scoped to projects only sees events of its own.
+	Project string          `json:"project,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+
+	seq uint64
+}
+
+// EventBus fans relay events out to subscribers. The zero value is not
+// usable; create with NewEventBus. A nil *EventBus drops what is
+// published, so components can hold one unconditionally.
+type EventBus struct {
+	mu     sync.Mutex
+	boot   string
+	seq    uint64
+	recent []RelayEvent // ring of the last eventBusReplay events, oldest first
+	subs   map[*EventSubscription]struct{}
+
+	// projects is the project list as of the last ObserveProjects, by ID,
+	// for diffing into project events. nil until the first call. observeMu
+	// serializes the calls, so two racing observers publish each change
+	// once and in order.
+	observeMu sync.Mutex
+	projects  map[string]projectEventView
+}
+
+// NewEventBus returns an empty bus.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		boot: strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs: make(map[*EventSubscription]struct{}),
+	}
+}
+
+// EventSubscription is one subscriber's feed. Events arrives in order
+// and is closed when the subscriber falls too far behind or cancels.
+type EventSubscription struct {
+	Events <-chan RelayEvent
+	ch     chan RelayEvent
+	bus    *EventBus
+	filter func(*RelayEvent) bool
+	// dropped is set when the bus ends the subscription for falling behind.
+	dropped bool
+}
+
+// Publish stamps an event with the next ID and delivers it. data is
+// marshalled to JSON; nil leaves the event without data.
+func (b *EventBus) Publish(typ, source, project string, data any) {
+	if b == nil {
+		return
+	}
+	var raw json.RawMessage
+	if data != nil {
+		var err error
+		if raw, err = json.Marshal(data); err != nil {
+			slog.Warn("events: dropping event with unmarshalable data", "type", typ, "error", err)
+			return
+		}
+	}
+	b.publish(RelayEvent{Type: typ, Source: source, Project: project, Data: raw})
+}
+
+// publishRaw is Publish for data already in JSON.
+func (b *EventBus) publishRaw(typ, source string, data json.RawMessage) {
+	if b == nil {
+		return
+	}
+	b.publish(RelayEvent{Type: typ, Source: source, Data: data})
+}
+
+func (b *EventBus) publish(ev RelayEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	ev.seq = b.seq
+	ev.ID = b.boot + "-" + strconv.FormatUint(b.seq, 10)
+	ev.Time = time.Now().UTC()
+	if len(b.recent) == eventBusReplay {
+		b.recent = append(b.recent[:0], b.recent[1:]...)
+	}
+	b.recent = append(b.recent, ev)
+	for sub := range b.subs {
+		b.deliverLocked(sub, ev)
+	}
+}
+
+// deliverLocked sends ev to sub, dropping sub if its buffer is full.
+// Caller holds b.mu.
+func (b *EventBus) deliverLocked(sub *EventSubscription, ev RelayEvent) {
+	if sub.filter != nil && !sub.filter(&ev) {
+		return
+	}
+	select {
+	case sub.ch <- ev:
+	default:
+		sub.dropped = true
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Subscribe starts a feed of the events filter accepts (nil accepts all).
+// With a non-empty lastID, the events held after it are delivered first;
+// if lastID isn't one the bus can resume after, a stream.gap event is
+// delivered first instead. Cancel the subscription when done.
+func (b *EventBus) Subscribe(lastID string, filter func(*RelayEvent) bool) *EventSubscription {
+	ch := make(chan RelayEvent, eventSubscriberBuffer+eventBusReplay)
+	sub := &EventSubscription{Events: ch, ch: ch, bus: b, filter: filter}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if lastID != "" {
+		missed, ok := b.sinceLocked(lastID)
+		if !ok {
+			ch <- RelayEvent{
+				ID:     b.boot + "-" + strconv.FormatUint(b.seq, 10),
+				Type:   EventStreamGap,
+				Source: eventSourceRelay,
+				Time:   time.Now().UTC(),
+			}
+		}
+		for _, ev := range missed {
+			if filter == nil || filter(&ev) {
+				ch <- ev
+			}
+		}
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// sinceLocked returns the held events after the one with ID lastID, and
+// false when the bus can't tell what came after it: an ID from another
+// relay process, or one older than everything held. Caller holds b.mu.
+func (b *EventBus) sinceLocked(lastID string) ([]RelayEvent, bool) {
+	boot, seqStr, ok := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if !ok || err != nil || boot != b.boot || seq > b.seq {
+		return b.recent, false
+	}
+	if seq == b.seq {
+		return nil, true
+	}
+	if len(b.recent) == 0 || b.recent[0].seq > seq+1 {
+		return b.recent, false
+	}
+	return b.recent[seq+1-b.recent[0].seq:], true
+}
+
+// Cancel ends the subscription and closes Events. Safe to call more than
+// once, and after the bus dropped it.
+func (s *EventSubscription) Cancel() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
+
+// Dropped reports whether the bus ended the subscription because the
+// subscriber fell behind. Meaningful once Events is closed.
+func (s *EventSubscription) Dropped() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
+
+// projectEventView is what a project event says about the project: enough
+// to find it again, nothing a project-scoped reader couldn't GET anyway,
+// and never its token.
+type projectEventView struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// sum is a digest of the project's record, to tell an edit from no
+	// change. Not sent.
+	sum string
+}
+
+// ObserveProjects compares projects with the list it saw last and publishes
+// project.created, project.updated and project.deleted for the
+// differences. Called wherever projects may have changed — it is cheap
+// when they haven't, and a change seen twice is published once. The first
+// call only records the list.
+func (b *EventBus) ObserveProjects(projects []Project) {
+	if b == nil {
+		return
+	}
+	b.observeMu.Lock()
+	defer b.observeMu.Unlock()
+	cur := make(map[string]projectEventView, len(projects))
+	for _, p := range projects {
+		sum, _ := json.Marshal(p)
+		cur[p.ID] = projectEventView{ID: p.ID, Name: p.Name, sum: string(sum)}
+	}
+	b.mu.Lock()
+	prev := b.projects
+	b.projects = cur
+	b.mu.Unlock()
+	if prev == nil {
+		return
+	}
+	for _, p := range projects {
+		old, ok := prev[p.ID]
+		switch {
+		case !ok:
+			b.Publish(EventProjectCreated, eventSourceRelay, p.ID, cur[p.ID])
+		case old.sum != cur[p.ID].sum:
+			b.Publish(EventProjectUpdated, eventSourceRelay, p.ID, cur[p.ID])
+		}
+	}
+	for id, old := range prev {
+		if _, ok := cur[id]; !ok {
+			b.Publish(EventProjectDeleted, eventSourceRelay, id, old)
+		}
+	}
+}
+
+// eventTypeFilter parses a comma-separated list of event type patterns —
+// an exact type, or a prefix ending in "." or "*" ("service.", "mcp.*") —
+// into a matcher. An empty list matches everything.
+func eventTypeFilter(list string) (func(string) bool, error) {
+	var exact, prefixes []string
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		switch {
+		case p == "":
+		case p == "*":
+			return func(string) bool { return true }, nil
+		case strings.HasSuffix(p, "*"):
+			prefixes = append(prefixes, strings.TrimSuffix(p, "*"))
+		case strings.HasSuffix(p, "."):
+			prefixes = append(prefixes, p)
+		case strings.ContainsAny(p, " \t"):
+			return nil, fmt.Errorf("event type %q contains whitespace", p)
+		default:
+			exact = append(exact, p)
+		}
+	}
+	if len(exact) == 0 && len(prefixes) == 0 {
+		return func(string) bool { return true }, nil
+	}
+	return func(typ string) bool {
+		for _, e := range exact {
+			if typ == e {
+				return true
+			}
+		}
+		for _, p := range prefixes {
+			if strings.HasPrefix(typ, p) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for the event bus: delivery, resuming after a reconnect, the gap
+// event, dropping a subscriber that falls behind, project diffing and the
+// type filter.
+
+// nextEvent reads one event from sub, failing the test after a second.
+func nextEvent(t *testing.T, sub *EventSubscription) RelayEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-sub.Events:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event within 1s")
+	}
+	return RelayEvent{}
+}
+
+// noEvent fails the test if sub has an event waiting.
+func noEvent(t *testing.T, sub *EventSubscription) {
+	t.Helper()
+	select {
+	case ev := <-sub.Events:
+		t.Fatalf("unexpected event %s %s", ev.Type, ev.Data)
+	default:
+	}
+}
+
+func TestEventBus_PublishSubscribe(t *testing.T) {
+	bus := NewEventBus()
+	all := bus.Subscribe("", nil)
+	defer all.Cancel()
+	mcpOnly := bus.Subscribe("", func(ev *RelayEvent) bool { return strings.HasPrefix(ev.Type, "mcp.") })
+	defer mcpOnly.Cancel()
+
+	bus.Publish(EventServiceExited, eventSourceRelay, "", serviceEventData{Service: "svc", Instance: "svc", Status: "exited: status 1"})
+	bus.Publish(EventMcpConnected, eventSourceRelay, "", mcpEventData{MCP: "fsmcp", Tools: 6})
+
+	first := nextEvent(t, all)
+	if first.Type != EventServiceExited || first.Source != eventSourceRelay || first.Time.IsZero() {
+		t.Errorf("first event = %+v", first)
+	}
+	var data serviceEventData
+	if err := json.Unmarshal(first.Data, &data); err != nil || data.Status != "exited: status 1" {
+		t.Errorf("data = %s (%v)", first.Data, err)
+	}
+	second := nextEvent(t, all)
+	if second.Type != EventMcpConnected || second.ID == first.ID {
+		t.Errorf("second event = %+v", second)
+	}
+	if ev := nextEvent(t, mcpOnly); ev.ID != second.ID {
+		t.Errorf("filtered subscriber got %s, want only %s", ev.Type, second.Type)
+	}
+	noEvent(t, mcpOnly)
+
+	var nilBus *EventBus
+	nilBus.Publish(EventMcpStopped, eventSourceRelay, "", nil) // must not panic
+	nilBus.ObserveProjects(nil)
+}
+
+func TestEventBus_ResumeAfterLastID(t *testing.T) {
+	bus := NewEventBus()
+	for i := range 3 {
+		bus.Publish(EventMcpConnected, eventSourceRelay, "", mcpEventData{MCP: string(rune('a' + i))})
+	}
+	probe := bus.Subscribe(bus.boot+"-0", nil)
+	ids := []string{nextEvent(t, probe).ID, nextEvent(t, probe).ID, nextEvent(t, probe).ID}
+	probe.Cancel()
+
+	sub := bus.Subscribe(ids[0], nil)
+	defer sub.Cancel()
+	if ev := nextEvent(t, sub); ev.ID != ids[1] {
+		t.Errorf("resumed at %s, want %s", ev.ID, ids[1])
+	}
+	if ev := nextEvent(t, sub); ev.ID != ids[2] {
+		t.Errorf("then %s, want %s", ev.ID, ids[2])
+	}
+	noEvent(t, sub)
+
+	upToDate := bus.Subscribe(ids[2], nil)
+	defer upToDate.Cancel()
+	noEvent(t, upToDate)
+	bus.Publish(EventMcpStopped, eventSourceRelay, "", nil)
+	if ev := nextEvent(t, upToDate); ev.Type != EventMcpStopped {
+		t.Errorf("live event = %s", ev.Type)
+	}
+}
+
+// An ID the bus can't resume after — another relay's, or one older than
+// the replay buffer — gets a gap event, then everything still held.
+func TestEventBus_GapWhenResumeImpossible(t *testing.T) {
+	bus := NewEventBus()
+	bus.Publish(EventMcpConnected, eventSourceRelay, "", nil)
+
+	sub := bus.Subscribe("someotherboot-7", nil)
+	if ev := nextEvent(t, sub); ev.Type != EventStreamGap {
+		t.Errorf("first event = %s, want %s", ev.Type, EventStreamGap)
+	}
+	if ev := nextEvent(t, sub); ev.Type != EventMcpConnected {
+		t.Errorf("then %s, want the held event", ev.Type)
+	}
+	sub.Cancel()
+
+	for range eventBusReplay + 5 {
+		bus.Publish(EventMcpStopped, eventSourceRelay, "", nil)
+	}
+	old := bus.Subscribe(bus.boot+"-1", nil)
+	defer old.Cancel()
+	if ev := nextEvent(t, old); ev.Type != EventStreamGap {
+		t.Errorf("resuming past the buffer: first event = %s, want %s", ev.Type, EventStreamGap)
+	}
+	if n := len(old.Events); n != eventBusReplay {
+		t.Errorf("%d events replayed, want the %d held", n, eventBusReplay)
+	}
+}
+
+func TestEventBus_DropsSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+	slow := bus.Subscribe("", nil)
+	fast := bus.Subscribe("", nil)
+
+	// The fast subscriber reads each event as it is published; the slow one
+	// reads nothing until its buffer has overflowed.
+	total := cap(slow.ch) + 1
+	for range total {
+		bus.Publish(EventMcpStopped, eventSourceRelay, "", nil)
+		nextEvent(t, fast)
+	}
+
+	n := 0
+	for range slow.Events {
+		n++
+	}
+	if !slow.Dropped() || n != total-1 {
+		t.Errorf("slow subscriber: dropped = %v after %d events, want dropped after %d", slow.Dropped(), n, total-1)
+	}
+	slow.Cancel() // after a drop: a no-op, not a double close
+
+	fast.Cancel()
+	if _, ok := <-fast.Events; ok {
+		t.Error("Events still open after Cancel")
+	}
+	if fast.Dropped() {
+		t.Error("a cancelled subscription must not report dropped")
+	}
+}
+
+func TestEventBus_ObserveProjects(t *testing.T) {
+	bus := NewEventBus()
+	sub := bus.Subscribe("", nil)
+	defer sub.Cancel()
+
+	a := Project{ID: "p-a", Name: "Alpha", Path: "/a", Token: "secret-a"}
+	b := Project{ID: "p-b", Name: "Beta", Path: "/b"}
+	bus.ObserveProjects([]Project{a, b})
+	noEvent(t, sub) // the first call only records
+
+	a.Path = "/a2"
+	c := Project{ID: "p-c", Name: "Gamma"}
+	bus.ObserveProjects([]Project{a, c})
+	got := map[string]string{}
+	for range 3 {
+		ev := nextEvent(t, sub)
+		got[ev.Type] = ev.Project
+		if strings.Contains(string(ev.Data), "secret") {
+			t.Errorf("%s carries the project token: %s", ev.Type, ev.Data)
+		}
+	}
+	want := map[string]string{EventProjectUpdated: "p-a", EventProjectCreated: "p-c", EventProjectDeleted: "p-b"}
+	for typ, id := range want {
+		if got[typ] != id {
+			t.Errorf("%s for %q, want %q (all: %v)", typ, got[typ], id, got)
+		}
+	}
+
+	bus.ObserveProjects([]Project{a, c})
+	noEvent(t, sub)
+}
+
+func TestEventTypeFilter(t *testing.T) {
+	match, err := eventTypeFilter("service., mcp.*, project.created")
+	assertNoErr(t, err, "parse")
+	for typ, want := range map[string]bool{
+		"service.exited":  true,
+		"mcp.auth_state":  true,
+		"project.created": true,
+		"project.deleted": false,
+		"stream.gap":      false,
+	} {
+		if got := match(typ); got != want {
+			t.Errorf("match(%q) = %v, want %v", typ, got, want)
+		}
+	}
+	all, err := eventTypeFilter("")
+	assertNoErr(t, err, "parse empty")
+	if !all("anything") {
+		t.Error("an empty filter must match everything")
+	}
+	if _, err := eventTypeFilter("service exited"); err == nil {
+		t.Error("a type with a space must be rejected")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"relaygo/bridge"
+)
+
+// eventKeepalive is how often an idle SSE stream gets a comment line, so
+// proxies and clients don't take a quiet stream for a dead one. A var so
+// tests can shorten it.
+var eventKeepalive = 25 * time.Second
+
+// RegisterEventRoutes wires the event stream (event_bus.go):
+//
+//	GET /api/events   Server-Sent Events, or a WebSocket when the request
+//	                  is an upgrade: one JSON RelayEvent per message
+//
+// Query parameters narrow the stream: types= a comma-separated list of
+// event types or prefixes ("project.", "mcp.*"), sources= a list of
+// sources ("relay", or a service's instance ID). An SSE client resumes with
+// the standard Last-Event-ID header; a WebSocket client, which can't set
+// one from a browser, with ?last_event_id=.
+//
+// A scoped credential sees the events of the projects it is granted, and
+// relay's own events that concern no project. One granted projects sees no
+// service events: relay can't tell which project those concern. The stream
+// ends within frontendCredentialRecheck of the credential being revoked.
+// allowedOrigins feeds the WebSocket Origin check, as for the dispatcher.
+// nil bus makes the route return 503.
+func RegisterEventRoutes(mux *http.ServeMux, store SettingsStore, bus *EventBus, allowedOrigins func() []string) {
+	mux.HandleFunc("GET /api/events", func(w http.ResponseWriter, r *http.Request) {
+		if bus == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "event stream unavailable"})
+			return
+		}
+		q := r.URL.Query()
+		typeOK, err := eventTypeFilter(q.Get("types"))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		var sources []string
+		for _, s := range strings.Split(q.Get("sources"), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				sources = append(sources, s)
+			}
+		}
+		cred := frontendCredentialFrom(r.Context())
+		filter := func(ev *RelayEvent) bool {
+			if cred != nil && ev.Project != "" && !cred.GrantsProject(ev.Project) {
+				return false
+			}
+			// A service's events carry no project relay could check, and may
+			// well concern projects outside the credential's scope.
+			if cred != nil && len(cred.ProjectIDs) > 0 && ev.Source != eventSourceRelay {
+				return false
+			}
+			if len(sources) > 0 && !slices.Contains(sources, ev.Source) {
+				return false
+			}
+			return typeOK(ev.Type)
+		}
+		var live func() bool
+		if cred != nil {
+			live = func() bool { return frontendCredentialLive(store, cred) }
+		}
+
+		if websocket.IsWebSocketUpgrade(r) {
+			var allowed []string
+			if allowedOrigins != nil {
+				allowed = allowedOrigins()
+			}
+			if !originAllowed(r, allowed) {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			sub := bus.Subscribe(q.Get("last_event_id"), filter)
+			defer sub.Cancel()
+			streamEventsWS(w, r, sub, live)
+			return
+		}
+		sub := bus.Subscribe(r.Header.Get("Last-Event-ID"), filter)
+		defer sub.Cancel()
+		streamEventsSSE(w, r, sub, live)
+	})
+}
+
+// streamEventsSSE writes sub to w as Server-Sent Events until the client
+// goes away, the bus drops the subscription, or live reports the
+// credential gone.
+func streamEventsSSE(w http.ResponseWriter, r *http.Request, sub *EventSubscription, live func() bool) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Nginx and friends buffer responses unless told not to.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+	recheck := time.NewTicker(frontendCredentialRecheck)
+	defer recheck.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-recheck.C:
+			if live != nil && !live() {
+				_, _ = fmt.Fprintf(w, "event: %s\ndata: {\"reason\":\"credential revoked\"}\n\n", EventStreamClosed)
+				_ = rc.Flush()
+				return
+			}
+			continue
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case ev, ok := <-sub.Events:
+			if !ok {
+				if sub.Dropped() {
+					slog.Info("frontend: event stream dropped a slow subscriber",
+						"request_id", r.Header.Get(bridge.RequestIDHeader))
+				}
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			// Neither ID nor type can hold a newline: IDs are relay's, and a
+			// service's event types are checked as they are read
+			// (validEventType).
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// streamEventsWS upgrades the request and writes sub to the WebSocket, one
+// text message per event, until the client closes it, the bus drops the
+// subscription, or live reports the credential gone. Anything the client
+// sends is read and discarded; reading is how its close frame is noticed.
+func streamEventsWS(w http.ResponseWriter, r *http.Request, sub *EventSubscription, live func() bool) {
+	var respHeader http.Header
+	if id := w.Header().Get(bridge.RequestIDHeader); id != "" {
+		respHeader = http.Header{bridge.RequestIDHeader: {id}}
+	}
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	conn, err := upgrader.Upgrade(w, r, respHeader)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	access := frontendAccessFrom(r.Context())
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait()))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait()))
+		})
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	closeWith := func(code int, reason string) {
+		_ = conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	}
+	ping := time.NewTicker(wsPingPeriod())
+	defer ping.Stop()
+	recheck := time.NewTicker(frontendCredentialRecheck)
+	defer recheck.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-recheck.C:
+			if live != nil && !live() {
+				closeWith(websocket.ClosePolicyViolation, "credential revoked")
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		case ev, ok := <-sub.Events:
+			if !ok {
+				// The client fell behind; it reconnects and resumes.
+				closeWith(websocket.CloseTryAgainLater, "subscriber too slow")
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+			access.countWS(false, int64(len(data)))
+		}
+	}
+}
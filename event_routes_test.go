@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"relaygo/bridge"
+)
+
+// Tests for GET /api/events over a live FrontendServer: SSE framing and
+// resuming, the WebSocket transport, the type filter, a scoped credential's
+// project filter and revocation, and the 503 without a bus.
+
+// startEventFrontend brings up a FrontendServer on a Unix socket streaming
+// bus, with two projects in its settings.
+func startEventFrontend(t *testing.T, bus *EventBus) (SettingsStore, string, Project, Project) {
+	t.Helper()
+	sock := filepath.Join(mkShortTempDir(t, "fe-ev-"), "frontend.sock")
+	store := newProjectsTestStore(t)
+	mine := createTestProject(t, store, "Mine", t.TempDir(), []string{"fsmcp"})
+	other := createTestProject(t, store, "Other", t.TempDir(), []string{"fsmcp"})
+	extMgr := NewExternalMcpManager(nil)
+	srv, err := NewFrontendServer(store, extMgr, extMgr, Endpoint{Socket: sock, Token: "good-token"},
+		NewEnhancedServiceRegistry(nil), nil, nil, bus, nil)
+	assertNoErr(t, err, "NewFrontendServer")
+	go func() { _ = srv.Serve() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	_ = dialUnixWithTimeout(t, sock, 2*time.Second).Close()
+	return store, sock, mine, other
+}
+
+// sseFrame is one event read off an SSE stream.
+type sseFrame struct {
+	id, event string
+	data      RelayEvent
+}
+
+// openSSE GETs /api/events and returns a reader of its frames. The stream
+// is closed at the end of the test.
+func openSSE(t *testing.T, sock, query string, hdr http.Header) (*http.Response, func() sseFrame) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://unix/api/events"+query, nil)
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	resp, err := dialFrontendHTTP(sock).Do(req)
+	assertNoErr(t, err, "GET /api/events")
+	t.Cleanup(func() { resp.Body.Close() })
+
+	frames := make(chan sseFrame, 16)
+	go func() {
+		defer close(frames)
+		sc := bufio.NewScanner(resp.Body)
+		var f sseFrame
+		for sc.Scan() {
+			field, value, _ := strings.Cut(sc.Text(), ": ")
+			switch field {
+			case "id":
+				f.id = value
+			case "event":
+				f.event = value
+			case "data":
+				_ = json.Unmarshal([]byte(value), &f.data)
+			case "":
+				if f.event != "" {
+					frames <- f
+				}
+				f = sseFrame{}
+			}
+		}
+	}()
+	return resp, func() sseFrame {
+		t.Helper()
+		select {
+		case f, ok := <-frames:
+			if !ok {
+				t.Fatal("stream ended")
+			}
+			return f
+		case <-time.After(2 * time.Second):
+			t.Fatal("no frame within 2s")
+		}
+		return sseFrame{}
+	}
+}
+
+// subscribed waits until the bus has n subscribers, so a test publishes
+// only once its stream is listening.
+func subscribed(t *testing.T, bus *EventBus, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		bus.mu.Lock()
+		got := len(bus.subs)
+		bus.mu.Unlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscribers, want %d", got, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEventRoutes_SSE(t *testing.T) {
+	bus := NewEventBus()
+	_, sock, _, _ := startEventFrontend(t, bus)
+
+	resp, next := openSSE(t, sock, "?types=mcp.", bearer("good-token"))
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	subscribed(t, bus, 1)
+	bus.Publish(EventServiceExited, eventSourceRelay, "", nil) // filtered out
+	bus.Publish(EventMcpConnected, eventSourceRelay, "", mcpEventData{MCP: "fsmcp"})
+	bus.Publish(EventMcpStopped, eventSourceRelay, "", mcpEventData{MCP: "fsmcp"})
+
+	first := next()
+	if first.event != EventMcpConnected || first.id != first.data.ID || first.data.Source != eventSourceRelay {
+		t.Errorf("first frame = %+v", first)
+	}
+	if f := next(); f.event != EventMcpStopped {
+		t.Errorf("second frame = %s", f.event)
+	}
+
+	// Resuming after the first frame replays the second.
+	hdr := bearer("good-token")
+	hdr.Set("Last-Event-ID", first.id)
+	_, resumed := openSSE(t, sock, "?types=mcp.", hdr)
+	if f := resumed(); f.event != EventMcpStopped {
+		t.Errorf("resumed with %s, want %s", f.event, EventMcpStopped)
+	}
+}
+
+func TestEventRoutes_WebSocket(t *testing.T) {
+	bus := NewEventBus()
+	_, sock, _, _ := startEventFrontend(t, bus)
+	bus.Publish(EventServiceRegistered, eventSourceRelay, "", serviceEventData{Service: "a", Instance: "a"})
+	bus.Publish(EventServiceRegistered, eventSourceRelay, "", serviceEventData{Service: "b", Instance: "b"})
+	firstID := bus.boot + "-1"
+
+	conn, _, err := wsDialerOverUnix(sock).Dial("ws://unix/api/events?last_event_id="+firstID, bearer("good-token"))
+	assertNoErr(t, err, "dial")
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var ev RelayEvent
+	assertNoErr(t, conn.ReadJSON(&ev), "read replayed")
+	var data serviceEventData
+	_ = json.Unmarshal(ev.Data, &data)
+	if ev.Type != EventServiceRegistered || data.Service != "b" {
+		t.Errorf("replayed %s %s, want b's registration", ev.Type, ev.Data)
+	}
+
+	bus.Publish(EventServiceHealth, eventSourceRelay, "", serviceEventData{Service: "b", Health: HealthReady})
+	assertNoErr(t, conn.ReadJSON(&ev), "read live")
+	if ev.Type != EventServiceHealth {
+		t.Errorf("live event = %s", ev.Type)
+	}
+}
+
+func TestEventRoutes_ScopedCredential(t *testing.T) {
+	old := frontendCredentialRecheck
+	frontendCredentialRecheck = 50 * time.Millisecond
+	t.Cleanup(func() { frontendCredentialRecheck = old })
+
+	bus := NewEventBus()
+	store, sock, mine, other := startEventFrontend(t, bus)
+	token := mustCreateCred(t, store, frontendCredentialRequest{
+		Name:       "watcher",
+		Routes:     []string{"/api/events"},
+		ProjectIDs: []string{mine.ID},
+	})
+
+	_, next := openSSE(t, sock, "", bearer(token))
+	subscribed(t, bus, 1)
+	bus.Publish(EventProjectUpdated, eventSourceRelay, other.ID, nil)
+	bus.Publish(EventProjectUpdated, eventSourceRelay, mine.ID, nil)
+	// A service's event, here about the other project, which relay can't see.
+	publishServiceEvent(bus, "relayLLM", bridge.EventsDecl{}, "session.updated", []byte(`{"projectId":"`+other.ID+`"}`))
+	bus.Publish(EventMcpConnected, eventSourceRelay, "", nil)
+	if f := next(); f.event != EventProjectUpdated || f.data.Project != mine.ID {
+		t.Errorf("first frame = %s for %q, want only %s's", f.event, f.data.Project, mine.ID)
+	}
+	if f := next(); f.event != EventMcpConnected {
+		t.Errorf("second frame = %s, want the projectless event", f.event)
+	}
+
+	_, err := revokeFrontendCredential(store, "watcher")
+	assertNoErr(t, err, "revoke")
+	if f := next(); f.event != EventStreamClosed {
+		t.Errorf("after revoke: %s, want %s", f.event, EventStreamClosed)
+	}
+
+	// Not a route the credential was granted: refused before streaming.
+	narrow := mustCreateCred(t, store, frontendCredentialRequest{Name: "narrow", Routes: []string{"/api/projects"}})
+	resp := getStatus(t, dialFrontendHTTP(sock), "GET", "http://unix/api/events", bearer(narrow))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("credential without /api/events = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestEventRoutes_WebSocketRejectsForeignOrigin(t *testing.T) {
+	_, sock, _, _ := startEventFrontend(t, NewEventBus())
+	hdr := bearer("good-token")
+	hdr.Set("Origin", "https://evil.example")
+	_, resp, err := wsDialerOverUnix(sock).Dial("ws://unix/api/events", hdr)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("foreign origin: err %v, resp %v; want 403", err, resp)
+	}
+}
+
+func TestEventRoutes_BadRequestAndUnavailable(t *testing.T) {
+	_, sock, _, _ := startEventFrontend(t, nil)
+	c := dialFrontendHTTP(sock)
+	if resp := getStatus(t, c, "GET", "http://unix/api/events", bearer("good-token")); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("nil bus = %d, want 503", resp.StatusCode)
+	}
+
+	_, sock, _, _ = startEventFrontend(t, NewEventBus())
+	c = dialFrontendHTTP(sock)
+	if resp := getStatus(t, c, "GET", "http://unix/api/events?types=a%20b", bearer("good-token")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad types = %d, want 400", resp.StatusCode)
+	}
+	if resp := getStatus(t, c, "GET", "http://unix/api/events", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token = %d, want 401", resp.StatusCode)
+	}
+}
@@ -44,6 +44,25 @@ func progressTokenString(v interface{}) string {
 	return fmt.Sprintf("%v", v)
 }
 
+// authStateConn is the optional capability of an McpConnection that tracks an
+// OAuth lifecycle. Only the HTTP connection implements it; stdio MCPs have no
+// auth state and report "".
+type authStateConn interface {
+	AuthState() McpAuthState
+}
+
+// exitStatusConn is implemented by connections backed by a local process
+// (stdio), which can say how that process ended.
+type exitStatusConn interface {
+	exitStatus() (childExit, bool)
+}
+
+// processConn is implemented by connections backed by a local process,
+// which report its PID while it runs (0 once it has exited).
+type processConn interface {
+	pid() int
+}
+
 // McpConnection abstracts a connection to an external MCP server (stdio or HTTP).
 type McpConnection interface {
 	SendRequest(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
@@ -64,6 +83,35 @@ type ExternalMcpManager struct {
 	conns          map[string]McpConnection
 	schemas        map[string]json.RawMessage // id → context schema (runtime-only)
 	onTokenRefresh OnTokenRefreshFunc
+
+	// OnAuthStateChange is called whenever an HTTP MCP's McpAuthState
+	// changes (a refresh starts or settles, or the provider rejects the
+	// grant). Set once during initialization, before any MCPs are started,
+	// so concurrent reads from request goroutines are safe. Drives the
+	// settings UI's auth badges without polling.
+	OnAuthStateChange func(mcpID string, state McpAuthState)
+
+	// SandboxProjectPaths resolves a sandbox profile's project_paths: the
+	// paths of the projects that currently grant mcpID. Consulted at each
+	// stdio spawn, so it must read fresh settings. Set once during
+	// initialization like OnAuthStateChange; nil exposes no project paths.
+	SandboxProjectPaths func(mcpID string) []string
+
+	// Events is the bus MCP connects, stops and exits are published on
+	// (event_bus.go). Set once during initialization like
+	// OnAuthStateChange; nil publishes nothing.
+	Events *EventBus
+}
+
+// mcpEventData is the data of relay's mcp.* events.
+type mcpEventData struct {
+	MCP   string `json:"mcp"`
+	Tools int    `json:"tools,omitempty"`
+	// Status and Limit are set on mcp.exited, as on service.exited.
+	Status string `json:"status,omitempty"`
+	Limit  string `json:"limit,omitempty"`
+	// State is set on mcp.auth_state.
+	State McpAuthState `json:"state,omitempty"`
 }
 
 // pendingResponse holds a channel for delivering a JSON-RPC response to a waiting caller.
@@ -130,6 +178,10 @@ type externalMcpConn struct {
 	readerDone chan struct{} // closed when the reader goroutine exits
 	readerErr  error         // set before readerDone is closed
 	closeOnce  sync.Once     // ensures Close is idempotent
+
+	limits *childLimits  // resource-limit enforcement (nil if unlimited)
+	exited chan struct{} // closed by reap once the process is waited for
+	exit   childExit     // set before exited is closed
 }
 
 // registerProgress installs a per-call handler keyed by progressToken; the
@@ -305,6 +357,27 @@ func (m *ExternalMcpManager) finalizeConnection(id string, conn McpConnection, r
 		m.mu.Unlock()
 	}
 	slog.Info("MCP connected", "id", id, "tools", len(result.Tools))
+	m.Events.Publish(EventMcpConnected, eventSourceRelay, "", mcpEventData{MCP: id, Tools: len(result.Tools)})
+	if c, ok := conn.(*externalMcpConn); ok && c.exited != nil && m.Events != nil {
+		go m.watchExit(id, c)
+	}
+}
+
+// watchExit publishes mcp.exited when a stdio MCP's process ends while it
+// is still the connection for id. One Stop removed first (or a restart
+// replaced) ended on purpose, and mcp.stopped already said so.
+func (m *ExternalMcpManager) watchExit(id string, c *externalMcpConn) {
+	<-c.exited
+	m.mu.RLock()
+	current := m.conns[id] == McpConnection(c)
+	m.mu.RUnlock()
+	if current {
+		m.Events.Publish(EventMcpExited, eventSourceRelay, "", mcpEventData{
+			MCP:    id,
+			Status: c.exit.Status,
+			Limit:  c.exit.Limit,
+		})
+	}
 }
 
 // StartAll launches all configured external MCP servers concurrently.
@@ -358,26 +431,52 @@ func (m *ExternalMcpManager) startOne(ctx context.Context, mcpCfg *ExternalMcp)
 
 // spawnStdioConn creates and starts a stdio MCP connection.
 // The caller is responsible for calling Close() on error or when done.
+// env may carry ${secret:}/${file:} references (env_refs.go); they are
+// resolved here, so every (re)spawn reads the current value.
 func spawnStdioConn(command string, args []string, env map[string]string, config *ExternalMcp) (*externalMcpConn, error) {
+	resolved, err := resolveEnvRefs(env)
+	if err != nil {
+		return nil, err
+	}
 	cmd := exec.Command(command, args...)
 	setProcessGroup(cmd)
-	mergeEnv(cmd, env)
+	mergeEnv(cmd, resolved)
+	var limits *childLimits
+	if config != nil {
+		if config.Sandbox.active() {
+			if err := sandboxCommand(cmd, config); err != nil {
+				return nil, fmt.Errorf("sandbox: %w", err)
+			}
+		}
+		// After the sandbox, so the limits cover its helper stages too.
+		if limits, err = applyResourceLimits(cmd, config.Limits, "mcp-"+config.ID); err != nil {
+			return nil, fmt.Errorf("resource limits: %w", err)
+		}
+	}
+	abandon := func() {
+		limits.started()
+		limits.finish()
+	}
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
+		abandon()
 		return nil, fmt.Errorf("stdin pipe: %w", err)
 	}
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		stdin.Close()
+		abandon()
 		return nil, fmt.Errorf("stdout pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
 		stdin.Close()
 		stdout.Close()
+		abandon()
 		return nil, fmt.Errorf("spawn failed: %w", err)
 	}
+	limits.started()
 
 	conn := &externalMcpConn{
 		cmd:         cmd,
@@ -385,20 +484,70 @@ func spawnStdioConn(command string, args []string, env map[string]string, config
 		pending:     make(map[int64]*pendingResponse),
 		progressSem: make(chan struct{}, maxInflightProgress),
 		readerDone:  make(chan struct{}),
+		limits:      limits,
+		exited:      make(chan struct{}),
 	}
 	if config != nil {
 		conn.config = *config
 	}
 
 	go conn.readLoop(stdout)
+	go conn.reap()
 	return conn, nil
 }
 
+// reap waits for the MCP process once its stdout is drained (Wait closes
+// the pipe, so waiting any earlier could drop a final response) and records
+// how it ended. Without this an MCP that dies on its own stays an
+// unreaped zombie until Close, and a memory-limit kill is indistinguishable
+// from a crash.
+func (c *externalMcpConn) reap() {
+	<-c.readerDone
+	err := c.cmd.Wait()
+	c.exit = describeExit(err, c.limits.finish())
+	close(c.exited)
+	if c.exit.Limit != "" {
+		slog.Warn("external MCP killed by resource limit", "id", c.config.ID, "limit", c.exit.Limit, "status", c.exit.Status)
+	}
+}
+
+// exitStatus reports how the process ended, once it has.
+func (c *externalMcpConn) exitStatus() (childExit, bool) {
+	if c.exited == nil {
+		return childExit{}, false
+	}
+	select {
+	case <-c.exited:
+		return c.exit, true
+	default:
+		return childExit{}, false
+	}
+}
+
+// pid reports the MCP process's PID until it has been reaped.
+func (c *externalMcpConn) pid() int {
+	if c.cmd == nil || c.cmd.Process == nil {
+		return 0
+	}
+	if _, done := c.exitStatus(); done {
+		return 0
+	}
+	return c.cmd.Process.Pid
+}
+
 // maxInflightProgress caps concurrent progress-delivery goroutines per stdio
 // connection (see externalMcpConn.progressSem).
 const maxInflightProgress = 64
 
 func (m *ExternalMcpManager) startStdio(ctx context.Context, mcpCfg *ExternalMcp) error {
+	if mcpCfg.Sandbox.active() && mcpCfg.Sandbox.ProjectPaths && m.SandboxProjectPaths != nil {
+		// Resolve on a copy: the profile the caller holds stays as persisted.
+		cfg := *mcpCfg
+		sb := *cfg.Sandbox
+		sb.projectPaths = m.SandboxProjectPaths(cfg.ID)
+		cfg.Sandbox = &sb
+		mcpCfg = &cfg
+	}
 	conn, err := spawnStdioConn(mcpCfg.Command, mcpCfg.Args, mcpCfg.Env, mcpCfg)
 	if err != nil {
 		return err
@@ -517,6 +666,65 @@ func (m *ExternalMcpManager) IsConnected(id string) bool {
 	return ok
 }
 
+// AuthState returns the OAuth state of a connected HTTP MCP, or "" for a
+// stdio MCP or one with no live connection.
+func (m *ExternalMcpManager) AuthState(id string) McpAuthState {
+	m.mu.RLock()
+	conn, ok := m.conns[id]
+	m.mu.RUnlock()
+	if !ok {
+		return ""
+	}
+	if ac, ok := conn.(authStateConn); ok {
+		return ac.AuthState()
+	}
+	return ""
+}
+
+// LastExit reports how a stdio MCP's process ended, while the dead
+// connection is still registered (until the next reload or reconcile).
+func (m *ExternalMcpManager) LastExit(id string) (childExit, bool) {
+	m.mu.RLock()
+	conn, ok := m.conns[id]
+	m.mu.RUnlock()
+	if !ok {
+		return childExit{}, false
+	}
+	if ec, ok := conn.(exitStatusConn); ok {
+		return ec.exitStatus()
+	}
+	return childExit{}, false
+}
+
+// PIDsByMcpID returns the OS PID of each running stdio MCP. HTTP MCPs have
+// no local process and are never listed.
+func (m *ExternalMcpManager) PIDsByMcpID() map[string]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string]int)
+	for id, conn := range m.conns {
+		if pc, ok := conn.(processConn); ok {
+			if pid := pc.pid(); pid != 0 {
+				out[id] = pid
+			}
+		}
+	}
+	return out
+}
+
+// AuthStates returns the OAuth state of every connected HTTP MCP, keyed by ID.
+func (m *ExternalMcpManager) AuthStates() map[string]McpAuthState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string]McpAuthState)
+	for id, conn := range m.conns {
+		if ac, ok := conn.(authStateConn); ok {
+			out[id] = ac.AuthState()
+		}
+	}
+	return out
+}
+
 // FindToolOwner returns the ID and config of the external MCP that owns the named tool.
 func (m *ExternalMcpManager) FindToolOwner(toolName string) (string, *ExternalMcp) {
 	m.mu.RLock()
@@ -612,6 +820,7 @@ func (m *ExternalMcpManager) Stop(id string) {
 
 	if ok {
 		conn.Close()
+		m.Events.Publish(EventMcpStopped, eventSourceRelay, "", mcpEventData{MCP: id})
 	}
 }
 
@@ -833,7 +1042,11 @@ func (c *externalMcpConn) Close() {
 		}
 		if c.cmd != nil {
 			killProcessGroup(c.cmd)
-			_ = c.cmd.Wait()
+			if c.exited != nil {
+				<-c.exited
+			} else {
+				_ = c.cmd.Wait()
+			}
 		}
 		// Wait for readLoop to finish so no goroutine is leaked and all pending
 		// requests are drained before the connection is considered closed.
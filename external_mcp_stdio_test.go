@@ -186,3 +186,43 @@ func TestStdioConn_RequestTimeout(t *testing.T) {
 		t.Fatalf("want request-timeout error, got %v", err)
 	}
 }
+
+// Once the child is gone the connection reaps it on its own and records how
+// it ended, so `relay mcp list` can say "exited: status 0" rather than a
+// bare "disconnected".
+func TestStdioConn_RecordsExitStatus(t *testing.T) {
+	conn := newTestMcpConn(t)
+	if _, ok := conn.exitStatus(); ok {
+		t.Fatal("exit status reported for a live process")
+	}
+	_, _ = conn.SendRequest(context.Background(), "exit", nil)
+
+	select {
+	case <-conn.exited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("process never reaped after exit")
+	}
+	exit, ok := conn.exitStatus()
+	if !ok || exit.Status != "exited: status 0" || exit.Limit != "" {
+		t.Fatalf("exitStatus = %+v, %v", exit, ok)
+	}
+}
+
+func TestExternalMcpManager_PIDsByMcpID(t *testing.T) {
+	conn := newTestMcpConn(t)
+	mgr := NewExternalMcpManager(nil)
+	mgr.setConnection("fs", conn)
+
+	if got := mgr.PIDsByMcpID(); got["fs"] != conn.cmd.Process.Pid || len(got) != 1 {
+		t.Fatalf("PIDsByMcpID = %v, want fs=%d", got, conn.cmd.Process.Pid)
+	}
+	_, _ = conn.SendRequest(context.Background(), "exit", nil)
+	select {
+	case <-conn.exited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("process never reaped after exit")
+	}
+	if got := mgr.PIDsByMcpID(); len(got) != 0 {
+		t.Fatalf("PIDsByMcpID lists a reaped MCP: %v", got)
+	}
+}
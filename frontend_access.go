@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"relaygo/bridge"
+)
+
+// The frontend access log.
+//
+// Every request through the front door — answered by relay itself, refused
+// at auth, or proxied to a service — leaves one JSON line in
+// logs/frontend-access.log: the route it matched, the service it went to,
+// the status, latency and bytes, and for a WebSocket how long the session
+// lasted and what crossed it. Without it a 502 Eve reports is a guess
+// between "no service claimed the route", "the service was restarting" and
+// "the service dropped the connection".
+//
+// Each request also gets a correlation ID. Relay honours a well-formed
+// X-Request-ID the client sent and mints one otherwise, passes it to the
+// service in the same header, and echoes it on the response. A service that
+// hands it back on its bridge calls (bridge.Client.WithRequestID) gets it
+// recorded on their audit events, so `relay audit --request-id` finds the
+// tool calls one frontend request caused.
+
+// frontendAccessLogFile is the access log's name in the logs directory.
+const frontendAccessLogFile = "frontend-access.log"
+
+// frontendAccess is one request's access-log line. The front door creates
+// it and fills in what it sees; the layers inside add what only they know —
+// bearer auth the credential, the mux the route pattern, the dispatcher the
+// service, its manifest route and any upstream error.
+type frontendAccess struct {
+	TS         time.Time `json:"ts"`
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route,omitempty"`
+	Service    string    `json:"service,omitempty"`
+	Credential string    `json:"credential,omitempty"`
+	Remote     string    `json:"remote,omitempty"`
+	Status     int       `json:"status"`
+	DurMs      int64     `json:"dur_ms"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	// WS marks a WebSocket session: Status is 101, DurMs runs to its close,
+	// WSMs is how long it was open and the byte counts are message payloads.
+	WS    bool   `json:"ws,omitempty"`
+	WSMs  int64  `json:"ws_ms,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	// Counted as the request runs, from the pumps of a WebSocket session
+	// among others, and copied into BytesIn/BytesOut when it ends.
+	in, out  atomic.Int64
+	upgraded time.Time
+}
+
+type frontendAccessKey struct{}
+
+// frontendAccessFrom returns the access record of the request ctx belongs
+// to, or nil outside the front door (handlers under test, say). Every
+// setter below is nil-safe for that reason.
+func frontendAccessFrom(ctx context.Context) *frontendAccess {
+	a, _ := ctx.Value(frontendAccessKey{}).(*frontendAccess)
+	return a
+}
+
+// setRoute records the route the request matched.
+func (a *frontendAccess) setRoute(route string) {
+	if a != nil {
+		a.Route = route
+	}
+}
+
+// setService records the service instance the request was sent to.
+func (a *frontendAccess) setService(instance string) {
+	if a != nil {
+		a.Service = instance
+	}
+}
+
+// setCredential records the scoped credential the request authenticated with.
+func (a *frontendAccess) setCredential(name string) {
+	if a != nil {
+		a.Credential = name
+	}
+}
+
+// setError records why the request failed beyond its status.
+func (a *frontendAccess) setError(err error) {
+	if a != nil && err != nil {
+		a.Error = err.Error()
+	}
+}
+
+// countWS adds a WebSocket message's payload to the session's bytes,
+// inbound being client to service.
+func (a *frontendAccess) countWS(inbound bool, n int64) {
+	if a == nil {
+		return
+	}
+	if inbound {
+		a.in.Add(n)
+	} else {
+		a.out.Add(n)
+	}
+}
+
+// frontendAccessLog writes access records as JSON lines to a rotating file.
+type frontendAccessLog struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	closed bool
+}
+
+// openFrontendAccessLog opens logs/frontend-access.log with openRotatingLog.
+// A log that can't be opened is reported and left out: requests are still
+// served, and still get their correlation IDs.
+func openFrontendAccessLog() *frontendAccessLog {
+	dir, err := serviceLogDir()
+	if err == nil {
+		var w *rotatingWriter
+		if w, err = openRotatingLog(filepath.Join(dir, frontendAccessLogFile)); err == nil {
+			return &frontendAccessLog{w: w}
+		}
+	}
+	slog.Warn("frontend: access log unavailable", "error", err)
+	return nil
+}
+
+func (l *frontendAccessLog) write(a *frontendAccess) {
+	if l == nil {
+		return
+	}
+	line, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// A WebSocket session can outlive Shutdown; its line is dropped rather
+	// than reopening the file behind it.
+	if l.closed {
+		return
+	}
+	_, _ = l.w.Write(append(line, '\n'))
+}
+
+// Close closes the file. Nil-safe.
+func (l *frontendAccessLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.w.Close()
+}
+
+// frontendRequestID returns the request's correlation ID: the client's
+// X-Request-ID when it passes bridge.ValidRequestID, a fresh UUID otherwise.
+// An ID that fails is replaced rather than logged, so a client can't write
+// what it likes into the access log.
+func frontendRequestID(r *http.Request) string {
+	if id := r.Header.Get(bridge.RequestIDHeader); bridge.ValidRequestID(id) {
+		return id
+	}
+	return uuid.NewString()
+}
+
+// frontendAccessLogger is the front door's outermost layer: it assigns the
+// correlation ID, sets it on the request (which the dispatcher forwards) and
+// the response, and writes the request's access record once it completes —
+// for a WebSocket, once the session closes. log may be nil, which still
+// assigns IDs.
+func frontendAccessLogger(log *frontendAccessLog, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		a := &frontendAccess{
+			TS:        start.UTC(),
+			RequestID: frontendRequestID(r),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+		}
+		// A Unix socket peer has no address worth recording.
+		if _, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			a.Remote = r.RemoteAddr
+		}
+		r.Header.Set(bridge.RequestIDHeader, a.RequestID)
+		w.Header().Set(bridge.RequestIDHeader, a.RequestID)
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &countingBody{ReadCloser: r.Body, n: &a.in}
+		}
+		aw := &accessResponseWriter{ResponseWriter: w, a: a}
+
+		defer func() {
+			end := time.Now()
+			a.DurMs = end.Sub(start).Milliseconds()
+			if a.Status == 0 {
+				// Nothing written: net/http answers 200 for a handler that
+				// returns without a word.
+				a.Status = http.StatusOK
+			}
+			if a.WS {
+				a.WSMs = end.Sub(a.upgraded).Milliseconds()
+			}
+			a.BytesIn, a.BytesOut = a.in.Load(), a.out.Load()
+			log.write(a)
+		}()
+		next.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), frontendAccessKey{}, a)))
+	})
+}
+
+// accessResponseWriter records the status and body bytes of a response.
+// It implements Hijacker for the WebSocket upgrade, and Unwrap so the
+// reverse proxy's flushes reach the real writer.
+type accessResponseWriter struct {
+	http.ResponseWriter
+	a           *frontendAccess
+	wroteHeader bool
+}
+
+func (w *accessResponseWriter) WriteHeader(code int) {
+	// Informational headers (103 Early Hints) precede the real status.
+	if !w.wroteHeader && code >= 200 {
+		w.wroteHeader = true
+		w.a.Status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.a.Status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.a.out.Add(int64(n))
+	return n, err
+}
+
+func (w *accessResponseWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *accessResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection to the WebSocket upgrader. From here the
+// record describes a session: the dispatcher counts its messages.
+func (w *accessResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.wroteHeader = true
+	w.a.Status = http.StatusSwitchingProtocols
+	w.a.WS = true
+	w.a.upgraded = time.Now()
+	return conn, brw, nil
+}
+
+// countingBody counts the request body bytes a handler reads.
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// frontendRoutePattern records which of relay's own routes the mux will
+// serve a request with. The dispatcher's catch-all replaces it with the
+// manifest route that matched.
+func frontendRoutePattern(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a := frontendAccessFrom(r.Context()); a != nil {
+			_, pattern := mux.Handler(r)
+			a.setRoute(pattern)
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"relaygo/bridge"
+)
+
+// Tests for the frontend access log and correlation IDs
+// (frontend_access.go): one line per request with the route, service,
+// status and bytes; X-Request-ID honoured, replaced, forwarded and echoed;
+// WebSocket sessions logged when they close.
+
+// readAccessLog waits until the access log holds at least n lines — a
+// request's line is written after its response, so the client can see the
+// response first — and returns them.
+func readAccessLog(t *testing.T, n int) []*frontendAccess {
+	t.Helper()
+	path := filepath.Join(bridge.ConfigDir(), "logs", frontendAccessLogFile)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		var out []*frontendAccess
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if line == "" {
+				continue
+			}
+			a := &frontendAccess{}
+			if err := json.Unmarshal([]byte(line), a); err != nil {
+				t.Fatalf("access log line is not JSON: %v\n%s", err, line)
+			}
+			out = append(out, a)
+		}
+		if len(out) >= n {
+			return out
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("access log has %d lines, want %d", len(out), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFrontendAccessLog_ProxiedRequest(t *testing.T) {
+	enhanced := NewEnhancedServiceRegistry(nil)
+	fake := NewFakeService(t, FakeServiceOptions{
+		ServiceID: "svc-echo",
+		Manifest:  newManifest("/api/echo/"),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// A service echoing the ID must not produce a second value.
+			w.Header().Set(bridge.RequestIDHeader, r.Header.Get(bridge.RequestIDHeader))
+			_, _ = w.Write([]byte("hello"))
+		}),
+	})
+	assertNoErr(t, enhanced.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "RegisterManifest")
+	sock := startFrontendServerWith(t, "good-token", enhanced)
+
+	req, _ := http.NewRequest("POST", "http://unix/api/echo/x", strings.NewReader("abc"))
+	req.Header.Set("Authorization", "Bearer good-token")
+	req.Header.Set(bridge.RequestIDHeader, "eve-42")
+	resp, err := dialFrontendHTTP(sock).Do(req)
+	assertNoErr(t, err, "POST")
+	resp.Body.Close()
+
+	if got := resp.Header.Values(bridge.RequestIDHeader); len(got) != 1 || got[0] != "eve-42" {
+		t.Errorf("response X-Request-ID = %v, want [eve-42]", got)
+	}
+	if got := fake.LastRequest().Headers.Get(bridge.RequestIDHeader); got != "eve-42" {
+		t.Errorf("service saw X-Request-ID %q, want eve-42", got)
+	}
+	a := readAccessLog(t, 1)[0]
+	if a.RequestID != "eve-42" || a.Method != "POST" || a.Path != "/api/echo/x" {
+		t.Errorf("logged %s %s id=%s", a.Method, a.Path, a.RequestID)
+	}
+	if a.Route != "/api/echo/" || a.Service != "svc-echo" || a.Status != http.StatusOK {
+		t.Errorf("route/service/status = %q/%q/%d", a.Route, a.Service, a.Status)
+	}
+	if a.BytesIn != 3 || a.BytesOut != 5 {
+		t.Errorf("bytes in/out = %d/%d, want 3/5", a.BytesIn, a.BytesOut)
+	}
+	if a.WS || a.Error != "" {
+		t.Errorf("unexpected ws=%v error=%q", a.WS, a.Error)
+	}
+}
+
+// Refusals are logged too, and a malformed inbound ID is replaced rather
+// than written to the log.
+func TestFrontendAccessLog_RefusedRequestAndRelayRoutes(t *testing.T) {
+	sock := startFrontendServerWith(t, "good-token", NewEnhancedServiceRegistry(nil))
+	client := dialFrontendHTTP(sock)
+
+	req, _ := http.NewRequest("GET", "http://unix/api/projects", nil)
+	req.Header.Set(bridge.RequestIDHeader, "bad id\"")
+	resp, err := client.Do(req)
+	assertNoErr(t, err, "GET unauthenticated")
+	resp.Body.Close()
+	id := resp.Header.Get(bridge.RequestIDHeader)
+	if resp.StatusCode != http.StatusUnauthorized || !bridge.ValidRequestID(id) {
+		t.Fatalf("status %d, X-Request-ID %q: want 401 and a fresh ID", resp.StatusCode, id)
+	}
+
+	req, _ = http.NewRequest("GET", "http://unix/api/projects", nil)
+	req.Header.Set("Authorization", "Bearer good-token")
+	resp, err = client.Do(req)
+	assertNoErr(t, err, "GET")
+	resp.Body.Close()
+
+	lines := readAccessLog(t, 2)
+	if lines[0].RequestID != id || lines[0].Status != http.StatusUnauthorized {
+		t.Errorf("first line = id %q status %d, want %q 401", lines[0].RequestID, lines[0].Status, id)
+	}
+	if lines[1].Route != "GET /api/projects" || lines[1].Service != "" || lines[1].Status != http.StatusOK {
+		t.Errorf("second line route/service/status = %q/%q/%d", lines[1].Route, lines[1].Service, lines[1].Status)
+	}
+	if lines[0].RequestID == lines[1].RequestID {
+		t.Error("two requests shared a request ID")
+	}
+}
+
+// The "Eve says 502" case: the line names the service and why it failed.
+func TestFrontendAccessLog_UpstreamError(t *testing.T) {
+	enhanced := NewEnhancedServiceRegistry(nil)
+	gone := filepath.Join(mkShortTempDir(t, "fe-gone-"), "gone.sock")
+	assertNoErr(t, enhanced.RegisterManifest("svc-gone", gone, "", newManifest("/api/gone")), "RegisterManifest")
+	sock := startFrontendServerWith(t, "good-token", enhanced)
+
+	req, _ := http.NewRequest("GET", "http://unix/api/gone", nil)
+	req.Header.Set("Authorization", "Bearer good-token")
+	resp, err := dialFrontendHTTP(sock).Do(req)
+	assertNoErr(t, err, "GET")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502", resp.StatusCode)
+	}
+	a := readAccessLog(t, 1)[0]
+	if a.Service != "svc-gone" || a.Status != http.StatusBadGateway || a.Error == "" {
+		t.Errorf("service/status/error = %q/%d/%q", a.Service, a.Status, a.Error)
+	}
+}
+
+func TestFrontendAccessLog_WebSocketSession(t *testing.T) {
+	enhanced := NewEnhancedServiceRegistry(nil)
+	fake := echoWSService(t)
+	assertNoErr(t, enhanced.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "RegisterManifest")
+	sock := startFrontendServerWith(t, "good-token", enhanced)
+
+	hdr := http.Header{"Authorization": {"Bearer good-token"}, bridge.RequestIDHeader: {"ws-1"}}
+	conn, resp, err := wsDialerOverUnix(sock).Dial("ws://unix/ws", hdr)
+	assertNoErr(t, err, "dial")
+	if got := resp.Header.Get(bridge.RequestIDHeader); got != "ws-1" {
+		t.Errorf("upgrade response X-Request-ID = %q, want ws-1", got)
+	}
+	assertNoErr(t, conn.WriteMessage(websocket.TextMessage, []byte("hi")), "write")
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "echo:hi" {
+		t.Fatalf("echo = %q, %v", msg, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+
+	if got := fake.LastRequest().Headers.Get(bridge.RequestIDHeader); got != "ws-1" {
+		t.Errorf("service saw X-Request-ID %q on the upgrade, want ws-1", got)
+	}
+	a := readAccessLog(t, 1)[0]
+	if !a.WS || a.Status != http.StatusSwitchingProtocols || a.Route != "/ws" || a.RequestID != "ws-1" {
+		t.Errorf("logged ws=%v status=%d route=%q id=%q", a.WS, a.Status, a.Route, a.RequestID)
+	}
+	if a.BytesIn != 2 || a.BytesOut != 7 {
+		t.Errorf("message bytes in/out = %d/%d, want 2/7", a.BytesIn, a.BytesOut)
+	}
+	if a.WSMs < 20 {
+		t.Errorf("ws_ms = %d, want the session's length", a.WSMs)
+	}
+}
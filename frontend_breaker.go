@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"relaygo/bridge"
+)
+
+// Circuit breaking and retry for dispatched requests.
+//
+// A service whose internal socket is gone — it crashed, or is restarting —
+// stays registered until the reaper Forgets it, and until then every
+// request routed to it waits on a dial that fails. Each replica therefore
+// has a circuit breaker in its dispatcher bookkeeping (replicaLoad). It
+// counts consecutive requests that failed to get a response. Past the
+// manifest's threshold the circuit opens: Lookup routes around the replica,
+// and when it is the only one the dispatcher answers 503 with Retry-After
+// straight away. Once the open period has passed, one request probes the
+// replica (half-open); its outcome closes the circuit or opens it again for
+// longer. A replica that registers again starts closed — it came back.
+//
+// A service that opts in (DispatchDecl.RetryOnRestart) also has a GET or
+// HEAD that failed held until the service registers again, then sent once
+// more (FrontendDispatcher.retryAfterRestart).
+
+// Circuit breaker defaults and bounds. Vars so tests can shorten them.
+var (
+	defaultBreakerThreshold = 3
+	defaultBreakerOpen      = 5 * time.Second
+	// breakerOpenMax caps the open period as it doubles on failed probes.
+	breakerOpenMax = time.Minute
+	// dispatchRetryWait bounds how long a retried request waits for its
+	// service to register again.
+	dispatchRetryWait = 10 * time.Second
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// String is the state's name in status output; "" for closed, which is
+// what status leaves out.
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half_open"
+	default:
+		return ""
+	}
+}
+
+// circuitBreaker is one replica's breaker. The zero value is closed with
+// the default settings.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    circuitState
+	failures int // consecutive, while closed
+	// trips counts the openings since the circuit was last closed; each
+	// doubles the open period.
+	trips int
+	// until is when an open circuit admits a probe, and while half-open,
+	// when a probe that never reported back stops blocking the next.
+	until time.Time
+
+	threshold int
+	open      time.Duration
+}
+
+// configure resets the breaker to closed with a manifest's settings.
+// Called when the replica registers.
+func (b *circuitBreaker) configure(d *bridge.DispatchDecl) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures, b.trips, b.until = circuitClosed, 0, 0, time.Time{}
+	b.threshold, b.open = 0, 0
+	if d != nil {
+		b.threshold = d.FailureThreshold
+		b.open = time.Duration(d.OpenSeconds) * time.Second
+	}
+}
+
+// blocked reports whether the breaker would refuse a request now, without
+// claiming a probe: Lookup's check when choosing among replicas.
+func (b *circuitBreaker) blocked(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != circuitClosed && now.Before(b.until)
+}
+
+// allow reports whether a request may go to the replica. An open circuit
+// whose period has passed goes half-open and admits this request as its
+// probe; until the probe reports, or a probe period passes without it, the
+// rest are refused. When refused, wait is how long until it's worth trying
+// again.
+func (b *circuitBreaker) allow(now time.Time) (ok bool, wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == circuitClosed {
+		return true, 0
+	}
+	if now.Before(b.until) {
+		return false, b.until.Sub(now)
+	}
+	b.state = circuitHalfOpen
+	b.until = now.Add(b.openPeriodLocked())
+	return true, 0
+}
+
+// record counts one request's outcome — err nil for a response of any
+// status — and returns the new state when it changed.
+func (b *circuitBreaker) record(err error, now time.Time) (circuitState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		if b.state == circuitClosed {
+			return circuitClosed, false
+		}
+		b.state, b.trips, b.until = circuitClosed, 0, time.Time{}
+		return circuitClosed, true
+	}
+	switch b.state {
+	case circuitClosed:
+		b.failures++
+		if b.failures < b.thresholdLocked() {
+			return circuitClosed, false
+		}
+	case circuitOpen:
+		// A request admitted before the circuit opened, failing late.
+		return circuitOpen, false
+	}
+	b.state, b.failures = circuitOpen, 0
+	b.until = now.Add(b.openPeriodLocked())
+	b.trips++
+	return circuitOpen, true
+}
+
+// status returns the breaker's state for status output.
+func (b *circuitBreaker) status() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) thresholdLocked() int {
+	if b.threshold > 0 {
+		return b.threshold
+	}
+	return defaultBreakerThreshold
+}
+
+// openPeriodLocked is how long the circuit stays open after its next
+// opening: the configured period, doubled per opening since it was last
+// closed, up to breakerOpenMax.
+func (b *circuitBreaker) openPeriodLocked() time.Duration {
+	d := b.open
+	if d <= 0 {
+		d = defaultBreakerOpen
+	}
+	for range min(b.trips, 16) {
+		d *= 2
+	}
+	return min(d, max(breakerOpenMax, b.open))
+}
+
+// retryAfterHeader renders a wait as a Retry-After value: whole seconds,
+// rounded up, at least 1.
+func retryAfterHeader(wait time.Duration) string {
+	return strconv.Itoa(max(1, int(math.Ceil(wait.Seconds()))))
+}
+
+// recordDispatch feeds one dispatched request's outcome to the replica's
+// breaker, logging and publishing the transitions. err is nil for a
+// response; a request the client abandoned says nothing about the service
+// and isn't recorded.
+func (r *EnhancedServiceRegistry) recordDispatch(ctx context.Context, rec *EnhancedService, err error) {
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	state, changed := rec.load.breaker.record(err, time.Now())
+	if !changed {
+		return
+	}
+	if state == circuitOpen {
+		slog.Warn("frontend dispatch: circuit opened", "service", rec.instance(), "error", err)
+	} else {
+		slog.Info("frontend dispatch: circuit closed", "service", rec.instance())
+	}
+	circuit := state.String()
+	if circuit == "" {
+		circuit = "closed"
+	}
+	r.Events.Publish(EventServiceCircuit, eventSourceRelay, "", serviceEventData{
+		Service:  rec.ServiceID,
+		Instance: rec.instance(),
+		Circuit:  circuit,
+	})
+}
+
+// dispatchAttemptKey carries a *dispatchAttempt in a request's context.
+type dispatchAttemptKey struct{}
+
+// dispatchAttempt marks a request the dispatcher will retry if it fails.
+// The proxy's error handler records the failure here instead of answering
+// 502, leaving the response unwritten for the retry.
+type dispatchAttempt struct {
+	err error
+}
+
+func dispatchAttemptFrom(ctx context.Context) *dispatchAttempt {
+	a, _ := ctx.Value(dispatchAttemptKey{}).(*dispatchAttempt)
+	return a
+}
+
+// retriesOnRestart reports whether a failed request to svc should wait for
+// the service to come back and go again: the manifest opted in, and the
+// request is a GET or HEAD without a body, so sending it twice is safe and
+// there is nothing to replay.
+func retriesOnRestart(svc *EnhancedService, r *http.Request) bool {
+	d := svc.Manifest.Dispatch
+	if d == nil || !d.RetryOnRestart {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0
+}
+
+// retryAfterRestart sends a GET or HEAD that failed to reach old once
+// more, when the registry has a replica other than old to route it to —
+// the service registered again after restarting, or another replica of it
+// is taking requests — or answers 503 after dispatchRetryWait without one.
+// The replica it retries on is a new registration, whose manifest may
+// guard the path where old's didn't, so ready checks its guards again.
+func (d *FrontendDispatcher) retryAfterRestart(w http.ResponseWriter, r *http.Request, old *EnhancedService, cause error) {
+	timer := time.NewTimer(dispatchRetryWait)
+	defer timer.Stop()
+	for {
+		changed := d.registry.changes()
+		if svc, match := d.registry.Lookup(r.Method, r.URL.Path); svc != nil && svc != old {
+			if !d.ready(w, r, svc, match) {
+				return
+			}
+			if !svc.acquire() {
+				refuseDraining(w, svc)
+				return
+			}
+			defer svc.release()
+			slog.Info("frontend dispatch: retrying after restart", "service", svc.instance(),
+				"path", r.URL.Path, "request_id", r.Header.Get(bridge.RequestIDHeader))
+			svc.proxy.ServeHTTP(w, forwardedRequest(r, match))
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		case <-timer.C:
+			frontendAccessFrom(r.Context()).setError(cause)
+			slog.Warn("frontend dispatch: service did not come back for retry", "service", old.instance(),
+				"path", r.URL.Path, "request_id", r.Header.Get(bridge.RequestIDHeader), "error", cause)
+			w.Header().Set("Retry-After", retryAfterHeader(defaultBreakerOpen))
+			http.Error(w, "service "+strconv.Quote(old.ServiceID)+" is unreachable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+}
+
+// errCircuitOpen is what the access log records for a request refused by
+// an open circuit.
+var errCircuitOpen = errors.New("circuit open")
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"relaygo/bridge"
+)
+
+// Tests for the dispatcher's circuit breakers and retry after restart:
+// the breaker's own transitions, failing fast once a dead socket trips it,
+// routing around a tripped replica, resetting on re-registration, and
+// holding an opted-in GET until the service is back.
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	var b circuitBreaker
+	b.configure(&bridge.DispatchDecl{FailureThreshold: 2, OpenSeconds: 4})
+	now := time.Now()
+	fail := func() (circuitState, bool) { return b.record(http.ErrHandlerTimeout, now) }
+
+	if _, changed := fail(); changed {
+		t.Fatal("one failure opened a threshold-2 circuit")
+	}
+	if st, changed := fail(); st != circuitOpen || !changed {
+		t.Fatalf("second failure: %v, %v; want it opened", st, changed)
+	}
+	if ok, wait := b.allow(now.Add(time.Second)); ok || wait != 3*time.Second {
+		t.Errorf("open circuit: allow = %v, wait %v; want refused for 3s", ok, wait)
+	}
+	if !b.blocked(now.Add(time.Second)) {
+		t.Error("open circuit not blocked")
+	}
+
+	// Past the open period one probe is let through, and only one.
+	now = now.Add(5 * time.Second)
+	if ok, _ := b.allow(now); !ok || b.status() != circuitHalfOpen {
+		t.Fatalf("after the open period: allow = %v, state %v; want a half-open probe", ok, b.status())
+	}
+	if ok, _ := b.allow(now); ok {
+		t.Error("a second request got through while the probe is out")
+	}
+	// The probe fails: open again, for twice as long.
+	if st, changed := fail(); st != circuitOpen || !changed {
+		t.Fatalf("failed probe: %v, %v", st, changed)
+	}
+	if _, wait := b.allow(now.Add(time.Second)); wait != 7*time.Second {
+		t.Errorf("reopened for %v more, want 7s (8s doubled period)", wait)
+	}
+
+	now = now.Add(9 * time.Second)
+	if ok, _ := b.allow(now); !ok {
+		t.Fatal("no probe after the doubled period")
+	}
+	if st, changed := b.record(nil, now); st != circuitClosed || !changed {
+		t.Fatalf("successful probe: %v, %v; want closed", st, changed)
+	}
+	if ok, _ := b.allow(now); !ok || b.status().String() != "" {
+		t.Error("closed circuit refused a request or reports a state")
+	}
+
+	fail()
+	fail()
+	b.configure(nil)
+	if b.status() != circuitClosed || b.thresholdLocked() != defaultBreakerThreshold {
+		t.Error("configure didn't reset the breaker to closed with the defaults")
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	for wait, want := range map[time.Duration]string{0: "1", 10 * time.Millisecond: "1", 1500 * time.Millisecond: "2", 5 * time.Second: "5"} {
+		if got := retryAfterHeader(wait); got != want {
+			t.Errorf("retryAfterHeader(%v) = %q, want %q", wait, got, want)
+		}
+	}
+}
+
+// deadSocket is a socket path nothing listens on.
+func deadSocket(t *testing.T) string {
+	return filepath.Join(mkShortTempDir(t, "dead-"), "gone.sock")
+}
+
+func TestFrontendDispatcher_CircuitOpensOnDeadSocket(t *testing.T) {
+	bus := NewEventBus()
+	registry := NewEnhancedServiceRegistry(nil)
+	registry.Events = bus
+	sub := bus.Subscribe("", func(ev *RelayEvent) bool { return ev.Type == EventServiceCircuit })
+	defer sub.Cancel()
+	m := newManifest("/api/dead/")
+	m.Dispatch = &bridge.DispatchDecl{FailureThreshold: 2, OpenSeconds: 30}
+	assertNoErr(t, registry.RegisterManifest("svc-dead", deadSocket(t), "", m), "register")
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	for i := range 2 {
+		resp, err := http.Get(srv.URL + "/api/dead/x")
+		assertNoErr(t, err, "GET")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadGateway {
+			t.Errorf("request %d = %d, want 502 while the circuit is closed", i, resp.StatusCode)
+		}
+	}
+	resp, err := http.Get(srv.URL + "/api/dead/x")
+	assertNoErr(t, err, "GET")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("after tripping = %d, want 503", resp.StatusCode)
+	}
+	if ra, _ := strconv.Atoi(resp.Header.Get("Retry-After")); ra < 29 || ra > 30 {
+		t.Errorf("Retry-After = %q, want about 30", resp.Header.Get("Retry-After"))
+	}
+	if c := registry.Get("svc-dead").Circuit(); c != "open" {
+		t.Errorf("Circuit() = %q, want open", c)
+	}
+	ev := nextEvent(t, sub)
+	var data serviceEventData
+	_ = json.Unmarshal(ev.Data, &data)
+	if data.Instance != "svc-dead" || data.Circuit != "open" {
+		t.Errorf("circuit event = %s", ev.Data)
+	}
+
+	// The service comes back and registers again: the circuit starts closed.
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-dead", Manifest: m})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), m), "re-register")
+	resp, err = http.Get(srv.URL + "/api/dead/x")
+	assertNoErr(t, err, "GET")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || registry.Get("svc-dead").Circuit() != "" {
+		t.Errorf("after re-registration = %d, circuit %q; want 200 and closed", resp.StatusCode, registry.Get("svc-dead").Circuit())
+	}
+}
+
+// A service's own error responses mean it is reachable.
+func TestFrontendDispatcher_ServiceErrorsDontTrip(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	fake := NewFakeService(t, FakeServiceOptions{
+		ServiceID: "svc-500",
+		Manifest:  newManifest("/api/err/"),
+		Handler:   func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusInternalServerError) },
+	})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "register")
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+	for range defaultBreakerThreshold + 2 {
+		resp, err := http.Get(srv.URL + "/api/err/x")
+		assertNoErr(t, err, "GET")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want the service's 500", resp.StatusCode)
+		}
+	}
+	if c := registry.Get("svc-500").Circuit(); c != "" {
+		t.Errorf("circuit %q after 500s, want closed", c)
+	}
+}
+
+// A service refusing a WebSocket upgrade answered it, so the refusal
+// doesn't count against its circuit either.
+func TestFrontendDispatcher_RefusedUpgradeDoesntTrip(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	fake := NewFakeService(t, FakeServiceOptions{
+		ServiceID: "svc-ws403",
+		Manifest:  newManifest("/api/ws403/"),
+		Handler:   func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusForbidden) },
+	})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "register")
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	dialer := websocket.Dialer{HandshakeTimeout: 2 * time.Second}
+	for range defaultBreakerThreshold + 1 {
+		conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws403/x", nil)
+		assertNoErr(t, err, "dial")
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseInternalServerErr) {
+			t.Fatalf("read = %v, want the upstream-refused close", err)
+		}
+		conn.Close()
+	}
+	if c := registry.Get("svc-ws403").Circuit(); c != "" {
+		t.Errorf("circuit %q after refused upgrades, want closed", c)
+	}
+	resp, err := http.Get(srv.URL + "/api/ws403/x")
+	assertNoErr(t, err, "GET")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET after refused upgrades = %d, want the service's 403", resp.StatusCode)
+	}
+}
+
+func TestFrontendDispatcher_RoutesAroundTrippedReplica(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	m := newManifest("/api/rep/")
+	m.Dispatch = &bridge.DispatchDecl{FailureThreshold: 1, OpenSeconds: 30}
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-rep", Manifest: m})
+	assertNoErr(t, registry.RegisterReplica("svc-rep", 0, deadSocket(t), "", m), "register dead replica")
+	assertNoErr(t, registry.RegisterReplica("svc-rep", 1, fake.Socket(), fake.Token(), m), "register live replica")
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	failures := 0
+	for range 10 {
+		resp, err := http.Get(srv.URL + "/api/rep/x")
+		assertNoErr(t, err, "GET")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			failures++
+		}
+	}
+	if failures != 1 {
+		t.Errorf("%d of 10 requests failed, want only the one that tripped replica 0", failures)
+	}
+	if c := registry.Get("svc-rep").Circuit(); c != "open" {
+		t.Errorf("replica 0 circuit = %q, want open", c)
+	}
+}
+
+func TestFrontendDispatcher_RetriesGetAfterRestart(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	m := newManifest("/api/rs/")
+	m.Dispatch = &bridge.DispatchDecl{RetryOnRestart: true}
+	assertNoErr(t, registry.RegisterManifest("svc-rs", deadSocket(t), "", m), "register")
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	// Not retried: a POST, which the service might have acted on.
+	resp, err := http.Post(srv.URL+"/api/rs/x", "text/plain", nil)
+	assertNoErr(t, err, "POST")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("POST = %d, want 502 at once", resp.StatusCode)
+	}
+
+	// The GET is held until the service registers again.
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-rs", Manifest: m})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		registry.Forget("svc-rs")
+		_ = registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), m)
+	}()
+	resp, err = http.Get(srv.URL + "/api/rs/x")
+	assertNoErr(t, err, "GET")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || fake.LastRequest() == nil {
+		t.Errorf("retried GET = %d, want 200 from the restarted service", resp.StatusCode)
+	}
+}
+
+func TestFrontendDispatcher_RetryGivesUp(t *testing.T) {
+	old := dispatchRetryWait
+	dispatchRetryWait = 100 * time.Millisecond
+	t.Cleanup(func() { dispatchRetryWait = old })
+
+	registry := NewEnhancedServiceRegistry(nil)
+	m := newManifest("/api/gone/")
+	m.Dispatch = &bridge.DispatchDecl{RetryOnRestart: true}
+	assertNoErr(t, registry.RegisterManifest("svc-gone", deadSocket(t), "", m), "register")
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/api/gone/x")
+	assertNoErr(t, err, "GET")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("GET = %d (Retry-After %q), want 503 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if waited := time.Since(start); waited < dispatchRetryWait {
+		t.Errorf("gave up after %v, want it to wait %v for a restart", waited, dispatchRetryWait)
+	}
+}
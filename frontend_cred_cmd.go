@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// `relay frontend-cred` — create, list and revoke scoped frontend
+// credentials (frontend_credentials.go). Follows enrol_cmd.go: a verb with
+// subcommands over the same SettingsStore, orchestration shared with the
+// Settings UI.
+func runFrontendCredCommand(args []string) {
+	store := NewSettingsStore()
+	runSubcommands("frontend-cred", []cliSubcommand{
+		{"create", func(a []string) { frontendCredCreate(store, a) }},
+		{"list", func(_ []string) { frontendCredList(store) }},
+		{"revoke", func(a []string) { frontendCredRevoke(store, a) }},
+	}, args)
+}
+
+func frontendCredCreate(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("frontend-cred create", flag.ExitOnError)
+	name := fs.String("name", "", "credential name (required, unique)")
+	var routes, methods, projects stringSlice
+	fs.Var(&routes, "route", "route prefix it may reach, e.g. /api/sessions (repeatable, at least one; / for all)")
+	fs.Var(&methods, "method", "HTTP method it may use (repeatable; default any)")
+	fs.Var(&projects, "project", "project id it may see and create sessions in (repeatable)")
+	var limit FrontendLimit
+	fs.Float64Var(&limit.Rate, "rate", 0, "requests per second it may send (0 = the frontend limits block's rate)")
+	fs.IntVar(&limit.Burst, "burst", 0, "requests it may send at once on top of --rate (0 = one second's worth)")
+	fs.Int64Var(&limit.MaxBodyBytes, "max-body", 0, "largest request body in bytes (0 = the frontend limits block's cap)")
+	fs.Parse(args)
+
+	if *name == "" {
+		exitError("--name is required")
+	}
+	cred, token, err := createFrontendCredential(store, frontendCredentialRequest{
+		Name:       *name,
+		Routes:     []string(routes),
+		Methods:    []string(methods),
+		ProjectIDs: []string(projects),
+		Limit:      &limit,
+	})
+	if err != nil {
+		exitError("%v", err)
+	}
+
+	fmt.Printf("created frontend credential %q\n", cred.Name)
+	fmt.Printf("  routes:   %s\n", strings.Join(cred.Routes, ","))
+	fmt.Printf("  methods:  %s\n", formatCredMethods(cred.Methods))
+	fmt.Printf("  projects: %s\n", formatGrants(cred.ProjectIDs))
+	fmt.Printf("  limit:    %s\n", formatCredLimit(cred.Limit))
+	fmt.Printf("  token:    %s\n", token)
+	fmt.Println("  the token is not stored and won't be shown again; send it as \"Authorization: Bearer <token>\"")
+}
+
+func frontendCredList(store SettingsStore) {
+	s := store.Get()
+	if len(s.FrontendCredentials) == 0 {
+		fmt.Println("no frontend credentials")
+		return
+	}
+	w := newTabWriter()
+	fmt.Fprintln(w, "NAME\tROUTES\tMETHODS\tPROJECTS\tLIMIT\tCREATED")
+	for _, c := range s.FrontendCredentials {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Name, strings.Join(c.Routes, ","), formatCredMethods(c.Methods),
+			formatGrants(c.ProjectIDs), formatCredLimit(c.Limit), c.CreatedAt)
+	}
+	w.Flush()
+}
+
+func frontendCredRevoke(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("frontend-cred revoke", flag.ExitOnError)
+	name := fs.String("name", "", "credential to revoke")
+	fs.Parse(args)
+
+	if *name == "" {
+		exitError("--name is required")
+	}
+	removed, err := revokeFrontendCredential(store, *name)
+	if err != nil {
+		exitError("%v", err)
+	}
+	fmt.Printf("revoked frontend credential %q\n", removed.Name)
+}
+
+// formatCredMethods renders a credential's methods, "any" for none.
+func formatCredMethods(methods []string) string {
+	if len(methods) == 0 {
+		return "any"
+	}
+	return strings.Join(methods, ",")
+}
+
+// formatCredLimit renders a credential's own limit, "default" for none:
+// "5/s burst 10, body 1.0 MB".
+func formatCredLimit(l *FrontendLimit) string {
+	if l == nil {
+		return "default"
+	}
+	var parts []string
+	if l.Rate > 0 {
+		parts = append(parts, fmt.Sprintf("%s/s burst %s", strconv.FormatFloat(l.Rate, 'f', -1, 64),
+			strconv.FormatFloat(l.burst(), 'f', -1, 64)))
+	}
+	if l.MaxBodyBytes > 0 {
+		parts = append(parts, "body "+formatBytes(uint64(l.MaxBodyBytes)))
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, ", ")
+}
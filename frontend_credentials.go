@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scoped frontend credentials.
+//
+// The frontend channel's token (RELAY_FRONTEND_TOKEN) is the front door's
+// master key: whoever holds it can reach every project route and every
+// dispatched service. That is right for Eve, the frontend relay was built
+// around, and wrong for everything else that wants a slice of the API — a
+// chat bridge that only ever posts to one project's sessions should not be
+// able to list every project or drive every service.
+//
+// A FrontendCredential is a named bearer limited to route prefixes, HTTP
+// methods and projects. settings.json keeps only the SHA-256 of its token;
+// the token itself is shown once, at creation, like a rotated project
+// token. Revoking one deletes the record, which takes effect on the next
+// request — every credential check reads settings fresh — and within
+// frontendCredentialRecheck for a WebSocket session it already opened.
+//
+// Project scope is enforced where relay knows the project: the project
+// routes (the list is filtered, the rest refused for projects outside the
+// scope, and creating one refused outright, since a new project can't be
+// in anyone's scope yet) and session creation, whose projectId the model
+// guard already reads. Everything else a dispatched service serves is
+// scoped by route and method alone; relay doesn't know which project a
+// session ID belongs to.
+
+// frontendCredentialTokenPrefix marks a scoped credential's token, so one
+// pasted into the wrong place is recognisable.
+const frontendCredentialTokenPrefix = "relay_fe_"
+
+// frontendCredentialRecheck is how often a WebSocket session opened with a
+// scoped credential checks that the credential still exists. A var so tests
+// can shorten it.
+var frontendCredentialRecheck = 5 * time.Second
+
+// frontendCredentialMethods are the methods a credential may be limited to.
+var frontendCredentialMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// AllowsMethod reports whether the credential may use method. No methods
+// means any.
+func (c *FrontendCredential) AllowsMethod(method string) bool {
+	return len(c.Methods) == 0 || slices.Contains(c.Methods, method)
+}
+
+// AllowsPath reports whether p falls under one of the credential's route
+// prefixes. A prefix matches whole path segments: "/api/sessions" covers
+// "/api/sessions/abc" but not "/api/sessionsX".
+func (c *FrontendCredential) AllowsPath(p string) bool {
+	p = path.Clean("/" + p)
+	for _, prefix := range c.Routes {
+		if prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantsProject reports whether the credential may act on projectID.
+func (c *FrontendCredential) GrantsProject(projectID string) bool {
+	return projectID != "" && slices.Contains(c.ProjectIDs, projectID)
+}
+
+// ---------------------------------------------------------------------------
+// CRUD — plain mutators that do not save, called within store.With, like the
+// Project and Enrolment ones.
+// ---------------------------------------------------------------------------
+
+// FindFrontendCredential returns the credential with the given name, or nil.
+func (s *Settings) FindFrontendCredential(name string) *FrontendCredential {
+	for i := range s.FrontendCredentials {
+		if s.FrontendCredentials[i].Name == name {
+			return &s.FrontendCredentials[i]
+		}
+	}
+	return nil
+}
+
+// FindFrontendCredentialByHash resolves a presented bearer's hash to a
+// credential, or nil.
+func (s *Settings) FindFrontendCredentialByHash(hash string) *FrontendCredential {
+	if hash == "" {
+		return nil
+	}
+	for i := range s.FrontendCredentials {
+		if s.FrontendCredentials[i].TokenHash == hash {
+			return &s.FrontendCredentials[i]
+		}
+	}
+	return nil
+}
+
+// RemoveFrontendCredential deletes the named credential and returns it.
+// Returns false if there is none. Does not save; use within store.With.
+func (s *Settings) RemoveFrontendCredential(name string) (FrontendCredential, bool) {
+	for i := range s.FrontendCredentials {
+		if s.FrontendCredentials[i].Name == name {
+			removed := s.FrontendCredentials[i]
+			s.FrontendCredentials = slices.Delete(s.FrontendCredentials, i, i+1)
+			return removed, true
+		}
+	}
+	return FrontendCredential{}, false
+}
+
+// ValidateFrontendCredential checks a candidate credential against the
+// current settings and normalizes its routes and methods in place. Call
+// inside the store.With that adds it, so two creates can't both claim a
+// name.
+func (s *Settings) ValidateFrontendCredential(c *FrontendCredential) error {
+	if !isSafeID(c.Name) {
+		return fmt.Errorf("credential name %q is invalid: use only letters, digits, '.', '_', '-'", c.Name)
+	}
+	if s.FindFrontendCredential(c.Name) != nil {
+		return fmt.Errorf("credential %q already exists: revoke it first, or choose another name", c.Name)
+	}
+	// At least one route, so a credential never reaches everything by
+	// omission; "/" says so on purpose.
+	if len(c.Routes) == 0 {
+		return fmt.Errorf("credential %q needs at least one route prefix (use / for every route)", c.Name)
+	}
+	routes := make([]string, 0, len(c.Routes))
+	for _, r := range c.Routes {
+		if !strings.HasPrefix(r, "/") {
+			return fmt.Errorf("route prefix %q must start with /", r)
+		}
+		if cleaned := path.Clean(r); !slices.Contains(routes, cleaned) {
+			routes = append(routes, cleaned)
+		}
+	}
+	c.Routes = routes
+	methods := make([]string, 0, len(c.Methods))
+	for _, m := range c.Methods {
+		m = strings.ToUpper(m)
+		if !slices.Contains(frontendCredentialMethods, m) {
+			return fmt.Errorf("method %q is not one of %s", m, strings.Join(frontendCredentialMethods, ", "))
+		}
+		if !slices.Contains(methods, m) {
+			methods = append(methods, m)
+		}
+	}
+	c.Methods = methods
+	if c.Limit != nil {
+		if err := c.Limit.validate(); err != nil {
+			return fmt.Errorf("credential %q limit: %w", c.Name, err)
+		}
+		if *c.Limit == (FrontendLimit{}) {
+			c.Limit = nil
+		}
+	}
+	// An unknown project is refused rather than kept: a later project that
+	// reused the id would inherit the grant.
+	for _, id := range c.ProjectIDs {
+		if proj, _ := s.findProjectByID(id); proj == nil {
+			return fmt.Errorf("credential %q cannot grant unknown project %q", c.Name, id)
+		}
+	}
+	return nil
+}
+
+// frontendCredentialRequest is the transport-agnostic body for creating a
+// credential; the CLI and the Settings UI both fill it.
+type frontendCredentialRequest struct {
+	Name       string   `json:"name"`
+	Routes     []string `json:"routes"`
+	Methods    []string `json:"methods"`
+	ProjectIDs []string `json:"project_ids"`
+	// Limit is the credential's own rate and body limit; nil for the
+	// frontend block's.
+	Limit *FrontendLimit `json:"limit,omitempty"`
+}
+
+// createFrontendCredential mints a token, persists the credential with
+// its hash, and returns the credential and the token — the only time the
+// token exists outside the caller that receives it.
+func createFrontendCredential(store SettingsStore, req frontendCredentialRequest) (FrontendCredential, string, error) {
+	raw, err := generateRandomHex(32)
+	if err != nil {
+		return FrontendCredential{}, "", fmt.Errorf("generate credential token: %w", err)
+	}
+	token := frontendCredentialTokenPrefix + raw
+	cred := FrontendCredential{
+		Name:       strings.TrimSpace(req.Name),
+		TokenHash:  hashToken(token),
+		Routes:     req.Routes,
+		Methods:    req.Methods,
+		ProjectIDs: req.ProjectIDs,
+		Limit:      req.Limit,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	var validateErr error
+	if err := store.With(func(s *Settings) {
+		if validateErr = s.ValidateFrontendCredential(&cred); validateErr == nil {
+			s.FrontendCredentials = append(s.FrontendCredentials, cred)
+		}
+	}); err != nil {
+		return FrontendCredential{}, "", fmt.Errorf("save settings: %w", err)
+	}
+	if validateErr != nil {
+		return FrontendCredential{}, "", validateErr
+	}
+	return cred, token, nil
+}
+
+// revokeFrontendCredential deletes the named credential.
+func revokeFrontendCredential(store SettingsStore, name string) (FrontendCredential, error) {
+	var removed FrontendCredential
+	var ok bool
+	if err := store.With(func(s *Settings) {
+		removed, ok = s.RemoveFrontendCredential(name)
+	}); err != nil {
+		return FrontendCredential{}, fmt.Errorf("save settings: %w", err)
+	}
+	if !ok {
+		return FrontendCredential{}, fmt.Errorf("no frontend credential named %q", name)
+	}
+	return removed, nil
+}
+
+// ---------------------------------------------------------------------------
+// Enforcement
+// ---------------------------------------------------------------------------
+
+type frontendCredentialKey struct{}
+
+// withFrontendCredential records the scoped credential a request
+// authenticated with.
+func withFrontendCredential(ctx context.Context, c *FrontendCredential) context.Context {
+	return context.WithValue(ctx, frontendCredentialKey{}, c)
+}
+
+// frontendCredentialFrom returns the scoped credential a request
+// authenticated with, or nil for the frontend channel's own token.
+func frontendCredentialFrom(ctx context.Context) *FrontendCredential {
+	c, _ := ctx.Value(frontendCredentialKey{}).(*FrontendCredential)
+	return c
+}
+
+// frontendCredentialLookup resolves a presented bearer to a scoped
+// credential from settings read fresh, so a credential created or revoked
+// by the CLI counts on the very next request (see freshSettings).
+func frontendCredentialLookup(store SettingsStore) func(token string) *FrontendCredential {
+	return func(token string) *FrontendCredential {
+		if !strings.HasPrefix(token, frontendCredentialTokenPrefix) {
+			return nil
+		}
+		return freshSettings(store).FindFrontendCredentialByHash(hashToken(token))
+	}
+}
+
+// frontendCredentialLive reports whether c still exists unchanged.
+func frontendCredentialLive(store SettingsStore, c *FrontendCredential) bool {
+	cur := freshSettings(store).FindFrontendCredentialByHash(c.TokenHash)
+	return cur != nil && cur.Name == c.Name
+}
+
+// frontendScope refuses a scoped credential's requests outside its routes,
+// methods and projects. Requests made with the frontend channel's token
+// pass untouched.
+func frontendScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cred := frontendCredentialFrom(r.Context())
+		if cred == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !cred.AllowsMethod(r.Method) || !cred.AllowsPath(r.URL.Path) {
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error": fmt.Sprintf("credential %q may not %s %s", cred.Name, r.Method, r.URL.Path),
+			})
+			return
+		}
+		if id, ok := projectRouteID(r.URL.Path); ok {
+			switch {
+			case id == "" && r.Method == http.MethodPost:
+				writeJSON(w, http.StatusForbidden, map[string]string{
+					"error": fmt.Sprintf("credential %q is scoped to projects and can't create one", cred.Name),
+				})
+				return
+			case id != "" && !cred.GrantsProject(id):
+				// 404, as for a project that doesn't exist, so a scoped
+				// credential can't probe for the IDs it wasn't given.
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": "project not found"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// projectRouteID classifies a path under the project routes: ok for
+// /api/projects itself (id "") and for anything under /api/projects/{id}.
+func projectRouteID(p string) (id string, ok bool) {
+	p = path.Clean("/" + p)
+	if p == "/api/projects" {
+		return "", true
+	}
+	rest, found := strings.CutPrefix(p, "/api/projects/")
+	if !found {
+		return "", false
+	}
+	id, _, _ = strings.Cut(rest, "/")
+	return id, true
+}
+
+// frontendProjectsFor filters a project list to what the request's
+// credential may see.
+func frontendProjectsFor(ctx context.Context, projects []Project) []Project {
+	cred := frontendCredentialFrom(ctx)
+	if cred == nil {
+		return projects
+	}
+	out := make([]Project, 0, len(projects))
+	for _, p := range projects {
+		if cred.GrantsProject(p.ID) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
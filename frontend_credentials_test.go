@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Tests for scoped frontend credentials (frontend_credentials.go): scope
+// matching, validation, enforcement over a live FrontendServer, revocation
+// of open WebSocket sessions, and the CLI and IPC surfaces.
+
+// scopedFrontend starts a FrontendServer over TCP loopback with two
+// projects in its settings, returning the server and both projects.
+func scopedFrontend(t *testing.T, enhanced *EnhancedServiceRegistry) (*FrontendServer, Project, Project) {
+	t.Helper()
+	srv := startTCPFrontend(t, enhanced, &FrontendConfig{TCP: tcpEnabled("127.0.0.1:0", false)})
+	assertNoErr(t, srv.store.With(func(s *Settings) {
+		s.ExternalMcps = []ExternalMcp{{ID: "fsmcp", DisplayName: "fsMCP"}}
+	}), "seed mcps")
+	mine := createTestProject(t, srv.store, "Mine", t.TempDir(), []string{"fsmcp"})
+	other := createTestProject(t, srv.store, "Other", t.TempDir(), []string{"fsmcp"})
+	return srv, mine, other
+}
+
+func mustCreateCred(t *testing.T, store SettingsStore, req frontendCredentialRequest) string {
+	t.Helper()
+	_, token, err := createFrontendCredential(store, req)
+	assertNoErr(t, err, "createFrontendCredential")
+	return token
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestFrontendCredential_AllowsPath(t *testing.T) {
+	c := &FrontendCredential{Routes: []string{"/api/sessions", "/api/projects"}}
+	for _, tc := range []struct {
+		path string
+		want bool
+	}{
+		{"/api/sessions", true},
+		{"/api/sessions/abc/messages", true},
+		{"/api/sessionsX", false},
+		{"/api/sessions/../mcps", false},
+		{"/api/projects/", true},
+		{"/api", false},
+		{"/", false},
+	} {
+		if got := c.AllowsPath(tc.path); got != tc.want {
+			t.Errorf("AllowsPath(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+	if !(&FrontendCredential{Routes: []string{"/"}}).AllowsPath("/anything/at/all") {
+		t.Error(`"/" must cover every route`)
+	}
+	if !(&FrontendCredential{}).AllowsMethod(http.MethodDelete) {
+		t.Error("no methods must mean any method")
+	}
+	if (&FrontendCredential{Methods: []string{"POST"}}).AllowsMethod(http.MethodGet) {
+		t.Error("GET allowed by a POST-only credential")
+	}
+	if (&FrontendCredential{ProjectIDs: []string{"a"}}).GrantsProject("") {
+		t.Error("a projectless request must never be granted")
+	}
+}
+
+func TestValidateFrontendCredential(t *testing.T) {
+	store := newProjectsTestStore(t)
+	proj := createTestProject(t, store, "Alpha", t.TempDir(), []string{"fsmcp"})
+
+	cred, token, err := createFrontendCredential(store, frontendCredentialRequest{
+		Name:       "telegram",
+		Routes:     []string{"/api/sessions/", "/api/sessions", "/api/projects"},
+		Methods:    []string{"post", "POST", "get"},
+		ProjectIDs: []string{proj.ID},
+	})
+	assertNoErr(t, err, "create")
+	if !strings.HasPrefix(token, frontendCredentialTokenPrefix) {
+		t.Errorf("token %q lacks the %s prefix", token, frontendCredentialTokenPrefix)
+	}
+	if strings.Join(cred.Routes, ",") != "/api/sessions,/api/projects" {
+		t.Errorf("routes = %v, want cleaned and deduplicated", cred.Routes)
+	}
+	if strings.Join(cred.Methods, ",") != "POST,GET" {
+		t.Errorf("methods = %v, want uppercased and deduplicated", cred.Methods)
+	}
+	stored := store.Get().FindFrontendCredential("telegram")
+	if stored == nil || stored.TokenHash != hashToken(token) {
+		t.Fatalf("stored credential = %+v, want the token's hash", stored)
+	}
+	if raw, _ := json.Marshal(store.Get()); strings.Contains(string(raw), token) {
+		t.Error("settings carry the plaintext token")
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  frontendCredentialRequest
+		want string
+	}{
+		{"duplicate", frontendCredentialRequest{Name: "telegram", Routes: []string{"/"}}, "already exists"},
+		{"unsafe name", frontendCredentialRequest{Name: "a/b", Routes: []string{"/"}}, "invalid"},
+		{"no routes", frontendCredentialRequest{Name: "x"}, "at least one route"},
+		{"relative route", frontendCredentialRequest{Name: "x", Routes: []string{"api"}}, "must start with /"},
+		{"bad method", frontendCredentialRequest{Name: "x", Routes: []string{"/"}, Methods: []string{"BREW"}}, "BREW"},
+		{"unknown project", frontendCredentialRequest{Name: "x", Routes: []string{"/"}, ProjectIDs: []string{"nope"}}, "unknown project"},
+		{"negative rate", frontendCredentialRequest{Name: "x", Routes: []string{"/"}, Limit: &FrontendLimit{Rate: -2}}, "rate -2"},
+	} {
+		if _, _, err := createFrontendCredential(store, tc.req); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want one containing %q", tc.name, err, tc.want)
+		}
+	}
+	if n := len(store.Get().FrontendCredentials); n != 1 {
+		t.Errorf("%d credentials stored, want only the valid one", n)
+	}
+
+	if _, err := revokeFrontendCredential(store, "telegram"); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := revokeFrontendCredential(store, "telegram"); err == nil {
+		t.Error("revoking twice must fail")
+	}
+}
+
+func TestFrontendServer_ScopedCredential(t *testing.T) {
+	srv, mine, other := scopedFrontend(t, NewEnhancedServiceRegistry(nil))
+	token := mustCreateCred(t, srv.store, frontendCredentialRequest{
+		Name:       "reader",
+		Routes:     []string{"/api/projects"},
+		Methods:    []string{"GET", "POST"},
+		ProjectIDs: []string{mine.ID},
+	})
+	base := "http://" + srv.TCPAddr()
+	c := &http.Client{Timeout: 2 * time.Second}
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/api/projects/" + mine.ID, http.StatusOK},
+		{"GET", "/api/projects/" + other.ID, http.StatusNotFound},
+		{"DELETE", "/api/projects/" + mine.ID, http.StatusForbidden},
+		{"POST", "/api/projects", http.StatusForbidden},
+		{"GET", "/api/mcps", http.StatusForbidden},
+	} {
+		if resp := getStatus(t, c, tc.method, base+tc.path, bearer(token)); resp.StatusCode != tc.want {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.path, resp.StatusCode, tc.want)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", base+"/api/projects", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.Do(req)
+	assertNoErr(t, err, "list projects")
+	var listed []struct {
+		ID string `json:"id"`
+	}
+	assertNoErr(t, json.NewDecoder(resp.Body).Decode(&listed), "decode")
+	resp.Body.Close()
+	if len(listed) != 1 || listed[0].ID != mine.ID {
+		t.Errorf("listed %v, want only %s", listed, mine.ID)
+	}
+
+	// The frontend channel's own token is untouched by scoping.
+	if resp := getStatus(t, c, "GET", base+"/api/projects/"+other.ID, bearer("good-token")); resp.StatusCode != http.StatusOK {
+		t.Errorf("master token GET other project = %d, want 200", resp.StatusCode)
+	}
+
+	_, err = revokeFrontendCredential(srv.store, "reader")
+	assertNoErr(t, err, "revoke")
+	if resp := getStatus(t, c, "GET", base+"/api/projects/"+mine.ID, bearer(token)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("revoked credential = %d, want 401", resp.StatusCode)
+	}
+	if resp := getStatus(t, c, "GET", base+"/api/projects", bearer(frontendCredentialTokenPrefix+"forged")); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unknown credential = %d, want 401", resp.StatusCode)
+	}
+}
+
+// The relayTelegram case: a credential that may only create sessions in
+// one project.
+func TestSessionModelGuard_ScopedCredential(t *testing.T) {
+	store := newProjectsTestStore(t)
+	mine := createTestProject(t, store, "Mine", t.TempDir(), []string{"fsmcp"})
+	other := createTestProject(t, store, "Other", t.TempDir(), []string{"fsmcp"})
+	cred := &FrontendCredential{Name: "telegram", Routes: []string{"/api/sessions"}, ProjectIDs: []string{mine.ID}}
+
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`{"projectId":"` + mine.ID + `"}`, http.StatusOK},
+		{`{"projectId":"` + other.ID + `"}`, http.StatusForbidden},
+		{`{}`, http.StatusForbidden},
+		{`not json`, http.StatusBadRequest},
+	} {
+		spy := &nextSpy{}
+		rec := httptest.NewRecorder()
+		req := postSessions(tc.body)
+		newSessionModelGuard(store, spy)(rec, req.WithContext(withFrontendCredential(req.Context(), cred)))
+		if rec.Code != tc.want {
+			t.Errorf("body %s: status = %d, want %d", tc.body, rec.Code, tc.want)
+		}
+		if spy.called != (tc.want == http.StatusOK) {
+			t.Errorf("body %s: forwarded = %v", tc.body, spy.called)
+		}
+	}
+}
+
+func TestFrontendServer_ScopedCredential_WSClosedOnRevoke(t *testing.T) {
+	old := frontendCredentialRecheck
+	frontendCredentialRecheck = 50 * time.Millisecond
+	t.Cleanup(func() { frontendCredentialRecheck = old })
+
+	enhanced := NewEnhancedServiceRegistry(nil)
+	fake := echoWSService(t)
+	assertNoErr(t, enhanced.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "RegisterManifest")
+	srv, _, _ := scopedFrontend(t, enhanced)
+	token := mustCreateCred(t, srv.store, frontendCredentialRequest{Name: "ws", Routes: []string{"/ws"}})
+
+	conn, _, err := (&websocket.Dialer{HandshakeTimeout: 2 * time.Second}).Dial("ws://"+srv.TCPAddr()+"/ws", bearer(token))
+	assertNoErr(t, err, "dial")
+	defer conn.Close()
+	assertNoErr(t, conn.WriteMessage(websocket.TextMessage, []byte("hi")), "write")
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "echo:hi" {
+		t.Fatalf("echo = %q, %v", msg, err)
+	}
+
+	_, err = revokeFrontendCredential(srv.store, "ws")
+	assertNoErr(t, err, "revoke")
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("read after revoke = %v, want a policy-violation close", err)
+	}
+}
+
+func TestFrontendCredCLI_CreateListRevoke(t *testing.T) {
+	store := newProjectsTestStore(t)
+	proj := createTestProject(t, store, "Alpha", t.TempDir(), []string{"fsmcp"})
+
+	frontendCredCreate(store, []string{"--name", "telegram", "--route", "/api/sessions", "--method", "post", "--project", proj.ID, "--rate", "0.5"})
+	cred := store.Get().FindFrontendCredential("telegram")
+	if cred == nil {
+		t.Fatal("credential not stored")
+	}
+	if strings.Join(cred.Methods, ",") != "POST" || strings.Join(cred.ProjectIDs, ",") != proj.ID {
+		t.Errorf("stored %+v", cred)
+	}
+	if cred.Limit == nil || cred.Limit.Rate != 0.5 || formatCredLimit(cred.Limit) != "0.5/s burst 1" {
+		t.Errorf("stored limit %+v (%s), want 0.5/s", cred.Limit, formatCredLimit(cred.Limit))
+	}
+	frontendCredList(store)
+	frontendCredRevoke(store, []string{"--name", "telegram"})
+	if store.Get().FindFrontendCredential("telegram") != nil {
+		t.Error("credential survived revoke")
+	}
+}
+
+func TestIPCFrontendCredentials(t *testing.T) {
+	ctx, store, ui := newEnrolmentIPC(t, false)
+
+	ipcCreateFrontendCredential(ctx, json.RawMessage(`{"name":" ","routes":["/"]}`))
+	if _, ok := findEvent(ui, "onFrontendCredentialError"); !ok {
+		t.Fatal("blank name emitted no error")
+	}
+
+	ipcCreateFrontendCredential(ctx, json.RawMessage(`{"name":"bot","routes":["/api/sessions"],"methods":["POST"]}`))
+	args, ok := findEvent(ui, "onFrontendCredentialCreated")
+	if !ok || len(args) != 2 {
+		t.Fatalf("create: args = %v", args)
+	}
+	token, _ := args[1].(string)
+	stored := store.Get().FindFrontendCredential("bot")
+	if stored == nil || stored.TokenHash != hashToken(token) {
+		t.Fatalf("stored %+v does not match the emitted token", stored)
+	}
+
+	ui.events = nil
+	ipcCreateFrontendCredential(ctx, json.RawMessage(`{"name":"bot","routes":["/"]}`))
+	if args, ok := findEvent(ui, "onFrontendCredentialError"); !ok || !strings.Contains(args[0].(string), "already exists") {
+		t.Errorf("duplicate: args = %v", args)
+	}
+
+	ipcRevokeFrontendCredential(ctx, json.RawMessage(`{"name":"bot"}`))
+	if args, ok := findEvent(ui, "onFrontendCredentialRevoked"); !ok || args[0] != "bot" {
+		t.Errorf("revoke: args = %v", args)
+	}
+	if len(store.Get().FrontendCredentials) != 0 {
+		t.Error("credential survived revoke")
+	}
+}
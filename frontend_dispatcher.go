@@ -1,21 +1,33 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"relaygo/bridge"
 )
 
 // FrontendDispatcher routes inbound front-door HTTP and WebSocket requests
 // to the appropriate enhanced service, using longest-prefix-match against
-// every registered manifest's routes. The single handler covers both
-// protocols — WS upgrades are detected from the request headers.
+// every registered manifest's routes — refined by their method filters and
+// priorities, and followed by their path rewrites (frontend_routes.go).
+// The single handler covers both protocols — WS upgrades are detected from
+// the request headers.
+//
+// A service run as several replicas is balanced: each new HTTP request goes
+// to the ready replica with the fewest requests in flight, and a WebSocket
+// session stays on the replica it was opened to for as long as it lasts
+// (see EnhancedServiceRegistry.Lookup).
 //
 // Per request, it reverse-proxies to the resolved service's internal Unix
 // socket, stripping any inbound Authorization header and injecting the
@@ -24,6 +36,17 @@ import (
 //   - internal token authenticates relay → enhanced service
 type FrontendDispatcher struct {
 	registry *EnhancedServiceRegistry
+	// allowedOrigins returns the origins settings allow besides the
+	// listener's own, for the WebSocket Origin check; nil allows none.
+	// Set by NewFrontendServer.
+	allowedOrigins func() []string
+	// credentialLive reports whether the scoped credential a WebSocket
+	// session was opened with still exists; proxyWS closes the session when
+	// it doesn't. nil skips the check. Set by NewFrontendServer.
+	credentialLive func(*FrontendCredential) bool
+	// store supplies the projects manifest guards check requests against
+	// (frontend_guards.go); nil skips the guards. Set by NewFrontendServer.
+	store SettingsStore
 }
 
 // NewFrontendDispatcher returns a dispatcher reading from the given registry.
@@ -33,28 +56,134 @@ func NewFrontendDispatcher(registry *EnhancedServiceRegistry) *FrontendDispatche
 	return &FrontendDispatcher{registry: registry}
 }
 
-// ServeHTTP routes one request. 404 if no manifest claims the path.
+// ServeHTTP routes one request. 404 if no manifest claims the path, 405 if
+// the routes claiming it all refuse the method, 503 if the service claiming
+// it has a health check and isn't ready, every replica of it is draining
+// for a restart, or its circuit is open (frontend_breaker.go), and 403 if
+// one of its guards refuses the request (frontend_guards.go).
 func (d *FrontendDispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	svc := d.registry.LookupByPath(r.URL.Path)
+	svc, match := d.route(w, r)
 	if svc == nil {
-		slog.Debug("frontend dispatch: no service for path", "path", r.URL.Path)
-		http.Error(w, "no service registered for this path", http.StatusNotFound)
 		return
 	}
-	if websocket.IsWebSocketUpgrade(r) {
-		d.proxyWS(svc, w, r)
+	fwd := forwardedRequest(r, match)
+	if websocket.IsWebSocketUpgrade(fwd) {
+		defer svc.release()
+		d.proxyWS(svc, w, fwd)
+		return
+	}
+	if !retriesOnRestart(svc, fwd) {
+		defer svc.release()
+		// proxy is built once at register time; it owns a connection-pooling
+		// transport, so the per-request cost here is one map lookup + ServeHTTP.
+		svc.proxy.ServeHTTP(w, fwd)
 		return
 	}
-	// proxy is built once at register time; it owns a connection-pooling
-	// transport, so the per-request cost here is one map lookup + ServeHTTP.
-	svc.proxy.ServeHTTP(w, r)
+	attempt := &dispatchAttempt{}
+	svc.proxy.ServeHTTP(w, fwd.WithContext(context.WithValue(fwd.Context(), dispatchAttemptKey{}, attempt)))
+	svc.release()
+	if attempt.err != nil && r.Context().Err() == nil {
+		d.retryAfterRestart(w, r, svc, attempt.err)
+	}
 }
 
-// dispatcherWSUpgrader is permissive: the frontend listener is a Unix
-// socket, so only same-host processes can reach it, and bearer auth has
-// already validated by the time the dispatcher runs.
-var dispatcherWSUpgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+// forwardedRequest returns the request to send on: r itself, or for a
+// route that rewrites the path, a copy with the rewritten path and the
+// stripped prefix in X-Forwarded-Prefix so the service can still build
+// links the client can follow. A client's own X-Forwarded-Prefix is never
+// passed on — the service would take it for relay's.
+func forwardedRequest(r *http.Request, match routeMatch) *http.Request {
+	r.Header.Del("X-Forwarded-Prefix")
+	if match.route == nil || !match.route.rewrites() {
+		return r
+	}
+	out := r.Clone(r.Context())
+	if stripped := match.route.rewrite(out.URL, match.params); stripped != "" {
+		out.Header.Set("X-Forwarded-Prefix", stripped)
+	}
+	return out
+}
+
+// route resolves the replica to send r to and counts the request against
+// it; the caller releases it when the response (or WebSocket session)
+// ends. On nil it has already written the error response.
+func (d *FrontendDispatcher) route(w http.ResponseWriter, r *http.Request) (*EnhancedService, routeMatch) {
+	for attempt := 0; ; attempt++ {
+		svc, match := d.registry.Lookup(r.Method, r.URL.Path)
+		if svc == nil {
+			if len(match.allow) > 0 {
+				w.Header().Set("Allow", strings.Join(match.allow, ", "))
+				http.Error(w, "method not allowed for this path", http.StatusMethodNotAllowed)
+				return nil, match
+			}
+			slog.Debug("frontend dispatch: no service for path", "path", r.URL.Path)
+			http.Error(w, "no service registered for this path", http.StatusNotFound)
+			return nil, match
+		}
+		if !d.ready(w, r, svc, match) {
+			return nil, match
+		}
+		if svc.acquire() {
+			return svc, match
+		}
+		// The replica began draining: after the lookup, in which case
+		// another may take the request, or before it, if all are.
+		if attempt > 0 {
+			refuseDraining(w, svc)
+			return nil, match
+		}
+	}
+}
+
+// ready checks that svc can take r now — it is ready, its guards let r
+// through, and so does its circuit — writing the refusal when it can't.
+func (d *FrontendDispatcher) ready(w http.ResponseWriter, r *http.Request, svc *EnhancedService, match routeMatch) bool {
+	// Recorded before the checks below, so a 503 names the service.
+	a := frontendAccessFrom(r.Context())
+	a.setService(svc.instance())
+	a.setRoute(match.route.Path)
+	// A service with a health check is only routed to once ready; the
+	// rest get a 503 the frontend can retry instead of a hung or failed
+	// proxy.
+	if state := d.registry.Health(svc.instance()); state != "" && state != HealthReady {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, fmt.Sprintf("service %q is %s", svc.ServiceID, state), http.StatusServiceUnavailable)
+		return false
+	}
+	// The guards go before the circuit: a request they refuse never reaches
+	// the service, so it must not take a half-open circuit's one probe.
+	if !d.enforceGuards(w, r, svc) {
+		return false
+	}
+	// An open circuit fails the request now rather than on a dial to a
+	// socket that isn't there.
+	if ok, wait := svc.load.breaker.allow(time.Now()); !ok {
+		a.setError(errCircuitOpen)
+		w.Header().Set("Retry-After", retryAfterHeader(wait))
+		http.Error(w, fmt.Sprintf("service %q is unreachable", svc.ServiceID), http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// refuseDraining answers 503 for a replica draining for a restart.
+func refuseDraining(w http.ResponseWriter, svc *EnhancedService) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, fmt.Sprintf("service %q is restarting", svc.ServiceID), http.StatusServiceUnavailable)
+}
+
+// checkOrigin decides whether to accept a WebSocket upgrade. Bearer auth
+// has already passed, but the frontend may be reachable over TCP
+// (frontend_tcp.go), and a browser page that gets hold of the token must
+// not be able to open a session from an origin nobody allowed — CORS
+// doesn't cover WebSocket. Clients that send no Origin (everything that
+// isn't a browser) are accepted, as is the listener's own origin.
+func (d *FrontendDispatcher) checkOrigin(r *http.Request) bool {
+	var allowed []string
+	if d.allowedOrigins != nil {
+		allowed = d.allowedOrigins()
+	}
+	return originAllowed(r, allowed)
 }
 
 // WebSocket keepalive parameters. The proxy pings each peer every wsPingPeriod
@@ -94,7 +223,20 @@ func (d *FrontendDispatcher) proxyWS(svc *EnhancedService, w http.ResponseWriter
 		HandshakeTimeout: 10 * time.Second,
 	}
 
-	clientConn, err := dispatcherWSUpgrader.Upgrade(w, r, nil)
+	if !d.checkOrigin(r) {
+		slog.Warn("frontend dispatch: WS upgrade refused for origin",
+			"service", svc.ServiceID, "origin", r.Header.Get("Origin"))
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	// The upgrader writes its response on the hijacked connection, so the
+	// correlation ID the front door set on w has to be handed over again.
+	var respHeader http.Header
+	if id := w.Header().Get(bridge.RequestIDHeader); id != "" {
+		respHeader = http.Header{bridge.RequestIDHeader: {id}}
+	}
+	clientConn, err := upgrader.Upgrade(w, r, respHeader)
 	if err != nil {
 		slog.Warn("frontend dispatch: WS upgrade failed",
 			"service", svc.ServiceID, "error", err)
@@ -102,14 +244,30 @@ func (d *FrontendDispatcher) proxyWS(svc *EnhancedService, w http.ResponseWriter
 	}
 	defer clientConn.Close()
 
+	access := frontendAccessFrom(r.Context())
 	upstreamHeader := http.Header{}
 	if svc.InternalToken != "" {
 		upstreamHeader.Set("Authorization", "Bearer "+svc.InternalToken)
 	}
-	upstreamConn, _, err := dialer.Dial("ws://internal.relay.localsocket"+r.URL.RequestURI(), upstreamHeader)
+	// The HTTP proxy forwards the correlation ID and a rewrite's prefix
+	// with the rest of the request's headers; this dial starts from none.
+	for _, h := range []string{bridge.RequestIDHeader, "X-Forwarded-Prefix"} {
+		if v := r.Header.Get(h); v != "" {
+			upstreamHeader.Set(h, v)
+		}
+	}
+	upstreamConn, resp, err := dialer.Dial("ws://internal.relay.localsocket"+r.URL.RequestURI(), upstreamHeader)
+	// A service that answered — even to refuse the upgrade — was reached;
+	// only a dial that got no response counts against its circuit.
+	if resp != nil {
+		d.registry.recordDispatch(r.Context(), svc, nil)
+	} else {
+		d.registry.recordDispatch(r.Context(), svc, err)
+	}
 	if err != nil {
+		access.setError(err)
 		slog.Warn("frontend dispatch: WS upstream dial failed",
-			"service", svc.ServiceID, "error", err)
+			"service", svc.ServiceID, "request_id", r.Header.Get(bridge.RequestIDHeader), "error", err)
 		_ = clientConn.WriteControl(
 			websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "upstream unreachable"),
@@ -133,23 +291,53 @@ func (d *FrontendDispatcher) proxyWS(svc *EnhancedService, w http.ResponseWriter
 	// closes. Not part of the WaitGroup — the data pumps own teardown.
 	go pingDispatchedWS(clientConn, done, closeBoth)
 	go pingDispatchedWS(upstreamConn, done, closeBoth)
+	if cred := frontendCredentialFrom(r.Context()); cred != nil && d.credentialLive != nil {
+		go d.watchCredential(cred, clientConn, done, closeBoth)
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(2)
-	go forwardDispatchedWS(clientConn, upstreamConn, &wg, closeBoth)
-	go forwardDispatchedWS(upstreamConn, clientConn, &wg, closeBoth)
+	go forwardDispatchedWS(clientConn, upstreamConn, &wg, closeBoth, func(n int64) { access.countWS(true, n) })
+	go forwardDispatchedWS(upstreamConn, clientConn, &wg, closeBoth, func(n int64) { access.countWS(false, n) })
 	wg.Wait()
 	closeBoth() // ensure done is closed so the pingers exit even on a clean close
 }
 
+// watchCredential closes a WebSocket session once the scoped credential
+// it was opened with is revoked. Without it, revocation would only stop
+// new requests: a session is one request that can last for hours.
+func (d *FrontendDispatcher) watchCredential(cred *FrontendCredential, conn *websocket.Conn, done <-chan struct{}, closeBoth func()) {
+	ticker := time.NewTicker(frontendCredentialRecheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if d.credentialLive(cred) {
+			continue
+		}
+		slog.Info("frontend dispatch: closing WS session of revoked credential", "credential", cred.Name)
+		_ = conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "credential revoked"),
+			time.Now().Add(time.Second),
+		)
+		closeBoth()
+		return
+	}
+}
+
 // forwardDispatchedWS pumps messages from src to dst until either side
-// closes. The 32KB buffer is reused across messages to avoid per-message
-// allocation on streaming token traffic.
+// closes, reporting each message's size to count. The 32KB buffer is reused
+// across messages to avoid per-message allocation on streaming token
+// traffic.
 //
 // An idle read deadline on src, extended by every pong and every data frame,
 // turns a half-open peer (no close frame, no traffic) into a read error so the
 // pump can tear down instead of blocking forever in NextReader.
-func forwardDispatchedWS(src, dst *websocket.Conn, wg *sync.WaitGroup, closeBoth func()) {
+func forwardDispatchedWS(src, dst *websocket.Conn, wg *sync.WaitGroup, closeBoth func(), count func(int64)) {
 	defer wg.Done()
 	defer closeBoth()
 
@@ -170,7 +358,9 @@ func forwardDispatchedWS(src, dst *websocket.Conn, wg *sync.WaitGroup, closeBoth
 		if err != nil {
 			return
 		}
-		if _, err := io.CopyBuffer(writer, reader, buf); err != nil {
+		n, err := io.CopyBuffer(writer, reader, buf)
+		count(n)
+		if err != nil {
 			_ = writer.Close()
 			return
 		}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"relaygo/bridge"
+)
+
+// Manifest-declared project guards.
+//
+// A project's allowlists — its models, MCPs and templates — live only in
+// relay's settings, so a rule like "this project may only start sessions
+// on these models" can only be enforced in front of the proxy. The session
+// model guard (frontend_model_guard.go) does that for relayLLM's one
+// endpoint. A guard declared in a manifest (bridge.GuardDecl) does the same
+// for any service's route: the dispatcher finds the project and the
+// guarded value in the request, and refuses it with 403 unless the
+// project's allowlist has the value. The service opts in by declaring the
+// guard; relay needs no code for the route.
+//
+// The posture matches the session guard's. A request relay can't
+// attribute — no project, no value, a project it doesn't know — goes on to
+// the service, which remains the authority on what it means. A scoped
+// frontend credential is the exception: it must name one of its projects,
+// and a body that can't be read is refused rather than forwarded. A value
+// of the wrong shape is refused for everyone, since passing it on would
+// let the service interpret what relay couldn't check.
+
+// maxGuardBodyBytes bounds how much of a guarded request's body is
+// buffered for inspection — the session guard's cap, for the same reasons.
+const maxGuardBodyBytes = maxSessionBodyBytes
+
+// frontendGuard is one compiled guard.
+type frontendGuard struct {
+	bridge.GuardDecl
+	route frontendRoute
+}
+
+// compileGuards compiles the manifest's guards for the dispatcher.
+// Validation defaults a guard's methods to POST; a manifest that skipped
+// it gets the same default here rather than a guard on every method.
+func compileGuards(m bridge.Manifest) []frontendGuard {
+	out := make([]frontendGuard, 0, len(m.Guards))
+	for _, g := range m.Guards {
+		methods := g.Methods
+		if len(methods) == 0 {
+			methods = []string{http.MethodPost}
+		}
+		out = append(out, frontendGuard{
+			GuardDecl: g,
+			route:     compileRoute(bridge.RouteDecl{Path: g.Path, Methods: methods}),
+		})
+	}
+	return out
+}
+
+// errGuardRefused is what the access log records for a request a guard
+// refused.
+var errGuardRefused = errors.New("refused by project guard")
+
+// enforceGuards applies svc's guards that match r, writing the refusal
+// when one refuses. Returns whether r may go on. The body, when a guard
+// read it, is put back for the proxy.
+func (d *FrontendDispatcher) enforceGuards(w http.ResponseWriter, r *http.Request, svc *EnhancedService) bool {
+	if d.store == nil || len(svc.guards) == 0 {
+		return true
+	}
+	var body any
+	var bodyRead, bodyOK bool
+	for i := range svc.guards {
+		g := &svc.guards[i]
+		if !g.route.allowsMethod(r.Method) {
+			continue
+		}
+		params, ok := g.route.matchPath(r.URL.Path)
+		if !ok {
+			continue
+		}
+		if !bodyRead && (!isGuardParam(g.Project) || !isGuardParam(g.Value)) {
+			bodyRead = true
+			var status int
+			if body, bodyOK, status = readGuardBody(r); status != 0 {
+				writeJSON(w, status, map[string]string{"error": http.StatusText(status)})
+				return false
+			}
+		}
+		if status, err := d.checkGuard(r, svc, g, params, body, bodyOK); err != nil {
+			frontendAccessFrom(r.Context()).setError(errGuardRefused)
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+// isGuardParam reports whether a guard locates its field in the path.
+func isGuardParam(loc string) bool {
+	_, ok := bridge.RouteParam(loc)
+	return ok
+}
+
+// readGuardBody buffers r's body and restores it, returning it decoded —
+// ok false when it isn't JSON — or the status to refuse it with: 413 over
+// maxGuardBodyBytes, which a guard must not truncate and forward, 400 for
+// one that can't be read.
+func readGuardBody(r *http.Request) (body any, ok bool, status int) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, false, 0
+	}
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxGuardBodyBytes+1))
+	if bodyTooLarge(err) || len(raw) > maxGuardBodyBytes {
+		slog.Warn("frontend: guarded request body exceeds inspection cap; rejecting",
+			"path", r.URL.Path, "limit", maxGuardBodyBytes)
+		return nil, false, http.StatusRequestEntityTooLarge
+	}
+	if err != nil {
+		return nil, false, http.StatusBadRequest
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+	r.ContentLength = int64(len(raw))
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return nil, false, 0
+	}
+	return body, true, 0
+}
+
+// checkGuard decides one guard for one request, returning the status and
+// error to refuse it with, or a nil error to let it through.
+func (d *FrontendDispatcher) checkGuard(r *http.Request, svc *EnhancedService, g *frontendGuard, params map[string]string, body any, bodyOK bool) (int, error) {
+	cred := frontendCredentialFrom(r.Context())
+	needsBody := !isGuardParam(g.Project) || !isGuardParam(g.Value)
+	if needsBody && !bodyOK {
+		// Not a body relay understands: the service produces the error,
+		// unless a scoped credential sent it — its project can't be
+		// checked, so it fails closed.
+		if cred != nil {
+			return http.StatusBadRequest, errors.New("request body is not JSON relay can check")
+		}
+		return 0, nil
+	}
+
+	projectID, _ := guardField(g.Project, params, body).(string)
+	if cred != nil && !cred.GrantsProject(projectID) {
+		slog.Warn("frontend: guard blocked request outside credential's projects",
+			"service", svc.instance(), "guard", g.Path, "credential", cred.Name, "project", projectID)
+		return http.StatusForbidden, fmt.Errorf("credential %q may not act in project %q", cred.Name, projectID)
+	}
+
+	values, ok := guardValues(guardField(g.Value, params, body))
+	if !ok {
+		return http.StatusBadRequest, fmt.Errorf("%s must be a string or a list of strings", g.Value)
+	}
+	if projectID == "" || len(values) == 0 {
+		return 0, nil // no project scope, or the service's default
+	}
+	proj, _ := freshSettings(d.store).findProjectByID(projectID)
+	if proj == nil {
+		return 0, nil // unknown project: the service produces the authoritative error
+	}
+	for _, v := range values {
+		if !projectAllows(proj, g.Allowlist, v) {
+			slog.Warn("frontend: guard blocked disallowed value",
+				"service", svc.instance(), "guard", g.Path, "project", projectID, "allowlist", g.Allowlist, "value", v)
+			return http.StatusForbidden, fmt.Errorf("%s %q is not allowed for this project", guardAllowlistNoun(g.Allowlist), v)
+		}
+	}
+	return 0, nil
+}
+
+// guardField finds a guard's field: a path parameter, or the value at a
+// dotted path in the decoded body, nil where there is none.
+func guardField(loc string, params map[string]string, body any) any {
+	if name, ok := bridge.RouteParam(loc); ok {
+		if v, ok := params[name]; ok {
+			return v
+		}
+		return nil
+	}
+	cur := body
+	for _, key := range strings.Split(loc, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = obj[key]
+	}
+	return cur
+}
+
+// guardValues normalizes a guarded field to the strings to check: none for
+// an absent field or an empty string, ok false for anything but a string
+// or a list of strings.
+func guardValues(v any) ([]string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, true
+	case string:
+		if v == "" {
+			return nil, true
+		}
+		return []string{v}, true
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, s)
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+// projectAllows reports whether the project's allowlist named by list
+// admits value. An empty model list is unrestricted (allowed_models' long
+// standing meaning); an MCP list admits only what it names, or anything
+// when it is the wildcard; the template lists admit their IDs.
+func projectAllows(proj *Project, list, value string) bool {
+	switch list {
+	case bridge.GuardAllowModels:
+		return len(proj.AllowedModels) == 0 || isWildcard(proj.AllowedModels) || slices.Contains(proj.AllowedModels, value)
+	case bridge.GuardAllowMcps:
+		return isWildcard(proj.AllowedMcpIDs) || slices.Contains(proj.AllowedMcpIDs, value)
+	case bridge.GuardAllowChatTemplates:
+		return slices.ContainsFunc(proj.ChatTemplates, func(t ChatTemplate) bool { return t.ID == value })
+	case bridge.GuardAllowShellTemplates:
+		return slices.ContainsFunc(proj.ShellTemplates, func(t ShellTemplate) bool { return t.ID == value })
+	}
+	return false
+}
+
+// guardAllowlistNoun names what an allowlist holds, for refusals.
+func guardAllowlistNoun(list string) string {
+	switch list {
+	case bridge.GuardAllowModels:
+		return "model"
+	case bridge.GuardAllowMcps:
+		return "MCP"
+	case bridge.GuardAllowChatTemplates:
+		return "chat template"
+	case bridge.GuardAllowShellTemplates:
+		return "shell template"
+	}
+	return list
+}
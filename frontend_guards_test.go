@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"relaygo/bridge"
+)
+
+// Tests for manifest-declared project guards (frontend_guards.go): each
+// allowlist, values in the body and in the path, the fail-open cases, the
+// wrong-shaped value, a scoped credential's projects and the body cap.
+
+// guardedService registers a FakeService declaring guards on /api/g/ and
+// returns a dispatcher over it that checks projects in store, and the
+// service.
+func guardedService(t *testing.T, store SettingsStore, guards ...bridge.GuardDecl) (*httptest.Server, *FakeService) {
+	t.Helper()
+	registry := NewEnhancedServiceRegistry(nil)
+	m := newManifest("/api/g/")
+	m.Guards = guards
+	assertNoErr(t, m.Validate(), "validate manifest")
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-g", Manifest: m})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), m), "register")
+	d := NewFrontendDispatcher(registry)
+	d.store = store
+	// A request with an X-Test-Credential header runs as that credential.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := r.Header.Get("X-Test-Credential"); name != "" {
+			if cred := store.Get().FindFrontendCredential(name); cred != nil {
+				r = r.WithContext(withFrontendCredential(r.Context(), cred))
+			}
+		}
+		d.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, fake
+}
+
+// guardedProject creates a project with an explicit model allowlist, one
+// MCP and one template of each kind.
+func guardedProject(t *testing.T, store SettingsStore) Project {
+	t.Helper()
+	proj := createTestProject(t, store, "Guarded", t.TempDir(), []string{"fsmcp"})
+	assertNoErr(t, store.With(func(s *Settings) {
+		p, _ := s.findProjectByID(proj.ID)
+		p.AllowedModels = []string{"small"}
+		p.ChatTemplates = []ChatTemplate{{ID: "tpl-chat", Name: "Chat"}}
+		p.ShellTemplates = []ShellTemplate{{ID: "tpl-shell", Name: "Shell"}}
+	}), "configure project")
+	return proj
+}
+
+func sendGuarded(t *testing.T, srv *httptest.Server, method, path, body, credential string) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if body == "" {
+		req.Body = http.NoBody
+	}
+	if credential != "" {
+		req.Header.Set("X-Test-Credential", credential)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assertNoErr(t, err, method+" "+path)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestFrontendGuards_BodyFields(t *testing.T) {
+	store := newProjectsTestStore(t)
+	proj := guardedProject(t, store)
+	srv, fake := guardedService(t, store,
+		bridge.GuardDecl{Path: "/api/g/chat", Project: "projectId", Value: "options.model", Allowlist: bridge.GuardAllowModels},
+		bridge.GuardDecl{Path: "/api/g/chat", Project: "projectId", Value: "mcps", Allowlist: bridge.GuardAllowMcps},
+		bridge.GuardDecl{Path: "/api/g/chat", Project: "projectId", Value: "template", Allowlist: bridge.GuardAllowChatTemplates},
+	)
+	body := func(fields string) string { return `{"projectId":"` + proj.ID + `"` + fields + `}` }
+
+	for _, tc := range []struct {
+		name, method, body string
+		want               int
+	}{
+		{"allowed model", "POST", body(`,"options":{"model":"small"}`), http.StatusOK},
+		{"disallowed model", "POST", body(`,"options":{"model":"huge"}`), http.StatusForbidden},
+		{"no model", "POST", body(``), http.StatusOK},
+		{"allowed MCPs", "POST", body(`,"mcps":["fsmcp"]`), http.StatusOK},
+		{"one MCP not allowed", "POST", body(`,"mcps":["fsmcp","macmcp"]`), http.StatusForbidden},
+		{"allowed template", "POST", body(`,"template":"tpl-chat"`), http.StatusOK},
+		{"unknown template", "POST", body(`,"template":"tpl-other"`), http.StatusForbidden},
+		{"wrong-shaped value", "POST", body(`,"options":{"model":7}`), http.StatusBadRequest},
+		{"no project", "POST", `{"options":{"model":"huge"}}`, http.StatusOK},
+		{"unknown project", "POST", `{"projectId":"nope","options":{"model":"huge"}}`, http.StatusOK},
+		{"not JSON", "POST", `model=huge`, http.StatusOK},
+		{"method not guarded", "PUT", body(`,"options":{"model":"huge"}`), http.StatusOK},
+	} {
+		if got := sendGuarded(t, srv, tc.method, "/api/g/chat", tc.body, ""); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	// What passes reaches the service whole.
+	want := body(`,"options":{"model":"small"},"mcps":["fsmcp"]`)
+	if got := sendGuarded(t, srv, "POST", "/api/g/chat", want, ""); got != http.StatusOK {
+		t.Fatalf("allowed request = %d", got)
+	}
+	if got := string(fake.LastRequest().Body); got != want {
+		t.Errorf("service got body %q, want %q", got, want)
+	}
+}
+
+func TestFrontendGuards_PathParams(t *testing.T) {
+	store := newProjectsTestStore(t)
+	proj := guardedProject(t, store)
+	srv, _ := guardedService(t, store, bridge.GuardDecl{
+		Path: "/api/g/{project}/shell/{template}", Methods: []string{"get"},
+		Project: "{project}", Value: "{template}", Allowlist: bridge.GuardAllowShellTemplates,
+	})
+	if got := sendGuarded(t, srv, "GET", "/api/g/"+proj.ID+"/shell/tpl-shell", "", ""); got != http.StatusOK {
+		t.Errorf("project's own shell template = %d, want 200", got)
+	}
+	if got := sendGuarded(t, srv, "GET", "/api/g/"+proj.ID+"/shell/tpl-chat", "", ""); got != http.StatusForbidden {
+		t.Errorf("another kind's template = %d, want 403", got)
+	}
+}
+
+func TestFrontendGuards_ScopedCredential(t *testing.T) {
+	store := newProjectsTestStore(t)
+	proj := guardedProject(t, store)
+	other := createTestProject(t, store, "Other", t.TempDir(), []string{"fsmcp"})
+	mustCreateCred(t, store, frontendCredentialRequest{Name: "bot", Routes: []string{"/api/g"}, ProjectIDs: []string{proj.ID}})
+	srv, _ := guardedService(t, store,
+		bridge.GuardDecl{Path: "/api/g/chat", Project: "projectId", Value: "model", Allowlist: bridge.GuardAllowModels})
+
+	for _, tc := range []struct {
+		name, body string
+		want       int
+	}{
+		{"own project", `{"projectId":"` + proj.ID + `","model":"small"}`, http.StatusOK},
+		{"own project, disallowed model", `{"projectId":"` + proj.ID + `","model":"huge"}`, http.StatusForbidden},
+		{"another project", `{"projectId":"` + other.ID + `"}`, http.StatusForbidden},
+		{"no project", `{"model":"small"}`, http.StatusForbidden},
+		{"not JSON", `projectId=x`, http.StatusBadRequest},
+	} {
+		if got := sendGuarded(t, srv, "POST", "/api/g/chat", tc.body, "bot"); got != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFrontendGuards_BodyOverCap(t *testing.T) {
+	store := newProjectsTestStore(t)
+	proj := guardedProject(t, store)
+	srv, fake := guardedService(t, store,
+		bridge.GuardDecl{Path: "/api/g/chat", Project: "projectId", Value: "model", Allowlist: bridge.GuardAllowModels})
+	body := `{"projectId":"` + proj.ID + `","pad":"` + strings.Repeat("A", maxGuardBodyBytes) + `","model":"huge"}`
+	if got := sendGuarded(t, srv, "POST", "/api/g/chat", body, ""); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized guarded body = %d, want 413", got)
+	}
+	if fake.LastRequest() != nil {
+		t.Error("an oversized guarded body reached the service")
+	}
+}
+
+// A GET retried after a restart goes to the new registration, so it is
+// held to the guards that registration declares, not the ones the request
+// originally passed.
+func TestFrontendGuards_RetryAfterRestart(t *testing.T) {
+	store := newProjectsTestStore(t)
+	proj := guardedProject(t, store)
+	registry := NewEnhancedServiceRegistry(nil)
+	before := newManifest("/api/g/")
+	before.Dispatch = &bridge.DispatchDecl{RetryOnRestart: true}
+	assertNoErr(t, registry.RegisterManifest("svc-g", deadSocket(t), "", before), "register")
+	after := before
+	after.Guards = []bridge.GuardDecl{{
+		Path: "/api/g/{project}/shell/{template}", Methods: []string{"get"},
+		Project: "{project}", Value: "{template}", Allowlist: bridge.GuardAllowShellTemplates,
+	}}
+	assertNoErr(t, after.Validate(), "validate manifest")
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-g", Manifest: after})
+	d := NewFrontendDispatcher(registry)
+	d.store = store
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), after)
+	}()
+	if got := sendGuarded(t, srv, "GET", "/api/g/"+proj.ID+"/shell/tpl-chat", "", ""); got != http.StatusForbidden {
+		t.Errorf("retried GET = %d, want 403 from the new registration's guard", got)
+	}
+	if fake.LastRequest() != nil {
+		t.Error("a request the restarted service guards against reached it")
+	}
+}
+
+// A guard refusing a half-open circuit's first request mustn't use up its
+// probe: the next request that passes the guards probes the replica.
+func TestFrontendGuards_RefusalLeavesCircuitProbe(t *testing.T) {
+	store := newProjectsTestStore(t)
+	proj := guardedProject(t, store)
+	registry := NewEnhancedServiceRegistry(nil)
+	m := newManifest("/api/g/")
+	m.Guards = []bridge.GuardDecl{{Path: "/api/g/chat", Project: "projectId", Value: "model", Allowlist: bridge.GuardAllowModels}}
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-g", Manifest: m})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), m), "register")
+	d := NewFrontendDispatcher(registry)
+	d.store = store
+	srv := httptest.NewServer(d)
+	defer srv.Close()
+
+	// Trip the circuit long enough ago that the next request is the probe.
+	breaker := &registry.Get("svc-g").load.breaker
+	for range defaultBreakerThreshold {
+		breaker.record(http.ErrHandlerTimeout, time.Now().Add(-time.Hour))
+	}
+
+	body := func(model string) string { return `{"projectId":"` + proj.ID + `","model":"` + model + `"}` }
+	if got := sendGuarded(t, srv, "POST", "/api/g/chat", body("huge"), ""); got != http.StatusForbidden {
+		t.Fatalf("guarded request = %d, want 403", got)
+	}
+	if got := sendGuarded(t, srv, "POST", "/api/g/chat", body("small"), ""); got != http.StatusOK {
+		t.Errorf("next request = %d, want 200 as the circuit's probe", got)
+	}
+	if c := registry.Get("svc-g").Circuit(); c != "" {
+		t.Errorf("circuit %q after a successful probe, want closed", c)
+	}
+}
+
+// Without a store (a dispatcher outside the frontend server) guards are
+// skipped rather than failing every request.
+func TestFrontendGuards_NoStore(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	m := newManifest("/api/g/")
+	m.Guards = []bridge.GuardDecl{{Path: "/api/g/chat", Project: "projectId", Value: "model", Allowlist: bridge.GuardAllowModels}}
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-g", Manifest: m})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), m), "register")
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(context.Background(), "POST", "/api/g/chat", strings.NewReader(`{"projectId":"p","model":"x"}`))
+	NewFrontendDispatcher(registry).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status %d, want 200", rec.Code)
+	}
+}
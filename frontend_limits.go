@@ -0,0 +1,461 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate and body-size limits on the frontend API.
+//
+// Whoever holds a frontend bearer — the channel's token or a scoped
+// credential — could otherwise send as many requests, and as large, as it
+// likes, and the dispatcher would hand every one to the service behind the
+// route. A browser tab stuck in a retry loop or a misbehaving bot can bury
+// relayLLM that way. The limiter sits just inside scope enforcement and
+// holds each bearer to a token bucket: a steady rate with a burst on top,
+// and 429 with Retry-After past it. Route rules add a bucket of their own
+// per bearer for the prefixes that deserve a tighter rate (session
+// creation, say), and every request body is capped, 413 past the cap.
+//
+// The limits come from the "limits" part of the frontend block, applied on
+// the settings poll like the rest of it, and from a credential's own
+// "limit", which replaces the block's rate for that credential and can
+// only lower its body cap. Counters of what was refused are served at
+// GET /api/limits.
+
+// defaultFrontendMaxBody caps a request body when nothing configures a
+// cap: large enough for any upload Eve makes, small enough that a body
+// nobody meant to send can't exhaust memory on the way through.
+const defaultFrontendMaxBody = 64 << 20
+
+// FrontendLimit is one rate and body limit. Rate is requests per second,
+// 0 for no rate limit; Burst is how many may arrive at once on top of it,
+// defaulting to one second's worth. MaxBodyBytes 0 leaves the cap to the
+// other limits that apply.
+type FrontendLimit struct {
+	Rate         float64 `json:"rate,omitempty"`
+	Burst        int     `json:"burst,omitempty"`
+	MaxBodyBytes int64   `json:"max_body_bytes,omitempty"`
+}
+
+// FrontendLimitsConfig is the "limits" part of the frontend block:
+//
+//	"limits": {
+//	  "rate": 20, "burst": 40, "max_body_bytes": 16777216,
+//	  "routes": [{"prefix": "/api/sessions", "methods": ["POST"], "rate": 1, "burst": 5}]
+//	}
+//
+// The top-level limit holds each bearer to its own bucket. A route rule
+// adds a second bucket per bearer for requests under its prefix (whole
+// segments, like a credential's routes), limited to its methods when it
+// names some; the longest matching prefix is the rule that applies.
+type FrontendLimitsConfig struct {
+	FrontendLimit
+	Routes []FrontendRouteLimit `json:"routes,omitempty"`
+}
+
+// FrontendRouteLimit is one route rule of the limits block.
+type FrontendRouteLimit struct {
+	Prefix  string   `json:"prefix"`
+	Methods []string `json:"methods,omitempty"`
+	FrontendLimit
+}
+
+// validate checks a limit's numbers.
+func (l FrontendLimit) validate() error {
+	if l.Rate < 0 || math.IsNaN(l.Rate) || math.IsInf(l.Rate, 0) {
+		return fmt.Errorf("rate %v must be a positive number of requests per second (0 for none)", l.Rate)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("burst %d must not be negative", l.Burst)
+	}
+	if l.MaxBodyBytes < 0 {
+		return fmt.Errorf("max_body_bytes %d must not be negative", l.MaxBodyBytes)
+	}
+	return nil
+}
+
+// burst is the bucket's capacity: Burst, or one second's worth of Rate.
+func (l FrontendLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return max(1, math.Ceil(l.Rate))
+}
+
+// limits returns the valid part of the limits block, normalized, and an
+// error naming what was left out. Nil-safe: no block means no rate limits
+// and the default body cap.
+func (c *FrontendConfig) limits() (FrontendLimitsConfig, error) {
+	if c == nil || c.Limits == nil {
+		return FrontendLimitsConfig{}, nil
+	}
+	var out FrontendLimitsConfig
+	var errs []error
+	if err := c.Limits.FrontendLimit.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("frontend.limits: %w", err))
+	} else {
+		out.FrontendLimit = c.Limits.FrontendLimit
+	}
+	for _, rule := range c.Limits.Routes {
+		if err := rule.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("frontend.limits route %q: %w", rule.Prefix, err))
+			continue
+		}
+		rule.Prefix = path.Clean(rule.Prefix)
+		methods := make([]string, 0, len(rule.Methods))
+		for _, m := range rule.Methods {
+			methods = append(methods, strings.ToUpper(m))
+		}
+		rule.Methods = methods
+		out.Routes = append(out.Routes, rule)
+	}
+	return out, errors.Join(errs...)
+}
+
+// validate checks a route rule: a prefix, known methods, sane numbers.
+func (r FrontendRouteLimit) validate() error {
+	if !strings.HasPrefix(r.Prefix, "/") {
+		return errors.New("prefix must start with /")
+	}
+	for _, m := range r.Methods {
+		if !slices.Contains(frontendCredentialMethods, strings.ToUpper(m)) {
+			return fmt.Errorf("method %q is not one of %s", m, strings.Join(frontendCredentialMethods, ", "))
+		}
+	}
+	return r.FrontendLimit.validate()
+}
+
+// match returns the rule applying to a request: the longest prefix that
+// covers p and allows method, or nil.
+func (c FrontendLimitsConfig) match(method, p string) *FrontendRouteLimit {
+	p = path.Clean("/" + p)
+	var best *FrontendRouteLimit
+	for i := range c.Routes {
+		rule := &c.Routes[i]
+		if len(rule.Methods) > 0 && !slices.Contains(rule.Methods, method) {
+			continue
+		}
+		if rule.Prefix != "/" && p != rule.Prefix && !strings.HasPrefix(p, rule.Prefix+"/") {
+			continue
+		}
+		if best == nil || len(rule.Prefix) > len(best.Prefix) {
+			best = rule
+		}
+	}
+	return best
+}
+
+// frontendLimitKey names one bucket: a bearer — a credential's name, ""
+// for the channel's token — alone, or under one route rule's prefix.
+type frontendLimitKey struct {
+	credential, route string
+}
+
+// frontendBucket is one key's token bucket and its counters.
+type frontendBucket struct {
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+	// throttled is set while the bucket is refusing, so the log gets one
+	// line per episode rather than one per request.
+	throttled bool
+
+	limited  uint64 // requests answered 429
+	tooLarge uint64 // bodies answered 413
+}
+
+// take refills the bucket to now and reports whether a token is there,
+// and if not, how long until one is. It doesn't consume: a request passes
+// only when every bucket it is held to has a token.
+func (b *frontendBucket) take(now time.Time) (bool, time.Duration) {
+	if b.rate <= 0 {
+		return true, 0
+	}
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// frontendLimiter holds the buckets. Safe for concurrent use; Reconcile
+// configures it and the front door consults it per request.
+type frontendLimiter struct {
+	mu      sync.Mutex
+	cfg     FrontendLimitsConfig
+	buckets map[frontendLimitKey]*frontendBucket
+}
+
+func newFrontendLimiter() *frontendLimiter {
+	return &frontendLimiter{buckets: map[frontendLimitKey]*frontendBucket{}}
+}
+
+// configure installs the limits block as of this settings poll, and drops
+// the buckets of credentials no longer in settings and of route rules no
+// longer in the block (or left without a rate, which is what gives a rule
+// buckets), so neither lingers in GET /api/limits. A bucket whose rate
+// changed starts again full on its next request.
+func (l *frontendLimiter) configure(cfg FrontendLimitsConfig, credentials []FrontendCredential) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	for key := range l.buckets {
+		if key.credential != "" && !slices.ContainsFunc(credentials, func(c FrontendCredential) bool { return c.Name == key.credential }) {
+			delete(l.buckets, key)
+			continue
+		}
+		if key.route != "" && !slices.ContainsFunc(cfg.Routes, func(r FrontendRouteLimit) bool { return r.Prefix == key.route && r.Rate > 0 }) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// bucketLocked returns key's bucket at limit, creating it full, or
+// refilling it full when the limit changed. Caller holds l.mu.
+func (l *frontendLimiter) bucketLocked(key frontendLimitKey, limit FrontendLimit) *frontendBucket {
+	b := l.buckets[key]
+	if b == nil {
+		b = &frontendBucket{}
+		l.buckets[key] = b
+	}
+	if b.rate != limit.Rate || b.burst != limit.burst() {
+		b.rate, b.burst = limit.Rate, limit.burst()
+		b.tokens, b.last = b.burst, time.Time{}
+	}
+	return b
+}
+
+// bearerLimitLocked is the rate a bearer is held to: its credential's own, when
+// it sets one, otherwise the block's.
+func (l *frontendLimiter) bearerLimitLocked(cred *FrontendCredential) FrontendLimit {
+	if cred != nil && cred.Limit != nil && cred.Limit.Rate > 0 {
+		return *cred.Limit
+	}
+	return l.cfg.FrontendLimit
+}
+
+// admit takes a token for a request from its bearer's bucket and, when a
+// route rule applies, the rule's — from both or neither. Refused, it
+// returns how long until the emptier bucket has a token again and which
+// bucket refused.
+func (l *frontendLimiter) admit(cred *FrontendCredential, method, p string, now time.Time) (bool, time.Duration, frontendLimitKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	name := ""
+	if cred != nil {
+		name = cred.Name
+	}
+	held := []frontendLimitKey{{credential: name}}
+	limits := []FrontendLimit{l.bearerLimitLocked(cred)}
+	if rule := l.cfg.match(method, p); rule != nil && rule.Rate > 0 {
+		held = append(held, frontendLimitKey{credential: name, route: rule.Prefix})
+		limits = append(limits, rule.FrontendLimit)
+	}
+	buckets := make([]*frontendBucket, 0, len(held))
+	for i, key := range held {
+		if limits[i].Rate <= 0 && l.buckets[key] == nil {
+			continue
+		}
+		b := l.bucketLocked(key, limits[i])
+		if ok, wait := b.take(now); !ok {
+			b.limited++
+			if !b.throttled {
+				b.throttled = true
+				slog.Warn("frontend: rate limit reached", "credential", name, "route", key.route,
+					"rate", b.rate, "burst", b.burst)
+			}
+			return false, wait, key
+		}
+		buckets = append(buckets, b)
+	}
+	for _, b := range buckets {
+		if b.rate > 0 {
+			b.tokens--
+		}
+		b.throttled = false
+	}
+	return true, 0, frontendLimitKey{}
+}
+
+// maxBody is the body cap for a request: the smallest of the caps that
+// apply to it — the block's, the route rule's, the credential's — or
+// defaultFrontendMaxBody when none is set. The key is the bucket its
+// refusals are counted on.
+func (l *frontendLimiter) maxBody(cred *FrontendCredential, method, p string) (int64, frontendLimitKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := frontendLimitKey{}
+	if cred != nil {
+		key.credential = cred.Name
+	}
+	var limit int64
+	tighten := func(n int64) {
+		if n > 0 && (limit == 0 || n < limit) {
+			limit = n
+		}
+	}
+	tighten(l.cfg.MaxBodyBytes)
+	if cred != nil && cred.Limit != nil {
+		tighten(cred.Limit.MaxBodyBytes)
+	}
+	if rule := l.cfg.match(method, p); rule != nil {
+		tighten(rule.MaxBodyBytes)
+		if rule.Rate > 0 {
+			key.route = rule.Prefix
+		}
+	}
+	if limit == 0 {
+		limit = defaultFrontendMaxBody
+	}
+	return limit, key
+}
+
+// countTooLarge records a body refused on key.
+func (l *frontendLimiter) countTooLarge(key frontendLimitKey) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.buckets[key]
+	if b == nil {
+		b = &frontendBucket{}
+		l.buckets[key] = b
+	}
+	b.tooLarge++
+}
+
+// frontendLimitStatus is one bucket in GET /api/limits. Credential is ""
+// for the frontend channel's token; Route is "" for the bearer's own
+// bucket. Tokens is what is left to spend right now.
+type frontendLimitStatus struct {
+	Credential string  `json:"credential"`
+	Route      string  `json:"route,omitempty"`
+	Rate       float64 `json:"rate,omitempty"`
+	Burst      float64 `json:"burst,omitempty"`
+	Tokens     float64 `json:"tokens,omitempty"`
+	Limited    uint64  `json:"limited"`
+	TooLarge   uint64  `json:"too_large"`
+}
+
+// snapshot returns every bucket, sorted by credential and route, with
+// its tokens refilled to now.
+func (l *frontendLimiter) snapshot(now time.Time) []frontendLimitStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]frontendLimitStatus, 0, len(l.buckets))
+	for key, b := range l.buckets {
+		st := frontendLimitStatus{Credential: key.credential, Route: key.route,
+			Rate: b.rate, Burst: b.burst, Limited: b.limited, TooLarge: b.tooLarge}
+		if b.rate > 0 {
+			st.Tokens = b.tokens
+			if !b.last.IsZero() {
+				st.Tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+			}
+			st.Tokens = math.Floor(st.Tokens*100) / 100
+		}
+		out = append(out, st)
+	}
+	slices.SortFunc(out, func(a, b frontendLimitStatus) int {
+		if c := strings.Compare(a.Credential, b.Credential); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Route, b.Route)
+	})
+	return out
+}
+
+// errRateLimited and errBodyTooLarge are what the access log records for
+// requests the limiter refused.
+var (
+	errRateLimited  = errors.New("rate limited")
+	errBodyTooLarge = errors.New("request body too large")
+)
+
+// frontendLimits enforces the limiter in front of next: 429 with
+// Retry-After for a request over its rate, 413 for a body declared over
+// its cap, and a capped reader for one that doesn't declare its length —
+// the proxy's error handler answers 413 when it hits the cap mid-stream
+// (newServiceProxy). nil l enforces nothing.
+func frontendLimits(l *frontendLimiter, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cred := frontendCredentialFrom(r.Context())
+		ok, wait, key := l.admit(cred, r.Method, r.URL.Path, time.Now())
+		if !ok {
+			frontendAccessFrom(r.Context()).setError(errRateLimited)
+			w.Header().Set("Retry-After", retryAfterHeader(wait))
+			msg := "rate limit exceeded"
+			if key.route != "" {
+				msg += " for " + key.route
+			}
+			writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": msg})
+			return
+		}
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limit, key := l.maxBody(cred, r.Method, r.URL.Path)
+		if r.ContentLength > limit {
+			l.countTooLarge(key)
+			frontendAccessFrom(r.Context()).setError(errBodyTooLarge)
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{
+				"error": fmt.Sprintf("request body exceeds %d bytes", limit),
+			})
+			return
+		}
+		r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit), onLimit: func() { l.countTooLarge(key) }}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitedBody counts the first time a capped body runs over its cap.
+type limitedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	onLimit func()
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if bodyTooLarge(err) {
+		b.once.Do(b.onLimit)
+	}
+	return n, err
+}
+
+// bodyTooLarge reports whether err is a capped body running over its cap.
+func bodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// RegisterFrontendLimitRoutes wires GET /api/limits: every bucket the
+// limiter holds, with what it has refused. A scoped credential sees only
+// its own. nil limiter makes it return 503.
+func RegisterFrontendLimitRoutes(mux *http.ServeMux, limiter *frontendLimiter) {
+	mux.HandleFunc("GET /api/limits", func(w http.ResponseWriter, r *http.Request) {
+		if limiter == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "limits unavailable"})
+			return
+		}
+		list := limiter.snapshot(time.Now())
+		if cred := frontendCredentialFrom(r.Context()); cred != nil {
+			list = slices.DeleteFunc(list, func(st frontendLimitStatus) bool { return st.Credential != cred.Name })
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"limits": list})
+	})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests for the frontend's rate and body limits (frontend_limits.go): the
+// limits block's validation, token buckets per bearer and per route rule,
+// a credential's own limit, body caps declared and streamed, and
+// GET /api/limits over a live FrontendServer.
+
+func TestFrontendConfig_Limits(t *testing.T) {
+	var nilCfg *FrontendConfig
+	if got, err := nilCfg.limits(); err != nil || got.Rate != 0 || len(got.Routes) != 0 {
+		t.Errorf("nil config: %+v, %v; want no limits", got, err)
+	}
+
+	cfg := &FrontendConfig{Limits: &FrontendLimitsConfig{
+		FrontendLimit: FrontendLimit{Rate: 10, MaxBodyBytes: 1024},
+		Routes: []FrontendRouteLimit{
+			{Prefix: "/api/sessions/", Methods: []string{"post"}, FrontendLimit: FrontendLimit{Rate: 1}},
+			{Prefix: "api/nope", FrontendLimit: FrontendLimit{Rate: 1}},
+			{Prefix: "/api/x", Methods: []string{"BREW"}},
+			{Prefix: "/api/y", FrontendLimit: FrontendLimit{Burst: -1}},
+		},
+	}}
+	got, err := cfg.limits()
+	if err == nil || !strings.Contains(err.Error(), "api/nope") || !strings.Contains(err.Error(), "BREW") || !strings.Contains(err.Error(), "burst -1") {
+		t.Errorf("err = %v, want the three bad rules named", err)
+	}
+	if got.Rate != 10 || len(got.Routes) != 1 || got.Routes[0].Prefix != "/api/sessions" || got.Routes[0].Methods[0] != "POST" {
+		t.Errorf("limits = %+v, want the valid rule normalized", got)
+	}
+	if cfg.Limits.Routes[0].Methods[0] != "post" {
+		t.Error("limits() normalized settings in place")
+	}
+
+	bad := &FrontendConfig{Limits: &FrontendLimitsConfig{FrontendLimit: FrontendLimit{Rate: -1}}}
+	if got, err := bad.limits(); err == nil || got.Rate != 0 {
+		t.Errorf("negative rate: %+v, %v; want refused", got, err)
+	}
+}
+
+func TestFrontendLimiter_Buckets(t *testing.T) {
+	l := newFrontendLimiter()
+	l.configure(FrontendLimitsConfig{
+		FrontendLimit: FrontendLimit{Rate: 2},
+		Routes: []FrontendRouteLimit{
+			{Prefix: "/api/sessions", Methods: []string{"POST"}, FrontendLimit: FrontendLimit{Rate: 0.5}},
+		},
+	}, nil)
+	now := time.Now()
+
+	// The bearer's bucket: a burst of two, then refused for half a second.
+	for i := range 2 {
+		if ok, _, _ := l.admit(nil, "GET", "/api/projects", now); !ok {
+			t.Fatalf("request %d refused within the burst", i)
+		}
+	}
+	ok, wait, key := l.admit(nil, "GET", "/api/projects", now)
+	if ok || key.route != "" || wait != 500*time.Millisecond {
+		t.Fatalf("third request: ok %v, wait %v, key %+v; want the bearer's bucket to refuse for 500ms", ok, wait, key)
+	}
+	now = now.Add(time.Second)
+
+	// The route rule's bucket: one at a time, every two seconds. A request
+	// it refuses doesn't spend the bearer's token.
+	if ok, _, _ := l.admit(nil, "POST", "/api/sessions/", now); !ok {
+		t.Fatal("first session create refused")
+	}
+	ok, wait, key = l.admit(nil, "POST", "/api/sessions", now)
+	if ok || key.route != "/api/sessions" || wait != 2*time.Second {
+		t.Fatalf("second session create: ok %v, wait %v, key %+v; want the rule to refuse for 2s", ok, wait, key)
+	}
+	if ok, _, _ := l.admit(nil, "GET", "/api/sessions", now); !ok {
+		t.Error("a GET was held to the POST-only rule")
+	}
+
+	// A credential has a bucket of its own, at its own rate when it sets one.
+	cred := &FrontendCredential{Name: "bot", Limit: &FrontendLimit{Rate: 1, Burst: 1}}
+	if ok, _, _ := l.admit(cred, "GET", "/api/projects", now); !ok {
+		t.Fatal("credential's first request refused")
+	}
+	if ok, _, key := l.admit(cred, "GET", "/api/projects", now); ok || key.credential != "bot" {
+		t.Errorf("credential's second request: ok %v, key %+v; want its own rate of 1 to refuse it", ok, key)
+	}
+
+	stats := l.snapshot(now)
+	byKey := map[frontendLimitKey]frontendLimitStatus{}
+	for _, st := range stats {
+		byKey[frontendLimitKey{st.Credential, st.Route}] = st
+	}
+	if byKey[frontendLimitKey{}].Limited != 1 || byKey[frontendLimitKey{"", "/api/sessions"}].Limited != 1 || byKey[frontendLimitKey{"bot", ""}].Limited != 1 {
+		t.Errorf("snapshot = %+v, want one refusal on each bucket", stats)
+	}
+
+	// Revoking the credential drops its bucket on the next configure.
+	l.configure(l.cfg, nil)
+	for _, st := range l.snapshot(now) {
+		if st.Credential == "bot" {
+			t.Errorf("revoked credential's bucket kept: %+v", st)
+		}
+	}
+
+	// So does removing the route rule, and the bearer's own bucket stays.
+	l.configure(FrontendLimitsConfig{FrontendLimit: FrontendLimit{Rate: 2}}, nil)
+	stats = l.snapshot(now)
+	for _, st := range stats {
+		if st.Route != "" {
+			t.Errorf("removed rule's bucket kept: %+v", st)
+		}
+	}
+	if len(stats) != 1 || stats[0].Limited != 1 {
+		t.Errorf("snapshot after removing the rule = %+v, want just the bearer's bucket", stats)
+	}
+	if ok, _, _ := l.admit(nil, "POST", "/api/sessions", now.Add(time.Second)); !ok {
+		t.Error("session create still held to the removed rule")
+	}
+}
+
+func TestFrontendLimiter_MaxBody(t *testing.T) {
+	l := newFrontendLimiter()
+	if got, _ := l.maxBody(nil, "POST", "/api/x"); got != defaultFrontendMaxBody {
+		t.Errorf("unconfigured cap = %d, want %d", got, defaultFrontendMaxBody)
+	}
+	l.configure(FrontendLimitsConfig{
+		FrontendLimit: FrontendLimit{MaxBodyBytes: 4096},
+		Routes:        []FrontendRouteLimit{{Prefix: "/api/upload", FrontendLimit: FrontendLimit{MaxBodyBytes: 1 << 20}}},
+	}, nil)
+	cred := &FrontendCredential{Name: "bot", Limit: &FrontendLimit{MaxBodyBytes: 100}}
+	for _, tc := range []struct {
+		cred *FrontendCredential
+		path string
+		want int64
+	}{
+		{nil, "/api/x", 4096},
+		{nil, "/api/upload/file", 4096}, // a rule can't raise the block's cap
+		{cred, "/api/x", 100},
+	} {
+		if got, _ := l.maxBody(tc.cred, "POST", tc.path); got != tc.want {
+			t.Errorf("maxBody(%v, %s) = %d, want %d", tc.cred != nil, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestFrontendServer_Limits(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	fake := NewFakeService(t, FakeServiceOptions{
+		ServiceID: "svc-echo",
+		Manifest:  newManifest("/api/echo/"),
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+		},
+	})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "register")
+	srv := startTCPFrontend(t, registry, &FrontendConfig{
+		TCP: tcpEnabled("127.0.0.1:0", false),
+		Limits: &FrontendLimitsConfig{
+			FrontendLimit: FrontendLimit{MaxBodyBytes: 64},
+			Routes:        []FrontendRouteLimit{{Prefix: "/api/echo", Methods: []string{"GET"}, FrontendLimit: FrontendLimit{Rate: 0.1, Burst: 2}}},
+		},
+	})
+	base := "http://" + srv.TCPAddr()
+	c := &http.Client{Timeout: 2 * time.Second}
+
+	for i := range 2 {
+		if resp := getStatus(t, c, "GET", base+"/api/echo/x", bearer("good-token")); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d = %d, want 200 within the burst", i, resp.StatusCode)
+		}
+	}
+	resp := getStatus(t, c, "GET", base+"/api/echo/x", bearer("good-token"))
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("past the burst = %d (Retry-After %q), want 429 with Retry-After", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	post := func(body io.Reader) int {
+		req, _ := http.NewRequest("POST", base+"/api/echo/x", body)
+		req.Header.Set("Authorization", "Bearer good-token")
+		resp, err := c.Do(req)
+		assertNoErr(t, err, "POST")
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := post(strings.NewReader(strings.Repeat("a", 64))); got != http.StatusOK {
+		t.Errorf("body at the cap = %d, want 200", got)
+	}
+	if got := post(strings.NewReader(strings.Repeat("a", 65))); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("declared body over the cap = %d, want 413", got)
+	}
+	// No Content-Length: the cap is hit while the proxy streams the body,
+	// and the service's circuit isn't charged for it.
+	if got := post(io.MultiReader(strings.NewReader(strings.Repeat("a", 200)))); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("streamed body over the cap = %d, want 413", got)
+	}
+	if c := registry.Get("svc-echo").Circuit(); c != "" {
+		t.Errorf("circuit %q after a body over the cap, want closed", c)
+	}
+
+	var limited, tooLarge uint64
+	for _, st := range getLimits(t, c, base, "good-token") {
+		limited += st.Limited
+		tooLarge += st.TooLarge
+	}
+	if limited != 1 || tooLarge != 2 {
+		t.Errorf("limited %d, too large %d; want 1 and 2", limited, tooLarge)
+	}
+}
+
+// getLimits reads GET /api/limits with token.
+func getLimits(t *testing.T, c *http.Client, base, token string) []frontendLimitStatus {
+	t.Helper()
+	req, _ := http.NewRequest("GET", base+"/api/limits", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.Do(req)
+	assertNoErr(t, err, "GET /api/limits")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/limits = %d", resp.StatusCode)
+	}
+	var got struct {
+		Limits []frontendLimitStatus `json:"limits"`
+	}
+	assertNoErr(t, json.NewDecoder(resp.Body).Decode(&got), "decode")
+	return got.Limits
+}
+
+// A credential's own limit replaces the block's rate for it, and it sees
+// only its own buckets.
+func TestFrontendServer_CredentialLimit(t *testing.T) {
+	srv, mine, _ := scopedFrontend(t, NewEnhancedServiceRegistry(nil))
+	token := mustCreateCred(t, srv.store, frontendCredentialRequest{
+		Name:       "bot",
+		Routes:     []string{"/api/projects", "/api/limits"},
+		ProjectIDs: []string{mine.ID},
+		Limit:      &FrontendLimit{Rate: 0.1, Burst: 2},
+	})
+	assertNoErr(t, srv.store.With(func(s *Settings) {
+		s.Frontend.Limits = &FrontendLimitsConfig{FrontendLimit: FrontendLimit{Rate: 100, Burst: 100}}
+	}), "set limits")
+	assertNoErr(t, srv.Reconcile(), "Reconcile")
+	base := "http://" + srv.TCPAddr()
+	c := &http.Client{Timeout: 2 * time.Second}
+
+	for range 5 {
+		if resp := getStatus(t, c, "GET", base+"/api/projects", bearer("good-token")); resp.StatusCode != http.StatusOK {
+			t.Fatalf("frontend token = %d, want 200 at the block's rate", resp.StatusCode)
+		}
+	}
+	if own := getLimits(t, c, base, token); len(own) != 1 || own[0].Credential != "bot" || own[0].Rate != 0.1 {
+		t.Errorf("credential's view = %+v, want only its own bucket", own)
+	}
+	if resp := getStatus(t, c, "GET", base+"/api/projects", bearer(token)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("credential's second request = %d, want 200 within its burst", resp.StatusCode)
+	}
+	if resp := getStatus(t, c, "GET", base+"/api/projects", bearer(token)); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("credential's third request = %d, want 429", resp.StatusCode)
+	}
+	for _, st := range getLimits(t, c, base, "good-token") {
+		if st.Credential == "bot" && st.Limited != 1 {
+			t.Errorf("bot's bucket = %+v, want 1 limited", st)
+		}
+		if st.Credential == "" && st.Limited != 0 {
+			t.Errorf("frontend token's bucket = %+v, want nothing limited", st)
+		}
+	}
+}
@@ -7,7 +7,8 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
-	"slices"
+
+	"relaygo/bridge"
 )
 
 // maxSessionBodyBytes bounds how much of a session-create body we buffer for
@@ -42,6 +43,11 @@ const maxSessionBodyBytes = 1 << 20
 //
 // Anything we can't confidently classify as disallowed is forwarded so
 // relayLLM remains the source of truth for every other failure mode.
+//
+// Other services declare the same kind of check in their manifests
+// (frontend_guards.go); this one stays built in because relayLLM's
+// manifest predates guards, and because session creation also carries the
+// remote-project refusal, which is no allowlist.
 func newSessionModelGuard(store SettingsStore, next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost || !isSessionCreatePath(r.URL.Path) {
@@ -56,6 +62,11 @@ func newSessionModelGuard(store SettingsStore, next http.Handler) http.HandlerFu
 		// body — relying on relayLLM to also reject the remainder. An oversized
 		// create body can't be fully validated, so fail closed instead.
 		body, err := io.ReadAll(io.LimitReader(r.Body, maxSessionBodyBytes+1))
+		if bodyTooLarge(err) {
+			// Over the front door's own, lower, cap (frontendLimits).
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			http.Error(w, "could not read request body", http.StatusBadRequest)
 			return
@@ -79,12 +90,30 @@ func newSessionModelGuard(store SettingsStore, next http.Handler) http.HandlerFu
 			ProjectID string `json:"projectId"`
 			Model     string `json:"model"`
 		}
+		cred := frontendCredentialFrom(r.Context())
 		if err := json.Unmarshal(body, &payload); err != nil {
-			// Not a shape we understand — let relayLLM produce the error.
+			// Not a shape we understand — let relayLLM produce the error,
+			// unless a scoped credential sent it: its project can't be
+			// checked, so it fails closed.
+			if cred != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid session create body"})
+				return
+			}
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		// A scoped credential creates sessions only in its own projects
+		// (frontend_credentials.go), never a projectless one.
+		if cred != nil && !cred.GrantsProject(payload.ProjectID) {
+			slog.Warn("frontend: blocked session create outside credential's projects",
+				"credential", cred.Name, "project", payload.ProjectID)
+			writeJSON(w, http.StatusForbidden, map[string]string{
+				"error": fmt.Sprintf("credential %q may not create sessions in project %q", cred.Name, payload.ProjectID),
+			})
+			return
+		}
+
 		if err := refuseRemoteSession(store, payload.ProjectID); err != nil {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
@@ -149,8 +178,5 @@ func modelAllowedForProject(store SettingsStore, projectID, model string) bool {
 	if proj == nil {
 		return true // unknown project — let relayLLM produce the authoritative error
 	}
-	if len(proj.AllowedModels) == 0 || isWildcard(proj.AllowedModels) {
-		return true // unrestricted
-	}
-	return slices.Contains(proj.AllowedModels, model)
+	return projectAllows(proj, bridge.GuardAllowModels, model)
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"cmp"
+	"net/url"
+	"slices"
+	"strings"
+
+	"relaygo/bridge"
+)
+
+// Manifest routes, compiled for the dispatcher.
+//
+// A manifest declares routes as bridge.RouteDecl — a path that may be a
+// prefix and may hold {name} parameters, the methods it takes, a rewrite
+// and a priority (bridge/manifest.go). RegisterReplica compiles each into
+// a frontendRoute once, so the per-request work in Lookup is a segment
+// comparison, and the dispatcher applies the route's rewrite to the
+// request it forwards.
+
+// frontendRoute is one compiled manifest route.
+type frontendRoute struct {
+	bridge.RouteDecl
+	// segs are Path's segments after the leading "/", without the empty
+	// one a prefix's trailing "/" leaves: "/api/{id}/" is ["api", "{id}"].
+	segs   []string
+	prefix bool
+	// literal is Path's length less its parameters: the specificity that
+	// ranks routes of equal priority. For a route without parameters it is
+	// the plain string length, which keeps longest-prefix match.
+	literal int
+	// firstParam is the index of the first parameter segment, len(segs)
+	// with none; breaks a tie in literal length in favour of the route
+	// whose literal segments come first.
+	firstParam int
+	// strip is how many leading request segments StripPrefix removes.
+	strip int
+}
+
+// compileRoutes compiles every route the manifest declares, in
+// Manifest.AllRoutes order.
+func compileRoutes(m bridge.Manifest) []frontendRoute {
+	decls := m.AllRoutes()
+	out := make([]frontendRoute, 0, len(decls))
+	for _, d := range decls {
+		out = append(out, compileRoute(d))
+	}
+	return out
+}
+
+// compileRoute compiles one route declaration.
+func compileRoute(d bridge.RouteDecl) frontendRoute {
+	rt := frontendRoute{RouteDecl: d, prefix: strings.HasSuffix(d.Path, "/")}
+	if p := strings.TrimSuffix(d.Path, "/"); p != "" {
+		rt.segs = strings.Split(p[1:], "/")
+	}
+	rt.literal, rt.firstParam = len(d.Path), len(rt.segs)
+	for i, seg := range rt.segs {
+		if _, ok := bridge.RouteParam(seg); ok {
+			rt.literal -= len(seg)
+			rt.firstParam = min(rt.firstParam, i)
+		}
+	}
+	if d.StripPrefix != "" {
+		rt.strip = strings.Count(d.StripPrefix, "/")
+	}
+	return rt
+}
+
+// matchPath reports whether the route's path matches p, and what its
+// parameters matched. A prefix route needs at least one more segment
+// (possibly empty: "/api/" matches "/api/"); an exact one needs none.
+func (rt *frontendRoute) matchPath(p string) (map[string]string, bool) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, false
+	}
+	segs := strings.Split(p[1:], "/")
+	if rt.prefix && len(segs) <= len(rt.segs) || !rt.prefix && len(segs) != len(rt.segs) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, want := range rt.segs {
+		name, ok := bridge.RouteParam(want)
+		if !ok {
+			if segs[i] != want {
+				return nil, false
+			}
+			continue
+		}
+		if segs[i] == "" {
+			return nil, false
+		}
+		if params == nil {
+			params = make(map[string]string, 1)
+		}
+		params[name] = segs[i]
+	}
+	return params, true
+}
+
+// allowsMethod reports whether the route takes the HTTP method.
+func (rt *frontendRoute) allowsMethod(method string) bool {
+	return len(rt.Methods) == 0 || slices.Contains(rt.Methods, method)
+}
+
+// rewrites reports whether the route changes the path it forwards.
+func (rt *frontendRoute) rewrites() bool {
+	return rt.StripPrefix != "" || rt.AddPrefix != ""
+}
+
+// rewrite applies the route's StripPrefix and AddPrefix to u in place. The
+// segments stripped are the ones the route matched, in the decoded path;
+// what is kept goes on as the client encoded it wherever the encoded path
+// splits the same way, so an escaped "/" inside a kept segment reaches the
+// service escaped. Parameters substituted into AddPrefix are escaped for a
+// path segment. It returns the prefix stripped, escaped, for
+// X-Forwarded-Prefix, or "".
+func (rt *frontendRoute) rewrite(u *url.URL, params map[string]string) string {
+	if !rt.rewrites() {
+		return ""
+	}
+	segs := strings.Split(u.Path[1:], "/")
+	esc := strings.Split(u.EscapedPath()[1:], "/")
+	n := min(rt.strip, len(segs))
+	stripped := ""
+	if n > 0 {
+		stripped = (&url.URL{Path: "/" + strings.Join(segs[:n], "/")}).EscapedPath()
+	}
+	raw := ""
+	if sameSegments(esc, segs, n) {
+		raw = joinRoute(rt.addPrefix(params, url.PathEscape), esc[n:])
+	}
+	u.Path = joinRoute(rt.addPrefix(params, func(v string) string { return v }), segs[n:])
+	u.RawPath = raw
+	return stripped
+}
+
+// addPrefix is AddPrefix with its parameters substituted, each through
+// escape.
+func (rt *frontendRoute) addPrefix(params map[string]string, escape func(string) string) string {
+	parts := strings.Split(rt.AddPrefix, "/")
+	for i, seg := range parts {
+		if name, ok := bridge.RouteParam(seg); ok {
+			parts[i] = escape(params[name])
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// joinRoute appends the kept segments to a prefix, giving "/" for nothing.
+func joinRoute(prefix string, rest []string) string {
+	out := prefix
+	if len(rest) > 0 {
+		out += "/" + strings.Join(rest, "/")
+	}
+	if out == "" {
+		out = "/"
+	}
+	return out
+}
+
+// sameSegments reports whether the first n segments of the escaped path
+// decode to the first n of the decoded one — false when an escaped "/"
+// among them moves the boundaries.
+func sameSegments(esc, segs []string, n int) bool {
+	if len(esc) < n {
+		return false
+	}
+	for i := range n {
+		if d, err := url.PathUnescape(esc[i]); err != nil || d != segs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// routeRank orders candidate routes for one request: higher priority,
+// then more literal characters, then exact over prefix, then literal
+// segments before parameters. The service ID breaks what's left — two
+// services whose different routes tie this far, like "/a/{x}/c" and
+// "/a/b/{y}" on "/a/b/c", get the same answer every time rather than
+// whichever registered first.
+type routeRank struct {
+	priority, literal int
+	exact             bool
+	firstParam        int
+	service           string
+}
+
+func rankOf(rt *frontendRoute, service string) routeRank {
+	return routeRank{
+		priority:   rt.Priority,
+		literal:    rt.literal,
+		exact:      !rt.prefix,
+		firstParam: rt.firstParam,
+		service:    service,
+	}
+}
+
+// compareRank returns a positive number when a ranks above b, negative
+// when below, and 0 for the same route of one service (its replicas).
+func compareRank(a, b routeRank) int {
+	if c := cmp.Compare(a.priority, b.priority); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.literal, b.literal); c != 0 {
+		return c
+	}
+	if a.exact != b.exact {
+		if a.exact {
+			return 1
+		}
+		return -1
+	}
+	if c := cmp.Compare(a.firstParam, b.firstParam); c != 0 {
+		return c
+	}
+	return strings.Compare(b.service, a.service)
+}
+
+// routeMatch is what Lookup found for a request besides the replica: the
+// route that matched and its parameters, or with no replica, the methods
+// the routes matching the path would have taken.
+type routeMatch struct {
+	route  *frontendRoute
+	params map[string]string
+	allow  []string
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"relaygo/bridge"
+)
+
+// Tests for manifest route rules (frontend_routes.go): parameter matching,
+// method filters, priorities, prefix rewriting, the conflict policy they
+// relax, and the dispatcher applying all of it to HTTP and WebSocket
+// requests.
+
+func ruleManifest(rules ...bridge.RouteDecl) bridge.Manifest {
+	return bridge.Manifest{RouteRules: rules}
+}
+
+func compileOne(t *testing.T, d bridge.RouteDecl) *frontendRoute {
+	t.Helper()
+	m := ruleManifest(d)
+	assertNoErr(t, m.Validate(), "Validate")
+	return &compileRoutes(m)[0]
+}
+
+func TestFrontendRoute_MatchPath(t *testing.T) {
+	cases := []struct {
+		route, path string
+		want        bool
+		params      map[string]string
+	}{
+		{"/api/", "/api/", true, nil},
+		{"/api/", "/api/x/y", true, nil},
+		{"/api/", "/api", false, nil},
+		{"/api/x", "/api/x", true, nil},
+		{"/api/x", "/api/x/", false, nil},
+		{"/api/x", "/api/xy", false, nil},
+		{"/", "/anything/at/all", true, nil},
+		{"/p/{id}", "/p/42", true, map[string]string{"id": "42"}},
+		{"/p/{id}", "/p/", false, nil},
+		{"/p/{id}", "/p/42/x", false, nil},
+		{"/p/{id}/files/", "/p/42/files/a.txt", true, map[string]string{"id": "42"}},
+		{"/p/{id}/files/", "/p/42/other/a.txt", false, nil},
+		{"/{a}/{b}", "/x/y", true, map[string]string{"a": "x", "b": "y"}},
+	}
+	for _, c := range cases {
+		rt := compileOne(t, bridge.RouteDecl{Path: c.route})
+		params, ok := rt.matchPath(c.path)
+		if ok != c.want {
+			t.Errorf("%q matching %q = %v, want %v", c.route, c.path, ok, c.want)
+			continue
+		}
+		for k, v := range c.params {
+			if params[k] != v {
+				t.Errorf("%q matching %q: {%s} = %q, want %q", c.route, c.path, k, params[k], v)
+			}
+		}
+	}
+}
+
+func TestFrontendRoute_Rewrite(t *testing.T) {
+	cases := []struct {
+		decl      bridge.RouteDecl
+		in        string
+		want      string
+		wantStrip string
+	}{
+		{bridge.RouteDecl{Path: "/v2/llm/", StripPrefix: "/v2/llm"}, "/v2/llm/sessions", "/sessions", "/v2/llm"},
+		{bridge.RouteDecl{Path: "/v2/llm/", StripPrefix: "/v2/llm"}, "/v2/llm/", "/", "/v2/llm"},
+		{bridge.RouteDecl{Path: "/v2/llm", StripPrefix: "/v2/llm"}, "/v2/llm", "/", "/v2/llm"},
+		{bridge.RouteDecl{Path: "/v2/llm/", StripPrefix: "/v2/llm", AddPrefix: "/api"}, "/v2/llm/sessions/1", "/api/sessions/1", "/v2/llm"},
+		{bridge.RouteDecl{Path: "/legacy/", AddPrefix: "/compat"}, "/legacy/x", "/compat/legacy/x", ""},
+		{bridge.RouteDecl{Path: "/t/{tenant}/jobs/", StripPrefix: "/t/{tenant}", AddPrefix: "/api/{tenant}"}, "/t/acme/jobs/7", "/api/acme/jobs/7", "/t/acme"},
+		// What the client encoded in the part kept stays encoded.
+		{bridge.RouteDecl{Path: "/v2/files/", StripPrefix: "/v2"}, "/v2/files/a%2Fb", "/files/a%2Fb", "/v2"},
+	}
+	for _, c := range cases {
+		rt := compileOne(t, c.decl)
+		u, err := url.Parse(c.in)
+		assertNoErr(t, err, "parse")
+		params, ok := rt.matchPath(u.Path)
+		if !ok {
+			t.Errorf("%q does not match %q", c.decl.Path, c.in)
+			continue
+		}
+		stripped := rt.rewrite(u, params)
+		if got := u.EscapedPath(); got != c.want || stripped != c.wantStrip {
+			t.Errorf("%+v on %q = %q (stripped %q), want %q (stripped %q)", c.decl, c.in, got, stripped, c.want, c.wantStrip)
+		}
+	}
+}
+
+// A parameter substituted into AddPrefix is escaped, so a value can't add
+// path segments of its own.
+func TestFrontendRoute_RewriteEscapesParams(t *testing.T) {
+	rt := compileOne(t, bridge.RouteDecl{Path: "/t/{tenant}/", StripPrefix: "/t/{tenant}", AddPrefix: "/api/{tenant}"})
+	u, _ := url.Parse("/t/a%20b/x")
+	params, _ := rt.matchPath(u.Path)
+	rt.rewrite(u, params)
+	if got := u.EscapedPath(); got != "/api/a%20b/x" || u.Path != "/api/a b/x" {
+		t.Errorf("rewritten to %q (%q)", got, u.Path)
+	}
+}
+
+// The route matches the decoded path, so the segments it strips are the
+// decoded ones, even when an escaped "/" inside them splits the encoded
+// path differently.
+func TestFrontendRoute_RewriteStripsWhatMatched(t *testing.T) {
+	rt := compileOne(t, bridge.RouteDecl{Path: "/t/{tenant}/", StripPrefix: "/t/{tenant}"})
+	u, _ := url.Parse("/t/a%2Fb/x")
+	params, ok := rt.matchPath(u.Path)
+	if !ok || params["tenant"] != "a" {
+		t.Fatalf("match = %v %v", params, ok)
+	}
+	if stripped := rt.rewrite(u, params); stripped != "/t/a" || u.Path != "/b/x" {
+		t.Errorf("stripped %q, left %q", stripped, u.Path)
+	}
+}
+
+// Two services share "/api/" by method, and a third takes one path over by
+// priority; a method nobody takes is a 405 naming those that are.
+func TestEnhancedServiceRegistry_Lookup_MethodsAndPriority(t *testing.T) {
+	r := NewEnhancedServiceRegistry(nil)
+	assertNoErr(t, r.RegisterManifest("reader", "/tmp/r.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/api/", Methods: []string{"GET", "HEAD"}})), "register reader")
+	assertNoErr(t, r.RegisterManifest("writer", "/tmp/w.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/api/", Methods: []string{"POST", "PUT"}})), "register writer")
+	assertNoErr(t, r.RegisterManifest("override", "/tmp/o.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/api/{any}", Priority: 10})), "register override")
+
+	cases := []struct {
+		method, path, want string
+	}{
+		{"GET", "/api/a/b", "reader"},
+		{"POST", "/api/a/b", "writer"},
+		// One segment under /api: the priority-10 route wins whatever the
+		// longer literal match elsewhere.
+		{"GET", "/api/a", "override"},
+		{"DELETE", "/api/a", "override"},
+		{"", "/api/a/b", "reader"},
+	}
+	for _, c := range cases {
+		svc, match := r.Lookup(c.method, c.path)
+		if svc == nil || svc.ServiceID != c.want {
+			t.Errorf("Lookup(%s %s) = %v, want %s", c.method, c.path, svc, c.want)
+			continue
+		}
+		if match.route == nil {
+			t.Errorf("Lookup(%s %s): no route", c.method, c.path)
+		}
+	}
+	svc, match := r.Lookup("DELETE", "/api/a/b")
+	if svc != nil {
+		t.Fatalf("DELETE routed to %s", svc.ServiceID)
+	}
+	if got := strings.Join(match.allow, ","); got != "GET,HEAD,POST,PUT" {
+		t.Errorf("allow = %q", got)
+	}
+}
+
+// Specificity ranks routes of equal priority: the more literal
+// characters, then exact over prefix, then literal segments first.
+func TestEnhancedServiceRegistry_Lookup_Specificity(t *testing.T) {
+	r := NewEnhancedServiceRegistry(nil)
+	assertNoErr(t, r.RegisterManifest("projects", "/tmp/p.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/p/{id}/files/"})), "register projects")
+	assertNoErr(t, r.RegisterManifest("shared", "/tmp/s.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/p/shared/files/"})), "register shared")
+	assertNoErr(t, r.RegisterManifest("late", "/tmp/l.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/p/{id}/x"})), "register late")
+	assertNoErr(t, r.RegisterManifest("early", "/tmp/e.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/p/7/{y}"})), "register early")
+
+	cases := map[string]string{
+		"/p/42/files/a":     "projects",
+		"/p/shared/files/a": "shared",
+		// Same literal length; the literal segment first wins.
+		"/p/7/x": "early",
+		"/p/8/x": "late",
+	}
+	for path, want := range cases {
+		if svc := r.LookupByPath(path); svc == nil || svc.ServiceID != want {
+			t.Errorf("LookupByPath(%s) = %v, want %s", path, svc, want)
+		}
+	}
+	_, match := r.Lookup("GET", "/p/42/files/a")
+	if match.params["id"] != "42" {
+		t.Errorf("params = %v", match.params)
+	}
+}
+
+func TestEnhancedServiceRegistry_RouteRuleConflicts(t *testing.T) {
+	r := NewEnhancedServiceRegistry(nil)
+	assertNoErr(t, r.RegisterManifest("svc-a", "/tmp/a.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/api/{id}", Methods: []string{"GET"}})), "register svc-a")
+
+	// Same shape, a method in common, equal priority: refused.
+	err := r.RegisterManifest("svc-b", "/tmp/b.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/api/{name}", Methods: []string{"GET", "POST"}}))
+	if err == nil || !strings.Contains(err.Error(), "svc-a") {
+		t.Fatalf("err = %v, want a conflict with svc-a", err)
+	}
+	// A plain route of the same shape collides too: it takes every method.
+	if err := r.RegisterManifest("svc-b", "/tmp/b.sock", "t", bridge.Manifest{Routes: []string{"/api/{x}"}}); err == nil {
+		t.Fatal("plain route over a GET rule accepted")
+	}
+	// Disjoint methods, or a different priority, are not conflicts.
+	assertNoErr(t, r.RegisterManifest("svc-b", "/tmp/b.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/api/{name}", Methods: []string{"POST"}})), "register disjoint")
+	assertNoErr(t, r.RegisterManifest("svc-c", "/tmp/c.sock", "t", ruleManifest(
+		bridge.RouteDecl{Path: "/api/{name}", Priority: -1})), "register lower priority")
+	if svc, _ := r.Lookup("DELETE", "/api/1"); svc == nil || svc.ServiceID != "svc-c" {
+		t.Errorf("DELETE went to %v, want the fallback svc-c", svc)
+	}
+}
+
+// A service mounted under a prefix it doesn't know: relay strips it, adds
+// the service's own, and says what it stripped.
+func TestFrontendDispatcher_RewritesPath(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	var escaped string
+	fake := NewFakeService(t, FakeServiceOptions{
+		ServiceID: "svc-v2",
+		Manifest: ruleManifest(bridge.RouteDecl{
+			Path: "/v2/llm/", StripPrefix: "/v2/llm", AddPrefix: "/api", Methods: []string{"GET"},
+		}),
+		Handler: func(w http.ResponseWriter, r *http.Request) { escaped = r.URL.EscapedPath() },
+	})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "register")
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/v2/llm/sessions/a%2Fb?x=1", nil)
+	req.Header.Set("X-Forwarded-Prefix", "/spoofed")
+	resp, err := http.DefaultClient.Do(req)
+	assertNoErr(t, err, "GET")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	got := fake.LastRequest()
+	if escaped != "/api/sessions/a%2Fb" || got.Query.Get("x") != "1" {
+		t.Errorf("service saw %s?%s", escaped, got.Query.Encode())
+	}
+	if p := got.Headers.Get("X-Forwarded-Prefix"); p != "/v2/llm" {
+		t.Errorf("X-Forwarded-Prefix = %q, want /v2/llm", p)
+	}
+
+	resp, err = http.Post(srv.URL+"/v2/llm/sessions", "text/plain", nil)
+	assertNoErr(t, err, "POST")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET" {
+		t.Errorf("POST = %d, Allow %q; want 405, GET", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
+
+// A route without a rewrite passes the path through untouched, and drops a
+// client's X-Forwarded-Prefix all the same.
+func TestFrontendDispatcher_NoRewriteDropsForwardedPrefix(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-a", Manifest: newManifest("/api/a/")})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "register")
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/api/a/x", nil)
+	req.Header.Set("X-Forwarded-Prefix", "/spoofed")
+	resp, err := http.DefaultClient.Do(req)
+	assertNoErr(t, err, "GET")
+	resp.Body.Close()
+	got := fake.LastRequest()
+	if got.Path != "/api/a/x" || got.Headers.Get("X-Forwarded-Prefix") != "" {
+		t.Errorf("service saw %s with X-Forwarded-Prefix %q", got.Path, got.Headers.Get("X-Forwarded-Prefix"))
+	}
+}
+
+func TestFrontendDispatcher_RewritesWebSocketPath(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	fake := NewFakeService(t, FakeServiceOptions{
+		ServiceID: "svc-ws",
+		Manifest:  ruleManifest(bridge.RouteDecl{Path: "/v2/ws", StripPrefix: "/v2", Methods: []string{"GET"}}),
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			c, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			_ = c.WriteMessage(websocket.TextMessage, []byte(r.URL.Path))
+		},
+	})
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "register")
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/v2/ws", nil)
+	assertNoErr(t, err, "dial")
+	defer conn.Close()
+	_, msg, err := conn.ReadMessage()
+	assertNoErr(t, err, "read")
+	if string(msg) != "/ws" {
+		t.Errorf("service saw %q, want /ws", msg)
+	}
+	if p := fake.LastRequest().Headers.Get("X-Forwarded-Prefix"); p != "/v2" {
+		t.Errorf("X-Forwarded-Prefix = %q, want /v2", p)
+	}
+}
@@ -11,7 +11,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"relaygo/bridge"
 )
 
 // FrontendServer hosts the HTTP API that Eve and relayScheduler consume. It
@@ -22,10 +26,31 @@ import (
 // The frontend bearer token is validated on every request and WS upgrade.
 // The dispatcher then injects each service's own internal token before
 // dialing it — the two trust boundaries stay distinct.
+//
+// Settings can also open a TCP listener serving the same handler
+// (frontend_tcp.go); Reconcile opens, moves and closes it.
 type FrontendServer struct {
 	socketPath string
 	server     *http.Server
 	listener   net.Listener
+	handler    http.Handler
+	store      SettingsStore
+	// access is the access log (frontend_access.go); nil when it couldn't
+	// be opened.
+	access *frontendAccessLog
+	// origins is the allowed_origins list as of the last Reconcile, read
+	// per request by CORS and the dispatcher's WebSocket Origin check.
+	origins atomic.Pointer[[]string]
+	// limits holds every bearer's rate and body limits
+	// (frontend_limits.go), configured by Reconcile.
+	limits *frontendLimiter
+
+	tcpMu sync.Mutex
+	tcp   *frontendTCP
+	// closed latches at Shutdown so a Reconcile racing it can't bind a
+	// listener behind it.
+	closed        bool
+	lastTCPReport string
 }
 
 // NewFrontendServer wires the mux and binds the frontend Unix socket at 0600.
@@ -35,6 +60,12 @@ type FrontendServer struct {
 // tools enumerates the live MCP tool list for the project-picker UI; nil
 // makes the GET /api/mcps/{id}/tools endpoint return 503.
 //
+// metrics backs the usage-history routes (RegisterResourceMetricsRoutes);
+// nil makes them return 503.
+//
+// events backs the event stream at GET /api/events (RegisterEventRoutes);
+// nil makes it return 503.
+//
 // onProjectsChanged fires after every successful project mutation so the
 // tray Settings webview can rebuild its state; nil suppresses fan-out.
 //
@@ -42,7 +73,7 @@ type FrontendServer struct {
 // relay-internal endpoints (project routes). It reads from the enhanced-
 // services registry to pick a target service per request — no hardcoded
 // per-service handlers live here.
-func NewFrontendServer(store SettingsStore, mcps ContextSchemasProvider, tools MCPToolsProvider, frontend Endpoint, enhanced *EnhancedServiceRegistry, skillLister SkillLister, onProjectsChanged ProjectsChangedFn) (*FrontendServer, error) {
+func NewFrontendServer(store SettingsStore, mcps ContextSchemasProvider, tools MCPToolsProvider, frontend Endpoint, enhanced *EnhancedServiceRegistry, skillLister SkillLister, metrics *MetricsHistory, events *EventBus, onProjectsChanged ProjectsChangedFn) (*FrontendServer, error) {
 	if frontend.Socket == "" {
 		return nil, errors.New("frontend socket path is empty")
 	}
@@ -50,14 +81,22 @@ func NewFrontendServer(store SettingsStore, mcps ContextSchemasProvider, tools M
 		return nil, errors.New("enhanced-services registry is nil")
 	}
 
+	fs := &FrontendServer{socketPath: frontend.Socket, store: store, access: openFrontendAccessLog(), limits: newFrontendLimiter()}
 	mux := http.NewServeMux()
 	RegisterProjectRoutes(mux, store, mcps, tools, skillLister, onProjectsChanged)
+	RegisterResourceMetricsRoutes(mux, store, metrics)
+	RegisterEventRoutes(mux, store, events, fs.allowedOrigins)
+	RegisterFrontendLimitRoutes(mux, fs.limits)
 
 	// Catch-all dispatcher: any path not matched by a more specific handler
-	// (project routes above) is resolved against the manifest registry and
-	// reverse-proxied to the matching enhanced service. WS upgrades are
-	// handled by the same dispatcher (it detects them from the request).
+	// (project, metrics and event routes above) is resolved against the
+	// manifest registry and reverse-proxied to the matching enhanced
+	// service. WS upgrades are handled by the same dispatcher (it detects
+	// them from the request).
 	dispatcher := NewFrontendDispatcher(enhanced)
+	dispatcher.allowedOrigins = fs.allowedOrigins
+	dispatcher.credentialLive = func(c *FrontendCredential) bool { return frontendCredentialLive(store, c) }
+	dispatcher.store = store
 
 	// Session creation is the one proxied route relay must inspect: the
 	// per-project model allowlist lives only in relay's settings, so it can
@@ -67,36 +106,47 @@ func NewFrontendServer(store SettingsStore, mcps ContextSchemasProvider, tools M
 	// request and forwards everything that isn't a session-create POST.
 	mux.Handle("/", newSessionModelGuard(store, dispatcher))
 
-	handler := frontendBearerAuth(frontend.Token, frontendRecover(mux))
-
-	srv := &http.Server{
-		Handler: handler,
-		// Streaming sessions run for many minutes; only header/idle timeouts
-		// apply, never write timeout (it would kill in-progress generations).
-		ReadHeaderTimeout: 30 * time.Second,
-		IdleTimeout:       5 * time.Minute,
-	}
+	// The access logger is outermost so refusals are logged too, and every
+	// response — a 401 included — carries the request's X-Request-ID. Limits
+	// apply once the bearer is known and in scope, so an unauthenticated
+	// flood can't spend a real bearer's budget.
+	fs.handler = frontendAccessLogger(fs.access, frontendCORS(fs.allowedOrigins,
+		frontendBearerAuth(frontend.Token, frontendCredentialLookup(store),
+			frontendRecover(frontendScope(frontendLimits(fs.limits, frontendRoutePattern(mux)))))))
+	fs.server = newFrontendHTTPServer(fs.handler)
 
 	if err := os.MkdirAll(filepath.Dir(frontend.Socket), 0o700); err != nil {
+		_ = fs.access.Close()
 		return nil, fmt.Errorf("create frontend socket dir: %w", err)
 	}
 	_ = os.Remove(frontend.Socket)
 	ln, err := net.Listen("unix", frontend.Socket)
 	if err != nil {
+		_ = fs.access.Close()
 		return nil, fmt.Errorf("listen on frontend socket: %w", err)
 	}
 	if err := os.Chmod(frontend.Socket, 0o600); err != nil {
 		_ = ln.Close()
+		_ = fs.access.Close()
 		return nil, fmt.Errorf("chmod frontend socket: %w", err)
 	}
 
+	fs.listener = ln
+
 	slog.Info("frontend server bound",
 		"socket", frontend.Socket, "auth", frontend.Token != "")
-	return &FrontendServer{
-		socketPath: frontend.Socket,
-		server:     srv,
-		listener:   ln,
-	}, nil
+	return fs, nil
+}
+
+// newFrontendHTTPServer returns the http.Server for one frontend listener.
+func newFrontendHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler: handler,
+		// Streaming sessions run for many minutes; only header/idle timeouts
+		// apply, never write timeout (it would kill in-progress generations).
+		ReadHeaderTimeout: 30 * time.Second,
+		IdleTimeout:       5 * time.Minute,
+	}
 }
 
 // Serve blocks accepting connections until Shutdown is called.
@@ -107,11 +157,20 @@ func (s *FrontendServer) Serve() error {
 	return nil
 }
 
-// Shutdown drains in-flight requests and unlinks the socket file.
+// Shutdown drains in-flight requests, closes the TCP listener if one is
+// open and unlinks the socket file.
 func (s *FrontendServer) Shutdown(ctx context.Context) {
 	if s == nil || s.server == nil {
 		return
 	}
+	s.tcpMu.Lock()
+	s.closed = true
+	tcp := s.tcp
+	s.tcp = nil
+	s.tcpMu.Unlock()
+	if tcp != nil {
+		tcp.shutdown(ctx)
+	}
 	if err := s.server.Shutdown(ctx); err != nil {
 		slog.Warn("frontend server did not drain cleanly", "error", err)
 	}
@@ -121,6 +180,7 @@ func (s *FrontendServer) Shutdown(ctx context.Context) {
 	if s.socketPath != "" {
 		_ = os.Remove(s.socketPath)
 	}
+	_ = s.access.Close()
 }
 
 // frontendBearerAuth validates the frontend bearer token. Constant-time
@@ -129,7 +189,12 @@ func (s *FrontendServer) Shutdown(ctx context.Context) {
 // channel always mints a token (FrontendChannel.Ensure), so empty means
 // misconfiguration, and serving open would silently expose every proxied
 // service. Reject all requests rather than disable auth.
-func frontendBearerAuth(token string, next http.Handler) http.Handler {
+//
+// A bearer that isn't the channel's token may be a scoped credential
+// (frontend_credentials.go): lookup resolves it, and the request carries
+// the credential on to frontendScope and the handlers that narrow by
+// project. nil lookup accepts the channel's token only.
+func frontendBearerAuth(token string, lookup func(string) *FrontendCredential, next http.Handler) http.Handler {
 	if token == "" {
 		slog.Error("frontend: no bearer token configured — rejecting all requests (fail closed)")
 		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
@@ -145,13 +210,21 @@ func frontendBearerAuth(token string, next http.Handler) http.Handler {
 			return
 		}
 		got := []byte(strings.TrimSpace(header[len(prefix):]))
-		if subtle.ConstantTimeCompare(got, expected) != 1 {
-			slog.Warn("frontend: bad bearer token",
-				"method", r.Method, "path", r.URL.Path)
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		if subtle.ConstantTimeCompare(got, expected) == 1 {
+			next.ServeHTTP(w, r)
 			return
 		}
-		next.ServeHTTP(w, r)
+		// Looked up by hash, so comparing it leaks nothing about the token.
+		if lookup != nil {
+			if cred := lookup(string(got)); cred != nil {
+				frontendAccessFrom(r.Context()).setCredential(cred.Name)
+				next.ServeHTTP(w, r.WithContext(withFrontendCredential(r.Context(), cred)))
+				return
+			}
+		}
+		slog.Warn("frontend: bad bearer token",
+			"method", r.Method, "path", r.URL.Path, "request_id", r.Header.Get(bridge.RequestIDHeader))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
 	})
 }
 
@@ -37,6 +37,8 @@ func newTestFrontendServer(t *testing.T, token string) (*FrontendServer, string)
 		enhanced,
 		nil,
 		nil,
+		nil,
+		nil,
 	)
 	if err != nil {
 		t.Fatalf("NewFrontendServer: %v", err)
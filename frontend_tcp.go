@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"relaygo/bridge"
+)
+
+// The frontend API's optional TCP listener.
+//
+// The frontend server always serves on its 0600 Unix socket, which is what
+// Eve and the scheduler use. A browser-based tool can't dial a Unix socket,
+// and neither can a phone on the LAN, so settings can also open a TCP
+// listener serving the very same handler — same bearer auth, same routes,
+// same dispatcher. It is off unless enabled, binds loopback unless told
+// otherwise, and refuses to bind beyond loopback without TLS: the bearer
+// token is the only credential, and it must not cross a network in the
+// clear. TLS uses a server certificate from relay's CA (enrolment_ca.go),
+// issued per bind like the remote listener's; clients trust ca.crt from the
+// config dir.
+//
+// Browsers add a second concern: a page on any origin can send requests to
+// a listener it can reach. Bearer auth already stops a page that doesn't
+// hold the token, but the browser also needs to be told which origins may
+// read responses (CORS) and the dispatcher has to refuse WebSocket upgrades
+// from origins nobody allowed. Both consult allowed_origins.
+
+// defaultFrontendListen is the TCP listener's default bind: loopback, one
+// port above the remote listener's.
+const defaultFrontendListen = "127.0.0.1:9920"
+
+// FrontendConfig is the "frontend" block in settings.json:
+//
+//	"frontend": {
+//	  "tcp": {"enabled": true, "listen": "127.0.0.1:9920", "tls": false},
+//	  "allowed_origins": ["http://localhost:5173"],
+//	  "limits": {"rate": 20, "burst": 40}
+//	}
+//
+// AllowedOrigins applies to the Unix socket too, though only a browser
+// sends an Origin header and a browser can't reach the socket. "*" allows
+// any origin; the bearer token still has to be presented. Limits, the rate
+// and body limits (frontend_limits.go), likewise cover both listeners.
+type FrontendConfig struct {
+	TCP            *FrontendTCPConfig    `json:"tcp,omitempty"`
+	AllowedOrigins []string              `json:"allowed_origins,omitempty"`
+	Limits         *FrontendLimitsConfig `json:"limits,omitempty"`
+}
+
+// FrontendTCPConfig is the TCP listener's part of the frontend block.
+// Enabled is a *bool defaulting to false for the reason RemoteConfig's is:
+// a block that names an address but forgets `enabled` opens nothing.
+type FrontendTCPConfig struct {
+	Enabled *bool  `json:"enabled,omitempty"`
+	Listen  string `json:"listen,omitempty"`
+	TLS     bool   `json:"tls,omitempty"`
+}
+
+// resolvedFrontendTCP is FrontendTCPConfig with defaults applied.
+// Comparable, so Reconcile can tell whether the live listener still matches.
+type resolvedFrontendTCP struct {
+	Enabled bool
+	Listen  string
+	TLS     bool
+}
+
+// tcp resolves the TCP listener's config. Nil-safe: an absent block
+// resolves to disabled.
+func (c *FrontendConfig) tcp() resolvedFrontendTCP {
+	out := resolvedFrontendTCP{Listen: defaultFrontendListen}
+	if c == nil || c.TCP == nil {
+		return out
+	}
+	out.Enabled = boolOr(c.TCP.Enabled, false)
+	out.TLS = c.TCP.TLS
+	if c.TCP.Listen != "" {
+		out.Listen = c.TCP.Listen
+	}
+	return out
+}
+
+// origins returns the valid entries of AllowedOrigins, normalized, and an
+// error naming the invalid ones. Nil-safe.
+func (c *FrontendConfig) origins() ([]string, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var out []string
+	var errs []error
+	for _, o := range c.AllowedOrigins {
+		n, err := normalizeOrigin(o)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out, errors.Join(errs...)
+}
+
+// normalizeOrigin checks an allowed_origins entry is "*" or a bare
+// scheme://host[:port] origin, the form browsers send, and lowercases it.
+func normalizeOrigin(o string) (string, error) {
+	if o == "*" {
+		return o, nil
+	}
+	u, err := url.Parse(strings.TrimSuffix(o, "/"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("allowed origin %q is not of the form http(s)://host[:port]", o)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// validate refuses a listener reachable beyond loopback without TLS.
+func (c resolvedFrontendTCP) validate() error {
+	host, _, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return fmt.Errorf("frontend.tcp.listen %q: %w", c.Listen, err)
+	}
+	// isLoopbackHost (oauth.go) is false for an empty host, which binds
+	// every interface.
+	if !c.TLS && !isLoopbackHost(host) {
+		return fmt.Errorf("frontend.tcp.listen %q is reachable beyond this machine; set frontend.tcp.tls so the bearer token isn't sent in the clear", c.Listen)
+	}
+	return nil
+}
+
+// originAllowed reports whether a request's Origin may use the frontend:
+// no Origin (not a browser), the origin of the listener it arrived on, or
+// one allowed by settings.
+//
+// The listener's own origin comes from its configuration, never from the
+// request's Host header: a page on a name the attacker re-points at
+// 127.0.0.1 (DNS rebinding) sends a Host that matches its own Origin.
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	own, _ := r.Context().Value(listenerOriginsKey{}).([]string)
+	if slices.Contains(own, strings.ToLower(origin)) {
+		return true
+	}
+	return originListed(origin, allowed)
+}
+
+// listenerOriginsKey carries, in a TCP request's context, the origins a
+// browser uses for the listener it arrived on. The Unix socket sets none:
+// no browser can load a page from it.
+type listenerOriginsKey struct{}
+
+// listenerOrigins returns the origins a browser may send for a listener
+// bound to addr per cfg: every name its certificate covers (the loopback
+// names, plus the configured host), with the bound port. A wildcard bind
+// gets only the loopback names; a LAN page goes on allowed_origins.
+func listenerOrigins(cfg resolvedFrontendTCP, addr net.Addr) []string {
+	scheme, defaultPort := "http", "80"
+	if cfg.TLS {
+		scheme, defaultPort = "https", "443"
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, h := range remoteCertHosts(cfg.Listen) {
+		out = append(out, strings.ToLower(scheme+"://"+net.JoinHostPort(h, port)))
+		if port == defaultPort {
+			// Browsers leave the scheme's default port out of Origin.
+			host := h
+			if strings.Contains(h, ":") {
+				host = "[" + h + "]"
+			}
+			out = append(out, strings.ToLower(scheme+"://"+host))
+		}
+	}
+	return out
+}
+
+// withListenerOrigins tags each request with its listener's origins.
+func withListenerOrigins(origins []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), listenerOriginsKey{}, origins)))
+	})
+}
+
+// originListed reports whether origin is on the allowlist.
+func originListed(origin string, allowed []string) bool {
+	if slices.Contains(allowed, "*") {
+		return true
+	}
+	return slices.Contains(allowed, strings.ToLower(origin))
+}
+
+// frontendCORS answers CORS for origins on the allowlist. It sits outside
+// bearer auth because a browser's preflight never carries credentials; the
+// request that follows it does, and is authenticated as usual. Responses
+// to other origins carry no CORS headers, so the browser withholds them
+// from the page, and a preflight from one is refused outright.
+//
+// X-Request-ID is both allowed and exposed, so a page can send its own ID
+// and read back the one the access log filed the request under.
+func frontendCORS(origins func() []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !originListed(origin, origins()) {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		if preflight {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+bridge.RequestIDHeader)
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", bridge.RequestIDHeader)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// frontendTCP is one bound TCP listener and the server on it.
+type frontendTCP struct {
+	cfg    resolvedFrontendTCP
+	ln     net.Listener
+	server *http.Server
+}
+
+// Reconcile converges the TCP listener, the origin allowlist and the rate
+// and body limits onto what settings.json says, the way
+// RemoteSupervisor.Reconcile does the remote listener: nothing happens when
+// nothing changed, a changed address or TLS setting binds the new listener
+// before closing the old one, and a bind that fails leaves the old one
+// serving. Called on every settings poll; a failure is logged once and
+// returned.
+func (s *FrontendServer) Reconcile() error {
+	if s == nil {
+		return nil
+	}
+	s.tcpMu.Lock()
+	defer s.tcpMu.Unlock()
+	if s.closed {
+		return nil
+	}
+	settings := freshSettings(s.store)
+	cfg := settings.Frontend
+	origins, originErr := cfg.origins()
+	s.origins.Store(&origins)
+	limits, limitsErr := cfg.limits()
+	s.limits.configure(limits, settings.FrontendCredentials)
+	originErr = errors.Join(originErr, limitsErr)
+	desired := cfg.tcp()
+
+	if !desired.Enabled {
+		s.stopTCPLocked("settings no longer enable it")
+		return s.reportTCPLocked("", originErr)
+	}
+	if err := desired.validate(); err != nil {
+		s.stopTCPLocked("its settings are invalid")
+		return s.reportTCPLocked(desired.Listen, errors.Join(err, originErr))
+	}
+	if s.tcp != nil && s.tcp.cfg == desired {
+		return s.reportTCPLocked(desired.Listen, originErr)
+	}
+
+	next, err := s.bindTCP(desired)
+	if err != nil {
+		return s.reportTCPLocked(desired.Listen, errors.Join(err, originErr))
+	}
+	old := s.tcp
+	s.tcp = next
+	go func() {
+		if err := next.server.Serve(next.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("frontend TCP listener exited with error", "addr", next.ln.Addr().String(), "error", err)
+		}
+	}()
+	slog.Info("frontend TCP listener started", "addr", next.ln.Addr().String(), "tls", desired.TLS)
+	if old != nil {
+		go old.shutdown(context.Background())
+		slog.Warn("frontend TCP listener moved",
+			"from", old.cfg.Listen, "to", next.ln.Addr().String())
+	}
+	return s.reportTCPLocked(desired.Listen, originErr)
+}
+
+// bindTCP opens a listener for cfg serving the frontend handler.
+func (s *FrontendServer) bindTCP(cfg resolvedFrontendTCP) (*frontendTCP, error) {
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("frontend TCP listener: listen on %s: %w", cfg.Listen, err)
+	}
+	if cfg.TLS {
+		ca, err := LoadOrCreateCA()
+		if err != nil {
+			_ = ln.Close()
+			return nil, fmt.Errorf("frontend TCP listener: %w", err)
+		}
+		cert, err := ca.IssueServerCert(remoteCertHosts(cfg.Listen)...)
+		if err != nil {
+			_ = ln.Close()
+			return nil, fmt.Errorf("frontend TCP listener: %w", err)
+		}
+		// TLS 1.2 rather than the remote listener's 1.3: the clients here
+		// are browsers and phones, not a peer relay ships.
+		ln = tls.NewListener(ln, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+	}
+	handler := withListenerOrigins(listenerOrigins(cfg, ln.Addr()), s.handler)
+	return &frontendTCP{cfg: cfg, ln: ln, server: newFrontendHTTPServer(handler)}, nil
+}
+
+// TCPAddr returns the address the TCP listener is bound to, or "" when
+// there is none.
+func (s *FrontendServer) TCPAddr() string {
+	if s == nil {
+		return ""
+	}
+	s.tcpMu.Lock()
+	defer s.tcpMu.Unlock()
+	if s.tcp == nil {
+		return ""
+	}
+	return s.tcp.ln.Addr().String()
+}
+
+// allowedOrigins returns the allowlist as of the last Reconcile.
+func (s *FrontendServer) allowedOrigins() []string {
+	if p := s.origins.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// stopTCPLocked closes the TCP listener, if any, in the background.
+// Caller holds s.tcpMu.
+func (s *FrontendServer) stopTCPLocked(why string) {
+	if s.tcp == nil {
+		return
+	}
+	old := s.tcp
+	s.tcp = nil
+	_ = old.ln.Close()
+	go old.shutdown(context.Background())
+	slog.Warn("frontend TCP listener stopped", "addr", old.cfg.Listen, "reason", why)
+}
+
+// reportTCPLocked logs err once per distinct (address, error) and returns
+// it, so a two-second poll doesn't repeat a steady failure at error level.
+// Caller holds s.tcpMu.
+func (s *FrontendServer) reportTCPLocked(addr string, err error) error {
+	key := addr
+	if err != nil {
+		key += "\x00" + err.Error()
+	}
+	repeat := key == s.lastTCPReport
+	s.lastTCPReport = key
+	if err == nil {
+		return nil
+	}
+	if repeat {
+		slog.Debug("frontend TCP listener still misconfigured", "listen", addr, "error", err)
+	} else {
+		slog.Error("frontend TCP listener misconfigured", "listen", addr, "error", err)
+	}
+	return err
+}
+
+// shutdown drains the listener's requests for up to five seconds (less if
+// ctx ends sooner), then closes the connections still open.
+func (t *frontendTCP) shutdown(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := t.server.Shutdown(ctx); err != nil {
+		_ = t.server.Close()
+	}
+	_ = t.ln.Close()
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Tests for the frontend's optional TCP listener (frontend_tcp.go): config
+// resolution, reconcile open/move/close, TLS from relay's CA, CORS and the
+// WebSocket Origin check.
+
+// startTCPFrontend brings up a FrontendServer with token "good-token" over
+// the given registry and enables its TCP listener with cfg. Returns the
+// server; its TCP address is srv.TCPAddr().
+func startTCPFrontend(t *testing.T, enhanced *EnhancedServiceRegistry, cfg *FrontendConfig) *FrontendServer {
+	t.Helper()
+	sock := filepath.Join(mkShortTempDir(t, "fe-tcp-"), "frontend.sock")
+	store := NewSettingsStoreAt(mkEmptySandboxRelayHome(t))
+	assertNoErr(t, store.EnsureInitialized(), "EnsureInitialized")
+	assertNoErr(t, store.With(func(s *Settings) { s.Frontend = cfg }), "set frontend")
+	extMgr := NewExternalMcpManager(nil)
+	srv, err := NewFrontendServer(store, extMgr, extMgr, Endpoint{Socket: sock, Token: "good-token"}, enhanced, nil, nil, nil, nil)
+	assertNoErr(t, err, "NewFrontendServer")
+	go func() { _ = srv.Serve() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	assertNoErr(t, srv.Reconcile(), "Reconcile")
+	return srv
+}
+
+func tcpEnabled(listen string, tls bool) *FrontendTCPConfig {
+	on := true
+	return &FrontendTCPConfig{Enabled: &on, Listen: listen, TLS: tls}
+}
+
+func getStatus(t *testing.T, c *http.Client, method, url string, hdr http.Header) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	resp, err := c.Do(req)
+	assertNoErr(t, err, method+" "+url)
+	resp.Body.Close()
+	return resp
+}
+
+func TestFrontendConfig_Resolve(t *testing.T) {
+	var nilCfg *FrontendConfig
+	if got := nilCfg.tcp(); got.Enabled || got.Listen != defaultFrontendListen {
+		t.Errorf("absent block = %+v, want disabled on %s", got, defaultFrontendListen)
+	}
+	if got := (&FrontendConfig{TCP: &FrontendTCPConfig{Listen: "127.0.0.1:1"}}).tcp(); got.Enabled {
+		t.Error("a tcp block without enabled must stay disabled")
+	}
+
+	for _, tc := range []struct {
+		listen string
+		tls    bool
+		ok     bool
+	}{
+		{"127.0.0.1:9920", false, true},
+		{"[::1]:9920", false, true},
+		{"localhost:9920", false, true},
+		{"0.0.0.0:9920", false, false},
+		{":9920", false, false},
+		{"192.168.1.5:9920", false, false},
+		{"0.0.0.0:9920", true, true},
+		{"no-port", true, false},
+	} {
+		err := resolvedFrontendTCP{Enabled: true, Listen: tc.listen, TLS: tc.tls}.validate()
+		if (err == nil) != tc.ok {
+			t.Errorf("validate(%s, tls=%v) = %v, want ok=%v", tc.listen, tc.tls, err, tc.ok)
+		}
+	}
+
+	got, err := (&FrontendConfig{AllowedOrigins: []string{
+		"http://Localhost:5173/", "https://app.example", "*", "ftp://x", "http://x/path", "nonsense",
+	}}).origins()
+	want := []string{"http://localhost:5173", "https://app.example", "*"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("origins = %v, want %v", got, want)
+	}
+	if err == nil || !strings.Contains(err.Error(), "ftp://x") || !strings.Contains(err.Error(), "nonsense") {
+		t.Errorf("origins error = %v, want one naming each invalid entry", err)
+	}
+}
+
+func TestFrontendServer_TCPListener_FollowsSettings(t *testing.T) {
+	srv := startTCPFrontend(t, NewEnhancedServiceRegistry(nil), nil)
+	if addr := srv.TCPAddr(); addr != "" {
+		t.Fatalf("TCP listener open without a frontend block: %s", addr)
+	}
+
+	assertNoErr(t, srv.store.With(func(s *Settings) {
+		s.Frontend = &FrontendConfig{TCP: tcpEnabled("127.0.0.1:0", false)}
+	}), "enable")
+	assertNoErr(t, srv.Reconcile(), "Reconcile")
+	addr := srv.TCPAddr()
+	if addr == "" {
+		t.Fatal("no TCP listener after enabling it")
+	}
+	c := &http.Client{Timeout: 2 * time.Second}
+	if resp := getStatus(t, c, "GET", "http://"+addr+"/nope", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token over TCP = %d, want 401", resp.StatusCode)
+	}
+	authed := http.Header{"Authorization": {"Bearer good-token"}}
+	if resp := getStatus(t, c, "GET", "http://"+addr+"/nope", authed); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("token over TCP = %d, want 404 from the dispatcher", resp.StatusCode)
+	}
+
+	// Unchanged settings leave the listener alone.
+	assertNoErr(t, srv.Reconcile(), "Reconcile again")
+	if srv.TCPAddr() != addr {
+		t.Errorf("unchanged reconcile rebound the listener: %s -> %s", addr, srv.TCPAddr())
+	}
+
+	// Beyond loopback without TLS is refused, and closes the listener.
+	assertNoErr(t, srv.store.With(func(s *Settings) { s.Frontend.TCP.Listen = "0.0.0.0:0" }), "widen")
+	if err := srv.Reconcile(); err == nil || !strings.Contains(err.Error(), "tls") {
+		t.Errorf("Reconcile on 0.0.0.0 without tls = %v, want a refusal naming tls", err)
+	}
+	if srv.TCPAddr() != "" {
+		t.Error("listener still open after its settings became invalid")
+	}
+
+	assertNoErr(t, srv.store.With(func(s *Settings) { s.Frontend = nil }), "disable")
+	assertNoErr(t, srv.Reconcile(), "Reconcile disabled")
+	if srv.TCPAddr() != "" {
+		t.Error("listener still open after the frontend block was removed")
+	}
+	if _, err := c.Get("http://" + addr + "/nope"); err == nil {
+		t.Error("old address still answers after the listener was closed")
+	}
+}
+
+func TestFrontendServer_TCPListener_TLS(t *testing.T) {
+	srv := startTCPFrontend(t, NewEnhancedServiceRegistry(nil), &FrontendConfig{TCP: tcpEnabled("127.0.0.1:0", true)})
+	addr := srv.TCPAddr()
+	if addr == "" {
+		t.Fatal("no TLS listener")
+	}
+	ca, err := LoadOrCreateCA()
+	assertNoErr(t, err, "LoadOrCreateCA")
+	c := &http.Client{Timeout: 2 * time.Second, Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: ca.Pool()},
+	}}
+	authed := http.Header{"Authorization": {"Bearer good-token"}}
+	if resp := getStatus(t, c, "GET", "https://"+addr+"/nope", authed); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("over TLS = %d, want 404", resp.StatusCode)
+	}
+	// Plain HTTP to a TLS listener gets no frontend response.
+	if resp, err := (&http.Client{Timeout: 2 * time.Second}).Get("http://" + addr + "/nope"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("plain HTTP to the TLS listener = %d", resp.StatusCode)
+		}
+	}
+}
+
+func TestFrontendServer_CORS(t *testing.T) {
+	srv := startTCPFrontend(t, NewEnhancedServiceRegistry(nil), &FrontendConfig{
+		TCP:            tcpEnabled("127.0.0.1:0", false),
+		AllowedOrigins: []string{"http://localhost:5173"},
+	})
+	base := "http://" + srv.TCPAddr()
+	c := &http.Client{Timeout: 2 * time.Second}
+
+	preflight := http.Header{"Origin": {"http://localhost:5173"}, "Access-Control-Request-Method": {"POST"}}
+	resp := getStatus(t, c, "OPTIONS", base+"/api/projects", preflight)
+	if resp.StatusCode != http.StatusNoContent ||
+		resp.Header.Get("Access-Control-Allow-Origin") != "http://localhost:5173" ||
+		!strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "Authorization") ||
+		!strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "X-Request-ID") {
+		t.Errorf("allowed preflight = %d %v", resp.StatusCode, resp.Header)
+	}
+
+	preflight.Set("Origin", "http://evil.example")
+	resp = getStatus(t, c, "OPTIONS", base+"/api/projects", preflight)
+	if resp.StatusCode != http.StatusForbidden || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed preflight = %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// Actual requests: auth still applies; CORS headers only for the allowlist.
+	hdr := http.Header{"Origin": {"http://localhost:5173"}, "Authorization": {"Bearer good-token"}}
+	resp = getStatus(t, c, "GET", base+"/nope", hdr)
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get("Access-Control-Allow-Origin") != "http://localhost:5173" {
+		t.Errorf("allowed GET = %d, ACAO %q", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+	if got := resp.Header.Get("Access-Control-Expose-Headers"); got != "X-Request-ID" || resp.Header.Get("X-Request-ID") == "" {
+		t.Errorf("allowed GET exposes %q (X-Request-ID %q), want the request ID readable", got, resp.Header.Get("X-Request-ID"))
+	}
+	hdr.Del("Authorization")
+	if resp = getStatus(t, c, "GET", base+"/nope", hdr); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("allowed origin without token = %d, want 401", resp.StatusCode)
+	}
+	hdr = http.Header{"Origin": {"http://evil.example"}, "Authorization": {"Bearer good-token"}}
+	if resp = getStatus(t, c, "GET", base+"/nope", hdr); resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed origin got ACAO %q", resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestFrontendServer_WSUpgrade_ChecksOrigin(t *testing.T) {
+	enhanced := NewEnhancedServiceRegistry(nil)
+	fake := echoWSService(t)
+	assertNoErr(t, enhanced.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "RegisterManifest")
+	srv := startTCPFrontend(t, enhanced, &FrontendConfig{
+		TCP:            tcpEnabled("127.0.0.1:0", false),
+		AllowedOrigins: []string{"http://localhost:5173"},
+	})
+	addr := srv.TCPAddr()
+	_, port, _ := net.SplitHostPort(addr)
+	dialer := &websocket.Dialer{HandshakeTimeout: 2 * time.Second}
+
+	for _, tc := range []struct {
+		origin string
+		host   string // Host header, when not addr
+		ok     bool
+	}{
+		{"", "", true},
+		{"http://" + addr, "", true},
+		{"http://localhost:" + port, "", true},
+		{"http://localhost:5173", "", true},
+		{"http://evil.example", "", false},
+		// DNS rebinding: the page's name now resolves to 127.0.0.1, so
+		// its Host matches its Origin. Neither is the listener's.
+		{"http://rebind.example:" + port, "rebind.example:" + port, false},
+	} {
+		hdr := http.Header{"Authorization": {"Bearer good-token"}}
+		if tc.origin != "" {
+			hdr.Set("Origin", tc.origin)
+		}
+		if tc.host != "" {
+			hdr.Set("Host", tc.host)
+		}
+		conn, resp, err := dialer.Dial("ws://"+addr+"/ws", hdr)
+		if tc.ok {
+			if err != nil {
+				t.Errorf("origin %q: dial failed: %v", tc.origin, err)
+				continue
+			}
+			conn.Close()
+			continue
+		}
+		if err == nil {
+			conn.Close()
+			t.Errorf("origin %q: upgrade accepted", tc.origin)
+		} else if resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("origin %q: want 403, got %v", tc.origin, resp)
+		}
+	}
+
+	upgrades := 0
+	for _, rq := range fake.Requests() {
+		if rq.WasWebSocket {
+			upgrades++
+		}
+	}
+	if upgrades != 4 {
+		t.Errorf("upstream saw %d upgrades, want 4 (the refused origins must not reach it)", upgrades)
+	}
+}
+
+func TestListenerOrigins(t *testing.T) {
+	addr := func(s string) net.Addr {
+		a, err := net.ResolveTCPAddr("tcp", s)
+		assertNoErr(t, err, "ResolveTCPAddr")
+		return a
+	}
+	for _, tc := range []struct {
+		name    string
+		cfg     resolvedFrontendTCP
+		bound   string
+		want    []string
+		wantNot []string
+	}{
+		{
+			name:    "loopback",
+			cfg:     resolvedFrontendTCP{Listen: "127.0.0.1:0"},
+			bound:   "127.0.0.1:9920",
+			want:    []string{"http://127.0.0.1:9920", "http://localhost:9920", "http://[::1]:9920"},
+			wantNot: []string{"https://localhost:9920", "http://localhost"},
+		},
+		{
+			name:    "TLS on a named host",
+			cfg:     resolvedFrontendTCP{Listen: "relay.lan:8443", TLS: true},
+			bound:   "192.168.1.5:8443",
+			want:    []string{"https://relay.lan:8443", "https://localhost:8443"},
+			wantNot: []string{"http://relay.lan:8443", "https://192.168.1.5:8443"},
+		},
+		{
+			name:  "default port is left out",
+			cfg:   resolvedFrontendTCP{Listen: "127.0.0.1:443", TLS: true},
+			bound: "127.0.0.1:443",
+			want:  []string{"https://localhost", "https://[::1]", "https://localhost:443"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := listenerOrigins(tc.cfg, addr(tc.bound))
+			for _, o := range tc.want {
+				if !slices.Contains(got, o) {
+					t.Errorf("missing %s in %v", o, got)
+				}
+			}
+			for _, o := range tc.wantNot {
+				if slices.Contains(got, o) {
+					t.Errorf("unexpected %s in %v", o, got)
+				}
+			}
+		})
+	}
+}
+
+// The front door owns CORS, so a service's own Access-Control-* headers
+// must not be copied through next to relay's.
+func TestFrontendServer_StripsUpstreamCORS(t *testing.T) {
+	enhanced := NewEnhancedServiceRegistry(nil)
+	fake := NewFakeService(t, FakeServiceOptions{
+		ServiceID: "svc-cors",
+		Manifest:  newManifest("/api/cors"),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.WriteHeader(http.StatusOK)
+		}),
+	})
+	assertNoErr(t, enhanced.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "RegisterManifest")
+	srv := startTCPFrontend(t, enhanced, &FrontendConfig{
+		TCP:            tcpEnabled("127.0.0.1:0", false),
+		AllowedOrigins: []string{"http://localhost:5173"},
+	})
+	hdr := http.Header{"Origin": {"http://localhost:5173"}, "Authorization": {"Bearer good-token"}}
+	resp := getStatus(t, &http.Client{Timeout: 2 * time.Second}, "GET", "http://"+srv.TCPAddr()+"/api/cors", hdr)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if got := resp.Header.Values("Access-Control-Allow-Origin"); len(got) != 1 || got[0] != "http://localhost:5173" {
+		t.Errorf("ACAO = %v, want relay's single value", got)
+	}
+	if resp.Header.Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("upstream Access-Control-Allow-Credentials was copied through")
+	}
+}
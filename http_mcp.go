@@ -20,6 +20,24 @@ import (
 // ErrAuthRequired indicates the HTTP MCP server returned 401.
 var ErrAuthRequired = errors.New("authentication required (HTTP 401)")
 
+// McpAuthState is the OAuth lifecycle of one HTTP MCP connection, surfaced in
+// the settings UI and `relay mcp list`. A connection starts authenticated if
+// it was handed a stored access token, none otherwise. Each refresh passes
+// through refreshing and settles back to authenticated — or to needs_reauth
+// when the provider rejects the grant, or when a token that was just minted
+// still gets a 401. needs_reauth is terminal for a connection: retrying can't
+// help, so requests fail fast. Re-authenticating replaces the connection,
+// which starts over. Transitions happen under httpMcpConn.tokenMu so the
+// observer sees them in order.
+type McpAuthState string
+
+const (
+	McpAuthNone          McpAuthState = "none"          // no credentials held
+	McpAuthAuthenticated McpAuthState = "authenticated" // access token believed valid
+	McpAuthRefreshing    McpAuthState = "refreshing"    // refresh in flight; requests queue
+	McpAuthNeedsReauth   McpAuthState = "needs_reauth"  // grant rejected; user must sign in again
+)
+
 // httpOAuth holds runtime OAuth token state for an HTTP MCP connection.
 // All fields must be read/written under httpMcpConn.mu.
 type httpOAuth struct {
@@ -58,14 +76,25 @@ type httpMcpConn struct {
 	url        string
 	sessionID  string
 	httpClient *http.Client
-	mu         sync.Mutex // protects sessionID and all oauth fields
+	mu         sync.Mutex // protects sessionID, authState, refreshDone and all oauth fields
 	tokenMu    sync.Mutex // serializes refresh operations (separate so non-refresh requests don't block on I/O)
 	closeOnce  sync.Once  // ensures Close is idempotent
 
 	oauth httpOAuth
 
+	// authState is the current McpAuthState. refreshDone is non-nil exactly
+	// while a refresh is in flight and is closed when it settles, so
+	// awaitRefresh can park callers on it instead of on tokenMu (which has no
+	// timeout and isn't context-aware).
+	authState   McpAuthState
+	refreshDone chan struct{}
+
 	// Callback to persist refreshed tokens. Injected by ExternalMcpManager.
 	onTokenRefresh func(oauth *OAuthState)
+
+	// Callback on every authState transition. Injected by ExternalMcpManager;
+	// invoked with tokenMu held (so calls arrive in order) but not mu.
+	onAuthStateChange func(state McpAuthState)
 }
 
 // sessionSnapshot holds pre-snapshotted OAuth and session state,
@@ -97,6 +126,7 @@ func newHTTPMcpConn(cfg ExternalMcp) *httpMcpConn {
 	conn.config = cfg
 
 	conn.oauth.url = cfg.URL
+	conn.authState = McpAuthNone
 
 	if cfg.OAuthState != nil {
 		conn.oauth.accessToken = cfg.OAuthState.AccessToken
@@ -108,11 +138,111 @@ func newHTTPMcpConn(cfg ExternalMcp) *httpMcpConn {
 				conn.oauth.tokenExpiry = t
 			}
 		}
+		if conn.oauth.accessToken != "" {
+			conn.authState = McpAuthAuthenticated
+		}
 	}
 
 	return conn
 }
 
+// AuthState reports the connection's current McpAuthState.
+func (c *httpMcpConn) AuthState() McpAuthState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authState
+}
+
+// setAuthStateLocked records a transition and returns whether it changed
+// anything. Caller holds tokenMu and mu; notify the observer after dropping mu.
+func (c *httpMcpConn) setAuthStateLocked(state McpAuthState) bool {
+	if c.authState == state {
+		return false
+	}
+	c.authState = state
+	return true
+}
+
+// notifyAuthState fires the observer callback. Caller holds tokenMu, not mu.
+func (c *httpMcpConn) notifyAuthState(state McpAuthState) {
+	if c.onAuthStateChange != nil {
+		c.onAuthStateChange(state)
+	}
+}
+
+// beginRefresh moves the connection into refreshing and opens the gate other
+// callers queue on. Caller holds tokenMu.
+func (c *httpMcpConn) beginRefresh() {
+	c.mu.Lock()
+	c.refreshDone = make(chan struct{})
+	changed := c.setAuthStateLocked(McpAuthRefreshing)
+	c.mu.Unlock()
+	if changed {
+		c.notifyAuthState(McpAuthRefreshing)
+	}
+}
+
+// endRefresh settles an in-flight refresh into state and releases queued
+// callers. Caller holds tokenMu.
+func (c *httpMcpConn) endRefresh(state McpAuthState) {
+	c.mu.Lock()
+	if c.refreshDone != nil {
+		close(c.refreshDone)
+		c.refreshDone = nil
+	}
+	changed := c.setAuthStateLocked(state)
+	c.mu.Unlock()
+	if changed {
+		c.notifyAuthState(state)
+	}
+}
+
+// markNeedsReauth parks the connection in needs_reauth outside a refresh
+// (a 401 with nothing to refresh, or a 401 on a token that was just minted).
+// Caller holds tokenMu.
+func (c *httpMcpConn) markNeedsReauth() {
+	c.mu.Lock()
+	changed := c.setAuthStateLocked(McpAuthNeedsReauth)
+	c.mu.Unlock()
+	if changed {
+		slog.Warn("HTTP MCP: OAuth credentials rejected; re-authentication required", "id", c.config.ID)
+		c.notifyAuthState(McpAuthNeedsReauth)
+	}
+}
+
+// awaitRefresh gates a request on the auth state. A connection in
+// needs_reauth fails fast with ErrAuthRequired — the provider has already
+// said no, and sending the request would just collect another 401. A
+// connection mid-refresh queues the caller until the refresh settles, bounded
+// by OAuthRefreshQueueTimeout and ctx, so a burst of tool calls that lands
+// during a refresh waits a moment and then uses the new token instead of
+// failing or stampeding the token endpoint.
+func (c *httpMcpConn) awaitRefresh(ctx context.Context) error {
+	c.mu.Lock()
+	state, done := c.authState, c.refreshDone
+	c.mu.Unlock()
+	if state == McpAuthNeedsReauth {
+		return ErrAuthRequired
+	}
+	if done == nil {
+		return nil
+	}
+
+	timer := time.NewTimer(OAuthRefreshQueueTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		return fmt.Errorf("timed out after %s waiting for OAuth token refresh", OAuthRefreshQueueTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if c.AuthState() == McpAuthNeedsReauth {
+		return ErrAuthRequired
+	}
+	return nil
+}
+
 // tokenRefreshSnap holds values snapshotted under mu for a token refresh.
 type tokenRefreshSnap struct {
 	meta         *oauthMetadata
@@ -123,6 +253,18 @@ type tokenRefreshSnap struct {
 	tokenExpiry  time.Time
 }
 
+// refreshSnapLocked copies the fields a refresh needs. Caller holds mu.
+func (c *httpMcpConn) refreshSnapLocked() tokenRefreshSnap {
+	return tokenRefreshSnap{
+		meta:         c.oauth.meta,
+		refreshToken: c.oauth.refreshToken,
+		clientID:     c.oauth.clientID,
+		clientSecret: c.oauth.clientSecret,
+		oauthURL:     c.oauth.url,
+		tokenExpiry:  c.oauth.tokenExpiry,
+	}
+}
+
 // tokenRefreshSnapshot reads OAuth state under mu and returns whether a refresh
 // is needed. All lock/unlock is handled via defer.
 func (c *httpMcpConn) tokenRefreshSnapshot() (tokenRefreshSnap, bool) {
@@ -134,14 +276,7 @@ func (c *httpMcpConn) tokenRefreshSnapshot() (tokenRefreshSnap, bool) {
 	if !needsRefresh {
 		return tokenRefreshSnap{}, false
 	}
-	return tokenRefreshSnap{
-		meta:         c.oauth.meta,
-		refreshToken: c.oauth.refreshToken,
-		clientID:     c.oauth.clientID,
-		clientSecret: c.oauth.clientSecret,
-		oauthURL:     c.oauth.url,
-		tokenExpiry:  c.oauth.tokenExpiry,
-	}, true
+	return c.refreshSnapLocked(), true
 }
 
 // applyRefreshedToken writes refreshed OAuth state under mu and notifies the
@@ -170,39 +305,21 @@ func (c *httpMcpConn) applyRefreshedToken(meta *oauthMetadata, tokenResp *oauthT
 	}
 }
 
-// refreshTokenIfNeeded checks token expiry and refreshes if within the refresh
-// window. Uses tokenMu to serialize refresh operations and mu to synchronize
-// token field access with concurrent SendRequest calls. Network I/O happens
-// without holding mu.
-func (c *httpMcpConn) refreshTokenIfNeeded() error {
-	c.tokenMu.Lock()
-	defer c.tokenMu.Unlock()
-
-	snap, needsRefresh := c.tokenRefreshSnapshot()
-	if !needsRefresh {
-		return nil
-	}
-
-	// stillValid reports whether the current access token has not yet expired.
-	// Refresh fires OAuthTokenRefreshWindow *before* expiry, so a transient
-	// refresh failure inside that window shouldn't fail the call — the existing
-	// token still works. Only hard-fail once the token is actually expired.
-	stillValid := func(err error) bool {
-		if !snap.tokenExpiry.IsZero() && time.Now().Before(snap.tokenExpiry) {
-			slog.Warn("OAuth proactive refresh failed; proceeding with still-valid token", "url", snap.oauthURL, "error", err)
-			return true
-		}
-		return false
-	}
+// runRefresh performs one refresh round-trip and drives the auth state
+// through refreshing to its outcome: authenticated on success, needs_reauth
+// when the provider rejects the grant, and back to authenticated on a
+// transient failure (the next call will try again). Caller holds tokenMu.
+// Network I/O happens without holding mu.
+func (c *httpMcpConn) runRefresh(snap tokenRefreshSnap) error {
+	c.beginRefresh()
+	settled := McpAuthAuthenticated
+	defer func() { c.endRefresh(settled) }()
 
 	// Discover metadata if needed (network I/O, no locks held).
 	meta := snap.meta
 	if meta == nil {
 		discovery, err := discoverOAuth(snap.oauthURL)
 		if err != nil {
-			if stillValid(err) {
-				return nil
-			}
 			return fmt.Errorf("discover OAuth metadata for refresh: %w", err)
 		}
 		meta = discovery.Metadata
@@ -211,8 +328,10 @@ func (c *httpMcpConn) refreshTokenIfNeeded() error {
 	// Refresh token (network I/O, no locks held).
 	tokenResp, err := refreshAccessToken(meta, snap.refreshToken, snap.clientID, snap.clientSecret)
 	if err != nil {
-		if stillValid(err) {
-			return nil
+		if isGrantRejected(err) {
+			settled = McpAuthNeedsReauth
+			slog.Warn("HTTP MCP: refresh token rejected; re-authentication required", "url", snap.oauthURL, "error", err)
+			return ErrAuthRequired
 		}
 		return fmt.Errorf("token refresh: %w", err)
 	}
@@ -221,6 +340,59 @@ func (c *httpMcpConn) refreshTokenIfNeeded() error {
 	return nil
 }
 
+// refreshTokenIfNeeded checks token expiry and refreshes if within the refresh
+// window. Uses tokenMu to serialize refresh operations and mu to synchronize
+// token field access with concurrent SendRequest calls.
+func (c *httpMcpConn) refreshTokenIfNeeded() error {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	snap, needsRefresh := c.tokenRefreshSnapshot()
+	if !needsRefresh {
+		return nil
+	}
+
+	err := c.runRefresh(snap)
+	if err == nil || errors.Is(err, ErrAuthRequired) {
+		return err
+	}
+	// Refresh fires OAuthTokenRefreshWindow *before* expiry, so a transient
+	// refresh failure inside that window shouldn't fail the call — the existing
+	// token still works. Only hard-fail once the token is actually expired.
+	if !snap.tokenExpiry.IsZero() && time.Now().Before(snap.tokenExpiry) {
+		slog.Warn("OAuth proactive refresh failed; proceeding with still-valid token", "url", snap.oauthURL, "error", err)
+		return nil
+	}
+	return err
+}
+
+// refreshAfterUnauthorized handles a 401 on a request sent with usedToken.
+// Returns nil when the caller should retry (a refresh succeeded, or another
+// caller already replaced the token while this request was in flight), and
+// ErrAuthRequired when there is nothing left to try. A server that 401s with
+// no credentials ever held stays in none — that's "not signed in yet", not a
+// revoked grant.
+func (c *httpMcpConn) refreshAfterUnauthorized(usedToken string) error {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+
+	c.mu.Lock()
+	current := c.oauth.accessToken
+	snap := c.refreshSnapLocked()
+	c.mu.Unlock()
+
+	if current != usedToken {
+		return nil
+	}
+	if snap.refreshToken == "" {
+		if usedToken != "" {
+			c.markNeedsReauth()
+		}
+		return ErrAuthRequired
+	}
+	return c.runRefresh(snap)
+}
+
 // setHeaders applies common headers using pre-snapshotted session state,
 // avoiding the need to hold a lock during HTTP I/O.
 func (c *httpMcpConn) setHeaders(req *http.Request, snap sessionSnapshot) {
@@ -243,35 +415,68 @@ func (c *httpMcpConn) SendRequest(ctx context.Context, method string, params int
 	ctx, cancel := context.WithTimeout(ctx, MCPRequestTimeout)
 	defer cancel()
 
+	if err := c.awaitRefresh(ctx); err != nil {
+		return nil, err
+	}
+
 	// Refresh token outside the request lock to avoid blocking other requests.
 	if err := c.refreshTokenIfNeeded(); err != nil {
 		return nil, err
 	}
 
+	result, usedToken, err := c.sendOnce(ctx, method, params)
+	if !errors.Is(err, ErrAuthRequired) {
+		return result, err
+	}
+
+	// 401: the token may have been revoked or expired early (no expires_in, a
+	// clock skew, a server-side rotation). Refresh once and retry once; a
+	// second 401 on a token we just minted means the grant itself is bad.
+	if err := c.refreshAfterUnauthorized(usedToken); err != nil {
+		return nil, err
+	}
+	result, retriedToken, err := c.sendOnce(ctx, method, params)
+	if errors.Is(err, ErrAuthRequired) && retriedToken != "" {
+		c.tokenMu.Lock()
+		c.markNeedsReauth()
+		c.tokenMu.Unlock()
+	}
+	return result, err
+}
+
+// sendOnce performs a single JSON-RPC POST. It reports the access token the
+// request carried so a 401 can be matched against the token that earned it.
+func (c *httpMcpConn) sendOnce(ctx context.Context, method string, params interface{}) (json.RawMessage, string, error) {
 	id := c.allocID()
 	body, err := json.Marshal(jsonrpc.NewRequest(id, method, params))
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	snap := c.snapshot()
 
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("create HTTP request: %w", err)
+		return nil, snap.accessToken, fmt.Errorf("create HTTP request: %w", err)
 	}
 	c.setHeaders(httpReq, snap)
 	httpReq.Header.Set("Accept", "application/json, text/event-stream")
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return nil, snap.accessToken, fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusUnauthorized {
-		return nil, ErrAuthRequired
+		return nil, snap.accessToken, ErrAuthRequired
 	}
+	result, err := c.readResponse(resp, method, id)
+	return result, snap.accessToken, err
+}
+
+// readResponse decodes a non-401 reply to request id.
+func (c *httpMcpConn) readResponse(resp *http.Response, method string, id int64) (json.RawMessage, error) {
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
 		return nil, fmt.Errorf("HTTP MCP %s: HTTP %d: %s", method, resp.StatusCode, string(respBody))
@@ -457,6 +662,12 @@ func (m *ExternalMcpManager) startHTTP(ctx context.Context, mcpCfg *ExternalMcp)
 			m.onTokenRefresh(id, oauth)
 		}
 	}
+	if m.OnAuthStateChange != nil {
+		id := mcpCfg.ID
+		conn.onAuthStateChange = func(state McpAuthState) {
+			m.OnAuthStateChange(id, state)
+		}
+	}
 
 	result, err := mcpHandshake(ctx, conn)
 	if err != nil {
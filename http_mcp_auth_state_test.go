@@ -0,0 +1,234 @@
+package main
+
+// Coverage for the HTTP-MCP auth state machine: reactive refresh on a 401,
+// needs_reauth on a rejected grant (and fail-fast afterwards), and queueing
+// of concurrent requests behind an in-flight refresh.
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenGatedMCP answers 401 unless the request carries "Bearer <valid>", and
+// counts every request it sees.
+func tokenGatedMCP(t *testing.T, valid string, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"jsonrpc":"2.0","id":1,"result":{"ok":true}}`)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// recordAuthStates captures every transition the connection reports.
+func recordAuthStates(conn *httpMcpConn) func() []McpAuthState {
+	var mu sync.Mutex
+	var seen []McpAuthState
+	conn.onAuthStateChange = func(s McpAuthState) {
+		mu.Lock()
+		seen = append(seen, s)
+		mu.Unlock()
+	}
+	return func() []McpAuthState {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]McpAuthState(nil), seen...)
+	}
+}
+
+func TestHTTPMcp_AuthState_InitialFromStoredCredentials(t *testing.T) {
+	if got := newHTTPMcpConn(ExternalMcp{ID: "x", Transport: "http", URL: "http://127.0.0.1"}).AuthState(); got != McpAuthNone {
+		t.Errorf("no credentials: state = %q, want none", got)
+	}
+	conn := newRefreshableConn("http://127.0.0.1", "http://127.0.0.1", time.Now().Add(time.Hour), "at")
+	if got := conn.AuthState(); got != McpAuthAuthenticated {
+		t.Errorf("stored access token: state = %q, want authenticated", got)
+	}
+}
+
+func TestHTTPMcp_401_RefreshesAndRetries(t *testing.T) {
+	tokenSrv := refreshTokenServer(t, 200, `{"access_token":"new-at","expires_in":3600}`)
+	var hits atomic.Int32
+	mcpSrv := tokenGatedMCP(t, "new-at", &hits)
+
+	// Expiry far out: no proactive refresh. The server has revoked old-at
+	// early, so only the 401 path can recover.
+	conn := newRefreshableConn(mcpSrv.URL, tokenSrv.URL, time.Now().Add(time.Hour), "old-at")
+	states := recordAuthStates(conn)
+
+	res, err := conn.SendRequest(context.Background(), "tools/list", nil)
+	if err != nil {
+		t.Fatalf("SendRequest should recover from a 401 by refreshing: %v", err)
+	}
+	if string(res) != `{"ok":true}` {
+		t.Errorf("result = %s", res)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("MCP saw %d requests, want 2 (401 then retry)", n)
+	}
+	if got := states(); len(got) != 2 || got[0] != McpAuthRefreshing || got[1] != McpAuthAuthenticated {
+		t.Errorf("transitions = %v, want [refreshing authenticated]", got)
+	}
+}
+
+func TestHTTPMcp_RejectedRefresh_NeedsReauthAndFailsFast(t *testing.T) {
+	tokenSrv := refreshTokenServer(t, 400, `{"error":"invalid_grant"}`)
+	var hits atomic.Int32
+	mcpSrv := tokenGatedMCP(t, "never", &hits)
+
+	conn := newRefreshableConn(mcpSrv.URL, tokenSrv.URL, time.Now().Add(time.Hour), "old-at")
+	states := recordAuthStates(conn)
+
+	if _, err := conn.SendRequest(context.Background(), "tools/list", nil); !errors.Is(err, ErrAuthRequired) {
+		t.Fatalf("err = %v, want ErrAuthRequired", err)
+	}
+	if got := conn.AuthState(); got != McpAuthNeedsReauth {
+		t.Fatalf("state = %q, want needs_reauth", got)
+	}
+	if got := states(); got[len(got)-1] != McpAuthNeedsReauth {
+		t.Errorf("last transition = %v, want needs_reauth", got)
+	}
+
+	// Subsequent calls must not touch the server: the grant is dead.
+	before := hits.Load()
+	if _, err := conn.SendRequest(context.Background(), "tools/list", nil); !errors.Is(err, ErrAuthRequired) {
+		t.Fatalf("second call err = %v, want ErrAuthRequired", err)
+	}
+	if hits.Load() != before {
+		t.Error("needs_reauth connection still sent a request to the MCP")
+	}
+}
+
+func TestHTTPMcp_TransientRefreshFailureAfter401_StaysAuthenticated(t *testing.T) {
+	tokenSrv := refreshTokenServer(t, 503, `{"error":"temporarily_unavailable"}`)
+	var hits atomic.Int32
+	mcpSrv := tokenGatedMCP(t, "never", &hits)
+
+	conn := newRefreshableConn(mcpSrv.URL, tokenSrv.URL, time.Now().Add(time.Hour), "old-at")
+	_, err := conn.SendRequest(context.Background(), "tools/list", nil)
+	if err == nil || errors.Is(err, ErrAuthRequired) {
+		t.Fatalf("err = %v, want the transient token-endpoint error", err)
+	}
+	if got := conn.AuthState(); got != McpAuthAuthenticated {
+		t.Errorf("state = %q, want authenticated (a 503 says nothing about the grant)", got)
+	}
+}
+
+func TestHTTPMcp_401WithoutRefreshToken(t *testing.T) {
+	var hits atomic.Int32
+	mcpSrv := tokenGatedMCP(t, "never", &hits)
+
+	conn := newHTTPMcpConn(ExternalMcp{
+		ID: "x", Transport: "http", URL: mcpSrv.URL,
+		OAuthState: &OAuthState{AccessToken: "at"},
+	})
+	if _, err := conn.SendRequest(context.Background(), "tools/list", nil); !errors.Is(err, ErrAuthRequired) {
+		t.Fatalf("err = %v, want ErrAuthRequired", err)
+	}
+	if got := conn.AuthState(); got != McpAuthNeedsReauth {
+		t.Errorf("state = %q, want needs_reauth (token rejected, nothing to refresh with)", got)
+	}
+}
+
+// blockingTokenServer holds every token request until release is closed and
+// counts how many arrived.
+func blockingTokenServer(t *testing.T, release <-chan struct{}, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"access_token":"new-at","expires_in":3600}`)
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// waitForAuthState polls until conn reports want or the deadline passes.
+func waitForAuthState(t *testing.T, conn *httpMcpConn, want McpAuthState) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for conn.AuthState() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("state never reached %q (now %q)", want, conn.AuthState())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHTTPMcp_RequestsQueueBehindRefresh(t *testing.T) {
+	release := make(chan struct{})
+	var tokenCalls, hits atomic.Int32
+	tokenSrv := blockingTokenServer(t, release, &tokenCalls)
+	mcpSrv := tokenGatedMCP(t, "new-at", &hits)
+
+	// Inside the refresh window: the first request starts a proactive refresh.
+	conn := newRefreshableConn(mcpSrv.URL, tokenSrv.URL, time.Now().Add(10*time.Second), "old-at")
+
+	errs := make(chan error, 3)
+	send := func() {
+		_, err := conn.SendRequest(context.Background(), "tools/list", nil)
+		errs <- err
+	}
+	go send()
+	waitForAuthState(t, conn, McpAuthRefreshing)
+	go send()
+	go send()
+
+	time.Sleep(50 * time.Millisecond) // let the followers park on the refresh
+	close(release)
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("queued request failed: %v", err)
+		}
+	}
+	if n := tokenCalls.Load(); n != 1 {
+		t.Errorf("token endpoint hit %d times, want 1 (followers must reuse the refresh)", n)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("MCP saw %d requests, want 3 (all with the new token, no 401 retries)", n)
+	}
+}
+
+func TestHTTPMcp_RefreshQueueTimeout(t *testing.T) {
+	orig := OAuthRefreshQueueTimeout
+	OAuthRefreshQueueTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { OAuthRefreshQueueTimeout = orig })
+
+	release := make(chan struct{})
+	var tokenCalls, hits atomic.Int32
+	tokenSrv := blockingTokenServer(t, release, &tokenCalls)
+	mcpSrv := tokenGatedMCP(t, "new-at", &hits)
+
+	conn := newRefreshableConn(mcpSrv.URL, tokenSrv.URL, time.Now().Add(10*time.Second), "old-at")
+	leader := make(chan error, 1)
+	go func() {
+		_, err := conn.SendRequest(context.Background(), "tools/list", nil)
+		leader <- err
+	}()
+	waitForAuthState(t, conn, McpAuthRefreshing)
+
+	_, err := conn.SendRequest(context.Background(), "tools/list", nil)
+	if err == nil || !strings.Contains(err.Error(), "waiting for OAuth token refresh") {
+		t.Errorf("follower err = %v, want a refresh-queue timeout", err)
+	}
+
+	close(release)
+	if err := <-leader; err != nil {
+		t.Errorf("leader request failed: %v", err)
+	}
+}
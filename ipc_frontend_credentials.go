@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Frontend Access tab IPC handlers — the Settings UI side of
+// `relay frontend-cred` (frontend_cred_cmd.go). Like ipc_enrolments.go, the
+// work is done by createFrontendCredential / revokeFrontendCredential, and
+// their errors are what the tab shows.
+//
+// The token is the one thing this surface hands the WebView that the CLI
+// would print: there is no other way to give it to the operator, and it
+// only exists at creation. The stored hash is sent along with the rest of
+// the record and is useless without the token.
+// ---------------------------------------------------------------------------
+
+const (
+	MsgCreateFrontendCredential = "create_frontend_credential"
+	MsgRevokeFrontendCredential = "revoke_frontend_credential"
+)
+
+// ipcFrontendCredentialNameMsg names one credential.
+type ipcFrontendCredentialNameMsg struct {
+	Name string `json:"name"`
+}
+
+// ipcCreateFrontendCredential creates a credential and emits it with its
+// token, once.
+func ipcCreateFrontendCredential(ctx *IPCContext, raw json.RawMessage) {
+	msg, ok := unmarshalIPC[frontendCredentialRequest](raw, MsgCreateFrontendCredential)
+	if !ok {
+		return
+	}
+	msg.Name = strings.TrimSpace(msg.Name)
+	if msg.Name == "" {
+		// Matches `relay frontend-cred create`'s "--name is required".
+		ctx.UI.EmitEvent("onFrontendCredentialError", "name is required")
+		return
+	}
+	cred, token, err := createFrontendCredential(ctx.Store, *msg)
+	if err != nil {
+		ctx.UI.EmitEvent("onFrontendCredentialError", err.Error())
+		return
+	}
+	ctx.UI.EmitEvent("onFrontendCredentialCreated", marshalForUI(cred), token)
+}
+
+// ipcRevokeFrontendCredential deletes a credential. The frontend server
+// notices on the credential's next request, and its open WebSocket sessions
+// within frontendCredentialRecheck, so there is no hook to fire here.
+func ipcRevokeFrontendCredential(ctx *IPCContext, raw json.RawMessage) {
+	msg, ok := unmarshalIPC[ipcFrontendCredentialNameMsg](raw, MsgRevokeFrontendCredential)
+	if !ok || msg.Name == "" {
+		return
+	}
+	removed, err := revokeFrontendCredential(ctx.Store, msg.Name)
+	if err != nil {
+		ctx.UI.EmitEvent("onFrontendCredentialError", err.Error())
+		return
+	}
+	ctx.UI.EmitEvent("onFrontendCredentialRevoked", removed.Name)
+}
@@ -14,7 +14,7 @@ import (
 
 func (a *App) openSettingsWindow() {
 	s := a.store.Get()
-	html := renderSettingsHTML(s, a.registry.RunningIDs(), a.buildToolCache(s))
+	html := renderSettingsHTML(s, a.registry.RunningIDs(), a.buildToolCache(s), a.extMgr.AuthStates())
 	a.platform.OpenSettings(html)
 	a.settingsOpen.Store(true)
 	// First paint shouldn't wait the full 2s poll interval. pushServiceStatusBatch
@@ -79,6 +79,9 @@ func (a *App) pushFullSettings() {
 		"running_ids":    a.registry.RunningIDs(),
 		"projects":       s.Projects,
 		"mcp_tool_cache": a.buildToolCache(s),
+		// Auth state is runtime-only like the tool cache; a reload after
+		// `relay mcp reset-credentials` must drop the badge back to "none".
+		"mcp_auth_states": a.extMgr.AuthStates(),
 		// Enrolments and the remote block ride along so the Remote Clients tab
 		// reflects an enrolment created or revoked by `relay enrol` while the
 		// window is open. The audit state comes from the live recorder rather
@@ -86,6 +89,8 @@ func (a *App) pushFullSettings() {
 		// same "remote is off" for the operator as one switched off on purpose.
 		"enrolments": s.Enrolments,
 		"remote":     remoteConfigViewOf(s, a.audit.Enabled()),
+		// Likewise the Frontend Access tab, for `relay frontend-cred`.
+		"frontend_credentials": s.FrontendCredentials,
 	})
 }
 
@@ -150,6 +155,9 @@ type IPCContext struct {
 	// Audit backs the Tool Calls tab. Nil when auditing is off; every method
 	// on the recorder is nil-safe, so handlers don't guard on it.
 	Audit *AuditRecorder
+	// Events receives the project events a settings edit implies
+	// (EventBus.ObserveProjects). nil publishes nothing.
+	Events *EventBus
 }
 
 // withSettingsReconcile atomically mutates settings, then asynchronously sends
@@ -178,6 +186,12 @@ func (ctx *IPCContext) withSettingsNotify(fn func(*Settings), notify func(string
 		ctx.UI.EmitEvent("onSettingsError", err.Error())
 		return false
 	}
+	// Most edits leave projects alone; ObserveProjects finds that out and
+	// publishes nothing, which beats every project handler remembering to
+	// call it.
+	if ctx.Events != nil {
+		ctx.Events.ObserveProjects(ctx.Store.Get().Projects)
+	}
 	if notify != nil {
 		ctx.GoFunc(func() {
 			if err := notify(secret); err != nil {
@@ -243,6 +257,7 @@ const (
 	MsgAuthenticateMcp     = "authenticate_mcp"
 	MsgRemoveExternalMcp   = "remove_external_mcp"
 	MsgResetMcpPermissions = "reset_mcp_permissions"
+	MsgResetMcpCredentials = "reset_mcp_credentials"
 
 	MsgAddService             = "add_service"
 	MsgRemoveService          = "remove_service"
@@ -277,6 +292,7 @@ var ipcHandlers = map[string]func(*IPCContext, json.RawMessage){
 	MsgAuthenticateMcp:     ipcAuthenticateMcp,
 	MsgRemoveExternalMcp:   ipcRemoveExternalMcp,
 	MsgResetMcpPermissions: ipcResetMcpPermissions,
+	MsgResetMcpCredentials: ipcResetMcpCredentials,
 
 	// Services (ipc_services.go)
 	MsgAddService:             ipcAddService,
@@ -286,9 +302,13 @@ var ipcHandlers = map[string]func(*IPCContext, json.RawMessage){
 	MsgStartService:           ipcStartService,
 	MsgStopService:            ipcStopService,
 
-	// Service Inspector (ipc_service_action.go, ipc_service_config.go)
+	// Service Inspector (ipc_service_action.go, ipc_service_config.go,
+	// ipc_service_logs.go, ipc_service_jobs.go)
 	MsgServiceAction: ipcServiceAction,
 	MsgServiceConfig: ipcServiceConfig,
+	MsgServiceLogs:   ipcServiceLogs,
+	MsgJobStatus:     ipcJobStatus,
+	MsgRunJob:        ipcRunJob,
 
 	// Projects (ipc_projects.go)
 	MsgCreateProject:              ipcCreateProject,
@@ -308,6 +328,10 @@ var ipcHandlers = map[string]func(*IPCContext, json.RawMessage){
 	MsgCreateEnrolment:    ipcCreateEnrolment,
 	MsgRevokeEnrolment:    ipcRevokeEnrolment,
 	MsgUpdateRemoteConfig: ipcUpdateRemoteConfig,
+
+	// Frontend Access (ipc_frontend_credentials.go)
+	MsgCreateFrontendCredential: ipcCreateFrontendCredential,
+	MsgRevokeFrontendCredential: ipcRevokeFrontendCredential,
 }
 
 // onSettingsIpc is called from the WKWebView IPC handler.
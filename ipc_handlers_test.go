@@ -19,6 +19,7 @@ func TestIPCDispatch_AllDeclaredMessageTypesHaveHandlers(t *testing.T) {
 		MsgAddExternalMcp,
 		MsgAuthenticateMcp,
 		MsgRemoveExternalMcp,
+		MsgResetMcpCredentials,
 		MsgAddService,
 		MsgRemoveService,
 		MsgUpdateService,
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"log/slog"
 )
 
 // ---------------------------------------------------------------------------
@@ -89,11 +90,55 @@ func ipcRemoveExternalMcp(ctx *IPCContext, raw json.RawMessage) {
 		return
 	}
 
-	if !ctx.withSettingsReconcile(func(s *Settings) { s.RemoveExternalMcp(msg.ID) }) {
+	var removed ExternalMcp
+	if !ctx.withSettingsReconcile(func(s *Settings) {
+		if m, _ := s.findMcpByID(msg.ID); m != nil {
+			removed = *m
+		}
+		s.RemoveExternalMcp(msg.ID)
+	}) {
 		return
 	}
 
 	ctx.UI.EmitEvent("onExternalMcpRemoved", msg.ID)
+	ctx.GoFunc(func() { logDroppedCredentialsRevocation(removed) })
+}
+
+// ipcResetMcpCredentials drops an HTTP MCP's stored OAuth credentials, reloads
+// it (it comes back unauthenticated), and revokes the old tokens at the
+// provider. The UI-side twin of `relay mcp reset-credentials`.
+func ipcResetMcpCredentials(ctx *IPCContext, raw json.RawMessage) {
+	msg, ok := unmarshalIPC[ipcIDMsg](raw, "reset_mcp_credentials")
+	if !ok || msg.ID == "" {
+		return
+	}
+
+	var cleared ExternalMcp
+	if !ctx.withSettingsNotify(
+		func(s *Settings) {
+			if m, _ := s.findMcpByID(msg.ID); m != nil && m.IsHTTP() {
+				cleared = *m
+				m.OAuthState = nil
+			}
+		},
+		func(secret string) error { return ctx.NotifyReloadMcp(msg.ID, secret) },
+	) {
+		return
+	}
+
+	ctx.UI.EmitEvent("onMcpCredentialsReset", msg.ID)
+	ctx.GoFunc(func() { logDroppedCredentialsRevocation(cleared) })
+}
+
+// logDroppedCredentialsRevocation revokes the OAuth tokens of an HTTP MCP
+// config whose credentials were just removed from settings. Runs off the
+// main thread (discovery + revocation are network round-trips) and only
+// logs: the local copy is already gone, so there is nothing for the UI to
+// retry.
+func logDroppedCredentialsRevocation(m ExternalMcp) {
+	if _, err := revokeDroppedCredentials(m); err != nil {
+		slog.Warn("OAuth token revocation failed", "id", m.ID, "error", err)
+	}
 }
 
 // ---------------------------------------------------------------------------
@@ -149,6 +194,11 @@ func authenticateMcp(ctx *IPCContext, id string) {
 		return
 	}
 
+	// The old grant is superseded by the new one; once the new tokens are
+	// saved, revoke it if it belonged to another client, so re-authenticating
+	// doesn't leave a second live refresh token at the provider.
+	previous := *mcpCfg
+
 	ctx.Platform.DispatchToMain(func() {
 		if !ctx.withSettingsNotify(
 			func(s *Settings) { s.UpdateOAuthState(id, oauth) },
@@ -158,5 +208,10 @@ func authenticateMcp(ctx *IPCContext, id string) {
 		}
 
 		ctx.UI.EmitEvent("onOAuthComplete", id)
+		ctx.GoFunc(func() {
+			if _, err := revokeSupersededGrant(previous, oauth); err != nil {
+				slog.Warn("OAuth token revocation failed", "id", previous.ID, "error", err)
+			}
+		})
 	})
 }
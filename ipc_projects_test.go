@@ -246,6 +246,27 @@ func TestIPCRemoveProject_DeletesAndEmits(t *testing.T) {
 	}
 }
 
+// A project edited from the Settings window reaches the event stream
+// through the IPC context's settings write, with no per-handler call.
+func TestIPCProjects_PublishEvents(t *testing.T) {
+	ipc, store, _, _ := newProjectsIPC(t)
+	ipc.Events = NewEventBus()
+	proj := createTestProject(t, store, "Alpha", t.TempDir(), []string{"fsmcp"})
+	ipc.Events.ObserveProjects(store.Get().Projects)
+	sub := ipc.Events.Subscribe("", nil)
+	defer sub.Cancel()
+
+	ipcUpdateProject(ipc, mustRaw(t, map[string]interface{}{"id": proj.ID, "name": "Alpha 2"}))
+	if ev := nextEvent(t, sub); ev.Type != EventProjectUpdated || ev.Project != proj.ID {
+		t.Errorf("after update: %s for %q", ev.Type, ev.Project)
+	}
+	ipcRemoveProject(ipc, mustRaw(t, ipcIDMsg{ID: proj.ID}))
+	if ev := nextEvent(t, sub); ev.Type != EventProjectDeleted || ev.Project != proj.ID {
+		t.Errorf("after remove: %s for %q", ev.Type, ev.Project)
+	}
+	noEvent(t, sub)
+}
+
 func TestIPCRotateProjectToken_EmitsNewPlaintextAndInvalidatesOld(t *testing.T) {
 	ipc, store, ui, _ := newProjectsIPC(t)
 	proj := createTestProject(t, store, "Alpha", t.TempDir(), []string{"fsmcp"})
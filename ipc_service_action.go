@@ -22,6 +22,12 @@ type ipcServiceActionMsg struct {
 	ServiceID string                     `json:"serviceId"`
 	ActionID  string                     `json:"actionId"`
 	Row       map[string]json.RawMessage `json:"row,omitempty"`
+	// Inputs are the values from the action's form, a JSON object keyed
+	// by field ID. Only for actions that declare inputs.
+	Inputs json.RawMessage `json:"inputs,omitempty"`
+	// Confirmed says the user answered the action's confirmation. Required
+	// for an action that asks for one (ActionDecl.NeedsConfirmation).
+	Confirmed bool `json:"confirmed,omitempty"`
 }
 
 const MsgServiceAction = "service_action"
@@ -30,11 +36,14 @@ const MsgServiceAction = "service_action"
 // The manifest *is* the action whitelist: relay refuses anything not in
 // manifest.Actions for the named serviceId. forEach actions substitute
 // `{key}` placeholders from the row map; non-forEach actions require an
-// empty row.
+// empty row. An action with inputs sends them as its JSON body once they
+// match its schema (service_action_inputs.go), and one that asks for
+// confirmation is refused unless the UI says it was given.
 //
 // Security boundary: paths come from the service-declared manifest, never
 // from the UI. Only row *values* come from the UI, and they pass through
-// url.PathEscape before being spliced in.
+// url.PathEscape before being spliced in; input values go in the body,
+// never the path.
 func ipcServiceAction(ipc *IPCContext, raw json.RawMessage) {
 	var msg ipcServiceActionMsg
 	if err := json.Unmarshal(raw, &msg); err != nil {
@@ -64,6 +73,15 @@ func ipcServiceAction(ipc *IPCContext, raw json.RawMessage) {
 		emitActionResult(ipc, msg, false, err.Error())
 		return
 	}
+	if action.NeedsConfirmation() && !msg.Confirmed {
+		emitActionResult(ipc, msg, false, fmt.Sprintf("action %q must be confirmed before it runs", msg.ActionID))
+		return
+	}
+	body, err := actionBody(action, msg.Inputs)
+	if err != nil {
+		emitActionResult(ipc, msg, false, err.Error())
+		return
+	}
 
 	// Off-main so a slow service can't block the UI on a 10s timeout.
 	client := NewServiceStatusClient(rec.InternalSocket, rec.InternalToken)
@@ -72,7 +90,7 @@ func ipcServiceAction(ipc *IPCContext, raw json.RawMessage) {
 		defer client.CloseIdleConnections()
 		callCtx, cancel := context.WithTimeout(ipc.Ctx, 10*time.Second)
 		defer cancel()
-		_, err := client.DoAction(callCtx, method, path)
+		_, err := client.DoAction(callCtx, method, path, body)
 		errStr := ""
 		if err != nil {
 			slog.Warn("service action failed",
@@ -274,3 +274,70 @@ func TestFindAction_OnlyMatchesByID(t *testing.T) {
 		t.Error("unknown action must not match")
 	}
 }
+
+// An action with inputs sends them, checked, as the JSON body.
+func TestIPCServiceAction_SendsInputsAsBody(t *testing.T) {
+	m := newManifest("/api/m/")
+	m.Actions = []bridge.ActionDecl{{
+		ID: "rename", Label: "Rename", Method: "POST", PathTemplate: "/api/m/{id}/rename", ForEach: "sessions",
+		Inputs: []bridge.FieldDecl{{ID: "title", Type: bridge.FieldTypeText, Required: true}},
+	}}
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-m", Manifest: m})
+	reg := NewEnhancedServiceRegistry(nil)
+	assertNoErr(t, reg.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), m), "register")
+	ipc, ui := newDispatcherIPC(t, reg)
+
+	send := func(inputs string) map[string]interface{} {
+		raw, _ := json.Marshal(ipcServiceActionMsg{
+			ServiceID: "svc-m", ActionID: "rename",
+			Row:    map[string]json.RawMessage{"id": json.RawMessage(`"s1"`)},
+			Inputs: json.RawMessage(inputs),
+		})
+		ipcServiceAction(ipc, raw)
+		return ui.lastResult(t)
+	}
+
+	if got := send(`{"title":7}`); got["ok"] != false || !strings.Contains(got["error"].(string), "must be a string") {
+		t.Errorf("bad inputs: %+v", got)
+	}
+	if fake.LastRequest() != nil {
+		t.Fatal("inputs that failed the schema reached the service")
+	}
+	if got := send(`{"title":"Planning"}`); got["ok"] != true {
+		t.Fatalf("good inputs: %+v", got)
+	}
+	req := fake.LastRequest()
+	if req == nil || req.Path != "/api/m/s1/rename" || string(req.Body) != `{"title":"Planning"}` ||
+		req.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("service got %+v", req)
+	}
+}
+
+// An action that asks for confirmation doesn't run without it.
+func TestIPCServiceAction_RequiresConfirmation(t *testing.T) {
+	m := newManifest("/api/m/")
+	m.Actions = []bridge.ActionDecl{
+		{ID: "wipe", Label: "Wipe", Method: "POST", PathTemplate: "/api/m/wipe", Danger: true},
+		{ID: "pull", Label: "Pull", Method: "POST", PathTemplate: "/api/m/pull", Confirm: "Download it?"},
+	}
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-m", Manifest: m})
+	reg := NewEnhancedServiceRegistry(nil)
+	assertNoErr(t, reg.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), m), "register")
+	ipc, ui := newDispatcherIPC(t, reg)
+
+	for _, id := range []string{"wipe", "pull"} {
+		raw, _ := json.Marshal(ipcServiceActionMsg{ServiceID: "svc-m", ActionID: id})
+		ipcServiceAction(ipc, raw)
+		if got := ui.lastResult(t); got["ok"] != false || !strings.Contains(got["error"].(string), "confirmed") {
+			t.Errorf("%s unconfirmed: %+v", id, got)
+		}
+	}
+	if fake.LastRequest() != nil {
+		t.Fatal("an unconfirmed action reached the service")
+	}
+	raw, _ := json.Marshal(ipcServiceActionMsg{ServiceID: "svc-m", ActionID: "wipe", Confirmed: true})
+	ipcServiceAction(ipc, raw)
+	if got := ui.lastResult(t); got["ok"] != true || fake.LastRequest() == nil || fake.LastRequest().Path != "/api/m/wipe" {
+		t.Errorf("confirmed: %+v", got)
+	}
+}
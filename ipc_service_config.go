@@ -29,7 +29,8 @@ const (
 // ipcServiceConfig handles a config get/save for one enhanced service. Path
 // resolution, reads, and writes go through resolveConfigPath (the single
 // security gate) and run off the UI thread — a save also restarts the service,
-// which blocks on process exit.
+// which blocks on process exit, or for a live service with a reload endpoint
+// waits for it to accept the file.
 func ipcServiceConfig(ipc *IPCContext, raw json.RawMessage) {
 	var msg ipcServiceConfigMsg
 	if err := json.Unmarshal(raw, &msg); err != nil {
@@ -91,6 +92,15 @@ func ipcServiceConfig(ipc *IPCContext, raw json.RawMessage) {
 				emitConfigResult(ipc, msg, false, "", err.Error())
 				return
 			}
+			// A service that can refuse the new file on reload gets the
+			// current one back if it does (service_config_reload.go).
+			var previous []byte
+			if decl.Reload != "" {
+				if previous, err = readConfigFile(realPath, info); err != nil {
+					emitConfigResult(ipc, msg, false, "", err.Error())
+					return
+				}
+			}
 			// Write the ORIGINAL edited bytes (not a re-marshal) so comments and
 			// key order survive on disk; preserve the file's existing mode (taken
 			// from the same FileInfo we validated, avoiding a re-stat race).
@@ -98,6 +108,10 @@ func ipcServiceConfig(ipc *IPCContext, raw json.RawMessage) {
 				emitConfigResult(ipc, msg, false, "", err.Error())
 				return
 			}
+			if decl.Reload != "" {
+				applyLiveConfig(ipc, msg, decl, allowedRoot, previous)
+				return
+			}
 			emitConfigResult(ipc, msg, true, "", "")
 
 			if decl.ApplyMode == bridge.ConfigApplyLive {
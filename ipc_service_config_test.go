@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -246,3 +247,209 @@ func TestIPCServiceConfig_SaveLiveSkipsRestart(t *testing.T) {
 		t.Errorf("want mode=saved for live, got %+v", applied)
 	}
 }
+
+// ---------------------------------------------------------------------------
+// live reload
+// ---------------------------------------------------------------------------
+
+// liveReloadManifest is configManifest with applyMode "live" and a reload
+// endpoint.
+func liveReloadManifest(path string) bridge.Manifest {
+	m := configManifest(path)
+	m.Config.ApplyMode = bridge.ConfigApplyLive
+	m.Config.Reload = "/config/reload"
+	return m
+}
+
+// reloadHashes returns the hash each reload request to fake carried, in order.
+func reloadHashes(t *testing.T, fake *FakeService) []string {
+	t.Helper()
+	var hashes []string
+	for _, req := range fake.Requests() {
+		if req.Method != http.MethodPost || req.Path != "/config/reload" {
+			t.Errorf("unexpected request %s %s", req.Method, req.Path)
+			continue
+		}
+		var body bridge.ConfigReloadRequest
+		if err := json.Unmarshal(req.Body, &body); err != nil {
+			t.Fatalf("reload body %q: %v", req.Body, err)
+		}
+		hashes = append(hashes, body.Hash)
+	}
+	return hashes
+}
+
+func rejectReload(reason string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(bridge.ConfigReloadResponse{Error: reason})
+	}
+}
+
+func TestIPCServiceConfig_LiveReloadApplied(t *testing.T) {
+	mkSandboxRelayHome(t)
+	root := t.TempDir()
+	cfg := filepath.Join(root, "settings.json")
+	writeFile(t, cfg, `{"a":"old"}`)
+
+	m := liveReloadManifest(cfg)
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "relayllm", Manifest: m,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			var req bridge.ConfigReloadRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			_ = json.NewEncoder(w).Encode(bridge.ConfigReloadResponse{Hash: req.Hash})
+		}})
+	reg := NewEnhancedServiceRegistry(nil)
+	_ = reg.RegisterManifest("relayllm", fake.Socket(), fake.Token(), m)
+	mgr := &recordingServiceManager{running: true}
+	ipc, ui := newConfigIPC(t, reg, mgr, "relayllm", root)
+
+	edited := `{"a":"new"}`
+	dispatchConfig(ipc, "relayllm", "save", edited)
+
+	if got := ui.lastEventNamed(t, "onServiceConfigResult"); got["ok"] != true {
+		t.Fatalf("save should succeed: %+v", got)
+	}
+	if applied := ui.lastEventNamed(t, "onServiceConfigApplied"); applied["mode"] != "applied" {
+		t.Errorf("want mode=applied, got %+v", applied)
+	}
+	if hashes := reloadHashes(t, fake); len(hashes) != 1 || hashes[0] != configHash([]byte(edited)) {
+		t.Errorf("reload hashes = %v, want [%s]", hashes, configHash([]byte(edited)))
+	}
+	if onDisk, _ := os.ReadFile(cfg); string(onDisk) != edited {
+		t.Errorf("file = %q, want %q", onDisk, edited)
+	}
+	if len(mgr.reloadIDs) != 0 {
+		t.Errorf("live reload must not restart; got %v", mgr.reloadIDs)
+	}
+}
+
+func TestIPCServiceConfig_LiveReloadRejectedRollsBack(t *testing.T) {
+	mkSandboxRelayHome(t)
+	root := t.TempDir()
+	cfg := filepath.Join(root, "settings.json")
+	original := `{"a":"old"}`
+	writeFile(t, cfg, original)
+
+	m := liveReloadManifest(cfg)
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "relayllm", Manifest: m, Handler: rejectReload("bad port")})
+	reg := NewEnhancedServiceRegistry(nil)
+	_ = reg.RegisterManifest("relayllm", fake.Socket(), fake.Token(), m)
+	ipc, ui := newConfigIPC(t, reg, &recordingServiceManager{running: true}, "relayllm", root)
+
+	dispatchConfig(ipc, "relayllm", "save", `{"a":"new"}`)
+
+	got := ui.lastEventNamed(t, "onServiceConfigResult")
+	errMsg, _ := got["error"].(string)
+	if got["ok"] != false || !strings.Contains(errMsg, "bad port") || !strings.Contains(errMsg, "previous version was restored") {
+		t.Errorf("rejected reload should fail the save with the service's reason, got %+v", got)
+	}
+	if onDisk, _ := os.ReadFile(cfg); string(onDisk) != original {
+		t.Errorf("file not rolled back: got %q, want %q", onDisk, original)
+	}
+	if ui.hasEvent("onServiceConfigApplied") {
+		t.Error("a refused config must not be reported as applied")
+	}
+}
+
+func TestIPCServiceConfig_LiveReloadUnconfirmedKeepsFile(t *testing.T) {
+	t.Run("500", func(t *testing.T) { testLiveReloadUnconfirmed(t, http.StatusInternalServerError) })
+	// A mistyped reload path says nothing about the file.
+	t.Run("404", func(t *testing.T) { testLiveReloadUnconfirmed(t, http.StatusNotFound) })
+}
+
+func testLiveReloadUnconfirmed(t *testing.T, status int) {
+	mkSandboxRelayHome(t)
+	root := t.TempDir()
+	cfg := filepath.Join(root, "settings.json")
+	writeFile(t, cfg, `{"a":"old"}`)
+
+	m := liveReloadManifest(cfg)
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "relayllm", Manifest: m,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "reload failed", status)
+		}})
+	reg := NewEnhancedServiceRegistry(nil)
+	_ = reg.RegisterManifest("relayllm", fake.Socket(), fake.Token(), m)
+	ipc, ui := newConfigIPC(t, reg, &recordingServiceManager{running: true}, "relayllm", root)
+
+	edited := `{"a":"new"}`
+	dispatchConfig(ipc, "relayllm", "save", edited)
+
+	if got := ui.lastEventNamed(t, "onServiceConfigResult"); got["ok"] != true {
+		t.Fatalf("an unconfirmed reload still saves: %+v", got)
+	}
+	applied := ui.lastEventNamed(t, "onServiceConfigApplied")
+	if applied["mode"] != "error" || !strings.Contains(applied["error"].(string), "didn't confirm") {
+		t.Errorf("want mode=error naming the unconfirmed reload, got %+v", applied)
+	}
+	if onDisk, _ := os.ReadFile(cfg); string(onDisk) != edited {
+		t.Errorf("an unconfirmed reload must not roll back: got %q", onDisk)
+	}
+}
+
+func TestIPCServiceConfig_LiveReloadRejectedLeavesRewrittenFile(t *testing.T) {
+	mkSandboxRelayHome(t)
+	root := t.TempDir()
+	cfg := filepath.Join(root, "settings.json")
+	writeFile(t, cfg, `{"a":"old"}`)
+
+	m := liveReloadManifest(cfg)
+	rewritten := `{"a":"fixed by the service"}`
+	reject := rejectReload("bad port")
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "relayllm", Manifest: m,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			// The service rewrites the file before answering; the rollback
+			// must not overwrite that.
+			writeFile(t, cfg, rewritten)
+			reject(w, r)
+		}})
+	reg := NewEnhancedServiceRegistry(nil)
+	_ = reg.RegisterManifest("relayllm", fake.Socket(), fake.Token(), m)
+	ipc, ui := newConfigIPC(t, reg, &recordingServiceManager{running: true}, "relayllm", root)
+
+	dispatchConfig(ipc, "relayllm", "save", `{"a":"new"}`)
+
+	got := ui.lastEventNamed(t, "onServiceConfigResult")
+	if got["ok"] != false || !strings.Contains(got["error"].(string), "changed again") {
+		t.Errorf("want a failed save explaining the file was left alone, got %+v", got)
+	}
+	if onDisk, _ := os.ReadFile(cfg); string(onDisk) != rewritten {
+		t.Errorf("rollback clobbered a newer file: got %q", onDisk)
+	}
+}
+
+func TestIPCServiceConfig_LiveReloadRejectedByReplicaRevertsOthers(t *testing.T) {
+	mkSandboxRelayHome(t)
+	root := t.TempDir()
+	cfg := filepath.Join(root, "settings.json")
+	original := `{"a":"old"}`
+	writeFile(t, cfg, original)
+
+	m := liveReloadManifest(cfg)
+	first := NewFakeService(t, FakeServiceOptions{ServiceID: "relayllm", Manifest: m,
+		Handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }})
+	second := NewFakeService(t, FakeServiceOptions{ServiceID: "relayllm-2", Manifest: m, Handler: rejectReload("bad port")})
+	reg := NewEnhancedServiceRegistry(nil)
+	_ = reg.RegisterReplica("relayllm", 0, first.Socket(), first.Token(), m)
+	_ = reg.RegisterReplica("relayllm", 1, second.Socket(), second.Token(), m)
+	ipc, ui := newConfigIPC(t, reg, &recordingServiceManager{running: true}, "relayllm", root)
+
+	edited := `{"a":"new"}`
+	dispatchConfig(ipc, "relayllm", "save", edited)
+
+	if got := ui.lastEventNamed(t, "onServiceConfigResult"); got["ok"] != false {
+		t.Fatalf("a replica's refusal fails the save: %+v", got)
+	}
+	want := []string{configHash([]byte(edited)), configHash([]byte(original))}
+	if hashes := reloadHashes(t, first); len(hashes) != 2 || hashes[0] != want[0] || hashes[1] != want[1] {
+		t.Errorf("first replica reloads = %v, want new then previous %v", hashes, want)
+	}
+	if hashes := reloadHashes(t, second); len(hashes) != 1 {
+		t.Errorf("second replica reloads = %v, want just the refused one", hashes)
+	}
+	if onDisk, _ := os.ReadFile(cfg); string(onDisk) != original {
+		t.Errorf("file not rolled back: got %q", onDisk)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"relaygo/bridge"
+)
+
+// ---------------------------------------------------------------------------
+// Job IPC handlers
+// ---------------------------------------------------------------------------
+
+const (
+	MsgJobStatus = "job_status"
+	MsgRunJob    = "run_job"
+)
+
+// jobStatusReply is one job's entry in the onJobStatus payload: whether its
+// schedule is armed, when it next runs, and its recent runs, oldest first.
+type jobStatusReply struct {
+	ID        string          `json:"id"`
+	Scheduled bool            `json:"scheduled"`
+	NextRun   *time.Time      `json:"next_run,omitempty"`
+	Runs      []bridge.JobRun `json:"runs"`
+}
+
+// ipcJobStatus reports every registered job's schedule and run history for
+// the Services tab, which asks on each status poll while it shows a job.
+func ipcJobStatus(ctx *IPCContext, _ json.RawMessage) {
+	ctx.UI.EmitEvent("onJobStatus", jobStatuses(ctx))
+}
+
+// jobStatuses collects the onJobStatus payload. A job the registry hasn't
+// started or run yet is listed with no runs.
+func jobStatuses(ctx *IPCContext) []jobStatusReply {
+	src, _ := ctx.Registry.(jobStatusSource)
+	out := []jobStatusReply{}
+	for _, svc := range ctx.Store.Get().Services {
+		if !svc.isJob() {
+			continue
+		}
+		reply := jobStatusReply{ID: svc.ID, Runs: []bridge.JobRun{}}
+		if src != nil {
+			if js, ok := src.JobStatus(svc.ID); ok {
+				var st bridge.ServiceStatus
+				fillJobStatus(&st, js)
+				reply.Scheduled, reply.NextRun, reply.Runs = st.Scheduled, st.NextRun, st.JobRuns
+			}
+		}
+		out = append(out, reply)
+	}
+	return out
+}
+
+// ipcRunJob runs a job now (the Run Now button). Off the UI thread: with
+// overlap "kill" it waits for the previous run to stop.
+func ipcRunJob(ctx *IPCContext, raw json.RawMessage) {
+	msg, ok := unmarshalIPC[ipcIDMsg](raw, MsgRunJob)
+	if !ok || msg.ID == "" {
+		return
+	}
+	svc, _ := ctx.Store.Get().findServiceByID(msg.ID)
+	runner, ok := ctx.Registry.(jobRunner)
+	switch {
+	case svc == nil || !svc.isJob():
+		ctx.UI.EmitEvent("onSettingsError", fmt.Sprintf("%q is not a job", msg.ID))
+		return
+	case !ok:
+		ctx.UI.EmitEvent("onSettingsError", "jobs can't be run here")
+		return
+	}
+	cfg := *svc
+	ctx.GoFunc(func() {
+		err := runner.RunJob(&cfg)
+		if err != nil {
+			slog.Error("job run failed", "id", cfg.ID, "error", err)
+		}
+		ctx.Platform.DispatchToMain(func() {
+			if err != nil {
+				ctx.UI.EmitEvent("onSettingsError", fmt.Sprintf("failed to run job: %v", err))
+			}
+			ctx.refreshServiceUI()
+			ctx.UI.EmitEvent("onJobStatus", jobStatuses(ctx))
+		})
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// lastJobStatus returns the payload of the most recent onJobStatus.
+func lastJobStatus(t *testing.T, ui *recordingUI) []jobStatusReply {
+	t.Helper()
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	for i := len(ui.events) - 1; i >= 0; i-- {
+		if ui.events[i].Name == "onJobStatus" {
+			return ui.events[i].Args[0].([]jobStatusReply)
+		}
+	}
+	t.Fatal("no onJobStatus emitted")
+	return nil
+}
+
+func TestIPCRunJob_RunsAndReportsHistory(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	ipc, ui := newConfigIPC(t, nil, reg, "svc-web", "")
+	job := ServiceConfig{ID: "job-report", DisplayName: "Report", Command: "/bin/true", Kind: KindJob}
+	ipc.Store = fixedStore{s: &Settings{Services: []ServiceConfig{{ID: "svc-web"}, job}}}
+	ipc.UpdateMenu = func() {}
+
+	// Listed before it has ever run, with no runs.
+	ipcJobStatus(ipc, nil)
+	if got := lastJobStatus(t, ui); len(got) != 1 || got[0].ID != job.ID || len(got[0].Runs) != 0 {
+		t.Fatalf("job status before a run = %+v", got)
+	}
+
+	ipcRunJob(ipc, json.RawMessage(`{"id":"job-report"}`))
+	waitFor(t, 5*time.Second, "job run", func() bool {
+		js, _ := reg.JobStatus(job.ID)
+		return len(js.History) == 1
+	})
+	ipcJobStatus(ipc, nil)
+	got := lastJobStatus(t, ui)
+	if len(got[0].Runs) != 1 || got[0].Runs[0].Trigger != jobTriggerManual || got[0].Runs[0].ExitCode != 0 {
+		t.Fatalf("job status after a run = %+v", got)
+	}
+
+	// A service isn't a job.
+	ipcRunJob(ipc, json.RawMessage(`{"id":"svc-web"}`))
+	if !ui.hasEvent("onSettingsError") {
+		t.Error("running a service as a job should report an error")
+	}
+}
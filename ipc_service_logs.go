@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Service log pane IPC handler
+// ---------------------------------------------------------------------------
+
+const MsgServiceLogs = "service_logs"
+
+// defaultServiceLogPaneLines is how much history the log pane loads when it
+// opens; it then follows with the cursor.
+const defaultServiceLogPaneLines = 500
+
+// ipcServiceLogsMsg asks for a service's log. Without a cursor it is the
+// pane's first load: the last Tail lines (default 500) of history. With the
+// cursor from the previous reply it returns only what was written since,
+// which is how the pane follows the log.
+type ipcServiceLogsMsg struct {
+	ID       string            `json:"id"`
+	Cursor   *serviceLogCursor `json:"cursor,omitempty"`
+	Grep     string            `json:"grep,omitempty"`
+	SinceSec int               `json:"since_sec,omitempty"`
+	Tail     int               `json:"tail,omitempty"`
+}
+
+// serviceLogsReply is the onServiceLogs payload. Append is false for a
+// first load (replace the pane's contents) and true for a follow-up.
+type serviceLogsReply struct {
+	ID     string           `json:"id"`
+	Lines  []serviceLogLine `json:"lines"`
+	Cursor serviceLogCursor `json:"cursor"`
+	Append bool             `json:"append"`
+	Path   string           `json:"path,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+// ipcServiceLogs reads a service's log for the settings UI's log pane, off
+// the UI thread since it touches the disk. Only registered services can be
+// read, so the ID can't be used to reach other files in the log directory.
+func ipcServiceLogs(ctx *IPCContext, raw json.RawMessage) {
+	msg, ok := unmarshalIPC[ipcServiceLogsMsg](raw, MsgServiceLogs)
+	if !ok {
+		return
+	}
+	reply := serviceLogsReply{ID: msg.ID, Lines: []serviceLogLine{}, Append: msg.Cursor != nil}
+	if svc, _ := ctx.Store.Get().findServiceByID(msg.ID); svc == nil {
+		reply.Error = "unknown service"
+		ctx.UI.EmitEvent("onServiceLogs", reply)
+		return
+	}
+
+	q := serviceLogQuery{Grep: msg.Grep, Tail: intOr(msg.Tail, defaultServiceLogPaneLines)}
+	if msg.SinceSec > 0 {
+		q.Since = time.Now().Add(-time.Duration(msg.SinceSec) * time.Second)
+	}
+	ctx.GoFunc(func() {
+		path, err := serviceLogPath(msg.ID)
+		if err == nil {
+			reply.Path = path
+			var lines []serviceLogLine
+			if msg.Cursor != nil {
+				lines, reply.Cursor, err = readServiceLogFrom(path, *msg.Cursor, q)
+			} else {
+				lines, reply.Cursor, err = readServiceLog(path, q)
+			}
+			if lines != nil {
+				reply.Lines = lines
+			}
+		}
+		if err != nil {
+			reply.Error = err.Error()
+		}
+		dispatchEmit(ctx, "onServiceLogs", reply)
+	})
+}
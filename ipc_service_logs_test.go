@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lastServiceLogs returns the payload of the most recent onServiceLogs.
+func lastServiceLogs(t *testing.T, ui *recordingUI) serviceLogsReply {
+	t.Helper()
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	for i := len(ui.events) - 1; i >= 0; i-- {
+		if ui.events[i].Name == "onServiceLogs" {
+			return ui.events[i].Args[0].(serviceLogsReply)
+		}
+	}
+	t.Fatal("no onServiceLogs emitted")
+	return serviceLogsReply{}
+}
+
+func TestIPCServiceLogs_LoadThenFollow(t *testing.T) {
+	mkEmptySandboxRelayHome(t)
+	ipc, ui := newConfigIPC(t, nil, noopServiceManager{}, "svc-web", "")
+	path, err := serviceLogPath("svc-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now().UTC().Add(-time.Hour)
+	writeLog(t, path, base, "old", "GET /a", "GET /b")
+
+	ipcServiceLogs(ipc, json.RawMessage(`{"id":"svc-web","tail":2}`))
+	first := lastServiceLogs(t, ui)
+	if first.Error != "" || first.Append || first.Path != path || strings.Join(texts(first.Lines), ",") != "GET /a,GET /b" {
+		t.Fatalf("first load = %+v", first)
+	}
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(time.Now().UTC().Format(logStampLayout) + " GET /c\n")
+	f.Close()
+	raw, _ := json.Marshal(ipcServiceLogsMsg{ID: "svc-web", Cursor: &first.Cursor})
+	ipcServiceLogs(ipc, raw)
+	next := lastServiceLogs(t, ui)
+	if !next.Append || strings.Join(texts(next.Lines), ",") != "GET /c" || next.Cursor.Offset <= first.Cursor.Offset {
+		t.Fatalf("follow-up = %+v", next)
+	}
+
+	// since_sec drops the hour-old lines.
+	ipcServiceLogs(ipc, json.RawMessage(`{"id":"svc-web","since_sec":60}`))
+	if got := strings.Join(texts(lastServiceLogs(t, ui).Lines), ","); got != "GET /c" {
+		t.Errorf("since_sec lines = %s", got)
+	}
+}
+
+// Only configured services' logs can be read; the ID is not a path.
+func TestIPCServiceLogs_UnknownService(t *testing.T) {
+	mkEmptySandboxRelayHome(t)
+	ipc, ui := newConfigIPC(t, nil, noopServiceManager{}, "svc-web", "")
+	ipcServiceLogs(ipc, json.RawMessage(`{"id":"../../settings"}`))
+	if got := lastServiceLogs(t, ui); got.Error != "unknown service" || len(got.Lines) != 0 {
+		t.Fatalf("reply = %+v", got)
+	}
+}
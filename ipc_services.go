@@ -94,7 +94,28 @@ func ipcUpdateService(ctx *IPCContext, raw json.RawMessage) {
 	config := msg.toServiceConfig(msg.ID)
 	wasRunning := ctx.Registry.IsRunning(msg.ID)
 
-	if !ctx.withSettings(func(s *Settings) { s.UpdateService(config) }) {
+	if !ctx.withSettings(func(s *Settings) {
+		// The settings UI doesn't edit resource limits, the restart
+		// policy, the health check, dependencies, how the service is
+		// stopped, a job's schedule, sockets, env files, env profiles or
+		// replicas; keep the CLI's.
+		if existing, _ := s.findServiceByID(config.ID); existing != nil {
+			config.Limits = existing.Limits
+			config.Restart = existing.Restart
+			config.Health = existing.Health
+			config.DependsOn = existing.DependsOn
+			config.StopSignal = existing.StopSignal
+			config.StopTimeoutSec = existing.StopTimeoutSec
+			config.PreStop = existing.PreStop
+			config.Kind = existing.Kind
+			config.Job = existing.Job
+			config.Sockets = existing.Sockets
+			config.EnvFiles = existing.EnvFiles
+			config.EnvProfiles = existing.EnvProfiles
+			config.Replicas = existing.Replicas
+		}
+		s.UpdateService(config)
+	}) {
 		return
 	}
 
@@ -14,6 +14,19 @@ import (
 )
 
 func main() {
+	// The sandbox helper stages (sandbox_linux.go) run inside a half-built
+	// container: no logging, no config dir, nothing but the plan.
+	if len(os.Args) > 1 && isSandboxHelperCommand(os.Args[1]) {
+		runSandboxHelper(os.Args[1:])
+		return
+	}
+	// Likewise the rlimit helper (resource_limits_unix.go), which sits
+	// between the tray and a limited child for one exec.
+	if len(os.Args) > 1 && os.Args[1] == limitsExecCommand {
+		runLimitsHelper(os.Args[2:])
+		return
+	}
+
 	logLevel := slog.LevelInfo
 	if env := os.Getenv("RELAY_LOG_LEVEL"); env != "" {
 		if err := logLevel.UnmarshalText([]byte(env)); err != nil {
@@ -58,10 +71,14 @@ func main() {
 		runAuditCommand(args[1:])
 	case "enrol":
 		runEnrolCommand(args[1:])
+	case "secrets":
+		runSecretsCommand(args[1:])
+	case "frontend-cred":
+		runFrontendCredCommand(args[1:])
 	case "mcpList":
 		exitError("mcpList has been removed. Use: relay mcpExec --token <TOKEN> --list")
 	default:
-		fmt.Fprintf(os.Stderr, "unknown command: %s\nUsage: relay [--config-dir DIR] [service|mcp|mcpExec|audit|enrol]\n", args[0])
+		fmt.Fprintf(os.Stderr, "unknown command: %s\nUsage: relay [--config-dir DIR] [service|mcp|mcpExec|audit|enrol|secrets|frontend-cred]\n", args[0])
 		os.Exit(1)
 	}
 }
@@ -95,7 +112,7 @@ func applyConfigDirFlag(args []string) []string {
 func runMcpOrServer(args []string) {
 	if len(args) > 0 {
 		switch args[0] {
-		case "register", "unregister", "list":
+		case "register", "unregister", "reset-credentials", "list":
 			runMcpCommand(args)
 			return
 		case "call":
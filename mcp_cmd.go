@@ -18,6 +18,7 @@ func runMcpCommand(args []string) {
 	runSubcommands("mcp", []cliSubcommand{
 		{"register", func(a []string) { mcpRegister(store, a) }},
 		{"unregister", func(a []string) { mcpUnregister(store, a) }},
+		{"reset-credentials", func(a []string) { mcpResetCredentials(store, a) }},
 		{"list", func(_ []string) { mcpList(store) }},
 	}, args)
 }
@@ -26,10 +27,19 @@ func mcpRegister(store SettingsStore, args []string) {
 	fs := flag.NewFlagSet("mcp register", flag.ExitOnError)
 	var opts registerOpts
 	addRegisterFlags(fs, &opts)
+	var limits ResourceLimits
+	addLimitFlags(fs, &limits)
 	command := fs.String("command", "", "command to run")
 	transport := fs.String("transport", "stdio", "transport type (stdio or http)")
 	mcpURL := fs.String("url", "", "MCP endpoint URL (required for http)")
 	tccServices := fs.String("tcc-services", "", "comma-separated TCC services the MCP needs (e.g. calendar,contacts,reminders,microphone,appleevents)")
+	linuxSvcs := fs.String("linux-services", "", "comma-separated Linux services a sandboxed MCP needs ("+strings.Join(linuxServiceNames(), ",")+")")
+	sandbox := fs.Bool("sandbox", false, "run the MCP in a Linux sandbox (namespaces, Landlock, seccomp)")
+	var sandboxRead, sandboxWrite stringSlice
+	fs.Var(&sandboxRead, "sandbox-read", "path to expose read-only in the sandbox (repeatable)")
+	fs.Var(&sandboxWrite, "sandbox-write", "path to expose read-write in the sandbox (repeatable)")
+	sandboxProjects := fs.Bool("sandbox-project-paths", false, "expose the paths of projects that grant this MCP")
+	denyNetwork := fs.Bool("deny-network", false, "give the sandboxed MCP no network beyond loopback")
 	fs.Parse(args)
 
 	if *transport != "stdio" && *transport != "http" {
@@ -48,12 +58,28 @@ func mcpRegister(store SettingsStore, args []string) {
 	id, env := opts.resolveIDAndEnv()
 
 	cfg := ExternalMcp{
-		ID:          id,
-		DisplayName: opts.Name,
-		Command:     *command,
-		Args:        []string(opts.Args),
-		Env:         env,
-		TccServices: parseTccServices(*tccServices),
+		ID:            id,
+		DisplayName:   opts.Name,
+		Command:       *command,
+		Args:          []string(opts.Args),
+		Env:           env,
+		TccServices:   parseTccServices(*tccServices),
+		LinuxServices: parseLinuxServices(*linuxSvcs),
+		Limits:        limitsFromFlags(limits),
+	}
+	if *sandbox {
+		cfg.Sandbox = &SandboxProfile{
+			Enabled:      true,
+			ReadPaths:    []string(sandboxRead),
+			WritePaths:   []string(sandboxWrite),
+			ProjectPaths: *sandboxProjects,
+			DenyNetwork:  *denyNetwork,
+		}
+	} else if len(sandboxRead)+len(sandboxWrite) > 0 || *sandboxProjects || *denyNetwork {
+		exitError("--sandbox-read, --sandbox-write, --sandbox-project-paths and --deny-network require --sandbox")
+	}
+	if err := validateSandbox(&cfg); err != nil {
+		exitError("%v", err)
 	}
 
 	updated, secret := upsertAndPrint(store, "mcp", opts.Name, id, func(s *Settings) bool {
@@ -154,9 +180,80 @@ func mcpUnregister(store SettingsStore, args []string) {
 	name := fs.String("name", "", "MCP display name")
 	fs.Parse(args)
 
+	// Capture the config inside the same write that removes it, so the
+	// credentials we revoke are exactly the ones that were dropped.
+	var removed ExternalMcp
 	_, adminSecret := resolveAndRemove(store, "mcp", *id, *name,
-		(*Settings).ResolveMcpID, (*Settings).RemoveExternalMcp)
+		(*Settings).ResolveMcpID, func(s *Settings, id string) {
+			if m, _ := s.findMcpByID(id); m != nil {
+				removed = *m
+			}
+			s.RemoveExternalMcp(id)
+		})
 	warnNotifyFailure(bridge.SendReconcile(adminSecret))
+	revokeAndReport(removed)
+}
+
+// mcpResetCredentials drops an HTTP MCP's stored OAuth credentials and revokes
+// them at the provider, leaving the registration in place. The tray reloads
+// the MCP, which comes back in the "none" auth state until the user signs in
+// again from the settings UI (or re-runs `relay mcp register`).
+func mcpResetCredentials(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("mcp reset-credentials", flag.ExitOnError)
+	id := fs.String("id", "", "MCP ID")
+	name := fs.String("name", "", "MCP display name")
+	fs.Parse(args)
+
+	if *id == "" && *name == "" {
+		exitError("--id or --name is required")
+	}
+
+	var resolvedID, adminSecret string
+	var cleared ExternalMcp
+	var notHTTP bool
+	if err := store.With(func(s *Settings) {
+		resolvedID = s.ResolveMcpID(*id, *name)
+		m, _ := s.findMcpByID(resolvedID)
+		if m == nil {
+			return
+		}
+		if !m.IsHTTP() {
+			notHTTP = true
+			return
+		}
+		cleared = *m
+		m.OAuthState = nil
+		adminSecret = s.AdminSecret
+	}); err != nil {
+		exitError("failed to save settings: %v", err)
+	}
+
+	switch {
+	case resolvedID == "" && *id != "":
+		exitError("no mcp found with id %q", *id)
+	case resolvedID == "":
+		exitError("no mcp found with name %q", *name)
+	case notHTTP:
+		exitError("mcp %q uses stdio transport and holds no OAuth credentials", resolvedID)
+	}
+
+	fmt.Printf("reset credentials for mcp %q\n", resolvedID)
+	warnNotifyFailure(bridge.SendReloadMcp(resolvedID, adminSecret))
+	revokeAndReport(cleared)
+}
+
+// revokeAndReport revokes the OAuth tokens of an HTTP MCP whose credentials
+// were just dropped from settings and says how it went. Best-effort: a
+// failure is a warning, since the local copy is already gone and there is
+// nothing the user can retry.
+func revokeAndReport(m ExternalMcp) {
+	revoked, err := revokeDroppedCredentials(m)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "warning: could not revoke OAuth tokens at the provider: %v\n", err)
+	case revoked:
+		fmt.Println("revoked OAuth tokens at the provider")
+	}
 }
 
 func mcpList(store SettingsStore) {
@@ -167,8 +264,19 @@ func mcpList(store SettingsStore) {
 		return
 	}
 
+	// Auth state and exit status are runtime-only, so ask the tray. Without
+	// a running tray (or against one that predates McpStatus) the AUTH and
+	// STATUS columns show "-".
+	statuses := map[string]bridge.McpStatus{}
+	if list, err := bridge.NewClient(s.AdminSecret).McpStatus(); err == nil {
+		for _, st := range list {
+			statuses[st.ID] = st
+		}
+	}
+
+	refs := listSecretRefs(store)
 	w := newTabWriter()
-	fmt.Fprintln(w, "ID\tNAME\tTRANSPORT\tENDPOINT")
+	fmt.Fprintln(w, "ID\tNAME\tTRANSPORT\tENDPOINT\tAUTH\tSTATUS\tLIMITS\tENV")
 	for _, m := range s.ExternalMcps {
 		transport := m.Transport
 		if transport == "" {
@@ -183,7 +291,20 @@ func mcpList(store SettingsStore) {
 				endpoint += " " + strings.Join(m.Args, " ")
 			}
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.ID, m.DisplayName, transport, endpoint)
+		st := statuses[m.ID]
+		auth := st.AuthState
+		if auth == "" {
+			auth = "-"
+		}
+		status := "-"
+		switch {
+		case st.LastExit != "":
+			status = st.LastExit
+		case st.Connected:
+			status = "connected"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", m.ID, m.DisplayName, transport, endpoint, auth,
+			status, m.Limits, formatEnvForList("mcp/"+m.ID+"/env/", m.Env, refs))
 	}
 	w.Flush()
 }
@@ -167,8 +167,12 @@ func ResetMcpPermissions(mcp ExternalMcp) (*ResetMcpPermissionsResult, error) {
 	// stdio spawn) means TCC attribution matches the runtime path. We do
 	// NOT use `open` -- that would reparent to launchd and break the
 	// responsible-parent chain the primer just established.
+	env, err := resolveEnvRefs(mcp.Env)
+	if err != nil {
+		return nil, fmt.Errorf("spawn %s --check-permissions: %w", mcp.Command, err)
+	}
 	cmd := exec.Command(mcp.Command, "--check-permissions")
-	mergeEnv(cmd, mcp.Env)
+	mergeEnv(cmd, env)
 
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
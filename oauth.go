@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"io"
@@ -24,6 +25,7 @@ type oauthMetadata struct {
 	ResponseTypesSupported        []string `json:"response_types_supported,omitempty"`
 	GrantTypesSupported           []string `json:"grant_types_supported,omitempty"`
 	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported,omitempty"`
+	RevocationEndpoint            string   `json:"revocation_endpoint,omitempty"` // RFC 7009; optional
 }
 
 // protectedResourceMetadata holds the PRM document (RFC 9728).
@@ -555,6 +557,49 @@ func startOAuthFlow(mcpURL string, openBrowser func(string)) (*OAuthState, error
 	return oauthState, nil
 }
 
+// tokenEndpointError is a non-200 reply from the token endpoint. Typed (rather
+// than a bare fmt error) so the refresh path can tell "the provider rejected
+// this refresh token" — the grant is dead and the user must re-authenticate —
+// apart from a 5xx or a garbled body, which is worth retrying on the next call.
+type tokenEndpointError struct {
+	Action string
+	Status int
+	Code   string // RFC 6749 §5.2 "error" field; empty if the body wasn't JSON
+	Body   string
+}
+
+func (e *tokenEndpointError) Error() string {
+	return fmt.Sprintf("%s failed (HTTP %d): %s", e.Action, e.Status, e.Body)
+}
+
+func newTokenEndpointError(action string, status int, body []byte) *tokenEndpointError {
+	var parsed struct {
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(body, &parsed)
+	return &tokenEndpointError{Action: action, Status: status, Code: parsed.Error, Body: string(body)}
+}
+
+// isGrantRejected reports whether err means the authorization server refused
+// the grant outright. invalid_grant is the RFC 6749 code for a revoked or
+// expired refresh token; invalid_client / unauthorized_client mean the
+// registration itself is gone. Some providers answer a bare 401 with no JSON
+// body, which is treated the same way. Anything else (5xx, network, 429) is
+// transient.
+func isGrantRejected(err error) bool {
+	var te *tokenEndpointError
+	if !errors.As(err, &te) {
+		return false
+	}
+	switch te.Code {
+	case "invalid_grant", "invalid_client", "unauthorized_client":
+		return te.Status == http.StatusBadRequest || te.Status == http.StatusUnauthorized
+	case "":
+		return te.Status == http.StatusUnauthorized
+	}
+	return false
+}
+
 // postTokenEndpoint POSTs form data to the token endpoint and decodes the response.
 // Shared by exchangeCode and refreshAccessToken.
 func postTokenEndpoint(meta *oauthMetadata, data url.Values, action string) (*oauthTokenResponse, error) {
@@ -569,7 +614,7 @@ func postTokenEndpoint(meta *oauthMetadata, data url.Values, action string) (*oa
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return nil, fmt.Errorf("%s failed (HTTP %d): %s", action, resp.StatusCode, string(body))
+		return nil, newTokenEndpointError(action, resp.StatusCode, body)
 	}
 
 	var tokenResp oauthTokenResponse
@@ -609,3 +654,90 @@ func refreshAccessToken(meta *oauthMetadata, refreshToken, clientID, clientSecre
 	}
 	return postTokenEndpoint(meta, data, "token refresh")
 }
+
+// revokeToken calls the RFC 7009 revocation endpoint for one token. The spec
+// says the server answers 200 for both a revoked and an already-unknown token,
+// so any 2xx is success.
+func revokeToken(meta *oauthMetadata, token, hint, clientID, clientSecret string) error {
+	if err := validateOAuthDiscoveryURL(meta.RevocationEndpoint); err != nil {
+		return fmt.Errorf("token revocation: %w", err)
+	}
+	data := url.Values{
+		"token":           {token},
+		"token_type_hint": {hint},
+		"client_id":       {clientID},
+	}
+	if clientSecret != "" {
+		data.Set("client_secret", clientSecret)
+	}
+	resp, err := oauthHTTPClient.PostForm(meta.RevocationEndpoint, data)
+	if err != nil {
+		return fmt.Errorf("token revocation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return newTokenEndpointError("token revocation", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// revokeOAuthState revokes the tokens held in an HTTP MCP's persisted OAuth
+// state so unregistering (or resetting credentials for) an MCP doesn't leave a
+// live grant at the provider. The refresh token goes first: revoking it
+// typically invalidates every access token minted from it, and it is the
+// long-lived credential that matters. The access token is revoked as well for
+// servers that don't cascade.
+//
+// Best-effort by design — the caller has already decided to drop the
+// credentials locally, and a provider without a revocation_endpoint (it is
+// optional in RFC 8414) is not an error. Returns nil when there was nothing
+// to revoke or nowhere to send it.
+func revokeOAuthState(mcpURL string, st *OAuthState) error {
+	if st == nil || (st.AccessToken == "" && st.RefreshToken == "") {
+		return nil
+	}
+	discovery, err := discoverOAuth(mcpURL)
+	if err != nil {
+		return fmt.Errorf("discover OAuth metadata for revocation: %w", err)
+	}
+	meta := discovery.Metadata
+	if meta.RevocationEndpoint == "" {
+		slog.Info("oauth: server advertises no revocation endpoint; tokens dropped locally only", "url", mcpURL)
+		return nil
+	}
+	var errs []error
+	if st.RefreshToken != "" {
+		errs = append(errs, revokeToken(meta, st.RefreshToken, "refresh_token", st.ClientID, st.ClientSecret))
+	}
+	if st.AccessToken != "" {
+		errs = append(errs, revokeToken(meta, st.AccessToken, "access_token", st.ClientID, st.ClientSecret))
+	}
+	return errors.Join(errs...)
+}
+
+// revokeDroppedCredentials revokes the OAuth state of an MCP config whose
+// credentials were just removed from settings — unregistered, reset, or
+// replaced by another client's grant. revoked reports whether it held any
+// state to revoke (a stdio MCP or an HTTP one never authorized holds none).
+// The tray and the CLI share it and differ only in how they report err: one
+// logs, the other warns on stderr.
+func revokeDroppedCredentials(m ExternalMcp) (revoked bool, err error) {
+	if !m.IsHTTP() || m.OAuthState == nil {
+		return false, nil
+	}
+	return true, revokeOAuthState(m.URL, m.OAuthState)
+}
+
+// revokeSupersededGrant revokes previous's OAuth state after re-authorizing
+// replaced it with next — but only when next was issued to a different
+// client. Some providers answer any RFC 7009 call by revoking every token
+// for that user and client, which would take the grant just obtained with
+// it. Under the same client the old refresh token is left to the provider,
+// which commonly retires it when the user consents again.
+func revokeSupersededGrant(previous ExternalMcp, next *OAuthState) (revoked bool, err error) {
+	if previous.OAuthState == nil || next == nil || previous.OAuthState.ClientID == next.ClientID {
+		return false, nil
+	}
+	return revokeDroppedCredentials(previous)
+}
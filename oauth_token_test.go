@@ -14,6 +14,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -204,3 +205,141 @@ func TestOAuthCallback_WaitForCodeTimeout(t *testing.T) {
 		t.Fatalf("want timeout error, got %v", err)
 	}
 }
+
+func TestIsGrantRejected(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{400, `{"error":"invalid_grant"}`, true},
+		{401, `{"error":"invalid_client"}`, true},
+		{400, `{"error":"unauthorized_client"}`, true},
+		{401, ``, true},
+		{400, `{"error":"invalid_request"}`, false},
+		{500, `{"error":"invalid_grant"}`, false},
+		{503, `{"error":"temporarily_unavailable"}`, false},
+	}
+	for _, c := range cases {
+		meta, _ := tokenEndpoint(t, c.status, c.body)
+		_, err := refreshAccessToken(meta, "rt", "id", "")
+		if got := isGrantRejected(err); got != c.want {
+			t.Errorf("HTTP %d %s: isGrantRejected = %v, want %v (err %v)", c.status, c.body, got, c.want, err)
+		}
+	}
+}
+
+// oauthASWithRevocation serves AS metadata at the non-path-aware well-known
+// URL and records every form posted to /revoke, in order.
+func oauthASWithRevocation(t *testing.T, advertise bool) (mcpURL string, revoked *[]url.Values) {
+	t.Helper()
+	var mu sync.Mutex
+	var forms []url.Values
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/oauth-authorization-server":
+			rev := ""
+			if advertise {
+				rev = `,"revocation_endpoint":"` + ts.URL + `/revoke"`
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"authorization_endpoint":"` + ts.URL + `/authorize","token_endpoint":"` + ts.URL + `/token"` + rev + `}`))
+		case "/revoke":
+			_ = r.ParseForm()
+			mu.Lock()
+			forms = append(forms, r.PostForm)
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL + "/mcp", &forms
+}
+
+func TestRevokeOAuthState_RevokesRefreshThenAccess(t *testing.T) {
+	mcpURL, revoked := oauthASWithRevocation(t, true)
+	err := revokeOAuthState(mcpURL, &OAuthState{ClientID: "cid", AccessToken: "at", RefreshToken: "rt"})
+	if err != nil {
+		t.Fatalf("revokeOAuthState: %v", err)
+	}
+	got := *revoked
+	if len(got) != 2 {
+		t.Fatalf("revocation endpoint saw %d posts, want 2", len(got))
+	}
+	if got[0].Get("token") != "rt" || got[0].Get("token_type_hint") != "refresh_token" {
+		t.Errorf("first revocation = %v, want the refresh token", got[0])
+	}
+	if got[1].Get("token") != "at" || got[1].Get("token_type_hint") != "access_token" {
+		t.Errorf("second revocation = %v, want the access token", got[1])
+	}
+	if got[0].Get("client_id") != "cid" {
+		t.Errorf("client_id not sent: %v", got[0])
+	}
+}
+
+func TestRevokeOAuthState_NoEndpointIsNoop(t *testing.T) {
+	mcpURL, revoked := oauthASWithRevocation(t, false)
+	if err := revokeOAuthState(mcpURL, &OAuthState{AccessToken: "at", RefreshToken: "rt"}); err != nil {
+		t.Fatalf("missing revocation_endpoint should not be an error: %v", err)
+	}
+	if len(*revoked) != 0 {
+		t.Errorf("nothing should be posted without an advertised endpoint: %v", *revoked)
+	}
+}
+
+func TestRevokeOAuthState_NothingToRevoke(t *testing.T) {
+	// No network at all: an unreachable URL would fail discovery.
+	if err := revokeOAuthState("http://127.0.0.1:1/mcp", nil); err != nil {
+		t.Errorf("nil state: %v", err)
+	}
+	if err := revokeOAuthState("http://127.0.0.1:1/mcp", &OAuthState{ClientID: "cid"}); err != nil {
+		t.Errorf("state without tokens: %v", err)
+	}
+}
+
+func TestRevokeDroppedCredentials(t *testing.T) {
+	mcpURL, revoked := oauthASWithRevocation(t, true)
+	for _, m := range []ExternalMcp{
+		{ID: "stdio", Transport: "stdio", OAuthState: &OAuthState{AccessToken: "at"}},
+		{ID: "fresh", Transport: "http", URL: mcpURL},
+	} {
+		if ok, err := revokeDroppedCredentials(m); ok || err != nil {
+			t.Errorf("%s: revokeDroppedCredentials = %v, %v; want nothing to revoke", m.ID, ok, err)
+		}
+	}
+	if len(*revoked) != 0 {
+		t.Fatalf("nothing should be posted for configs without OAuth state: %v", *revoked)
+	}
+
+	m := ExternalMcp{ID: "gh", Transport: "http", URL: mcpURL, OAuthState: &OAuthState{RefreshToken: "rt"}}
+	if ok, err := revokeDroppedCredentials(m); !ok || err != nil {
+		t.Fatalf("revokeDroppedCredentials = %v, %v", ok, err)
+	}
+	if len(*revoked) != 1 || (*revoked)[0].Get("token") != "rt" {
+		t.Errorf("revocations = %v, want the refresh token", *revoked)
+	}
+}
+
+// Re-authorizing under the same client doesn't revoke the old grant: some
+// providers would revoke the new one along with it.
+func TestRevokeSupersededGrant(t *testing.T) {
+	mcpURL, revoked := oauthASWithRevocation(t, true)
+	m := ExternalMcp{ID: "gh", Transport: "http", URL: mcpURL, OAuthState: &OAuthState{ClientID: "c1", RefreshToken: "rt-old"}}
+
+	if ok, err := revokeSupersededGrant(m, &OAuthState{ClientID: "c1", RefreshToken: "rt-new"}); ok || err != nil {
+		t.Fatalf("same client: revokeSupersededGrant = %v, %v; want nothing revoked", ok, err)
+	}
+	if len(*revoked) != 0 {
+		t.Fatalf("same client: revocations = %v, want none", *revoked)
+	}
+
+	if ok, err := revokeSupersededGrant(m, &OAuthState{ClientID: "c2", RefreshToken: "rt-new"}); !ok || err != nil {
+		t.Fatalf("new client: revokeSupersededGrant = %v, %v", ok, err)
+	}
+	if len(*revoked) != 1 || (*revoked)[0].Get("token") != "rt-old" {
+		t.Errorf("new client: revocations = %v, want the old refresh token", *revoked)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessStats is one sample of a managed child's resource usage, summed over
+// everything it runs: the root process, its descendants, and anything else in
+// its process group. Services and stdio MCPs are launched Setpgid behind a
+// `/bin/sh -l -c` wrapper, so the root PID is a shell and the real workload
+// lives below it — the root alone would report a few hundred KB and no CPU.
+//
+// CPU is cumulative user+system time, so a rate needs two samples (see
+// MetricsHistory). Procs is zero when the root was not found at all, which
+// is how callers tell "exited between listing and sampling" from "idle".
+type ProcessStats struct {
+	RSS   uint64        // resident memory, bytes
+	CPU   time.Duration // cumulative CPU time
+	Procs int           // live processes counted
+}
+
+// procInfo is one row of the platform's process table, as read by
+// readProcessTable.
+type procInfo struct {
+	pid, ppid, pgid int
+	rss             uint64
+	cpu             time.Duration
+}
+
+// SampleProcessStats returns the stats of each root PID's process tree and
+// group. One pass over the process table per call, however many roots;
+// returns an empty map if the table can't be read rather than partial data.
+func SampleProcessStats(rootPIDs []int) map[int]ProcessStats {
+	if len(rootPIDs) == 0 {
+		return map[int]ProcessStats{}
+	}
+	procs, ok := readProcessTable()
+	if !ok {
+		return map[int]ProcessStats{}
+	}
+	return sumProcessGroups(procs, rootPIDs)
+}
+
+// sumProcessGroups totals procs for each root: the root itself, every
+// descendant (even one that moved to its own group), and every member of the
+// root's group when the root leads it (even one reparented away from the
+// tree, e.g. a daemonized grandchild). Each process counts once per root.
+func sumProcessGroups(procs []procInfo, roots []int) map[int]ProcessStats {
+	byPID := make(map[int]procInfo, len(procs))
+	children := make(map[int][]int, len(procs))
+	groups := make(map[int][]int, len(procs))
+	for _, p := range procs {
+		byPID[p.pid] = p
+		children[p.ppid] = append(children[p.ppid], p.pid)
+		groups[p.pgid] = append(groups[p.pgid], p.pid)
+	}
+
+	out := make(map[int]ProcessStats, len(roots))
+	for _, root := range roots {
+		rp, ok := byPID[root]
+		if !ok {
+			// Root is dead or not visible; report zero so callers can distinguish.
+			out[root] = ProcessStats{}
+			continue
+		}
+		queue := []int{root}
+		if rp.pgid == root {
+			queue = append(queue, groups[root]...)
+		}
+		var st ProcessStats
+		seen := make(map[int]struct{}, 16)
+		for len(queue) > 0 {
+			pid := queue[0]
+			queue = queue[1:]
+			if _, dup := seen[pid]; dup {
+				continue
+			}
+			seen[pid] = struct{}{}
+			p := byPID[pid]
+			st.RSS += p.rss
+			st.CPU += p.cpu
+			st.Procs++
+			queue = append(queue, children[pid]...)
+		}
+		out[root] = st
+	}
+	return out
+}
+
+// parsePsTime parses ps's cumulative CPU time column, "[[dd-]hh:]mm:ss[.ss]"
+// ("0:01.25" on macOS, "01:02:03" or "2-01:02:03" elsewhere).
+func parsePsTime(s string) (time.Duration, error) {
+	var days int
+	rest := s
+	if d, r, ok := strings.Cut(s, "-"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil {
+			return 0, fmt.Errorf("cpu time %q: bad day count", s)
+		}
+		days, rest = n, r
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("cpu time %q: want [hh:]mm:ss", s)
+	}
+	secs, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || secs < 0 {
+		return 0, fmt.Errorf("cpu time %q: bad seconds", s)
+	}
+	total := time.Duration(days) * 24 * time.Hour
+	total += time.Duration(secs * float64(time.Second))
+	unit := time.Minute
+	for i := len(parts) - 2; i >= 0; i-- {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("cpu time %q: bad field %q", s, parts[i])
+		}
+		total += time.Duration(n) * unit
+		unit = time.Hour
+	}
+	return total, nil
+}
@@ -11,74 +11,45 @@ import (
 	"time"
 )
 
-// SampleRSSByRoot returns, for each root PID, the total resident memory (bytes)
-// of that process and all of its descendants. Services in relay are launched
-// via `/bin/sh -l -c '...'`, so the canonical PID is a shell wrapper and the
-// real workload lives one level down — summing the subtree is what matters.
-//
-// Implementation: one `ps -axo pid=,ppid=,rss=` call per invocation (~5 ms on
-// macOS), parsed in-process, then BFS from each root summing RSS. Returns an
-// empty map on failure rather than partial data.
-func SampleRSSByRoot(rootPIDs []int) map[int]uint64 {
-	if len(rootPIDs) == 0 {
-		return map[int]uint64{}
-	}
-
+// readProcessTable lists every process via one `ps -axo
+// pid=,ppid=,pgid=,rss=,time=` call (~5 ms on macOS), parsed in-process.
+// macOS has no /proc, and libproc would need cgo for what ps already does.
+func readProcessTable() ([]procInfo, bool) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
-	out, err := exec.CommandContext(ctx, "ps", "-axo", "pid=,ppid=,rss=").Output()
+	out, err := exec.CommandContext(ctx, "ps", "-axo", "pid=,ppid=,pgid=,rss=,time=").Output()
 	if err != nil {
-		slog.Warn("rss sample: ps failed", "error", err)
-		return map[int]uint64{}
+		slog.Warn("process sample: ps failed", "error", err)
+		return nil, false
 	}
 
-	// rss is in KB on macOS; multiply by 1024 at the end.
-	rssKB := make(map[int]uint64, 256)
-	children := make(map[int][]int, 256)
-
+	procs := make([]procInfo, 0, 256)
 	for _, line := range strings.Split(string(out), "\n") {
 		fields := strings.Fields(line)
-		if len(fields) < 3 {
+		if len(fields) < 5 {
 			continue
 		}
-		pid, err := strconv.Atoi(fields[0])
-		if err != nil {
+		var p procInfo
+		var err error
+		if p.pid, err = strconv.Atoi(fields[0]); err != nil {
 			continue
 		}
-		ppid, err := strconv.Atoi(fields[1])
-		if err != nil {
+		if p.ppid, err = strconv.Atoi(fields[1]); err != nil {
 			continue
 		}
-		rss, err := strconv.ParseUint(fields[2], 10, 64)
-		if err != nil {
+		if p.pgid, err = strconv.Atoi(fields[2]); err != nil {
 			continue
 		}
-		rssKB[pid] = rss
-		children[ppid] = append(children[ppid], pid)
-	}
-
-	result := make(map[int]uint64, len(rootPIDs))
-	for _, root := range rootPIDs {
-		if _, ok := rssKB[root]; !ok {
-			// Root is dead or not visible; report zero so callers can distinguish.
-			result[root] = 0
+		rssKB, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
 			continue
 		}
-		var sumKB uint64
-		visited := make(map[int]struct{}, 16)
-		queue := []int{root}
-		for len(queue) > 0 {
-			pid := queue[0]
-			queue = queue[1:]
-			if _, seen := visited[pid]; seen {
-				continue
-			}
-			visited[pid] = struct{}{}
-			sumKB += rssKB[pid]
-			queue = append(queue, children[pid]...)
+		p.rss = rssKB * 1024
+		if p.cpu, err = parsePsTime(fields[4]); err != nil {
+			continue
 		}
-		result[root] = sumKB * 1024
+		procs = append(procs, p)
 	}
-	return result
+	return procs, true
 }
@@ -0,0 +1,97 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// procClockTicks is USER_HZ, the unit of /proc/<pid>/stat's CPU times. The
+// kernel fixes it at 100 for userspace on every architecture Go supports, so
+// it is a constant rather than a sysconf(_SC_CLK_TCK) call that would need cgo.
+const procClockTicks = 100
+
+// readProcessTable lists every process from /proc/<pid>/stat. A process that
+// exits between the directory read and its stat read is skipped; that's the
+// same race ps has.
+func readProcessTable() ([]procInfo, bool) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, false
+	}
+	pageSize := uint64(os.Getpagesize())
+	procs := make([]procInfo, 0, len(entries))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile("/proc/" + e.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		p, err := parseProcStat(data, pageSize)
+		if err != nil || p.pid != pid {
+			continue
+		}
+		procs = append(procs, p)
+	}
+	return procs, true
+}
+
+// parseProcStat parses one /proc/<pid>/stat line (proc(5)). The command name
+// (field 2) is parenthesised and may itself contain spaces and parentheses,
+// so the remaining fields are split after its LAST ')'.
+//
+// CPU counts the process's own user+system time plus that of its reaped
+// children (cutime, cstime): when a service's short-lived child exits and
+// the shell waits for it, the child's CPU moves into the shell's counters
+// instead of vanishing from the group total and making the rate go negative.
+func parseProcStat(data []byte, pageSize uint64) (procInfo, error) {
+	open := bytes.IndexByte(data, '(')
+	end := bytes.LastIndexByte(data, ')')
+	if open < 0 || end < open {
+		return procInfo{}, fmt.Errorf("malformed stat line")
+	}
+	var p procInfo
+	var err error
+	if p.pid, err = strconv.Atoi(string(bytes.TrimSpace(data[:open]))); err != nil {
+		return procInfo{}, fmt.Errorf("pid: %w", err)
+	}
+	// fields[0] is field 3 (state).
+	fields := bytes.Fields(data[end+1:])
+	if len(fields) < 22 {
+		return procInfo{}, fmt.Errorf("stat line has %d fields after comm", len(fields))
+	}
+	field := func(n int) (uint64, error) { return strconv.ParseUint(string(fields[n-3]), 10, 64) }
+	ppid, err := field(4)
+	if err != nil {
+		return procInfo{}, fmt.Errorf("ppid: %w", err)
+	}
+	pgid, err := field(5)
+	if err != nil {
+		return procInfo{}, fmt.Errorf("pgrp: %w", err)
+	}
+	var ticks uint64
+	for n := 14; n <= 17; n++ { // utime, stime, cutime, cstime
+		t, err := field(n)
+		if err != nil {
+			return procInfo{}, fmt.Errorf("cpu field %d: %w", n, err)
+		}
+		ticks += t
+	}
+	rss, err := strconv.ParseInt(string(fields[24-3]), 10, 64)
+	if err != nil {
+		return procInfo{}, fmt.Errorf("rss: %w", err)
+	}
+	p.ppid, p.pgid = int(ppid), int(pgid)
+	p.cpu = time.Duration(ticks) * time.Second / procClockTicks
+	if rss > 0 {
+		p.rss = uint64(rss) * pageSize
+	}
+	return p, nil
+}
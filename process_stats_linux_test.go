@@ -0,0 +1,54 @@
+//go:build linux
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	// comm may contain spaces and parentheses; fields resume after the last ')'.
+	line := "4242 (my (odd) prog) S 4241 4240 4240 0 -1 4194560 100 0 0 0 " +
+		"150 50 20 30 20 0 3 0 12345 123456789 512 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0 0 0 0\n"
+	p, err := parseProcStat([]byte(line), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := procInfo{pid: 4242, ppid: 4241, pgid: 4240, rss: 512 * 4096, cpu: 2500 * time.Millisecond}
+	if p != want {
+		t.Fatalf("parseProcStat = %+v, want %+v", p, want)
+	}
+	if _, err := parseProcStat([]byte("4242 (short) S 1 2"), 4096); err == nil {
+		t.Fatal("truncated line accepted")
+	}
+}
+
+func TestSampleProcessStats_CountsProcessGroup(t *testing.T) {
+	// Launched the way services are: Setpgid behind a shell, real work below.
+	cmd := exec.Command("/bin/sh", "-c", "sleep 30 & sleep 30 & while :; do :; done")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		_ = cmd.Wait()
+	})
+	pid := cmd.Process.Pid
+
+	var st ProcessStats
+	waitFor(t, 5*time.Second, "group of 3 with CPU time", func() bool {
+		st = SampleProcessStats([]int{pid})[pid]
+		return st.Procs == 3 && st.CPU > 0
+	})
+	if st.RSS == 0 {
+		t.Fatalf("no resident memory counted: %+v", st)
+	}
+
+	if got := SampleProcessStats([]int{1 << 30}); got[1<<30] != (ProcessStats{}) {
+		t.Fatalf("nonexistent root = %+v", got[1<<30])
+	}
+}
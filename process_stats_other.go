@@ -1,7 +1,9 @@
-//go:build !darwin
+//go:build !darwin && !linux
 
 package main
 
-func SampleRSSByRoot(rootPIDs []int) map[int]uint64 {
-	return map[int]uint64{}
+// readProcessTable has no implementation here; SampleProcessStats reports
+// nothing and the tray simply shows no usage figures.
+func readProcessTable() ([]procInfo, bool) {
+	return nil, false
 }
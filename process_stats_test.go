@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSumProcessGroups(t *testing.T) {
+	procs := []procInfo{
+		{pid: 1, ppid: 0, pgid: 1, rss: 1000, cpu: time.Second},
+		// Service 100: shell wrapper leading its group, a worker below it, a
+		// grandchild that moved to its own group, and a daemonized member of
+		// the group reparented to init.
+		{pid: 100, ppid: 1, pgid: 100, rss: 10, cpu: 10 * time.Millisecond},
+		{pid: 101, ppid: 100, pgid: 100, rss: 200, cpu: time.Second},
+		{pid: 102, ppid: 101, pgid: 102, rss: 30, cpu: 2 * time.Second},
+		{pid: 103, ppid: 1, pgid: 100, rss: 4, cpu: 0},
+		// Service 200 is not a group leader: only its tree counts.
+		{pid: 200, ppid: 1, pgid: 1, rss: 50, cpu: time.Second},
+		{pid: 201, ppid: 200, pgid: 1, rss: 5, cpu: time.Second},
+	}
+	got := sumProcessGroups(procs, []int{100, 200, 999})
+
+	if want := (ProcessStats{RSS: 244, CPU: 3010 * time.Millisecond, Procs: 4}); got[100] != want {
+		t.Errorf("group 100 = %+v, want %+v", got[100], want)
+	}
+	if want := (ProcessStats{RSS: 55, CPU: 2 * time.Second, Procs: 2}); got[200] != want {
+		t.Errorf("tree 200 = %+v, want %+v", got[200], want)
+	}
+	if st, ok := got[999]; !ok || st != (ProcessStats{}) {
+		t.Errorf("dead root = %+v, %v; want a zero entry", st, ok)
+	}
+}
+
+func TestParsePsTime(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"0:01.25":    1250 * time.Millisecond,
+		"12:34.00":   12*time.Minute + 34*time.Second,
+		"01:02:03":   time.Hour + 2*time.Minute + 3*time.Second,
+		"2-01:02:03": 49*time.Hour + 2*time.Minute + 3*time.Second,
+	} {
+		got, err := parsePsTime(in)
+		if err != nil || got != want {
+			t.Errorf("parsePsTime(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "12", "a:00", "1:2:3:4", "x-00:01"} {
+		if _, err := parsePsTime(in); err == nil {
+			t.Errorf("parsePsTime(%q) accepted", in)
+		}
+	}
+}
@@ -80,7 +80,9 @@ func RegisterProjectRoutes(mux *http.ServeMux, store SettingsStore, mcps Context
 		}
 	}
 	mux.HandleFunc("GET /api/projects", func(w http.ResponseWriter, r *http.Request) {
-		projects := store.Get().Projects
+		// A scoped credential sees only its own projects; frontendScope
+		// refuses the per-project routes for the rest.
+		projects := frontendProjectsFor(r.Context(), store.Get().Projects)
 		if projects == nil {
 			projects = []Project{}
 		}
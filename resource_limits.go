@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Per-child resource limits for managed services and stdio MCPs.
+//
+// Two mechanisms, picked per spawn:
+//
+//   - cgroup v2 (Linux, when relay's own cgroup is delegated to it): each
+//     child gets a sub-cgroup with memory.max, cpu.max and pids.max, and is
+//     cloned straight into it, so nothing it forks ever runs unlimited. An
+//     OOM kill shows up in memory.events, which is how a limit-triggered
+//     death is told apart from an ordinary crash.
+//   - rlimits, everywhere: the child is started through `relay
+//     __limits-exec`, which sets RLIMIT_NOFILE (and RLIMIT_DATA as the memory
+//     bound when there is no cgroup) and execs the real command. Go can't run
+//     code between fork and exec, so a re-exec is the only way to hand a
+//     child limits the parent doesn't share.
+//
+// cpu_percent and processes have no per-process rlimit equivalent
+// (RLIMIT_NPROC counts every process the user owns, not the child's), so
+// without a cgroup they are reported as unenforced rather than approximated.
+
+// ResourceLimits bounds one service or MCP (`limits` in settings.json). Zero
+// fields are unlimited.
+type ResourceLimits struct {
+	// MemoryMB caps resident + swap memory of the whole process tree.
+	MemoryMB int64 `json:"memory_mb,omitempty"`
+	// CPUPercent throttles the tree to this share of one core (200 = two
+	// cores). Throttling, not killing: a busy child slows down.
+	CPUPercent int `json:"cpu_percent,omitempty"`
+	// OpenFiles caps file descriptors per process (RLIMIT_NOFILE).
+	OpenFiles int `json:"open_files,omitempty"`
+	// Processes caps live processes + threads in the tree.
+	Processes int `json:"processes,omitempty"`
+}
+
+// active reports whether l sets any limit. Nil-safe.
+func (l *ResourceLimits) active() bool {
+	return l != nil && (l.MemoryMB > 0 || l.CPUPercent > 0 || l.OpenFiles > 0 || l.Processes > 0)
+}
+
+// validate rejects limits that are negative or too small to start anything:
+// a shell, a dynamic loader and a runtime need a handful of descriptors and
+// a few MB before the child's own code runs.
+func (l *ResourceLimits) validate() error {
+	if l == nil {
+		return nil
+	}
+	switch {
+	case l.MemoryMB < 0 || l.CPUPercent < 0 || l.OpenFiles < 0 || l.Processes < 0:
+		return fmt.Errorf("resource limits must not be negative")
+	case l.MemoryMB > 0 && l.MemoryMB < 8:
+		return fmt.Errorf("memory_mb %d is too small (minimum 8)", l.MemoryMB)
+	case l.OpenFiles > 0 && l.OpenFiles < 16:
+		return fmt.Errorf("open_files %d is too small (minimum 16)", l.OpenFiles)
+	}
+	return nil
+}
+
+// String renders the set limits compactly for list output, or "-".
+func (l *ResourceLimits) String() string {
+	if !l.active() {
+		return "-"
+	}
+	var parts []string
+	if l.MemoryMB > 0 {
+		parts = append(parts, fmt.Sprintf("mem=%dM", l.MemoryMB))
+	}
+	if l.CPUPercent > 0 {
+		parts = append(parts, fmt.Sprintf("cpu=%d%%", l.CPUPercent))
+	}
+	if l.OpenFiles > 0 {
+		parts = append(parts, fmt.Sprintf("files=%d", l.OpenFiles))
+	}
+	if l.Processes > 0 {
+		parts = append(parts, fmt.Sprintf("procs=%d", l.Processes))
+	}
+	return strings.Join(parts, ",")
+}
+
+// limitsExecCommand is the hidden relay subcommand that applies rlimits and
+// execs the child (resource_limits_unix.go). Dispatched first thing in main.
+const limitsExecCommand = "__limits-exec"
+
+// cgroupControllers are the controllers a child cgroup needs. relay only
+// uses cgroups when its subtree can enable all three; a partial set would
+// make which limits hold depend on the machine.
+var cgroupControllers = []string{"cpu", "memory", "pids"}
+
+// cgroupCPUPeriod is the cpu.max period, in microseconds (the kernel default).
+const cgroupCPUPeriod = 100000
+
+// cgroupLimitFiles maps interface file → value for the limits a cgroup
+// enforces. Swap is pinned to zero so a memory cap means a kill at the cap,
+// not a slow slide into swap; oom.group makes that kill take the whole tree,
+// so a service's shell doesn't outlive its OOM-killed workload.
+func cgroupLimitFiles(l *ResourceLimits) map[string]string {
+	files := map[string]string{}
+	if l.MemoryMB > 0 {
+		files["memory.max"] = strconv.FormatInt(l.MemoryMB<<20, 10)
+		files["memory.swap.max"] = "0"
+		files["memory.oom.group"] = "1"
+	}
+	if l.CPUPercent > 0 {
+		files["cpu.max"] = fmt.Sprintf("%d %d", l.CPUPercent*cgroupCPUPeriod/100, cgroupCPUPeriod)
+	}
+	if l.Processes > 0 {
+		files["pids.max"] = strconv.Itoa(l.Processes)
+	}
+	return files
+}
+
+// childCgroup is one child's cgroup directory under relay's root.
+type childCgroup struct {
+	dir string
+}
+
+// cgroupSeq keeps child cgroup names unique across restarts of the same
+// child: the previous instance's directory may not be removed yet.
+var cgroupSeq atomic.Uint64
+
+// newChildCgroup creates root/<name>.<seq> and writes l into it.
+func newChildCgroup(root, name string, l *ResourceLimits) (*childCgroup, error) {
+	dir := filepath.Join(root, fmt.Sprintf("%s.%d", name, cgroupSeq.Add(1)))
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return nil, err
+	}
+	cg := &childCgroup{dir: dir}
+	for file, value := range cgroupLimitFiles(l) {
+		if err := writeCgroupFile(filepath.Join(dir, file), value); err != nil {
+			// memory.swap.max is absent without swap accounting; there is
+			// no swap to pin to zero then.
+			if file == "memory.swap.max" && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			cg.remove()
+			return nil, fmt.Errorf("set %s: %w", file, err)
+		}
+	}
+	return cg, nil
+}
+
+// writeCgroupFile writes one cgroup interface file. Never creates: a missing
+// file means the controller or kernel feature isn't there, and creating a
+// regular file in its place would hide that.
+func writeCgroupFile(path, value string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// limitEvents are the limit hits a child's cgroup recorded over its life.
+type limitEvents struct {
+	OOMKills int // memory.events oom_kill: the kernel killed for memory.max
+	PidsMax  int // pids.events max: a fork was refused at pids.max
+}
+
+// events reads the cgroup's event counters. Missing files read as zero.
+func (cg *childCgroup) events() limitEvents {
+	return limitEvents{
+		OOMKills: readCgroupCounter(filepath.Join(cg.dir, "memory.events"), "oom_kill"),
+		PidsMax:  readCgroupCounter(filepath.Join(cg.dir, "pids.events"), "max"),
+	}
+}
+
+// readCgroupCounter returns the value of key in a flat-keyed cgroup file
+// ("key value" per line).
+func readCgroupCounter(path, key string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if k, v, ok := strings.Cut(sc.Text(), " "); ok && k == key {
+			n, _ := strconv.Atoi(strings.TrimSpace(v))
+			return n
+		}
+	}
+	return 0
+}
+
+// remove kills anything still in the cgroup and deletes it. A child's main
+// process exiting doesn't end processes it left behind; cgroup.kill (Linux
+// 5.14+) does, and an empty cgroup is the only kind rmdir accepts.
+func (cg *childCgroup) remove() {
+	_ = writeCgroupFile(filepath.Join(cg.dir, "cgroup.kill"), "1")
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := os.Remove(cg.dir)
+		if err == nil || errors.Is(err, os.ErrNotExist) || time.Now().After(deadline) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// childLimits is the enforcement attached to one spawned child.
+type childLimits struct {
+	cgroup *childCgroup // nil when only rlimits apply
+	// closeFD releases the cgroup directory fd handed to clone; called once
+	// the child has started (or failed to).
+	closeFD func()
+}
+
+// started releases spawn-time resources. Nil-safe.
+func (c *childLimits) started() {
+	if c != nil && c.closeFD != nil {
+		c.closeFD()
+		c.closeFD = nil
+	}
+}
+
+// finish collects the limit events and tears the cgroup down once the child
+// has exited. Nil-safe.
+func (c *childLimits) finish() limitEvents {
+	if c == nil || c.cgroup == nil {
+		return limitEvents{}
+	}
+	ev := c.cgroup.events()
+	c.cgroup.remove()
+	return ev
+}
+
+// childExit records how a managed child ended, for status displays.
+type childExit struct {
+	// Status is a one-line description: "exited: status 1", "killed: signal
+	// terminated", "killed: memory limit exceeded".
+	Status string `json:"status"`
+	// Limit names the resource limit that killed the child ("memory"), or
+	// "" when the exit had nothing to do with a limit.
+	Limit string    `json:"limit,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+// describeExit classifies a child's exit from its Wait error and cgroup
+// events. An OOM kill is reported as the memory limit whatever signal the
+// kernel used, so the cause is never mistaken for a crash.
+func describeExit(waitErr error, ev limitEvents) childExit {
+	out := childExit{At: time.Now()}
+	var exitErr *exec.ExitError
+	switch {
+	case ev.OOMKills > 0:
+		out.Status, out.Limit = "killed: memory limit exceeded", "memory"
+	case waitErr == nil:
+		out.Status = "exited: status 0"
+	case errors.As(waitErr, &exitErr):
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			out.Status = "killed: signal " + ws.Signal().String()
+		} else {
+			out.Status = fmt.Sprintf("exited: status %d", exitErr.ExitCode())
+		}
+	default:
+		out.Status = waitErr.Error()
+	}
+	if ev.PidsMax > 0 && out.Limit == "" {
+		// Not a kill — the fork just failed — but the likeliest reason the
+		// child gave up, so say so.
+		out.Status += " (hit process limit)"
+		if waitErr != nil {
+			out.Limit = "processes"
+		}
+	}
+	return out
+}
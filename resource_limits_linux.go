@@ -0,0 +1,132 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// cgroupMount is where the unified (v2) hierarchy is mounted.
+const cgroupMount = "/sys/fs/cgroup"
+
+var (
+	cgroupRootOnce sync.Once
+	cgroupRootDir  string
+	cgroupRootErr  error
+)
+
+// relayCgroupRoot returns the cgroup under which child cgroups are created,
+// setting it up on first use. The layout, under relay's own cgroup C:
+//
+//	C/tray            relay itself
+//	C/service-<id>.N  one per running service
+//	C/mcp-<id>.N      one per running stdio MCP
+//
+// relay has to leave C because cgroup v2 forbids processes in a cgroup that
+// hands controllers to its children. That's only safe when relay is alone in
+// C — a systemd user service with Delegate=yes, or a scope of its own. Run
+// from a terminal, C is the terminal's scope and holds the shell too;
+// moving out would leave the shell stranded under relay's controllers, so
+// relay declines and children fall back to rlimits.
+func relayCgroupRoot() (string, error) {
+	cgroupRootOnce.Do(func() {
+		cgroupRootDir, cgroupRootErr = setupCgroupRoot()
+	})
+	return cgroupRootDir, cgroupRootErr
+}
+
+func setupCgroupRoot() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 is not mounted at %s", cgroupMount)
+	}
+	own, err := ownCgroupPath()
+	if err != nil {
+		return "", err
+	}
+	root := filepath.Join(cgroupMount, own)
+
+	available, err := os.ReadFile(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+	have := strings.Fields(string(available))
+	for _, c := range cgroupControllers {
+		if !slices.Contains(have, c) {
+			return "", fmt.Errorf("cgroup %s does not delegate the %s controller", own, c)
+		}
+	}
+
+	procs, err := os.ReadFile(filepath.Join(root, "cgroup.procs"))
+	if err != nil {
+		return "", err
+	}
+	self := strconv.Itoa(os.Getpid())
+	for _, pid := range strings.Fields(string(procs)) {
+		if pid != self {
+			return "", fmt.Errorf("relay shares cgroup %s with other processes; run it as a systemd user service with Delegate=yes", own)
+		}
+	}
+
+	tray := filepath.Join(root, "tray")
+	if err := os.Mkdir(tray, 0o755); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	if err := writeCgroupFile(filepath.Join(tray, "cgroup.procs"), self); err != nil {
+		return "", fmt.Errorf("move relay into %s: %w", tray, err)
+	}
+	enable := "+" + strings.Join(cgroupControllers, " +")
+	if err := writeCgroupFile(filepath.Join(root, "cgroup.subtree_control"), enable); err != nil {
+		// Put relay back where it was so a failed setup changes nothing.
+		_ = writeCgroupFile(filepath.Join(root, "cgroup.procs"), self)
+		return "", fmt.Errorf("enable controllers in %s: %w", own, err)
+	}
+
+	// Child cgroups left by a previous session that crashed. Empty ones go;
+	// ones still holding orphans stay (rmdir refuses) for ReclaimOrphans.
+	if entries, err := os.ReadDir(root); err == nil {
+		for _, e := range entries {
+			if e.IsDir() && (strings.HasPrefix(e.Name(), "service-") || strings.HasPrefix(e.Name(), "mcp-")) {
+				_ = os.Remove(filepath.Join(root, e.Name()))
+			}
+		}
+	}
+	return root, nil
+}
+
+// ownCgroupPath returns this process's path in the unified hierarchy.
+func ownCgroupPath() (string, error) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("process is not in a cgroup v2 hierarchy")
+}
+
+// attachCgroup makes cmd's child start inside cg (clone3 CLONE_INTO_CGROUP),
+// so there is no window in which it, or anything it forks first, runs
+// outside the limits. The returned func closes the directory fd.
+func attachCgroup(cmd *exec.Cmd, cg *childCgroup) (func(), error) {
+	fd, err := syscall.Open(cg.dir, syscall.O_DIRECTORY|syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+	return func() { syscall.Close(fd) }, nil
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// relayCgroupRoot: cgroups are Linux-only; elsewhere limits are rlimits.
+func relayCgroupRoot() (string, error) {
+	return "", fmt.Errorf("cgroups are not available on %s", runtime.GOOS)
+}
+
+func attachCgroup(cmd *exec.Cmd, cg *childCgroup) (func(), error) {
+	return nil, fmt.Errorf("cgroups are not available on %s", runtime.GOOS)
+}
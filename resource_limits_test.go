@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResourceLimits_Validate(t *testing.T) {
+	ok := []*ResourceLimits{
+		nil,
+		{},
+		{MemoryMB: 512, CPUPercent: 50, OpenFiles: 256, Processes: 64},
+		{CPUPercent: 400},
+	}
+	for i, l := range ok {
+		if err := l.validate(); err != nil {
+			t.Errorf("ok[%d]: %v", i, err)
+		}
+	}
+
+	bad := map[string]*ResourceLimits{
+		"negative memory":  {MemoryMB: -1},
+		"negative procs":   {Processes: -5},
+		"tiny memory":      {MemoryMB: 4},
+		"tiny open files":  {OpenFiles: 3},
+		"negative cpu pct": {CPUPercent: -10},
+	}
+	for name, l := range bad {
+		if err := l.validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+}
+
+func TestResourceLimits_ValidatedWithConfigs(t *testing.T) {
+	mcp := &ExternalMcp{ID: "m", DisplayName: "M", Command: "/bin/true", Limits: &ResourceLimits{OpenFiles: 2}}
+	if err := mcp.Validate(); err == nil {
+		t.Error("MCP with open_files=2 validated")
+	}
+	svc := &ServiceConfig{ID: "s", DisplayName: "S", Command: "/bin/true", Limits: &ResourceLimits{MemoryMB: -1}}
+	if err := svc.Validate(); err == nil {
+		t.Error("service with negative memory validated")
+	}
+}
+
+func TestResourceLimits_String(t *testing.T) {
+	cases := []struct {
+		l    *ResourceLimits
+		want string
+	}{
+		{nil, "-"},
+		{&ResourceLimits{}, "-"},
+		{&ResourceLimits{MemoryMB: 512, CPUPercent: 50, OpenFiles: 256, Processes: 64}, "mem=512M,cpu=50%,files=256,procs=64"},
+		{&ResourceLimits{OpenFiles: 32}, "files=32"},
+	}
+	for _, c := range cases {
+		if got := c.l.String(); got != c.want {
+			t.Errorf("%+v: got %q, want %q", c.l, got, c.want)
+		}
+	}
+}
+
+func TestCgroupLimitFiles(t *testing.T) {
+	got := cgroupLimitFiles(&ResourceLimits{MemoryMB: 256, CPUPercent: 150, Processes: 32, OpenFiles: 64})
+	want := map[string]string{
+		"memory.max":       "268435456",
+		"memory.swap.max":  "0",
+		"memory.oom.group": "1",
+		"cpu.max":          "150000 100000",
+		"pids.max":         "32",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+	// open_files is an rlimit, never a cgroup file.
+	if files := cgroupLimitFiles(&ResourceLimits{OpenFiles: 64}); len(files) != 0 {
+		t.Errorf("open_files alone produced cgroup files: %v", files)
+	}
+}
+
+// TestChildCgroup_FailedSetupCleansUp drives newChildCgroup against a plain
+// directory standing in for relay's cgroup root. The kernel populates a new
+// cgroup's interface files; a plain mkdir doesn't, so every write fails —
+// which must surface as an error, not create regular files, and must not
+// leave the half-made cgroup behind.
+func TestChildCgroup_FailedSetupCleansUp(t *testing.T) {
+	root := t.TempDir()
+	if _, err := newChildCgroup(root, "service-bare", &ResourceLimits{Processes: 8}); err == nil {
+		t.Fatal("newChildCgroup succeeded without pids.max")
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Fatalf("failed cgroup left behind: %v", entries)
+	}
+
+	// Two children of the same name get distinct directories, so a restart
+	// never collides with a predecessor still being torn down.
+	a, err := newChildCgroup(root, "mcp-fs", &ResourceLimits{OpenFiles: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newChildCgroup(root, "mcp-fs", &ResourceLimits{OpenFiles: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.dir == b.dir || !strings.HasPrefix(filepath.Base(a.dir), "mcp-fs.") {
+		t.Fatalf("cgroup dirs %q, %q", a.dir, b.dir)
+	}
+	a.remove()
+	b.remove()
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Fatalf("remove left %v", entries)
+	}
+}
+
+func TestReadCgroupCounter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "memory.events")
+	if err := os.WriteFile(path, []byte("low 0\nhigh 0\nmax 12\noom 2\noom_kill 1\noom_group_kill 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readCgroupCounter(path, "oom_kill"); got != 1 {
+		t.Errorf("oom_kill = %d, want 1", got)
+	}
+	if got := readCgroupCounter(path, "max"); got != 12 {
+		t.Errorf("max = %d, want 12", got)
+	}
+	if got := readCgroupCounter(path, "absent"); got != 0 {
+		t.Errorf("absent key = %d, want 0", got)
+	}
+	if got := readCgroupCounter(filepath.Join(dir, "missing"), "oom_kill"); got != 0 {
+		t.Errorf("missing file = %d, want 0", got)
+	}
+
+	cg := &childCgroup{dir: dir}
+	if err := os.WriteFile(filepath.Join(dir, "pids.events"), []byte("max 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ev := cg.events(); ev != (limitEvents{OOMKills: 1, PidsMax: 3}) {
+		t.Errorf("events = %+v", ev)
+	}
+}
+
+func TestDescribeExit(t *testing.T) {
+	exitErr := func(script string) error {
+		err := exec.Command("/bin/sh", "-c", script).Run()
+		if err == nil {
+			t.Fatalf("%q exited 0", script)
+		}
+		return err
+	}
+	status3 := exitErr("exit 3")
+	killed := exitErr("kill -KILL $$")
+
+	cases := []struct {
+		name       string
+		err        error
+		ev         limitEvents
+		wantStatus string
+		wantLimit  string
+	}{
+		{"clean", nil, limitEvents{}, "exited: status 0", ""},
+		{"status", status3, limitEvents{}, "exited: status 3", ""},
+		{"signal", killed, limitEvents{}, "killed: signal killed", ""},
+		// The kernel's OOM kill is a SIGKILL; the cgroup event is what
+		// tells it apart from someone running kill -9.
+		{"oom", killed, limitEvents{OOMKills: 1}, "killed: memory limit exceeded", "memory"},
+		{"pids failure", status3, limitEvents{PidsMax: 2}, "exited: status 3 (hit process limit)", "processes"},
+		{"pids survived", nil, limitEvents{PidsMax: 1}, "exited: status 0 (hit process limit)", ""},
+	}
+	for _, c := range cases {
+		got := describeExit(c.err, c.ev)
+		if got.Status != c.wantStatus || got.Limit != c.wantLimit {
+			t.Errorf("%s: got (%q, %q), want (%q, %q)", c.name, got.Status, got.Limit, c.wantStatus, c.wantLimit)
+		}
+		if got.At.IsZero() {
+			t.Errorf("%s: At not set", c.name)
+		}
+	}
+}
+
+func TestChildLimits_NilSafe(t *testing.T) {
+	var l *childLimits
+	l.started()
+	if ev := l.finish(); ev != (limitEvents{}) {
+		t.Errorf("nil finish = %+v", ev)
+	}
+	if ev := (&childLimits{}).finish(); ev != (limitEvents{}) {
+		t.Errorf("rlimit-only finish = %+v", ev)
+	}
+}
@@ -0,0 +1,130 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// rlimitPlan is what the __limits-exec helper sets before exec'ing the
+// child. Zero fields are left alone.
+type rlimitPlan struct {
+	OpenFiles uint64 `json:"open_files,omitempty"`
+	DataBytes uint64 `json:"data_bytes,omitempty"`
+}
+
+// applyResourceLimits arranges for cmd's child to run under l; name
+// ("service-eve", "mcp-fs") names its cgroup. Call it last, after any other
+// rewrite of cmd (the sandbox included), so the limits wrap everything the
+// child becomes. Returns nil, nil when l sets nothing.
+//
+// The caller owns the result: started() once cmd.Start returns, finish()
+// once the child has been waited for.
+func applyResourceLimits(cmd *exec.Cmd, l *ResourceLimits, name string) (*childLimits, error) {
+	if !l.active() {
+		return nil, nil
+	}
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+	lim := &childLimits{}
+	var plan rlimitPlan
+	if l.MemoryMB > 0 || l.CPUPercent > 0 || l.Processes > 0 {
+		if root, err := relayCgroupRoot(); err == nil {
+			cg, err := newChildCgroup(root, name, l)
+			if err != nil {
+				return nil, fmt.Errorf("create cgroup: %w", err)
+			}
+			closeFD, err := attachCgroup(cmd, cg)
+			if err != nil {
+				cg.remove()
+				return nil, fmt.Errorf("attach cgroup: %w", err)
+			}
+			lim.cgroup, lim.closeFD = cg, closeFD
+		} else {
+			if l.MemoryMB > 0 {
+				plan.DataBytes = uint64(l.MemoryMB) << 20
+			}
+			var unenforced []string
+			if l.CPUPercent > 0 {
+				unenforced = append(unenforced, "cpu_percent")
+			}
+			if l.Processes > 0 {
+				unenforced = append(unenforced, "processes")
+			}
+			slog.Warn("no cgroup for resource limits; using rlimits",
+				"child", name, "reason", err, "unenforced", strings.Join(unenforced, ","))
+		}
+	}
+	if l.OpenFiles > 0 {
+		plan.OpenFiles = uint64(l.OpenFiles)
+	}
+	if plan == (rlimitPlan{}) {
+		return lim, nil
+	}
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		lim.started()
+		lim.finish()
+		return nil, err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		lim.started()
+		lim.finish()
+		return nil, fmt.Errorf("locate relay binary for limits helper: %w", err)
+	}
+	cmd.Args = append([]string{self, limitsExecCommand, string(data), cmd.Path}, cmd.Args...)
+	cmd.Path = self
+	return lim, nil
+}
+
+// runLimitsHelper is `relay __limits-exec <plan> <path> <argv...>`: set the
+// rlimits, then become the child. Never returns; a setup failure exits 126
+// with the reason on stderr, like a shell that can't exec.
+func runLimitsHelper(args []string) {
+	fail := func(format string, a ...any) {
+		fmt.Fprintf(os.Stderr, "relay limits: "+format+"\n", a...)
+		os.Exit(126)
+	}
+	if len(args) < 3 {
+		fail("malformed helper invocation")
+	}
+	var plan rlimitPlan
+	if err := json.Unmarshal([]byte(args[0]), &plan); err != nil {
+		fail("bad plan: %v", err)
+	}
+	if plan.OpenFiles > 0 {
+		if err := lowerRlimit(syscall.RLIMIT_NOFILE, plan.OpenFiles); err != nil {
+			fail("open_files: %v", err)
+		}
+	}
+	if plan.DataBytes > 0 {
+		if err := lowerRlimit(syscall.RLIMIT_DATA, plan.DataBytes); err != nil {
+			fail("memory: %v", err)
+		}
+	}
+	err := syscall.Exec(args[1], args[2:], os.Environ())
+	fail("exec %s: %v", args[1], err)
+}
+
+// lowerRlimit sets both the soft and hard limit to v, so the child can't
+// raise it back. A v above the current hard limit is clamped to it: what's
+// there is already stricter than what was asked for.
+func lowerRlimit(resource int, v uint64) error {
+	var cur syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &cur); err != nil {
+		return err
+	}
+	if v > cur.Max {
+		v = cur.Max
+	}
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: v, Max: v})
+}
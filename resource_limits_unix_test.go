@@ -0,0 +1,149 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Limits that need an rlimit are applied by re-executing os.Executable() —
+// under `go test` that is the test binary, so it must answer the helper
+// subcommand the way relay's main does.
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == limitsExecCommand {
+		runLimitsHelper(os.Args[2:])
+	}
+}
+
+// runLimited runs a shell script under l and returns its trimmed output.
+func runLimited(t *testing.T, l *ResourceLimits, script string) string {
+	t.Helper()
+	cmd := exec.Command("/bin/sh", "-c", script)
+	lim, err := applyResourceLimits(cmd, l, "service-test")
+	if err != nil {
+		t.Fatalf("applyResourceLimits: %v", err)
+	}
+	out, err := cmd.CombinedOutput()
+	lim.started()
+	lim.finish()
+	if err != nil {
+		t.Fatalf("run: %v\n%s", err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestApplyResourceLimits_OpenFiles(t *testing.T) {
+	if got := runLimited(t, &ResourceLimits{OpenFiles: 32}, "ulimit -n; ulimit -Hn"); got != "32\n32" {
+		t.Fatalf("ulimit -n / -Hn = %q, want 32 and 32", got)
+	}
+}
+
+// Without a delegated cgroup, memory falls back to RLIMIT_DATA. Skipped
+// where relay can set up cgroups, since the cgroup path is taken instead.
+func TestApplyResourceLimits_MemoryFallsBackToRlimit(t *testing.T) {
+	if _, err := relayCgroupRoot(); err == nil {
+		t.Skip("cgroup v2 delegated here; memory is enforced by the cgroup")
+	}
+	if got := runLimited(t, &ResourceLimits{MemoryMB: 64}, "ulimit -d"); got != "65536" {
+		t.Fatalf("ulimit -d = %q, want 65536 (KB)", got)
+	}
+}
+
+func TestApplyResourceLimits_NoneLeavesCommandAlone(t *testing.T) {
+	cmd := exec.Command("/bin/true")
+	lim, err := applyResourceLimits(cmd, &ResourceLimits{}, "service-none")
+	if err != nil || lim != nil {
+		t.Fatalf("applyResourceLimits(empty) = %v, %v", lim, err)
+	}
+	if cmd.Path != "/bin/true" || len(cmd.Args) != 1 {
+		t.Fatalf("command rewritten: %q %q", cmd.Path, cmd.Args)
+	}
+}
+
+// runLimitsHelper is the child's first code: a bad invocation must fail
+// like a shell that can't exec, not run the command unlimited.
+func TestLimitsHelper_RejectsBadPlan(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(self, limitsExecCommand, "{not json", "/bin/true", "true").CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 126 {
+		t.Fatalf("err = %v, want exit 126", err)
+	}
+	if !strings.Contains(string(out), "relay limits: bad plan") {
+		t.Fatalf("output = %q", out)
+	}
+}
+
+// TestServiceRegistry_LimitsAndLastExit runs a real service under an
+// open-files limit and checks both that the limit reached it and that the
+// registry recorded how it exited.
+func TestServiceRegistry_LimitsAndLastExit(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	exited := make(chan struct{}, 1)
+	reg.OnProcessExit = func() {
+		select {
+		case exited <- struct{}{}:
+		default:
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "nofile")
+	cfg := &ServiceConfig{
+		ID:          "svc-limited",
+		DisplayName: "Limited",
+		Command:     "/bin/sh",
+		Args:        []string{"-c", `ulimit -n > "$OUT"; exit 3`},
+		Env:         map[string]string{"OUT": out},
+		Limits:      &ResourceLimits{OpenFiles: 32},
+	}
+	if _, ok := reg.LastExit(cfg.ID); ok {
+		t.Fatal("LastExit set before the service ever ran")
+	}
+	if err := reg.Start(cfg); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("service never exited")
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read ulimit output: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "32" {
+		t.Fatalf("service saw ulimit -n %q, want 32", got)
+	}
+	exit, ok := reg.LastExit(cfg.ID)
+	if !ok || exit.Status != "exited: status 3" || exit.Limit != "" {
+		t.Fatalf("LastExit = %+v, %v", exit, ok)
+	}
+}
+
+// The limits helper sits between relay and a stdio MCP; JSON-RPC over the
+// pipes must still work through it.
+func TestStdioConn_UnderLimits(t *testing.T) {
+	bin := buildTestMcpBinary(t)
+	cfg := &ExternalMcp{ID: "lim", Command: bin, Limits: &ResourceLimits{OpenFiles: 64}}
+	conn, err := spawnStdioConn(bin, nil, nil, cfg)
+	if err != nil {
+		t.Fatalf("spawnStdioConn: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	raw, err := conn.SendRequest(context.Background(), "echo", map[string]any{"marker": "limited"})
+	if err != nil {
+		t.Fatalf("echo under limits: %v", err)
+	}
+	if got := markerOf(t, raw); got != "limited" {
+		t.Fatalf("marker = %q", got)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of child a MetricsHistory tracks. Service and MCP IDs are separate
+// namespaces, so every lookup is by kind and ID.
+const (
+	metricsKindService = "service"
+	metricsKindMcp     = "mcp"
+)
+
+const (
+	// metricsHistoryLen bounds each child's ring: 30 minutes of samples at
+	// the tray's 2s status poll, ~40 KB per child.
+	metricsHistoryLen = 900
+	// metricsRetention is how long a stopped child's history is kept after
+	// its last sample, so a graph can still show what it did before it died.
+	metricsRetention = 30 * time.Minute
+)
+
+// MetricsSample is one point of a child's resource history. CPUPercent is
+// the CPU used since the previous sample as a share of one core (so 250 is
+// two and a half cores busy, as top shows it); it is 0 on the first sample
+// of a run, which has nothing to diff against.
+type MetricsSample struct {
+	At         time.Time
+	CPUPercent float64
+	RSS        uint64
+	Procs      int
+}
+
+// metricsKey names one tracked child.
+type metricsKey struct{ kind, id string }
+
+// metricsRing is one child's bounded sample history plus what the next CPU
+// rate is computed against.
+type metricsRing struct {
+	pid     int // root PID of the run being sampled; a change starts a new baseline
+	samples []MetricsSample
+	next    int // write position once samples is full
+	lastCPU time.Duration
+}
+
+func (r *metricsRing) add(s MetricsSample, size int) {
+	if len(r.samples) < size {
+		r.samples = append(r.samples, s)
+		return
+	}
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % size
+}
+
+// ordered returns a copy of the ring oldest first.
+func (r *metricsRing) ordered() []MetricsSample {
+	out := make([]MetricsSample, 0, len(r.samples))
+	out = append(out, r.samples[r.next:]...)
+	return append(out, r.samples[:r.next]...)
+}
+
+func (r *metricsRing) last() (MetricsSample, bool) {
+	if len(r.samples) == 0 {
+		return MetricsSample{}, false
+	}
+	i := r.next - 1
+	if i < 0 {
+		i = len(r.samples) - 1
+	}
+	return r.samples[i], true
+}
+
+// MetricsHistory keeps a bounded CPU/memory history per managed service and
+// stdio MCP. The tray's status poller feeds it every tick (see
+// App.sampleResources); the bridge and the frontend API read it. Safe for
+// concurrent use.
+type MetricsHistory struct {
+	mu    sync.Mutex
+	size  int
+	rings map[metricsKey]*metricsRing
+	// recorded is each kind's latest Record time: a series whose last
+	// sample is older belongs to a child that has since stopped.
+	recorded map[string]time.Time
+}
+
+// NewMetricsHistory returns a history keeping up to size samples per child;
+// size <= 0 means metricsHistoryLen.
+func NewMetricsHistory(size int) *MetricsHistory {
+	if size <= 0 {
+		size = metricsHistoryLen
+	}
+	return &MetricsHistory{size: size, rings: make(map[metricsKey]*metricsRing), recorded: make(map[string]time.Time)}
+}
+
+// Record adds one sample for each running child of kind: pids maps child ID
+// to root PID, stats holds SampleProcessStats' result for those PIDs. A child
+// whose root had already gone by sampling time is skipped rather than
+// recorded as zero. Stopped children's histories are kept for
+// metricsRetention after their last sample, then dropped.
+func (h *MetricsHistory) Record(kind string, pids map[string]int, stats map[int]ProcessStats, at time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.recorded[kind] = at
+	for id, pid := range pids {
+		st, ok := stats[pid]
+		if !ok || st.Procs == 0 {
+			continue
+		}
+		key := metricsKey{kind, id}
+		ring := h.rings[key]
+		if ring == nil {
+			ring = &metricsRing{}
+			h.rings[key] = ring
+		}
+		s := MetricsSample{At: at, RSS: st.RSS, Procs: st.Procs}
+		if prev, ok := ring.last(); ok && ring.pid == pid && at.After(prev.At) && st.CPU >= ring.lastCPU {
+			s.CPUPercent = 100 * float64(st.CPU-ring.lastCPU) / float64(at.Sub(prev.At))
+		}
+		ring.pid, ring.lastCPU = pid, st.CPU
+		ring.add(s, h.size)
+	}
+	for key, ring := range h.rings {
+		if key.kind != kind {
+			continue
+		}
+		if _, running := pids[key.id]; running {
+			continue
+		}
+		if last, ok := ring.last(); !ok || at.Sub(last.At) > metricsRetention {
+			delete(h.rings, key)
+		}
+	}
+}
+
+// MetricsSeries is one child's history as returned by History.
+type MetricsSeries struct {
+	Kind    string
+	ID      string
+	PID     int  // root PID at the latest sample
+	Running bool // sampled by the latest Record of its kind
+	Samples []MetricsSample
+}
+
+// History returns the tracked series, sorted by kind then ID, with samples
+// oldest first. An empty kind or id matches any; samples at or before since
+// are left out, so a poller can fetch only what is new. A series with
+// nothing left after since is still listed, with no samples.
+func (h *MetricsHistory) History(kind, id string, since time.Time) []MetricsSeries {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []MetricsSeries
+	for key, ring := range h.rings {
+		if (kind != "" && key.kind != kind) || (id != "" && key.id != id) {
+			continue
+		}
+		samples := ring.ordered()
+		last, _ := ring.last()
+		i := sort.Search(len(samples), func(i int) bool { return samples[i].At.After(since) })
+		out = append(out, MetricsSeries{
+			Kind:    key.kind,
+			ID:      key.id,
+			PID:     ring.pid,
+			Running: last.At.Equal(h.recorded[key.kind]),
+			Samples: samples[i:],
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// checkMetricsTarget rejects a metrics query for an unknown kind, or for an
+// ID not registered as that kind (as either, when kind is empty).
+func checkMetricsTarget(s *Settings, kind, id string) error {
+	switch kind {
+	case "", metricsKindService, metricsKindMcp:
+	default:
+		return fmt.Errorf("unknown kind %q (want %q or %q)", kind, metricsKindService, metricsKindMcp)
+	}
+	if id == "" {
+		return nil
+	}
+	if kind != metricsKindMcp {
+		if svc, _ := s.findServiceByID(id); svc != nil {
+			return nil
+		}
+	}
+	if kind != metricsKindService {
+		if m, _ := s.findMcpByID(id); m != nil {
+			return nil
+		}
+	}
+	if kind == "" {
+		return fmt.Errorf("no service or MCP registered with id %q", id)
+	}
+	return fmt.Errorf("no %s registered with id %q", kind, id)
+}
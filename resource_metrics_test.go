@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"relaygo/bridge"
+	"relaygo/jsonrpc"
+)
+
+func TestMetricsHistory_RecordsCPURateAndBoundsRing(t *testing.T) {
+	h := NewMetricsHistory(3)
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	pids := map[string]int{"web": 100}
+	rec := func(sec int, cpu time.Duration, rss uint64) {
+		h.Record(metricsKindService, pids, map[int]ProcessStats{100: {RSS: rss, CPU: cpu, Procs: 2}}, t0.Add(time.Duration(sec)*time.Second))
+	}
+	rec(0, 5*time.Second, 10)
+	rec(2, 6*time.Second, 20)  // 1s CPU over 2s: 50%
+	rec(4, 10*time.Second, 30) // 4s over 2s: two cores, 200%
+	rec(6, 10*time.Second, 40)
+
+	hist := h.History(metricsKindService, "web", time.Time{})
+	if len(hist) != 1 || hist[0].PID != 100 || !hist[0].Running {
+		t.Fatalf("History = %+v", hist)
+	}
+	var cpu []float64
+	var rss []uint64
+	for _, s := range hist[0].Samples {
+		cpu = append(cpu, s.CPUPercent)
+		rss = append(rss, s.RSS)
+	}
+	if len(rss) != 3 || rss[0] != 20 || rss[2] != 40 {
+		t.Fatalf("ring kept %v, want the last 3 oldest first", rss)
+	}
+	if cpu[0] != 50 || cpu[1] != 200 || cpu[2] != 0 {
+		t.Fatalf("cpu = %v, want [50 200 0]", cpu)
+	}
+
+	since := h.History(metricsKindService, "web", t0.Add(4*time.Second))
+	if len(since) != 1 || len(since[0].Samples) != 1 || since[0].Samples[0].RSS != 40 {
+		t.Fatalf("since filter = %+v", since)
+	}
+}
+
+func TestMetricsHistory_RestartResetsBaseline(t *testing.T) {
+	h := NewMetricsHistory(0)
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	h.Record(metricsKindService, map[string]int{"web": 100}, map[int]ProcessStats{100: {CPU: 50 * time.Second, Procs: 1}}, t0)
+	// New run, new PID, CPU counter back near zero: no rate, not a negative one.
+	h.Record(metricsKindService, map[string]int{"web": 200}, map[int]ProcessStats{200: {CPU: time.Second, Procs: 1}}, t0.Add(2*time.Second))
+	h.Record(metricsKindService, map[string]int{"web": 200}, map[int]ProcessStats{200: {CPU: 2 * time.Second, Procs: 1}}, t0.Add(4*time.Second))
+
+	s := h.History(metricsKindService, "web", time.Time{})[0]
+	if s.PID != 200 || s.Samples[1].CPUPercent != 0 || s.Samples[2].CPUPercent != 50 {
+		t.Fatalf("history across restart = %+v", s)
+	}
+}
+
+func TestMetricsHistory_StoppedChildrenKeptThenDropped(t *testing.T) {
+	h := NewMetricsHistory(0)
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	stats := map[int]ProcessStats{100: {RSS: 1, Procs: 1}, 300: {RSS: 3, Procs: 1}}
+	h.Record(metricsKindService, map[string]int{"web": 100}, stats, t0)
+	h.Record(metricsKindMcp, map[string]int{"fs": 300}, stats, t0)
+	// A root that died between listing and sampling isn't recorded as zero.
+	h.Record(metricsKindService, map[string]int{"web": 100, "gone": 400}, stats, t0.Add(time.Second))
+
+	h.Record(metricsKindService, map[string]int{}, stats, t0.Add(2*time.Second))
+	all := h.History("", "", time.Time{})
+	if len(all) != 2 || all[0].Kind != metricsKindMcp || all[1].ID != "web" || all[1].Running {
+		t.Fatalf("after stop = %+v, want mcp fs then a stopped web", all)
+	}
+
+	h.Record(metricsKindService, map[string]int{}, stats, t0.Add(time.Second+metricsRetention+time.Second))
+	if got := h.History(metricsKindService, "", time.Time{}); len(got) != 0 {
+		t.Fatalf("stopped service kept past retention: %+v", got)
+	}
+	if got := h.History(metricsKindMcp, "fs", time.Time{}); len(got) != 1 || !got[0].Running {
+		t.Fatalf("pruning services touched MCPs: %+v", got)
+	}
+}
+
+func TestCheckMetricsTarget(t *testing.T) {
+	s := &Settings{
+		Services:     []ServiceConfig{{ID: "web"}},
+		ExternalMcps: []ExternalMcp{{ID: "fs"}},
+	}
+	for _, c := range []struct {
+		kind, id string
+		ok       bool
+	}{
+		{"", "", true},
+		{"", "web", true},
+		{"", "fs", true},
+		{metricsKindService, "web", true},
+		{metricsKindMcp, "fs", true},
+		{metricsKindService, "fs", false},
+		{metricsKindMcp, "web", false},
+		{"", "nope", false},
+		{"disk", "", false},
+	} {
+		if err := checkMetricsTarget(s, c.kind, c.id); (err == nil) != c.ok {
+			t.Errorf("checkMetricsTarget(%q, %q) = %v", c.kind, c.id, err)
+		}
+	}
+}
+
+func TestAppRouter_ResourceMetrics(t *testing.T) {
+	s := &Settings{Services: []ServiceConfig{{ID: "web"}, {ID: "idle"}}}
+	r := &appRouter{store: fixedStore{s: s}}
+
+	_, err := r.ResourceMetrics(context.Background(), bridge.ResourceMetricsRequest{})
+	if code := rpcCodeOf(err); code != jsonrpc.CodeMethodNotFound {
+		t.Fatalf("without metrics: err = %v (code %d)", err, code)
+	}
+
+	r.metrics = NewMetricsHistory(0)
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.metrics.Record(metricsKindService, map[string]int{"web": 100}, map[int]ProcessStats{100: {RSS: 4096, Procs: 2}}, at)
+
+	got, err := r.ResourceMetrics(context.Background(), bridge.ResourceMetricsRequest{Kind: metricsKindService, ID: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bridge.ResourceSample{At: at, RSSBytes: 4096, Procs: 2}
+	if len(got) != 1 || got[0].ID != "web" || got[0].PID != 100 || !got[0].Running || len(got[0].Samples) != 1 || got[0].Samples[0] != want {
+		t.Fatalf("ResourceMetrics = %+v", got)
+	}
+
+	if got, err := r.ResourceMetrics(context.Background(), bridge.ResourceMetricsRequest{ID: "idle"}); err != nil || got == nil || len(got) != 0 {
+		t.Fatalf("registered but never run = %v, %v; want an empty list", got, err)
+	}
+	_, err = r.ResourceMetrics(context.Background(), bridge.ResourceMetricsRequest{ID: "nope"})
+	if code := rpcCodeOf(err); code != jsonrpc.CodeInvalidParams || !strings.Contains(err.Error(), "nope") {
+		t.Fatalf("unknown id: err = %v (code %d)", err, code)
+	}
+}
+
+// rpcCodeOf is the JSON-RPC code err carries, or 0.
+func rpcCodeOf(err error) int {
+	var ce *jsonrpc.CodedError
+	if errors.As(err, &ce) {
+		return ce.RPCCode
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"relaygo/bridge"
+)
+
+// RegisterResourceMetricsRoutes wires the read-only usage-history endpoints
+// Eve graphs from. Payloads are bridge.ResourceMetrics, the same shape
+// `relay service status` reads over the bridge:
+//
+//	GET /api/metrics              every tracked service and MCP (?kind= narrows)
+//	GET /api/services/{id}/metrics one service
+//	GET /api/mcps/{id}/metrics     one stdio MCP
+//
+// Each takes an optional ?since=<RFC 3339 time>; samples at or before it are
+// left out, so a graph polls with its newest sample's "at" and appends. An
+// ID that isn't registered is 404; a registered one that hasn't run yet is
+// a series with no samples. nil metrics makes every route return 503.
+func RegisterResourceMetricsRoutes(mux *http.ServeMux, store SettingsStore, metrics *MetricsHistory) {
+	query := func(w http.ResponseWriter, r *http.Request, kind, id string) ([]bridge.ResourceMetrics, bool) {
+		if metrics == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "resource metrics unavailable"})
+			return nil, false
+		}
+		var since time.Time
+		if v := r.URL.Query().Get("since"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be an RFC 3339 time"})
+				return nil, false
+			}
+			since = t
+		}
+		if err := checkMetricsTarget(store.Get(), kind, id); err != nil {
+			status := http.StatusNotFound
+			if id == "" {
+				status = http.StatusBadRequest
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return nil, false
+		}
+		return bridgeResourceMetrics(metrics.History(kind, id, since)), true
+	}
+	one := func(kind string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id := r.PathValue("id")
+			list, ok := query(w, r, kind, id)
+			if !ok {
+				return
+			}
+			if len(list) == 0 {
+				writeJSON(w, http.StatusOK, bridge.ResourceMetrics{Kind: kind, ID: id, Samples: []bridge.ResourceSample{}})
+				return
+			}
+			writeJSON(w, http.StatusOK, list[0])
+		}
+	}
+
+	mux.HandleFunc("GET /api/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if list, ok := query(w, r, r.URL.Query().Get("kind"), ""); ok {
+			writeJSON(w, http.StatusOK, list)
+		}
+	})
+	mux.HandleFunc("GET /api/services/{id}/metrics", one(metricsKindService))
+	mux.HandleFunc("GET /api/mcps/{id}/metrics", one(metricsKindMcp))
+}
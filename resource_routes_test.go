@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"relaygo/bridge"
+)
+
+func newResourceRoutesServer(t *testing.T, metrics *MetricsHistory) *httptest.Server {
+	t.Helper()
+	s := &Settings{
+		Services:     []ServiceConfig{{ID: "web"}, {ID: "idle"}},
+		ExternalMcps: []ExternalMcp{{ID: "fs"}},
+	}
+	mux := http.NewServeMux()
+	RegisterResourceMetricsRoutes(mux, fixedStore{s: s}, metrics)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// getJSON GETs path and decodes the body into out, returning the status.
+func getJSON(t *testing.T, srv *httptest.Server, path string, out any) int {
+	t.Helper()
+	resp, err := http.Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestResourceMetricsRoutes(t *testing.T) {
+	h := NewMetricsHistory(0)
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		at := t0.Add(time.Duration(i) * 2 * time.Second)
+		stats := map[int]ProcessStats{100: {RSS: uint64(i + 1), Procs: 1}, 300: {RSS: 7, Procs: 1}}
+		h.Record(metricsKindService, map[string]int{"web": 100}, stats, at)
+		h.Record(metricsKindMcp, map[string]int{"fs": 300}, stats, at)
+	}
+	srv := newResourceRoutesServer(t, h)
+
+	var web bridge.ResourceMetrics
+	if code := getJSON(t, srv, "/api/services/web/metrics", &web); code != http.StatusOK {
+		t.Fatalf("service metrics: status %d", code)
+	}
+	if web.Kind != metricsKindService || web.PID != 100 || !web.Running || len(web.Samples) != 3 || web.Samples[2].RSSBytes != 3 {
+		t.Fatalf("service metrics = %+v", web)
+	}
+
+	since := url.QueryEscape(t0.Add(2 * time.Second).Format(time.RFC3339Nano))
+	if getJSON(t, srv, "/api/services/web/metrics?since="+since, &web); len(web.Samples) != 1 || web.Samples[0].RSSBytes != 3 {
+		t.Fatalf("since filter = %+v", web.Samples)
+	}
+
+	var fs bridge.ResourceMetrics
+	if code := getJSON(t, srv, "/api/mcps/fs/metrics", &fs); code != http.StatusOK || fs.Kind != metricsKindMcp || len(fs.Samples) != 3 {
+		t.Fatalf("mcp metrics: status %d, %+v", code, fs)
+	}
+
+	var idle bridge.ResourceMetrics
+	if code := getJSON(t, srv, "/api/services/idle/metrics", &idle); code != http.StatusOK || idle.ID != "idle" || idle.Running || idle.Samples == nil || len(idle.Samples) != 0 {
+		t.Fatalf("never-run service: status %d, %+v", code, idle)
+	}
+
+	var all []bridge.ResourceMetrics
+	if getJSON(t, srv, "/api/metrics", &all); len(all) != 2 {
+		t.Fatalf("all metrics = %+v", all)
+	}
+	if getJSON(t, srv, "/api/metrics?kind=mcp", &all); len(all) != 1 || all[0].ID != "fs" {
+		t.Fatalf("kind filter = %+v", all)
+	}
+
+	for path, want := range map[string]int{
+		"/api/services/nope/metrics":         http.StatusNotFound,
+		"/api/mcps/web/metrics":              http.StatusNotFound,
+		"/api/metrics?kind=disk":             http.StatusBadRequest,
+		"/api/services/web/metrics?since=1h": http.StatusBadRequest,
+	} {
+		if code := getJSON(t, srv, path, nil); code != want {
+			t.Errorf("GET %s = %d, want %d", path, code, want)
+		}
+	}
+}
+
+func TestResourceMetricsRoutes_NoHistory(t *testing.T) {
+	srv := newResourceRoutesServer(t, nil)
+	if code := getJSON(t, srv, "/api/services/web/metrics", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", code)
+	}
+}
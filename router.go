@@ -34,6 +34,9 @@ type ToolManager interface {
 	ToolProvider
 	Reconcile(ctx context.Context, mcps []ExternalMcp)
 	Reload(ctx context.Context, id string, cfg *ExternalMcp) error
+	IsConnected(id string) bool
+	AuthState(id string) McpAuthState
+	LastExit(id string) (childExit, bool)
 }
 
 // ServiceReloader abstracts service restart operations.
@@ -41,6 +44,40 @@ type ServiceReloader interface {
 	Reload(id string, cfg *ServiceConfig) error
 }
 
+// serviceStatusSource is the optional read side of a ServiceReloader, used by
+// ServiceStatus. Kept off ServiceReloader so test doubles that only record
+// reloads don't have to grow it.
+type serviceStatusSource interface {
+	PIDsByServiceID() map[string]int
+	LastExit(id string) (childExit, bool)
+	RestartStatus(id string) (serviceRestartStatus, bool)
+	Health(id string) (serviceHealthStatus, bool)
+}
+
+// jobStatusSource and jobRunner are the optional job side of a
+// ServiceReloader (service_jobs.go), used by ServiceStatus, RunJob and the
+// settings UI. Separate from serviceStatusSource for the same reason.
+type jobStatusSource interface {
+	JobStatus(id string) (serviceJobStatus, bool)
+}
+
+type jobRunner interface {
+	RunJob(cfg *ServiceConfig) error
+}
+
+// socketStatusSource is the optional socket-activation side of a
+// ServiceReloader (service_sockets.go), used by ServiceStatus and the tray
+// menu.
+type socketStatusSource interface {
+	SocketStatus(id string) (serviceSocketStatus, bool)
+}
+
+// replicaStatusSource is the optional replicas side of a ServiceReloader
+// (service_replicas.go), used by ServiceStatus.
+type replicaStatusSource interface {
+	ReplicaStatus(id string) ([]serviceReplicaStatus, bool)
+}
+
 // checkToolAccess verifies that the resolved token has permission to access
 // the specified MCP and (optionally) tool. Pass empty toolName to check
 // only the MCP-level permission. Operates on the StoredToken directly so it
@@ -79,6 +116,9 @@ type appRouter struct {
 	// up with an unbudgeted router by omission.
 	budgets       enrolmentBudgets
 	serviceTokens serviceTokenStore
+	// metrics is the tray's CPU/memory history behind ReqResourceMetrics.
+	// Nil answers method-not-found, as for a router without the capability.
+	metrics *MetricsHistory
 }
 
 // serviceTokenName identifies service tokens in the Name field.
@@ -90,19 +130,33 @@ const serviceTokenName = "service"
 type serviceTokenStore struct {
 	mu     sync.Mutex
 	hashes map[string]*StoredToken // hash → synthetic StoredToken with full access
+	// owners records the process each token was issued to, as an instance
+	// ID (service_replicas.go), so a replica's RegisterManifest is filed
+	// under its replica without the service having to say which it is.
+	owners map[string]string
 }
 
 // Register adds an in-memory service token.
 func (s *serviceTokenStore) Register(hash string) {
+	s.RegisterFor(hash, "")
+}
+
+// RegisterFor adds an in-memory service token issued to the process with
+// the given instance ID ("" if unknown).
+func (s *serviceTokenStore) RegisterFor(hash, instance string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.hashes == nil {
 		s.hashes = make(map[string]*StoredToken)
+		s.owners = make(map[string]string)
 	}
 	s.hashes[hash] = &StoredToken{
 		Name: serviceTokenName,
 		Hash: hash,
 	}
+	if instance != "" {
+		s.owners[hash] = instance
+	}
 }
 
 // Remove deletes an in-memory service token.
@@ -110,6 +164,14 @@ func (s *serviceTokenStore) Remove(hash string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.hashes, hash)
+	delete(s.owners, hash)
+}
+
+// Owner returns the instance ID a service token was issued to, or "".
+func (s *serviceTokenStore) Owner(hash string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.owners[hash]
 }
 
 // Lookup checks if a hash matches an in-memory service token.
@@ -130,9 +192,18 @@ func (s *serviceTokenStore) Len() int {
 
 // Compile-time interface assertions.
 var (
-	_ bridge.ToolRouter = (*appRouter)(nil)
-	_ ToolManager       = (*ExternalMcpManager)(nil)
-	_ ServiceReloader   = (*ServiceRegistry)(nil)
+	_ bridge.ToolRouter            = (*appRouter)(nil)
+	_ ToolManager                  = (*ExternalMcpManager)(nil)
+	_ ServiceReloader              = (*ServiceRegistry)(nil)
+	_ bridge.McpStatusRouter       = (*appRouter)(nil)
+	_ bridge.ServiceStatusRouter   = (*appRouter)(nil)
+	_ serviceStatusSource          = (*ServiceRegistry)(nil)
+	_ jobStatusSource              = (*ServiceRegistry)(nil)
+	_ socketStatusSource           = (*ServiceRegistry)(nil)
+	_ replicaStatusSource          = (*ServiceRegistry)(nil)
+	_ jobRunner                    = (*ServiceRegistry)(nil)
+	_ bridge.JobRunner             = (*appRouter)(nil)
+	_ bridge.ResourceMetricsRouter = (*appRouter)(nil)
 )
 
 // resolveAuth loads settings and authenticates the given token.
@@ -750,21 +821,218 @@ func (r *appRouter) ReloadExternalMcp(ctx context.Context, id string) error {
 	return nil
 }
 
+// McpStatus reports the connection and OAuth state of every registered
+// external MCP, in settings order. Admin-gated at the bridge; backs the AUTH
+// column of `relay mcp list`.
+func (r *appRouter) McpStatus(_ context.Context) ([]bridge.McpStatus, error) {
+	settings := r.store.Get()
+	out := make([]bridge.McpStatus, 0, len(settings.ExternalMcps))
+	for _, m := range settings.ExternalMcps {
+		st := bridge.McpStatus{
+			ID:        m.ID,
+			Connected: r.tools.IsConnected(m.ID),
+			AuthState: string(r.tools.AuthState(m.ID)),
+		}
+		if exit, ok := r.tools.LastExit(m.ID); ok {
+			st.LastExit, st.Limit = exit.Status, exit.Limit
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// ServiceStatus reports whether each registered service is running and how
+// its last run ended, in settings order. Admin-gated at the bridge; backs
+// the STATUS column of `relay service list`.
+func (r *appRouter) ServiceStatus(_ context.Context) ([]bridge.ServiceStatus, error) {
+	settings := r.store.Get()
+	src, _ := r.services.(serviceStatusSource)
+	var pids map[string]int
+	if src != nil {
+		pids = src.PIDsByServiceID()
+	}
+	out := make([]bridge.ServiceStatus, 0, len(settings.Services))
+	for _, svc := range settings.Services {
+		st := bridge.ServiceStatus{ID: svc.ID}
+		if pid, ok := pids[svc.ID]; ok {
+			st.Running, st.PID = true, pid
+		}
+		if src != nil {
+			if exit, ok := src.LastExit(svc.ID); ok {
+				st.LastExit, st.Limit = exit.Status, exit.Limit
+			}
+			if rs, ok := src.RestartStatus(svc.ID); ok {
+				fillRestartStatus(&st, rs)
+			}
+			if hs, ok := src.Health(svc.ID); ok {
+				st.Health, st.HealthError = string(hs.State), hs.LastError
+			}
+		}
+		if svc.isJob() {
+			st.Kind = KindJob
+			if js, ok := r.services.(jobStatusSource); ok {
+				if jst, ok := js.JobStatus(svc.ID); ok {
+					fillJobStatus(&st, jst)
+				}
+			}
+		}
+		if ss, ok := r.services.(socketStatusSource); ok {
+			if sst, ok := ss.SocketStatus(svc.ID); ok {
+				st.Listening, st.AwaitingConnection = sst.Listening, sst.Awaiting
+			}
+		}
+		if rs, ok := r.services.(replicaStatusSource); ok {
+			if replicas, ok := rs.ReplicaStatus(svc.ID); ok {
+				r.fillReplicaStatus(&st, replicas)
+			}
+		}
+		if len(st.Replicas) == 0 && r.enhanced != nil {
+			if rec := r.enhanced.Get(svc.ID); rec != nil {
+				st.Circuit = rec.Circuit()
+			}
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// fillReplicaStatus copies each replica's process state, and the front
+// door's view of it, into the bridge status.
+func (r *appRouter) fillReplicaStatus(st *bridge.ServiceStatus, replicas []serviceReplicaStatus) {
+	registered := map[int]*EnhancedService{}
+	if r.enhanced != nil {
+		for _, rec := range r.enhanced.Replicas(st.ID) {
+			registered[rec.Replica] = rec
+		}
+	}
+	for _, rp := range replicas {
+		br := bridge.ServiceReplica{Replica: rp.Replica, Running: rp.Running, PID: rp.PID, Health: string(rp.Health)}
+		if rec := registered[rp.Replica]; rec != nil {
+			br.Registered, br.InFlight, br.Draining = true, rec.InFlight(), rec.Draining()
+			br.Circuit = rec.Circuit()
+		}
+		st.Replicas = append(st.Replicas, br)
+	}
+}
+
+// fillRestartStatus copies the registry's restart bookkeeping into the
+// bridge status.
+func fillRestartStatus(st *bridge.ServiceStatus, rs serviceRestartStatus) {
+	if rs.Policy != "-" {
+		st.RestartPolicy = rs.Policy
+	}
+	st.Restarts, st.CrashLoop = rs.Restarts, rs.GaveUp
+	if rs.Pending {
+		next := rs.Next
+		st.NextRestart = &next
+	}
+	for _, h := range rs.History {
+		st.RestartHistory = append(st.RestartHistory, bridge.ServiceRestart{
+			At: h.At, Exit: h.Exit, Attempt: h.Attempt, DelayMs: h.Delay.Milliseconds(),
+		})
+	}
+}
+
+// fillJobStatus copies a job's schedule and run history into the bridge
+// status.
+func fillJobStatus(st *bridge.ServiceStatus, js serviceJobStatus) {
+	st.Scheduled = js.Scheduled
+	if js.Scheduled && !js.Next.IsZero() {
+		next := js.Next
+		st.NextRun = &next
+	}
+	st.JobRuns = bridgeJobRuns(js.History)
+}
+
+// bridgeJobRuns converts a job's run history to its wire form.
+func bridgeJobRuns(history []jobRun) []bridge.JobRun {
+	out := make([]bridge.JobRun, len(history))
+	for i, h := range history {
+		out[i] = bridge.JobRun{Start: h.Start, DurationMs: h.Duration.Milliseconds(), ExitCode: h.ExitCode, Status: h.Status, Trigger: h.Trigger}
+	}
+	return out
+}
+
+// RunJob runs a registered job now (`relay service run`). Admin-gated at the
+// bridge.
+func (r *appRouter) RunJob(id string) error {
+	settings := r.store.Reload()
+	svc, _ := settings.findServiceByID(id)
+	switch {
+	case svc == nil:
+		return jsonrpc.NewCodedError(jsonrpc.CodeInvalidParams, fmt.Errorf("no service registered with id %q", id))
+	case !svc.isJob():
+		return jsonrpc.NewCodedError(jsonrpc.CodeInvalidParams, fmt.Errorf("service %q is not a job", id))
+	}
+	runner, ok := r.services.(jobRunner)
+	if !ok {
+		return jsonrpc.NewCodedError(jsonrpc.CodeMethodNotFound, fmt.Errorf("this tray can't run jobs"))
+	}
+	if err := runner.RunJob(svc); err != nil {
+		return jsonrpc.NewCodedError(jsonrpc.CodeInternalError, fmt.Errorf("run job %q: %w", id, err))
+	}
+	r.onChange()
+	return nil
+}
+
+// ResourceMetrics returns the CPU/memory history of the services and MCPs
+// req selects (`relay service status`, Eve's usage graphs). Naming an ID
+// that isn't registered is an error; a registered one that hasn't run yet
+// just has no series. Admin-gated at the bridge.
+func (r *appRouter) ResourceMetrics(_ context.Context, req bridge.ResourceMetricsRequest) ([]bridge.ResourceMetrics, error) {
+	if r.metrics == nil {
+		return nil, jsonrpc.NewCodedError(jsonrpc.CodeMethodNotFound, fmt.Errorf("this tray doesn't record resource metrics"))
+	}
+	if err := checkMetricsTarget(r.store.Reload(), req.Kind, req.ID); err != nil {
+		return nil, jsonrpc.NewCodedError(jsonrpc.CodeInvalidParams, err)
+	}
+	return bridgeResourceMetrics(r.metrics.History(req.Kind, req.ID, req.Since)), nil
+}
+
+// bridgeResourceMetrics converts metrics history to its wire form, shared by
+// the bridge and the frontend API. Never nil, so it encodes as [].
+func bridgeResourceMetrics(series []MetricsSeries) []bridge.ResourceMetrics {
+	out := make([]bridge.ResourceMetrics, 0, len(series))
+	for _, ser := range series {
+		m := bridge.ResourceMetrics{
+			Kind:    ser.Kind,
+			ID:      ser.ID,
+			PID:     ser.PID,
+			Running: ser.Running,
+			Samples: make([]bridge.ResourceSample, len(ser.Samples)),
+		}
+		for i, s := range ser.Samples {
+			m.Samples[i] = bridge.ResourceSample{At: s.At, CPUPercent: s.CPUPercent, RSSBytes: s.RSS, Procs: s.Procs}
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
 // RegisterManifest authenticates the service token then forwards the full
 // record to the enhanced-services registry. The registry handles conflict
 // detection and triggers an onChange notification so the front-door
 // dispatcher rebuilds its routing table.
+//
+// A replica of a replicated service is identified by the token relay gave
+// its process, so every replica can register under the plain service ID.
 func (r *appRouter) RegisterManifest(_ context.Context, req bridge.RegisterManifestRequest, token string) error {
 	if err := r.requireServiceToken(token, bridge.ReqRegisterManifest); err != nil {
 		return err
 	}
-	if err := r.enhanced.RegisterManifest(req.ServiceID, req.InternalSocket, req.InternalToken, req.Manifest); err != nil {
+	replica := 0
+	if id, n := splitInstanceID(r.serviceTokens.Owner(hashToken(token))); id == req.ServiceID {
+		replica = n
+	}
+	if err := r.enhanced.RegisterReplica(req.ServiceID, replica, req.InternalSocket, req.InternalToken, req.Manifest); err != nil {
 		return jsonrpc.NewCodedError(jsonrpc.CodeInvalidParams, err)
 	}
 	slog.Info("manifest registered",
 		"service", req.ServiceID,
+		"replica", replica,
 		"socket", req.InternalSocket,
 		"routes", req.Manifest.Routes,
+		"route_rules", len(req.Manifest.RouteRules),
 		"actions", len(req.Manifest.Actions))
 	return nil
 }
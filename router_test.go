@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"relaygo/bridge"
 	"relaygo/mcp"
 )
 
@@ -528,3 +531,86 @@ func TestResolveAuth_ServiceToken(t *testing.T) {
 		t.Fatal("expected error after service token removal")
 	}
 }
+
+// statusServices is a ServiceReloader that also answers serviceStatusSource,
+// as ServiceRegistry does.
+type statusServices struct {
+	fakeServiceReloader
+	pids     map[string]int
+	exits    map[string]childExit
+	restarts map[string]serviceRestartStatus
+	health   map[string]serviceHealthStatus
+}
+
+func (s *statusServices) PIDsByServiceID() map[string]int { return s.pids }
+func (s *statusServices) LastExit(id string) (childExit, bool) {
+	e, ok := s.exits[id]
+	return e, ok
+}
+func (s *statusServices) RestartStatus(id string) (serviceRestartStatus, bool) {
+	rs, ok := s.restarts[id]
+	return rs, ok
+}
+func (s *statusServices) Health(id string) (serviceHealthStatus, bool) {
+	hs, ok := s.health[id]
+	return hs, ok
+}
+
+func TestAppRouter_ServiceStatus(t *testing.T) {
+	s := &Settings{Services: []ServiceConfig{{ID: "eve"}, {ID: "indexer"}, {ID: "idle"}}}
+	r := &appRouter{store: fixedStore{s: s}, services: &statusServices{
+		pids:  map[string]int{"eve": 4242},
+		exits: map[string]childExit{"indexer": {Status: "killed: memory limit exceeded", Limit: "memory"}},
+	}}
+
+	got, err := r.ServiceStatus(context.Background())
+	if err != nil {
+		t.Fatalf("ServiceStatus: %v", err)
+	}
+	want := []bridge.ServiceStatus{
+		{ID: "eve", Running: true, PID: 4242},
+		{ID: "indexer", LastExit: "killed: memory limit exceeded", Limit: "memory"},
+		{ID: "idle"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ServiceStatus = %+v, want %+v", got, want)
+	}
+
+	// Restart bookkeeping is carried through, with the pending restart as a
+	// timestamp and history delays in milliseconds.
+	next := time.Now().Add(4 * time.Second)
+	r.services = &statusServices{
+		exits: map[string]childExit{"indexer": {Status: "exited: status 1"}},
+		restarts: map[string]serviceRestartStatus{"indexer": {
+			Policy: RestartOnFailure, Restarts: 2, Pending: true, Next: next,
+			History: []restartRecord{{Exit: "exited: status 1", Attempt: 2, Delay: 2 * time.Second}},
+		}},
+	}
+	got, _ = r.ServiceStatus(context.Background())
+	idx := got[1]
+	if idx.RestartPolicy != RestartOnFailure || idx.Restarts != 2 || idx.NextRestart == nil || !idx.NextRestart.Equal(next) ||
+		len(idx.RestartHistory) != 1 || idx.RestartHistory[0].DelayMs != 2000 || idx.CrashLoop {
+		t.Fatalf("restart status = %+v", idx)
+	}
+	if got[0].RestartPolicy != "" || got[0].NextRestart != nil {
+		t.Fatalf("service without restart state = %+v", got[0])
+	}
+
+	// Health is reported for services that have a check.
+	r.services = &statusServices{
+		pids:   map[string]int{"eve": 4242},
+		health: map[string]serviceHealthStatus{"eve": {State: HealthUnhealthy, Failures: 3, LastError: "GET /healthz: 500 Internal Server Error"}},
+	}
+	got, _ = r.ServiceStatus(context.Background())
+	if got[0].Health != "unhealthy" || got[0].HealthError != "GET /healthz: 500 Internal Server Error" || got[1].Health != "" {
+		t.Fatalf("health status = %+v", got)
+	}
+
+	// A reloader without the status side reports everything as stopped
+	// rather than failing.
+	r.services = &fakeServiceReloader{}
+	got, err = r.ServiceStatus(context.Background())
+	if err != nil || len(got) != 3 || got[0].Running {
+		t.Fatalf("ServiceStatus without source = %+v, %v", got, err)
+	}
+}
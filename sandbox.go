@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Opt-in sandboxing for stdio MCPs (Linux).
+//
+// A stdio MCP otherwise runs with the user's full privileges, and project
+// scoping is only as good as the MCP's own handling of `_meta.allowed_dirs`.
+// With a sandbox profile the kernel enforces the scope instead:
+//
+//   - user + mount + PID namespaces: the MCP sees a fresh root holding only
+//     the system directories, the paths the profile declares, and — with
+//     project_paths — the paths of the projects that grant it;
+//   - Landlock: the same paths again as filesystem rules, so escaping the
+//     mount view (a bug, a leaked fd) still meets a second wall;
+//   - seccomp: a deny-list of the syscalls a tool server has no business
+//     making (mount, ptrace, bpf, kexec, module loading, namespace entry);
+//   - deny_network: a private network namespace with only loopback.
+//
+// LinuxServices is the Linux analogue of TccServices. On macOS relay asks
+// TCC for the camera or the calendar on the MCP's behalf; on Linux the same
+// "this MCP needs X" becomes the extra sockets and device nodes the sandbox
+// must expose. An MCP with no sandbox profile ignores it.
+//
+// Everything here is portable so profiles validate and plan identically on
+// every platform; sandbox_linux.go does the enforcing and sandbox_other.go
+// refuses to start a sandboxed MCP anywhere else. A sandbox that silently
+// isn't there is worse than an MCP that won't start.
+
+// Hidden relay subcommands for the two sandbox helper stages (see
+// sandbox_linux.go). Dispatched first thing in main, before logging or
+// config setup.
+const (
+	sandboxInitCommand = "__sandbox-init"
+	sandboxExecCommand = "__sandbox-exec"
+)
+
+// isSandboxHelperCommand reports whether arg names a helper stage.
+func isSandboxHelperCommand(arg string) bool {
+	return arg == sandboxInitCommand || arg == sandboxExecCommand
+}
+
+// SandboxProfile is the per-MCP sandbox declaration (`sandbox` in
+// settings.json). Paths are absolute or `~/`-relative.
+type SandboxProfile struct {
+	Enabled bool `json:"enabled"`
+	// ReadPaths are exposed read-only (plus execute).
+	ReadPaths []string `json:"read_paths,omitempty"`
+	// WritePaths are exposed read-write.
+	WritePaths []string `json:"write_paths,omitempty"`
+	// ProjectPaths exposes, read-write, the path of every local project whose
+	// allowed_mcp_ids grants this MCP. Resolved at spawn: granting the MCP to
+	// another project takes effect on its next restart.
+	ProjectPaths bool `json:"project_paths,omitempty"`
+	// DenyNetwork runs the MCP in a network namespace with only loopback.
+	DenyNetwork bool `json:"deny_network,omitempty"`
+
+	// projectPaths is the spawn-time resolution of ProjectPaths, filled in
+	// by ExternalMcpManager.startStdio. Never persisted.
+	projectPaths []string
+}
+
+// active reports whether p asks for sandboxing. Nil-safe.
+func (p *SandboxProfile) active() bool {
+	return p != nil && p.Enabled
+}
+
+// sandboxSystemPaths are exposed read-only to every sandboxed MCP: enough of
+// the OS for a dynamically linked binary, an interpreter, TLS roots and DNS.
+// Missing ones are skipped, so the same list serves merged-/usr distros
+// (where /bin is a symlink) and NixOS alike.
+var sandboxSystemPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+	"/etc", "/opt", "/nix/store", "/run/current-system",
+}
+
+// sandboxDevices are the device nodes every sandboxed MCP gets. Not
+// /dev/tty: it is whatever terminal relay was started from, and an MCP has
+// no business with it (stdio MCPs talk over pipes).
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom"}
+
+// linuxServiceGrant is what one LinuxServices entry adds to the sandbox.
+// Paths may use $XDG_RUNTIME_DIR and similar env expansions; entries that
+// don't exist on this machine are skipped rather than failing the spawn —
+// "needs audio" on a box with no sound server just gets no audio.
+type linuxServiceGrant struct {
+	Paths   []string // read-write (sockets must be writable to connect)
+	Devices []string // device nodes or directories of them; globs allowed
+	EnvPath []string // env vars naming a file or socket to expose
+}
+
+// linuxServices maps canonical LinuxServices names to their grants.
+var linuxServices = map[string]linuxServiceGrant{
+	"display": {
+		Paths:   []string{"/tmp/.X11-unix", "$XDG_RUNTIME_DIR/$WAYLAND_DISPLAY"},
+		EnvPath: []string{"XAUTHORITY"},
+	},
+	"audio": {
+		Paths:   []string{"$XDG_RUNTIME_DIR/pulse", "$XDG_RUNTIME_DIR/pipewire-0"},
+		Devices: []string{"/dev/snd"},
+	},
+	"dbus": {
+		Paths: []string{"$XDG_RUNTIME_DIR/bus", "/run/dbus/system_bus_socket"},
+	},
+	"gpu": {
+		Devices: []string{"/dev/dri"},
+	},
+	"camera": {
+		Devices: []string{"/dev/video*", "/dev/media*"},
+	},
+	// network grants nothing by itself — the network is open unless the
+	// profile denies it. Declaring it makes deny_network a validation error
+	// instead of an MCP that starts and then fails every request.
+	"network": {},
+}
+
+// linuxServiceNames lists the canonical names, sorted, for error messages
+// and CLI help.
+func linuxServiceNames() []string {
+	out := make([]string, 0, len(linuxServices))
+	for k := range linuxServices {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// parseLinuxServices splits a comma-separated CLI value, like
+// parseTccServices. Unknown names are kept so Validate can reject them with
+// the list of valid ones.
+func parseLinuxServices(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	var out []string
+	for _, p := range strings.Split(raw, ",") {
+		if s := strings.ToLower(strings.TrimSpace(p)); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// validateSandbox checks an MCP's sandbox profile and LinuxServices.
+func validateSandbox(m *ExternalMcp) error {
+	for _, s := range m.LinuxServices {
+		if _, ok := linuxServices[s]; !ok {
+			return fmt.Errorf("unknown linux service %q (valid: %s)", s, strings.Join(linuxServiceNames(), ", "))
+		}
+	}
+	p := m.Sandbox
+	if !p.active() {
+		return nil
+	}
+	if m.IsHTTP() {
+		return fmt.Errorf("sandbox applies to stdio MCPs only")
+	}
+	if p.DenyNetwork {
+		for _, s := range m.LinuxServices {
+			if s == "network" {
+				return fmt.Errorf("sandbox denies network but the MCP declares the network linux service")
+			}
+		}
+	}
+	for _, path := range append(append([]string{}, p.ReadPaths...), p.WritePaths...) {
+		if !filepath.IsAbs(path) && !strings.HasPrefix(path, "~/") {
+			return fmt.Errorf("sandbox path %q must be absolute or start with ~/", path)
+		}
+		if filepath.Clean(expandHome(path)) == "/" {
+			return fmt.Errorf("sandbox path %q exposes the whole filesystem", path)
+		}
+	}
+	return nil
+}
+
+// expandHome expands a leading "~/". Returns path unchanged when there is
+// no home to expand to.
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
+
+// sandboxMountKind is one step of building the sandbox root.
+type sandboxMountKind string
+
+const (
+	sandboxBindRO sandboxMountKind = "ro"    // bind, then remount read-only
+	sandboxBindRW sandboxMountKind = "rw"    // bind read-write
+	sandboxDevice sandboxMountKind = "dev"   // bind a device node read-write
+	sandboxTmpfs  sandboxMountKind = "tmpfs" // fresh, empty, writable
+	sandboxProcfs sandboxMountKind = "proc"  // procfs for the new PID namespace
+	sandboxDevfs  sandboxMountKind = "devfs" // tmpfs /dev, populated by sandboxDevice steps
+)
+
+// sandboxMount is one planned mount. Path is both the host source and the
+// in-sandbox target: the sandbox shows a subset of the host tree at the same
+// paths, so configs, shebangs and error messages all still make sense.
+//
+// Link is set instead of a mount for a system path that is itself a symlink
+// (/bin → usr/bin on merged-/usr distros): the sandbox gets the same symlink,
+// which resolves against the /usr it also gets.
+type sandboxMount struct {
+	Kind sandboxMountKind `json:"kind"`
+	Path string           `json:"path"`
+	Link string           `json:"link,omitempty"`
+}
+
+// sandboxPlan is everything the in-namespace helper needs, computed in the
+// parent (where settings, env and the user's home are at hand) and handed
+// over as JSON on the helper's command line.
+type sandboxPlan struct {
+	Mounts      []sandboxMount `json:"mounts"`
+	DenyNetwork bool           `json:"deny_network,omitempty"`
+	Path        string         `json:"path"` // absolute path of the MCP binary
+	Args        []string       `json:"args"` // argv, including argv[0]
+}
+
+// buildSandboxPlan computes the mount plan for m. commandPath is the
+// resolved, absolute MCP binary; its directory is exposed read-only so an
+// MCP installed under ~/.local/bin (outside every system path) can run.
+// Declared paths that don't exist are an error — a typo in a write path
+// should not quietly become "no access" — while system paths and service
+// grants that don't exist on this machine are skipped.
+func buildSandboxPlan(m *ExternalMcp, commandPath string, args []string, getenv func(string) string) (*sandboxPlan, error) {
+	p := m.Sandbox
+	mounts := map[string]sandboxMountKind{}
+	links := map[string]string{}
+	// add records a mount; a read-write grant wins over a read-only one for
+	// the same path, whichever order they arrive in.
+	add := func(path string, kind sandboxMountKind) {
+		path = filepath.Clean(path)
+		if prev, ok := mounts[path]; ok && prev != sandboxBindRO {
+			return
+		}
+		mounts[path] = kind
+	}
+	exists := func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+
+	for _, sys := range sandboxSystemPaths {
+		if target, err := os.Readlink(sys); err == nil {
+			links[sys] = target
+			continue
+		}
+		if exists(sys) {
+			add(sys, sandboxBindRO)
+		}
+	}
+	add("/tmp", sandboxTmpfs)
+	add("/proc", sandboxProcfs)
+	add("/dev", sandboxDevfs)
+	add("/dev/shm", sandboxTmpfs)
+	for _, d := range sandboxDevices {
+		if exists(d) {
+			add(d, sandboxDevice)
+		}
+	}
+	add(filepath.Dir(commandPath), sandboxBindRO)
+
+	declared := func(paths []string, kind sandboxMountKind) error {
+		for _, raw := range paths {
+			path := expandHome(raw)
+			if !exists(path) {
+				return fmt.Errorf("sandbox path %s does not exist", raw)
+			}
+			add(path, kind)
+		}
+		return nil
+	}
+	if err := declared(p.ReadPaths, sandboxBindRO); err != nil {
+		return nil, err
+	}
+	if err := declared(p.WritePaths, sandboxBindRW); err != nil {
+		return nil, err
+	}
+	if p.ProjectPaths {
+		for _, path := range p.projectPaths {
+			if path != "" && exists(path) {
+				add(path, sandboxBindRW)
+			}
+		}
+	}
+
+	// expand resolves $XDG_RUNTIME_DIR-style paths; any unset variable
+	// drops the path rather than binding "/pulse" or "/".
+	expand := func(raw string) string {
+		missing := false
+		out := os.Expand(raw, func(k string) string {
+			v := getenv(k)
+			if v == "" {
+				missing = true
+			}
+			return v
+		})
+		if missing {
+			return ""
+		}
+		return out
+	}
+	for _, name := range m.LinuxServices {
+		g := linuxServices[name]
+		for _, raw := range g.Paths {
+			if path := expand(raw); path != "" && exists(path) {
+				add(path, sandboxBindRW)
+			}
+		}
+		for _, env := range g.EnvPath {
+			if path := getenv(env); filepath.IsAbs(path) && exists(path) {
+				add(path, sandboxBindRW)
+			}
+		}
+		for _, pattern := range g.Devices {
+			matches, _ := filepath.Glob(pattern)
+			for _, dev := range matches {
+				add(dev, sandboxDevice)
+			}
+		}
+	}
+
+	plan := &sandboxPlan{
+		DenyNetwork: p.DenyNetwork,
+		Path:        commandPath,
+		Args:        args,
+	}
+	for path, kind := range mounts {
+		plan.Mounts = append(plan.Mounts, sandboxMount{Kind: kind, Path: path})
+	}
+	for path, target := range links {
+		if _, mounted := mounts[path]; !mounted {
+			plan.Mounts = append(plan.Mounts, sandboxMount{Kind: sandboxBindRO, Path: path, Link: target})
+		}
+	}
+	// Parents before children: "/tmp" must be a tmpfs before "/tmp/.X11-unix"
+	// is bound into it, and "/home/u" before "/home/u/project" is bound over
+	// it. Sorting by path gives exactly that, since a parent is a prefix of
+	// its children.
+	sort.Slice(plan.Mounts, func(i, j int) bool { return plan.Mounts[i].Path < plan.Mounts[j].Path })
+	return plan, nil
+}
+
+// sandboxProjectPaths returns the paths of the local projects that grant
+// mcpID — the project_paths resolution. Remote projects have no path.
+func sandboxProjectPaths(s *Settings, mcpID string) []string {
+	var out []string
+	for _, p := range s.Projects {
+		if p.Path == "" || p.IsRemote() {
+			continue
+		}
+		for _, id := range p.AllowedMcpIDs {
+			if id == mcpID {
+				out = append(out, p.Path)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,180 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock for the sandbox exec stage. The rules mirror the mount plan —
+// read-only binds get read+execute, write paths and the tmpfs mounts get
+// everything — so the two layers agree and either alone keeps the MCP to
+// the paths it was given. Applied inside the new root, where every plan
+// path sits at its host path.
+
+// Landlock syscalls share one number on every architecture (added after
+// the syscall tables were unified).
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1
+	landlockRulePathBeneath      = 1
+)
+
+// Filesystem access rights (uapi/linux/landlock.h), by the ABI that added them.
+const (
+	llExecute    = 1 << 0
+	llWriteFile  = 1 << 1
+	llReadFile   = 1 << 2
+	llReadDir    = 1 << 3
+	llRemoveDir  = 1 << 4
+	llRemoveFile = 1 << 5
+	llMakeChar   = 1 << 6
+	llMakeDir    = 1 << 7
+	llMakeReg    = 1 << 8
+	llMakeSock   = 1 << 9
+	llMakeFifo   = 1 << 10
+	llMakeBlock  = 1 << 11
+	llMakeSym    = 1 << 12
+	llRefer      = 1 << 13 // ABI 2
+	llTruncate   = 1 << 14 // ABI 3
+	llIoctlDev   = 1 << 15 // ABI 5
+
+	llNetBindTCP    = 1 << 0 // ABI 4
+	llNetConnectTCP = 1 << 1 // ABI 4
+
+	// llFileRights are the only rights a rule on a non-directory may carry.
+	llFileRights = llExecute | llWriteFile | llReadFile | llTruncate | llIoctlDev
+	llReadRights = llExecute | llReadFile | llReadDir
+)
+
+var errLandlockUnavailable = errors.New("landlock unavailable")
+
+// landlockABI returns the kernel's Landlock ABI version, or 0 if Landlock
+// is compiled out or disabled.
+func landlockABI() int {
+	v, _, e := syscall.RawSyscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if e != 0 {
+		return 0
+	}
+	return int(v)
+}
+
+// landlockHandledFS is every filesystem right the given ABI knows. Handling
+// a right and granting it nowhere is what denies it.
+func landlockHandledFS(abi int) uint64 {
+	h := uint64(llExecute | llWriteFile | llReadFile | llReadDir | llRemoveDir | llRemoveFile |
+		llMakeChar | llMakeDir | llMakeReg | llMakeSock | llMakeFifo | llMakeBlock | llMakeSym)
+	if abi >= 2 {
+		h |= llRefer
+	}
+	if abi >= 3 {
+		h |= llTruncate
+	}
+	if abi >= 5 {
+		h |= llIoctlDev
+	}
+	return h
+}
+
+// landlockRules maps each plan path to the rights it grants. "/" gets
+// directory listing only, so `ls /` works without making any file under it
+// readable.
+func landlockRules(plan *sandboxPlan, handled uint64) map[string]uint64 {
+	rules := map[string]uint64{"/": llReadDir}
+	for _, m := range plan.Mounts {
+		if m.Link != "" {
+			continue // resolves into a path with its own rule
+		}
+		var access uint64
+		switch m.Kind {
+		case sandboxBindRO, sandboxProcfs, sandboxDevfs:
+			access = llReadRights
+		case sandboxBindRW, sandboxTmpfs:
+			access = handled
+		case sandboxDevice:
+			access = llReadFile | llWriteFile | llIoctlDev | llReadDir
+		}
+		rules[m.Path] |= access & handled
+	}
+	return rules
+}
+
+// applyLandlock restricts the calling thread to the plan's paths. Requires
+// no_new_privs to be set already.
+func applyLandlock(plan *sandboxPlan) error {
+	abi := landlockABI()
+	if abi < 1 {
+		return errLandlockUnavailable
+	}
+	handled := landlockHandledFS(abi)
+
+	// struct landlock_ruleset_attr grew handled_access_net in ABI 4; pass
+	// the size the kernel expects for the ABI we're using.
+	attr := make([]byte, 16)
+	binary.NativeEndian.PutUint64(attr[0:], handled)
+	size := 8
+	if abi >= 4 && plan.DenyNetwork {
+		// Belt and braces over the network namespace: no TCP bind or
+		// connect at all, loopback included.
+		binary.NativeEndian.PutUint64(attr[8:], llNetBindTCP|llNetConnectTCP)
+		size = 16
+	}
+	fd, _, e := syscall.RawSyscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr[0])), uintptr(size), 0)
+	if e != 0 {
+		return os.NewSyscallError("landlock_create_ruleset", e)
+	}
+	defer syscall.Close(int(fd))
+
+	for path, access := range landlockRules(plan, handled) {
+		if access == 0 {
+			continue
+		}
+		if err := landlockAddPath(int(fd), path, access); err != nil {
+			return err
+		}
+	}
+	runtime.KeepAlive(attr)
+	if _, _, e := syscall.RawSyscall(sysLandlockRestrictSelf, fd, 0, 0); e != 0 {
+		return os.NewSyscallError("landlock_restrict_self", e)
+	}
+	return nil
+}
+
+// landlockAddPath adds one path-beneath rule. A path that vanished between
+// planning and now is skipped — it grants nothing either way.
+func landlockAddPath(rulesetFD int, path string, access uint64) error {
+	pfd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) {
+			return nil
+		}
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer syscall.Close(pfd)
+	var st syscall.Stat_t
+	if err := syscall.Fstat(pfd, &st); err != nil {
+		return &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		access &= llFileRights
+	}
+
+	// struct landlock_path_beneath_attr is packed: u64 allowed_access, s32
+	// parent_fd — 12 bytes, which no Go struct lays out without padding.
+	var buf [12]byte
+	binary.NativeEndian.PutUint64(buf[0:], access)
+	binary.NativeEndian.PutUint32(buf[8:], uint32(int32(pfd)))
+	_, _, e := syscall.RawSyscall6(sysLandlockAddRule, uintptr(rulesetFD), landlockRulePathBeneath, uintptr(unsafe.Pointer(&buf[0])), 0, 0, 0)
+	if e != 0 {
+		return &os.PathError{Op: "landlock_add_rule", Path: path, Err: e}
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Linux sandbox enforcement. The MCP is started through relay itself in two
+// stages, both inside the namespaces the parent clones for it:
+//
+//	relay __sandbox-init <plan>   PID 1 of the new PID namespace. Builds the
+//	                              root (tmpfs + binds), pivots into it, then
+//	                              supervises stage two: forwards signals,
+//	                              reaps orphans, exits with its status.
+//	relay __sandbox-exec <plan>   Drops every capability, sets no_new_privs,
+//	                              applies Landlock and seccomp to its own
+//	                              thread, and execs the MCP from that thread.
+//
+// Two stages because Go can't run code between fork and exec: Landlock and
+// seccomp attach to the calling thread and survive execve, so the only way
+// to confine the MCP from Go is for a locked thread to restrict itself and
+// then become the MCP. The init stage stays PID 1 rather than exec'ing the
+// MCP directly because PID 1 only receives signals it installed handlers
+// for — an MCP that never expected to be init would ignore relay's SIGTERM.
+
+// Linux constants the frozen syscall package doesn't carry.
+const (
+	prSetNoNewPrivs         = 38
+	prCapAmbient            = 47
+	prCapAmbientClearAll    = 4
+	linuxCapabilityVersion3 = 0x20080522
+	oPath                   = 0x200000
+	siocGIFFlags            = 0x8913
+	iffUp                   = 0x1
+)
+
+// sandboxCommand rewrites cmd so the MCP it would start runs inside the
+// sandbox m.Sandbox describes. Called after the env is merged, so the plan
+// sees the same $XDG_RUNTIME_DIR the MCP will.
+func sandboxCommand(cmd *exec.Cmd, m *ExternalMcp) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	path, err := filepath.Abs(cmd.Path)
+	if err != nil {
+		return err
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	plan, err := buildSandboxPlan(m, path, cmd.Args, envGetter(env))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locate relay binary for sandbox helper: %w", err)
+	}
+
+	cmd.Path = self
+	cmd.Args = []string{self, sandboxInitCommand, string(data)}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+	if plan.DenyNetwork {
+		flags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr.Cloneflags = flags
+	// Root inside the namespace is the user outside it: the init stage needs
+	// the namespace's capabilities to mount, and files the MCP creates on a
+	// write path are still owned by the user. The exec stage drops every
+	// capability before the MCP runs.
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	return nil
+}
+
+// envGetter returns a lookup over a KEY=VALUE slice (last one wins, as in
+// exec).
+func envGetter(env []string) func(string) string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			m[k] = v
+		}
+	}
+	return func(k string) string { return m[k] }
+}
+
+// runSandboxHelper is the entry point for both helper stages. It never
+// returns: the init stage exits with the MCP's status, the exec stage
+// becomes the MCP. Any setup failure exits 126 with the reason on stderr.
+func runSandboxHelper(args []string) {
+	if len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "relay sandbox: malformed helper invocation")
+		os.Exit(126)
+	}
+	var plan sandboxPlan
+	if err := json.Unmarshal([]byte(args[1]), &plan); err != nil {
+		fmt.Fprintf(os.Stderr, "relay sandbox: bad plan: %v\n", err)
+		os.Exit(126)
+	}
+	var err error
+	switch args[0] {
+	case sandboxInitCommand:
+		err = sandboxInit(&plan, args[1])
+	case sandboxExecCommand:
+		err = sandboxExec(&plan)
+	default:
+		err = fmt.Errorf("unknown stage %q", args[0])
+	}
+	fmt.Fprintf(os.Stderr, "relay sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// sandboxInit is stage one. Returns only on setup failure.
+func sandboxInit(plan *sandboxPlan, planJSON string) error {
+	if plan.DenyNetwork {
+		// A fresh network namespace has loopback down. Bring it up so an MCP
+		// that talks to itself over 127.0.0.1 keeps working; nothing else
+		// exists to reach.
+		if err := bringUpLoopback(); err != nil {
+			fmt.Fprintf(os.Stderr, "relay sandbox: loopback: %v\n", err)
+		}
+	}
+	if err := buildSandboxRoot(plan); err != nil {
+		return err
+	}
+
+	child := exec.Command("/proc/self/exe", sandboxExecCommand, planJSON)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// A session of its own leaves relay's controlling terminal behind, so
+	// a descriptor on it the MCP inherited can't be used to reach it.
+	child.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	sigs := make(chan os.Signal, 4)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT)
+	if err := child.Start(); err != nil {
+		return fmt.Errorf("start exec stage: %w", err)
+	}
+	go func() {
+		for s := range sigs {
+			_ = child.Process.Signal(s)
+		}
+	}()
+
+	// Reap everything — as PID 1 we inherit the MCP's orphans — until the
+	// MCP itself exits. Leaving then tears the namespace down and the kernel
+	// kills whatever is left in it.
+	for {
+		var ws syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &ws, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("wait: %w", err)
+		}
+		if pid != child.Process.Pid {
+			continue
+		}
+		if ws.Signaled() {
+			os.Exit(128 + int(ws.Signal()))
+		}
+		os.Exit(ws.ExitStatus())
+	}
+}
+
+// buildSandboxRoot mounts a tmpfs, populates it per plan, and pivots into
+// it. The tmpfs's mountpoint is a fresh temp dir: a fixed path (bwrap uses
+// /tmp itself) would hide any plan path living under it.
+func buildSandboxRoot(plan *sandboxPlan) error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	root, err := os.MkdirTemp("", "relay-sandbox-")
+	if err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+		os.Remove(root)
+		return fmt.Errorf("mount root tmpfs: %w", err)
+	}
+	for _, m := range plan.Mounts {
+		if err := sandboxMountOne(root, m); err != nil {
+			return fmt.Errorf("%s %s: %w", m.Kind, m.Path, err)
+		}
+	}
+
+	oldRoot := filepath.Join(root, ".oldroot")
+	if err := os.Mkdir(oldRoot, 0o700); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(root, oldRoot); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+	// The temp dir was only a mountpoint and pivot_root moved the mount off
+	// it, so on the host it is an empty directory again: remove it rather
+	// than leave one behind per spawn.
+	_ = os.Remove(filepath.Join("/.oldroot", root))
+	if err := syscall.Unmount("/.oldroot", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach old root: %w", err)
+	}
+	_ = os.Remove("/.oldroot")
+	// The skeleton itself is read-only; /tmp, /dev/shm and the write paths
+	// are separate mounts and stay writable.
+	if err := syscall.Mount("", "/", "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("remount root read-only: %w", err)
+	}
+	return nil
+}
+
+// sandboxMountOne performs one planned mount under root.
+func sandboxMountOne(root string, m sandboxMount) error {
+	target := filepath.Join(root, m.Path)
+	if m.Link != "" {
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return os.Symlink(m.Link, target)
+	}
+	switch m.Kind {
+	case sandboxTmpfs:
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return err
+		}
+		return syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777")
+	case sandboxProcfs:
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return err
+		}
+		return syscall.Mount("proc", target, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+	case sandboxDevfs:
+		if err := os.MkdirAll(target, 0o755); err != nil {
+			return err
+		}
+		if err := syscall.Mount("tmpfs", target, "tmpfs", syscall.MS_NOSUID|syscall.MS_NOEXEC, "mode=0755"); err != nil {
+			return err
+		}
+		for name, link := range map[string]string{
+			"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2",
+		} {
+			if err := os.Symlink(link, filepath.Join(target, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case sandboxBindRO, sandboxBindRW, sandboxDevice:
+		if err := makeMountTarget(m.Path, target); err != nil {
+			return err
+		}
+		if err := syscall.Mount(m.Path, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return err
+		}
+		if m.Kind != sandboxBindRO {
+			return nil
+		}
+		return remountReadOnly(target)
+	}
+	return fmt.Errorf("unknown mount kind %q", m.Kind)
+}
+
+// makeMountTarget creates an empty directory or file at target matching the
+// type of src, unless something is already there (a child of an earlier
+// bind).
+func makeMountTarget(src, target string) error {
+	if _, err := os.Lstat(target); err == nil {
+		return nil
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return os.MkdirAll(target, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// remountReadOnly makes a bind mount read-only. Inside a user namespace the
+// kernel refuses a remount that would clear a flag the original mount had
+// locked (nosuid, nodev, noexec, atime), so they are carried over.
+func remountReadOnly(target string) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(target, &st); err != nil {
+		return err
+	}
+	const keep = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+		syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME
+	flags := uintptr(st.Flags) & keep
+	return syscall.Mount("", target, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY|flags, "")
+}
+
+// bringUpLoopback sets IFF_UP on lo in the current network namespace.
+func bringUpLoopback() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	var ifr [40]byte // struct ifreq: name[16] then a union; flags is a short at 16
+	copy(ifr[:], "lo")
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), siocGIFFlags, uintptr(unsafe.Pointer(&ifr[0]))); e != 0 {
+		return e
+	}
+	*(*uint16)(unsafe.Pointer(&ifr[16])) |= iffUp
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifr[0]))); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// sandboxExec is stage two. Returns only on failure; on success the MCP
+// replaces this process.
+func sandboxExec(plan *sandboxPlan) error {
+	// Everything below restricts the calling thread, and execve carries the
+	// calling thread's restrictions into the new program. Stay on it.
+	runtime.LockOSThread()
+
+	if err := dropCapabilities(); err != nil {
+		return fmt.Errorf("drop capabilities: %w", err)
+	}
+	if _, _, e := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); e != 0 {
+		return fmt.Errorf("no_new_privs: %w", e)
+	}
+	if err := applyLandlock(plan); err != nil {
+		if !errors.Is(err, errLandlockUnavailable) {
+			return fmt.Errorf("landlock: %w", err)
+		}
+		// Older kernels and LSM stacks without Landlock still get the
+		// mount namespace, which is the primary boundary.
+		fmt.Fprintln(os.Stderr, "relay sandbox: landlock unavailable on this kernel; relying on the mount namespace")
+	}
+	if err := applySeccomp(); err != nil {
+		return fmt.Errorf("seccomp: %w", err)
+	}
+	return syscall.Exec(plan.Path, plan.Args, os.Environ())
+}
+
+// dropCapabilities empties the bounding, ambient, effective, permitted and
+// inheritable sets of the calling thread. With the bounding set empty, even
+// the MCP running as uid 0 of the namespace gains nothing at execve.
+func dropCapabilities() error {
+	for c := uintptr(0); ; c++ {
+		_, _, e := syscall.RawSyscall6(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, c, 0, 0, 0, 0)
+		if e == syscall.EINVAL {
+			break // past the last capability this kernel knows
+		}
+		if e != 0 {
+			return fmt.Errorf("capbset drop %d: %w", c, e)
+		}
+	}
+	// Ambient caps predate no kernel we care about, but tolerate EINVAL.
+	if _, _, e := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0, 0, 0, 0); e != 0 && e != syscall.EINVAL {
+		return fmt.Errorf("clear ambient: %w", e)
+	}
+	hdr := struct {
+		version uint32
+		pid     int32
+	}{version: linuxCapabilityVersion3}
+	var data [2]struct{ effective, permitted, inheritable uint32 }
+	if _, _, e := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); e != 0 {
+		return fmt.Errorf("capset: %w", e)
+	}
+	return nil
+}
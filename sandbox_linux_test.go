@@ -0,0 +1,379 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// The sandbox starts its helper stages by re-executing os.Executable() —
+// under `go test` that is the test binary, so it must answer the helper
+// subcommands the way relay's main does. init runs before TestMain, so the
+// helper never touches the suite's config sandboxing.
+func init() {
+	if len(os.Args) > 1 && isSandboxHelperCommand(os.Args[1]) {
+		runSandboxHelper(os.Args[1:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == sandboxProbeCommand {
+		sandboxProbe()
+		os.Exit(0)
+	}
+}
+
+// sandboxProbeCommand makes the test binary, run as a sandboxed MCP, try
+// what the sandbox must refuse and print how each attempt ended, one
+// name=result per line.
+const sandboxProbeCommand = "__sandbox-test-probe"
+
+func sandboxProbe() {
+	result := func(e syscall.Errno) string {
+		if e == 0 {
+			return "ok"
+		}
+		return e.Error()
+	}
+	run := func(flags uintptr) string {
+		cmd := exec.Command("/bin/true")
+		cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: flags}
+		var errno syscall.Errno
+		if err := cmd.Run(); err != nil && !errors.As(err, &errno) {
+			return err.Error()
+		}
+		return result(errno)
+	}
+	ioctl := func(req uintptr) string {
+		_, _, e := syscall.Syscall(syscall.SYS_IOCTL, ^uintptr(0), req, 0)
+		return result(e)
+	}
+	_, _, clone3 := syscall.Syscall(sandboxSysClone3, 0, 0, 0)
+	sid, _, _ := syscall.RawSyscall(syscall.SYS_GETSID, 0, 0, 0)
+	_, ttyErr := os.Stat("/dev/tty")
+	fmt.Printf("clone=%s\nclone-newuser=%s\nclone3=%s\n", run(0), run(syscall.CLONE_NEWUSER), result(clone3))
+	fmt.Printf("tiocsti=%s\ntioclinux=%s\ntcgets=%s\n", ioctl(syscall.TIOCSTI), ioctl(syscall.TIOCLINUX), ioctl(syscall.TCGETS))
+	fmt.Printf("session-leader=%v\ndev-tty=%v\n", int(sid) == os.Getpid(), !os.IsNotExist(ttyErr))
+}
+
+// runProbe runs the sandbox probe and returns its results by name.
+func runProbe(t *testing.T) map[string]string {
+	t.Helper()
+	requireUserNamespaces(t)
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(self, sandboxProbeCommand)
+	if err := sandboxCommand(cmd, &ExternalMcp{ID: "sb", Command: self, Sandbox: &SandboxProfile{Enabled: true}}); err != nil {
+		t.Fatalf("sandboxCommand: %v", err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("probe failed: %v\n%s", err, out)
+	}
+	results := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			results[k] = v
+		}
+	}
+	return results
+}
+
+// requireUserNamespaces skips when this kernel or container refuses
+// unprivileged user namespaces (common in CI), which the sandbox needs.
+func requireUserNamespaces(t *testing.T) {
+	t.Helper()
+	cmd := exec.Command("/bin/true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	if err := cmd.Run(); err != nil {
+		t.Skipf("user namespaces unavailable: %v", err)
+	}
+}
+
+// runSandboxed runs a shell script inside the sandbox m describes and
+// returns its combined output and exit error.
+func runSandboxed(t *testing.T, m *ExternalMcp, script string) (string, error) {
+	t.Helper()
+	cmd := exec.Command("/bin/sh", "-c", script)
+	if err := sandboxCommand(cmd, m); err != nil {
+		t.Fatalf("sandboxCommand: %v", err)
+	}
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+// TestSandbox_FilesystemView is the core promise: the MCP sees the paths its
+// profile grants, at their host paths, with the declared access — and
+// nothing else from the host.
+func TestSandbox_FilesystemView(t *testing.T) {
+	requireUserNamespaces(t)
+	// Outside /tmp, which the sandbox replaces with an empty tmpfs: the
+	// hidden file must be hidden by the plan, not by accident.
+	base, err := os.MkdirTemp(".", ".sandbox-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ = filepath.Abs(base)
+	t.Cleanup(func() { os.RemoveAll(base) })
+	ro, rw, hidden := filepath.Join(base, "ro"), filepath.Join(base, "rw"), filepath.Join(base, "hidden")
+	for _, d := range []string{ro, rw, hidden} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, "f"), []byte(filepath.Base(d)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &ExternalMcp{ID: "sb", Command: "/bin/sh", Sandbox: &SandboxProfile{
+		Enabled: true, ReadPaths: []string{ro}, WritePaths: []string{rw},
+	}}
+	script := strings.NewReplacer("RO", ro, "RW", rw, "HIDDEN", hidden).Replace(`
+cat RO/f; echo
+cat RW/f; echo
+echo written > RW/out && echo rw-write-ok
+(echo nope > RO/out) 2>/dev/null && echo ro-write-LEAK
+cat HIDDEN/f 2>/dev/null && echo hidden-LEAK
+touch /etc/relay-sandbox-probe 2>/dev/null && echo etc-write-LEAK
+echo scratch > /tmp/x && echo tmp-ok
+tr '\0' '\n' < /proc/1/cmdline | sed -n 2p
+grep CapEff /proc/self/status
+`)
+	out, err := runSandboxed(t, m, script)
+	if err != nil {
+		t.Fatalf("sandboxed script failed: %v\n%s", err, out)
+	}
+	for _, want := range []string{"ro\n", "rw\n", "rw-write-ok", "tmp-ok", sandboxInitCommand, "CapEff:\t0000000000000000"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "LEAK") {
+		t.Errorf("sandbox leaked access:\n%s", out)
+	}
+	if data, err := os.ReadFile(filepath.Join(rw, "out")); err != nil || string(data) != "written\n" {
+		t.Errorf("write path not shared with host: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(ro, "out")); err == nil {
+		t.Error("read-only path was written on the host")
+	}
+}
+
+// TestSandbox_DenyNetwork: only loopback exists, and it is up.
+func TestSandbox_DenyNetwork(t *testing.T) {
+	requireUserNamespaces(t)
+	m := &ExternalMcp{ID: "sb", Command: "/bin/sh", Sandbox: &SandboxProfile{Enabled: true, DenyNetwork: true}}
+	out, err := runSandboxed(t, m, `tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' '`)
+	if err != nil {
+		t.Fatalf("sandboxed script failed: %v\n%s", err, out)
+	}
+	if strings.TrimSpace(out) != "lo" {
+		t.Fatalf("interfaces inside deny_network sandbox = %q, want only lo", out)
+	}
+}
+
+// TestSandbox_SeccompDeniesNamespaces: the MCP can't build itself a fresh
+// user namespace to regain capabilities in.
+func TestSandbox_SeccompDeniesNamespaces(t *testing.T) {
+	requireUserNamespaces(t)
+	if _, err := exec.LookPath("unshare"); err != nil {
+		t.Skip("unshare(1) not installed")
+	}
+	m := &ExternalMcp{ID: "sb", Command: "/bin/sh", Sandbox: &SandboxProfile{Enabled: true}}
+	out, err := runSandboxed(t, m, `unshare -U true 2>&1 && echo unshare-LEAK; exit 0`)
+	if err != nil {
+		t.Fatalf("sandboxed script failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "LEAK") {
+		t.Fatalf("unshare succeeded inside the sandbox:\n%s", out)
+	}
+}
+
+// TestSandbox_SeccompDeniesCloneNamespaces: clone can't create the nested
+// namespaces unshare is denied for, and clone3 — whose flags the filter
+// can't see — sends callers back to clone. Plain process creation works.
+func TestSandbox_SeccompDeniesCloneNamespaces(t *testing.T) {
+	got := runProbe(t)
+	want := map[string]string{
+		"clone":         "ok",
+		"clone-newuser": syscall.EPERM.Error(),
+		"clone3":        syscall.ENOSYS.Error(),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q (probe: %v)", k, got[k], v, got)
+		}
+	}
+}
+
+// TestSandbox_NoTerminalAccess: the MCP can't push keystrokes into the
+// terminal relay was started from — it has no /dev/tty, a session of its
+// own, and TIOCSTI/TIOCLINUX are refused before the descriptor is even
+// looked at. Other ioctls still reach the kernel (EBADF on fd -1).
+func TestSandbox_NoTerminalAccess(t *testing.T) {
+	got := runProbe(t)
+	want := map[string]string{
+		"tiocsti":        syscall.EPERM.Error(),
+		"tioclinux":      syscall.EPERM.Error(),
+		"tcgets":         syscall.EBADF.Error(),
+		"session-leader": "true",
+		"dev-tty":        "false",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q (probe: %v)", k, got[k], v, got)
+		}
+	}
+}
+
+// TestSandbox_ExitStatusPropagates: the init stage exits with the MCP's
+// status, so the manager's crash handling sees the real exit.
+func TestSandbox_ExitStatusPropagates(t *testing.T) {
+	requireUserNamespaces(t)
+	m := &ExternalMcp{ID: "sb", Command: "/bin/sh", Sandbox: &SandboxProfile{Enabled: true}}
+	_, err := runSandboxed(t, m, `exit 7`)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 7 {
+		t.Fatalf("exit = %v, want status 7", err)
+	}
+}
+
+// TestSandbox_StdioMcpHandshake drives the real spawnStdioConn path with a
+// sandbox profile against cmd/testmcp: JSON-RPC over the pipes still works
+// through both helper stages.
+func TestSandbox_StdioMcpHandshake(t *testing.T) {
+	requireUserNamespaces(t)
+	bin := buildTestMcpBinary(t)
+	cfg := &ExternalMcp{ID: "sb", Command: bin, Sandbox: &SandboxProfile{Enabled: true, DenyNetwork: true}}
+	conn, err := spawnStdioConn(bin, nil, nil, cfg)
+	if err != nil {
+		t.Fatalf("spawnStdioConn: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	raw, err := conn.SendRequest(context.Background(), "echo", map[string]any{"marker": "sandboxed"})
+	if err != nil {
+		t.Fatalf("echo through sandbox: %v", err)
+	}
+	if got := markerOf(t, raw); got != "sandboxed" {
+		t.Fatalf("marker = %q", got)
+	}
+}
+
+// seccompRun evaluates prog, a classic BPF program of the shapes
+// seccompProgram emits, against one syscall.
+func seccompRun(t *testing.T, prog []syscall.SockFilter, arch, nr uint32, args ...uint64) uint32 {
+	t.Helper()
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[seccompDataNr:], nr)
+	binary.LittleEndian.PutUint32(data[seccompDataArch:], arch)
+	for i, a := range args {
+		binary.LittleEndian.PutUint64(data[seccompDataArg0+8*i:], a)
+	}
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case bpfLdWAbs:
+			acc = binary.LittleEndian.Uint32(data[ins.K:])
+		case bpfRetK:
+			return ins.K
+		case bpfJeqK, bpfJgeK, bpfJsetK:
+			taken := ins.Code == bpfJeqK && acc == ins.K ||
+				ins.Code == bpfJgeK && acc >= ins.K ||
+				ins.Code == bpfJsetK && acc&ins.K != 0
+			if taken {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		default:
+			t.Fatalf("instruction %d: unexpected code %#x", pc, ins.Code)
+		}
+	}
+	t.Fatal("program fell off the end")
+	return 0
+}
+
+// TestSeccompProgram pins the jump arithmetic by running the filter: a
+// foreign arch is killed, denied and x32 calls get EPERM, and the calls
+// judged by argument are refused only for the arguments that matter.
+func TestSeccompProgram(t *testing.T) {
+	const arch = 0xc000003e
+	table := seccompTable{arch: arch, x32Bit: 0x40000000, denied: []uint32{10, 20, 30}, ioctl: 16, clone: 56, clone3: 435}
+	prog := seccompProgram(table)
+	eperm, enosys := seccompRetErrno|uint32(syscall.EPERM), seccompRetErrno|uint32(syscall.ENOSYS)
+	for _, c := range []struct {
+		name     string
+		arch, nr uint32
+		args     []uint64
+		want     uint32
+	}{
+		{"foreign arch", 0x40000003, 1, nil, seccompRetKillProcess},
+		{"x32", arch, 0x40000000 + 1, nil, eperm},
+		{"denied first", arch, 10, nil, eperm},
+		{"denied last", arch, 30, nil, eperm},
+		{"other", arch, 11, nil, seccompRetAllow},
+		{"clone thread", arch, 56, []uint64{syscall.CLONE_VM | syscall.CLONE_THREAD | syscall.CLONE_SIGHAND}, seccompRetAllow},
+		{"clone newuser", arch, 56, []uint64{syscall.CLONE_NEWUSER | uint64(syscall.SIGCHLD)}, eperm},
+		{"clone newtime", arch, 56, []uint64{syscall.CLONE_NEWTIME}, eperm},
+		{"clone3", arch, 435, nil, enosys},
+		{"ioctl TIOCSTI", arch, 16, []uint64{0, syscall.TIOCSTI}, eperm},
+		{"ioctl TIOCLINUX", arch, 16, []uint64{0, syscall.TIOCLINUX}, eperm},
+		{"ioctl TCGETS", arch, 16, []uint64{0, syscall.TCGETS}, seccompRetAllow},
+	} {
+		if got := seccompRun(t, prog, c.arch, c.nr, c.args...); got != c.want {
+			t.Errorf("%s: filter returned %#x, want %#x", c.name, got, c.want)
+		}
+	}
+	if len(sandboxDeniedSyscalls) == 0 && (runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64") {
+		t.Fatal("no deny table for a supported architecture")
+	}
+}
+
+// TestLandlockRules: the Landlock rules mirror the mount plan.
+func TestLandlockRules(t *testing.T) {
+	handled := landlockHandledFS(5)
+	plan := &sandboxPlan{Mounts: []sandboxMount{
+		{Kind: sandboxBindRO, Path: "/usr"},
+		{Kind: sandboxBindRO, Path: "/bin", Link: "usr/bin"},
+		{Kind: sandboxBindRW, Path: "/home/u/proj"},
+		{Kind: sandboxTmpfs, Path: "/tmp"},
+		{Kind: sandboxDevice, Path: "/dev/null"},
+	}}
+	rules := landlockRules(plan, handled)
+	if rules["/"] != llReadDir {
+		t.Errorf("/ = %#x, want list-only", rules["/"])
+	}
+	if rules["/usr"]&llWriteFile != 0 || rules["/usr"]&llReadFile == 0 {
+		t.Errorf("/usr = %#x, want read-only", rules["/usr"])
+	}
+	if _, ok := rules["/bin"]; ok {
+		t.Error("symlink entries must not get their own rule")
+	}
+	if rules["/home/u/proj"] != handled || rules["/tmp"] != handled {
+		t.Error("write paths and tmpfs must get every handled right")
+	}
+	if rules["/dev/null"]&llExecute != 0 {
+		t.Error("device nodes must not be executable")
+	}
+	// Rights the ABI doesn't know are never requested.
+	if landlockRules(plan, landlockHandledFS(1))["/tmp"]&(llRefer|llTruncate|llIoctlDev) != 0 {
+		t.Error("ABI 1 rules carry later-ABI rights")
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// sandboxCommand refuses: the sandbox is Linux-only, and an MCP whose
+// profile asks for confinement must not start without it.
+func sandboxCommand(cmd *exec.Cmd, m *ExternalMcp) error {
+	return fmt.Errorf("sandbox profiles are only supported on Linux (this is %s); disable the sandbox for %q to run it unconfined", runtime.GOOS, m.ID)
+}
+
+func runSandboxHelper(args []string) {
+	fmt.Fprintln(os.Stderr, "relay sandbox: not supported on", runtime.GOOS)
+	os.Exit(126)
+}
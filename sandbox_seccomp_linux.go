@@ -0,0 +1,169 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// seccomp deny-list for the sandbox exec stage. A deny-list rather than an
+// allow-list on purpose: MCPs are arbitrary programs (node, python, Go, a
+// shell script), and an allow-list tight enough to mean something breaks
+// half of them. What is denied is what a tool server never needs and a
+// sandbox escape almost always does — mounting, entering or creating
+// namespaces, tracing other processes, loading kernel code, pushing input
+// into a terminal. The per-arch tables live in sandbox_seccomp_linux_<arch>.go.
+//
+// Three syscalls are judged by their arguments rather than refused
+// outright, because every program needs them in their ordinary use:
+//
+//   - clone is refused when its flags ask for a new namespace. unshare and
+//     setns are on the deny-list; without this, clone(CLONE_NEWUSER) would
+//     build the same nested user namespace by another door.
+//   - clone3 passes its flags in a struct seccomp can't read, so it gets
+//     ENOSYS: libc and language runtimes take that as "old kernel" and fall
+//     back to clone, where the flags are visible.
+//   - ioctl is refused for TIOCSTI and TIOCLINUX, which inject input into a
+//     terminal — relay's own, if it was started from one and the MCP
+//     inherited a descriptor on it.
+
+const (
+	seccompModeFilter = 2
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	bpfLdWAbs = syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS
+	bpfJeqK   = syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K
+	bpfJgeK   = syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K
+	bpfJsetK  = syscall.BPF_JMP | syscall.BPF_JSET | syscall.BPF_K
+	bpfRetK   = syscall.BPF_RET | syscall.BPF_K
+
+	// offsets into struct seccomp_data. An argument's low 32 bits are at
+	// its offset on the little-endian architectures that have a table.
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16
+	seccompDataArg1 = 24
+
+	// sandboxCloneNamespaces are the clone flags that create a namespace.
+	sandboxCloneNamespaces = syscall.CLONE_NEWNS | syscall.CLONE_NEWCGROUP | syscall.CLONE_NEWUTS |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET |
+		syscall.CLONE_NEWTIME
+)
+
+// sandboxDeniedIoctls are the ioctl requests refused with EPERM.
+var sandboxDeniedIoctls = []uint32{syscall.TIOCSTI, syscall.TIOCLINUX}
+
+// seccompTable is one architecture's filter input.
+type seccompTable struct {
+	arch   uint32   // AUDIT_ARCH_* the filter admits
+	x32Bit uint32   // __X32_SYSCALL_BIT, or 0 where there is no such ABI
+	denied []uint32 // refused outright
+	// Syscall numbers checked by argument; see the file comment.
+	ioctl, clone, clone3 uint32
+}
+
+// seccompProgram builds the filter:
+//
+//	arch != native               → kill (no 32-bit compat syscalls around the table)
+//	nr >= x32 bit (amd64)        → EPERM
+//	nr in denied                 → EPERM
+//	clone with namespace flags   → EPERM
+//	clone3                       → ENOSYS
+//	ioctl TIOCSTI / TIOCLINUX    → EPERM
+//	otherwise                    → allow
+//
+// EPERM rather than kill for denied calls: well-behaved programs probe
+// (e.g. for userfaultfd or perf) and fall back when refused.
+func seccompProgram(t seccompTable) []syscall.SockFilter {
+	var prog []syscall.SockFilter
+	labels := map[string]int{}
+	type target struct {
+		at     int
+		jt, jf string // "" is the next instruction
+	}
+	var targets []target
+	stmt := func(code uint16, k uint32) {
+		prog = append(prog, syscall.SockFilter{Code: code, K: k})
+	}
+	jump := func(code uint16, k uint32, jt, jf string) {
+		targets = append(targets, target{len(prog), jt, jf})
+		prog = append(prog, syscall.SockFilter{Code: code, K: k})
+	}
+	label := func(name string) { labels[name] = len(prog) }
+
+	stmt(bpfLdWAbs, seccompDataArch)
+	jump(bpfJeqK, t.arch, "nr", "")
+	stmt(bpfRetK, seccompRetKillProcess)
+	label("nr")
+	stmt(bpfLdWAbs, seccompDataNr)
+	if t.x32Bit != 0 {
+		jump(bpfJgeK, t.x32Bit, "eperm", "")
+	}
+	for _, nr := range t.denied {
+		jump(bpfJeqK, nr, "eperm", "")
+	}
+	if t.clone != 0 {
+		jump(bpfJeqK, t.clone, "clone", "")
+	}
+	if t.clone3 != 0 {
+		jump(bpfJeqK, t.clone3, "enosys", "")
+	}
+	if t.ioctl != 0 {
+		jump(bpfJeqK, t.ioctl, "ioctl", "")
+	}
+	stmt(bpfRetK, seccompRetAllow)
+	label("clone")
+	stmt(bpfLdWAbs, seccompDataArg0)
+	jump(bpfJsetK, sandboxCloneNamespaces, "eperm", "")
+	stmt(bpfRetK, seccompRetAllow)
+	label("ioctl")
+	stmt(bpfLdWAbs, seccompDataArg1)
+	for _, req := range sandboxDeniedIoctls {
+		jump(bpfJeqK, req, "eperm", "")
+	}
+	stmt(bpfRetK, seccompRetAllow)
+	label("enosys")
+	stmt(bpfRetK, seccompRetErrno|uint32(syscall.ENOSYS))
+	label("eperm")
+	stmt(bpfRetK, seccompRetErrno|uint32(syscall.EPERM))
+
+	// BPF jumps only go forward — hence the returns after the checks that
+	// use them — by an 8-bit offset from the next instruction;
+	// applySeccomp keeps the deny-list short enough for that.
+	for _, tg := range targets {
+		if tg.jt != "" {
+			prog[tg.at].Jt = uint8(labels[tg.jt] - tg.at - 1)
+		}
+		if tg.jf != "" {
+			prog[tg.at].Jf = uint8(labels[tg.jf] - tg.at - 1)
+		}
+	}
+	return prog
+}
+
+// applySeccomp installs the filter on the calling thread. Requires
+// no_new_privs.
+func applySeccomp() error {
+	if len(sandboxDeniedSyscalls) == 0 {
+		return fmt.Errorf("no syscall table for %s", runtime.GOARCH)
+	}
+	if len(sandboxDeniedSyscalls) > 240 {
+		return fmt.Errorf("deny-list too long for 8-bit BPF jumps")
+	}
+	prog := seccompProgram(seccompTable{
+		arch: sandboxAuditArch, x32Bit: sandboxX32Bit, denied: sandboxDeniedSyscalls,
+		ioctl: sandboxSysIoctl, clone: sandboxSysClone, clone3: sandboxSysClone3,
+	})
+	fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	if _, _, e := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_SECCOMP, seccompModeFilter, uintptr(unsafe.Pointer(&fprog))); e != 0 {
+		return e
+	}
+	runtime.KeepAlive(prog)
+	return nil
+}
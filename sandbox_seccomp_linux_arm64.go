@@ -0,0 +1,52 @@
+//go:build linux && arm64
+
+package main
+
+const (
+	sandboxAuditArch = 0xc00000b7 // AUDIT_ARCH_AARCH64
+	sandboxX32Bit    = 0          // no x32-style alternate ABI
+
+	sandboxSysIoctl  = 29
+	sandboxSysClone  = 220
+	sandboxSysClone3 = 435
+)
+
+// sandboxDeniedSyscalls is the seccomp deny-list for arm64 (no iopl/ioperm).
+var sandboxDeniedSyscalls = []uint32{
+	39,  // umount2
+	40,  // mount
+	41,  // pivot_root
+	51,  // chroot
+	60,  // quotactl
+	89,  // acct
+	97,  // unshare
+	104, // kexec_load
+	105, // init_module
+	106, // delete_module
+	117, // ptrace
+	142, // reboot
+	161, // sethostname
+	162, // setdomainname
+	217, // add_key
+	218, // request_key
+	219, // keyctl
+	224, // swapon
+	225, // swapoff
+	241, // perf_event_open
+	264, // name_to_handle_at
+	265, // open_by_handle_at
+	268, // setns
+	270, // process_vm_readv
+	271, // process_vm_writev
+	273, // finit_module
+	280, // bpf
+	282, // userfaultfd
+	294, // kexec_file_load
+	428, // open_tree
+	429, // move_mount
+	430, // fsopen
+	431, // fsconfig
+	432, // fsmount
+	433, // fspick
+	442, // mount_setattr
+}
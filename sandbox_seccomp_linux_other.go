@@ -0,0 +1,16 @@
+//go:build linux && !amd64 && !arm64
+
+package main
+
+// No deny-list for this architecture yet: applySeccomp refuses, so a
+// sandboxed MCP fails to start rather than running without the filter.
+const (
+	sandboxAuditArch = 0
+	sandboxX32Bit    = 0
+
+	sandboxSysIoctl  = 0
+	sandboxSysClone  = 0
+	sandboxSysClone3 = 0
+)
+
+var sandboxDeniedSyscalls []uint32
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sandboxedMcp(p *SandboxProfile, services ...string) *ExternalMcp {
+	return &ExternalMcp{ID: "m", DisplayName: "M", Command: "/bin/true", Sandbox: p, LinuxServices: services}
+}
+
+func TestValidateSandbox(t *testing.T) {
+	ok := []*ExternalMcp{
+		sandboxedMcp(nil),
+		sandboxedMcp(&SandboxProfile{Enabled: true, ReadPaths: []string{"/opt/models"}, WritePaths: []string{"~/notes"}}),
+		sandboxedMcp(&SandboxProfile{Enabled: true, DenyNetwork: true}, "audio", "gpu"),
+		// A disabled profile is kept for later but not checked.
+		sandboxedMcp(&SandboxProfile{ReadPaths: []string{"relative"}}),
+	}
+	for i, m := range ok {
+		if err := m.Validate(); err != nil {
+			t.Errorf("ok[%d]: %v", i, err)
+		}
+	}
+
+	bad := map[string]*ExternalMcp{
+		"unknown service":  sandboxedMcp(nil, "telepathy"),
+		"relative path":    sandboxedMcp(&SandboxProfile{Enabled: true, ReadPaths: []string{"data"}}),
+		"whole filesystem": sandboxedMcp(&SandboxProfile{Enabled: true, WritePaths: []string{"/"}}),
+		"network conflict": sandboxedMcp(&SandboxProfile{Enabled: true, DenyNetwork: true}, "network"),
+		"http transport": {ID: "h", DisplayName: "H", Transport: "http", URL: "https://x",
+			Sandbox: &SandboxProfile{Enabled: true}},
+	}
+	for name, m := range bad {
+		if err := m.Validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+	if err := sandboxedMcp(nil, "telepathy").Validate(); !strings.Contains(err.Error(), "display") {
+		t.Errorf("unknown-service error should list the valid names: %v", err)
+	}
+}
+
+func TestParseLinuxServices(t *testing.T) {
+	got := parseLinuxServices(" Audio, gpu,,dbus ")
+	if strings.Join(got, ",") != "audio,gpu,dbus" {
+		t.Fatalf("got %v", got)
+	}
+	if parseLinuxServices("") != nil {
+		t.Fatal("empty input should be nil")
+	}
+}
+
+// planKinds indexes a plan's mounts by path.
+func planKinds(p *sandboxPlan) map[string]sandboxMountKind {
+	out := map[string]sandboxMountKind{}
+	for _, m := range p.Mounts {
+		if m.Link == "" {
+			out[m.Path] = m.Kind
+		}
+	}
+	return out
+}
+
+func TestBuildSandboxPlan(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared")
+	data := filepath.Join(dir, "data")
+	proj := filepath.Join(dir, "proj")
+	runtimeDir := filepath.Join(dir, "run")
+	for _, d := range []string{shared, data, proj, filepath.Join(runtimeDir, "pulse")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bin := filepath.Join(dir, "bin", "mcp")
+
+	p := &SandboxProfile{
+		Enabled:      true,
+		ReadPaths:    []string{shared, data},
+		WritePaths:   []string{shared},
+		ProjectPaths: true,
+		projectPaths: []string{proj, filepath.Join(dir, "gone")},
+	}
+	env := map[string]string{"XDG_RUNTIME_DIR": runtimeDir}
+	plan, err := buildSandboxPlan(sandboxedMcp(p, "audio", "dbus"), bin, []string{bin}, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatalf("buildSandboxPlan: %v", err)
+	}
+	kinds := planKinds(plan)
+
+	want := map[string]sandboxMountKind{
+		shared:                             sandboxBindRW, // write wins over read
+		data:                               sandboxBindRO,
+		proj:                               sandboxBindRW,
+		filepath.Dir(bin):                  sandboxBindRO,
+		filepath.Join(runtimeDir, "pulse"): sandboxBindRW,
+		"/tmp":                             sandboxTmpfs,
+		"/proc":                            sandboxProcfs,
+		"/dev":                             sandboxDevfs,
+	}
+	for path, kind := range want {
+		if kinds[path] != kind {
+			t.Errorf("%s = %q, want %q", path, kinds[path], kind)
+		}
+	}
+	if _, ok := kinds[filepath.Join(dir, "gone")]; ok {
+		t.Error("a project path that no longer exists was planned")
+	}
+	// dbus's session socket doesn't exist here: skipped, not an error.
+	if _, ok := kinds[filepath.Join(runtimeDir, "bus")]; ok {
+		t.Error("missing service socket was planned")
+	}
+	for i := 1; i < len(plan.Mounts); i++ {
+		if plan.Mounts[i-1].Path > plan.Mounts[i].Path {
+			t.Fatalf("mounts not sorted: %s before %s", plan.Mounts[i-1].Path, plan.Mounts[i].Path)
+		}
+	}
+}
+
+// TestBuildSandboxPlan_UnsetEnvSkipsServicePath: with $XDG_RUNTIME_DIR unset,
+// "$XDG_RUNTIME_DIR/pulse" must not collapse to "/pulse".
+func TestBuildSandboxPlan_UnsetEnvSkipsServicePath(t *testing.T) {
+	plan, err := buildSandboxPlan(sandboxedMcp(&SandboxProfile{Enabled: true}, "audio", "display"),
+		"/bin/true", nil, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range plan.Mounts {
+		if m.Path == "/pulse" || m.Path == "/pipewire-0" || m.Path == "/" {
+			t.Fatalf("unset env var produced mount %q", m.Path)
+		}
+	}
+}
+
+// TestBuildSandboxPlan_MissingDeclaredPath: a typo in a declared path is an
+// error, not silently no access.
+func TestBuildSandboxPlan_MissingDeclaredPath(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "typo")
+	_, err := buildSandboxPlan(sandboxedMcp(&SandboxProfile{Enabled: true, WritePaths: []string{missing}}),
+		"/bin/true", nil, os.Getenv)
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestSandboxProjectPaths(t *testing.T) {
+	s := &Settings{Projects: []Project{
+		{ID: "a", Path: "/work/a", AllowedMcpIDs: []string{"fs", "git"}},
+		{ID: "b", Path: "/work/b", AllowedMcpIDs: []string{"git"}},
+		{ID: "r", Kind: ProjectKindRemote, AllowedMcpIDs: []string{"fs"}},
+	}}
+	got := sandboxProjectPaths(s, "fs")
+	if len(got) != 1 || got[0] != "/work/a" {
+		t.Fatalf("fs project paths = %v", got)
+	}
+	if got := sandboxProjectPaths(s, "other"); len(got) != 0 {
+		t.Fatalf("ungranted MCP got %v", got)
+	}
+}
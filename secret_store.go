@@ -0,0 +1,471 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Encrypted-at-rest secret store.
+//
+// settings.json is 0600, but 0600 does nothing for the copies of it that end
+// up in Time Machine, a dotfiles repo, or a cloud-synced config dir. Once the
+// store is enabled (`relay secrets migrate`), every credential relay manages —
+// the admin secret, project tokens, HTTP MCP OAuth state, and secret-looking
+// MCP/service env vars — is written to secrets.enc.json encrypted under a
+// master key that lives in its own file, and settings.json carries only an
+// opaque `secret://<name>` reference in its place. A copy of settings.json on
+// its own is then worth nothing.
+//
+// The store is file-based on purpose: it has to work on a headless Linux box
+// with no keychain or secret-service daemon. The trade is that the master key
+// is a file too, so the protection is exactly "the key file is not in the
+// backup" — RELAY_SECRETS_KEY_FILE exists so the key can live somewhere the
+// config dir's backups and syncs don't reach.
+//
+// Resolution is entirely inside FileSettingsStore: load swaps references for
+// plaintext before anything else sees the Settings, and save swaps them back.
+// Every other part of relay keeps reading s.AdminSecret or mcp.Env["API_KEY"]
+// exactly as before.
+
+// secretRefPrefix marks a settings value that lives in the secret store.
+const secretRefPrefix = "secret://"
+
+// envSecretsKeyFile overrides where the master key is read from and created.
+const envSecretsKeyFile = "RELAY_SECRETS_KEY_FILE"
+
+const (
+	secretKeyFileName   = "secrets.key"
+	secretStoreFileName = "secrets.enc.json"
+	secretKeyLen        = 32 // AES-256
+	secretStoreVersion  = 1
+)
+
+// isSecretRef reports whether v is a `secret://` reference.
+func isSecretRef(v string) bool {
+	return strings.HasPrefix(v, secretRefPrefix) && len(v) > len(secretRefPrefix)
+}
+
+// secretRef builds the reference for a store entry.
+func secretRef(name string) string { return secretRefPrefix + name }
+
+// secretRefName extracts the entry name from a reference.
+func secretRefName(ref string) string { return strings.TrimPrefix(ref, secretRefPrefix) }
+
+// defaultSecretKeyPath resolves the master-key location for the real config
+// dir: the env override if set, otherwise alongside settings.json.
+func defaultSecretKeyPath(dir string) string {
+	if p := os.Getenv(envSecretsKeyFile); p != "" {
+		return p
+	}
+	return filepath.Join(dir, secretKeyFileName)
+}
+
+// SecretStore is an open, decrypted view of secrets.enc.json. Not safe for
+// concurrent use; callers open one per operation (FileSettingsStore does so
+// under its own mutex).
+type SecretStore struct {
+	path    string
+	key     []byte
+	entries map[string]string
+}
+
+// secretStoreFile is the on-disk shape. Each entry is sealed on its own with
+// its name as additional data, so a hand-edited file can't move one secret's
+// ciphertext under another name (e.g. swap a project token into admin_secret)
+// without failing authentication.
+type secretStoreFile struct {
+	Version int               `json:"version"`
+	Entries map[string]string `json:"entries"` // name → base64(nonce || ciphertext)
+}
+
+// openSecretStore opens the store rooted at dir using the master key at
+// keyPath. Returns (nil, nil) when there is no key file — the store has not
+// been enabled and settings stay plaintext.
+func openSecretStore(dir, keyPath string) (*SecretStore, error) {
+	key, err := readSecretKey(keyPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	st := &SecretStore{
+		path:    filepath.Join(dir, secretStoreFileName),
+		key:     key,
+		entries: map[string]string{},
+	}
+	if err := st.load(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// createSecretStore enables the store: it generates a master key at keyPath
+// if none exists yet, then opens the store.
+func createSecretStore(dir, keyPath string) (*SecretStore, error) {
+	if _, err := os.Stat(keyPath); errors.Is(err, os.ErrNotExist) {
+		if err := writeNewSecretKey(keyPath); err != nil {
+			return nil, err
+		}
+	}
+	return openSecretStore(dir, keyPath)
+}
+
+// readSecretKey loads the hex-encoded master key and refuses one readable by
+// group or other: a key anyone on the box can read protects nothing.
+func readSecretKey(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("secret store key %s has mode %v; must be 0600", path, info.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read secret store key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != secretKeyLen {
+		return nil, fmt.Errorf("secret store key %s is not %d hex-encoded bytes", path, secretKeyLen)
+	}
+	return key, nil
+}
+
+// writeNewSecretKey creates a fresh master key. O_EXCL so two racing
+// `relay secrets migrate` runs can't each generate a key and have the loser's
+// ciphertext become undecryptable.
+func writeNewSecretKey(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create secret key dir: %w", err)
+	}
+	key := make([]byte, secretKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("generate secret store key: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("create secret store key: %w", err)
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("write secret store key: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("sync secret store key: %w", err)
+	}
+	return f.Close()
+}
+
+func (st *SecretStore) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(st.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// load decrypts secrets.enc.json. A missing file is an empty store. Any entry
+// that fails to decrypt fails the whole load: silently dropping it would let
+// the next save garbage-collect a credential the user still needs.
+func (st *SecretStore) load() error {
+	data, err := os.ReadFile(st.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read secret store: %w", err)
+	}
+	var f secretStoreFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parse secret store: %w", err)
+	}
+	if f.Version != secretStoreVersion {
+		return fmt.Errorf("secret store version %d not supported", f.Version)
+	}
+	aead, err := st.aead()
+	if err != nil {
+		return err
+	}
+	for name, enc := range f.Entries {
+		raw, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil || len(raw) < aead.NonceSize() {
+			return fmt.Errorf("secret %q: malformed ciphertext", name)
+		}
+		plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(name))
+		if err != nil {
+			return fmt.Errorf("secret %q: decryption failed (wrong key or tampered file)", name)
+		}
+		st.entries[name] = string(plain)
+	}
+	return nil
+}
+
+// save re-seals every entry under a fresh nonce and writes the file atomically.
+func (st *SecretStore) save() error {
+	aead, err := st.aead()
+	if err != nil {
+		return err
+	}
+	f := secretStoreFile{Version: secretStoreVersion, Entries: make(map[string]string, len(st.entries))}
+	for name, plain := range st.entries {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return fmt.Errorf("generate nonce: %w", err)
+		}
+		f.Entries[name] = base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(plain), []byte(name)))
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("serialize secret store: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(st.path), 0o700); err != nil {
+		return fmt.Errorf("create secret store dir: %w", err)
+	}
+	if err := atomicWriteFile(st.path, data, 0o600); err != nil {
+		return fmt.Errorf("write secret store: %w", err)
+	}
+	return nil
+}
+
+// Get returns the plaintext for name.
+func (st *SecretStore) Get(name string) (string, bool) {
+	v, ok := st.entries[name]
+	return v, ok
+}
+
+// Set stores a plaintext value. Does not save.
+func (st *SecretStore) Set(name, value string) { st.entries[name] = value }
+
+// Delete removes an entry. Does not save.
+func (st *SecretStore) Delete(name string) { delete(st.entries, name) }
+
+// Names lists every entry name, sorted.
+func (st *SecretStore) Names() []string {
+	names := make([]string, 0, len(st.entries))
+	for n := range st.entries {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ---------------------------------------------------------------------------
+// Settings ↔ store mapping
+// ---------------------------------------------------------------------------
+
+// secretField is one credential-bearing value in Settings. name is its
+// canonical store entry; auto says whether a plaintext value is moved into the
+// store on save (always true except for env vars whose key doesn't look like a
+// credential — PATH and friends stay readable).
+type secretField struct {
+	name string
+	auto bool
+	get  func() string
+	set  func(string)
+}
+
+// managedSecretPrefixes are the canonical namespaces relay owns. Entries under
+// them that no field references any more (the MCP or env profile was
+// removed, the token rotated away) are garbage-collected on save. Names a
+// user chose by hand (`relay secrets set --name openai`) are never collected.
+var managedSecretPrefixes = []string{"admin_secret", "project/", "mcp/", "service/", "profile/"}
+
+func isManagedSecretName(name string) bool {
+	for _, p := range managedSecretPrefixes {
+		if name == p || strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretEnvKeyMarkers flag an env var as a credential for auto-migration.
+var secretEnvKeyMarkers = []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "AUTH"}
+
+// looksSecretEnvKey reports whether an env var name suggests a credential.
+// Deliberately a heuristic: anything it misses can still be stored by hand
+// and referenced as `secret://<name>`.
+func looksSecretEnvKey(k string) bool {
+	up := strings.ToUpper(k)
+	for _, m := range secretEnvKeyMarkers {
+		if strings.Contains(up, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretFields enumerates every credential-bearing value in s.
+func secretFields(s *Settings) []secretField {
+	var out []secretField
+	str := func(name string, auto bool, p *string) {
+		out = append(out, secretField{name: name, auto: auto, get: func() string { return *p }, set: func(v string) { *p = v }})
+	}
+	env := func(prefix string, m map[string]string) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			k := k
+			out = append(out, secretField{
+				name: prefix + k,
+				auto: looksSecretEnvKey(k),
+				get:  func() string { return m[k] },
+				set:  func(v string) { m[k] = v },
+			})
+		}
+	}
+
+	str("admin_secret", true, &s.AdminSecret)
+	for i := range s.Projects {
+		p := &s.Projects[i]
+		str("project/"+p.ID+"/token", true, &p.Token)
+	}
+	for i := range s.ExternalMcps {
+		m := &s.ExternalMcps[i]
+		if o := m.OAuthState; o != nil {
+			str("mcp/"+m.ID+"/oauth/access_token", true, &o.AccessToken)
+			str("mcp/"+m.ID+"/oauth/refresh_token", true, &o.RefreshToken)
+			str("mcp/"+m.ID+"/oauth/client_secret", true, &o.ClientSecret)
+		}
+		env("mcp/"+m.ID+"/env/", m.Env)
+	}
+	for i := range s.Services {
+		svc := &s.Services[i]
+		env("service/"+svc.ID+"/env/", svc.Env)
+	}
+	profiles := make([]string, 0, len(s.EnvProfiles))
+	for name := range s.EnvProfiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	for _, name := range profiles {
+		env("profile/"+name+"/env/", s.EnvProfiles[name])
+	}
+	return out
+}
+
+// resolveSecretRefs replaces every `secret://` reference in s with its
+// plaintext and returns field → entry name for each one, so save can write
+// the same references back. A reference that can't be resolved (no store, or
+// no such entry) becomes "" — never the literal reference string, which
+// would otherwise go out as a bearer token or an env value — and is reported
+// in errs.
+func resolveSecretRefs(s *Settings, st *SecretStore) (refs map[string]string, errs []error) {
+	refs = map[string]string{}
+	for _, f := range secretFields(s) {
+		v := f.get()
+		if !isSecretRef(v) {
+			continue
+		}
+		name := secretRefName(v)
+		refs[f.name] = name
+		if st == nil {
+			errs = append(errs, fmt.Errorf("%s references %s but the secret store is not enabled", f.name, v))
+			f.set("")
+			continue
+		}
+		plain, ok := st.Get(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s references unknown secret %q", f.name, name))
+			f.set("")
+			continue
+		}
+		f.set(plain)
+	}
+	return refs, errs
+}
+
+// externalizeSecrets is resolveSecretRefs in reverse, applied to a copy of
+// the settings about to be written. For each field:
+//   - a value that came from a reference and is unchanged keeps it (so a
+//     user-named `secret://openai` stays pointed at "openai");
+//   - a changed one is written back into its own canonical entry, in place
+//     when that's the entry it came from, and otherwise repointed there:
+//     other fields may share a user-named entry, and must not change too;
+//   - a dangling reference that resolved to "" is preserved untouched;
+//   - any other auto field's plaintext moves to its canonical entry.
+//
+// With no store (st == nil) only the dangling-reference rule applies and
+// everything else is written as it is. Returns the new field → entry map.
+func externalizeSecrets(s *Settings, st *SecretStore, refs map[string]string) (map[string]string, error) {
+	next := map[string]string{}
+	keep := map[string]bool{}
+	for _, f := range secretFields(s) {
+		v := f.get()
+		orig, hadRef := refs[f.name]
+		switch {
+		case isSecretRef(v):
+			next[f.name] = secretRefName(v)
+			keep[secretRefName(v)] = true
+			continue
+		case v == "":
+			if hadRef && (st == nil || !hasSecret(st, orig)) {
+				f.set(secretRef(orig))
+				next[f.name] = orig
+				keep[orig] = true
+			}
+			continue
+		case st == nil && hadRef:
+			// The field is stored behind a key we can't read (moved, or
+			// RELAY_SECRETS_KEY_FILE unset). Writing the new value in
+			// plaintext over the reference would both leak it and orphan
+			// the entry; make the user restore the key first.
+			return nil, fmt.Errorf("%s is stored as %s but the secret store key is missing; restore it before changing the value", f.name, secretRef(orig))
+		case st == nil:
+			continue
+		case hadRef && (orig == f.name || secretEquals(st, orig, v)):
+			st.Set(orig, v)
+			f.set(secretRef(orig))
+			next[f.name] = orig
+			keep[orig] = true
+		case hadRef:
+			st.Set(f.name, v)
+			f.set(secretRef(f.name))
+			next[f.name] = f.name
+			keep[f.name] = true
+		case f.auto && !hasEnvRef(v):
+			// A ${secret:}/${file:} value is a reference already
+			// (env_refs.go); storing it would only hide it.
+			st.Set(f.name, v)
+			f.set(secretRef(f.name))
+			next[f.name] = f.name
+			keep[f.name] = true
+		}
+	}
+	if st != nil {
+		for _, name := range st.Names() {
+			if isManagedSecretName(name) && !keep[name] {
+				st.Delete(name)
+			}
+		}
+	}
+	return next, nil
+}
+
+func hasSecret(st *SecretStore, name string) bool {
+	_, ok := st.Get(name)
+	return ok
+}
+
+// secretEquals reports whether the entry name holds v.
+func secretEquals(st *SecretStore, name, v string) bool {
+	cur, ok := st.Get(name)
+	return ok && cur == v
+}
@@ -0,0 +1,388 @@
+package main
+
+// Coverage for the encrypted secret store (secret_store.go) and its
+// integration into FileSettingsStore: credentials leave settings.json once the
+// store is enabled, come back as plaintext on load, and a config without a key
+// behaves exactly as before.
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// secretTestSettings is a config carrying one of every credential kind.
+func secretTestSettings() *Settings {
+	s := defaultSettings()
+	s.AdminSecret = "admin-plain"
+	s.Projects = []Project{{ID: "p1", Name: "P1", Token: "proj-token-plain", TokenHash: "hash"}}
+	s.ExternalMcps = []ExternalMcp{{
+		ID:          "krisp",
+		DisplayName: "Krisp",
+		Env:         map[string]string{"API_KEY": "env-key-plain", "LOG_LEVEL": "debug"},
+		OAuthState: &OAuthState{
+			ClientID:     "cid",
+			ClientSecret: "client-secret-plain",
+			AccessToken:  "access-plain",
+			RefreshToken: "refresh-plain",
+		},
+	}}
+	s.Services = []ServiceConfig{{ID: "svc", DisplayName: "svc", Env: map[string]string{"DB_PASSWORD": "db-plain"}}}
+	s.normalize()
+	return s
+}
+
+func readSettingsFile(t *testing.T, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "settings.json"))
+	if err != nil {
+		t.Fatalf("read settings.json: %v", err)
+	}
+	return string(data)
+}
+
+// enabledSecretStore returns a settings store in a temp dir with the secret
+// store switched on (key created) and seeded with secretTestSettings.
+func enabledSecretStore(t *testing.T) (*FileSettingsStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := createSecretStore(dir, filepath.Join(dir, secretKeyFileName)); err != nil {
+		t.Fatalf("createSecretStore: %v", err)
+	}
+	store := NewSettingsStoreAt(dir)
+	seed := secretTestSettings()
+	if err := store.With(func(s *Settings) { *s = *seed }); err != nil {
+		t.Fatalf("With: %v", err)
+	}
+	return store, dir
+}
+
+func TestSecretStore_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, secretKeyFileName)
+	st, err := createSecretStore(dir, keyPath)
+	if err != nil {
+		t.Fatalf("createSecretStore: %v", err)
+	}
+	st.Set("openai", "sk-123")
+	if err := st.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, secretStoreFileName))
+	if strings.Contains(string(raw), "sk-123") {
+		t.Fatal("plaintext written to secrets.enc.json")
+	}
+
+	st2, err := openSecretStore(dir, keyPath)
+	if err != nil || st2 == nil {
+		t.Fatalf("openSecretStore: %v, %v", st2, err)
+	}
+	if v, ok := st2.Get("openai"); !ok || v != "sk-123" {
+		t.Fatalf("Get(openai) = %q, %v", v, ok)
+	}
+}
+
+func TestSecretStore_NoKeyIsDisabled(t *testing.T) {
+	dir := t.TempDir()
+	st, err := openSecretStore(dir, filepath.Join(dir, secretKeyFileName))
+	if st != nil || err != nil {
+		t.Fatalf("openSecretStore without a key = %v, %v; want nil, nil", st, err)
+	}
+}
+
+// TestSecretStore_RejectsMovedCiphertext: entries are bound to their names,
+// so moving one entry's ciphertext under another name fails to open rather
+// than silently handing back the wrong credential.
+func TestSecretStore_RejectsMovedCiphertext(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, secretKeyFileName)
+	st, _ := createSecretStore(dir, keyPath)
+	st.Set("a", "alpha")
+	st.Set("b", "beta")
+	if err := st.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	path := filepath.Join(dir, secretStoreFileName)
+	var f secretStoreFile
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &f); err != nil {
+		t.Fatal(err)
+	}
+	f.Entries["a"], f.Entries["b"] = f.Entries["b"], f.Entries["a"]
+	data, _ = json.Marshal(f)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openSecretStore(dir, keyPath); err == nil {
+		t.Fatal("openSecretStore accepted swapped ciphertext")
+	}
+}
+
+func TestSecretStore_RejectsLooseKeyPermissions(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, secretKeyFileName)
+	if _, err := createSecretStore(dir, keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(keyPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openSecretStore(dir, keyPath); err == nil || !strings.Contains(err.Error(), "0600") {
+		t.Fatalf("openSecretStore with a 0644 key: err = %v, want a mode error", err)
+	}
+}
+
+// TestSettingsStore_ExternalizesCredentials is the core promise: with the
+// store enabled, settings.json holds no credential, and every consumer still
+// reads plaintext.
+func TestSettingsStore_ExternalizesCredentials(t *testing.T) {
+	store, dir := enabledSecretStore(t)
+
+	onDisk := readSettingsFile(t, dir)
+	for _, plain := range []string{"admin-plain", "proj-token-plain", "env-key-plain", "client-secret-plain", "access-plain", "refresh-plain", "db-plain"} {
+		if strings.Contains(onDisk, plain) {
+			t.Errorf("settings.json still contains %q", plain)
+		}
+	}
+	for _, ref := range []string{"secret://admin_secret", "secret://project/p1/token", "secret://mcp/krisp/env/API_KEY", "secret://mcp/krisp/oauth/refresh_token", "secret://service/svc/env/DB_PASSWORD"} {
+		if !strings.Contains(onDisk, ref) {
+			t.Errorf("settings.json missing reference %s", ref)
+		}
+	}
+	// Non-secret env values and the token hash stay readable.
+	if !strings.Contains(onDisk, `"LOG_LEVEL": "debug"`) || !strings.Contains(onDisk, `"hash"`) {
+		t.Error("non-secret values were externalized")
+	}
+
+	// A fresh store (a new process) resolves everything back.
+	got := NewSettingsStoreAt(dir).Get()
+	if got.AdminSecret != "admin-plain" || got.Projects[0].Token != "proj-token-plain" ||
+		got.ExternalMcps[0].Env["API_KEY"] != "env-key-plain" ||
+		got.ExternalMcps[0].OAuthState.RefreshToken != "refresh-plain" ||
+		got.Services[0].Env["DB_PASSWORD"] != "db-plain" {
+		t.Fatalf("resolved settings wrong: %+v", got)
+	}
+	// The writer's own cache kept plaintext too.
+	if store.Get().AdminSecret != "admin-plain" {
+		t.Fatal("cache holds a reference instead of plaintext")
+	}
+}
+
+// TestSettingsStore_GarbageCollectsDroppedSecrets: removing an MCP removes
+// its credentials from the store, not just its references.
+func TestSettingsStore_GarbageCollectsDroppedSecrets(t *testing.T) {
+	store, dir := enabledSecretStore(t)
+	if err := store.With(func(s *Settings) { s.ExternalMcps = []ExternalMcp{} }); err != nil {
+		t.Fatal(err)
+	}
+	st, err := openSecretStore(dir, filepath.Join(dir, secretKeyFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range st.Names() {
+		if strings.HasPrefix(n, "mcp/krisp/") {
+			t.Errorf("entry %q survived its MCP's removal", n)
+		}
+	}
+	if _, ok := st.Get("admin_secret"); !ok {
+		t.Error("unrelated entry was collected")
+	}
+}
+
+// TestSettingsStore_GarbageCollectsDroppedProfileSecrets: removing an env
+// profile's key, then the profile itself, removes their credentials from
+// the store.
+func TestSettingsStore_GarbageCollectsDroppedProfileSecrets(t *testing.T) {
+	store, dir := enabledSecretStore(t)
+	if err := store.With(func(s *Settings) {
+		s.EnvProfiles = map[string]map[string]string{"dev": {"API_KEY": "dev-key", "DB_PASSWORD": "dev-db"}}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	names := func() []string {
+		st, err := openSecretStore(dir, filepath.Join(dir, secretKeyFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, n := range st.Names() {
+			if strings.HasPrefix(n, "profile/") {
+				out = append(out, n)
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+	if got := strings.Join(names(), ","); got != "profile/dev/env/API_KEY,profile/dev/env/DB_PASSWORD" {
+		t.Fatalf("profile entries = %s", got)
+	}
+
+	if err := store.With(func(s *Settings) { delete(s.EnvProfiles["dev"], "API_KEY") }); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names(), ","); got != "profile/dev/env/DB_PASSWORD" {
+		t.Errorf("after removing a key, profile entries = %s", got)
+	}
+
+	if err := store.With(func(s *Settings) { delete(s.EnvProfiles, "dev") }); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(); len(got) != 0 {
+		t.Errorf("entries %v survived their profile's removal", got)
+	}
+}
+
+// TestSettingsStore_PreservesUserNamedRefs: a hand-written reference to a
+// user-named secret stays pointed at that name across saves. Changing one
+// field that shares it moves that field to its own entry rather than
+// changing the others.
+func TestSettingsStore_PreservesUserNamedRefs(t *testing.T) {
+	store, dir := enabledSecretStore(t)
+	st, _ := openSecretStore(dir, filepath.Join(dir, secretKeyFileName))
+	st.Set("openai", "sk-1")
+	if err := st.save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.With(func(s *Settings) {
+		s.ExternalMcps[0].Env["OPENAI_API_KEY"] = "secret://openai"
+		s.Services[0].Env["OPENAI_API_KEY"] = "secret://openai"
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if v := store.Get().ExternalMcps[0].Env["OPENAI_API_KEY"]; v != "sk-1" {
+		t.Fatalf("cached OPENAI_API_KEY = %q, want sk-1", v)
+	}
+	store = NewSettingsStoreAt(dir)
+	if v := store.Get().ExternalMcps[0].Env["OPENAI_API_KEY"]; v != "sk-1" {
+		t.Fatalf("resolved OPENAI_API_KEY = %q, want sk-1", v)
+	}
+	if err := store.With(func(s *Settings) { s.AdminSecret = "admin-2" }); err != nil {
+		t.Fatal(err)
+	}
+	if onDisk := readSettingsFile(t, dir); strings.Count(onDisk, `"OPENAI_API_KEY": "secret://openai"`) != 2 {
+		t.Fatal("user-named reference was rewritten by an unrelated save")
+	}
+
+	if err := store.With(func(s *Settings) { s.ExternalMcps[0].Env["OPENAI_API_KEY"] = "sk-2" }); err != nil {
+		t.Fatal(err)
+	}
+	onDisk := readSettingsFile(t, dir)
+	if !strings.Contains(onDisk, `"OPENAI_API_KEY": "secret://mcp/krisp/env/OPENAI_API_KEY"`) ||
+		!strings.Contains(onDisk, `"OPENAI_API_KEY": "secret://openai"`) {
+		t.Fatalf("want the changed field repointed and the other left on openai:\n%s", onDisk)
+	}
+	st, _ = openSecretStore(dir, filepath.Join(dir, secretKeyFileName))
+	if v, _ := st.Get("openai"); v != "sk-1" {
+		t.Fatalf("openai = %q, want sk-1 left alone", v)
+	}
+	if got := NewSettingsStoreAt(dir).Get(); got.ExternalMcps[0].Env["OPENAI_API_KEY"] != "sk-2" ||
+		got.Services[0].Env["OPENAI_API_KEY"] != "sk-1" {
+		t.Fatalf("resolved = %q / %q, want sk-2 / sk-1",
+			got.ExternalMcps[0].Env["OPENAI_API_KEY"], got.Services[0].Env["OPENAI_API_KEY"])
+	}
+}
+
+// TestSettingsStore_RefsSurviveMissingKey: with the key gone, references
+// resolve to "" (never the literal reference) and a save keeps them intact
+// instead of blanking the fields.
+func TestSettingsStore_RefsSurviveMissingKey(t *testing.T) {
+	_, dir := enabledSecretStore(t)
+	if err := os.Remove(filepath.Join(dir, secretKeyFileName)); err != nil {
+		t.Fatal(err)
+	}
+	store := NewSettingsStoreAt(dir)
+	if v := store.Get().AdminSecret; v != "" {
+		t.Fatalf("AdminSecret with no key = %q, want empty", v)
+	}
+	if err := store.With(func(s *Settings) { s.Projects[0].Name = "renamed" }); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(readSettingsFile(t, dir), "secret://admin_secret") {
+		t.Fatal("reference lost on save without a key")
+	}
+}
+
+// TestSettingsStore_MissingKeyNeverWritesPlaintext: with the key gone, a new
+// value for a referenced field fails the save rather than landing in
+// settings.json, and startup refuses to mint a replacement admin secret.
+func TestSettingsStore_MissingKeyNeverWritesPlaintext(t *testing.T) {
+	_, dir := enabledSecretStore(t)
+	if err := os.Remove(filepath.Join(dir, secretKeyFileName)); err != nil {
+		t.Fatal(err)
+	}
+	before := readSettingsFile(t, dir)
+
+	store := NewSettingsStoreAt(dir)
+	err := store.With(func(s *Settings) { s.Projects[0].Token = "rotated-plain" })
+	if err == nil || !strings.Contains(err.Error(), "project/p1/token") {
+		t.Fatalf("With err = %v, want a missing-key error naming the field", err)
+	}
+	if err := NewSettingsStoreAt(dir).EnsureInitialized(); err == nil || !strings.Contains(err.Error(), "secret://admin_secret") {
+		t.Fatalf("EnsureInitialized err = %v, want an unresolved admin_secret error", err)
+	}
+	if after := readSettingsFile(t, dir); after != before {
+		t.Fatalf("settings.json changed without a key:\n%s", after)
+	}
+}
+
+// TestSettingsStore_AtHonoursKeyFileEnv: a key moved out of the config dir
+// is found through RELAY_SECRETS_KEY_FILE by NewSettingsStoreAt too.
+func TestSettingsStore_AtHonoursKeyFileEnv(t *testing.T) {
+	_, dir := enabledSecretStore(t)
+	moved := filepath.Join(t.TempDir(), "relay.key")
+	if err := os.Rename(filepath.Join(dir, secretKeyFileName), moved); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(envSecretsKeyFile, moved)
+	store := NewSettingsStoreAt(dir)
+	if v := store.Get().AdminSecret; v != "admin-plain" {
+		t.Fatalf("AdminSecret = %q, want admin-plain", v)
+	}
+	if err := store.EnsureInitialized(); err != nil {
+		t.Fatalf("EnsureInitialized: %v", err)
+	}
+}
+
+func TestSettingsStore_NoKeyLeavesPlaintext(t *testing.T) {
+	dir := t.TempDir()
+	store := NewSettingsStoreAt(dir)
+	seed := secretTestSettings()
+	if err := store.With(func(s *Settings) { *s = *seed }); err != nil {
+		t.Fatal(err)
+	}
+	if onDisk := readSettingsFile(t, dir); !strings.Contains(onDisk, "admin-plain") || strings.Contains(onDisk, secretRefPrefix) {
+		t.Fatal("settings externalized without the store enabled")
+	}
+	if _, err := os.Stat(filepath.Join(dir, secretStoreFileName)); !os.IsNotExist(err) {
+		t.Fatal("secrets file created without the store enabled")
+	}
+}
+
+func TestValidateSecretName(t *testing.T) {
+	for _, ok := range []string{"openai", "team/github.pat", "a-b_c"} {
+		if err := validateSecretName(ok); err != nil {
+			t.Errorf("validateSecretName(%q) = %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"", "has space", "admin_secret", "mcp/x/env/K", "project/p/token", "profile/x/env/K"} {
+		if err := validateSecretName(bad); err == nil {
+			t.Errorf("validateSecretName(%q) accepted", bad)
+		}
+	}
+}
+
+// TestSettingsStore_LeavesEnvRefsInline: a ${secret:}/${file:} env value is
+// already a reference (env_refs.go) and stays readable in settings.json even
+// under a credential-looking key.
+func TestSettingsStore_LeavesEnvRefsInline(t *testing.T) {
+	store, dir := enabledSecretStore(t)
+	if err := store.With(func(s *Settings) { s.Services[0].Env["BOT_TOKEN"] = "${secret:telegram_bot_token}" }); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(readSettingsFile(t, dir), `"BOT_TOKEN": "${secret:telegram_bot_token}"`) {
+		t.Fatal("env reference was moved into the secret store")
+	}
+}
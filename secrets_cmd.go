@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// `relay secrets` — enable and manage the encrypted secret store
+// (secret_store.go). Follows the enrol_cmd.go shape: a verb with subcommands
+// over the same SettingsStore.
+//
+// No subcommand ever prints a secret value. `list` shows names and who
+// references them; reading a value back out is what the key file is for.
+func runSecretsCommand(args []string) {
+	store := NewSettingsStore()
+	runSubcommands("secrets", []cliSubcommand{
+		{"migrate", func(_ []string) { secretsMigrate(store) }},
+		{"set", func(a []string) { secretsSet(store, a) }},
+		{"list", func(_ []string) { secretsList(store) }},
+		{"rm", func(a []string) { secretsRm(store, a) }},
+	}, args)
+}
+
+// secretsMigrate enables the store and moves every plaintext credential in
+// settings.json into it. Idempotent: re-running on a migrated config only
+// picks up credentials added in plaintext since (e.g. by hand-editing).
+func secretsMigrate(store *FileSettingsStore) {
+	keyPath := store.secretKeyPath()
+	_, statErr := os.Stat(keyPath)
+	created := os.IsNotExist(statErr)
+	if _, err := createSecretStore(store.dir, keyPath); err != nil {
+		exitError("%v", err)
+	}
+	// A no-op mutation is a full load→save cycle, and save externalizes.
+	if err := store.With(func(*Settings) {}); err != nil {
+		exitError("%v", err)
+	}
+
+	refs := store.secretReferences()
+	fmt.Printf("secret store enabled: %d credential(s) encrypted\n", len(refs))
+	if created {
+		fmt.Printf("  key:     %s (new)\n", keyPath)
+	} else {
+		fmt.Printf("  key:     %s\n", keyPath)
+	}
+	fmt.Printf("  secrets: %s\n", store.dir+string(os.PathSeparator)+secretStoreFileName)
+	// The two warnings that matter: lose the key and every credential is
+	// gone; keep it next to the ciphertext in the same backup and the
+	// encryption bought nothing.
+	fmt.Println("  back up the key separately — without it the stored credentials cannot be recovered")
+	fmt.Printf("  to keep it out of the config dir, move it and set %s\n", envSecretsKeyFile)
+	fmt.Println("  earlier copies of settings.json (backups, syncs) still hold plaintext; rotate anything they exposed")
+}
+
+// secretsSet stores a user-named secret, read from stdin so it never appears
+// in argv or shell history. Reference it from settings as secret://<name>.
+func secretsSet(store *FileSettingsStore, args []string) {
+	fs := flag.NewFlagSet("secrets set", flag.ExitOnError)
+	name := fs.String("name", "", "secret name (letters, digits, . _ - /)")
+	fs.Parse(args)
+
+	if err := validateSecretName(*name); err != nil {
+		exitError("%v", err)
+	}
+	st := openSecretStoreOrExit(store)
+	value, err := readSecretValue(os.Stdin)
+	if err != nil {
+		exitError("%v", err)
+	}
+	_, existed := st.Get(*name)
+	st.Set(*name, value)
+	if err := st.save(); err != nil {
+		exitError("%v", err)
+	}
+	// Touch settings.json so the tray's poll reloads and re-resolves any
+	// field already pointing at this name.
+	if err := store.With(func(*Settings) {}); err != nil {
+		exitError("%v", err)
+	}
+	if existed {
+		fmt.Printf("updated secret %q\n", *name)
+	} else {
+		fmt.Printf("stored secret %q\n", *name)
+	}
+	fmt.Printf("  reference it as %s%s\n", secretRefPrefix, *name)
+}
+
+func secretsList(store *FileSettingsStore) {
+	st := openSecretStoreOrExit(store)
+	usedBy := map[string][]string{}
+	for field, name := range store.secretReferences() {
+		usedBy[name] = append(usedBy[name], field)
+	}
+	names := st.Names()
+	if len(names) == 0 {
+		fmt.Println("no secrets")
+		return
+	}
+	w := newTabWriter()
+	fmt.Fprintln(w, "NAME\tUSED BY")
+	for _, n := range names {
+		fields := usedBy[n]
+		sort.Strings(fields)
+		fmt.Fprintf(w, "%s\t%s\n", n, dash(strings.Join(fields, ", ")))
+	}
+	w.Flush()
+}
+
+// secretsRm deletes a user-named secret. Refuses while anything references
+// it: a dangling reference resolves to "", which surfaces later as a
+// confusing auth failure rather than here. Entries relay manages are
+// removed by removing the thing that owns them.
+func secretsRm(store *FileSettingsStore, args []string) {
+	fs := flag.NewFlagSet("secrets rm", flag.ExitOnError)
+	name := fs.String("name", "", "secret name to remove")
+	fs.Parse(args)
+
+	if *name == "" {
+		exitError("--name is required")
+	}
+	st := openSecretStoreOrExit(store)
+	if _, ok := st.Get(*name); !ok {
+		exitError("no secret named %q", *name)
+	}
+	var users []string
+	for field, ref := range store.secretReferences() {
+		if ref == *name {
+			users = append(users, field)
+		}
+	}
+	if len(users) > 0 {
+		sort.Strings(users)
+		exitError("secret %q is still referenced by %s", *name, strings.Join(users, ", "))
+	}
+	st.Delete(*name)
+	if err := st.save(); err != nil {
+		exitError("%v", err)
+	}
+	fmt.Printf("removed secret %q\n", *name)
+}
+
+func openSecretStoreOrExit(store *FileSettingsStore) *SecretStore {
+	st, err := store.secretStore()
+	if err != nil {
+		exitError("%v", err)
+	}
+	if st == nil {
+		exitError("secret store is not enabled; run: relay secrets migrate")
+	}
+	return st
+}
+
+// validateSecretName restricts user-chosen names to a path-like charset and
+// keeps them out of the namespaces relay garbage-collects, where a
+// hand-stored entry would silently vanish on the next settings save.
+func validateSecretName(name string) error {
+	if name == "" {
+		return fmt.Errorf("--name is required")
+	}
+	for _, r := range name {
+		ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '.' || r == '_' || r == '-' || r == '/'
+		if !ok {
+			return fmt.Errorf("secret name %q may only contain letters, digits, '.', '_', '-' and '/'", name)
+		}
+	}
+	if isManagedSecretName(name) {
+		return fmt.Errorf("secret name %q is in a namespace relay manages; choose another name", name)
+	}
+	return nil
+}
+
+// readSecretValue reads one value from r: the first line, without its line
+// ending, so `echo $TOKEN | relay secrets set` and an interactive paste both
+// work. Empty is refused — it is never what the user meant to store.
+func readSecretValue(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("read secret from stdin: %w", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("no secret value on stdin")
+	}
+	return line, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"relaygo/bridge"
+)
+
+// Action inputs: the values a user typed into an action's form, checked
+// against the manifest's schema before they become the request body.
+//
+// The settings UI already renders the form from the schema and refuses to
+// submit one missing a required field, but relay is the side that sends
+// the request, so it checks again: the IPC message is just JSON, and a
+// service declaring `"type": "number"` should be able to rely on getting
+// one. The checks are the schema's own — types, required leaves, select
+// options, no keys the schema doesn't declare — and nothing the schema
+// can't express; what a value means is still the service's to judge.
+
+// actionBody returns the request body for running action with inputs: nil
+// for an action that declares none (and was sent none), otherwise the
+// inputs as a JSON object, once they match the schema. Absent inputs are
+// an empty object, so an action whose fields are all optional runs
+// without a form having been filled in (a pre-stop hook, say).
+func actionBody(action *bridge.ActionDecl, inputs json.RawMessage) (json.RawMessage, error) {
+	empty := len(bytes.TrimSpace(inputs)) == 0 || bytes.Equal(bytes.TrimSpace(inputs), []byte("null"))
+	if len(action.Inputs) == 0 {
+		if !empty && !bytes.Equal(bytes.TrimSpace(inputs), []byte("{}")) {
+			return nil, fmt.Errorf("action %q takes no inputs", action.ID)
+		}
+		return nil, nil
+	}
+	var obj map[string]any
+	if !empty {
+		dec := json.NewDecoder(bytes.NewReader(inputs))
+		dec.UseNumber()
+		if err := dec.Decode(&obj); err != nil || obj == nil {
+			return nil, fmt.Errorf("action %q: inputs must be a JSON object", action.ID)
+		}
+	}
+	if obj == nil {
+		obj = map[string]any{}
+	}
+	if err := checkInputObject("", action.Inputs, obj); err != nil {
+		return nil, fmt.Errorf("action %q: %w", action.ID, err)
+	}
+	return json.Marshal(obj)
+}
+
+// checkInputObject checks an object's keys against its declared fields.
+// label is the dotted path to the object, for errors. A "keyValue" field
+// with Rest set owns every key the other fields don't, so those pass as
+// long as they are scalars.
+func checkInputObject(label string, fields []bridge.FieldDecl, obj map[string]any) error {
+	var rest bool
+	for _, f := range fields {
+		rest = rest || (f.Type == bridge.FieldTypeKeyValue && f.Rest)
+	}
+	for key, v := range obj {
+		if slices.ContainsFunc(fields, func(f bridge.FieldDecl) bool { return f.ID == key && !f.Rest }) {
+			continue
+		}
+		if !rest {
+			return fmt.Errorf("input %q is not in the action's form", inputLabel(label, key))
+		}
+		if !isInputScalar(v) {
+			return fmt.Errorf("input %q must be a string, number or boolean", inputLabel(label, key))
+		}
+	}
+	for i := range fields {
+		f := &fields[i]
+		if f.Type == bridge.FieldTypeKeyValue && f.Rest {
+			continue
+		}
+		if err := checkInputValue(inputLabel(label, f.ID), f, obj[f.ID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkInputValue checks one value against its field. A missing value, a
+// null, an empty string or an empty list is "not filled in": an error for
+// a required field and fine for any other, the same reading of required
+// the config editor's save check uses.
+func checkInputValue(label string, f *bridge.FieldDecl, v any) error {
+	if inputEmpty(v) {
+		if f.Required {
+			return fmt.Errorf("input %q is required", label)
+		}
+		return nil
+	}
+	switch f.Type {
+	case bridge.FieldTypeText, bridge.FieldTypeTextarea, bridge.FieldTypeSecret:
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("input %q must be a string", label)
+		}
+	case bridge.FieldTypeSelect:
+		if s, ok := v.(string); !ok || !slices.Contains(f.Options, s) {
+			return fmt.Errorf("input %q must be one of %v", label, f.Options)
+		}
+	case bridge.FieldTypeBool:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("input %q must be true or false", label)
+		}
+	case bridge.FieldTypeNumber:
+		if _, ok := v.(json.Number); !ok {
+			return fmt.Errorf("input %q must be a number", label)
+		}
+	case bridge.FieldTypeStringArr:
+		list, ok := v.([]any)
+		if !ok || slices.ContainsFunc(list, func(item any) bool { _, ok := item.(string); return !ok }) {
+			return fmt.Errorf("input %q must be a list of strings", label)
+		}
+	case bridge.FieldTypeStringMap:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("input %q must be an object of strings", label)
+		}
+		for _, item := range m {
+			if _, ok := item.(string); !ok {
+				return fmt.Errorf("input %q must be an object of strings", label)
+			}
+		}
+	case bridge.FieldTypeKeyValue:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("input %q must be an object", label)
+		}
+		for key, item := range m {
+			if !isInputScalar(item) {
+				return fmt.Errorf("input %q must be a string, number or boolean", inputLabel(label, key))
+			}
+		}
+	case bridge.FieldTypeJSON:
+		// Any JSON at all; that's what the escape hatch is for.
+	case bridge.FieldTypeObject:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("input %q must be an object", label)
+		}
+		return checkInputObject(label, f.Fields, m)
+	case bridge.FieldTypeArray:
+		list, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("input %q must be a list", label)
+		}
+		for i, item := range list {
+			if err := checkInputItem(fmt.Sprintf("%s[%d]", label, i), f.Item, item); err != nil {
+				return err
+			}
+		}
+	case bridge.FieldTypeMap:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("input %q must be an object", label)
+		}
+		for key, item := range m {
+			if err := checkInputItem(inputLabel(label, key), f.Item, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("input %q has unsupported type %q", label, f.Type)
+	}
+	return nil
+}
+
+// checkInputItem checks one element of an array or map. An element that
+// is there at all must have the item's shape; "required" is about whether
+// the user filled a field in, not whether a list has holes.
+func checkInputItem(label string, item *bridge.FieldDecl, v any) error {
+	if item == nil {
+		return fmt.Errorf("input %q has no item schema", label)
+	}
+	if v == nil {
+		return fmt.Errorf("input %q is empty", label)
+	}
+	return checkInputValue(label, item, v)
+}
+
+func inputEmpty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+func isInputScalar(v any) bool {
+	switch v.(type) {
+	case string, json.Number, bool:
+		return true
+	}
+	return false
+}
+
+func inputLabel(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"relaygo/bridge"
+)
+
+// Tests for checking an action's inputs against its schema
+// (service_action_inputs.go): what becomes the body, each field type's
+// shape, required fields, select options, undeclared keys and rest
+// keyValue fields.
+
+func pullAction() *bridge.ActionDecl {
+	return &bridge.ActionDecl{ID: "pull", Label: "Pull", Method: "POST", PathTemplate: "/api/pull", Inputs: []bridge.FieldDecl{
+		{ID: "name", Type: bridge.FieldTypeText, Required: true},
+		{ID: "quant", Type: bridge.FieldTypeSelect, Options: []string{"q4", "q8"}},
+		{ID: "keep", Type: bridge.FieldTypeBool},
+		{ID: "ctx", Type: bridge.FieldTypeNumber},
+		{ID: "tags", Type: bridge.FieldTypeStringArr},
+		{ID: "env", Type: bridge.FieldTypeStringMap},
+		{ID: "extra", Type: bridge.FieldTypeJSON},
+		{ID: "source", Type: bridge.FieldTypeObject, Fields: []bridge.FieldDecl{
+			{ID: "url", Type: bridge.FieldTypeText, Required: true},
+			{ID: "flags", Type: bridge.FieldTypeKeyValue, Rest: true},
+		}},
+		{ID: "mirrors", Type: bridge.FieldTypeArray, Item: &bridge.FieldDecl{Type: bridge.FieldTypeText}},
+		{ID: "limits", Type: bridge.FieldTypeMap, Item: &bridge.FieldDecl{Type: bridge.FieldTypeNumber}},
+	}}
+}
+
+func TestActionBody_Valid(t *testing.T) {
+	in := `{"name":"qwen3-8b","quant":"q4","keep":true,"ctx":8192,"tags":["a"],"env":{"A":"1"},"extra":[1,{"x":null}],` +
+		`"source":{"url":"https://x","threads":4,"mmap":false},"mirrors":["m1"],"limits":{"rpm":60}}`
+	body, err := actionBody(pullAction(), json.RawMessage(in))
+	if err != nil {
+		t.Fatalf("actionBody: %v", err)
+	}
+	var got, want any
+	_ = json.Unmarshal(body, &got)
+	_ = json.Unmarshal([]byte(in), &want)
+	if gb, _ := json.Marshal(got); string(gb) != mustMarshalString(want) {
+		t.Errorf("body = %s, want the inputs unchanged", body)
+	}
+	if !strings.Contains(string(body), `"ctx":8192`) {
+		t.Errorf("number lost its form: %s", body)
+	}
+
+	// Optional fields left empty are fine.
+	if _, err := actionBody(pullAction(), json.RawMessage(`{"name":"x","quant":"","tags":[],"ctx":null}`)); err != nil {
+		t.Errorf("empty optional fields: %v", err)
+	}
+}
+
+func mustMarshalString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func TestActionBody_Rejects(t *testing.T) {
+	for _, tc := range []struct{ name, in, want string }{
+		{"not an object", `["x"]`, "JSON object"},
+		{"required missing", `{}`, `input "name" is required`},
+		{"required empty", `{"name":""}`, `input "name" is required`},
+		{"text as number", `{"name":7}`, `"name" must be a string`},
+		{"select off the list", `{"name":"x","quant":"q2"}`, "must be one of [q4 q8]"},
+		{"bool as string", `{"name":"x","keep":"yes"}`, "true or false"},
+		{"number as string", `{"name":"x","ctx":"8k"}`, "must be a number"},
+		{"string list with a number", `{"name":"x","tags":["a",1]}`, "list of strings"},
+		{"stringMap with a bool", `{"name":"x","env":{"A":true}}`, "object of strings"},
+		{"undeclared key", `{"name":"x","admin":true}`, `"admin" is not in the action's form`},
+		{"nested required", `{"name":"x","source":{"threads":4}}`, `"source.url" is required`},
+		{"rest value not scalar", `{"name":"x","source":{"url":"u","deep":{"a":1}}}`, `"source.deep" must be a string, number or boolean`},
+		{"array item wrong type", `{"name":"x","mirrors":["m1",2]}`, `"mirrors[1]" must be a string`},
+		{"array item null", `{"name":"x","mirrors":[null]}`, `"mirrors[0]" is empty`},
+		{"map value wrong type", `{"name":"x","limits":{"rpm":"lots"}}`, `"limits.rpm" must be a number`},
+	} {
+		_, err := actionBody(pullAction(), json.RawMessage(tc.in))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want it to mention %s", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestActionBody_NoInputs(t *testing.T) {
+	plain := &bridge.ActionDecl{ID: "reload", Method: "POST", PathTemplate: "/reload"}
+	for _, in := range []string{"", "null", "{}"} {
+		if body, err := actionBody(plain, json.RawMessage(in)); err != nil || body != nil {
+			t.Errorf("inputs %q: body %s, err %v; want no body", in, body, err)
+		}
+	}
+	if _, err := actionBody(plain, json.RawMessage(`{"x":1}`)); err == nil || !strings.Contains(err.Error(), "takes no inputs") {
+		t.Errorf("inputs to a plain action: err = %v", err)
+	}
+
+	// All-optional inputs with nothing sent: an empty object body.
+	opt := &bridge.ActionDecl{ID: "flush", Inputs: []bridge.FieldDecl{{ID: "force", Type: bridge.FieldTypeBool}}}
+	if body, err := actionBody(opt, nil); err != nil || string(body) != "{}" {
+		t.Errorf("optional inputs, none sent: body %s, err %v", body, err)
+	}
+	if _, err := actionBody(pullAction(), nil); err == nil {
+		t.Error("required inputs, none sent: no error")
+	}
+}
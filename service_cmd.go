@@ -1,10 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"relaygo/bridge"
 )
@@ -15,7 +20,12 @@ func runServiceCommand(args []string) {
 		{"register", func(a []string) { serviceRegister(store, a) }},
 		{"unregister", func(a []string) { serviceUnregister(store, a) }},
 		{"restart", func(a []string) { serviceRestart(store, a) }},
-		{"list", func(_ []string) { serviceList(store) }},
+		{"run", func(a []string) { serviceRun(store, a) }},
+		{"list", func(a []string) { serviceList(store, a) }},
+		{"status", func(a []string) { serviceStatus(store, a) }},
+		{"logs", func(a []string) { serviceLogs(store, a) }},
+		{"show", func(a []string) { serviceShow(store, a) }},
+		{"profile", func(a []string) { serviceProfile(store, a) }},
 	}, args)
 }
 
@@ -23,10 +33,47 @@ func serviceRegister(store SettingsStore, args []string) {
 	fs := flag.NewFlagSet("service register", flag.ExitOnError)
 	var opts registerOpts
 	addRegisterFlags(fs, &opts)
+	var limits ResourceLimits
+	addLimitFlags(fs, &limits)
 	command := fs.String("command", "", "command to run (required)")
 	workdir := fs.String("workdir", "", "working directory")
 	url := fs.String("url", "", "service URL")
 	autostart := fs.Bool("autostart", false, "start automatically")
+	restart := fs.String("restart", "", "restart policy: no, on-failure or always")
+	maxRetries := fs.Int("max-retries", 0, "restarts without a stable run before giving up (default 5)")
+	restartBackoff := fs.Int("restart-backoff", 0, "seconds before the first restart, doubling after (default 1)")
+	var successCodes stringSlice
+	fs.Var(&successCodes, "success-exit-code", "exit code on-failure treats as a clean stop (repeatable)")
+	var health HealthCheck
+	fs.StringVar(&health.HTTP, "health-http", "", "health check: GET this path (on the service's socket or URL) or http(s) URL")
+	fs.StringVar(&health.TCP, "health-tcp", "", "health check: connect to this host:port")
+	fs.Var((*stringSlice)(&health.Exec), "health-exec", "health check: run this command, exit 0 = healthy (repeatable: command, then each argument)")
+	fs.IntVar(&health.IntervalSec, "health-interval", 0, "seconds between health checks (default 10)")
+	fs.IntVar(&health.TimeoutSec, "health-timeout", 0, "seconds before a health check fails (default 3)")
+	fs.IntVar(&health.FailureThreshold, "health-threshold", 0, "failed checks in a row before the service is unhealthy (default 3)")
+	fs.IntVar(&health.StartPeriodSec, "health-start-period", 0, "seconds after start during which failed checks don't count (default 30)")
+	var dependsOn stringSlice
+	fs.Var(&dependsOn, "depends-on", "service ID this one needs, as id or id:started|healthy|registered (repeatable)")
+	stopSignal := fs.String("stop-signal", "", "signal that asks the service to stop: TERM, INT, QUIT, HUP, USR1 or USR2 (default TERM)")
+	stopTimeout := fs.Int("stop-timeout", 0, "seconds the service has to exit after the stop signal before SIGKILL (default 1)")
+	var preStop PreStopHook
+	fs.StringVar(&preStop.HTTP, "pre-stop-http", "", "before stopping, call this path (on the service's socket or URL) or http(s) URL")
+	fs.StringVar(&preStop.Method, "pre-stop-method", "", "HTTP method for --pre-stop-http (default POST)")
+	fs.StringVar(&preStop.Action, "pre-stop-action", "", "before stopping, call this action from the service's manifest")
+	fs.IntVar(&preStop.TimeoutSec, "pre-stop-timeout", 0, "seconds to wait for the pre-stop call (default 5)")
+	kind := fs.String("kind", "", "service (kept running, the default) or job (run to completion on a schedule or on demand)")
+	var job JobSpec
+	fs.StringVar(&job.Schedule, "schedule", "", "job: cron schedule, e.g. \"0 3 * * *\" or @hourly (implies --kind job)")
+	fs.IntVar(&job.IntervalSec, "every", 0, "job: run every N seconds (implies --kind job)")
+	fs.IntVar(&job.TimeoutSec, "job-timeout", 0, "job: seconds a run may take before it is stopped (default no limit)")
+	fs.StringVar(&job.Overlap, "overlap", "", "job: when a run is due during the previous one: skip, queue or kill (default skip)")
+	var envFiles, envProfiles stringSlice
+	fs.Var(&envFiles, "env-file", "dotenv file to load, relative to --workdir (repeatable; later files and --env override earlier)")
+	fs.Var(&envProfiles, "env-profile", "env profile to apply, see `relay service profile` (repeatable; later ones override earlier)")
+	var sockets stringSlice
+	fs.Var(&sockets, "socket", "listener relay binds and passes to the service (LISTEN_FDS), as [name=]unix:/path or [name=]tcp:host:port (repeatable)")
+	onDemand := fs.Bool("on-demand", false, "with --socket: start the service on its first connection instead of right away")
+	replicas := fs.Int("replicas", 0, fmt.Sprintf("run this many processes, balanced by the front door (1-%d; default 1)", maxReplicas))
 	noFrontendCreds := fs.Bool("no-frontend-creds", false, "do not inject relay front-door creds (RELAY_FRONTEND_SOCKET/TOKEN); set for backends that never dial the front door, so the bearer can't leak into spawned shells")
 	fs.Parse(args)
 
@@ -44,6 +91,41 @@ func serviceRegister(store SettingsStore, args []string) {
 
 	id, env := opts.resolveIDAndEnv()
 
+	var restartPolicy *RestartPolicy
+	if *restart != "" {
+		restartPolicy = &RestartPolicy{Policy: *restart, MaxRetries: *maxRetries, BackoffSec: *restartBackoff}
+		for _, c := range successCodes {
+			code, err := strconv.Atoi(c)
+			if err != nil {
+				exitError("invalid --success-exit-code %q", c)
+			}
+			restartPolicy.SuccessExitCodes = append(restartPolicy.SuccessExitCodes, code)
+		}
+		if err := restartPolicy.validate(); err != nil {
+			exitError("%v", err)
+		}
+	} else if *maxRetries != 0 || *restartBackoff != 0 || len(successCodes) > 0 {
+		exitError("--max-retries, --restart-backoff and --success-exit-code require --restart")
+	}
+	healthCheck := healthFromFlags(health)
+	preStopHook := preStopFromFlags(preStop)
+	if _, err := parseStopSignal(*stopSignal); err != nil {
+		exitError("%v", err)
+	}
+	if *stopTimeout < 0 {
+		exitError("--stop-timeout must not be negative")
+	}
+	jobSpec := jobFromFlags(kind, job)
+	socketSpec := socketsFromFlags(sockets, *onDemand)
+	var deps []ServiceDependency
+	for _, v := range dependsOn {
+		d, err := parseServiceDependency(v)
+		if err != nil {
+			exitError("invalid --depends-on %q: %v", v, err)
+		}
+		deps = append(deps, d)
+	}
+
 	resolvedWorkdir := *workdir
 	if resolvedWorkdir != "" {
 		abs, err := filepath.Abs(resolvedWorkdir)
@@ -63,6 +145,36 @@ func serviceRegister(store SettingsStore, args []string) {
 		Autostart:        *autostart,
 		URL:              *url,
 		FrontendConsumer: frontendConsumer,
+		Limits:           limitsFromFlags(limits),
+		Restart:          restartPolicy,
+		Health:           healthCheck,
+		DependsOn:        deps,
+		StopSignal:       *stopSignal,
+		StopTimeoutSec:   *stopTimeout,
+		PreStop:          preStopHook,
+		Kind:             *kind,
+		Job:              jobSpec,
+		Sockets:          socketSpec,
+		EnvFiles:         []string(envFiles),
+		EnvProfiles:      []string(envProfiles),
+		Replicas:         *replicas,
+	}
+
+	// Check the dependency graph as it will be saved, before saving it.
+	merged := config
+	current := store.Get()
+	current.MergeServiceDefaults(&merged)
+	if err := current.checkServiceDependencies(merged); err != nil {
+		exitError("%v", err)
+	}
+	if err := merged.validateEnvSources(); err != nil {
+		exitError("%v", err)
+	}
+	if err := merged.validateReplicas(); err != nil {
+		exitError("%v", err)
+	}
+	if err := current.checkEnvProfiles(merged); err != nil {
+		exitError("%v", err)
 	}
 
 	_, secret := upsertAndPrint(store, "service", opts.Name, id, func(s *Settings) bool {
@@ -73,6 +185,81 @@ func serviceRegister(store SettingsStore, args []string) {
 	warnNotifyFailure(bridge.SendReloadService(id, secret))
 }
 
+// healthFromFlags returns the health check given by the --health-* flags, or
+// nil when no probe was given. Exits on an invalid check, or on timing flags
+// without a probe.
+func healthFromFlags(h HealthCheck) *HealthCheck {
+	if h.HTTP == "" && h.TCP == "" && len(h.Exec) == 0 {
+		if h.IntervalSec != 0 || h.TimeoutSec != 0 || h.FailureThreshold != 0 || h.StartPeriodSec != 0 {
+			exitError("--health-interval, --health-timeout, --health-threshold and --health-start-period require --health-http, --health-tcp or --health-exec")
+		}
+		return nil
+	}
+	if err := h.validate(); err != nil {
+		exitError("%v", err)
+	}
+	return &h
+}
+
+// preStopFromFlags returns the hook given by the --pre-stop-* flags, or nil
+// when none was given. Exits on an invalid hook, or on options without one.
+func preStopFromFlags(h PreStopHook) *PreStopHook {
+	if h.HTTP == "" && h.Action == "" {
+		if h.Method != "" || h.TimeoutSec != 0 {
+			exitError("--pre-stop-method and --pre-stop-timeout require --pre-stop-http or --pre-stop-action")
+		}
+		return nil
+	}
+	if err := h.validate(); err != nil {
+		exitError("%v", err)
+	}
+	return &h
+}
+
+// jobFromFlags returns the job given by --schedule, --every, --job-timeout and
+// --overlap, or nil when none was given, setting kind to "job" if the flags
+// imply it. Exits on an invalid job, or on job flags with --kind service.
+func jobFromFlags(kind *string, j JobSpec) *JobSpec {
+	if j == (JobSpec{}) {
+		return nil
+	}
+	switch *kind {
+	case "":
+		*kind = KindJob
+	case KindJob:
+	default:
+		exitError("--schedule, --every, --job-timeout and --overlap need --kind job")
+	}
+	if err := j.validate(); err != nil {
+		exitError("%v", err)
+	}
+	return &j
+}
+
+// socketsFromFlags returns the listeners given by --socket and --on-demand,
+// or nil when none was given. Exits on an invalid listener, or on
+// --on-demand without one.
+func socketsFromFlags(sockets []string, onDemand bool) *SocketActivation {
+	if len(sockets) == 0 {
+		if onDemand {
+			exitError("--on-demand requires --socket")
+		}
+		return nil
+	}
+	a := &SocketActivation{OnDemand: onDemand}
+	for _, v := range sockets {
+		l, err := parseSocketListener(v)
+		if err != nil {
+			exitError("invalid --socket %q: %v", v, err)
+		}
+		a.Listeners = append(a.Listeners, l)
+	}
+	if err := a.validate(); err != nil {
+		exitError("%v", err)
+	}
+	return a
+}
+
 func serviceUnregister(store SettingsStore, args []string) {
 	fs := flag.NewFlagSet("service unregister", flag.ExitOnError)
 	id := fs.String("id", "", "service ID")
@@ -111,7 +298,158 @@ func serviceRestart(store SettingsStore, args []string) {
 	warnNotifyFailure(bridge.SendReloadService(resolvedID, s.AdminSecret))
 }
 
-func serviceList(store SettingsStore) {
+// serviceRun asks the tray to run a job now, whatever its schedule. Unlike
+// restart this needs the tray: running the job is all it does.
+func serviceRun(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("service run", flag.ExitOnError)
+	id := fs.String("id", "", "job ID")
+	name := fs.String("name", "", "job display name")
+	fs.Parse(args)
+
+	if *id == "" && *name == "" {
+		exitError("--id or --name is required")
+	}
+	s := store.Get()
+	resolvedID := s.ResolveServiceID(*id, *name)
+	svc, _ := s.findServiceByID(resolvedID)
+	if svc == nil {
+		if *id != "" {
+			exitError("no service found with id %q", *id)
+		}
+		exitError("no service found with name %q", *name)
+	}
+	if !svc.isJob() {
+		exitError("service %q is not a job; use `relay service restart`", resolvedID)
+	}
+	if err := bridge.SendRunJob(resolvedID, s.AdminSecret); err != nil {
+		exitError("run job %q: %v", resolvedID, err)
+	}
+	fmt.Printf("running job %q\n", resolvedID)
+}
+
+// serviceStatus implements `relay service status`: one service's runtime
+// state plus its recent CPU and memory, from the tray's sample history.
+// Runtime-only like the STATUS column, so it needs the tray.
+func serviceStatus(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("service status", flag.ExitOnError)
+	id := fs.String("id", "", "service ID")
+	name := fs.String("name", "", "service display name")
+	samples := fs.Int("samples", 10, "show the last N samples (0 = all kept)")
+	asJSON := fs.Bool("json", false, "print the status and full sample history as JSON")
+	fs.Parse(args)
+
+	if *id == "" && *name == "" {
+		exitError("--id or --name is required")
+	}
+	s := store.Get()
+	resolvedID := s.ResolveServiceID(*id, *name)
+	if resolvedID == "" {
+		if *id != "" {
+			exitError("no service found with id %q", *id)
+		}
+		exitError("no service found with name %q", *name)
+	}
+
+	client := bridge.NewClient(s.AdminSecret)
+	statuses, err := client.ServiceStatus()
+	if err != nil {
+		exitError("service status: %v", err)
+	}
+	var st bridge.ServiceStatus
+	for _, cur := range statuses {
+		if cur.ID == resolvedID {
+			st = cur
+		}
+	}
+	metrics := bridge.ResourceMetrics{Kind: metricsKindService, ID: resolvedID, Samples: []bridge.ResourceSample{}}
+	list, err := client.ResourceMetrics(bridge.ResourceMetricsRequest{Kind: metricsKindService, ID: resolvedID})
+	if err != nil {
+		exitError("resource metrics: %v", err)
+	}
+	if len(list) > 0 {
+		metrics = list[0]
+	}
+
+	st.ID = resolvedID
+	if *asJSON {
+		out := struct {
+			Status  bridge.ServiceStatus   `json:"status"`
+			Metrics bridge.ResourceMetrics `json:"metrics"`
+		}{st, metrics}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(out)
+		return
+	}
+	printServiceStatus(os.Stdout, resolvedID, st, metrics, *samples, time.Now())
+}
+
+// printServiceStatus renders `service status`: a summary of the service and
+// its usage over the kept window, then its last n samples (all when n is 0).
+func printServiceStatus(out io.Writer, id string, st bridge.ServiceStatus, m bridge.ResourceMetrics, n int, now time.Time) {
+	w := newTabWriterTo(out)
+	fmt.Fprintf(w, "service:\t%s\n", id)
+	fmt.Fprintf(w, "status:\t%s\n", formatServiceStatus(st, now))
+	if st.PID != 0 {
+		fmt.Fprintf(w, "pid:\t%d\n", st.PID)
+	}
+	if st.RestartPolicy != "" {
+		fmt.Fprintf(w, "restarts:\t%d (%s)\n", st.Restarts, st.RestartPolicy)
+	}
+	if len(m.Samples) == 0 {
+		w.Flush()
+		fmt.Fprintln(out, "no resource samples yet")
+		return
+	}
+	var cpuSum, cpuPeak float64
+	var rssSum, rssPeak uint64
+	for _, s := range m.Samples {
+		cpuSum += s.CPUPercent
+		cpuPeak = max(cpuPeak, s.CPUPercent)
+		rssSum += s.RSSBytes
+		rssPeak = max(rssPeak, s.RSSBytes)
+	}
+	last := m.Samples[len(m.Samples)-1]
+	count := len(m.Samples)
+	span := last.At.Sub(m.Samples[0].At).Round(time.Second)
+	label := "now"
+	if !m.Running {
+		label = "at exit"
+	}
+	fmt.Fprintf(w, "cpu:\t%.1f%% %s, %.1f%% avg, %.1f%% peak\n", last.CPUPercent, label, cpuSum/float64(count), cpuPeak)
+	fmt.Fprintf(w, "memory:\t%s %s, %s avg, %s peak\n", formatMetricBytes(last.RSSBytes), label,
+		formatMetricBytes(rssSum/uint64(count)), formatMetricBytes(rssPeak))
+	fmt.Fprintf(w, "processes:\t%d\n", last.Procs)
+	fmt.Fprintf(w, "window:\t%d samples over %s\n", count, span)
+	w.Flush()
+
+	shown := m.Samples
+	if n > 0 && len(shown) > n {
+		shown = shown[len(shown)-n:]
+	}
+	fmt.Fprintln(out)
+	w = newTabWriterTo(out)
+	fmt.Fprintln(w, "TIME\tCPU\tMEMORY\tPROCS")
+	for _, s := range shown {
+		fmt.Fprintf(w, "%s\t%.1f%%\t%s\t%d\n", s.At.Local().Format("15:04:05"), s.CPUPercent, formatMetricBytes(s.RSSBytes), s.Procs)
+	}
+	w.Flush()
+}
+
+// formatMetricBytes is formatBytes with an explicit zero, for columns where
+// a blank would read as missing data.
+func formatMetricBytes(b uint64) string {
+	if b == 0 {
+		return "0"
+	}
+	return formatBytes(b)
+}
+
+func serviceList(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("service list", flag.ExitOnError)
+	history := fs.Bool("history", false, "also print each service's recent automatic restarts and each job's recent runs")
+	fs.Parse(args)
+
 	s := store.Get()
 
 	if len(s.Services) == 0 {
@@ -119,13 +457,30 @@ func serviceList(store SettingsStore) {
 		return
 	}
 
-	w := newTabWriter()
-	fmt.Fprintln(w, "ID\tNAME\tCOMMAND\tURL\tAUTOSTART")
-	for _, svc := range s.Services {
-		cmd := svc.Command
-		if len(svc.Args) > 0 {
-			cmd += " " + strings.Join(svc.Args, " ")
+	// Running state and last exit are runtime-only, so ask the tray.
+	// Without a running tray the STATUS column shows "-".
+	statuses := map[string]bridge.ServiceStatus{}
+	if list, err := bridge.NewClient(s.AdminSecret).ServiceStatus(); err == nil {
+		for _, st := range list {
+			statuses[st.ID] = st
 		}
+	}
+	printServiceList(os.Stdout, s.Services, statuses, time.Now())
+
+	if *history {
+		printRestartHistory(s.Services, statuses)
+		printJobHistory(s.Services, statuses)
+	}
+}
+
+// printServiceList renders `service list`: one short row per service. The
+// rest of a service's settings — command, dependencies, schedule, sockets,
+// health check, restart and stop policy, limits, env — are `service show`'s,
+// and its restart count `service status`'s, so the table fits a terminal.
+func printServiceList(out io.Writer, services []ServiceConfig, statuses map[string]bridge.ServiceStatus, now time.Time) {
+	w := newTabWriterTo(out)
+	fmt.Fprintln(w, "ID\tNAME\tSTATUS\tAUTOSTART\tURL")
+	for _, svc := range services {
 		auto := "no"
 		if svc.Autostart {
 			auto = "yes"
@@ -134,7 +489,223 @@ func serviceList(store SettingsStore) {
 		if urlStr == "" {
 			urlStr = "-"
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", svc.ID, svc.DisplayName, cmd, urlStr, auto)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", svc.ID, svc.DisplayName, formatServiceStatus(statuses[svc.ID], now), auto, urlStr)
 	}
 	w.Flush()
 }
+
+// formatServiceStatus renders one service's STATUS cell: "running" (with
+// its readiness when it has a health check, and how many of its replicas
+// run when it has them), an on-demand service waiting for a connection, a
+// job's next scheduled run, a pending restart or crash loop, how its last
+// run ended, or "-" when it hasn't run (or the tray is unreachable). A
+// tripped circuit breaker is noted after the rest.
+func formatServiceStatus(st bridge.ServiceStatus, now time.Time) string {
+	s := formatServiceState(st, now)
+	if st.Circuit != "" {
+		s += ", circuit " + strings.ReplaceAll(st.Circuit, "_", "-")
+	}
+	return s
+}
+
+// formatServiceState is formatServiceStatus without the circuit.
+func formatServiceState(st bridge.ServiceStatus, now time.Time) string {
+	switch {
+	case st.Running && len(st.Replicas) > 0:
+		return "running (" + formatReplicas(st.Replicas) + ")"
+	case st.Running && st.Health != "":
+		return "running (" + st.Health + ")"
+	case st.Running:
+		return "running"
+	case st.AwaitingConnection:
+		return "waiting for connection"
+	case st.NextRun != nil:
+		in := max(st.NextRun.Sub(now).Round(time.Second), 0)
+		if st.LastExit == "" {
+			return fmt.Sprintf("next run in %s", in)
+		}
+		return fmt.Sprintf("next run in %s (last %s)", in, st.LastExit)
+	case st.NextRestart != nil:
+		in := max(st.NextRestart.Sub(now).Round(time.Second), 0)
+		return fmt.Sprintf("restarting in %s (%s)", in, st.LastExit)
+	case st.CrashLoop:
+		return "crash loop (" + st.LastExit + ")"
+	case st.LastExit != "":
+		return st.LastExit
+	default:
+		return "-"
+	}
+}
+
+// formatReplicas summarises a replicated service's replicas for its STATUS
+// cell: how many run, and how many of those are ready, draining or behind
+// a tripped circuit breaker when any are.
+func formatReplicas(replicas []bridge.ServiceReplica) string {
+	var running, ready, draining, tripped int
+	for _, r := range replicas {
+		if !r.Running {
+			continue
+		}
+		running++
+		if r.Health == string(HealthReady) {
+			ready++
+		}
+		if r.Draining {
+			draining++
+		}
+		if r.Circuit != "" {
+			tripped++
+		}
+	}
+	s := fmt.Sprintf("%d/%d replicas", running, len(replicas))
+	if ready > 0 {
+		s += fmt.Sprintf(", %d ready", ready)
+	}
+	if draining > 0 {
+		s += fmt.Sprintf(", %d draining", draining)
+	}
+	if tripped > 0 {
+		s += fmt.Sprintf(", %d circuit open", tripped)
+	}
+	return s
+}
+
+// printRestartHistory lists each service's recent automatic restarts below
+// the table, for `service list --history`.
+func printRestartHistory(services []ServiceConfig, statuses map[string]bridge.ServiceStatus) {
+	for _, svc := range services {
+		hist := statuses[svc.ID].RestartHistory
+		if len(hist) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s restarts:\n", svc.ID)
+		w := newTabWriter()
+		for _, h := range hist {
+			fmt.Fprintf(w, "  %s\t#%d\t%s\tafter %s\n", h.At.Local().Format("2006-01-02 15:04:05"),
+				h.Attempt, h.Exit, time.Duration(h.DelayMs)*time.Millisecond)
+		}
+		w.Flush()
+	}
+}
+
+// printJobHistory lists each job's recent runs below the table, for
+// `service list --history`.
+func printJobHistory(services []ServiceConfig, statuses map[string]bridge.ServiceStatus) {
+	for _, svc := range services {
+		runs := statuses[svc.ID].JobRuns
+		if len(runs) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s runs:\n", svc.ID)
+		w := newTabWriter()
+		for _, run := range runs {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", run.Start.Local().Format("2006-01-02 15:04:05"),
+				run.Trigger, time.Duration(run.DurationMs)*time.Millisecond, run.Status)
+		}
+		w.Flush()
+	}
+}
+
+// serviceLogFollowInterval is how often `service logs -f` checks for new
+// output.
+const serviceLogFollowInterval = 500 * time.Millisecond
+
+// serviceLogs implements `relay service logs`: a service's output across
+// its rotated log files, filtered, optionally followed. Like `relay audit`
+// it reads the files directly, so it works whether or not the tray runs.
+func serviceLogs(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("service logs", flag.ExitOnError)
+	id := fs.String("id", "", "service ID")
+	name := fs.String("name", "", "service display name")
+	var follow bool
+	fs.BoolVar(&follow, "f", false, "keep printing new output (like tail -f)")
+	fs.BoolVar(&follow, "follow", false, "same as -f")
+	since := fs.String("since", "", "only lines from the last duration (10m, 2h) or after a time (RFC 3339)")
+	grep := fs.String("grep", "", "only lines containing this text (case-insensitive)")
+	tail := fs.Int("tail", 200, "show the last N matching lines (0 = all)")
+	asJSON := fs.Bool("json", false, "emit one JSON object per line instead of text")
+	pathOnly := fs.Bool("path", false, "print the log file path and exit")
+	replica := fs.Int("replica", 0, "for a service with replicas, which replica's log")
+	fs.Parse(args)
+
+	if *id == "" && *name == "" {
+		exitError("--id or --name is required")
+	}
+	resolvedID := store.Get().ResolveServiceID(*id, *name)
+	if resolvedID == "" {
+		if *id != "" {
+			exitError("no service found with id %q", *id)
+		}
+		exitError("no service found with name %q", *name)
+	}
+	if svc, _ := store.Get().findServiceByID(resolvedID); *replica < 0 || *replica >= svc.replicaCount() {
+		exitError("--replica must be between 0 and %d", svc.replicaCount()-1)
+	}
+	path, err := serviceLogPath(instanceID(resolvedID, *replica))
+	if err != nil {
+		exitError("cannot resolve log path: %v", err)
+	}
+	if *pathOnly {
+		fmt.Println(path)
+		return
+	}
+
+	q := serviceLogQuery{Grep: *grep, Tail: *tail}
+	if *since != "" {
+		if q.Since, err = parseLogSince(*since, time.Now()); err != nil {
+			exitError("%v", err)
+		}
+	}
+	lines, cursor, err := readServiceLog(path, q)
+	if err != nil {
+		exitError("read %s: %v", path, err)
+	}
+	if len(lines) == 0 && !follow && !*asJSON {
+		fmt.Printf("no matching output in %s\n", path)
+		return
+	}
+	printServiceLogLines(os.Stdout, lines, *asJSON)
+
+	for follow {
+		time.Sleep(serviceLogFollowInterval)
+		lines, cursor, err = readServiceLogFrom(path, cursor, q)
+		if err != nil {
+			exitError("read %s: %v", path, err)
+		}
+		printServiceLogLines(os.Stdout, lines, *asJSON)
+	}
+}
+
+// parseLogSince turns a --since value into a cutoff: a duration back from
+// now, or an absolute RFC 3339 time.
+func parseLogSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("--since %q must not be negative", s)
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("--since %q is neither a duration (10m) nor an RFC 3339 time", s)
+}
+
+// printServiceLogLines writes lines as JSON objects, or as text with the
+// local time in front and JSON payloads pretty-printed.
+func printServiceLogLines(w io.Writer, lines []serviceLogLine, asJSON bool) {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		for _, l := range lines {
+			enc.Encode(l)
+		}
+		return
+	}
+	for _, l := range lines {
+		stamp := "-"
+		if !l.Time.IsZero() {
+			stamp = l.Time.Local().Format("2006-01-02 15:04:05.000")
+		}
+		fmt.Fprintf(w, "%s  %s\n", stamp, l.pretty())
+	}
+}
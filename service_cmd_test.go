@@ -7,7 +7,15 @@ package main
 // the persisted config back. The trailing SendReloadService notify fails
 // harmlessly (no tray running) via warnNotifyFailure.
 
-import "testing"
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"relaygo/bridge"
+)
 
 func newCLISandboxStore(t *testing.T) SettingsStore {
 	t.Helper()
@@ -68,3 +76,214 @@ func TestServiceRegister_DefaultLeavesFrontendCredsUnset(t *testing.T) {
 		t.Errorf("URL = %q, want http://127.0.0.1:9000", cfg.URL)
 	}
 }
+
+func TestServiceRegister_RestartPolicyAndLimits(t *testing.T) {
+	store := newCLISandboxStore(t)
+
+	serviceRegister(store, []string{
+		"--name", "Worker",
+		"--command", "/usr/bin/true",
+		"--restart", "on-failure",
+		"--max-retries", "3",
+		"--success-exit-code", "75",
+		"--memory-mb", "256",
+	})
+	cfg := store.Get().Services[0]
+	if cfg.Restart == nil || cfg.Restart.Policy != RestartOnFailure || cfg.Restart.MaxRetries != 3 ||
+		len(cfg.Restart.SuccessExitCodes) != 1 || cfg.Restart.SuccessExitCodes[0] != 75 {
+		t.Fatalf("Restart = %+v", cfg.Restart)
+	}
+	if cfg.Limits == nil || cfg.Limits.MemoryMB != 256 {
+		t.Fatalf("Limits = %+v", cfg.Limits)
+	}
+}
+
+func TestServiceRegister_HealthCheck(t *testing.T) {
+	store := newCLISandboxStore(t)
+
+	serviceRegister(store, []string{
+		"--name", "Web",
+		"--command", "/usr/bin/true",
+		"--health-exec", "/usr/bin/test", "--health-exec", "-e", "--health-exec", "/tmp/ready",
+		"--health-threshold", "5",
+	})
+	cfg := store.Get().Services[0]
+	if cfg.Health == nil || len(cfg.Health.Exec) != 3 || cfg.Health.Exec[2] != "/tmp/ready" || cfg.Health.FailureThreshold != 5 {
+		t.Fatalf("Health = %+v", cfg.Health)
+	}
+}
+
+func TestServiceRegister_DependsOn(t *testing.T) {
+	store := newCLISandboxStore(t)
+
+	serviceRegister(store, []string{"--name", "LLM", "--command", "/usr/bin/true", "--health-http", "/healthz"})
+	llm := store.Get().Services[0].ID
+	serviceRegister(store, []string{
+		"--name", "Scheduler",
+		"--command", "/usr/bin/true",
+		"--depends-on", llm + ":registered",
+		"--depends-on", llm + ":healthy",
+	})
+	cfg := store.Get().Services[1]
+	want := []ServiceDependency{{Service: llm, Condition: DependsRegistered}, {Service: llm, Condition: DependsHealthy}}
+	if !reflect.DeepEqual(cfg.DependsOn, want) {
+		t.Fatalf("DependsOn = %+v, want %+v", cfg.DependsOn, want)
+	}
+}
+
+func TestServiceRegister_StopSettings(t *testing.T) {
+	store := newCLISandboxStore(t)
+
+	serviceRegister(store, []string{
+		"--name", "Queue",
+		"--command", "/usr/bin/true",
+		"--stop-signal", "INT",
+		"--stop-timeout", "30",
+		"--pre-stop-http", "/drain",
+		"--pre-stop-timeout", "10",
+	})
+	cfg := store.Get().Services[0]
+	if cfg.StopSignal != "INT" || cfg.StopTimeoutSec != 30 || cfg.PreStop == nil || *cfg.PreStop != (PreStopHook{HTTP: "/drain", TimeoutSec: 10}) {
+		t.Fatalf("stop settings = %q %d %+v", cfg.StopSignal, cfg.StopTimeoutSec, cfg.PreStop)
+	}
+}
+
+func TestServiceRegister_Job(t *testing.T) {
+	store := newCLISandboxStore(t)
+
+	// --schedule implies --kind job.
+	serviceRegister(store, []string{
+		"--name", "Backup",
+		"--command", "/usr/bin/true",
+		"--schedule", "0 3 * * *",
+		"--job-timeout", "3600",
+		"--overlap", "kill",
+	})
+	cfg := store.Get().Services[0]
+	if cfg.Kind != KindJob || cfg.Job == nil || *cfg.Job != (JobSpec{Schedule: "0 3 * * *", TimeoutSec: 3600, Overlap: OverlapKill}) {
+		t.Fatalf("job = %q %+v", cfg.Kind, cfg.Job)
+	}
+
+	// A one-shot job has a kind and no schedule.
+	serviceRegister(store, []string{"--name", "Migrate", "--command", "/usr/bin/true", "--kind", "job"})
+	if cfg = store.Get().Services[1]; cfg.Kind != KindJob || cfg.Job != nil {
+		t.Fatalf("one-shot job = %q %+v", cfg.Kind, cfg.Job)
+	}
+}
+
+func TestServiceRegister_Sockets(t *testing.T) {
+	store := newCLISandboxStore(t)
+
+	serviceRegister(store, []string{
+		"--name", "API",
+		"--command", "/usr/bin/true",
+		"--socket", "http=tcp:127.0.0.1:8080",
+		"--socket", "/tmp/api.sock",
+		"--on-demand",
+	})
+	cfg := store.Get().Services[0]
+	want := &SocketActivation{
+		Listeners: []SocketListener{{Name: "http", Address: "tcp:127.0.0.1:8080"}, {Address: "/tmp/api.sock"}},
+		OnDemand:  true,
+	}
+	if !reflect.DeepEqual(cfg.Sockets, want) {
+		t.Fatalf("sockets = %+v, want %+v", cfg.Sockets, want)
+	}
+}
+
+func TestFormatServiceStatus(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	next := now.Add(4 * time.Second)
+	cases := []struct {
+		st   bridge.ServiceStatus
+		want string
+	}{
+		{bridge.ServiceStatus{}, "-"},
+		{bridge.ServiceStatus{Running: true, LastExit: "exited: status 1"}, "running"},
+		{bridge.ServiceStatus{Running: true, Health: "starting"}, "running (starting)"},
+		{bridge.ServiceStatus{LastExit: "exited: status 1", NextRestart: &next}, "restarting in 4s (exited: status 1)"},
+		{bridge.ServiceStatus{LastExit: "killed: memory limit exceeded", CrashLoop: true}, "crash loop (killed: memory limit exceeded)"},
+		{bridge.ServiceStatus{LastExit: "exited: status 0"}, "exited: status 0"},
+		{bridge.ServiceStatus{Kind: KindJob, Scheduled: true, NextRun: &next}, "next run in 4s"},
+		{bridge.ServiceStatus{Kind: KindJob, Scheduled: true, NextRun: &next, LastExit: "exited: status 2"}, "next run in 4s (last exited: status 2)"},
+		{bridge.ServiceStatus{Kind: KindJob, Running: true, NextRun: &next}, "running"},
+		{bridge.ServiceStatus{AwaitingConnection: true, Listening: []string{"tcp:127.0.0.1:8080"}, LastExit: "exited: status 0"}, "waiting for connection"},
+		{bridge.ServiceStatus{Running: true, Circuit: "open"}, "running, circuit open"},
+		{bridge.ServiceStatus{Running: true, Health: "ready", Circuit: "half_open"}, "running (ready), circuit half-open"},
+	}
+	for _, c := range cases {
+		if got := formatServiceStatus(c.st, now); got != c.want {
+			t.Errorf("%+v: got %q, want %q", c.st, got, c.want)
+		}
+	}
+}
+
+// `service list` is a summary a terminal can hold; the rest of a service's
+// settings are `service show`'s.
+func TestPrintServiceList(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	services := []ServiceConfig{
+		{ID: "web", DisplayName: "Web", Command: "./web", URL: "http://localhost:3000", Autostart: true,
+			Restart: &RestartPolicy{Policy: RestartAlways}, Env: map[string]string{"A": "1"}},
+		{ID: "backup", DisplayName: "Backup", Command: "./backup.sh"},
+	}
+	statuses := map[string]bridge.ServiceStatus{"web": {ID: "web", Running: true}}
+
+	var buf bytes.Buffer
+	printServiceList(&buf, services, statuses, now)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || strings.Join(strings.Fields(lines[0]), " ") != "ID NAME STATUS AUTOSTART URL" {
+		t.Fatalf("list:\n%s", buf.String())
+	}
+	if got := strings.Join(strings.Fields(lines[1]), " "); got != "web Web running yes http://localhost:3000" {
+		t.Errorf("web row = %q", got)
+	}
+	if got := strings.Join(strings.Fields(lines[2]), " "); got != "backup Backup - no -" {
+		t.Errorf("backup row = %q", got)
+	}
+}
+
+func TestPrintServiceStatus(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	st := bridge.ServiceStatus{ID: "web", Running: true, PID: 4242, RestartPolicy: RestartAlways, Restarts: 2}
+	m := bridge.ResourceMetrics{Kind: metricsKindService, ID: "web", PID: 4242, Running: true}
+	for i, cpu := range []float64{10, 30, 20} {
+		m.Samples = append(m.Samples, bridge.ResourceSample{
+			At: now.Add(time.Duration(i-2) * 2 * time.Second), CPUPercent: cpu, RSSBytes: uint64(i+1) * 10 << 20, Procs: 3,
+		})
+	}
+
+	var buf bytes.Buffer
+	printServiceStatus(&buf, "web", st, m, 2, now)
+	out := buf.String()
+	for _, want := range []string{
+		"status:     running",
+		"pid:        4242",
+		"restarts:   2 (always)",
+		"cpu:        20.0% now, 20.0% avg, 30.0% peak",
+		"memory:     30 MB now, 20 MB avg, 30 MB peak",
+		"processes:  3",
+		"window:     3 samples over 4s",
+		"TIME",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if rows := strings.Count(out, "%  "); rows != 2 {
+		t.Errorf("want the last 2 samples listed, got %d rows:\n%s", rows, out)
+	}
+
+	buf.Reset()
+	m.Running = false
+	printServiceStatus(&buf, "web", bridge.ServiceStatus{LastExit: "exited: status 1"}, m, 0, now)
+	if out := buf.String(); !strings.Contains(out, "at exit") || !strings.Contains(out, "exited: status 1") || strings.Contains(out, "pid:") {
+		t.Errorf("stopped service output:\n%s", out)
+	}
+
+	buf.Reset()
+	printServiceStatus(&buf, "idle", bridge.ServiceStatus{}, bridge.ResourceMetrics{}, 10, now)
+	if out := buf.String(); !strings.Contains(out, "no resource samples yet") {
+		t.Errorf("no-sample output:\n%s", out)
+	}
+}
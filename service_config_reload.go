@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"relaygo/bridge"
+)
+
+// Live config apply with rollback.
+//
+// A service with applyMode "live" used to be left to notice a saved file by
+// itself, and relay had no way to learn whether it liked what it found. One
+// that declares config.reload is told instead: relay writes the file, POSTs
+// its hash to the reload path on every registered replica, and waits for
+// each to answer. A service that refuses the file (4xx) gets the previous
+// version back on disk, and any replica that had already taken the new one
+// is told to reload the old — so what's on disk is what the service runs.
+//
+// A reload that can't be confirmed (no answer, a 5xx) is not a refusal: the
+// service may well have applied the file. The save stands and the user is
+// told the reload wasn't confirmed, rather than relay rolling back a config
+// that might be live.
+
+// configReloadTimeout bounds each replica's reload call. A reload that
+// validates and swaps in a config should take well under a second; this
+// leaves room for one that reconnects to something on the way.
+const configReloadTimeout = 10 * time.Second
+
+// configHash names a version of a config file in reload calls.
+func configHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// applyLiveConfig tells a service's replicas about the config file
+// ipcServiceConfig just wrote (msg.Text, replacing previous) and reports the
+// outcome on the save: applied, refused and rolled back, or unconfirmed.
+// Runs off-main, on the save's goroutine.
+func applyLiveConfig(ipc *IPCContext, msg ipcServiceConfigMsg, decl *bridge.ConfigDecl, allowedRoot string, previous []byte) {
+	written := []byte(msg.Text)
+	replicas := ipc.Enhanced.Replicas(msg.ServiceID)
+	if len(replicas) == 0 {
+		// Not running: it reads the new file when it next starts.
+		emitConfigResult(ipc, msg, true, "", "")
+		dispatchEmit(ipc, "onServiceConfigApplied", map[string]interface{}{
+			"serviceId": msg.ServiceID, "mode": "saved",
+		})
+		return
+	}
+
+	acked, err := reloadLiveConfig(ipc.Ctx, replicas, decl.Reload, configHash(written))
+	var rejected *configRejectedError
+	switch {
+	case err == nil:
+		emitConfigResult(ipc, msg, true, "", "")
+		dispatchEmit(ipc, "onServiceConfigApplied", map[string]interface{}{
+			"serviceId": msg.ServiceID, "mode": "applied",
+		})
+
+	case errors.As(err, &rejected):
+		if rerr := rollbackConfigFile(decl, allowedRoot, written, previous); rerr != nil {
+			slog.Error("service config rollback failed", "service", msg.ServiceID, "error", rerr)
+			emitConfigResult(ipc, msg, false, "", fmt.Sprintf("%v; restoring the previous file failed: %v", err, rerr))
+			return
+		}
+		// Replicas that took the new file before another refused it go
+		// back to the version now on disk.
+		if len(acked) > 0 {
+			if _, rerr := reloadLiveConfig(ipc.Ctx, acked, decl.Reload, configHash(previous)); rerr != nil {
+				slog.Warn("service config rollback: replica did not reload the previous file",
+					"service", msg.ServiceID, "error", rerr)
+			}
+		}
+		emitConfigResult(ipc, msg, false, "", err.Error()+"; the previous version was restored")
+
+	default:
+		slog.Warn("service config reload not confirmed", "service", msg.ServiceID, "error", err)
+		emitConfigResult(ipc, msg, true, "", "")
+		dispatchEmit(ipc, "onServiceConfigApplied", map[string]interface{}{
+			"serviceId": msg.ServiceID, "mode": "error",
+			"error": fmt.Sprintf("config saved, but the service didn't confirm the reload: %v", err),
+		})
+	}
+	if ipc.PushServiceStatusBatch != nil {
+		ipc.PushServiceStatusBatch()
+	}
+}
+
+// reloadLiveConfig asks each replica to reload the config at hash,
+// returning those that applied it. It stops at the first refusal — the
+// file is about to be rolled back, so the rest shouldn't load it — and
+// otherwise carries on past a replica it can't reach, returning the first
+// such failure.
+func reloadLiveConfig(ctx context.Context, replicas []*EnhancedService, path, hash string) ([]*EnhancedService, error) {
+	var acked []*EnhancedService
+	var firstErr error
+	for _, rec := range replicas {
+		err := reloadReplicaConfig(ctx, rec, path, hash)
+		if err == nil {
+			acked = append(acked, rec)
+			continue
+		}
+		err = fmt.Errorf("%s: %w", rec.instance(), err)
+		var rejected *configRejectedError
+		if errors.As(err, &rejected) {
+			return acked, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return acked, firstErr
+}
+
+func reloadReplicaConfig(ctx context.Context, rec *EnhancedService, path, hash string) error {
+	client := NewServiceStatusClient(rec.InternalSocket, rec.InternalToken)
+	defer client.CloseIdleConnections()
+	client.http.Timeout = 0 // ctx carries configReloadTimeout
+	callCtx, cancel := context.WithTimeout(ctx, configReloadTimeout)
+	defer cancel()
+	return client.ReloadConfig(callCtx, path, hash)
+}
+
+// rollbackConfigFile puts previous back where written was saved — through
+// the same path gate as the save — unless the file has changed again since
+// (the service rewrote it, or another save landed), which a rollback must
+// not clobber.
+func rollbackConfigFile(decl *bridge.ConfigDecl, allowedRoot string, written, previous []byte) error {
+	realPath, info, err := resolveConfigPath(decl, allowedRoot)
+	if err != nil {
+		return err
+	}
+	current, err := readConfigFile(realPath, info)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, written) {
+		return errors.New("the file changed again after the save; left as it is")
+	}
+	return writeConfigFile(realPath, previous, info.Mode().Perm())
+}
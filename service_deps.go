@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Service dependencies and ordered startup/shutdown.
+//
+// A service lists the services it needs in `depends_on`, each with the
+// condition that counts as "up":
+//
+//	started     the dependency's process is running (the default)
+//	healthy     its health check passes (service_health.go); a dependency
+//	            without a check counts once started
+//	registered  it has registered its manifest with relay, so its routes
+//	            and internal socket exist
+//
+// StartAllAutostart starts services with no dependencies at once, as before,
+// and each dependent from its own goroutine once its dependencies meet their
+// conditions — it can't block, because manifest registration arrives over
+// the bridge, which only starts serving afterwards. Dependencies of an
+// autostart service are started even if they aren't autostart themselves.
+// StopAll runs the other way: dependents first, then what they depend on.
+//
+// Unknown services, self-dependencies and cycles are rejected when a service
+// is registered. A hand-edited settings file can still contain them; the
+// registry then logs the problem and starts everything unordered.
+
+// Dependency conditions (ServiceDependency.Condition).
+const (
+	DependsStarted    = "started"
+	DependsHealthy    = "healthy"
+	DependsRegistered = "registered"
+)
+
+// dependencyWaitTimeout bounds how long a dependent waits for its
+// dependencies before giving up on starting, and dependencyPollInterval is
+// how often it checks. Vars (not consts) so tests can shorten them.
+var (
+	dependencyWaitTimeout  = 2 * time.Minute
+	dependencyPollInterval = 200 * time.Millisecond
+)
+
+// ServiceDependency is one entry of a service's `depends_on`.
+type ServiceDependency struct {
+	// Service is the ID of the service depended on.
+	Service string `json:"service"`
+	// Condition is "started", "healthy" or "registered". Empty means
+	// "started".
+	Condition string `json:"condition,omitempty"`
+}
+
+func (d ServiceDependency) condition() string {
+	if d.Condition == "" {
+		return DependsStarted
+	}
+	return d.Condition
+}
+
+func (d ServiceDependency) validate(self string) error {
+	if d.Service == "" {
+		return fmt.Errorf("depends_on entry needs a service ID")
+	}
+	if d.Service == self {
+		return fmt.Errorf("service %q depends on itself", self)
+	}
+	switch d.condition() {
+	case DependsStarted, DependsHealthy, DependsRegistered:
+		return nil
+	}
+	return fmt.Errorf("dependency condition %q must be %s, %s or %s", d.Condition, DependsStarted, DependsHealthy, DependsRegistered)
+}
+
+// String renders the dependency as the CLI takes it: "id" or "id:condition".
+func (d ServiceDependency) String() string {
+	if d.condition() == DependsStarted {
+		return d.Service
+	}
+	return d.Service + ":" + d.Condition
+}
+
+// parseServiceDependency parses a `--depends-on` value, "id[:condition]".
+func parseServiceDependency(s string) (ServiceDependency, error) {
+	id, cond, _ := strings.Cut(s, ":")
+	d := ServiceDependency{Service: id, Condition: cond}
+	if d.Condition == DependsStarted {
+		d.Condition = ""
+	}
+	return d, d.validate("")
+}
+
+// formatDependencies renders a depends_on list for `service show`, or "-".
+func formatDependencies(deps []ServiceDependency) string {
+	if len(deps) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(deps))
+	for i, d := range deps {
+		parts[i] = d.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// serviceStartOrder returns configs sorted so every service comes after the
+// services it depends on, keeping the configured order otherwise. It fails
+// on a dependency that isn't in configs and on a cycle, naming the loop.
+func serviceStartOrder(configs []ServiceConfig) ([]ServiceConfig, error) {
+	index := make(map[string]int, len(configs))
+	for i, c := range configs {
+		index[c.ID] = i
+	}
+	for _, c := range configs {
+		for _, d := range c.DependsOn {
+			if _, ok := index[d.Service]; !ok {
+				return nil, fmt.Errorf("service %q depends on unknown service %q", c.ID, d.Service)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(configs))
+	order := make([]ServiceConfig, 0, len(configs))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			start := slices.Index(path, configs[i].ID)
+			loop := append(slices.Clone(path[start:]), configs[i].ID)
+			return fmt.Errorf("service dependency cycle: %s", strings.Join(loop, " -> "))
+		}
+		state[i] = visiting
+		path = append(path, configs[i].ID)
+		for _, d := range configs[i].DependsOn {
+			if err := visit(index[d.Service]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		order = append(order, configs[i])
+		return nil
+	}
+	for i := range configs {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// checkServiceDependencies validates the dependency graph as it would be
+// with cfg upserted: every dependency names a registered service that isn't
+// a job, "healthy" only targets a service with a health check, and there is
+// no cycle.
+func (s *Settings) checkServiceDependencies(cfg ServiceConfig) error {
+	configs := slices.Clone(s.Services)
+	if _, idx := s.findServiceByID(cfg.ID); idx >= 0 {
+		configs[idx] = cfg
+	} else {
+		configs = append(configs, cfg)
+	}
+	for _, d := range cfg.DependsOn {
+		if err := d.validate(cfg.ID); err != nil {
+			return err
+		}
+		if d.condition() != DependsHealthy {
+			continue
+		}
+		for _, c := range configs {
+			if c.ID == d.Service && c.Health == nil {
+				return fmt.Errorf("%q has no health check to wait for; use --depends-on %s", d.Service, d.Service)
+			}
+		}
+	}
+	// A job exits after each run, so it's never reliably "up".
+	for _, c := range configs {
+		for _, d := range c.DependsOn {
+			for _, dep := range configs {
+				if dep.ID == d.Service && dep.isJob() {
+					return fmt.Errorf("%q depends on %q, which is a job; services can only depend on services", c.ID, dep.ID)
+				}
+			}
+		}
+	}
+	_, err := serviceStartOrder(configs)
+	return err
+}
+
+// StartAllAutostart starts every autostart service, and what they depend on,
+// in dependency order.
+func (r *ServiceRegistry) StartAllAutostart(configs []ServiceConfig) {
+	order, err := serviceStartOrder(configs)
+	ordered := err == nil
+	if !ordered {
+		slog.Error("ignoring service dependencies", "error", err)
+		order = configs
+	}
+
+	byID := make(map[string]*ServiceConfig, len(order))
+	for i := range order {
+		byID[order[i].ID] = &order[i]
+	}
+	// Pull in dependencies: walking the order backwards sees every
+	// dependent before the services it needs.
+	want := make(map[string]bool)
+	for i := len(order) - 1; i >= 0; i-- {
+		cfg := &order[i]
+		if !cfg.Autostart && !want[cfg.ID] {
+			continue
+		}
+		want[cfg.ID] = true
+		if ordered {
+			for _, d := range cfg.DependsOn {
+				want[d.Service] = true
+			}
+		}
+	}
+
+	for i := range order {
+		cfg := &order[i]
+		if !want[cfg.ID] {
+			continue
+		}
+		if !ordered || len(cfg.DependsOn) == 0 {
+			if err := r.Start(cfg); err != nil {
+				slog.Error("service autostart failed", "error", err)
+			}
+			continue
+		}
+		go r.startAfterDependencies(cfg, byID, dependencyWaitTimeout, dependencyPollInterval)
+	}
+}
+
+// startAfterDependencies waits until each of cfg's dependencies meets its
+// condition, checking every poll, then starts cfg. Gives up (logged) after
+// timeout or when StopAll begins shutting the registry down.
+func (r *ServiceRegistry) startAfterDependencies(cfg *ServiceConfig, byID map[string]*ServiceConfig, timeout, poll time.Duration) {
+	deadline := time.After(timeout)
+	tick := time.NewTicker(poll)
+	defer tick.Stop()
+	for _, d := range cfg.DependsOn {
+		for !r.dependencyMet(d, byID[d.Service]) {
+			select {
+			case <-r.quit:
+				return
+			case <-deadline:
+				slog.Error("service dependency not ready; not starting",
+					"id", cfg.ID, "dependency", d.Service, "condition", d.condition(), "waited", timeout)
+				return
+			case <-tick.C:
+			}
+		}
+	}
+	select {
+	case <-r.quit:
+		return
+	default:
+	}
+	if err := r.Start(cfg); err != nil {
+		slog.Error("service autostart failed", "error", err)
+	}
+}
+
+// dependencyMet reports whether dependency d currently meets its condition.
+// dep is the dependency's config.
+func (r *ServiceRegistry) dependencyMet(d ServiceDependency, dep *ServiceConfig) bool {
+	if !r.IsRunning(d.Service) {
+		return false
+	}
+	switch d.condition() {
+	case DependsHealthy:
+		if dep == nil || dep.Health == nil {
+			return true
+		}
+		hs, ok := r.Health(d.Service)
+		return ok && hs.State == HealthReady
+	case DependsRegistered:
+		return r.Enhanced == nil || r.Enhanced.Get(d.Service) != nil
+	}
+	return true
+}
+
+// StopAll stops every running service: dependents before the services they
+// depend on, and each wave concurrently so one slow-to-stop service doesn't
+// hold up unrelated ones. It also cancels pending restarts, job schedules
+// and dependents still waiting to start.
+func (r *ServiceRegistry) StopAll() {
+	r.quitOnce.Do(func() { close(r.quit) })
+
+	r.mu.Lock()
+	for id := range r.restarts {
+		r.cancelRestartLocked(id)
+	}
+	for id := range r.jobs {
+		r.disarmJobLocked(id)
+	}
+	for id := range r.sockets {
+		r.closeSocketsLocked(id)
+	}
+	procs := make(map[string]*serviceProcess, len(r.processes))
+	deps := make(map[string][]ServiceDependency, len(r.processes))
+	for id, proc := range r.processes {
+		proc.stopping = true
+		procs[id] = proc
+		if st := r.restarts[id]; st != nil {
+			deps[id] = st.config.DependsOn
+		}
+	}
+	r.mu.Unlock()
+
+	for _, wave := range stopWaves(procs, deps) {
+		var wg sync.WaitGroup
+		for _, id := range wave {
+			wg.Add(1)
+			go func(id string, p *serviceProcess) {
+				defer wg.Done()
+				r.stopProcess(id, p)
+			}(id, procs[id])
+		}
+		wg.Wait()
+	}
+
+	// Clean up after all processes are dead.
+	r.mu.Lock()
+	for id, proc := range procs {
+		if r.processes[id] == proc {
+			delete(r.processes, id)
+		}
+	}
+	r.mu.Unlock()
+}
+
+// stopWaves groups the services in procs for StopAll: each wave holds the
+// services no remaining service depends on, a service's replicas together.
+// A cycle (possible only in a hand-edited settings file) ends up in one
+// final wave.
+func stopWaves(procs map[string]*serviceProcess, deps map[string][]ServiceDependency) [][]string {
+	remaining := make(map[string]bool, len(procs))
+	for id := range procs {
+		remaining[id] = true
+	}
+	var waves [][]string
+	for len(remaining) > 0 {
+		needed := make(map[string]bool)
+		for id := range remaining {
+			for _, d := range deps[id] {
+				needed[d.Service] = true
+			}
+		}
+		var wave []string
+		for id := range remaining {
+			if service, _ := splitInstanceID(id); !needed[service] {
+				wave = append(wave, id)
+			}
+		}
+		if len(wave) == 0 {
+			for id := range remaining {
+				wave = append(wave, id)
+			}
+		}
+		slices.Sort(wave)
+		for _, id := range wave {
+			delete(remaining, id)
+		}
+		waves = append(waves, wave)
+	}
+	return waves
+}
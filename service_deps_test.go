@@ -0,0 +1,210 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func depsOn(ids ...string) []ServiceDependency {
+	deps := make([]ServiceDependency, len(ids))
+	for i, id := range ids {
+		deps[i] = ServiceDependency{Service: id}
+	}
+	return deps
+}
+
+func configIDs(configs []ServiceConfig) []string {
+	ids := make([]string, len(configs))
+	for i, c := range configs {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+func TestServiceStartOrder(t *testing.T) {
+	configs := []ServiceConfig{
+		{ID: "eve", DependsOn: depsOn("llm", "scheduler")},
+		{ID: "scheduler", DependsOn: depsOn("llm")},
+		{ID: "kokoro"},
+		{ID: "llm"},
+	}
+	order, err := serviceStartOrder(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dependencies first; unrelated services keep their configured place.
+	if got, want := configIDs(order), []string{"llm", "scheduler", "eve", "kokoro"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+
+	configs[3].DependsOn = depsOn("eve")
+	_, err = serviceStartOrder(configs)
+	if err == nil || !strings.Contains(err.Error(), "eve -> llm -> eve") {
+		t.Fatalf("cycle error = %v", err)
+	}
+
+	_, err = serviceStartOrder([]ServiceConfig{{ID: "eve", DependsOn: depsOn("ghost")}})
+	if err == nil || !strings.Contains(err.Error(), `unknown service "ghost"`) {
+		t.Fatalf("unknown dependency error = %v", err)
+	}
+}
+
+func TestServiceDependency_ParseAndValidate(t *testing.T) {
+	cases := map[string]ServiceDependency{
+		"llm":            {Service: "llm"},
+		"llm:started":    {Service: "llm"},
+		"llm:healthy":    {Service: "llm", Condition: DependsHealthy},
+		"llm:registered": {Service: "llm", Condition: DependsRegistered},
+	}
+	for in, want := range cases {
+		got, err := parseServiceDependency(in)
+		if err != nil || got != want {
+			t.Errorf("%q: got %+v, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"", ":healthy", "llm:ready"} {
+		if _, err := parseServiceDependency(in); err == nil {
+			t.Errorf("%q parsed", in)
+		}
+	}
+
+	svc := &ServiceConfig{ID: "llm", DisplayName: "LLM", Command: "/bin/true", DependsOn: depsOn("llm")}
+	if err := svc.Validate(); err == nil {
+		t.Error("self-dependency validated")
+	}
+	if got := formatDependencies([]ServiceDependency{{Service: "llm", Condition: DependsRegistered}, {Service: "db"}}); got != "llm:registered,db" {
+		t.Errorf("formatDependencies = %q", got)
+	}
+}
+
+func TestSettings_CheckServiceDependencies(t *testing.T) {
+	s := &Settings{Services: []ServiceConfig{
+		{ID: "llm", Health: &HealthCheck{HTTP: "/healthz"}},
+		{ID: "db"},
+		{ID: "eve", DependsOn: depsOn("llm")},
+	}}
+	if err := s.checkServiceDependencies(ServiceConfig{ID: "scheduler", DependsOn: []ServiceDependency{{Service: "llm", Condition: DependsHealthy}}}); err != nil {
+		t.Fatalf("valid dependency: %v", err)
+	}
+	if err := s.checkServiceDependencies(ServiceConfig{ID: "scheduler", DependsOn: []ServiceDependency{{Service: "db", Condition: DependsHealthy}}}); err == nil {
+		t.Error("healthy condition on a service without a health check accepted")
+	}
+	if err := s.checkServiceDependencies(ServiceConfig{ID: "scheduler", DependsOn: depsOn("ghost")}); err == nil {
+		t.Error("unknown dependency accepted")
+	}
+	// Updating llm to depend on eve closes a loop through the existing entry.
+	if err := s.checkServiceDependencies(ServiceConfig{ID: "llm", DependsOn: depsOn("eve")}); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("cycle via update = %v", err)
+	}
+}
+
+func TestStopWaves(t *testing.T) {
+	procs := map[string]*serviceProcess{"llm": nil, "scheduler": nil, "eve": nil, "kokoro": nil}
+	deps := map[string][]ServiceDependency{
+		"eve":       depsOn("llm", "scheduler"),
+		"scheduler": depsOn("llm", "stopped-already"),
+	}
+	want := [][]string{{"eve", "kokoro"}, {"scheduler"}, {"llm"}}
+	if got := stopWaves(procs, deps); !reflect.DeepEqual(got, want) {
+		t.Fatalf("waves = %v, want %v", got, want)
+	}
+
+	// A cycle can't be ordered; it goes down in one final wave.
+	deps = map[string][]ServiceDependency{"a": depsOn("b"), "b": depsOn("a")}
+	got := stopWaves(map[string]*serviceProcess{"a": nil, "b": nil, "c": nil}, deps)
+	if want := [][]string{{"c"}, {"a", "b"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("cyclic waves = %v, want %v", got, want)
+	}
+}
+
+// fastDependencies shortens the dependency poll and timeout for a test.
+func fastDependencies(t *testing.T, timeout time.Duration) {
+	t.Helper()
+	prevWait, prevPoll := dependencyWaitTimeout, dependencyPollInterval
+	dependencyWaitTimeout, dependencyPollInterval = timeout, 10*time.Millisecond
+	t.Cleanup(func() { dependencyWaitTimeout, dependencyPollInterval = prevWait, prevPoll })
+}
+
+// TestServiceRegistry_AutostartWaitsForManifest is the relayScheduler case:
+// a dependent on "registered" must not start until its dependency has
+// registered a manifest, and the dependency is started even though it isn't
+// autostart itself.
+func TestServiceRegistry_AutostartWaitsForManifest(t *testing.T) {
+	fastDependencies(t, 10*time.Second)
+	binPath := buildTestServiceBinary(t)
+	enhanced := NewEnhancedServiceRegistry(nil)
+	_, reg := startSandboxBridge(t, enhanced)
+
+	reg.StartAllAutostart([]ServiceConfig{
+		{ID: "svc-sched", DisplayName: "Scheduler", Command: binPath, Autostart: true,
+			DependsOn: []ServiceDependency{{Service: "svc-llm", Condition: DependsRegistered}}},
+		{ID: "svc-llm", DisplayName: "LLM", Command: binPath, Args: []string{"--register"}},
+	})
+	t.Cleanup(reg.StopAll)
+
+	if !reg.IsRunning("svc-llm") {
+		t.Fatal("dependency of an autostart service was not started")
+	}
+	waitFor(t, 10*time.Second, "dependent start", func() bool { return reg.IsRunning("svc-sched") })
+
+	rec := enhanced.Get("svc-llm")
+	reg.mu.Lock()
+	started := reg.processes["svc-sched"].started
+	reg.mu.Unlock()
+	if rec == nil || started.Before(rec.RegisteredAt) {
+		t.Fatalf("dependent started at %v, before the manifest registered (%+v)", started, rec)
+	}
+}
+
+// A dependent whose dependency never becomes ready gives up at the timeout
+// instead of starting into a missing dependency.
+func TestServiceRegistry_AutostartDependencyTimeout(t *testing.T) {
+	fastDependencies(t, 200*time.Millisecond)
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+
+	reg.StartAllAutostart([]ServiceConfig{
+		{ID: "svc-quiet", DisplayName: "Quiet", Command: "/bin/sleep", Args: []string{"30"}},
+		{ID: "svc-needy", DisplayName: "Needy", Command: "/bin/sleep", Args: []string{"30"}, Autostart: true,
+			DependsOn: []ServiceDependency{{Service: "svc-quiet", Condition: DependsRegistered}}},
+	})
+	time.Sleep(500 * time.Millisecond)
+	if reg.IsRunning("svc-needy") {
+		t.Fatal("dependent started although its dependency never registered")
+	}
+	if !reg.IsRunning("svc-quiet") {
+		t.Fatal("dependency not running")
+	}
+}
+
+// StopAll takes dependents down before what they depend on.
+func TestServiceRegistry_StopAllInDependencyOrder(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	out := filepath.Join(t.TempDir(), "stops")
+	// Each service notes its ID when told to stop. The short sleep makes an
+	// out-of-order (concurrent) stop show up as a misordered file.
+	script := `trap 'sleep 0.1; echo "$NAME" >> "$OUT"; exit 0' TERM; while :; do sleep 1; done`
+	svc := func(id string, deps ...string) ServiceConfig {
+		return ServiceConfig{ID: id, DisplayName: id, Command: "/bin/sh", Args: []string{"-c", script},
+			Env: map[string]string{"NAME": id, "OUT": out}, DependsOn: depsOn(deps...)}
+	}
+	configs := []ServiceConfig{svc("svc-llm"), svc("svc-sched", "svc-llm"), svc("svc-eve", "svc-sched")}
+	for i := range configs {
+		if err := reg.Start(&configs[i]); err != nil {
+			t.Fatalf("Start %s: %v", configs[i].ID, err)
+		}
+	}
+	time.Sleep(200 * time.Millisecond) // let the shells install their traps
+	reg.StopAll()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(data)); !reflect.DeepEqual(got, []string{"svc-eve", "svc-sched", "svc-llm"}) {
+		t.Fatalf("stop order = %v", got)
+	}
+}
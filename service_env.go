@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// A service's environment, lowest precedence first:
+//
+//	env_profiles  named profiles from settings.json's top-level
+//	              `env_profiles`, in the order the service lists them
+//	env_files     dotenv files, in the order listed; a relative path is
+//	              taken from the service's working_dir
+//	env           the service's own KEY=VALUE pairs
+//
+// A later layer overrides an earlier one key by key. The merged map then goes
+// through resolveEnvRefs like `env` always has, so a profile or an env file
+// can hold ${secret:} and ${file:} references too. Profiles are shared: edit
+// one and every service using it picks the change up on its next start,
+// which is how a set of services switches between, say, "dev" and "prod".
+//
+// Env files are read at every spawn, like ${file:} references, and a missing
+// or malformed one fails the start rather than starting the service without
+// what it asked for.
+
+// maxEnvFileBytes caps an env file read.
+const maxEnvFileBytes = 1 << 20
+
+// Sources of an effective env var, as `relay service show` labels them.
+const (
+	envSourceProfile = "profile"
+	envSourceFile    = "file"
+	envSourceService = "env"
+)
+
+// envVar is one variable of a service's effective environment: its value as
+// configured (references unresolved) and the layer it came from.
+type envVar struct {
+	Key    string
+	Value  string
+	Source string // envSourceProfile, envSourceFile or envSourceService
+	// From names the profile or env file for those sources.
+	From string
+	// Field is the secretFields name the value is stored under, for
+	// masking a secret-store reference; "" for an env file's values.
+	Field string
+}
+
+// validateEnvSources checks the service's env_files and env_profiles for
+// what can be checked without settings: whether profiles exist is
+// Settings.checkEnvProfiles'.
+func (c *ServiceConfig) validateEnvSources() error {
+	for _, f := range c.EnvFiles {
+		if strings.TrimSpace(f) == "" {
+			return fmt.Errorf("env_files entries must not be empty")
+		}
+		if !filepath.IsAbs(f) && !strings.HasPrefix(f, "~/") && c.WorkingDir == "" {
+			return fmt.Errorf("env file %q is relative but the service has no working directory", f)
+		}
+	}
+	for i, p := range c.EnvProfiles {
+		if !isSafeID(p) {
+			return fmt.Errorf("env profile name %q is invalid: use only letters, digits, '.', '_', '-'", p)
+		}
+		if slices.Contains(c.EnvProfiles[:i], p) {
+			return fmt.Errorf("env profile %q is listed twice", p)
+		}
+	}
+	return nil
+}
+
+// checkEnvProfiles rejects a service that uses a profile s doesn't define.
+func (s *Settings) checkEnvProfiles(cfg ServiceConfig) error {
+	for _, p := range cfg.EnvProfiles {
+		if _, ok := s.EnvProfiles[p]; !ok {
+			return fmt.Errorf("service %q uses env profile %q, which doesn't exist (create it with: relay service profile set --name %s --env KEY=VALUE)", cfg.ID, p, p)
+		}
+	}
+	return nil
+}
+
+// profileUsers returns the IDs of the services that use profile name.
+func (s *Settings) profileUsers(name string) []string {
+	var ids []string
+	for _, svc := range s.Services {
+		if slices.Contains(svc.EnvProfiles, name) {
+			ids = append(ids, svc.ID)
+		}
+	}
+	return ids
+}
+
+// effectiveServiceEnv merges cfg's env layers into the environment it is
+// started with, sorted by key, without resolving references. profiles is
+// the settings' env_profiles.
+func effectiveServiceEnv(cfg *ServiceConfig, profiles map[string]map[string]string) ([]envVar, error) {
+	merged := map[string]envVar{}
+	for _, name := range cfg.EnvProfiles {
+		env, ok := profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("env profile %q doesn't exist", name)
+		}
+		for k, v := range env {
+			merged[k] = envVar{Key: k, Value: v, Source: envSourceProfile, From: name, Field: "profile/" + name + "/env/" + k}
+		}
+	}
+	for _, f := range cfg.EnvFiles {
+		env, err := readEnvFile(f, cfg.WorkingDir)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range env {
+			merged[k] = envVar{Key: k, Value: v, Source: envSourceFile, From: f}
+		}
+	}
+	for k, v := range cfg.Env {
+		merged[k] = envVar{Key: k, Value: v, Source: envSourceService, Field: "service/" + cfg.ID + "/env/" + k}
+	}
+	out := make([]envVar, 0, len(merged))
+	for _, v := range merged {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// serviceEnv returns the environment cfg is spawned with: every layer
+// merged, references resolved. Returns cfg.Env itself for a service with no
+// profiles or env files, as before they existed.
+func (r *ServiceRegistry) serviceEnv(cfg *ServiceConfig) (map[string]string, error) {
+	if len(cfg.EnvProfiles) == 0 && len(cfg.EnvFiles) == 0 {
+		return resolveEnvRefs(cfg.Env)
+	}
+	var profiles map[string]map[string]string
+	if r.EnvProfiles != nil {
+		profiles = r.EnvProfiles()
+	}
+	vars, err := effectiveServiceEnv(cfg, profiles)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string, len(vars))
+	for _, v := range vars {
+		env[v.Key] = v.Value
+	}
+	return resolveEnvRefs(env)
+}
+
+// envFilePath resolves an env_files entry: "~/" is the home directory, and
+// a relative path is taken from workdir.
+func envFilePath(path, workdir string) (string, error) {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("expand ~: %w", err)
+		}
+		return filepath.Join(home, rest), nil
+	}
+	if !filepath.IsAbs(path) {
+		if workdir == "" {
+			return "", fmt.Errorf("env file %q is relative but the service has no working directory", path)
+		}
+		return filepath.Join(workdir, path), nil
+	}
+	return path, nil
+}
+
+// readEnvFile reads and parses one env file.
+func readEnvFile(path, workdir string) (map[string]string, error) {
+	full, err := envFilePath(path, workdir)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, fmt.Errorf("env file: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxEnvFileBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("env file %s: %w", full, err)
+	}
+	if len(data) > maxEnvFileBytes {
+		return nil, fmt.Errorf("env file %s is larger than %d bytes", full, maxEnvFileBytes)
+	}
+	env, err := parseDotenv(data)
+	if err != nil {
+		return nil, fmt.Errorf("env file %s: %w", full, err)
+	}
+	return env, nil
+}
+
+// parseDotenv parses the common dotenv format: one KEY=VALUE per line,
+// optionally prefixed with "export"; blank lines and lines starting with #
+// are skipped. An unquoted value is trimmed and ends at " #"; a
+// single-quoted one is taken literally; a double-quoted one may span lines
+// and understands \n, \t, \" and \\. There is no $VAR interpolation —
+// ${secret:} and ${file:} references are left for resolveEnvRefs.
+func parseDotenv(data []byte) (map[string]string, error) {
+	env := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64<<10), maxEnvFileBytes)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "export "); ok {
+			line = strings.TrimSpace(rest)
+		}
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || !validEnvKey(k) {
+			return nil, fmt.Errorf("line %d: want KEY=VALUE", lineNo)
+		}
+		v = strings.TrimSpace(v)
+		switch {
+		case strings.HasPrefix(v, "'"):
+			end := strings.IndexByte(v[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", lineNo)
+			}
+			v = v[1 : 1+end]
+		case strings.HasPrefix(v, `"`):
+			start := lineNo
+			val, closed := unquoteDotenv(v[1:])
+			for !closed && sc.Scan() {
+				lineNo++
+				more, c := unquoteDotenv(sc.Text())
+				val, closed = val+"\n"+more, c
+			}
+			if !closed {
+				return nil, fmt.Errorf("line %d: unterminated double quote", start)
+			}
+			v = val
+		default:
+			if i := strings.Index(v, " #"); i >= 0 {
+				v = strings.TrimSpace(v[:i])
+			}
+		}
+		env[k] = v
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// unquoteDotenv decodes s up to an unescaped closing double quote,
+// reporting whether it found one.
+func unquoteDotenv(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return b.String(), true
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), false
+}
+
+// validEnvKey reports whether k is a portable environment variable name.
+func validEnvKey(k string) bool {
+	if k == "" || (k[0] >= '0' && k[0] <= '9') {
+		return false
+	}
+	for _, c := range k {
+		if c != '_' && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// serviceShow prints one service's configuration, a field per line, and the
+// environment it would be started with — profiles, env files and env merged,
+// each variable labelled with where it came from — without starting it.
+// Credentials are masked as in `mcp list`: references are shown as written,
+// plaintext under a credential-looking key as <redacted>.
+func serviceShow(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("service show", flag.ExitOnError)
+	id := fs.String("id", "", "service ID")
+	name := fs.String("name", "", "service display name")
+	fs.Parse(args)
+
+	if *id == "" && *name == "" {
+		exitError("--id or --name is required")
+	}
+	s := store.Get()
+	resolvedID := s.ResolveServiceID(*id, *name)
+	if resolvedID == "" {
+		if *id != "" {
+			exitError("no service found with id %q", *id)
+		}
+		exitError("no service found with name %q", *name)
+	}
+	svc, _ := s.findServiceByID(resolvedID)
+	vars, err := effectiveServiceEnv(svc, s.EnvProfiles)
+	if err != nil {
+		exitError("service %q environment: %v", svc.ID, err)
+	}
+	printServiceShow(os.Stdout, svc, vars, listSecretRefs(store))
+}
+
+// printServiceShow renders `service show`.
+func printServiceShow(out io.Writer, svc *ServiceConfig, vars []envVar, storeRefs map[string]string) {
+	orDash := func(v string) string {
+		if v == "" {
+			return "-"
+		}
+		return v
+	}
+	cmd := svc.Command
+	if len(svc.Args) > 0 {
+		cmd += " " + strings.Join(svc.Args, " ")
+	}
+	w := newTabWriterTo(out)
+	fmt.Fprintf(w, "ID:\t%s\n", svc.ID)
+	fmt.Fprintf(w, "Name:\t%s\n", svc.DisplayName)
+	fmt.Fprintf(w, "Command:\t%s\n", cmd)
+	fmt.Fprintf(w, "Working dir:\t%s\n", orDash(svc.WorkingDir))
+	if svc.replicaCount() > 1 {
+		fmt.Fprintf(w, "Replicas:\t%d\n", svc.Replicas)
+	}
+	fmt.Fprintf(w, "URL:\t%s\n", orDash(svc.URL))
+	auto := "no"
+	if svc.Autostart {
+		auto = "yes"
+	}
+	fmt.Fprintf(w, "Autostart:\t%s\n", auto)
+	fmt.Fprintf(w, "Depends on:\t%s\n", formatDependencies(svc.DependsOn))
+	if svc.isJob() {
+		fmt.Fprintf(w, "Schedule:\t%s\n", formatSchedule(svc))
+	}
+	fmt.Fprintf(w, "Sockets:\t%s\n", svc.Sockets)
+	fmt.Fprintf(w, "Health check:\t%s\n", svc.Health)
+	fmt.Fprintf(w, "Restart:\t%s\n", svc.Restart)
+	fmt.Fprintf(w, "Stop:\t%s\n", formatStop(svc))
+	fmt.Fprintf(w, "Limits:\t%s\n", svc.Limits)
+	fmt.Fprintf(w, "Env profiles:\t%s\n", orDash(strings.Join(svc.EnvProfiles, ", ")))
+	fmt.Fprintf(w, "Env files:\t%s\n", orDash(strings.Join(svc.EnvFiles, ", ")))
+	w.Flush()
+
+	fmt.Fprintln(out, "\nEnvironment:")
+	if len(vars) == 0 {
+		fmt.Fprintln(out, "  (none)")
+		return
+	}
+	w = newTabWriterTo(out)
+	for _, v := range vars {
+		source := v.Source
+		if v.From != "" {
+			source += " " + v.From
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", v.Key, displayEnvValue(v.Field, v.Key, v.Value, storeRefs), source)
+	}
+	w.Flush()
+}
+
+// `relay service profile` — manage the settings' env profiles.
+func serviceProfile(store SettingsStore, args []string) {
+	runSubcommands("service profile", []cliSubcommand{
+		{"set", func(a []string) { serviceProfileSet(store, a) }},
+		{"list", func(_ []string) { serviceProfileList(store, os.Stdout) }},
+		{"rm", func(a []string) { serviceProfileRm(store, a) }},
+	}, args)
+}
+
+// serviceProfileSet creates a profile or changes some of its variables:
+// --env sets (or overrides) a key, --unset removes one, and keys named in
+// neither are left alone.
+func serviceProfileSet(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("service profile set", flag.ExitOnError)
+	name := fs.String("name", "", "profile name (required)")
+	var envPairs, unset stringSlice
+	fs.Var(&envPairs, "env", "environment KEY=VALUE (repeatable)")
+	fs.Var(&unset, "unset", "remove KEY from the profile (repeatable)")
+	fs.Parse(args)
+
+	if !isSafeID(*name) {
+		exitError("--name is required: use only letters, digits, '.', '_', '-'")
+	}
+	env, err := parseEnvPairs(envPairs)
+	if err != nil {
+		exitError("%v", err)
+	}
+	for k := range env {
+		if !validEnvKey(k) {
+			exitError("invalid env key %q", k)
+		}
+	}
+	var users []string
+	created := false
+	if err := store.With(func(s *Settings) {
+		if s.EnvProfiles == nil {
+			s.EnvProfiles = map[string]map[string]string{}
+		}
+		p, ok := s.EnvProfiles[*name]
+		if !ok {
+			p, created = map[string]string{}, true
+		}
+		for k, v := range env {
+			p[k] = v
+		}
+		for _, k := range unset {
+			delete(p, k)
+		}
+		s.EnvProfiles[*name] = p
+		users = s.profileUsers(*name)
+	}); err != nil {
+		exitError("failed to save settings: %v", err)
+	}
+	verb := "updated"
+	if created {
+		verb = "created"
+	}
+	fmt.Printf("%s env profile %q\n", verb, *name)
+	if len(users) > 0 {
+		fmt.Printf("services using it pick the change up on their next start: %s\n", strings.Join(users, ", "))
+	}
+}
+
+// serviceProfileList prints each profile's variables, masked as in
+// `service show`, and the services using it.
+func serviceProfileList(store SettingsStore, out io.Writer) {
+	s := store.Get()
+	if len(s.EnvProfiles) == 0 {
+		fmt.Fprintln(out, "no env profiles defined")
+		return
+	}
+	names := make([]string, 0, len(s.EnvProfiles))
+	for n := range s.EnvProfiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	refs := listSecretRefs(store)
+	w := newTabWriterTo(out)
+	fmt.Fprintln(w, "NAME\tUSED BY\tENV")
+	for _, n := range names {
+		users := strings.Join(s.profileUsers(n), ",")
+		if users == "" {
+			users = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", n, users, formatEnvForList("profile/"+n+"/env/", s.EnvProfiles[n], refs))
+	}
+	w.Flush()
+}
+
+// serviceProfileRm deletes a profile no service uses.
+func serviceProfileRm(store SettingsStore, args []string) {
+	fs := flag.NewFlagSet("service profile rm", flag.ExitOnError)
+	name := fs.String("name", "", "profile name (required)")
+	fs.Parse(args)
+
+	if *name == "" {
+		exitError("--name is required")
+	}
+	var found bool
+	var users []string
+	if err := store.With(func(s *Settings) {
+		if _, found = s.EnvProfiles[*name]; !found {
+			return
+		}
+		if users = s.profileUsers(*name); len(users) > 0 {
+			return
+		}
+		delete(s.EnvProfiles, *name)
+	}); err != nil {
+		exitError("failed to save settings: %v", err)
+	}
+	switch {
+	case !found:
+		exitError("no env profile named %q", *name)
+	case len(users) > 0:
+		exitError("env profile %q is used by %s; change their --env-profile first", *name, strings.Join(users, ", "))
+	}
+	fmt.Printf("removed env profile %q\n", *name)
+}
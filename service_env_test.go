@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDotenv(t *testing.T) {
+	data := `# comment
+PLAIN=value
+export EXPORTED = spaced out
+EMPTY=
+TRAILING=abc # note
+HASH=abc#def
+SINGLE='lit\n $X # kept'
+DOUBLE="a\tb \"q\" \\ # kept"
+MULTI="line1
+line2"
+REF=${secret:gh}
+`
+	env, err := parseDotenv([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"PLAIN":    "value",
+		"EXPORTED": "spaced out",
+		"EMPTY":    "",
+		"TRAILING": "abc",
+		"HASH":     "abc#def",
+		"SINGLE":   `lit\n $X # kept`,
+		"DOUBLE":   "a\tb \"q\" \\ # kept",
+		"MULTI":    "line1\nline2",
+		"REF":      "${secret:gh}",
+	}
+	if len(env) != len(want) {
+		t.Errorf("parsed %d vars, want %d: %v", len(env), len(want), env)
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("%s = %q, want %q", k, env[k], v)
+		}
+	}
+
+	for _, bad := range []string{"NOEQUALS", "1BAD=x", "BAD KEY=x", "Q='open", "Q=\"open\nstill open"} {
+		if _, err := parseDotenv([]byte(bad)); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+func TestEffectiveServiceEnv(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("A=file\nB=file\nC=file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "local.env"), []byte("C=local\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	profiles := map[string]map[string]string{
+		"base": {"A": "base", "P": "base", "Q": "base"},
+		"dev":  {"Q": "dev"},
+	}
+	cfg := &ServiceConfig{ID: "web", WorkingDir: dir, EnvProfiles: []string{"base", "dev"},
+		EnvFiles: []string{".env", "local.env"}, Env: map[string]string{"B": "env"}}
+
+	vars, err := effectiveServiceEnv(cfg, profiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range vars {
+		got = append(got, v.Key+"="+v.Value+" "+v.Source+" "+v.From)
+	}
+	want := []string{
+		"A=file file .env",
+		"B=env env ",
+		"C=local file local.env",
+		"P=base profile base",
+		"Q=dev profile dev",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("effective env:\n got %q\nwant %q", got, want)
+	}
+	if vars[1].Field != "service/web/env/B" || vars[3].Field != "profile/base/env/P" || vars[0].Field != "" {
+		t.Errorf("fields: %q %q %q", vars[1].Field, vars[3].Field, vars[0].Field)
+	}
+
+	missing := *cfg
+	missing.EnvFiles = []string{"nope.env"}
+	if _, err := effectiveServiceEnv(&missing, profiles); err == nil {
+		t.Error("missing env file accepted")
+	}
+	unknown := *cfg
+	unknown.EnvProfiles = []string{"prod"}
+	if _, err := effectiveServiceEnv(&unknown, profiles); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
+
+func TestServiceConfig_ValidateEnvSources(t *testing.T) {
+	base := ServiceConfig{ID: "web", DisplayName: "Web", Command: "/bin/true"}
+	for _, mod := range []func(*ServiceConfig){
+		func(c *ServiceConfig) { c.EnvFiles = []string{".env"} }, // relative, no workdir
+		func(c *ServiceConfig) { c.EnvFiles = []string{" "} },
+		func(c *ServiceConfig) { c.EnvProfiles = []string{"a/b"} },
+		func(c *ServiceConfig) { c.EnvProfiles = []string{"dev", "dev"} },
+	} {
+		cfg := base
+		mod(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("config %+v validated", cfg)
+		}
+	}
+	ok := base
+	ok.WorkingDir, ok.EnvFiles, ok.EnvProfiles = "/srv", []string{".env", "/etc/web.env", "~/web.env"}, []string{"dev"}
+	if err := ok.Validate(); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+
+	s := &Settings{EnvProfiles: map[string]map[string]string{"dev": {}}, Services: []ServiceConfig{ok, base}}
+	if err := s.checkEnvProfiles(ok); err != nil {
+		t.Errorf("checkEnvProfiles: %v", err)
+	}
+	ok.EnvProfiles = []string{"prod"}
+	if err := s.checkEnvProfiles(ok); err == nil {
+		t.Error("unknown profile passed checkEnvProfiles")
+	}
+	if users := s.profileUsers("dev"); len(users) != 1 || users[0] != "web" {
+		t.Errorf("profileUsers = %v", users)
+	}
+}
+
+// Profile values are settings credentials like env values: the secret store
+// migrates them.
+func TestSecretFields_IncludeEnvProfiles(t *testing.T) {
+	s := &Settings{EnvProfiles: map[string]map[string]string{"prod": {"API_TOKEN": "t", "REGION": "eu"}}}
+	auto := map[string]bool{}
+	for _, f := range secretFields(s) {
+		auto[f.name] = f.auto
+	}
+	if a, ok := auto["profile/prod/env/API_TOKEN"]; !ok || !a {
+		t.Errorf("API_TOKEN field: present %v auto %v", ok, a)
+	}
+	if a, ok := auto["profile/prod/env/REGION"]; !ok || a {
+		t.Errorf("REGION field: present %v auto %v", ok, a)
+	}
+}
+
+func TestServiceRegistry_SpawnsWithEffectiveEnv(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	reg.EnvProfiles = func() map[string]map[string]string {
+		return map[string]map[string]string{"shared": {"FROM_PROFILE": "p", "OVERRIDDEN": "profile"}}
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("FROM_FILE=f\nOVERRIDDEN=file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	cfg := ServiceConfig{ID: "svc-env", DisplayName: "Env", Command: "/bin/sh", WorkingDir: dir,
+		Args:        []string{"-c", `echo "$FROM_PROFILE $FROM_FILE $OVERRIDDEN" > "$OUT"`},
+		Env:         map[string]string{"OUT": out, "OVERRIDDEN": "env"},
+		EnvProfiles: []string{"shared"}, EnvFiles: []string{".env"}}
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "service output", func() bool {
+		data, _ := os.ReadFile(out)
+		return len(data) > 0
+	})
+	if data, _ := os.ReadFile(out); string(data) != "p f env\n" {
+		t.Errorf("service env: %q", data)
+	}
+
+	cfg.EnvFiles = []string{"missing.env"}
+	if err := reg.Start(&cfg); err == nil {
+		t.Error("started with a missing env file")
+	}
+}
+
+func TestPrintServiceShow(t *testing.T) {
+	svc := &ServiceConfig{ID: "web", DisplayName: "Web", Command: "./web", Args: []string{"--port", "80"},
+		WorkingDir: "/srv/web", EnvProfiles: []string{"prod"}, EnvFiles: []string{".env"},
+		Autostart: true, DependsOn: []ServiceDependency{{Service: "db", Condition: DependsHealthy}},
+		Health:  &HealthCheck{HTTP: "/healthz"},
+		Restart: &RestartPolicy{Policy: RestartOnFailure}, StopSignal: "INT", StopTimeoutSec: 30,
+		Sockets: &SocketActivation{Listeners: []SocketListener{{Name: "http", Address: "tcp:127.0.0.1:8080"}}}}
+	vars := []envVar{
+		{Key: "API_TOKEN", Value: "plain", Source: envSourceFile, From: ".env"},
+		{Key: "DB_PASSWORD", Value: "resolved", Source: envSourceProfile, From: "prod", Field: "profile/prod/env/DB_PASSWORD"},
+		{Key: "GH", Value: "${secret:gh}", Source: envSourceService, Field: "service/web/env/GH"},
+		{Key: "REGION", Value: "eu", Source: envSourceProfile, From: "prod", Field: "profile/prod/env/REGION"},
+	}
+	var out bytes.Buffer
+	printServiceShow(&out, svc, vars, map[string]string{"profile/prod/env/DB_PASSWORD": "db"})
+	got := out.String()
+	for _, want := range []string{
+		"Command:       ./web --port 80",
+		"Env profiles:  prod",
+		"URL:           -",
+		"Autostart:     yes",
+		"Depends on:    db:healthy",
+		"Sockets:       http=tcp:127.0.0.1:8080",
+		"Health check:  http /healthz",
+		"Restart:       on-failure",
+		"Stop:          SIGINT 30s",
+		"Limits:        -",
+		"API_TOKEN    <redacted>    file .env",
+		"DB_PASSWORD  secret://db   profile prod",
+		"GH           ${secret:gh}  env",
+		"REGION       eu            profile prod",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "plain") || strings.Contains(got, "resolved") {
+		t.Errorf("credential shown:\n%s", got)
+	}
+	if strings.Contains(got, "Schedule:") {
+		t.Errorf("a service shows no schedule:\n%s", got)
+	}
+}
+
+func TestServiceProfileCommands(t *testing.T) {
+	store := newCLISandboxStore(t)
+	serviceProfileSet(store, []string{"--name", "dev", "--env", "A=1", "--env", "API_KEY=k"})
+	serviceProfileSet(store, []string{"--name", "dev", "--env", "B=2", "--unset", "A"})
+	if got := store.Get().EnvProfiles["dev"]; len(got) != 2 || got["B"] != "2" || got["API_KEY"] != "k" {
+		t.Fatalf("profile = %v", got)
+	}
+
+	dir := t.TempDir()
+	serviceRegister(store, []string{"--name", "Web", "--command", "/usr/bin/true", "--workdir", dir,
+		"--env-profile", "dev", "--env-file", ".env"})
+	cfg := store.Get().Services[0]
+	if strings.Join(cfg.EnvProfiles, ",") != "dev" || strings.Join(cfg.EnvFiles, ",") != ".env" {
+		t.Fatalf("registered env sources: %v %v", cfg.EnvProfiles, cfg.EnvFiles)
+	}
+
+	var out bytes.Buffer
+	serviceProfileList(store, &out)
+	if got := out.String(); !strings.Contains(got, "dev   web      API_KEY=<redacted> B=2") {
+		t.Errorf("profile list:\n%s", got)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"relaygo/bridge"
+)
+
+// Service event feeds: the fan-in half of the event bus (event_bus.go).
+//
+// A manifest that declares an event stream (bridge.EventsDecl) gets a feed:
+// a goroutine that holds a GET on the stream over the service's internal
+// socket, with its internal token, reads Server-Sent Events from it and
+// republishes each on the bus with the replica's instance ID as the
+// source. It runs from the registration to the Forget (or the next
+// registration, which starts a fresh one) and reconnects when the stream
+// drops, so a service restarting its listener loses nothing but the
+// events sent while it was down.
+
+// serviceEventRetry is how long a feed waits before reconnecting, doubled
+// per consecutive failure up to serviceEventRetryMax. Vars so tests can
+// shorten them.
+var (
+	serviceEventRetry    = time.Second
+	serviceEventRetryMax = 30 * time.Second
+)
+
+// maxServiceEventBytes bounds one event read from a service, like
+// maxStatusBodyBytes bounds a status body: the stream is long-lived, so
+// only a per-event cap keeps a misbehaving service from growing relay's
+// buffers without limit.
+const maxServiceEventBytes = 256 << 10
+
+// startEventFeed starts rec's feed when its manifest declares an event
+// stream and the registry publishes to a bus, and returns the function
+// that stops it (a no-op otherwise).
+//
+// Stopping waits for the feed to return, so once a Forget or a
+// re-registration is done nothing more from the old replica reaches the
+// bus. Cancelling the context aborts the stream's read, so the wait is
+// short.
+func (r *EnhancedServiceRegistry) startEventFeed(rec *EnhancedService) func() {
+	decl := rec.Manifest.Events
+	if decl == nil || r.Events == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	feed := eventFeed{
+		bus:      r.Events,
+		source:   rec.instance(),
+		socket:   rec.InternalSocket,
+		token:    rec.InternalToken,
+		decl:     *decl,
+		retry:    serviceEventRetry,
+		retryMax: serviceEventRetryMax,
+	}
+	go func() {
+		defer close(done)
+		feed.run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// eventFeed is one replica's feed. The retry delays are copied from the
+// package vars when it starts, so a test restoring them can't race a feed
+// that is still winding down.
+type eventFeed struct {
+	bus                   *EventBus
+	source, socket, token string
+	decl                  bridge.EventsDecl
+	retry, retryMax       time.Duration
+}
+
+// run holds the service's event stream open until ctx ends.
+func (f eventFeed) run(ctx context.Context) {
+	client := &http.Client{Transport: newUnixHTTPTransport(f.socket)}
+	defer client.CloseIdleConnections()
+	wait := f.retry
+	for {
+		got, err := readEventFeed(ctx, client, f.bus, f.source, f.token, f.decl)
+		if ctx.Err() != nil {
+			return
+		}
+		if got {
+			wait = f.retry
+		}
+		slog.Debug("service events: stream ended; reconnecting", "service", f.source, "error", err, "in", wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, f.retryMax)
+	}
+}
+
+// readEventFeed reads one connection's worth of the stream, publishing as
+// it goes. It reports whether any event arrived, so a stream that works
+// and then drops reconnects promptly.
+func readEventFeed(ctx context.Context, client *http.Client, bus *EventBus, source, token string, decl bridge.EventsDecl) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, internalUnixHostURL+decl.Path, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	got := false
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 0, 4096), maxServiceEventBytes)
+	typ, data := "", []byte(nil)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if data != nil {
+				got = true
+				publishServiceEvent(bus, source, decl, typ, data)
+			}
+			typ, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// Comment: the service's keepalive.
+		default:
+			field, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+			switch field {
+			case "event":
+				typ = value
+			case "data":
+				if data != nil {
+					data = append(data, '\n')
+				}
+				data = append(data, value...)
+				if data == nil {
+					data = []byte{}
+				}
+				if len(data) > maxServiceEventBytes {
+					return got, fmt.Errorf("event exceeds %d bytes", maxServiceEventBytes)
+				}
+			}
+			// id and retry are the service's own bookkeeping; relay's
+			// stream numbers events itself.
+		}
+	}
+	return got, sc.Err()
+}
+
+// publishServiceEvent republishes one event read from a service. An event
+// without a type is "message", as in SSE. One whose type isn't valid, is in
+// a namespace of relay's own, or isn't among those the manifest declared is
+// dropped. Data that isn't JSON is carried as a JSON string.
+func publishServiceEvent(bus *EventBus, source string, decl bridge.EventsDecl, typ string, data []byte) {
+	if typ == "" {
+		typ = "message"
+	}
+	if !bridge.ValidEventType(typ) || bridge.ReservedEventType(typ) ||
+		(len(decl.Types) > 0 && !slices.Contains(decl.Types, typ)) {
+		slog.Debug("service events: dropping event", "service", source, "type", typ)
+		return
+	}
+	raw := json.RawMessage(bytes.Clone(data))
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(string(data))
+	}
+	bus.publishRaw(typ, source, raw)
+}
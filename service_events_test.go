@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relaygo/bridge"
+)
+
+// Tests for service event feeds and the registry's own service events:
+// republishing with the instance as source, the declared-type whitelist,
+// relay's reserved namespaces, reconnecting, and stopping on Forget.
+
+// sseService returns a FakeService whose events endpoint writes frames and
+// then holds the stream open until the client goes away. connects counts
+// the GETs it has served.
+func sseService(t *testing.T, id string, decl *bridge.EventsDecl, frames string, connects *atomic.Int32) *FakeService {
+	t.Helper()
+	m := newManifest("/api/" + id + "/")
+	m.Events = decl
+	return NewFakeService(t, FakeServiceOptions{
+		ServiceID: id,
+		Manifest:  m,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != decl.Path {
+				return
+			}
+			connects.Add(1)
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, frames)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	})
+}
+
+// serviceOnly subscribes to the events a service published.
+func serviceOnly(bus *EventBus, source string) *EventSubscription {
+	return bus.Subscribe("", func(ev *RelayEvent) bool { return ev.Source == source })
+}
+
+func TestServiceEvents_Republished(t *testing.T) {
+	bus := NewEventBus()
+	registry := NewEnhancedServiceRegistry(nil)
+	registry.Events = bus
+	decl := &bridge.EventsDecl{Path: "/events", Types: []string{"session.started", "message"}}
+	var connects atomic.Int32
+	fake := sseService(t, "svc-ev", decl, ": hello\n\n"+
+		"event: session.started\ndata: {\"id\":\"s1\"}\n\n"+
+		"event: session.secret\ndata: {}\n\n"+ // not declared
+		"event: project.deleted\ndata: {}\n\n"+ // relay's namespace
+		"data: plain\ndata: text\n\n", &connects)
+	sub := serviceOnly(bus, "svc-ev")
+	defer sub.Cancel()
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "register")
+	defer registry.Forget("svc-ev")
+
+	ev := nextEvent(t, sub)
+	if ev.Type != "session.started" || string(ev.Data) != `{"id":"s1"}` {
+		t.Errorf("first event = %s %s", ev.Type, ev.Data)
+	}
+	ev = nextEvent(t, sub)
+	var text string
+	if ev.Type != "message" || json.Unmarshal(ev.Data, &text) != nil || text != "plain\ntext" {
+		t.Errorf("second event = %s %s, want the unnamed text as a JSON string", ev.Type, ev.Data)
+	}
+	noEvent(t, sub)
+	if got := fake.LastRequest(); got.Headers.Get("Authorization") != "Bearer "+fake.Token() {
+		t.Errorf("feed sent Authorization %q, want the internal token", got.Headers.Get("Authorization"))
+	}
+}
+
+func TestServiceEvents_ReconnectsAndStopsOnForget(t *testing.T) {
+	oldRetry := serviceEventRetry
+	serviceEventRetry = 10 * time.Millisecond
+	t.Cleanup(func() { serviceEventRetry = oldRetry })
+
+	bus := NewEventBus()
+	registry := NewEnhancedServiceRegistry(nil)
+	registry.Events = bus
+	decl := &bridge.EventsDecl{Path: "/events"}
+	var connects atomic.Int32
+	m := newManifest("/api/flaky/")
+	m.Events = decl
+	// Each connection sends one event and ends, so the feed keeps coming back.
+	fake := NewFakeService(t, FakeServiceOptions{
+		ServiceID: "svc-flaky",
+		Manifest:  m,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			n := connects.Add(1)
+			_, _ = fmt.Fprintf(w, "event: tick\ndata: %d\n\n", n)
+		},
+	})
+	sub := serviceOnly(bus, "svc-flaky")
+	defer sub.Cancel()
+	assertNoErr(t, registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()), "register")
+	for want := 1; want <= 2; want++ {
+		if ev := nextEvent(t, sub); ev.Type != "tick" || string(ev.Data) != fmt.Sprint(want) {
+			t.Errorf("event %d = %s %s", want, ev.Type, ev.Data)
+		}
+	}
+
+	registry.Forget("svc-flaky")
+	time.Sleep(50 * time.Millisecond)
+	after := connects.Load()
+	time.Sleep(100 * time.Millisecond)
+	if n := connects.Load(); n != after {
+		t.Errorf("feed reconnected %d times after Forget", n-after)
+	}
+}
+
+func TestEnhancedServiceRegistry_PublishesLifecycle(t *testing.T) {
+	bus := NewEventBus()
+	registry := NewEnhancedServiceRegistry(nil)
+	registry.Events = bus
+	sub := bus.Subscribe("", func(ev *RelayEvent) bool { return ev.Source == eventSourceRelay })
+	defer sub.Cancel()
+
+	assertNoErr(t, registry.RegisterReplica("svc", 1, "/tmp/none.sock", "", newManifest("/api/svc/")), "register")
+	registry.SetHealth("svc#1", HealthStarting)
+	registry.SetHealth("svc#1", HealthStarting) // no change, no event
+	registry.SetHealth("svc#1", HealthReady)
+	registry.SetHealth("svc#1", "")
+	registry.Forget("svc#1")
+	registry.Forget("svc#1") // already gone, no event
+
+	for _, want := range []struct {
+		typ    string
+		health ServiceHealth
+	}{
+		{EventServiceRegistered, ""},
+		{EventServiceHealth, HealthStarting},
+		{EventServiceHealth, HealthReady},
+		{EventServiceUnregistered, ""},
+	} {
+		ev := nextEvent(t, sub)
+		var data serviceEventData
+		_ = json.Unmarshal(ev.Data, &data)
+		if ev.Type != want.typ || data.Service != "svc" || data.Instance != "svc#1" || data.Health != want.health {
+			t.Errorf("event = %s %s, want %s for svc#1 (health %q)", ev.Type, ev.Data, want.typ, want.health)
+		}
+	}
+	noEvent(t, sub)
+}
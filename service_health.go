@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Health checks and readiness for managed services.
+//
+// A running process is not the same as a working service: a relayLLM that
+// is up but wedged still holds its process group. A service with a `health`
+// block is probed for as long as it runs and moves between three states:
+//
+//	starting   spawned, not yet passed a probe
+//	ready      the last probe passed, or fewer than FailureThreshold have
+//	           failed in a row since
+//	unhealthy  FailureThreshold probes in a row have failed
+//
+// Failures during StartPeriodSec don't count, so a slow boot stays
+// "starting" instead of turning unhealthy. The state is published to the
+// enhanced-services registry, where the front-door dispatcher answers 503
+// for anything not ready. When the service also has a restart policy, going
+// unhealthy kills it and the policy brings it back; without one, probing
+// continues and a passing probe makes it ready again.
+//
+// Services without a health block have no state and are always routed to,
+// as before.
+
+// ServiceHealth is a service's readiness state.
+type ServiceHealth string
+
+const (
+	HealthStarting  ServiceHealth = "starting"
+	HealthReady     ServiceHealth = "ready"
+	HealthUnhealthy ServiceHealth = "unhealthy"
+)
+
+const (
+	defaultHealthInterval    = 10 * time.Second
+	defaultHealthTimeout     = 3 * time.Second
+	defaultHealthFailures    = 3
+	defaultHealthStartPeriod = 30 * time.Second
+)
+
+// healthStartingInterval caps the probe interval while a service is still
+// starting, so a fast boot is routed to within a second rather than after a
+// full interval. A var (not const) so tests can shorten it.
+var healthStartingInterval = time.Second
+
+// HealthCheck declares how to probe a service (`health` in settings.json).
+// Exactly one of HTTP, TCP and Exec is set.
+type HealthCheck struct {
+	// HTTP is a path ("/healthz") or an absolute http(s) URL to GET; any
+	// 2xx or 3xx passes. A path goes to the service's internal socket once
+	// it has registered a manifest (with its internal token), and otherwise
+	// to its URL.
+	HTTP string `json:"http,omitempty"`
+	// TCP is a host:port that must accept a connection.
+	TCP string `json:"tcp,omitempty"`
+	// Exec is a command and arguments, run directly (not through the login
+	// shell) in the service's working directory with its env; exit 0 passes.
+	Exec []string `json:"exec,omitempty"`
+
+	// IntervalSec is the time between probes. 0 means 10.
+	IntervalSec int `json:"interval_sec,omitempty"`
+	// TimeoutSec bounds one probe. 0 means 3.
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+	// FailureThreshold is how many failures in a row make the service
+	// unhealthy. 0 means 3.
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+	// StartPeriodSec is the boot grace period during which failures don't
+	// count. 0 means 30.
+	StartPeriodSec int `json:"start_period_sec,omitempty"`
+}
+
+func (h *HealthCheck) validate() error {
+	if h == nil {
+		return nil
+	}
+	kinds := 0
+	for _, set := range []bool{h.HTTP != "", h.TCP != "", len(h.Exec) > 0} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("health check needs exactly one of http, tcp and exec")
+	}
+	if h.IntervalSec < 0 || h.TimeoutSec < 0 || h.FailureThreshold < 0 || h.StartPeriodSec < 0 {
+		return fmt.Errorf("health check timings must not be negative")
+	}
+	switch {
+	case h.HTTP != "":
+		if !isPathOrHTTPURL(h.HTTP) {
+			return fmt.Errorf("health check http %q must be a path or an http(s) URL", h.HTTP)
+		}
+	case h.TCP != "":
+		if _, port, err := net.SplitHostPort(h.TCP); err != nil || port == "" {
+			return fmt.Errorf("health check tcp %q must be host:port", h.TCP)
+		}
+	case h.Exec[0] == "":
+		return fmt.Errorf("health check exec command is empty")
+	}
+	return nil
+}
+
+// isPathOrHTTPURL reports whether s is a path ("/healthz") or an absolute
+// http(s) URL, the two targets serviceHTTP accepts.
+func isPathOrHTTPURL(s string) bool {
+	if strings.HasPrefix(s, "/") {
+		return true
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (h *HealthCheck) interval() time.Duration {
+	return secondsOr(h.IntervalSec, defaultHealthInterval)
+}
+
+func (h *HealthCheck) timeout() time.Duration {
+	return secondsOr(h.TimeoutSec, defaultHealthTimeout)
+}
+
+func (h *HealthCheck) startPeriod() time.Duration {
+	return secondsOr(h.StartPeriodSec, defaultHealthStartPeriod)
+}
+
+func (h *HealthCheck) threshold() int {
+	if h.FailureThreshold > 0 {
+		return h.FailureThreshold
+	}
+	return defaultHealthFailures
+}
+
+// secondsOr converts a seconds setting, with 0 meaning def.
+func secondsOr(sec int, def time.Duration) time.Duration {
+	if sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return def
+}
+
+// String renders the check for `service show`, or "-".
+func (h *HealthCheck) String() string {
+	switch {
+	case h == nil:
+		return "-"
+	case h.HTTP != "":
+		return "http " + h.HTTP
+	case h.TCP != "":
+		return "tcp " + h.TCP
+	default:
+		return "exec " + strings.Join(h.Exec, " ")
+	}
+}
+
+// serviceHealthStatus is a snapshot of one running service's health.
+type serviceHealthStatus struct {
+	State     ServiceHealth
+	Failures  int       // failed probes in a row
+	LastError string    // most recent probe failure, "" after a pass
+	CheckedAt time.Time // when the last probe finished
+}
+
+// healthMonitor tracks one process's probe results.
+type healthMonitor struct {
+	// startingInterval is healthStartingInterval, read once when the
+	// process starts so the monitor goroutine never touches the var.
+	startingInterval time.Duration
+
+	mu sync.Mutex
+	st serviceHealthStatus
+}
+
+func newHealthMonitor() *healthMonitor {
+	return &healthMonitor{
+		startingInterval: healthStartingInterval,
+		st:               serviceHealthStatus{State: HealthStarting},
+	}
+}
+
+func (m *healthMonitor) status() serviceHealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.st
+}
+
+// record applies one probe result and reports whether the state changed.
+// inGrace is true during the start period, when failures don't count
+// against a service that has never been ready.
+func (m *healthMonitor) record(err error, inGrace bool, threshold int) (ServiceHealth, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev := m.st.State
+	m.st.CheckedAt = time.Now()
+	if err == nil {
+		m.st.State, m.st.Failures, m.st.LastError = HealthReady, 0, ""
+		return m.st.State, m.st.State != prev
+	}
+	m.st.LastError = err.Error()
+	if prev == HealthStarting && inGrace {
+		return prev, false
+	}
+	m.st.Failures++
+	if m.st.Failures >= threshold {
+		m.st.State = HealthUnhealthy
+	}
+	return m.st.State, m.st.State != prev
+}
+
+// monitorHealth probes proc until it exits. Started by startLocked for
+// services with a health check, which publishes the initial "starting";
+// the reaper clears the state on exit.
+func (r *ServiceRegistry) monitorHealth(proc *serviceProcess, cfg ServiceConfig, env map[string]string) {
+	hc := cfg.Health
+	for {
+		wait := hc.interval()
+		if proc.health.status().State == HealthStarting {
+			wait = min(wait, proc.health.startingInterval)
+		}
+		select {
+		case <-proc.done:
+			return
+		case <-time.After(wait):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), hc.timeout())
+		err := r.probe(ctx, &cfg, env)
+		cancel()
+		state, changed := proc.health.record(err, time.Since(proc.started) < hc.startPeriod(), hc.threshold())
+		if !changed {
+			continue
+		}
+		r.publishHealth(cfg.ID, proc, state)
+		if r.OnHealthChange != nil {
+			r.OnHealthChange()
+		}
+		if state != HealthUnhealthy {
+			slog.Info("service health changed", "id", cfg.ID, "state", state)
+			continue
+		}
+		slog.Warn("service unhealthy", "id", cfg.ID, "failures", hc.threshold(), "error", err)
+		if cfg.Restart.enabled() && r.markUnhealthyKill(proc) {
+			// The reaper sees a failed exit and the restart policy takes
+			// it from there. No pre-stop: the service isn't answering.
+			r.terminate(cfg.ID, proc)
+			return
+		}
+	}
+}
+
+// markUnhealthyKill flags proc as killed for failing its health check,
+// unless a Stop got there first. Reports whether the caller should kill.
+func (r *ServiceRegistry) markUnhealthyKill(proc *serviceProcess) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if proc.stopping {
+		return false
+	}
+	proc.unhealthy = true
+	return true
+}
+
+// publishHealth mirrors a state change into the enhanced-services registry,
+// which the front-door dispatcher consults.
+func (r *ServiceRegistry) publishHealth(id string, proc *serviceProcess, state ServiceHealth) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.publishHealthLocked(id, proc, state)
+}
+
+// publishHealthLocked publishes state for proc ("" clears it), unless proc
+// has already been reaped — a probe that finishes after the exit must not
+// overwrite the clear, or the state of a restarted successor. Caller holds
+// r.mu.
+func (r *ServiceRegistry) publishHealthLocked(id string, proc *serviceProcess, state ServiceHealth) {
+	if r.Enhanced == nil || (proc.exited && state != "") {
+		return
+	}
+	r.Enhanced.SetHealth(id, state)
+}
+
+// probe runs one health check against cfg's service.
+func (r *ServiceRegistry) probe(ctx context.Context, cfg *ServiceConfig, env map[string]string) error {
+	hc := cfg.Health
+	switch {
+	case hc.HTTP != "":
+		return r.probeHTTP(ctx, cfg)
+	case hc.TCP != "":
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", hc.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	default:
+		cmd := exec.CommandContext(ctx, hc.Exec[0], hc.Exec[1:]...)
+		cmd.Dir = cfg.WorkingDir
+		mergeEnv(cmd, env)
+		cmd.WaitDelay = time.Second
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("%w: %s", err, truncateRunes(msg, 200))
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// probeHTTP GETs the health endpoint.
+func (r *ServiceRegistry) probeHTTP(ctx context.Context, cfg *ServiceConfig) error {
+	return r.serviceHTTP(ctx, cfg.ID, cfg.URL, http.MethodGet, cfg.Health.HTTP)
+}
+
+// serviceHTTP sends a bodiless request to a service and fails on a transport
+// error or a status of 400 or more. A path target goes to the internal
+// socket (with the internal token) when the service has registered one, so
+// enhanced services are reached on the same channel the dispatcher uses, and
+// otherwise to baseURL; an absolute URL is used as is. Redirects are not
+// followed: a redirect is a success in itself, and chasing it could leave
+// the host.
+func (r *ServiceRegistry) serviceHTTP(ctx context.Context, id, baseURL, method, target string) error {
+	shown := target
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	var token string
+	if strings.HasPrefix(target, "/") {
+		var svc *EnhancedService
+		if r.Enhanced != nil {
+			svc = r.Enhanced.Get(id)
+		}
+		switch {
+		case svc != nil && svc.InternalSocket != "":
+			transport := newUnixHTTPTransport(svc.InternalSocket)
+			defer transport.CloseIdleConnections()
+			client.Transport = transport
+			token = svc.InternalToken
+			target = internalUnixHostURL + target
+		case baseURL != "":
+			target = strings.TrimSuffix(baseURL, "/") + target
+		default:
+			return errors.New("no internal socket or URL to reach yet")
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s %s: %s", method, shown, resp.Status)
+	}
+	return nil
+}
+
+// Health reports a running service's health. ok is false when the service
+// isn't running or has no health check.
+func (r *ServiceRegistry) Health(id string) (serviceHealthStatus, bool) {
+	r.mu.Lock()
+	proc := r.processes[id]
+	r.mu.Unlock()
+	if proc == nil || proc.health == nil {
+		return serviceHealthStatus{}, false
+	}
+	select {
+	case <-proc.done:
+		return serviceHealthStatus{}, false
+	default:
+	}
+	return proc.health.status(), true
+}
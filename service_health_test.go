@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck_Validate(t *testing.T) {
+	ok := []*HealthCheck{
+		nil,
+		{HTTP: "/healthz"},
+		{HTTP: "http://127.0.0.1:8080/healthz", IntervalSec: 5, TimeoutSec: 1, FailureThreshold: 2, StartPeriodSec: 60},
+		{TCP: "127.0.0.1:5432"},
+		{Exec: []string{"/usr/bin/pg_isready", "-q"}},
+	}
+	for i, h := range ok {
+		if err := h.validate(); err != nil {
+			t.Errorf("ok[%d]: %v", i, err)
+		}
+	}
+
+	bad := map[string]*HealthCheck{
+		"no probe":          {IntervalSec: 5},
+		"two probes":        {HTTP: "/healthz", TCP: "127.0.0.1:80"},
+		"relative path":     {HTTP: "healthz"},
+		"ftp url":           {HTTP: "ftp://host/healthz"},
+		"tcp without port":  {TCP: "127.0.0.1"},
+		"empty exec":        {Exec: []string{""}},
+		"negative interval": {HTTP: "/healthz", IntervalSec: -1},
+		"negative failures": {HTTP: "/healthz", FailureThreshold: -3},
+	}
+	for name, h := range bad {
+		if err := h.validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+
+	svc := &ServiceConfig{ID: "s", DisplayName: "S", Command: "/bin/true", Health: &HealthCheck{}}
+	if err := svc.Validate(); err == nil {
+		t.Error("service with empty health check validated")
+	}
+}
+
+func TestHealthMonitor_Record(t *testing.T) {
+	fail := errors.New("connection refused")
+	m := newHealthMonitor()
+
+	// Failures during the start period leave a booting service starting.
+	for range 5 {
+		if state, changed := m.record(fail, true, 2); state != HealthStarting || changed {
+			t.Fatalf("grace failure: %s, changed=%v", state, changed)
+		}
+	}
+	if st := m.status(); st.Failures != 0 || st.LastError != "connection refused" {
+		t.Fatalf("after grace failures: %+v", st)
+	}
+	if state, changed := m.record(nil, true, 2); state != HealthReady || !changed {
+		t.Fatalf("first pass: %s, changed=%v", state, changed)
+	}
+
+	// Once ready, the grace period no longer shields it: threshold failures
+	// in a row, and a pass in between resets the count.
+	m.record(fail, true, 2)
+	m.record(nil, false, 2)
+	if state, _ := m.record(fail, false, 2); state != HealthReady {
+		t.Fatalf("one failure after a pass: %s", state)
+	}
+	if state, changed := m.record(fail, false, 2); state != HealthUnhealthy || !changed {
+		t.Fatalf("threshold reached: %s, changed=%v", state, changed)
+	}
+	if state, changed := m.record(nil, false, 2); state != HealthReady || !changed {
+		t.Fatalf("recovery: %s, changed=%v", state, changed)
+	}
+	if st := m.status(); st.Failures != 0 || st.LastError != "" || st.CheckedAt.IsZero() {
+		t.Fatalf("after recovery: %+v", st)
+	}
+
+	// A service that never came up turns unhealthy once the grace ends.
+	m = newHealthMonitor()
+	m.record(fail, false, 1)
+	if st := m.status(); st.State != HealthUnhealthy {
+		t.Fatalf("failed boot: %+v", st)
+	}
+}
+
+func probeOnce(t *testing.T, r *ServiceRegistry, cfg *ServiceConfig) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return r.probe(ctx, cfg, cfg.Env)
+}
+
+func TestServiceRegistry_ProbeHTTP(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	reg := NewServiceRegistry()
+
+	// A path is resolved against the service URL until it registers a socket.
+	cfg := &ServiceConfig{ID: "web", URL: srv.URL + "/", Health: &HealthCheck{HTTP: "/healthz"}}
+	if err := probeOnce(t, reg, cfg); err != nil {
+		t.Fatalf("healthy: %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := probeOnce(t, reg, cfg); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("503 probe = %v", err)
+	}
+	status = http.StatusFound // a redirect passes without being followed
+	if err := probeOnce(t, reg, cfg); err != nil {
+		t.Fatalf("redirect: %v", err)
+	}
+
+	// An absolute URL is used as-is.
+	cfg = &ServiceConfig{ID: "web", Health: &HealthCheck{HTTP: srv.URL + "/missing"}}
+	if err := probeOnce(t, reg, cfg); err == nil {
+		t.Fatal("404 probe passed")
+	}
+
+	// Neither a socket nor a URL: nothing to probe yet.
+	cfg = &ServiceConfig{ID: "web", Health: &HealthCheck{HTTP: "/healthz"}}
+	if err := probeOnce(t, reg, cfg); err == nil {
+		t.Fatal("probe with no target passed")
+	}
+}
+
+// An enhanced service is probed over its internal socket with its internal
+// token, the same channel the dispatcher uses.
+func TestServiceRegistry_ProbeHTTPInternalSocket(t *testing.T) {
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-h", Manifest: newManifest("/api/h/")})
+	reg := NewServiceRegistry()
+	reg.Enhanced = NewEnhancedServiceRegistry(nil)
+	if err := reg.Enhanced.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ServiceConfig{ID: "svc-h", URL: "http://127.0.0.1:1", Health: &HealthCheck{HTTP: "/healthz"}}
+	if err := probeOnce(t, reg, cfg); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	got := fake.LastRequest()
+	if got == nil || got.Path != "/healthz" || got.Headers.Get("Authorization") != "Bearer "+fake.Token() {
+		t.Fatalf("upstream request = %+v", got)
+	}
+}
+
+func TestServiceRegistry_ProbeTCPAndExec(t *testing.T) {
+	reg := NewServiceRegistry()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	cfg := &ServiceConfig{ID: "db", Health: &HealthCheck{TCP: addr}}
+	if err := probeOnce(t, reg, cfg); err != nil {
+		t.Fatalf("tcp up: %v", err)
+	}
+	ln.Close()
+	if err := probeOnce(t, reg, cfg); err == nil {
+		t.Fatal("tcp probe passed with nothing listening")
+	}
+
+	// Exec runs in the working directory with the service's env, and a
+	// failure carries the command's output.
+	dir := t.TempDir()
+	cfg = &ServiceConfig{
+		ID:         "job",
+		WorkingDir: dir,
+		Env:        map[string]string{"MARKER": "ready"},
+		Health:     &HealthCheck{Exec: []string{"/bin/sh", "-c", `test -e "$MARKER" || { echo "no $MARKER in $PWD"; exit 1; }`}},
+	}
+	err = probeOnce(t, reg, cfg)
+	if err == nil || !strings.Contains(err.Error(), "no ready in "+dir) {
+		t.Fatalf("exec probe before marker = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ready"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := probeOnce(t, reg, cfg); err != nil {
+		t.Fatalf("exec probe after marker: %v", err)
+	}
+
+	// A hung command is cut off at the timeout.
+	cfg.Health = &HealthCheck{Exec: []string{"/bin/sleep", "30"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := reg.probe(ctx, cfg, nil); err == nil || time.Since(start) > 5*time.Second {
+		t.Fatalf("hung exec probe = %v after %v", err, time.Since(start))
+	}
+}
+
+func TestFrontendDispatcher_503UntilReady(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-r", Manifest: newManifest("/api/r/")})
+	if err := registry.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	get := func() *http.Response {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/api/r/x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	for _, state := range []ServiceHealth{HealthStarting, HealthUnhealthy} {
+		registry.SetHealth("svc-r", state)
+		resp := get()
+		if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+			t.Fatalf("%s: status %d, Retry-After %q", state, resp.StatusCode, resp.Header.Get("Retry-After"))
+		}
+	}
+	if n := len(fake.Requests()); n != 0 {
+		t.Fatalf("unready service received %d requests", n)
+	}
+
+	registry.SetHealth("svc-r", HealthReady)
+	if resp := get(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("ready: status %d", resp.StatusCode)
+	}
+	// No health state (no check, or cleared on exit) routes as before.
+	registry.SetHealth("svc-r", "")
+	if resp := get(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("no health state: status %d", resp.StatusCode)
+	}
+}
+
+// TestServiceRegistry_UnhealthyServiceRestarted runs a service whose exec
+// check passes while a marker file exists. It must go starting → ready, and
+// when the marker goes away be killed as unhealthy and brought back by its
+// restart policy.
+func TestServiceRegistry_UnhealthyServiceRestarted(t *testing.T) {
+	fastRestarts(t)
+	prev := healthStartingInterval
+	healthStartingInterval = 20 * time.Millisecond
+	t.Cleanup(func() { healthStartingInterval = prev })
+
+	enhanced := NewEnhancedServiceRegistry(nil)
+	_, reg := startSandboxBridge(t, enhanced)
+	exits := countingExits(reg)
+
+	marker := filepath.Join(t.TempDir(), "ready")
+	cfg := &ServiceConfig{
+		ID:          "svc-sick",
+		DisplayName: "Sick",
+		Command:     "/bin/sleep",
+		Args:        []string{"30"},
+		Env:         map[string]string{"MARKER": marker},
+		Restart:     &RestartPolicy{Policy: RestartAlways},
+		Health: &HealthCheck{
+			Exec:             []string{"/bin/sh", "-c", `test -e "$MARKER"`},
+			IntervalSec:      1,
+			FailureThreshold: 1,
+		},
+	}
+	if err := reg.Start(cfg); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if hs, ok := reg.Health(cfg.ID); !ok || hs.State != HealthStarting || enhanced.Health(cfg.ID) != HealthStarting {
+		t.Fatalf("just started: %+v, %v, published %q", hs, ok, enhanced.Health(cfg.ID))
+	}
+
+	if err := os.WriteFile(marker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "ready", func() bool { return enhanced.Health(cfg.ID) == HealthReady })
+
+	os.Remove(marker)
+	waitFor(t, 10*time.Second, "unhealthy kill", func() bool { return exits.Load() == 1 })
+	exit, _ := reg.LastExit(cfg.ID)
+	if !strings.HasPrefix(exit.Status, "killed: unhealthy (") {
+		t.Fatalf("LastExit = %+v", exit)
+	}
+	waitFor(t, 5*time.Second, "restart", func() bool { return reg.IsRunning(cfg.ID) })
+	if rs, _ := reg.RestartStatus(cfg.ID); rs.Restarts != 1 {
+		t.Fatalf("restart status = %+v", rs)
+	}
+	// The new process starts over, in its start period.
+	if hs, _ := reg.Health(cfg.ID); hs.State != HealthStarting {
+		t.Fatalf("restarted service health = %+v", hs)
+	}
+
+	// Stop clears the published state.
+	reg.Stop(cfg.ID)
+	waitFor(t, 5*time.Second, "stop", func() bool { return exits.Load() == 2 })
+	if got := enhanced.Health(cfg.ID); got != "" {
+		t.Fatalf("health after stop = %q", got)
+	}
+	if _, ok := reg.Health(cfg.ID); ok {
+		t.Fatal("Health reported for a stopped service")
+	}
+}
+
+// Without a restart policy an unhealthy service is left running and keeps
+// being probed.
+func TestServiceRegistry_UnhealthyWithoutRestartKeepsRunning(t *testing.T) {
+	prev := healthStartingInterval
+	healthStartingInterval = 20 * time.Millisecond
+	t.Cleanup(func() { healthStartingInterval = prev })
+
+	enhanced := NewEnhancedServiceRegistry(nil)
+	_, reg := startSandboxBridge(t, enhanced)
+	marker := filepath.Join(t.TempDir(), "ready")
+	if err := os.WriteFile(marker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ServiceConfig{
+		ID:          "svc-limp",
+		DisplayName: "Limp",
+		Command:     "/bin/sleep",
+		Args:        []string{"30"},
+		Env:         map[string]string{"MARKER": marker},
+		Health:      &HealthCheck{Exec: []string{"/bin/sh", "-c", `test -e "$MARKER"`}, IntervalSec: 1, FailureThreshold: 1},
+	}
+	if err := reg.Start(cfg); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	waitFor(t, 5*time.Second, "ready", func() bool { return enhanced.Health(cfg.ID) == HealthReady })
+	os.Remove(marker)
+	waitFor(t, 5*time.Second, "unhealthy", func() bool { return enhanced.Health(cfg.ID) == HealthUnhealthy })
+	if !reg.IsRunning(cfg.ID) {
+		t.Fatal("unhealthy service without a restart policy was killed")
+	}
+	if err := os.WriteFile(marker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "recovered", func() bool { return enhanced.Health(cfg.ID) == HealthReady })
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// Scheduled and one-shot jobs.
+//
+// A service with `kind: "job"` is a command run to completion rather than
+// kept running. Its `job` block says when:
+//
+//	schedule      a cron expression (cron.go), in local time
+//	interval_sec  every N seconds, counted from when the job is started
+//	(neither)     one-shot: it runs each time it is started
+//
+// Starting a scheduled job arms its schedule; stopping it disarms it and
+// stops a run in progress. IsRunning and RunningIDs report an armed job as
+// running, so the tray and settings toggles mean "scheduled". A job can also
+// be run now, whatever its schedule (`relay service run`, the settings UI).
+//
+// Each run goes through the same spawn path as a service — env injection, a
+// fresh service token, stamped output in the job's log — and the reaper
+// records its exit code and duration in the job's run history. A run that
+// outlasts timeout_sec is stopped the way any service is (service_stop.go).
+// `overlap` says what happens when a run comes due while the previous one is
+// still going: "skip" it (the default; recorded in the history), "queue" it
+// to start when the previous one ends (at most one waits), or "kill" the
+// previous run and start afresh.
+//
+// Jobs have no restart policy or health check, and services can't depend on
+// them: a job is expected to exit.
+
+// Service kinds (ServiceConfig.Kind). Empty means KindService.
+const (
+	KindService = "service"
+	KindJob     = "job"
+)
+
+// Overlap policies (JobSpec.Overlap).
+const (
+	OverlapSkip  = "skip"
+	OverlapQueue = "queue"
+	OverlapKill  = "kill"
+)
+
+// What started a job run (jobRun.Trigger).
+const (
+	jobTriggerStart    = "start"
+	jobTriggerSchedule = "schedule"
+	jobTriggerManual   = "manual"
+	jobTriggerQueued   = "queued"
+)
+
+const (
+	// maxJobHistory bounds the per-job run log kept in memory.
+	maxJobHistory = 20
+	// jobClockCheck caps how long the scheduler sleeps before looking at the
+	// wall clock again, so a run due while the machine slept fires soon
+	// after it wakes rather than a sleep's worth late.
+	jobClockCheck = time.Minute
+)
+
+// JobSpec is a job's `job` block in settings.json.
+type JobSpec struct {
+	// Schedule is a cron expression; see cron.go.
+	Schedule string `json:"schedule,omitempty"`
+	// IntervalSec runs the job every N seconds instead.
+	IntervalSec int `json:"interval_sec,omitempty"`
+	// TimeoutSec stops a run that takes longer. 0 means no limit.
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+	// Overlap is "skip", "queue" or "kill". Empty means "skip".
+	Overlap string `json:"overlap,omitempty"`
+}
+
+func (j *JobSpec) validate() error {
+	if j == nil {
+		return nil
+	}
+	if j.Schedule != "" && j.IntervalSec != 0 {
+		return fmt.Errorf("job needs a schedule or an interval, not both")
+	}
+	if j.IntervalSec < 0 || j.TimeoutSec < 0 {
+		return fmt.Errorf("job interval and timeout must not be negative")
+	}
+	if j.Schedule != "" {
+		if _, err := parseCron(j.Schedule); err != nil {
+			return err
+		}
+	}
+	switch j.Overlap {
+	case "", OverlapSkip, OverlapQueue, OverlapKill:
+		return nil
+	}
+	return fmt.Errorf("job overlap %q must be %s, %s or %s", j.Overlap, OverlapSkip, OverlapQueue, OverlapKill)
+}
+
+// scheduled reports whether the job runs on its own. Nil-safe.
+func (j *JobSpec) scheduled() bool {
+	return j != nil && (j.Schedule != "" || j.IntervalSec > 0)
+}
+
+func (j *JobSpec) overlap() string {
+	if j == nil || j.Overlap == "" {
+		return OverlapSkip
+	}
+	return j.Overlap
+}
+
+func (j *JobSpec) timeout() time.Duration {
+	if j == nil {
+		return 0
+	}
+	return secondsOr(j.TimeoutSec, 0)
+}
+
+// String renders when the job runs, for `service show`: the cron expression,
+// "every 10m0s" or "one-shot". Nil-safe.
+func (j *JobSpec) String() string {
+	switch {
+	case j == nil:
+		return "one-shot"
+	case j.Schedule != "":
+		return j.Schedule
+	case j.IntervalSec > 0:
+		return "every " + (time.Duration(j.IntervalSec) * time.Second).String()
+	default:
+		return "one-shot"
+	}
+}
+
+// isJob reports whether the service is a job.
+func (c *ServiceConfig) isJob() bool {
+	return c.Kind == KindJob
+}
+
+// validateKind checks Kind and, for a job, the settings that go with it.
+func (c *ServiceConfig) validateKind() error {
+	switch c.Kind {
+	case "", KindService:
+		if c.Job != nil {
+			return fmt.Errorf("job settings need kind %q", KindJob)
+		}
+		return nil
+	case KindJob:
+	default:
+		return fmt.Errorf("service kind %q must be %s or %s", c.Kind, KindService, KindJob)
+	}
+	if c.Restart.enabled() {
+		return fmt.Errorf("a job can't have a restart policy; it runs on its schedule")
+	}
+	if c.Health != nil {
+		return fmt.Errorf("a job can't have a health check")
+	}
+	if c.Sockets != nil {
+		return fmt.Errorf("a job can't have sockets")
+	}
+	if c.Replicas > 1 {
+		return fmt.Errorf("a job can't have replicas")
+	}
+	return c.Job.validate()
+}
+
+// formatSchedule renders a job's schedule for `service show`: "-" for a
+// service, else when the job runs, with a non-default timeout and overlap
+// policy.
+func formatSchedule(cfg *ServiceConfig) string {
+	if !cfg.isJob() {
+		return "-"
+	}
+	s := cfg.Job.String()
+	if t := cfg.Job.timeout(); t > 0 {
+		s += ", timeout " + t.String()
+	}
+	if o := cfg.Job.overlap(); o != OverlapSkip {
+		s += ", overlap " + o
+	}
+	return s
+}
+
+// jobRun is one run of a job (or one that was due and skipped), for the
+// history shown by `relay service list --history` and the settings UI.
+type jobRun struct {
+	Start    time.Time
+	Duration time.Duration
+	ExitCode int    // -1 when there is none: killed by a signal, skipped, failed to start
+	Status   string // childExit.Status, or why the run didn't happen
+	Trigger  string // jobTrigger*
+}
+
+// jobState is the registry's per-job bookkeeping. It outlives runs and
+// re-arming so the history survives a Stop. Guarded by ServiceRegistry.mu.
+type jobState struct {
+	config  ServiceConfig // config runs use: the last one started
+	armed   bool          // the schedule is active
+	disarm  chan struct{} // closed to stop the armed schedule's goroutine
+	next    time.Time     // when the schedule next fires
+	queued  bool          // overlap "queue": a run waits for the current one
+	history []jobRun
+}
+
+func (js *jobState) record(run jobRun) {
+	js.history = append(js.history, run)
+	if len(js.history) > maxJobHistory {
+		js.history = js.history[len(js.history)-maxJobHistory:]
+	}
+}
+
+// serviceJobStatus is a snapshot of jobState for status displays.
+type serviceJobStatus struct {
+	Scheduled bool
+	Next      time.Time
+	History   []jobRun
+}
+
+// jobLocked returns the job's state, creating it. Caller holds r.mu.
+func (r *ServiceRegistry) jobLocked(id string) *jobState {
+	js := r.jobs[id]
+	if js == nil {
+		js = &jobState{}
+		r.jobs[id] = js
+	}
+	return js
+}
+
+// startJobLocked is Start for a job: it arms the schedule, or runs a one-shot
+// job. Starting an armed job is a no-op, like starting a running service.
+// Caller holds r.mu.
+func (r *ServiceRegistry) startJobLocked(cfg *ServiceConfig) error {
+	js := r.jobLocked(cfg.ID)
+	if js.armed {
+		return nil
+	}
+	js.config = *cfg
+	if !cfg.Job.scheduled() {
+		return r.startJobRunLocked(cfg.ID, js, jobTriggerStart)
+	}
+	js.armed = true
+	js.disarm = make(chan struct{})
+	go r.scheduleJob(cfg.ID, js, *cfg.Job, js.disarm)
+	return nil
+}
+
+// disarmJobLocked stops the job's schedule and drops a queued run. Caller
+// holds r.mu.
+func (r *ServiceRegistry) disarmJobLocked(id string) {
+	js := r.jobs[id]
+	if js == nil {
+		return
+	}
+	if js.armed {
+		close(js.disarm)
+	}
+	js.armed, js.disarm, js.next, js.queued = false, nil, time.Time{}, false
+}
+
+// jobArmedLocked reports whether id is a job with an armed schedule. Caller
+// holds r.mu.
+func (r *ServiceRegistry) jobArmedLocked(id string) bool {
+	js := r.jobs[id]
+	return js != nil && js.armed
+}
+
+// scheduleJob is an armed job's timer loop. It runs the job each time the
+// schedule comes due until disarm is closed or the registry shuts down.
+func (r *ServiceRegistry) scheduleJob(id string, js *jobState, spec JobSpec, disarm chan struct{}) {
+	var cron *cronSchedule
+	if spec.Schedule != "" {
+		cron, _ = parseCron(spec.Schedule) // validated by Start
+	}
+	interval := time.Duration(spec.IntervalSec) * time.Second
+	due := time.Now().Round(0) // wall clock: see jobClockCheck
+	for {
+		now := time.Now().Round(0)
+		if cron != nil {
+			due = cron.next(now)
+		} else {
+			due = due.Add(interval)
+			if behind := now.Sub(due); behind > 0 {
+				due = due.Add((behind/interval + 1) * interval) // missed while asleep
+			}
+		}
+		r.mu.Lock()
+		if js.disarm != disarm {
+			r.mu.Unlock()
+			return
+		}
+		js.next = due
+		r.mu.Unlock()
+
+		for wait := time.Until(due); wait > 0; wait = time.Until(due) {
+			timer := time.NewTimer(min(wait, jobClockCheck))
+			select {
+			case <-disarm:
+				timer.Stop()
+				return
+			case <-r.quit:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		if err := r.runJob(id, jobTriggerSchedule, disarm); err != nil {
+			slog.Error("scheduled job run failed", "id", id, "error", err)
+		}
+	}
+}
+
+// RunJob runs a job now, whatever its schedule, subject to its overlap
+// policy — except that with "skip" it fails rather than skipping, since the
+// user asked for this run. An armed job runs with the config it was armed
+// with; otherwise cfg becomes the job's config.
+func (r *ServiceRegistry) RunJob(cfg *ServiceConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid service config: %w", err)
+	}
+	if !cfg.isJob() {
+		return fmt.Errorf("%q is not a job", cfg.ID)
+	}
+	r.mu.Lock()
+	if js := r.jobLocked(cfg.ID); !js.armed {
+		js.config = *cfg
+	}
+	r.mu.Unlock()
+	return r.runJob(cfg.ID, jobTriggerManual, nil)
+}
+
+// runJob starts a run of a known job, applying its overlap policy if a run
+// is still going. A scheduled run passes the disarm channel it was armed
+// with, so a run that comes due just as the job is stopped doesn't start.
+func (r *ServiceRegistry) runJob(id, trigger string, disarm chan struct{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	js := r.jobs[id]
+	if js == nil || (disarm != nil && js.disarm != disarm) {
+		return nil
+	}
+	if r.isRunningLocked(id) {
+		proc := r.processes[id]
+		switch js.config.Job.overlap() {
+		case OverlapQueue:
+			js.queued = true
+			return nil
+		case OverlapKill:
+			proc.stopping = true
+			proc.jobEnd = "killed: replaced by the next run"
+			r.mu.Unlock()
+			r.stopProcess(id, proc)
+			r.mu.Lock()
+			if r.jobs[id] != js || (disarm != nil && js.disarm != disarm) {
+				return nil
+			}
+		default:
+			if trigger == jobTriggerManual {
+				return fmt.Errorf("job %q is already running", id)
+			}
+			js.record(jobRun{Start: time.Now(), ExitCode: -1, Status: "skipped: previous run still going", Trigger: trigger})
+			slog.Warn("job run skipped; previous run still going", "id", id)
+			return nil
+		}
+	}
+	return r.startJobRunLocked(id, js, trigger)
+}
+
+// startJobRunLocked spawns one run of the job, unless one is already going
+// (another trigger got there first). A failed spawn goes in the history.
+// Caller holds r.mu.
+func (r *ServiceRegistry) startJobRunLocked(id string, js *jobState, trigger string) error {
+	if r.isRunningLocked(id) {
+		return nil
+	}
+	cfg := js.config
+	if err := r.startLocked(&cfg); err != nil {
+		js.record(jobRun{Start: time.Now(), ExitCode: -1, Status: "failed to start: " + err.Error(), Trigger: trigger})
+		return err
+	}
+	proc := r.processes[id]
+	proc.jobTrigger = trigger
+	if t := cfg.Job.timeout(); t > 0 {
+		go r.enforceJobTimeout(id, proc, t)
+	}
+	return nil
+}
+
+// enforceJobTimeout stops proc if it is still running after timeout.
+func (r *ServiceRegistry) enforceJobTimeout(id string, proc *serviceProcess, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-proc.done:
+		return
+	case <-timer.C:
+	}
+	r.mu.Lock()
+	if proc.exited || proc.stopping {
+		r.mu.Unlock()
+		return
+	}
+	proc.stopping = true
+	proc.jobEnd = "killed: timed out after " + timeout.String()
+	r.mu.Unlock()
+	slog.Warn("job run timed out; stopping", "id", id, "timeout", timeout)
+	r.stopProcess(id, proc)
+}
+
+// recordJobRunLocked adds a finished run to the job's history, as proc's
+// reaper, and reports whether a queued run should start now. Caller holds
+// r.mu.
+func (r *ServiceRegistry) recordJobRunLocked(id string, proc *serviceProcess, exit childExit) bool {
+	js := r.jobs[id]
+	if proc.jobTrigger == "" || js == nil {
+		return false
+	}
+	code := -1
+	if proc.cmd.ProcessState != nil {
+		code = proc.cmd.ProcessState.ExitCode()
+	}
+	run := jobRun{Start: proc.started, Duration: time.Since(proc.started), ExitCode: code, Status: exit.Status, Trigger: proc.jobTrigger}
+	js.record(run)
+	slog.Info("job run finished", "id", id, "status", run.Status, "duration", run.Duration, "trigger", run.Trigger)
+	queued := js.queued
+	js.queued = false
+	return queued
+}
+
+// runQueuedJob starts the run the overlap "queue" policy held back, once the
+// previous run is fully torn down.
+func (r *ServiceRegistry) runQueuedJob(id string) {
+	select {
+	case <-r.quit:
+		return
+	default:
+	}
+	if err := r.runJob(id, jobTriggerQueued, nil); err != nil {
+		slog.Error("queued job run failed", "id", id, "error", err)
+	}
+}
+
+// JobStatus reports a job's schedule and recent runs. ok is false for a job
+// this registry has never started or run.
+func (r *ServiceRegistry) JobStatus(id string) (serviceJobStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	js := r.jobs[id]
+	if js == nil {
+		return serviceJobStatus{}, false
+	}
+	return serviceJobStatus{
+		Scheduled: js.armed,
+		Next:      js.next,
+		History:   slices.Clone(js.history),
+	}, true
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"relaygo/bridge"
+)
+
+func TestJobConfig_Validate(t *testing.T) {
+	base := ServiceConfig{ID: "backup", DisplayName: "Backup", Command: "/bin/true", Kind: KindJob}
+	for name, mutate := range map[string]func(*ServiceConfig){
+		"unknown kind":      func(c *ServiceConfig) { c.Kind = "daemon" },
+		"job on a service":  func(c *ServiceConfig) { c.Kind, c.Job = "", &JobSpec{IntervalSec: 60} },
+		"schedule+interval": func(c *ServiceConfig) { c.Job = &JobSpec{Schedule: "@daily", IntervalSec: 60} },
+		"bad cron":          func(c *ServiceConfig) { c.Job = &JobSpec{Schedule: "0 25 * * *"} },
+		"negative timeout":  func(c *ServiceConfig) { c.Job = &JobSpec{TimeoutSec: -1} },
+		"bad overlap":       func(c *ServiceConfig) { c.Job = &JobSpec{Overlap: "wait"} },
+		"restart policy":    func(c *ServiceConfig) { c.Restart = &RestartPolicy{Policy: RestartAlways} },
+		"health check":      func(c *ServiceConfig) { c.Health = &HealthCheck{TCP: "127.0.0.1:9"} },
+	} {
+		cfg := base
+		mutate(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+	for _, job := range []*JobSpec{nil, {Schedule: "*/5 * * * *", TimeoutSec: 60, Overlap: OverlapKill}, {IntervalSec: 600, Overlap: OverlapQueue}} {
+		cfg := base
+		cfg.Job = job
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("job %+v: %v", job, err)
+		}
+	}
+
+	for _, c := range []struct {
+		cfg  ServiceConfig
+		want string
+	}{
+		{ServiceConfig{}, "-"},
+		{ServiceConfig{Kind: KindJob}, "one-shot"},
+		{ServiceConfig{Kind: KindJob, Job: &JobSpec{IntervalSec: 600}}, "every 10m0s"},
+		{ServiceConfig{Kind: KindJob, Job: &JobSpec{Schedule: "0 3 * * *", TimeoutSec: 90, Overlap: OverlapQueue}}, "0 3 * * *, timeout 1m30s, overlap queue"},
+	} {
+		if got := formatSchedule(&c.cfg); got != c.want {
+			t.Errorf("formatSchedule(%+v) = %q, want %q", c.cfg.Job, got, c.want)
+		}
+	}
+}
+
+// Services can only depend on services: a job is down between runs.
+func TestCheckServiceDependencies_RejectsJobs(t *testing.T) {
+	s := &Settings{Services: []ServiceConfig{{ID: "backup", Kind: KindJob}, {ID: "web"}}}
+	if err := s.checkServiceDependencies(ServiceConfig{ID: "api", DependsOn: []ServiceDependency{{Service: "backup"}}}); err == nil {
+		t.Error("dependency on a job accepted")
+	}
+	// Nor can a service others depend on become a job.
+	s.Services = append(s.Services, ServiceConfig{ID: "api", DependsOn: []ServiceDependency{{Service: "web"}}})
+	if err := s.checkServiceDependencies(ServiceConfig{ID: "web", Kind: KindJob}); err == nil {
+		t.Error("turning a dependency into a job accepted")
+	}
+	if err := s.checkServiceDependencies(ServiceConfig{ID: "report", Kind: KindJob, DependsOn: []ServiceDependency{{Service: "web"}}}); err != nil {
+		t.Errorf("job depending on a service: %v", err)
+	}
+}
+
+// jobHistory waits for the job to have n runs on record and returns them.
+func jobHistory(t *testing.T, reg *ServiceRegistry, id string, n int, timeout time.Duration) []jobRun {
+	t.Helper()
+	var runs []jobRun
+	waitFor(t, timeout, "job runs", func() bool {
+		js, _ := reg.JobStatus(id)
+		runs = js.History
+		return len(runs) >= n
+	})
+	return runs
+}
+
+// A one-shot job runs when started, through the normal spawn path, and its
+// run lands in the history; it doesn't stay "running".
+func TestServiceRegistry_OneShotJob(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	out := filepath.Join(t.TempDir(), "out")
+	cfg := ServiceConfig{ID: "job-once", DisplayName: "Once", Command: "/bin/sh", Kind: KindJob,
+		Args: []string{"-c", `echo "$RELAY_SERVICE_ID" > "$OUT"; [ -n "$RELAY_SERVICE_TOKEN" ] && echo token >> "$OUT"; exit 3`},
+		Env:  map[string]string{"OUT": out}}
+
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	runs := jobHistory(t, reg, cfg.ID, 1, 5*time.Second)
+	if r := runs[0]; r.ExitCode != 3 || r.Status != "exited: status 3" || r.Trigger != jobTriggerStart || r.Duration <= 0 {
+		t.Fatalf("run = %+v", r)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "job-once\ntoken\n" {
+		t.Errorf("job env: %q", data)
+	}
+	waitFor(t, 2*time.Second, "job not running", func() bool { return !reg.IsRunning(cfg.ID) })
+	if js, _ := reg.JobStatus(cfg.ID); js.Scheduled {
+		t.Error("one-shot job reported as scheduled")
+	}
+
+	if err := reg.RunJob(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if runs = jobHistory(t, reg, cfg.ID, 2, 5*time.Second); runs[1].Trigger != jobTriggerManual {
+		t.Fatalf("manual run = %+v", runs[1])
+	}
+	svc := ServiceConfig{ID: "svc", DisplayName: "Svc", Command: "/bin/true"}
+	if err := reg.RunJob(&svc); err == nil {
+		t.Error("RunJob ran a service")
+	}
+}
+
+// An interval job runs on its own while armed, counts as running, and stops
+// running once stopped.
+func TestServiceRegistry_IntervalJob(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	cfg := ServiceConfig{ID: "job-tick", DisplayName: "Tick", Command: "/bin/true", Kind: KindJob, Job: &JobSpec{IntervalSec: 1}}
+
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reg.IsRunning(cfg.ID) || !strings.Contains(strings.Join(reg.RunningIDs(), ","), cfg.ID) {
+		t.Fatal("armed job not reported as running")
+	}
+	waitFor(t, time.Second, "next run", func() bool {
+		js, _ := reg.JobStatus(cfg.ID)
+		return js.Scheduled && !js.Next.IsZero()
+	})
+	runs := jobHistory(t, reg, cfg.ID, 2, 5*time.Second)
+	if runs[0].Trigger != jobTriggerSchedule || runs[0].ExitCode != 0 {
+		t.Fatalf("run = %+v", runs[0])
+	}
+
+	reg.Stop(cfg.ID)
+	if reg.IsRunning(cfg.ID) {
+		t.Fatal("stopped job still running")
+	}
+	js, _ := reg.JobStatus(cfg.ID)
+	time.Sleep(1500 * time.Millisecond)
+	if after, _ := reg.JobStatus(cfg.ID); len(after.History) != len(js.History) || after.Scheduled {
+		t.Fatalf("job kept running after Stop: %d runs, then %d", len(js.History), len(after.History))
+	}
+}
+
+// sleepJob is a one-shot job that runs for secs seconds.
+func sleepJob(id, secs string, overlap string) ServiceConfig {
+	return ServiceConfig{ID: id, DisplayName: id, Command: "/bin/sleep", Args: []string{secs},
+		Kind: KindJob, Job: &JobSpec{Overlap: overlap}}
+}
+
+func TestServiceRegistry_JobOverlap(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+
+	t.Run("skip", func(t *testing.T) {
+		cfg := sleepJob("job-skip", "30", "")
+		if err := reg.Start(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		defer reg.Stop(cfg.ID)
+		if err := reg.RunJob(&cfg); err == nil || !strings.Contains(err.Error(), "already running") {
+			t.Errorf("manual run during a run: %v", err)
+		}
+		if err := reg.runJob(cfg.ID, jobTriggerSchedule, nil); err != nil {
+			t.Fatal(err)
+		}
+		js, _ := reg.JobStatus(cfg.ID)
+		if len(js.History) != 1 || js.History[0].Status != "skipped: previous run still going" || js.History[0].ExitCode != -1 {
+			t.Fatalf("history = %+v", js.History)
+		}
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		cfg := sleepJob("job-queue", "0.5", OverlapQueue)
+		if err := reg.Start(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.RunJob(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := reg.RunJob(&cfg); err != nil { // at most one waits
+			t.Fatal(err)
+		}
+		runs := jobHistory(t, reg, cfg.ID, 2, 5*time.Second)
+		if runs[0].Trigger != jobTriggerStart || runs[1].Trigger != jobTriggerQueued || runs[1].Start.Before(runs[0].Start.Add(runs[0].Duration)) {
+			t.Fatalf("runs = %+v", runs)
+		}
+		time.Sleep(time.Second)
+		if js, _ := reg.JobStatus(cfg.ID); len(js.History) != 2 {
+			t.Fatalf("want 2 runs, got %+v", js.History)
+		}
+	})
+
+	t.Run("kill", func(t *testing.T) {
+		cfg := sleepJob("job-kill", "30", OverlapKill)
+		if err := reg.Start(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		defer reg.Stop(cfg.ID)
+		first := reg.PIDsByServiceID()[cfg.ID]
+		if err := reg.RunJob(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		runs := jobHistory(t, reg, cfg.ID, 1, 5*time.Second)
+		if runs[0].Status != "killed: replaced by the next run" {
+			t.Fatalf("killed run = %+v", runs[0])
+		}
+		if pid := reg.PIDsByServiceID()[cfg.ID]; pid == 0 || pid == first {
+			t.Fatalf("no fresh run: pid %d (was %d)", pid, first)
+		}
+	})
+}
+
+func TestServiceRegistry_JobTimeout(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	cfg := ServiceConfig{ID: "job-slow", DisplayName: "Slow", Command: "/bin/sleep", Args: []string{"30"},
+		Kind: KindJob, Job: &JobSpec{TimeoutSec: 1}}
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	runs := jobHistory(t, reg, cfg.ID, 1, 5*time.Second)
+	if r := runs[0]; r.Status != "killed: timed out after 1s" || r.Duration < time.Second || r.Duration > 4*time.Second {
+		t.Fatalf("run = %+v", r)
+	}
+	if exit, _ := reg.LastExit(cfg.ID); exit.Status != "killed: timed out after 1s" {
+		t.Errorf("last exit = %q", exit.Status)
+	}
+}
+
+// jobServices adds the job side to statusServices.
+type jobServices struct {
+	statusServices
+	jobs map[string]serviceJobStatus
+	ran  []string
+}
+
+func (j *jobServices) JobStatus(id string) (serviceJobStatus, bool) {
+	js, ok := j.jobs[id]
+	return js, ok
+}
+
+func (j *jobServices) RunJob(cfg *ServiceConfig) error {
+	j.ran = append(j.ran, cfg.ID)
+	return nil
+}
+
+func TestAppRouter_JobStatusAndRun(t *testing.T) {
+	s := &Settings{Services: []ServiceConfig{{ID: "eve"}, {ID: "backup", Kind: KindJob, Job: &JobSpec{Schedule: "@daily"}}}}
+	next := time.Now().Add(time.Hour)
+	start := time.Now().Add(-time.Minute)
+	services := &jobServices{jobs: map[string]serviceJobStatus{"backup": {
+		Scheduled: true, Next: next,
+		History: []jobRun{{Start: start, Duration: 1500 * time.Millisecond, ExitCode: 0, Status: "exited: status 0", Trigger: jobTriggerSchedule}},
+	}}}
+	r := &appRouter{store: fixedStore{s: s}, services: services, onChange: func() {}}
+
+	got, err := r.ServiceStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := got[1]
+	want := bridge.JobRun{Start: start, DurationMs: 1500, ExitCode: 0, Status: "exited: status 0", Trigger: jobTriggerSchedule}
+	if job.Kind != KindJob || !job.Scheduled || job.NextRun == nil || !job.NextRun.Equal(next) || len(job.JobRuns) != 1 || job.JobRuns[0] != want {
+		t.Fatalf("job status = %+v", job)
+	}
+	if got[0].Kind != "" || got[0].JobRuns != nil {
+		t.Fatalf("service status = %+v", got[0])
+	}
+
+	if err := r.RunJob("backup"); err != nil || len(services.ran) != 1 {
+		t.Fatalf("RunJob = %v, ran %v", err, services.ran)
+	}
+	for _, id := range []string{"eve", "nope"} {
+		if err := r.RunJob(id); err == nil {
+			t.Errorf("RunJob(%q) accepted", id)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Service logs: stamping on the way in, reading on the way out.
+//
+// A managed service's merged stdout+stderr is pumped through a stampWriter
+// into its rotating <id>.log, so every line starts with the UTC time relay
+// received it. Services don't have to timestamp their own output for
+// `relay service logs --since` to work, and a service that does (slog's JSON
+// handler, say) gets pretty-printed from its fields.
+//
+// Reading goes straight to the files, like `relay audit`: the log is written
+// by the tray but readable without it. A read covers every rotated
+// generation, oldest first, and returns a cursor — the live file and the
+// offset reached in it — that a follower (the CLI's -f, the settings UI's
+// log pane) passes back to get only what was written since.
+
+// logStampLayout is the per-line timestamp relay writes. Fixed width, so a
+// reader can tell a stamp from a line that happens to start with a date.
+const logStampLayout = "2006-01-02T15:04:05.000Z"
+
+// stampWriter prefixes each line written through it with the current time.
+// Stamps go on when a line's first byte arrives, so a line written in pieces
+// gets one stamp. Safe for concurrent use, though exec.Cmd only ever writes
+// from one copy goroutine when Stdout and Stderr are the same writer.
+type stampWriter struct {
+	mu      sync.Mutex
+	w       io.WriteCloser
+	now     func() time.Time
+	midLine bool // the last write didn't end with a newline
+}
+
+func newStampWriter(w io.WriteCloser) *stampWriter {
+	return &stampWriter{w: w, now: time.Now}
+}
+
+func (s *stampWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var buf bytes.Buffer
+	buf.Grow(len(p) + len(logStampLayout) + 1)
+	for rest := p; len(rest) > 0; {
+		if !s.midLine {
+			buf.WriteString(s.now().UTC().Format(logStampLayout))
+			buf.WriteByte(' ')
+			s.midLine = true
+		}
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			buf.Write(rest)
+			break
+		}
+		buf.Write(rest[:i+1])
+		rest = rest[i+1:]
+		s.midLine = false
+	}
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close ends a final unterminated line, so the next run's first stamp
+// starts a line of its own, and closes the underlying writer.
+func (s *stampWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.midLine {
+		s.w.Write([]byte{'\n'})
+		s.midLine = false
+	}
+	return s.w.Close()
+}
+
+// serviceLogPath returns where a service's output is logged.
+func serviceLogPath(id string) (string, error) {
+	dir, err := serviceLogDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".log"), nil
+}
+
+// serviceLogLine is one parsed line of a service log.
+type serviceLogLine struct {
+	// Time is relay's stamp, or for a JSON line without one (written before
+	// relay stamped output) its own "time" field. A line with neither
+	// inherits the time of the line before it.
+	Time time.Time `json:"time,omitzero"`
+	// Text is the line as the service wrote it, without relay's stamp.
+	Text string `json:"text"`
+	// Level, Msg and Fields are set when Text is a JSON object, as slog's
+	// JSON handler writes.
+	Level  string         `json:"level,omitempty"`
+	Msg    string         `json:"msg,omitempty"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+// parseServiceLogLine splits off relay's stamp and decodes a JSON payload.
+func parseServiceLogLine(raw string) serviceLogLine {
+	var line serviceLogLine
+	line.Text = raw
+	if len(raw) > len(logStampLayout) && raw[len(logStampLayout)] == ' ' {
+		if t, err := time.Parse(logStampLayout, raw[:len(logStampLayout)]); err == nil {
+			line.Time, line.Text = t, raw[len(logStampLayout)+1:]
+		}
+	}
+	if !strings.HasPrefix(line.Text, "{") {
+		return line
+	}
+	var fields map[string]any
+	if json.Unmarshal([]byte(line.Text), &fields) != nil {
+		return line
+	}
+	line.Msg = takeString(fields, "msg", "message")
+	line.Level = strings.ToUpper(takeString(fields, "level", "severity"))
+	if ts := takeString(fields, "time", "ts", "timestamp"); ts != "" && line.Time.IsZero() {
+		line.Time, _ = time.Parse(time.RFC3339Nano, ts)
+	}
+	if len(fields) > 0 {
+		line.Fields = fields
+	}
+	return line
+}
+
+// takeString removes and returns the first of keys present in m as a string.
+func takeString(m map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := m[k]; ok {
+			delete(m, k)
+			if s, ok := v.(string); ok {
+				return s
+			}
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+// pretty renders a JSON line as "LEVEL msg key=value ...", keys sorted; any
+// other line is returned as written.
+func (l serviceLogLine) pretty() string {
+	if l.Msg == "" && l.Level == "" && l.Fields == nil {
+		return l.Text
+	}
+	var b strings.Builder
+	if l.Level != "" {
+		fmt.Fprintf(&b, "%-5s ", l.Level)
+	}
+	b.WriteString(l.Msg)
+	keys := make([]string, 0, len(l.Fields))
+	for k := range l.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := l.Fields[k]
+		var s string
+		if str, ok := v.(string); ok {
+			s = str
+			if strings.ContainsAny(s, " \t\"=") || s == "" {
+				s = fmt.Sprintf("%q", s)
+			}
+		} else {
+			raw, _ := json.Marshal(v)
+			s = string(raw)
+		}
+		fmt.Fprintf(&b, " %s=%s", k, s)
+	}
+	return b.String()
+}
+
+// serviceLogQuery filters a read. Zero values match everything.
+type serviceLogQuery struct {
+	Since time.Time // drop lines stamped before this
+	Grep  string    // case-insensitive substring of the line
+	Tail  int       // keep only the last Tail matches (0 = all)
+}
+
+func (q serviceLogQuery) matches(l *serviceLogLine) bool {
+	if !q.Since.IsZero() && l.Time.Before(q.Since) {
+		return false
+	}
+	if q.Grep != "" && !strings.Contains(strings.ToLower(l.Text), strings.ToLower(q.Grep)) {
+		return false
+	}
+	return true
+}
+
+// logGenerations lists path's rotated backups and path itself, oldest first.
+func logGenerations(path string) []string {
+	var backups []string
+	for i := 1; ; i++ {
+		p := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		backups = append(backups, p)
+	}
+	out := make([]string, 0, len(backups)+1)
+	for i := len(backups) - 1; i >= 0; i-- {
+		out = append(out, backups[i])
+	}
+	return append(out, path)
+}
+
+// serviceLogCursor is where a read of a log left off: the live file, by
+// its identity (logFileID), and the offset reached in it. Opaque to the
+// settings UI, which hands it back on its next read.
+type serviceLogCursor struct {
+	Offset int64  `json:"offset"`
+	File   uint64 `json:"file,omitempty"`
+}
+
+// readServiceLog reads every generation of the log at path and returns the
+// lines matching q, oldest first, with the cursor for readServiceLogFrom.
+func readServiceLog(path string, q serviceLogQuery) ([]serviceLogLine, serviceLogCursor, error) {
+	gens := logGenerations(path)
+	var lines []serviceLogLine
+	var prev time.Time
+	var cursor serviceLogCursor
+	for i, p := range gens {
+		live := i == len(gens)-1
+		end, err := scanLogFile(p, 0, live, &prev, func(l serviceLogLine) {
+			if q.matches(&l) {
+				lines = append(lines, l)
+			}
+		})
+		if err != nil && !(live && os.IsNotExist(err)) {
+			return nil, serviceLogCursor{}, err
+		}
+		cursor = end
+	}
+	if q.Tail > 0 && len(lines) > q.Tail {
+		lines = lines[len(lines)-q.Tail:]
+	}
+	return lines, cursor, nil
+}
+
+// readServiceLogFrom returns the lines written since cursor (from an earlier
+// read) that match q, and the new cursor. If the live file is no longer the
+// one cursor was in, or is shorter than its offset, the log has rotated:
+// the rest of the old file is read from its backup, then the new file from
+// the start. q.Tail is ignored.
+func readServiceLogFrom(path string, cursor serviceLogCursor, q serviceLogQuery) ([]serviceLogLine, serviceLogCursor, error) {
+	var lines []serviceLogLine
+	var prev time.Time
+	collect := func(l serviceLogLine) {
+		if q.matches(&l) {
+			lines = append(lines, l)
+		}
+	}
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, serviceLogCursor{}, nil
+	case err != nil:
+		return nil, cursor, err
+	case info.Size() < cursor.Offset || (cursor.File != 0 && logFileID(info) != cursor.File):
+		// A size check alone misses a new file that has already grown past
+		// the old offset; the tail would pick it up mid-way.
+		if _, err := scanLogFile(path+".1", cursor.Offset, false, &prev, collect); err != nil && !os.IsNotExist(err) {
+			return nil, cursor, err
+		}
+		cursor = serviceLogCursor{}
+	}
+	end, err := scanLogFile(path, cursor.Offset, true, &prev, collect)
+	if err != nil {
+		return nil, cursor, err
+	}
+	return lines, end, nil
+}
+
+// scanLogFile parses the file at path from offset, calling fn per line, and
+// returns the cursor after the last line consumed. For the live file a
+// trailing line without its newline is left for the next read, since the
+// service may still be writing it. prev carries the last seen time across
+// calls, for lines without one.
+func scanLogFile(path string, offset int64, live bool, prev *time.Time, fn func(serviceLogLine)) (serviceLogCursor, error) {
+	cursor := serviceLogCursor{Offset: offset}
+	f, err := os.Open(path)
+	if err != nil {
+		return cursor, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		cursor.File = logFileID(info)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return cursor, err
+	}
+	r := bufio.NewReaderSize(f, 64*1024)
+	for {
+		raw, err := r.ReadString('\n')
+		if err != nil && (live || raw == "") {
+			// EOF: a partial live line stays unread.
+			if err == io.EOF {
+				return cursor, nil
+			}
+			return cursor, err
+		}
+		cursor.Offset += int64(len(raw))
+		line := parseServiceLogLine(strings.TrimRight(raw, "\r\n"))
+		if line.Time.IsZero() {
+			line.Time = *prev
+		}
+		*prev = line.Time
+		fn(line)
+		if err != nil {
+			return cursor, nil
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nopWriteCloser lets a bytes.Buffer stand in for the log file.
+type nopWriteCloser struct{ *bytes.Buffer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestStampWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newStampWriter(nopWriteCloser{&buf})
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { clock = clock.Add(time.Second); return clock }
+
+	// A line written in pieces gets one stamp, taken when it began.
+	w.Write([]byte("hel"))
+	w.Write([]byte("lo\nwor"))
+	w.Write([]byte("ld\n\n"))
+	w.Write([]byte("partial"))
+	w.Close()
+
+	want := "2026-03-01T12:00:01.000Z hello\n" +
+		"2026-03-01T12:00:02.000Z world\n" +
+		"2026-03-01T12:00:03.000Z \n" +
+		"2026-03-01T12:00:04.000Z partial\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("stamped output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseServiceLogLine(t *testing.T) {
+	stamp := time.Date(2026, 3, 1, 12, 0, 0, 250e6, time.UTC)
+
+	l := parseServiceLogLine("2026-03-01T12:00:00.250Z plain text")
+	if !l.Time.Equal(stamp) || l.Text != "plain text" || l.pretty() != "plain text" {
+		t.Errorf("plain line = %+v", l)
+	}
+
+	l = parseServiceLogLine(`2026-03-01T12:00:00.250Z {"time":"2020-01-01T00:00:00Z","level":"warn","msg":"slow query","ms":1500,"table":"users","sql":"select *"}`)
+	if !l.Time.Equal(stamp) {
+		t.Errorf("relay's stamp should win over the payload's time, got %v", l.Time)
+	}
+	if got, want := l.pretty(), `WARN  slow query ms=1500 sql="select *" table=users`; got != want {
+		t.Errorf("pretty = %q, want %q", got, want)
+	}
+
+	// Written before relay stamped output: the payload's own time is used.
+	l = parseServiceLogLine(`{"ts":"2020-01-01T00:00:00Z","severity":"info","message":"up"}`)
+	if !l.Time.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) || l.pretty() != "INFO  up" {
+		t.Errorf("unstamped JSON line = %+v (%q)", l, l.pretty())
+	}
+
+	// A line that merely starts with a date or a brace is left alone.
+	for _, raw := range []string{"2026-03-01 backup done", "{not json"} {
+		if l := parseServiceLogLine(raw); !l.Time.IsZero() || l.Text != raw || l.pretty() != raw {
+			t.Errorf("%q parsed as %+v", raw, l)
+		}
+	}
+}
+
+func TestServiceLogQuery(t *testing.T) {
+	cut := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	q := serviceLogQuery{Since: cut, Grep: "ERROR"}
+	for _, tc := range []struct {
+		line serviceLogLine
+		want bool
+	}{
+		{serviceLogLine{Time: cut.Add(time.Second), Text: "an error here"}, true},
+		{serviceLogLine{Time: cut.Add(-time.Second), Text: "an error here"}, false},
+		{serviceLogLine{Time: cut.Add(time.Second), Text: "all fine"}, false},
+	} {
+		if got := q.matches(&tc.line); got != tc.want {
+			t.Errorf("matches(%+v) = %v", tc.line, got)
+		}
+	}
+}
+
+// writeLog writes stamped lines, one second apart from base, to path.
+func writeLog(t *testing.T, path string, base time.Time, lines ...string) {
+	t.Helper()
+	var b strings.Builder
+	for i, l := range lines {
+		b.WriteString(base.Add(time.Duration(i)*time.Second).Format(logStampLayout) + " " + l + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func texts(lines []serviceLogLine) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = l.Text
+	}
+	return out
+}
+
+func TestReadServiceLog_AcrossGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.log")
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeLog(t, path+".2", base, "one", "two")
+	writeLog(t, path+".1", base.Add(time.Minute), "three")
+	writeLog(t, path, base.Add(2*time.Minute), "four", "five")
+
+	lines, cursor, err := readServiceLog(path, serviceLogQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(texts(lines), ","); got != "one,two,three,four,five" {
+		t.Fatalf("lines = %s", got)
+	}
+	if info, _ := os.Stat(path); cursor.Offset != info.Size() || cursor.File != logFileID(info) {
+		t.Errorf("cursor = %+v, want end of live file (%d)", cursor, info.Size())
+	}
+
+	lines, _, _ = readServiceLog(path, serviceLogQuery{Since: base.Add(time.Minute), Tail: 2})
+	if got := strings.Join(texts(lines), ","); got != "four,five" {
+		t.Errorf("since+tail lines = %s", got)
+	}
+
+	// No log yet (service never started) is empty, not an error.
+	if lines, _, err := readServiceLog(filepath.Join(t.TempDir(), "none.log"), serviceLogQuery{}); err != nil || len(lines) != 0 {
+		t.Errorf("missing log = %v, %v", lines, err)
+	}
+}
+
+func TestReadServiceLogFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.log")
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeLog(t, path, base, "one")
+	_, cursor, _ := readServiceLog(path, serviceLogQuery{})
+
+	// An unterminated line is still being written: hold it back.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(base.Add(time.Second).Format(logStampLayout) + " two\n" + base.Add(2*time.Second).Format(logStampLayout) + " thr")
+	f.Close()
+	lines, cursor, err := readServiceLogFrom(path, cursor, serviceLogQuery{})
+	if err != nil || strings.Join(texts(lines), ",") != "two" {
+		t.Fatalf("follow read = %v, %v", texts(lines), err)
+	}
+
+	// The log rotates: the rest of the old file is in .1, new output in path.
+	f, _ = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("ee\n")
+	f.Close()
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeLog(t, path, base.Add(time.Minute), "four")
+	lines, _, err = readServiceLogFrom(path, cursor, serviceLogQuery{Grep: "o"})
+	if err != nil || strings.Join(texts(lines), ",") != "four" {
+		t.Fatalf("grep after rotation = %v, %v", texts(lines), err)
+	}
+	lines, _, _ = readServiceLogFrom(path, cursor, serviceLogQuery{})
+	if got := strings.Join(texts(lines), ","); got != "three,four" {
+		t.Fatalf("after rotation = %s", got)
+	}
+}
+
+// A new live file that has already grown past the old offset by the next
+// poll is still read from its start.
+func TestReadServiceLogFrom_RotatedFileLongerThanCursor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.log")
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeLog(t, path, base, "one")
+	_, cursor, _ := readServiceLog(path, serviceLogQuery{})
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeLog(t, path, base.Add(time.Minute), "two", "three", "four")
+	lines, cursor, err := readServiceLogFrom(path, cursor, serviceLogQuery{})
+	if err != nil || strings.Join(texts(lines), ",") != "two,three,four" {
+		t.Fatalf("after rotation = %v, %v", texts(lines), err)
+	}
+	if info, _ := os.Stat(path); cursor.Offset != info.Size() || cursor.File != logFileID(info) {
+		t.Errorf("cursor = %+v, want the end of the new file", cursor)
+	}
+}
+
+func TestParseLogSince(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got, err := parseLogSince("10m", now); err != nil || !got.Equal(now.Add(-10*time.Minute)) {
+		t.Errorf("10m = %v, %v", got, err)
+	}
+	if got, err := parseLogSince("2026-02-28T09:00:00Z", now); err != nil || !got.Equal(time.Date(2026, 2, 28, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("RFC 3339 = %v, %v", got, err)
+	}
+	for _, bad := range []string{"-5m", "yesterday"} {
+		if _, err := parseLogSince(bad, now); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestPrintServiceLogLines(t *testing.T) {
+	lines := []serviceLogLine{
+		parseServiceLogLine(`2026-03-01T12:00:00.000Z {"level":"error","msg":"boom","code":7}`),
+		{Text: "no time"},
+	}
+	var text bytes.Buffer
+	printServiceLogLines(&text, lines, false)
+	out := strings.Split(strings.TrimSpace(text.String()), "\n")
+	if len(out) != 2 || !strings.HasSuffix(out[0], "  ERROR boom code=7") || out[1] != "-  no time" {
+		t.Errorf("text output:\n%s", text.String())
+	}
+
+	var js bytes.Buffer
+	printServiceLogLines(&js, lines, true)
+	if got := strings.Split(strings.TrimSpace(js.String()), "\n"); len(got) != 2 ||
+		!strings.Contains(got[0], `"level":"ERROR"`) || !strings.Contains(got[0], `"fields":{"code":7}`) ||
+		got[1] != `{"text":"no time"}` {
+		t.Errorf("json output:\n%s", js.String())
+	}
+}
+
+// A running service's output reaches its log stamped, ready for `relay
+// service logs`.
+func TestServiceRegistry_StampsServiceOutput(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	cfg := &ServiceConfig{ID: "svc-chatty", DisplayName: "Chatty", Command: "/bin/sh",
+		Args: []string{"-c", `echo starting; echo '{"level":"info","msg":"ready","port":8080}'; echo oops >&2; sleep 30`}}
+	if err := reg.Start(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(reg.StopAll)
+
+	path, err := serviceLogPath(cfg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []serviceLogLine
+	waitFor(t, 5*time.Second, "three log lines", func() bool {
+		lines, _, _ = readServiceLog(path, serviceLogQuery{})
+		return len(lines) >= 3
+	})
+	start := time.Now().Add(-time.Minute)
+	for _, l := range lines {
+		if l.Time.Before(start) {
+			t.Errorf("line %q not stamped (time %v)", l.Text, l.Time)
+		}
+	}
+	if got := lines[1].pretty(); got != "INFO  ready port=8080" {
+		t.Errorf("JSON line pretty = %q", got)
+	}
+	if lines[2].Text != "oops" {
+		t.Errorf("stderr line = %q", lines[2].Text)
+	}
+}
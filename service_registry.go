@@ -8,7 +8,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"sync"
+	"time"
 
 	"relaygo/bridge"
 )
@@ -37,12 +39,54 @@ type serviceProcess struct {
 	logFile   *rotatingWriter
 	done      chan struct{} // closed when cmd.Wait() returns
 	tokenHash string        // in-memory service token hash (empty if none)
+	limits    *childLimits  // resource-limit enforcement (nil if unlimited)
+	started   time.Time     // when the process was spawned
+	// stopping is set (under ServiceRegistry.mu) by Stop and StopAll before
+	// they kill the process, so the reaper knows the exit was asked for and
+	// must not trigger a restart.
+	stopping bool
+	// health tracks probe results for a service with a health check (nil
+	// otherwise); see service_health.go.
+	health *healthMonitor
+	// unhealthy is set (under ServiceRegistry.mu) when the health monitor
+	// kills the process for failing its checks, so the exit says why.
+	unhealthy bool
+	// exited is set (under ServiceRegistry.mu) by the reaper, so a health
+	// probe finishing after the exit doesn't publish a stale state.
+	exited bool
+	// stop is how to shut the process down; see service_stop.go.
+	stop stopPlan
+	// escalated is set (under ServiceRegistry.mu) when stopping it took a
+	// SIGKILL after the stop timeout, so the exit says so.
+	escalated bool
+	// jobTrigger is set for a job run to what started it, so the reaper
+	// records the run in the job's history; see service_jobs.go.
+	jobTrigger string
+	// jobEnd is set (under ServiceRegistry.mu) when the registry ends a job
+	// run itself — a timeout, or overlap "kill" — and is the exit status.
+	jobEnd string
 }
 
 // ServiceRegistry manages background service child processes.
 type ServiceRegistry struct {
 	mu        sync.Mutex
 	processes map[string]*serviceProcess
+	// exits records how each service's most recent process ended, so a
+	// stopped service can say why (a memory-limit kill vs. a crash vs. a
+	// clean stop). Kept after the process entry is reaped.
+	exits map[string]childExit
+	// restarts holds each service's restart policy state and history; see
+	// service_restart.go.
+	restarts map[string]*restartState
+	// jobs holds each job's schedule and run history; see service_jobs.go.
+	jobs map[string]*jobState
+	// sockets holds the listeners relay binds for socket-activated
+	// services; see service_sockets.go.
+	sockets map[string]*socketSet
+	// quit is closed by StopAll so dependents still waiting to start give
+	// up; see service_deps.go.
+	quit     chan struct{}
+	quitOnce sync.Once
 
 	// TokenStore holds ephemeral in-memory tokens for managed services.
 	// Set during initialization, before any services are started.
@@ -65,12 +109,31 @@ type ServiceRegistry struct {
 	// Enables event-driven UI updates (e.g., tray menu status dots)
 	// without polling for process state changes.
 	OnProcessExit func()
+
+	// EnvProfiles returns the settings' env profiles, which services may
+	// layer into their environment (service_env.go). Set once during
+	// initialization like OnProcessExit; nil means there are none.
+	EnvProfiles func() map[string]map[string]string
+
+	// OnHealthChange is called from a service's health monitor goroutine
+	// when its readiness changes (service_health.go). Same init-once rule
+	// as OnProcessExit.
+	OnHealthChange func()
+
+	// Events is the bus service exits are published on (event_bus.go). Same
+	// init-once rule as OnProcessExit; nil publishes nothing.
+	Events *EventBus
 }
 
 // NewServiceRegistry creates an empty registry.
 func NewServiceRegistry() *ServiceRegistry {
 	return &ServiceRegistry{
 		processes: make(map[string]*serviceProcess),
+		exits:     make(map[string]childExit),
+		restarts:  make(map[string]*restartState),
+		jobs:      make(map[string]*jobState),
+		sockets:   make(map[string]*socketSet),
+		quit:      make(chan struct{}),
 	}
 }
 
@@ -83,7 +146,12 @@ func serviceLogDir() (string, error) {
 }
 
 // Start spawns a service through the platform shell so the user's profile is available.
-// Stdout and stderr go to a log file.
+// Stdout and stderr go to a log file. Starting a service clears any pending
+// automatic restart or crash-loop verdict; config becomes the one future
+// restarts use. Starting a job arms its schedule instead (service_jobs.go);
+// starting a socket-activated service binds its listeners first, and for an
+// on-demand one stops there until a connection arrives (service_sockets.go).
+// A service with replicas starts them all (service_replicas.go).
 func (r *ServiceRegistry) Start(config *ServiceConfig) error {
 	if err := config.Validate(); err != nil {
 		return fmt.Errorf("invalid service config: %w", err)
@@ -92,11 +160,46 @@ func (r *ServiceRegistry) Start(config *ServiceConfig) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	r.resetRestartLocked(config)
+	if config.isJob() {
+		return r.startJobLocked(config)
+	}
+	if !r.isRunningLocked(config.ID) {
+		ss, err := r.socketsLocked(config)
+		if err != nil {
+			return fmt.Errorf("start '%s': %w", config.DisplayName, err)
+		}
+		if ss != nil && ss.spec.OnDemand {
+			r.armSocketsLocked(config.ID, ss)
+			return nil
+		}
+		if ss != nil {
+			r.disarmSocketsLocked(ss)
+		}
+	}
+	if err := r.startLocked(config); err != nil {
+		return err
+	}
+	return r.startReplicasLocked(config)
+}
+
+// startLocked is Start without the validation and restart reset, shared
+// with automatic restarts. It starts one process: for a replicated service,
+// config is one replica's (ServiceConfig.replicaConfig). Caller holds r.mu.
+func (r *ServiceRegistry) startLocked(config *ServiceConfig) error {
 	if r.isRunningLocked(config.ID) {
 		return nil
 	}
+	logicalID, replica := splitInstanceID(config.ID)
 
-	cmd := buildCommand(config)
+	env, err := r.serviceEnv(config)
+	if err != nil {
+		return fmt.Errorf("start '%s': %w", config.DisplayName, err)
+	}
+	cmd, err := buildCommand(config, env)
+	if err != nil {
+		return fmt.Errorf("start '%s': %w", config.DisplayName, err)
+	}
 
 	// Generate an ephemeral service token and inject Relay MCP env vars.
 	var tokenHash string
@@ -106,7 +209,7 @@ func (r *ServiceRegistry) Start(config *ServiceConfig) error {
 			return fmt.Errorf("generate service token for %q: %w", config.ID, err)
 		}
 		tokenHash = hashToken(rawToken)
-		r.TokenStore.Register(tokenHash)
+		r.TokenStore.RegisterFor(tokenHash, config.ID)
 
 		relayBin, _ := os.Executable()
 		relayBin, _ = filepath.EvalSymlinks(relayBin)
@@ -136,22 +239,40 @@ func (r *ServiceRegistry) Start(config *ServiceConfig) error {
 	}
 	mergeEnv(cmd, map[string]string{
 		EnvBridgeSocket: bridge.SocketPath(),
-		EnvServiceID:    config.ID,
+		EnvServiceID:    logicalID,
 	})
+	if config.replicaCount() > 1 {
+		mergeEnv(cmd, map[string]string{bridge.EnvServiceReplica: strconv.Itoa(replica)})
+	}
+	if ss := r.sockets[config.ID]; ss != nil && config.Sockets != nil {
+		ss.pass(cmd)
+	}
 
-	// Clean up the service token on any error path before the process starts.
+	// Clean up the service token and limits on any error path before the
+	// process starts.
+	var limits *childLimits
 	committed := false
 	defer func() {
-		if !committed && tokenHash != "" {
-			r.TokenStore.Remove(tokenHash)
+		if !committed {
+			if tokenHash != "" {
+				r.TokenStore.Remove(tokenHash)
+			}
+			limits.started()
+			limits.finish()
 		}
 	}()
 
-	logDir, err := serviceLogDir()
+	// Limits go on last: they may wrap cmd in the rlimit helper, which has
+	// to carry the final command line.
+	limits, err = applyResourceLimits(cmd, config.Limits, "service-"+config.ID)
+	if err != nil {
+		return fmt.Errorf("resource limits for '%s': %w", config.DisplayName, err)
+	}
+
+	logPath, err := serviceLogPath(config.ID)
 	if err != nil {
 		return err
 	}
-	logPath := filepath.Join(logDir, config.ID+".log")
 	// Size-capped rotating log: assigning an io.Writer (not *os.File) makes Go
 	// pump the child's merged stdout+stderr through one copy goroutine, which
 	// cmd.Wait awaits before the reaper closes the writer below.
@@ -160,14 +281,18 @@ func (r *ServiceRegistry) Start(config *ServiceConfig) error {
 		return fmt.Errorf("failed to create log file: %w", err)
 	}
 
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
+	// Each line is stamped with the time relay received it; see
+	// service_logs.go.
+	stamped := newStampWriter(logFile)
+	cmd.Stdout = stamped
+	cmd.Stderr = stamped
 
 	if err := cmd.Start(); err != nil {
-		logFile.Close()
+		stamped.Close()
 		return fmt.Errorf("failed to start '%s': %w", config.DisplayName, err)
 	}
 	committed = true
+	limits.started()
 
 	// Record the process group leader so a future tray session can reclaim
 	// this child if we are SIGKILLed before the reaper runs. Best-effort —
@@ -181,21 +306,43 @@ func (r *ServiceRegistry) Start(config *ServiceConfig) error {
 		logFile:   logFile,
 		done:      make(chan struct{}),
 		tokenHash: tokenHash,
+		limits:    limits,
+		started:   time.Now(),
+		stop:      newStopPlan(config),
+	}
+	if config.Health != nil {
+		proc.health = newHealthMonitor()
+		r.publishHealthLocked(config.ID, proc, HealthStarting)
+		go r.monitorHealth(proc, *config, env)
 	}
 
 	// Reap the process in the background so ProcessState is populated
 	// and we can detect exit via the done channel. Defers run LIFO:
-	// logFile.Close → close(done) → OnProcessExit, ensuring the done
-	// channel is closed before the exit callback reads process state.
+	// stamped.Close → close(done) → OnProcessExit → armRestart (or a
+	// queued job run), ensuring the done channel is closed before the exit
+	// callback reads process state, and the old process is fully cleaned up
+	// before a restart.
 	serviceID := config.ID
 	go func() {
+		var restart, runQueued bool
+		defer func() {
+			if restart {
+				r.armRestart(serviceID)
+			}
+			if runQueued {
+				r.runQueuedJob(serviceID)
+			}
+			if !restart && !runQueued {
+				r.afterSocketServiceExit(serviceID, proc)
+			}
+		}()
 		defer func() {
 			if r.OnProcessExit != nil {
 				r.OnProcessExit()
 			}
 		}()
 		defer close(proc.done)
-		defer logFile.Close()
+		defer stamped.Close()
 		// Pidfile removal pairs with writePidFile above; on clean exit we
 		// leave nothing for the next session to reclaim.
 		defer removePidFile(serviceID)
@@ -209,7 +356,36 @@ func (r *ServiceRegistry) Start(config *ServiceConfig) error {
 		if r.Enhanced != nil {
 			defer r.Enhanced.Forget(serviceID)
 		}
-		if err := cmd.Wait(); err != nil {
+		err := cmd.Wait()
+		exit := describeExit(err, proc.limits.finish())
+		r.mu.Lock()
+		switch {
+		case proc.unhealthy:
+			exit.Status = "killed: unhealthy (" + proc.health.status().LastError + ")"
+		case proc.jobEnd != "":
+			exit.Status = proc.jobEnd
+		case proc.escalated:
+			exit.Status = proc.stop.escalatedStatus()
+		}
+		proc.exited = true
+		if proc.health != nil {
+			r.publishHealthLocked(serviceID, proc, "")
+		}
+		r.exits[serviceID] = exit
+		restart = r.planRestartLocked(serviceID, proc, err, exit)
+		runQueued = r.recordJobRunLocked(serviceID, proc, exit)
+		r.mu.Unlock()
+		service, _ := splitInstanceID(serviceID)
+		r.Events.Publish(EventServiceExited, eventSourceRelay, "", serviceEventData{
+			Service:  service,
+			Instance: serviceID,
+			Status:   exit.Status,
+			Limit:    exit.Limit,
+		})
+		switch {
+		case exit.Limit != "":
+			slog.Warn("service killed by resource limit", "id", serviceID, "limit", exit.Limit, "status", exit.Status)
+		case err != nil:
 			slog.Warn("service exited with error", "id", serviceID, "error", err)
 		}
 	}()
@@ -241,17 +417,35 @@ func generateRandomHex(n int) (string, error) {
 	return hex.EncodeToString(b), nil
 }
 
-// Stop kills a service process and waits for it to exit.
-// The process remains in the map while stopping so IsRunning returns true,
-// preventing duplicate spawns from concurrent Start calls.
+// Stop shuts a service down gracefully (see service_stop.go) and waits for it
+// to exit. The process remains in the map while stopping so IsRunning returns
+// true, preventing duplicate spawns from concurrent Start calls. A job's
+// schedule is disarmed, and a run in progress stopped. A socket-activated
+// service's listeners are closed. Every replica is stopped.
 func (r *ServiceRegistry) Stop(id string) {
+	r.stopInstances(id, false)
+}
+
+// stop is Stop for one process (id may be a replica's instance ID);
+// keepSockets leaves a socket-activated service's listeners
+// bound (only disarming an on-demand wait), for a Start that follows.
+func (r *ServiceRegistry) stop(id string, keepSockets bool) {
 	r.mu.Lock()
+	r.cancelRestartLocked(id)
+	r.disarmJobLocked(id)
+	if ss := r.sockets[id]; ss != nil && keepSockets {
+		r.disarmSocketsLocked(ss)
+	} else {
+		r.closeSocketsLocked(id)
+	}
 	proc, ok := r.processes[id]
+	if ok {
+		proc.stopping = true
+	}
 	r.mu.Unlock()
 
 	if ok {
-		killProcessGroup(proc.cmd)
-		<-proc.done
+		r.stopProcess(id, proc)
 
 		r.mu.Lock()
 		// Only delete if this is still the same process (not replaced by a new Start).
@@ -263,17 +457,32 @@ func (r *ServiceRegistry) Stop(id string) {
 }
 
 // Reload restarts a service with new config. Stops the service if running,
-// then starts it. Stop is a no-op for non-running services.
+// then starts it. Stop is a no-op for non-running services. A
+// socket-activated service keeps its listeners across the reload (unless the
+// new config changes them), so connections made meanwhile wait in the
+// backlog for the new process. A running service with replicas is replaced
+// one replica at a time, so it keeps serving throughout.
 func (r *ServiceRegistry) Reload(id string, cfg *ServiceConfig) error {
-	r.Stop(id)
-	return r.Start(cfg)
+	if r.rollingReloadWanted(id, cfg) {
+		return r.rollingReload(id, cfg)
+	}
+	r.stopInstances(id, true)
+	if err := r.Start(cfg); err != nil {
+		r.mu.Lock()
+		r.closeSocketsLocked(id)
+		r.mu.Unlock()
+		return err
+	}
+	return nil
 }
 
-// IsRunning checks whether a service process is still alive.
+// IsRunning checks whether a service process (any replica's) is still
+// alive, a job's schedule is armed, or an on-demand service is waiting for
+// a connection.
 func (r *ServiceRegistry) IsRunning(id string) bool {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	return r.isRunningLocked(id)
+	return r.replicasRunningLocked(id) > 0 || r.jobArmedLocked(id) || r.socketsArmedLocked(id)
 }
 
 // isRunningLocked checks whether a process is still alive. If the process has
@@ -307,96 +516,88 @@ func (r *ServiceRegistry) isRunningLocked(id string) bool {
 func (r *ServiceRegistry) ReclaimOrphans(configs []ServiceConfig) {
 	for i := range configs {
 		cfg := &configs[i]
-		pid, err := readPidFile(cfg.ID)
-		if err != nil {
-			slog.Warn("read pidfile failed", "id", cfg.ID, "error", err)
-			continue
-		}
-		if pid == 0 {
-			continue
-		}
-		if reclaimOrphan(pid, cfg.Command) {
-			slog.Warn("reclaimed orphan service from previous session",
-				"id", cfg.ID, "pid", pid)
-		}
-		removePidFile(cfg.ID)
-	}
-}
-
-// StartAllAutostart starts all services with autostart enabled.
-func (r *ServiceRegistry) StartAllAutostart(configs []ServiceConfig) {
-	for i := range configs {
-		if configs[i].Autostart {
-			if err := r.Start(&configs[i]); err != nil {
-				slog.Error("service autostart failed", "error", err)
+		for n := range cfg.replicaCount() {
+			key := instanceID(cfg.ID, n)
+			pid, err := readPidFile(key)
+			if err != nil {
+				slog.Warn("read pidfile failed", "id", key, "error", err)
+				continue
 			}
+			if pid == 0 {
+				continue
+			}
+			if reclaimOrphan(pid, cfg.Command) {
+				slog.Warn("reclaimed orphan service from previous session",
+					"id", key, "pid", pid)
+			}
+			removePidFile(key)
 		}
 	}
 }
 
-// StopAll kills all running service processes concurrently to avoid one
-// slow-to-stop service blocking the shutdown of others.
-func (r *ServiceRegistry) StopAll() {
-	r.mu.Lock()
-	procs := make(map[string]*serviceProcess, len(r.processes))
-	for id, proc := range r.processes {
-		procs[id] = proc
-	}
-	r.mu.Unlock()
-
-	var wg sync.WaitGroup
-	for _, proc := range procs {
-		wg.Add(1)
-		go func(p *serviceProcess) {
-			defer wg.Done()
-			killProcessGroup(p.cmd)
-			<-p.done
-		}(proc)
-	}
-	wg.Wait()
-
-	// Clean up after all processes are dead.
-	r.mu.Lock()
-	for id, proc := range procs {
-		if r.processes[id] == proc {
-			delete(r.processes, id)
-		}
-	}
-	r.mu.Unlock()
-}
-
-// RunningIDs returns the IDs of all currently running services.
+// RunningIDs returns the IDs of all currently running services, of jobs
+// whose schedule is armed, and of on-demand services waiting for a
+// connection.
 func (r *ServiceRegistry) RunningIDs() []string {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	ids := make([]string, 0, len(r.processes))
-	for id := range r.processes {
-		if r.isRunningLocked(id) {
+	seen := make(map[string]bool, len(r.processes))
+	for key := range r.processes {
+		id, _ := splitInstanceID(key)
+		if r.isRunningLocked(key) && !r.jobArmedLocked(id) && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for id, js := range r.jobs {
+		if js.armed {
+			ids = append(ids, id)
+		}
+	}
+	for id, ss := range r.sockets {
+		if ss.armed && !r.isRunningLocked(id) {
 			ids = append(ids, id)
 		}
 	}
 	return ids
 }
 
-// PIDsByServiceID returns the OS PID of each currently-running service. Dead
-// entries are reaped (via isRunningLocked) and entries with no spawned Process
-// handle are skipped. Used by the tray menu to sample subtree memory.
+// PIDsByServiceID returns the OS PID of each currently-running service —
+// for one with replicas, of its lowest-numbered running replica. Dead
+// entries are reaped (via isRunningLocked) and entries with no spawned
+// Process handle are skipped. Used by the tray menu to sample subtree memory.
 func (r *ServiceRegistry) PIDsByServiceID() map[string]int {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	out := make(map[string]int, len(r.processes))
-	for id, proc := range r.processes {
-		if !r.isRunningLocked(id) {
+	lowest := make(map[string]int, len(r.processes))
+	for key, proc := range r.processes {
+		if !r.isRunningLocked(key) {
 			continue
 		}
 		if proc.cmd == nil || proc.cmd.Process == nil {
 			continue
 		}
+		id, n := splitInstanceID(key)
+		if l, ok := lowest[id]; ok && l < n {
+			continue
+		}
+		lowest[id] = n
 		out[id] = proc.cmd.Process.Pid
 	}
 	return out
 }
 
+// LastExit reports how the service's most recent process ended. ok is
+// false if it has never exited under this registry.
+func (r *ServiceRegistry) LastExit(id string) (exit childExit, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	exit, ok = r.exits[id]
+	return exit, ok
+}
+
 // CloseFrontendChannel unlinks the frontend Unix socket if one was
 // provisioned. Safe to call multiple times.
 func (r *ServiceRegistry) CloseFrontendChannel() {
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
 	"strconv"
@@ -21,33 +22,70 @@ func setProcessGroup(cmd *exec.Cmd) {
 // for graceful shutdown before falling back to SIGKILL.
 // Checks the process group (not just the shell PID) to avoid orphaning children.
 func killProcessGroup(cmd *exec.Cmd) {
+	signalProcessGroup(cmd, syscall.SIGTERM)
+	if !waitProcessGroup(cmd, time.Second) {
+		signalProcessGroup(cmd, syscall.SIGKILL)
+	}
+}
+
+// signalProcessGroup sends sig to the command's whole process group.
+func signalProcessGroup(cmd *exec.Cmd, sig syscall.Signal) {
 	if cmd.Process == nil {
 		return
 	}
-	pid := cmd.Process.Pid
-
-	// Try graceful shutdown first.
-	_ = syscall.Kill(-pid, syscall.SIGTERM)
+	_ = syscall.Kill(-cmd.Process.Pid, sig)
+}
 
-	// Poll for up to 1 second. Check the process group, not just the shell PID,
-	// to avoid returning early while children are still running.
-	deadline := time.Now().Add(1 * time.Second)
+// waitProcessGroup polls for up to timeout until the command's process group
+// is gone, and reports whether it went. The group, not just the shell PID,
+// so children still running don't count as stopped.
+func waitProcessGroup(cmd *exec.Cmd, timeout time.Duration) bool {
+	if cmd.Process == nil {
+		return true
+	}
+	pid := cmd.Process.Pid
+	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
 		if !processGroupAlive(pid) {
-			return
+			return true
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
+	return !processGroupAlive(pid)
+}
 
-	// Still alive -- force kill the entire group.
-	_ = syscall.Kill(-pid, syscall.SIGKILL)
+// stopSignals are the signals a service may name as its stop_signal. Names
+// are accepted with or without the SIG prefix, in any case.
+var stopSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"HUP":  syscall.SIGHUP,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// parseStopSignal resolves a stop_signal name; "" is SIGTERM.
+func parseStopSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	if sig, ok := stopSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+	return 0, fmt.Errorf("stop signal %q must be one of TERM, INT, QUIT, HUP, USR1 or USR2", name)
 }
 
 func shellQuote(s string) string {
 	return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
 }
 
-func buildCommand(config *ServiceConfig) *exec.Cmd {
+// buildCommand prepares the service's shell invocation with env, the
+// service's effective environment. The caller resolves it per spawn
+// (ServiceRegistry.serviceEnv), so a restart picks up a rotated secret, key
+// file or env file; an unresolvable one fails the start rather than
+// launching the service without its credential.
+func buildCommand(config *ServiceConfig, env map[string]string) (*exec.Cmd, error) {
 	shell := os.Getenv("SHELL")
 	if shell == "" {
 		shell = "/bin/sh"
@@ -57,14 +95,17 @@ func buildCommand(config *ServiceConfig) *exec.Cmd {
 	for _, arg := range config.Args {
 		fullCmd += " " + shellQuote(arg)
 	}
+	if config.Sockets != nil {
+		fullCmd = listenPIDPrefix + fullCmd
+	}
 
 	cmd := exec.Command(shell, "-l", "-c", fullCmd)
 	setProcessGroup(cmd)
 	if config.WorkingDir != "" {
 		cmd.Dir = config.WorkingDir
 	}
-	mergeEnv(cmd, config.Env)
-	return cmd
+	mergeEnv(cmd, env)
+	return cmd, nil
 }
 
 // processGroupAlive checks if the process group led by pid has any living members.
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Replicas.
+//
+// A service with `replicas: N` runs as N processes of the same command, so a
+// CPU-bound backend can use more than one core and a restart doesn't drop
+// every request at once. Each replica is a registry instance of its own:
+// replica 0 is kept under the service's ID, as a single-process service
+// always has been, and replica n under the instance ID "<id>#<n>" — '#' is
+// never part of a service ID, so the two can't collide. Everything the
+// registry tracks per process (restart policy state, health, pidfile, log
+// file, last exit) is tracked per replica, so each one restarts, is probed
+// and logs on its own; its log is <id>#<n>.log.
+//
+// Every replica gets the same RELAY_SERVICE_ID and registers its manifest
+// under it; RELAY_SERVICE_REPLICA tells it its index, for choosing its own
+// internal socket path. Relay files each registration under the right
+// replica by the service token it issued to that process, and the front
+// door's dispatcher balances new requests across the registered, ready
+// replicas (EnhancedServiceRegistry.LookupByPath).
+//
+// Reload replaces replicas one at a time: the dispatcher stops sending a
+// replica new requests, waits up to replicaDrainTimeout for those in flight
+// (WebSocket sessions included) to finish, stops it and starts its
+// replacement with the new config, then waits until the replacement is
+// ready — registered, if its predecessor was, and healthy, if it has a
+// health check — before moving to the next. A replacement that exits or
+// isn't ready within replicaReadyTimeout stops the rollout, leaving the
+// replicas not yet replaced running the old config.
+
+// maxReplicas caps a service's replicas.
+const maxReplicas = 16
+
+// instanceSep separates a service ID from a replica index in an instance
+// ID.
+const instanceSep = "#"
+
+// replicaDrainTimeout bounds how long a rolling reload waits for a
+// replica's in-flight requests, and replicaReadyTimeout for its
+// replacement to become ready. Vars so tests can shorten them.
+var (
+	replicaDrainTimeout = 30 * time.Second
+	replicaReadyTimeout = 30 * time.Second
+)
+
+// instanceID returns the registry key of one replica of service id.
+func instanceID(id string, replica int) string {
+	if replica == 0 {
+		return id
+	}
+	return id + instanceSep + strconv.Itoa(replica)
+}
+
+// splitInstanceID is the inverse of instanceID. A plain service ID is
+// replica 0.
+func splitInstanceID(key string) (id string, replica int) {
+	id, n, ok := strings.Cut(key, instanceSep)
+	if !ok {
+		return key, 0
+	}
+	replica, err := strconv.Atoi(n)
+	if err != nil {
+		return key, 0
+	}
+	return id, replica
+}
+
+// replicaCount returns how many processes the service runs as.
+func (c *ServiceConfig) replicaCount() int {
+	return max(c.Replicas, 1)
+}
+
+// validateReplicas checks Replicas. A job's are rejected by validateKind.
+func (c *ServiceConfig) validateReplicas() error {
+	if c.Replicas < 0 || c.Replicas > maxReplicas {
+		return fmt.Errorf("replicas must be between 1 and %d", maxReplicas)
+	}
+	if c.Replicas > 1 && c.Sockets != nil {
+		return fmt.Errorf("a service with replicas can't have sockets; relay would have to hand the same listeners to every replica")
+	}
+	return nil
+}
+
+// replicaConfig returns the config replica n is started with: c itself
+// under the replica's instance ID.
+func (c *ServiceConfig) replicaConfig(n int) ServiceConfig {
+	inst := *c
+	inst.ID = instanceID(c.ID, n)
+	return inst
+}
+
+// instancesLocked returns the instance IDs the registry has a process or
+// restart state for under service id, by replica, always including id
+// itself. Caller holds r.mu.
+func (r *ServiceRegistry) instancesLocked(id string) []string {
+	seen := map[string]bool{id: true}
+	keys := []string{id}
+	add := func(key string) {
+		if sid, n := splitInstanceID(key); sid == id && n > 0 && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for key := range r.processes {
+		add(key)
+	}
+	for key := range r.restarts {
+		add(key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		_, a := splitInstanceID(keys[i])
+		_, b := splitInstanceID(keys[j])
+		return a < b
+	})
+	return keys
+}
+
+// replicasRunningLocked counts the running replicas of service id. Caller
+// holds r.mu.
+func (r *ServiceRegistry) replicasRunningLocked(id string) int {
+	n := 0
+	for _, key := range r.instancesLocked(id) {
+		if r.isRunningLocked(key) {
+			n++
+		}
+	}
+	return n
+}
+
+// startReplicasLocked starts replicas 1 and up of cfg, whose replica 0
+// Start has just started, and stops any replicas beyond its count left
+// running from a config with more. Caller holds r.mu.
+func (r *ServiceRegistry) startReplicasLocked(cfg *ServiceConfig) error {
+	n := cfg.replicaCount()
+	for _, key := range r.instancesLocked(cfg.ID) {
+		if _, i := splitInstanceID(key); i >= n {
+			r.cancelRestartLocked(key)
+			if proc := r.processes[key]; proc != nil && !proc.stopping {
+				go r.stop(key, false)
+			}
+		}
+	}
+	for i := 1; i < n; i++ {
+		inst := cfg.replicaConfig(i)
+		r.resetRestartLocked(&inst)
+		if err := r.startLocked(&inst); err != nil {
+			return fmt.Errorf("replica %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// stopInstances is stop for every replica of service id, concurrently.
+func (r *ServiceRegistry) stopInstances(id string, keepSockets bool) {
+	r.mu.Lock()
+	keys := r.instancesLocked(id)
+	r.mu.Unlock()
+	if len(keys) == 1 {
+		r.stop(id, keepSockets)
+		return
+	}
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.stop(key, keepSockets)
+		}()
+	}
+	wg.Wait()
+}
+
+// rollingReloadWanted reports whether Reload should replace service id's
+// replicas one at a time: it is running, and runs (or will run) as more
+// than one process.
+func (r *ServiceRegistry) rollingReloadWanted(id string, cfg *ServiceConfig) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	running := r.replicasRunningLocked(id)
+	return running > 0 && (running > 1 || cfg.replicaCount() > 1)
+}
+
+// rollingReload replaces service id's replicas with cfg's one at a time;
+// see the top of this file.
+func (r *ServiceRegistry) rollingReload(id string, cfg *ServiceConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid service config: %w", err)
+	}
+	r.mu.Lock()
+	keys := r.instancesLocked(id)
+	r.mu.Unlock()
+	n := cfg.replicaCount()
+	_, last := splitInstanceID(keys[len(keys)-1])
+	last = max(last, n-1)
+
+	for i := 0; i <= last; i++ {
+		key := instanceID(id, i)
+		r.mu.Lock()
+		running := r.isRunningLocked(key)
+		r.mu.Unlock()
+		wasRegistered := r.Enhanced != nil && r.Enhanced.Get(key) != nil
+		if running && wasRegistered && !r.Enhanced.Drain(key, replicaDrainTimeout) {
+			slog.Warn("replica still had requests in flight after the drain timeout; stopping it",
+				"id", id, "replica", i, "timeout", replicaDrainTimeout)
+		}
+		r.stop(key, false)
+		if i >= n {
+			continue
+		}
+
+		inst := cfg.replicaConfig(i)
+		r.mu.Lock()
+		r.resetRestartLocked(&inst)
+		err := r.startLocked(&inst)
+		r.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("replica %d: %w", i, err)
+		}
+		if err := r.awaitReplica(&inst, i, wasRegistered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// awaitReplica waits for a replica a rolling reload just started to be
+// ready for requests: registered if register is set, and ready if it has a
+// health check. Fails if it exits, or isn't ready within
+// replicaReadyTimeout.
+func (r *ServiceRegistry) awaitReplica(inst *ServiceConfig, replica int, register bool) error {
+	id, _ := splitInstanceID(inst.ID)
+	deadline := time.Now().Add(replicaReadyTimeout)
+	for {
+		r.mu.Lock()
+		running := r.isRunningLocked(inst.ID)
+		r.mu.Unlock()
+		if !running {
+			return fmt.Errorf("replica %d of %q exited before it was ready; stopped the rolling restart", replica, id)
+		}
+		ready := r.Enhanced == nil ||
+			((!register || r.Enhanced.Get(inst.ID) != nil) &&
+				(inst.Health == nil || r.Enhanced.Health(inst.ID) == HealthReady))
+		if ready {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("replica %d of %q wasn't ready after %s; stopped the rolling restart", replica, id, replicaReadyTimeout)
+		}
+		time.Sleep(dependencyPollInterval)
+	}
+}
+
+// serviceReplicaStatus is one replica's process state for status
+// displays; the dispatcher's view of it comes from the enhanced registry.
+type serviceReplicaStatus struct {
+	Replica int
+	Running bool
+	PID     int
+	Health  ServiceHealth
+}
+
+// ReplicaStatus reports each replica of a service last started with more
+// than one. ok is false for any other service.
+func (r *ServiceRegistry) ReplicaStatus(id string) ([]serviceReplicaStatus, bool) {
+	r.mu.Lock()
+	st := r.restarts[id]
+	if st == nil || st.config.replicaCount() < 2 {
+		r.mu.Unlock()
+		return nil, false
+	}
+	out := make([]serviceReplicaStatus, st.config.replicaCount())
+	for i := range out {
+		key := instanceID(id, i)
+		out[i].Replica = i
+		if proc := r.processes[key]; r.isRunningLocked(key) && proc.cmd.Process != nil {
+			out[i].Running, out[i].PID = true, proc.cmd.Process.Pid
+		}
+	}
+	r.mu.Unlock()
+	for i := range out {
+		if hs, ok := r.Health(instanceID(id, i)); ok {
+			out[i].Health = hs.State
+		}
+	}
+	return out, true
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"relaygo/bridge"
+)
+
+func TestInstanceID(t *testing.T) {
+	for _, tc := range []struct {
+		id      string
+		replica int
+		key     string
+	}{
+		{"web", 0, "web"},
+		{"web", 3, "web#3"},
+	} {
+		if got := instanceID(tc.id, tc.replica); got != tc.key {
+			t.Errorf("instanceID(%q, %d) = %q", tc.id, tc.replica, got)
+		}
+		if id, n := splitInstanceID(tc.key); id != tc.id || n != tc.replica {
+			t.Errorf("splitInstanceID(%q) = %q, %d", tc.key, id, n)
+		}
+	}
+	if id, n := splitInstanceID("web#x"); id != "web#x" || n != 0 {
+		t.Errorf("malformed instance ID split as %q, %d", id, n)
+	}
+}
+
+func TestServiceConfig_ValidateReplicas(t *testing.T) {
+	base := ServiceConfig{ID: "web", DisplayName: "Web", Command: "/bin/true"}
+	for _, mod := range []func(*ServiceConfig){
+		func(c *ServiceConfig) { c.Replicas = -1 },
+		func(c *ServiceConfig) { c.Replicas = maxReplicas + 1 },
+		func(c *ServiceConfig) {
+			c.Replicas, c.Sockets = 2, &SocketActivation{Listeners: []SocketListener{{Address: "tcp:127.0.0.1:0"}}}
+		},
+		func(c *ServiceConfig) { c.Replicas, c.Kind = 2, KindJob },
+	} {
+		cfg := base
+		mod(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("config %+v validated", cfg)
+		}
+	}
+	ok := base
+	ok.Replicas = maxReplicas
+	if err := ok.Validate(); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+	if inst := ok.replicaConfig(2); inst.ID != "web#2" || inst.Command != ok.Command {
+		t.Errorf("replicaConfig = %+v", inst)
+	}
+}
+
+func TestEnhancedServiceRegistry_Replicas(t *testing.T) {
+	reg := NewEnhancedServiceRegistry(nil)
+	for n := range 3 {
+		if err := reg.RegisterReplica("api", n, "/tmp/api.sock", "tok", newManifest("/api/")); err != nil {
+			t.Fatalf("replica %d: %v", n, err)
+		}
+	}
+	if err := reg.RegisterManifest("other", "/tmp/o.sock", "tok", newManifest("/api/")); err == nil {
+		t.Error("another service registered a replicated service's route")
+	}
+	if all := reg.All(); len(all) != 1 || all[0].Replica != 0 {
+		t.Errorf("All = %v, want replica 0 only", all)
+	}
+	if got := len(reg.Replicas("api")); got != 3 {
+		t.Fatalf("Replicas = %d, want 3", got)
+	}
+
+	pick := func() int { return reg.LookupByPath("/api/x").Replica }
+	// Idle replicas take turns.
+	turns := map[int]bool{}
+	for range 3 {
+		turns[pick()] = true
+	}
+	if len(turns) != 3 {
+		t.Errorf("idle picks = %v, want every replica", turns)
+	}
+	r0, r1 := reg.Get("api"), reg.Get("api#1")
+	r0.acquire()
+	r1.acquire()
+	for range 3 {
+		if got := pick(); got != 2 {
+			t.Errorf("pick with 0 and 1 busy = %d, want 2", got)
+		}
+	}
+	reg.SetHealth("api#2", HealthStarting)
+	r1.acquire()
+	if got := pick(); got != 0 {
+		t.Errorf("pick with 2 not ready and 1 busier = %d, want 0", got)
+	}
+	r0.release()
+	r1.release()
+	r1.release()
+
+	if !reg.Drain("api", time.Second) || !r0.Draining() {
+		t.Fatal("idle replica did not drain")
+	}
+	for range 3 {
+		if got := pick(); got != 1 {
+			t.Errorf("pick with 0 draining and 2 not ready = %d, want 1", got)
+		}
+	}
+	if r0.acquire() {
+		t.Error("draining replica accepted a request")
+	}
+
+	// A drain waits for requests in flight, up to its timeout.
+	prev := drainPollInterval
+	drainPollInterval = 5 * time.Millisecond
+	t.Cleanup(func() { drainPollInterval = prev })
+	r1.acquire()
+	if reg.Drain("api#1", 30*time.Millisecond) {
+		t.Error("drain with a request in flight reported done")
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		r1.release()
+	}()
+	if !reg.Drain("api#1", 5*time.Second) {
+		t.Error("drain didn't see the request finish")
+	}
+
+	// Re-registering clears the drain and keeps the count.
+	r0.load.inflight.Add(1)
+	if err := reg.RegisterReplica("api", 0, "/tmp/api2.sock", "tok", newManifest("/api/")); err != nil {
+		t.Fatal(err)
+	}
+	if rec := reg.Get("api"); rec.Draining() || rec.InFlight() != 1 {
+		t.Errorf("re-registered replica: draining %v, in flight %d", rec.Draining(), rec.InFlight())
+	}
+
+	reg.Forget("api#1")
+	reg.Forget("api#2")
+	if got := len(reg.Replicas("api")); got != 1 {
+		t.Errorf("after Forget: %d replicas", got)
+	}
+}
+
+// TestFrontendDispatcher_BalancesReplicas sends concurrent slow requests
+// through the dispatcher and checks they are spread across both replicas.
+func TestFrontendDispatcher_BalancesReplicas(t *testing.T) {
+	registry := NewEnhancedServiceRegistry(nil)
+	var hits [2]atomic.Int32
+	release := make(chan struct{})
+	for n := range 2 {
+		fake := NewFakeService(t, FakeServiceOptions{
+			ServiceID: "svc-rep" + string(rune('a'+n)),
+			Manifest:  newManifest("/api/rep/"),
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				hits[n].Add(1)
+				<-release
+			},
+		})
+		if err := registry.RegisterReplica("svc-rep", n, fake.Socket(), fake.Token(), fake.Manifest()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(NewFrontendDispatcher(registry))
+	defer srv.Close()
+
+	// One at a time, so each lookup sees the previous request in flight.
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(srv.URL + "/api/rep/x")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		waitFor(t, 5*time.Second, "request in flight", func() bool { return hits[0].Load()+hits[1].Load() == int32(i+1) })
+	}
+	if hits[0].Load() != 2 || hits[1].Load() != 2 {
+		t.Errorf("requests per replica = %d, %d; want 2, 2", hits[0].Load(), hits[1].Load())
+	}
+	if got := registry.Get("svc-rep#1").InFlight(); got != 2 {
+		t.Errorf("replica 1 in flight = %d", got)
+	}
+	close(release)
+	wg.Wait()
+	waitFor(t, 5*time.Second, "in-flight count to drop", func() bool { return registry.Get("svc-rep").InFlight() == 0 })
+
+	// With every replica draining the dispatcher answers 503.
+	registry.Drain("svc-rep", time.Second)
+	registry.Drain("svc-rep#1", time.Second)
+	resp, err := http.Get(srv.URL + "/api/rep/x")
+	assertNoErr(t, err, "GET while draining")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("all draining: status %d, want 503", resp.StatusCode)
+	}
+}
+
+// replicaOf returns which replica of the testservice answered a dispatched
+// request, or "" on failure.
+func replicaOf(t *testing.T, base, path string) string {
+	t.Helper()
+	resp, err := http.Get(base + path)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	var body struct{ Replica string }
+	if json.NewDecoder(resp.Body).Decode(&body) != nil {
+		return ""
+	}
+	return body.Replica
+}
+
+func TestServiceRegistry_RunsAndRollsReplicas(t *testing.T) {
+	binPath := buildTestServiceBinary(t)
+	enhanced := NewEnhancedServiceRegistry(nil)
+	router, reg := startSandboxBridge(t, enhanced)
+	srv := httptest.NewServer(NewFrontendDispatcher(enhanced))
+	defer srv.Close()
+
+	cfg := ServiceConfig{ID: "svc-rep", DisplayName: "Replicated", Command: binPath,
+		Args: []string{"--register"}, Replicas: 3}
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 10*time.Second, "3 replicas registered", func() bool { return len(enhanced.Replicas("svc-rep")) == 3 })
+
+	statuses, ok := reg.ReplicaStatus("svc-rep")
+	if !ok || len(statuses) != 3 {
+		t.Fatalf("ReplicaStatus = %v, %v", statuses, ok)
+	}
+	oldPIDs := map[int]bool{}
+	for _, st := range statuses {
+		if !st.Running || oldPIDs[st.PID] {
+			t.Fatalf("replica %d: running %v, pid %d", st.Replica, st.Running, st.PID)
+		}
+		oldPIDs[st.PID] = true
+	}
+	if ids := reg.RunningIDs(); len(ids) != 1 || ids[0] != "svc-rep" {
+		t.Errorf("RunningIDs = %v", ids)
+	}
+	seen := map[string]bool{}
+	for range 6 {
+		seen[replicaOf(t, srv.URL, "/api/svc-rep")] = true
+	}
+	if len(seen) != 3 || seen[""] {
+		t.Errorf("answering replicas = %v, want 0, 1 and 2", seen)
+	}
+
+	// The router fills in the front door's view of each replica.
+	router.services = reg
+	if err := router.store.With(func(s *Settings) { s.Services = []ServiceConfig{cfg} }); err != nil {
+		t.Fatal(err)
+	}
+	list, err := router.ServiceStatus(t.Context())
+	if err != nil || len(list) != 1 || len(list[0].Replicas) != 3 || !list[0].Replicas[2].Registered {
+		t.Fatalf("ServiceStatus = %+v, %v", list, err)
+	}
+	if got := formatServiceStatus(list[0], time.Now()); got != "running (3/3 replicas)" {
+		t.Errorf("STATUS = %q", got)
+	}
+
+	// Reload down to two replicas while requests keep coming: none may fail.
+	var failures, served atomic.Int32
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if replicaOf(t, srv.URL, "/api/svc-rep") == "" {
+				failures.Add(1)
+			} else {
+				served.Add(1)
+			}
+		}
+	}()
+	cfg.Replicas = 2
+	err = reg.Reload("svc-rep", &cfg)
+	close(stop)
+	<-done
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if failures.Load() != 0 {
+		t.Errorf("%d of %d requests failed during the rolling reload", failures.Load(), failures.Load()+served.Load())
+	}
+	statuses, _ = reg.ReplicaStatus("svc-rep")
+	if len(statuses) != 2 {
+		t.Fatalf("after reload: %d replicas", len(statuses))
+	}
+	for _, st := range statuses {
+		if !st.Running || oldPIDs[st.PID] {
+			t.Errorf("replica %d not replaced: running %v, pid %d", st.Replica, st.Running, st.PID)
+		}
+	}
+	waitFor(t, 5*time.Second, "replica 2 forgotten", func() bool { return len(enhanced.Replicas("svc-rep")) == 2 })
+
+	reg.Stop("svc-rep")
+	if reg.IsRunning("svc-rep") || len(enhanced.Replicas("svc-rep")) != 0 {
+		t.Error("replicas still running after Stop")
+	}
+}
+
+func TestServiceRegistry_ReplicaEnv(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	dir := t.TempDir()
+	cfg := ServiceConfig{ID: "svc-env-rep", DisplayName: "Env", Command: "/bin/sh", Replicas: 2,
+		Args: []string{"-c", `echo "$RELAY_SERVICE_ID $RELAY_SERVICE_REPLICA" > "$OUT/$RELAY_SERVICE_REPLICA"; sleep 30`},
+		Env:  map[string]string{"OUT": dir}}
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reg.Stop(cfg.ID) })
+	for _, n := range []string{"0", "1"} {
+		waitFor(t, 5*time.Second, "replica "+n+" output", func() bool {
+			data, _ := os.ReadFile(filepath.Join(dir, n))
+			return string(data) == "svc-env-rep "+n+"\n"
+		})
+	}
+}
+
+func TestFormatReplicas(t *testing.T) {
+	got := formatReplicas([]bridge.ServiceReplica{
+		{Replica: 0, Running: true, Health: "ready"},
+		{Replica: 1, Running: true, Health: "ready", Draining: true},
+		{Replica: 2},
+		{Replica: 3, Running: true, Circuit: "open"},
+	})
+	if want := "3/4 replicas, 2 ready, 1 draining, 1 circuit open"; got != want {
+		t.Errorf("formatReplicas = %q, want %q", got, want)
+	}
+	if !strings.HasPrefix(formatServiceStatus(bridge.ServiceStatus{Running: true, Replicas: []bridge.ServiceReplica{{Running: true}}}, time.Now()), "running (1/1") {
+		t.Error("STATUS doesn't summarise replicas")
+	}
+}
+
+func TestServiceRegister_Replicas(t *testing.T) {
+	store := newCLISandboxStore(t)
+	serviceRegister(store, []string{"--name", "API", "--command", "/usr/bin/true", "--replicas", "3"})
+	if got := store.Get().Services[0].Replicas; got != 3 {
+		t.Fatalf("registered replicas = %d", got)
+	}
+}
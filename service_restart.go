@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"slices"
+	"time"
+)
+
+// Restart policies for managed services.
+//
+// A service with a policy other than "no" is started again by the registry
+// when its process exits on its own — never after Stop, Reload or StopAll,
+// which mark the process as stopping before killing it. Each restart goes
+// through the same spawn path as a manual Start, so it gets a fresh
+// ephemeral service token (the old one is revoked by the reaper) and a fresh
+// manifest registration.
+//
+// Delays double from BackoffSec up to maxRestartBackoff. A run that lasts
+// restartStableAfter counts as healthy and resets the count; MaxRetries
+// restarts without one is a crash loop, and the registry gives up until the
+// user starts the service again.
+
+// Restart policy names (RestartPolicy.Policy).
+const (
+	RestartNo        = "no"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// defaultRestartBackoff is the first restart delay when the policy doesn't
+// set one. A var (not const) so tests can restart without waiting seconds.
+var defaultRestartBackoff = time.Second
+
+const (
+	defaultRestartRetries = 5
+	maxRestartBackoff     = 5 * time.Minute
+	// restartStableAfter is how long a run must last for the next exit to
+	// be treated as a fresh failure rather than part of a crash loop.
+	restartStableAfter = time.Minute
+	// maxRestartHistory bounds the per-service restart log kept in memory.
+	maxRestartHistory = 20
+)
+
+// RestartPolicy says when a service is restarted after exiting (`restart`
+// in settings.json). A nil policy means "no".
+type RestartPolicy struct {
+	// Policy is "no", "on-failure" (non-zero exit or signal) or "always"
+	// (any exit, including status 0).
+	Policy string `json:"policy"`
+	// MaxRetries is the crash-loop threshold: consecutive restarts without
+	// a stable run before the registry gives up. 0 means 5.
+	MaxRetries int `json:"max_retries,omitempty"`
+	// BackoffSec is the delay before the first restart; each further one
+	// doubles it, up to five minutes. 0 means one second.
+	BackoffSec int `json:"backoff_sec,omitempty"`
+	// SuccessExitCodes are exit codes on-failure treats like status 0: the
+	// service meant to stop, so it isn't restarted.
+	SuccessExitCodes []int `json:"success_exit_codes,omitempty"`
+}
+
+// enabled reports whether p restarts anything. Nil-safe.
+func (p *RestartPolicy) enabled() bool {
+	return p != nil && (p.Policy == RestartOnFailure || p.Policy == RestartAlways)
+}
+
+func (p *RestartPolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Policy {
+	case RestartNo, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("restart policy %q must be %s, %s or %s", p.Policy, RestartNo, RestartOnFailure, RestartAlways)
+	}
+	if p.MaxRetries < 0 || p.BackoffSec < 0 {
+		return fmt.Errorf("restart max_retries and backoff_sec must not be negative")
+	}
+	for _, c := range p.SuccessExitCodes {
+		if c < 1 || c > 255 {
+			return fmt.Errorf("success exit code %d out of range 1-255", c)
+		}
+	}
+	return nil
+}
+
+func (p *RestartPolicy) retries() int {
+	if p.MaxRetries > 0 {
+		return p.MaxRetries
+	}
+	return defaultRestartRetries
+}
+
+// backoff is the delay before restart number attempt (1-based).
+func (p *RestartPolicy) backoff(attempt int) time.Duration {
+	d := defaultRestartBackoff
+	if p.BackoffSec > 0 {
+		d = time.Duration(p.BackoffSec) * time.Second
+	}
+	for i := 1; i < attempt && d < maxRestartBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRestartBackoff)
+}
+
+// shouldRestart applies the policy to an exit, given cmd.Wait's error.
+func (p *RestartPolicy) shouldRestart(waitErr error) bool {
+	switch {
+	case !p.enabled():
+		return false
+	case p.Policy == RestartAlways:
+		return true
+	case waitErr == nil:
+		return false
+	}
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) && slices.Contains(p.SuccessExitCodes, exitErr.ExitCode()) {
+		return false
+	}
+	return true
+}
+
+// String renders the policy's name, or "-" when there is none.
+func (p *RestartPolicy) String() string {
+	if !p.enabled() {
+		return "-"
+	}
+	return p.Policy
+}
+
+// restartRecord is one automatic restart, for the history shown by
+// `relay service list --history`.
+type restartRecord struct {
+	At      time.Time     // when the exit was seen
+	Exit    string        // how the previous run ended (childExit.Status)
+	Attempt int           // 1-based count since the last stable run
+	Delay   time.Duration // backoff before the new run
+}
+
+// restartState is the registry's per-service restart bookkeeping. It
+// outlives individual processes so the history and crash-loop count span
+// restarts. Guarded by ServiceRegistry.mu.
+type restartState struct {
+	config   ServiceConfig // config to restart with: the last one started
+	attempts int           // restarts since the last stable run
+	total    int           // automatic restarts since the tray started
+	pending  bool          // a restart is scheduled
+	next     time.Time     // when it fires
+	timer    *time.Timer   // nil until the reaper arms it
+	gen      uint64        // bumped per armed timer; see armLocked
+	gaveUp   bool          // crash loop: stopped restarting
+	history  []restartRecord
+}
+
+// serviceRestartStatus is a snapshot of restartState for status displays.
+type serviceRestartStatus struct {
+	Policy   string
+	Restarts int
+	Pending  bool
+	Next     time.Time
+	GaveUp   bool
+	History  []restartRecord
+}
+
+// resetRestartLocked records cfg as the service's current config and
+// clears any pending restart or crash-loop verdict: an explicit Start is the
+// user saying "try again". History and the total are kept. Caller holds r.mu.
+func (r *ServiceRegistry) resetRestartLocked(cfg *ServiceConfig) {
+	st := r.restarts[cfg.ID]
+	if st == nil {
+		st = &restartState{}
+		r.restarts[cfg.ID] = st
+	}
+	r.cancelRestartLocked(cfg.ID)
+	st.config = *cfg
+}
+
+// cancelRestartLocked drops a scheduled restart and the crash-loop state.
+// Caller holds r.mu.
+func (r *ServiceRegistry) cancelRestartLocked(id string) {
+	st := r.restarts[id]
+	if st == nil {
+		return
+	}
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	st.pending, st.next = false, time.Time{}
+	st.attempts, st.gaveUp = 0, false
+}
+
+// planRestartLocked decides, as proc's reaper, whether the service comes
+// back and after what delay. It only records the decision; the reaper arms
+// the timer (armRestart) once the old process is fully torn down, so the
+// new one never races the old one's token or manifest cleanup. Caller holds
+// r.mu.
+func (r *ServiceRegistry) planRestartLocked(id string, proc *serviceProcess, waitErr error, exit childExit) bool {
+	st := r.restarts[id]
+	if st == nil || proc.stopping || !st.config.Restart.shouldRestart(waitErr) {
+		return false
+	}
+	if time.Since(proc.started) >= restartStableAfter {
+		st.attempts = 0
+	}
+	return r.nextAttemptLocked(id, st, exit.Status)
+}
+
+// nextAttemptLocked schedules the next attempt after a failure described by
+// reason, or declares a crash loop. Caller holds r.mu.
+func (r *ServiceRegistry) nextAttemptLocked(id string, st *restartState, reason string) bool {
+	p := st.config.Restart
+	if st.attempts >= p.retries() {
+		st.gaveUp = true
+		slog.Error("service is crash-looping; not restarting until started again",
+			"id", id, "restarts", st.attempts, "last_exit", reason)
+		return false
+	}
+	st.attempts++
+	st.total++
+	delay := p.backoff(st.attempts)
+	now := time.Now()
+	st.pending, st.next = true, now.Add(delay)
+	st.history = append(st.history, restartRecord{At: now, Exit: reason, Attempt: st.attempts, Delay: delay})
+	if len(st.history) > maxRestartHistory {
+		st.history = st.history[len(st.history)-maxRestartHistory:]
+	}
+	slog.Warn("service exited; restarting", "id", id, "exit", reason, "attempt", st.attempts, "delay", delay)
+	return true
+}
+
+// armRestart starts the timer for a restart planned by planRestartLocked,
+// unless a Stop or Start got there first.
+func (r *ServiceRegistry) armRestart(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.restarts[id]
+	if st == nil || !st.pending || st.timer != nil {
+		return
+	}
+	r.armLocked(id, st)
+}
+
+// armLocked schedules restartFired for st.next. The generation lets a timer
+// that fires after being cancelled (Stop can't always win the race with
+// time.AfterFunc) recognise it is stale. Caller holds r.mu.
+func (r *ServiceRegistry) armLocked(id string, st *restartState) {
+	st.gen++
+	gen := st.gen
+	st.timer = time.AfterFunc(time.Until(st.next), func() { r.restartFired(id, st, gen) })
+}
+
+// restartFired performs a scheduled restart. A failed spawn counts as
+// another failed run and is retried on the same backoff.
+func (r *ServiceRegistry) restartFired(id string, st *restartState, gen uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.restarts[id] != st || st.timer == nil || st.gen != gen {
+		return // cancelled or superseded while waiting for the lock
+	}
+	st.timer, st.pending, st.next = nil, false, time.Time{}
+	cfg := st.config
+	if err := r.startLocked(&cfg); err != nil {
+		slog.Error("service restart failed", "id", id, "error", err)
+		if r.nextAttemptLocked(id, st, err.Error()) {
+			r.armLocked(id, st)
+		} else {
+			r.idleSocketsLocked(id)
+		}
+	}
+}
+
+// RestartStatus reports a service's restart bookkeeping. ok is false for a
+// service this registry has never started.
+func (r *ServiceRegistry) RestartStatus(id string) (serviceRestartStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.restarts[id]
+	if st == nil {
+		return serviceRestartStatus{}, false
+	}
+	return serviceRestartStatus{
+		Policy:   st.config.Restart.String(),
+		Restarts: st.total,
+		Pending:  st.pending,
+		Next:     st.next,
+		GaveUp:   st.gaveUp,
+		History:  slices.Clone(st.history),
+	}, true
+}
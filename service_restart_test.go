@@ -0,0 +1,239 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRestartPolicy_Validate(t *testing.T) {
+	ok := []*RestartPolicy{
+		nil,
+		{Policy: RestartNo},
+		{Policy: RestartOnFailure, MaxRetries: 3, BackoffSec: 2, SuccessExitCodes: []int{75}},
+		{Policy: RestartAlways},
+	}
+	for i, p := range ok {
+		if err := p.validate(); err != nil {
+			t.Errorf("ok[%d]: %v", i, err)
+		}
+	}
+
+	bad := map[string]*RestartPolicy{
+		"empty policy":      {},
+		"unknown policy":    {Policy: "sometimes"},
+		"negative retries":  {Policy: RestartAlways, MaxRetries: -1},
+		"negative backoff":  {Policy: RestartAlways, BackoffSec: -1},
+		"zero success code": {Policy: RestartOnFailure, SuccessExitCodes: []int{0}},
+		"code out of range": {Policy: RestartOnFailure, SuccessExitCodes: []int{256}},
+	}
+	for name, p := range bad {
+		if err := p.validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+
+	svc := &ServiceConfig{ID: "s", DisplayName: "S", Command: "/bin/true", Restart: &RestartPolicy{Policy: "maybe"}}
+	if err := svc.Validate(); err == nil {
+		t.Error("service with bad restart policy validated")
+	}
+}
+
+func TestRestartPolicy_Backoff(t *testing.T) {
+	p := &RestartPolicy{Policy: RestartAlways, BackoffSec: 10}
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, maxRestartBackoff, maxRestartBackoff}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+	if got := (&RestartPolicy{Policy: RestartAlways}).backoff(1); got != defaultRestartBackoff {
+		t.Errorf("default first backoff = %v, want %v", got, defaultRestartBackoff)
+	}
+	if got := (&RestartPolicy{}).retries(); got != defaultRestartRetries {
+		t.Errorf("default retries = %d", got)
+	}
+}
+
+func TestRestartPolicy_ShouldRestart(t *testing.T) {
+	exitWith := func(script string) error {
+		return exec.Command("/bin/sh", "-c", script).Run()
+	}
+	clean := exitWith("exit 0")
+	failed := exitWith("exit 1")
+	tempfail := exitWith("exit 75")
+	killed := exitWith("kill -KILL $$")
+
+	onFailure := &RestartPolicy{Policy: RestartOnFailure, SuccessExitCodes: []int{75}}
+	always := &RestartPolicy{Policy: RestartAlways}
+	cases := []struct {
+		name string
+		p    *RestartPolicy
+		err  error
+		want bool
+	}{
+		{"nil policy", nil, failed, false},
+		{"no", &RestartPolicy{Policy: RestartNo}, failed, false},
+		{"on-failure clean", onFailure, clean, false},
+		{"on-failure status 1", onFailure, failed, true},
+		{"on-failure signal", onFailure, killed, true},
+		{"on-failure allowlisted", onFailure, tempfail, false},
+		{"always clean", always, clean, true},
+		{"always allowlist ignored", &RestartPolicy{Policy: RestartAlways, SuccessExitCodes: []int{75}}, tempfail, true},
+	}
+	for _, c := range cases {
+		if got := c.p.shouldRestart(c.err); got != c.want {
+			t.Errorf("%s: shouldRestart = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// fastRestarts shortens the default backoff for the duration of a test.
+func fastRestarts(t *testing.T) {
+	t.Helper()
+	prev := defaultRestartBackoff
+	defaultRestartBackoff = 20 * time.Millisecond
+	t.Cleanup(func() { defaultRestartBackoff = prev })
+}
+
+// countingExits returns a registry hook that counts process exits.
+func countingExits(reg *ServiceRegistry) *atomic.Int32 {
+	var n atomic.Int32
+	reg.OnProcessExit = func() { n.Add(1) }
+	return &n
+}
+
+// TestServiceRegistry_RestartsUntilCrashLoop runs a service that always
+// fails: it must be restarted MaxRetries times with a fresh token each
+// time, then left down as a crash loop.
+func TestServiceRegistry_RestartsUntilCrashLoop(t *testing.T) {
+	fastRestarts(t)
+	router, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	exits := countingExits(reg)
+
+	tokens := filepath.Join(t.TempDir(), "tokens")
+	cfg := &ServiceConfig{
+		ID:          "svc-crashy",
+		DisplayName: "Crashy",
+		Command:     "/bin/sh",
+		Args:        []string{"-c", `echo "$` + EnvServiceToken + `" >> "$OUT"; exit 1`},
+		Env:         map[string]string{"OUT": tokens},
+		Restart:     &RestartPolicy{Policy: RestartOnFailure, MaxRetries: 2},
+	}
+	if err := reg.Start(cfg); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	waitFor(t, 5*time.Second, "crash loop", func() bool {
+		rs, _ := reg.RestartStatus(cfg.ID)
+		return rs.GaveUp
+	})
+
+	if n := exits.Load(); n != 3 {
+		t.Fatalf("process exits = %d, want 3 (first run + 2 restarts)", n)
+	}
+	rs, _ := reg.RestartStatus(cfg.ID)
+	if rs.Restarts != 2 || rs.Pending || len(rs.History) != 2 || rs.History[1].Attempt != 2 || rs.History[0].Exit != "exited: status 1" {
+		t.Fatalf("restart status = %+v", rs)
+	}
+	if rs.History[1].Delay != 2*rs.History[0].Delay {
+		t.Fatalf("backoff did not double: %v then %v", rs.History[0].Delay, rs.History[1].Delay)
+	}
+
+	data, err := os.ReadFile(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, tok := range strings.Fields(string(data)) {
+		seen[tok] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("each run must get a fresh service token; saw %d distinct of %q", len(seen), data)
+	}
+	// The reapers revoked every token; none outlives its run.
+	waitFor(t, 5*time.Second, "token revocation", func() bool { return router.serviceTokens.Len() == 0 })
+
+	// Starting it by hand clears the crash-loop verdict.
+	cfg.Restart = &RestartPolicy{Policy: RestartNo}
+	if err := reg.Start(cfg); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if rs, _ := reg.RestartStatus(cfg.ID); rs.GaveUp || rs.Restarts != 2 {
+		t.Fatalf("after manual start: %+v (want crash loop cleared, history kept)", rs)
+	}
+}
+
+// TestServiceRegistry_StopDoesNotRestart checks that exits the registry
+// caused itself never trigger the policy, and that Stop cancels a restart
+// that is already scheduled.
+func TestServiceRegistry_StopDoesNotRestart(t *testing.T) {
+	fastRestarts(t)
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	exits := countingExits(reg)
+
+	cfg := &ServiceConfig{
+		ID:          "svc-always",
+		DisplayName: "Always",
+		Command:     "/bin/sleep",
+		Args:        []string{"30"},
+		Restart:     &RestartPolicy{Policy: RestartAlways},
+	}
+	if err := reg.Start(cfg); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	reg.Stop(cfg.ID)
+	waitFor(t, 5*time.Second, "exit", func() bool { return exits.Load() == 1 })
+	time.Sleep(100 * time.Millisecond) // several backoffs' worth
+	if reg.IsRunning(cfg.ID) {
+		t.Fatal("service restarted after Stop")
+	}
+	if rs, _ := reg.RestartStatus(cfg.ID); rs.Restarts != 0 || rs.Pending {
+		t.Fatalf("restart status after Stop = %+v", rs)
+	}
+
+	// A long backoff leaves a restart pending; Stop must cancel it.
+	cfg.Args = []string{"-c", "exit 1"}
+	cfg.Command = "/bin/sh"
+	cfg.Restart = &RestartPolicy{Policy: RestartAlways, BackoffSec: 60}
+	if err := reg.Start(cfg); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	waitFor(t, 5*time.Second, "pending restart", func() bool {
+		rs, _ := reg.RestartStatus(cfg.ID)
+		return rs.Pending
+	})
+	reg.Stop(cfg.ID)
+	if rs, _ := reg.RestartStatus(cfg.ID); rs.Pending || !rs.Next.IsZero() {
+		t.Fatalf("Stop left a restart pending: %+v", rs)
+	}
+}
+
+// A service that exits with an allowlisted code under on-failure is done.
+func TestServiceRegistry_SuccessExitCodeNotRestarted(t *testing.T) {
+	fastRestarts(t)
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	exits := countingExits(reg)
+
+	cfg := &ServiceConfig{
+		ID:          "svc-done",
+		DisplayName: "Done",
+		Command:     "/bin/sh",
+		Args:        []string{"-c", "exit 75"},
+		Restart:     &RestartPolicy{Policy: RestartOnFailure, SuccessExitCodes: []int{75}},
+	}
+	if err := reg.Start(cfg); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	waitFor(t, 5*time.Second, "exit", func() bool { return exits.Load() == 1 })
+	time.Sleep(100 * time.Millisecond)
+	if n := exits.Load(); n != 1 {
+		t.Fatalf("allowlisted exit restarted the service (%d exits)", n)
+	}
+	if exit, _ := reg.LastExit(cfg.ID); exit.Status != "exited: status 75" {
+		t.Fatalf("LastExit = %+v", exit)
+	}
+}
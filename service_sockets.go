@@ -0,0 +1,478 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Socket activation for managed services.
+//
+// A service with a `sockets` block doesn't bind its own listeners: relay
+// binds them and the service inherits them, the way systemd passes sockets:
+//
+//	fd 3, 4, ...     the listeners, in the order declared
+//	LISTEN_FDS       how many there are
+//	LISTEN_FDNAMES   their names, colon-separated
+//	LISTEN_PID       the service's PID (the wrapper execs the command, so the
+//	                 process that checks it is the one it names)
+//
+// Relay holds the listeners for as long as the service is meant to be up —
+// across crashes, automatic restarts and reloads — so clients connecting
+// while it (re)starts queue in the kernel instead of being refused, and a
+// restart never races its predecessor for the port. That also takes the
+// sting out of orphans: a new run inherits the bound socket rather than
+// fighting a leftover process for it.
+//
+// With on_demand, Start binds the listeners but doesn't spawn anything: the
+// service is started by the first connection, and started again by the
+// next one after it exits on its own. Relay never accepts a connection
+// itself; it only waits for one to be pending.
+//
+// Stop closes the listeners, as does an exit that nothing will follow (no
+// restart, not on demand), so a stopped service's port is free again.
+
+// Environment the socket-activation protocol passes to the service.
+const (
+	envListenFDs     = "LISTEN_FDS"
+	envListenFDNames = "LISTEN_FDNAMES"
+	envListenPID     = "LISTEN_PID"
+)
+
+// listenFDStart is the first inherited listener's descriptor (after stdin,
+// stdout and stderr), fixed by the protocol.
+const listenFDStart = 3
+
+// maxServiceSockets bounds a service's listeners; each is an fd held open in
+// the tray for the service's lifetime.
+const maxServiceSockets = 16
+
+// socketWaitTick is how often an on-demand service's connection wait checks
+// whether it has been disarmed. A var (not const) so tests can shorten it.
+var socketWaitTick = 250 * time.Millisecond
+
+// SocketActivation declares the listeners relay binds for a service
+// (`sockets` in settings.json).
+type SocketActivation struct {
+	Listeners []SocketListener `json:"listeners"`
+	// OnDemand defers starting the service to the first connection.
+	OnDemand bool `json:"on_demand,omitempty"`
+}
+
+// SocketListener is one listener: Address is "unix:/abs/path" or an
+// absolute path for a Unix socket, "tcp:host:port" or "host:port" for TCP.
+// Name goes in LISTEN_FDNAMES; it defaults to the service ID, as systemd
+// defaults it to the socket unit's name.
+type SocketListener struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+// parseSocketAddress splits a listener address into the network and address
+// net.Listen takes.
+func parseSocketAddress(s string) (network, addr string, err error) {
+	switch {
+	case strings.HasPrefix(s, "unix:"):
+		network, addr = "unix", strings.TrimPrefix(s, "unix:")
+	case strings.HasPrefix(s, "tcp:"):
+		network, addr = "tcp", strings.TrimPrefix(s, "tcp:")
+	case strings.HasPrefix(s, "/"):
+		network, addr = "unix", s
+	default:
+		network, addr = "tcp", s
+	}
+	if network == "unix" {
+		if !filepath.IsAbs(addr) {
+			return "", "", fmt.Errorf("socket %q: Unix socket path must be absolute", s)
+		}
+		// sun_path is 104 bytes on macOS (108 on Linux), NUL included.
+		if len(addr) >= 104 {
+			return "", "", fmt.Errorf("socket %q: Unix socket path is too long (max 103 bytes)", s)
+		}
+		return network, filepath.Clean(addr), nil
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("socket %q: want host:port or an absolute path", s)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", "", fmt.Errorf("socket %q: port must be 1-65535", s)
+	}
+	return network, addr, nil
+}
+
+// parseSocketListener parses a `--socket` value, "[name=]address".
+func parseSocketListener(s string) (SocketListener, error) {
+	l := SocketListener{Address: s}
+	if name, addr, ok := strings.Cut(s, "="); ok {
+		l = SocketListener{Name: name, Address: addr}
+	}
+	if _, _, err := parseSocketAddress(l.Address); err != nil {
+		return SocketListener{}, err
+	}
+	return l, validSocketName(l.Name)
+}
+
+// validSocketName rejects names LISTEN_FDNAMES can't carry: the protocol
+// separates them with ':' and allows only printable ASCII.
+func validSocketName(name string) error {
+	if len(name) > 255 {
+		return fmt.Errorf("socket name %q is too long", name)
+	}
+	for _, c := range name {
+		if c <= ' ' || c > '~' || c == ':' {
+			return fmt.Errorf("socket name %q: use printable ASCII without spaces or ':'", name)
+		}
+	}
+	return nil
+}
+
+func (a *SocketActivation) validate() error {
+	if a == nil {
+		return nil
+	}
+	if len(a.Listeners) == 0 {
+		return fmt.Errorf("sockets needs at least one listener")
+	}
+	if len(a.Listeners) > maxServiceSockets {
+		return fmt.Errorf("at most %d sockets per service", maxServiceSockets)
+	}
+	seen := make(map[string]bool, len(a.Listeners))
+	for _, l := range a.Listeners {
+		network, addr, err := parseSocketAddress(l.Address)
+		if err != nil {
+			return err
+		}
+		if err := validSocketName(l.Name); err != nil {
+			return err
+		}
+		if key := network + ":" + addr; seen[key] {
+			return fmt.Errorf("socket %q is listed twice", l.Address)
+		} else {
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+// String renders the listeners as `service show` shows them, e.g.
+// "http=tcp:127.0.0.1:8080 (on demand)", or "-".
+func (a *SocketActivation) String() string {
+	if a == nil || len(a.Listeners) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(a.Listeners))
+	for i, l := range a.Listeners {
+		network, addr, _ := parseSocketAddress(l.Address)
+		parts[i] = network + ":" + addr
+		if l.Name != "" {
+			parts[i] = l.Name + "=" + parts[i]
+		}
+	}
+	s := strings.Join(parts, ",")
+	if a.OnDemand {
+		s += " (on demand)"
+	}
+	return s
+}
+
+// socketSet is a service's bound listeners and, while it waits on demand,
+// the wait that will start it.
+type socketSet struct {
+	spec  SocketActivation // as bound, so a reload can tell if it changed
+	names []string         // LISTEN_FDNAMES entries, defaults filled in
+	files []*os.File
+	paths []string // Unix socket files to unlink on close
+	// config is what a connection starts, for an on-demand service.
+	config ServiceConfig
+	// armed is set while an on-demand service waits for a connection;
+	// disarm is closed to end the wait.
+	armed  bool
+	disarm chan struct{}
+}
+
+// bindSockets binds every listener in cfg.Sockets. Unix sockets are created
+// 0600 (in a 0700 directory if relay has to create it), replacing a stale
+// socket file but never anything else. All or nothing: on error, whatever
+// was bound is closed again.
+func bindSockets(cfg *ServiceConfig) (_ *socketSet, err error) {
+	ss := &socketSet{spec: *cfg.Sockets, config: *cfg}
+	ss.spec.Listeners = slices.Clone(cfg.Sockets.Listeners)
+	defer func() {
+		if err != nil {
+			ss.close()
+		}
+	}()
+	for _, l := range cfg.Sockets.Listeners {
+		network, addr, err := parseSocketAddress(l.Address)
+		if err != nil {
+			return nil, err
+		}
+		f, err := bindSocket(network, addr)
+		if err != nil {
+			return nil, fmt.Errorf("bind %s:%s: %w", network, addr, err)
+		}
+		ss.files = append(ss.files, f)
+		if network == "unix" {
+			ss.paths = append(ss.paths, addr)
+		}
+		name := l.Name
+		if name == "" {
+			name = cfg.ID
+		}
+		ss.names = append(ss.names, name)
+	}
+	return ss, nil
+}
+
+// bindSocket listens on one address and returns the listening socket as a
+// blocking file, ready to hand to a child. The net.Listener is closed right
+// away; the file holds a separate descriptor for the same socket.
+func bindSocket(network, addr string) (*os.File, error) {
+	if network == "unix" {
+		if err := os.MkdirAll(filepath.Dir(addr), 0o700); err != nil {
+			return nil, err
+		}
+		if fi, err := os.Lstat(addr); err == nil {
+			if fi.Mode()&fs.ModeSocket == 0 {
+				return nil, fmt.Errorf("%s exists and is not a socket", addr)
+			}
+			_ = os.Remove(addr)
+		}
+	}
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	var f *os.File
+	switch l := ln.(type) {
+	case *net.TCPListener:
+		f, err = l.File()
+	case *net.UnixListener:
+		l.SetUnlinkOnClose(false)
+		if err = os.Chmod(addr, 0o600); err == nil {
+			f, err = l.File()
+		}
+	default:
+		err = fmt.Errorf("unsupported listener %T", ln)
+	}
+	ln.Close()
+	if err != nil {
+		if network == "unix" {
+			_ = os.Remove(addr)
+		}
+		return nil, err
+	}
+	// Children expect the blocking sockets systemd hands out; the flag is
+	// per open file, so this is what they inherit.
+	if err := syscall.SetNonblock(int(f.Fd()), false); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// close releases the listeners and unlinks their Unix socket files.
+func (ss *socketSet) close() {
+	for _, f := range ss.files {
+		f.Close()
+	}
+	for _, p := range ss.paths {
+		_ = os.Remove(p)
+	}
+	ss.files, ss.paths = nil, nil
+}
+
+// pass hands the listeners to cmd as fd 3 onwards, with the protocol's
+// environment. LISTEN_PID is set by the service's wrapper (listenPIDPrefix).
+func (ss *socketSet) pass(cmd *exec.Cmd) {
+	cmd.ExtraFiles = append(cmd.ExtraFiles[:0:0], ss.files...)
+	mergeEnv(cmd, map[string]string{
+		envListenFDs:     strconv.Itoa(len(ss.files)),
+		envListenFDNames: strings.Join(ss.names, ":"),
+	})
+}
+
+// listenPIDPrefix is prepended to a socket-activated service's quoted
+// command and args. The login shell runs it for the PATH it sets up, but
+// that shell is the user's $SHELL — fish and tcsh have no $$ and no
+// VAR=val; — so the part that needs POSIX syntax is a fixed /bin/sh
+// script, passed single-quoted: it sets LISTEN_PID to its own PID and
+// execs the command ($0) and args in its place, so the PID the service
+// sees in LISTEN_PID is its own. Outside the quotes it's plain words that
+// read the same in any shell.
+const listenPIDPrefix = "exec /bin/sh -c '" + envListenPID + "=$$; export " + envListenPID + `; exec "$0" "$@"' `
+
+// socketsLocked binds cfg's listeners, or keeps the ones already bound if
+// they're unchanged (a reload, a restart), and returns them; with no
+// sockets block it closes any left from an earlier config and returns nil.
+// Caller holds r.mu.
+func (r *ServiceRegistry) socketsLocked(cfg *ServiceConfig) (*socketSet, error) {
+	ss := r.sockets[cfg.ID]
+	if cfg.Sockets == nil {
+		r.closeSocketsLocked(cfg.ID)
+		return nil, nil
+	}
+	if ss != nil && sameSockets(&ss.spec, cfg.Sockets) {
+		ss.config = *cfg
+		ss.spec.OnDemand = cfg.Sockets.OnDemand
+		return ss, nil
+	}
+	r.closeSocketsLocked(cfg.ID)
+	ss, err := bindSockets(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r.sockets[cfg.ID] = ss
+	return ss, nil
+}
+
+// sameSockets reports whether b binds exactly what a does. OnDemand isn't
+// compared: switching it needs no rebind.
+func sameSockets(a, b *SocketActivation) bool {
+	return slices.Equal(a.Listeners, b.Listeners)
+}
+
+// closeSocketsLocked ends an on-demand wait and closes the service's
+// listeners. Caller holds r.mu.
+func (r *ServiceRegistry) closeSocketsLocked(id string) {
+	ss := r.sockets[id]
+	if ss == nil {
+		return
+	}
+	r.disarmSocketsLocked(ss)
+	ss.close()
+	delete(r.sockets, id)
+}
+
+// armSocketsLocked starts waiting for the first connection to an on-demand
+// service. Caller holds r.mu.
+func (r *ServiceRegistry) armSocketsLocked(id string, ss *socketSet) {
+	if ss.armed {
+		return
+	}
+	ss.armed = true
+	ss.disarm = make(chan struct{})
+	go r.awaitConnection(id, ss, ss.disarm)
+}
+
+func (r *ServiceRegistry) disarmSocketsLocked(ss *socketSet) {
+	if ss.armed {
+		close(ss.disarm)
+	}
+	ss.armed, ss.disarm = false, nil
+}
+
+// socketsArmedLocked reports whether id is an on-demand service waiting for
+// a connection. Caller holds r.mu.
+func (r *ServiceRegistry) socketsArmedLocked(id string) bool {
+	ss := r.sockets[id]
+	return ss != nil && ss.armed
+}
+
+// awaitConnection waits until one of an armed service's listeners has a
+// connection pending, then starts the service, which accepts it. Returns
+// without starting if disarm is closed or the registry shuts down first.
+func (r *ServiceRegistry) awaitConnection(id string, ss *socketSet, disarm chan struct{}) {
+	stopped := func() bool {
+		select {
+		case <-disarm:
+			return true
+		case <-r.quit:
+			return true
+		default:
+			return false
+		}
+	}
+	r.mu.Lock()
+	fds := make([]int, len(ss.files))
+	for i, f := range ss.files {
+		fds[i] = int(f.Fd())
+	}
+	r.mu.Unlock()
+	ready, err := waitReadable(fds, stopped)
+	if err != nil {
+		// Can't wait here (see waitReadable); start now rather than never.
+		slog.Warn("can't wait for a connection; starting on-demand service now", "id", id, "error", err)
+	} else if !ready {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ss.disarm != disarm {
+		return
+	}
+	ss.armed, ss.disarm = false, nil
+	cfg := ss.config
+	slog.Info("starting on-demand service for a connection", "id", id)
+	if err := r.startLocked(&cfg); err != nil {
+		// Waiting again would retry at once for the same pending
+		// connection; release the sockets instead, as for a failed start.
+		slog.Error("on-demand service start failed", "id", id, "error", err)
+		r.closeSocketsLocked(id)
+	}
+}
+
+// afterSocketServiceExit is called by the reaper when a process exit has
+// nothing (a restart, a queued run) following it; see idleSocketsLocked.
+func (r *ServiceRegistry) afterSocketServiceExit(id string, proc *serviceProcess) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if proc.stopping || r.isRunningLocked(id) {
+		return // Stop or a new Start already decided
+	}
+	r.idleSocketsLocked(id)
+}
+
+// idleSocketsLocked decides what happens to a socket-activated service's
+// listeners once it is down for good — exited with no restart to follow, or
+// its restart policy gave up: an on-demand service waits for the next
+// connection, any other releases them. Caller holds r.mu.
+func (r *ServiceRegistry) idleSocketsLocked(id string) {
+	ss := r.sockets[id]
+	if ss == nil {
+		return
+	}
+	if ss.spec.OnDemand {
+		r.armSocketsLocked(id, ss)
+		return
+	}
+	r.closeSocketsLocked(id)
+}
+
+// serviceSocketStatus is a socket-activated service's listener state, for
+// `service list` and the bridge.
+type serviceSocketStatus struct {
+	Listening []string // bound addresses, in fd order
+	Awaiting  bool     // on demand, waiting for a connection
+}
+
+// SocketStatus reports the service's bound listeners; ok is false when it
+// has none.
+func (r *ServiceRegistry) SocketStatus(id string) (st serviceSocketStatus, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ss := r.sockets[id]
+	if ss == nil {
+		return st, false
+	}
+	for _, l := range ss.spec.Listeners {
+		network, addr, _ := parseSocketAddress(l.Address)
+		st.Listening = append(st.Listening, network+":"+addr)
+	}
+	return serviceSocketStatus{Listening: st.Listening, Awaiting: ss.armed}, true
+}
+
+// errNoSocketWait is returned by waitReadable where there's no way to wait.
+var errNoSocketWait = errors.New("waiting for connections is not supported on this platform")
@@ -0,0 +1,43 @@
+//go:build darwin
+
+package main
+
+import (
+	"syscall"
+)
+
+// waitReadable blocks until one of fds — listening sockets — has a
+// connection pending (reporting true) or stopped returns true (reporting
+// false), checking stopped every socketWaitTick. It uses its own kqueue
+// rather than Go's netpoller: the runtime has no way to watch a listener
+// without accepting from it, and relay must leave the connection for the
+// service to accept.
+func waitReadable(fds []int, stopped func() bool) (bool, error) {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return false, err
+	}
+	defer syscall.Close(kq)
+	changes := make([]syscall.Kevent_t, len(fds))
+	for i, fd := range fds {
+		syscall.SetKevent(&changes[i], fd, syscall.EVFILT_READ, syscall.EV_ADD)
+	}
+	if _, err := syscall.Kevent(kq, changes, nil, nil); err != nil {
+		return false, err
+	}
+	events := make([]syscall.Kevent_t, len(fds))
+	for !stopped() {
+		ts := syscall.NsecToTimespec(int64(socketWaitTick))
+		n, err := syscall.Kevent(kq, nil, events, &ts)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return !stopped(), nil
+		}
+	}
+	return false, nil
+}
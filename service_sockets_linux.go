@@ -0,0 +1,42 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// waitReadable blocks until one of fds — listening sockets — has a
+// connection pending (reporting true) or stopped returns true (reporting
+// false), checking stopped every socketWaitTick. It uses its own epoll set
+// rather than Go's netpoller: the runtime has no way to watch a listener
+// without accepting from it, and relay must leave the connection for the
+// service to accept.
+func waitReadable(fds []int, stopped func() bool) (bool, error) {
+	ep, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return false, err
+	}
+	defer syscall.Close(ep)
+	for _, fd := range fds {
+		ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fd)}
+		if err := syscall.EpollCtl(ep, syscall.EPOLL_CTL_ADD, fd, &ev); err != nil {
+			return false, err
+		}
+	}
+	events := make([]syscall.EpollEvent, len(fds))
+	for !stopped() {
+		n, err := syscall.EpollWait(ep, events, int(socketWaitTick/time.Millisecond))
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return !stopped(), nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !linux
+
+package main
+
+// waitReadable has no implementation here, so an on-demand service is
+// started as soon as its listeners are bound (see awaitConnection).
+func waitReadable(fds []int, stopped func() bool) (bool, error) {
+	return false, errNoSocketWait
+}
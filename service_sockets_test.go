@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSocketActivation_Validate(t *testing.T) {
+	for in, want := range map[string][2]string{
+		"unix:/tmp/a.sock": {"unix", "/tmp/a.sock"},
+		"/tmp/b/../a.sock": {"unix", "/tmp/a.sock"},
+		"tcp:127.0.0.1:80": {"tcp", "127.0.0.1:80"},
+		"localhost:8080":   {"tcp", "localhost:8080"},
+		"tcp:[::1]:65535":  {"tcp", "[::1]:65535"},
+	} {
+		network, addr, err := parseSocketAddress(in)
+		if err != nil || network != want[0] || addr != want[1] {
+			t.Errorf("parseSocketAddress(%q) = %q, %q, %v", in, network, addr, err)
+		}
+	}
+	for _, bad := range []string{"unix:rel.sock", "tcp:8080", "tcp:127.0.0.1:0", "127.0.0.1:70000", "unix:/" + strings.Repeat("x", 110)} {
+		if _, _, err := parseSocketAddress(bad); err == nil {
+			t.Errorf("socket address %q accepted", bad)
+		}
+	}
+
+	if l, err := parseSocketListener("http=tcp:127.0.0.1:8080"); err != nil || l != (SocketListener{Name: "http", Address: "tcp:127.0.0.1:8080"}) {
+		t.Errorf("parseSocketListener = %+v, %v", l, err)
+	}
+	if _, err := parseSocketListener("a:b=tcp:127.0.0.1:8080"); err == nil {
+		t.Error("socket name with ':' accepted")
+	}
+
+	for _, a := range []*SocketActivation{
+		{},
+		{Listeners: []SocketListener{{Address: "tcp:127.0.0.1:8080"}, {Address: "127.0.0.1:8080"}}},
+		{Listeners: []SocketListener{{Name: "has space", Address: "/tmp/a.sock"}}},
+		{Listeners: make([]SocketListener, maxServiceSockets+1)},
+	} {
+		if err := a.validate(); err == nil {
+			t.Errorf("sockets %+v validated", *a)
+		}
+	}
+
+	sockets := &SocketActivation{OnDemand: true, Listeners: []SocketListener{{Name: "http", Address: "127.0.0.1:8080"}, {Address: "/tmp/a.sock"}}}
+	if got := sockets.String(); got != "http=tcp:127.0.0.1:8080,unix:/tmp/a.sock (on demand)" {
+		t.Errorf("String = %q", got)
+	}
+	if got := (*SocketActivation)(nil).String(); got != "-" {
+		t.Errorf("nil String = %q", got)
+	}
+
+	job := ServiceConfig{ID: "j", DisplayName: "J", Command: "/bin/true", Kind: KindJob, Sockets: sockets}
+	if err := job.Validate(); err == nil {
+		t.Error("job with sockets validated")
+	}
+}
+
+// freeTCPAddr returns a loopback address with a port nothing listens on.
+func freeTCPAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// shortSocketPath returns a Unix socket path short enough for sun_path,
+// which t.TempDir's can exceed on macOS.
+func shortSocketPath(t *testing.T, name string) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, name)
+}
+
+// socketService runs a shell that records what socket activation handed it
+// in $OUT, then idles. It never accepts, so connections stay queued.
+func socketService(t *testing.T, id string, listeners ...SocketListener) (ServiceConfig, string) {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "out")
+	script := `echo "$LISTEN_FDS $LISTEN_FDNAMES $([ "$LISTEN_PID" = $$ ] && echo pid)" >> "$OUT"
+for fd in 3 4; do [ -S /dev/fd/$fd ] && echo "fd$fd" >> "$OUT"; done
+while :; do sleep 0.1; done`
+	return ServiceConfig{ID: id, DisplayName: id, Command: "/bin/sh", Args: []string{"-c", script},
+		Env: map[string]string{"OUT": out}, Sockets: &SocketActivation{Listeners: listeners}}, out
+}
+
+// queued reports whether conn is still waiting in a live listener's
+// backlog: a read times out rather than failing because the listener was
+// closed under it.
+func queued(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err := conn.Read(make([]byte, 1))
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// The service inherits the listeners as fd 3 onwards with the protocol's
+// environment; they outlive a reload and are closed by Stop.
+func TestServiceRegistry_SocketActivation(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	tcpAddr := freeTCPAddr(t)
+	unixPath := shortSocketPath(t, "svc.sock")
+	cfg, out := socketService(t, "svc-sock",
+		SocketListener{Name: "http", Address: "tcp:" + tcpAddr},
+		SocketListener{Address: unixPath})
+
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "service to report its sockets", func() bool {
+		data, _ := os.ReadFile(out)
+		return strings.Count(string(data), "\n") >= 3
+	})
+	if data, _ := os.ReadFile(out); string(data) != "2 http:svc-sock pid\nfd3\nfd4\n" {
+		t.Fatalf("service saw %q", data)
+	}
+	if fi, err := os.Stat(unixPath); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("unix socket: %v, %v", fi, err)
+	}
+	if st, ok := reg.SocketStatus(cfg.ID); !ok || st.Awaiting || strings.Join(st.Listening, " ") != "tcp:"+tcpAddr+" unix:"+unixPath {
+		t.Errorf("SocketStatus = %+v, %v", st, ok)
+	}
+
+	conn, err := net.Dial("tcp", tcpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := reg.Reload(cfg.ID, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !queued(conn) {
+		t.Error("connection made before a reload was dropped")
+	}
+
+	reg.Stop(cfg.ID)
+	if queued(conn) {
+		t.Error("connection still queued after Stop")
+	}
+	if _, err := net.Dial("tcp", tcpAddr); err == nil {
+		t.Error("TCP socket still listening after Stop")
+	}
+	if _, err := os.Stat(unixPath); !os.IsNotExist(err) {
+		t.Errorf("unix socket left behind: %v", err)
+	}
+	if _, ok := reg.SocketStatus(cfg.ID); ok {
+		t.Error("SocketStatus reported after Stop")
+	}
+}
+
+// An on-demand service waits, counting as running, until a connection
+// arrives; it is started for it, and waits again once it exits on its own.
+func TestServiceRegistry_SocketOnDemand(t *testing.T) {
+	prev := socketWaitTick
+	socketWaitTick = 20 * time.Millisecond
+	t.Cleanup(func() { socketWaitTick = prev })
+
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	tcpAddr := freeTCPAddr(t)
+	dir := t.TempDir()
+	out, quit := filepath.Join(dir, "out"), filepath.Join(dir, "quit")
+	cfg := ServiceConfig{ID: "svc-lazy", DisplayName: "Lazy", Command: "/bin/sh",
+		Args:    []string{"-c", `echo started >> "$OUT"; while [ ! -e "$QUIT" ]; do sleep 0.05; done; rm "$QUIT"`},
+		Env:     map[string]string{"OUT": out, "QUIT": quit},
+		Sockets: &SocketActivation{OnDemand: true, Listeners: []SocketListener{{Address: "tcp:" + tcpAddr}}}}
+
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatal("on-demand service started without a connection")
+	}
+	if !reg.IsRunning(cfg.ID) || strings.Join(reg.RunningIDs(), ",") != cfg.ID {
+		t.Error("waiting on-demand service not reported as running")
+	}
+	if _, ok := reg.PIDsByServiceID()[cfg.ID]; ok {
+		t.Error("waiting on-demand service has a PID")
+	}
+	if st, _ := reg.SocketStatus(cfg.ID); !st.Awaiting {
+		t.Errorf("SocketStatus = %+v", st)
+	}
+
+	conn, err := net.Dial("tcp", tcpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitFor(t, 5*time.Second, "service to start for the connection", func() bool {
+		_, ok := reg.PIDsByServiceID()[cfg.ID]
+		return ok
+	})
+	if st, _ := reg.SocketStatus(cfg.ID); st.Awaiting {
+		t.Error("still awaiting a connection while running")
+	}
+
+	// Take the connection off the backlog as the service would have, then
+	// let it exit: it goes back to waiting rather than starting again.
+	reg.mu.Lock()
+	fd := reg.sockets[cfg.ID].files[0]
+	reg.mu.Unlock()
+	ln, err := net.FileListener(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted.Close()
+	ln.Close()
+	if err := os.WriteFile(quit, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "service to wait again", func() bool {
+		st, _ := reg.SocketStatus(cfg.ID)
+		return st.Awaiting
+	})
+	if data, _ := os.ReadFile(out); string(data) != "started\n" {
+		t.Fatalf("service runs: %q", data)
+	}
+
+	second, err := net.Dial("tcp", tcpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	waitFor(t, 5*time.Second, "second on-demand start", func() bool {
+		data, _ := os.ReadFile(out)
+		return string(data) == "started\nstarted\n"
+	})
+
+	reg.Stop(cfg.ID)
+	if reg.IsRunning(cfg.ID) {
+		t.Error("on-demand service running after Stop")
+	}
+	if _, err := net.Dial("tcp", tcpAddr); err == nil {
+		t.Error("socket still listening after Stop")
+	}
+}
+
+// The login shell is the user's $SHELL, which needn't be POSIX: fish and
+// tcsh have no $$ and no bare VAR=val;. A stand-in shell that refuses
+// anything but quoted words and plain ones must still start the service
+// with LISTEN_PID naming it.
+func TestServiceRegistry_SocketActivationNonPOSIXShell(t *testing.T) {
+	shell := filepath.Join(t.TempDir(), "nonposix")
+	writeFile(t, shell, `#!/bin/sh
+[ "$1" = -l ] && shift
+[ "$1" = -c ] || exit 2
+bare=$(printf '%s' "$2" | tr '\n' ' ' | sed "s/'[^']*'//g")
+case $bare in *'$'*|*';'*|*'='*) echo "nonposix: unsupported syntax: $bare" >&2; exit 127;; esac
+exec /bin/sh -c "$2"
+`)
+	if err := os.Chmod(shell, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SHELL", shell)
+
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	cfg, out := socketService(t, "svc-nonposix", SocketListener{Name: "http", Address: "tcp:" + freeTCPAddr(t)})
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Stop(cfg.ID)
+	waitFor(t, 5*time.Second, "service to report its sockets", func() bool {
+		data, _ := os.ReadFile(out)
+		return strings.Count(string(data), "\n") >= 2
+	})
+	if data, _ := os.ReadFile(out); string(data) != "1 http pid\nfd3\n" {
+		t.Fatalf("service saw %q", data)
+	}
+}
+
+// A service that exits with nothing to bring it back releases its sockets.
+func TestServiceRegistry_SocketsClosedOnExit(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	tcpAddr := freeTCPAddr(t)
+	cfg := ServiceConfig{ID: "svc-brief", DisplayName: "Brief", Command: "/bin/sh", Args: []string{"-c", "exit 0"},
+		Sockets: &SocketActivation{Listeners: []SocketListener{{Address: tcpAddr}}}}
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "sockets to be released", func() bool {
+		_, ok := reg.SocketStatus(cfg.ID)
+		return !ok
+	})
+	if _, err := net.Dial("tcp", tcpAddr); err == nil {
+		t.Error("socket still listening after the service exited")
+	}
+}
+
+func TestBindSockets_RefusesNonSocketFile(t *testing.T) {
+	path := shortSocketPath(t, "file")
+	if err := os.WriteFile(path, []byte("keep"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := ServiceConfig{ID: "svc", Sockets: &SocketActivation{Listeners: []SocketListener{{Address: "tcp:" + freeTCPAddr(t)}, {Address: path}}}}
+	if _, err := bindSockets(&cfg); err == nil {
+		t.Fatal("bound over a regular file")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "keep" {
+		t.Errorf("file clobbered: %q", data)
+	}
+
+	// A stale socket from an earlier run is replaced.
+	stale := shortSocketPath(t, "stale.sock")
+	ln, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	cfg.Sockets.Listeners = []SocketListener{{Address: stale}}
+	ss, err := bindSockets(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.close()
+	if len(ss.files) != 1 || ss.names[0] != "svc" {
+		t.Errorf("bound %d files, names %v", len(ss.files), ss.names)
+	}
+	if _, err := net.Dial("unix", stale); err != nil {
+		t.Errorf("dial rebound socket: %v", err)
+	}
+}
+
+// socketServices adds the socket side to statusServices.
+type socketServices struct {
+	statusServices
+	sockets map[string]serviceSocketStatus
+}
+
+func (s *socketServices) SocketStatus(id string) (serviceSocketStatus, bool) {
+	st, ok := s.sockets[id]
+	return st, ok
+}
+
+func TestAppRouter_ServiceStatusSockets(t *testing.T) {
+	s := &Settings{Services: []ServiceConfig{{ID: "eve"}, {ID: "docs"}}}
+	services := &socketServices{sockets: map[string]serviceSocketStatus{
+		"docs": {Listening: []string{"unix:/tmp/docs.sock"}, Awaiting: true},
+	}}
+	r := &appRouter{store: fixedStore{s: s}, services: services, onChange: func() {}}
+
+	got, err := r.ServiceStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if docs := got[1]; !docs.AwaitingConnection || docs.Running || len(docs.Listening) != 1 || docs.Listening[0] != "unix:/tmp/docs.sock" {
+		t.Fatalf("docs status = %+v", docs)
+	}
+	if got[0].Listening != nil || got[0].AwaitingConnection {
+		t.Fatalf("eve status = %+v", got[0])
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"relaygo/bridge"
 )
 
 // ServiceStatusClient calls one enhanced service's HTTP API over its
@@ -15,8 +19,9 @@ import (
 // (InternalSocket, InternalToken) pair declared at manifest registration —
 // no service-specific knowledge.
 //
-// Used by the status poller (status path → JSON snapshot) and the action
-// dispatcher (manifest-declared method + path → fire-and-forget call).
+// Used by the status poller (status path → JSON snapshot), the action
+// dispatcher (manifest-declared method + path → fire-and-forget call) and
+// the config editor's live reload.
 type ServiceStatusClient struct {
 	socket string
 	token  string
@@ -54,14 +59,60 @@ func (c *ServiceStatusClient) GetStatus(ctx context.Context, path string) (json.
 	return c.do(ctx, http.MethodGet, path, nil)
 }
 
-// DoAction fires a manifest-declared action. Returns the response body
-// (empty on 204) so the UI can surface server-side messages on the rare
-// action that returns one. Errors are returned for 4xx/5xx as well as
+// DoAction fires a manifest-declared action, with body (the action's
+// checked inputs) as its JSON body when there is one. Returns the response
+// body (empty on 204) so the UI can surface server-side messages on the
+// rare action that returns one. Errors are returned for 4xx/5xx as well as
 // transport failures.
-func (c *ServiceStatusClient) DoAction(ctx context.Context, method, path string) (json.RawMessage, error) {
-	return c.do(ctx, method, path, nil)
+func (c *ServiceStatusClient) DoAction(ctx context.Context, method, path string, body json.RawMessage) (json.RawMessage, error) {
+	return c.do(ctx, method, path, body)
+}
+
+// ReloadConfig asks the service to apply its freshly written config file
+// (ConfigDecl.Reload), naming the version by hash. A 400, 409 or 422 answer
+// is the service refusing the file and comes back as *configRejectedError;
+// any other failure — a 404 from a mistyped path or a 401 from a stale
+// token among them — means the reload wasn't confirmed either way.
+func (c *ServiceStatusClient) ReloadConfig(ctx context.Context, path, hash string) error {
+	body, _ := json.Marshal(bridge.ConfigReloadRequest{Hash: hash})
+	respBody, err := c.do(ctx, http.MethodPost, path, body)
+	if err != nil {
+		var herr *serviceHTTPError
+		if errors.As(err, &herr) && configRejectedStatus(herr.status) {
+			var answer bridge.ConfigReloadResponse
+			reason := strings.TrimSpace(string(herr.body))
+			if json.Unmarshal(herr.body, &answer) == nil && answer.Error != "" {
+				reason = answer.Error
+			}
+			if reason == "" {
+				reason = herr.statusText
+			}
+			return &configRejectedError{reason: reason}
+		}
+		return err
+	}
+	var ack bridge.ConfigReloadResponse
+	if json.Unmarshal(respBody, &ack) == nil && ack.Hash != "" && ack.Hash != hash {
+		return fmt.Errorf("service loaded config %s, not the saved %s", ack.Hash, hash)
+	}
+	return nil
 }
 
+// configRejectedStatus reports whether a reload's answer status means the
+// service judged the file and refused it, rather than never getting to it.
+func configRejectedStatus(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// configRejectedError is a service refusing a config file on reload.
+type configRejectedError struct{ reason string }
+
+func (e *configRejectedError) Error() string { return "service rejected the config: " + e.reason }
+
 // CloseIdleConnections releases this client's pooled connections. Callers that
 // build a client per use (the status poller fans out one per service per tick,
 // the action dispatcher one per action) must call this when done, or each
@@ -96,7 +147,21 @@ func (c *ServiceStatusClient) do(ctx context.Context, method, path string, body
 		return nil, fmt.Errorf("read body: %w", err)
 	}
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, string(respBody))
+		return nil, &serviceHTTPError{method: method, path: path, status: resp.StatusCode, statusText: resp.Status, body: respBody}
 	}
 	return json.RawMessage(respBody), nil
 }
+
+// serviceHTTPError is a service's own error response, kept typed so a
+// caller can tell the service refusing a request (the config reload's 4xx)
+// from failing to reach it.
+type serviceHTTPError struct {
+	method, path string
+	status       int
+	statusText   string
+	body         []byte
+}
+
+func (e *serviceHTTPError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.method, e.path, e.statusText, string(e.body))
+}
@@ -186,7 +186,7 @@ func TestServiceStatusClient_DoAction_NoContentIsSuccess(t *testing.T) {
 	srv.script("DELETE", "/api/llama/instances/qwen3-8b", 204, "")
 
 	client := NewServiceStatusClient(srv.socket, "tok")
-	body, err := client.DoAction(context.Background(), "DELETE", "/api/llama/instances/qwen3-8b")
+	body, err := client.DoAction(context.Background(), "DELETE", "/api/llama/instances/qwen3-8b", nil)
 	if err != nil {
 		t.Fatalf("DoAction: %v", err)
 	}
@@ -200,7 +200,7 @@ func TestServiceStatusClient_DoAction_4xxIsError(t *testing.T) {
 	srv.script("DELETE", "/api/llama/instances/missing", 404, `{"error":"no such instance"}`)
 
 	client := NewServiceStatusClient(srv.socket, "tok")
-	_, err := client.DoAction(context.Background(), "DELETE", "/api/llama/instances/missing")
+	_, err := client.DoAction(context.Background(), "DELETE", "/api/llama/instances/missing", nil)
 	if err == nil {
 		t.Fatal("expected error on 404")
 	}
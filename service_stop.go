@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Graceful stop for managed services.
+//
+// Stopping a service (Stop, Reload, StopAll) goes:
+//
+//  1. pre_stop, if set: an HTTP call to the service, or one of the actions
+//     its manifest declares, so it can drain or flush before the signal.
+//     Bounded by its own timeout; a failure is logged and the stop goes on.
+//  2. stop_signal (SIGTERM unless set) to the whole process group.
+//  3. stop_timeout_sec for the group to exit, then SIGKILL for whatever is
+//     left. The escalation is recorded as the service's last exit, so
+//     `relay service list` and the tray say the service had to be killed.
+//
+// The health monitor's kill of an unhealthy service skips step 1 — the
+// service isn't answering — but uses the same signal and timeout.
+
+const (
+	// defaultStopTimeout is the grace relay has always given a service
+	// between SIGTERM and SIGKILL; longer is opt-in, so quitting the tray
+	// isn't held up by services that never asked for it.
+	defaultStopTimeout    = time.Second
+	defaultPreStopTimeout = 5 * time.Second
+)
+
+// PreStopHook is a service's `pre_stop`: a call relay makes before
+// signalling it to stop. Exactly one of HTTP and Action is set.
+type PreStopHook struct {
+	// HTTP is a path ("/drain") or an absolute http(s) URL. A path goes to
+	// the service's internal socket once it has registered a manifest (with
+	// its internal token), and otherwise to its URL, as for health checks.
+	HTTP string `json:"http,omitempty"`
+	// Method is the HTTP method. Empty means POST.
+	Method string `json:"method,omitempty"`
+	// Action is the ID of an action in the service's manifest, called the
+	// way the settings UI would. It must not be a forEach action.
+	Action string `json:"action,omitempty"`
+	// TimeoutSec bounds the call. 0 means 5.
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+}
+
+func (h *PreStopHook) validate() error {
+	if h == nil {
+		return nil
+	}
+	if (h.HTTP == "") == (h.Action == "") {
+		return fmt.Errorf("pre_stop needs exactly one of http and action")
+	}
+	if h.TimeoutSec < 0 {
+		return fmt.Errorf("pre_stop timeout must not be negative")
+	}
+	if h.HTTP != "" && !isPathOrHTTPURL(h.HTTP) {
+		return fmt.Errorf("pre_stop http %q must be a path or an http(s) URL", h.HTTP)
+	}
+	if h.Method != "" && h.Action != "" {
+		return fmt.Errorf("pre_stop method applies to http, not to an action (it uses the manifest's)")
+	}
+	return nil
+}
+
+func (h *PreStopHook) method() string {
+	if h.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(h.Method)
+}
+
+func (h *PreStopHook) timeout() time.Duration {
+	return secondsOr(h.TimeoutSec, defaultPreStopTimeout)
+}
+
+// String renders the hook, e.g. "POST /drain" or "action flush".
+func (h *PreStopHook) String() string {
+	switch {
+	case h == nil:
+		return "-"
+	case h.Action != "":
+		return "action " + h.Action
+	default:
+		return h.method() + " " + h.HTTP
+	}
+}
+
+// formatStop renders a service's stop settings for `relay service show`:
+// "-" for the defaults, else e.g. "SIGINT 30s, pre-stop POST /drain".
+func formatStop(cfg *ServiceConfig) string {
+	if cfg.StopSignal == "" && cfg.StopTimeoutSec == 0 && cfg.PreStop == nil {
+		return "-"
+	}
+	plan := newStopPlan(cfg)
+	s := signalName(plan.signal) + " " + plan.timeout.String()
+	if cfg.PreStop != nil {
+		s += ", pre-stop " + cfg.PreStop.String()
+	}
+	return s
+}
+
+// stopPlan is how one process is to be stopped, captured from its config
+// at start so a settings change doesn't alter a running process's stop.
+type stopPlan struct {
+	signal  syscall.Signal
+	timeout time.Duration
+	preStop *PreStopHook
+	url     string // the service URL, for a pre_stop path before registration
+}
+
+func newStopPlan(cfg *ServiceConfig) stopPlan {
+	sig, err := parseStopSignal(cfg.StopSignal)
+	if err != nil { // Validate has already rejected it; belt and braces
+		sig = syscall.SIGTERM
+	}
+	return stopPlan{
+		signal:  sig,
+		timeout: secondsOr(cfg.StopTimeoutSec, defaultStopTimeout),
+		preStop: cfg.PreStop,
+		url:     cfg.URL,
+	}
+}
+
+// escalatedStatus is the exit status recorded when a stop had to SIGKILL.
+func (p stopPlan) escalatedStatus() string {
+	return fmt.Sprintf("killed: SIGKILL after %s (did not stop within %s)", signalName(p.signal), p.timeout)
+}
+
+// signalName is "SIGTERM" for syscall.SIGTERM, and so on.
+func signalName(sig syscall.Signal) string {
+	for name, s := range stopSignals {
+		if s == sig {
+			return "SIG" + name
+		}
+	}
+	return sig.String()
+}
+
+// stopProcess shuts proc down per its stop plan — pre-stop hook, signal,
+// SIGKILL after the timeout — and returns once the process is reaped. The
+// caller has already marked proc stopping.
+func (r *ServiceRegistry) stopProcess(id string, proc *serviceProcess) {
+	if proc.stop.preStop != nil {
+		r.runPreStop(id, proc)
+	}
+	r.terminate(id, proc)
+	<-proc.done
+}
+
+// terminate sends proc's stop signal and escalates to SIGKILL if its process
+// group outlives the stop timeout, recording that it had to.
+func (r *ServiceRegistry) terminate(id string, proc *serviceProcess) {
+	signalProcessGroup(proc.cmd, proc.stop.signal)
+	if waitProcessGroup(proc.cmd, proc.stop.timeout) {
+		return
+	}
+
+	r.mu.Lock()
+	proc.escalated = true
+	if proc.exited && !proc.unhealthy {
+		// The shell exited on the signal but left part of its group
+		// running; the reaper has already recorded the exit, so correct it.
+		exit := r.exits[id]
+		exit.Status = proc.stop.escalatedStatus()
+		r.exits[id] = exit
+	}
+	r.mu.Unlock()
+
+	slog.Warn("service did not stop in time; killing",
+		"id", id, "signal", signalName(proc.stop.signal), "timeout", proc.stop.timeout)
+	signalProcessGroup(proc.cmd, syscall.SIGKILL)
+}
+
+// runPreStop makes proc's pre-stop call. It's cut short if the process exits
+// meanwhile, and a failure only gets logged: the service is stopped either way.
+func (r *ServiceRegistry) runPreStop(id string, proc *serviceProcess) {
+	hook := proc.stop.preStop
+	ctx, cancel := context.WithTimeout(context.Background(), hook.timeout())
+	defer cancel()
+	go func() {
+		select {
+		case <-proc.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var err error
+	if hook.Action != "" {
+		err = r.callManifestAction(ctx, id, hook.Action)
+	} else {
+		err = r.serviceHTTP(ctx, id, proc.stop.url, hook.method(), hook.HTTP)
+	}
+	if err != nil {
+		select {
+		case <-proc.done:
+			return // exited during the call; nothing went wrong
+		default:
+		}
+		slog.Warn("service pre-stop failed; stopping anyway", "id", id, "pre_stop", hook.String(), "error", err)
+	}
+}
+
+// callManifestAction calls a non-forEach action from the service's
+// registered manifest. The manifest is the whitelist, as for the settings
+// UI's action buttons (ipc_service_action.go).
+func (r *ServiceRegistry) callManifestAction(ctx context.Context, id, actionID string) error {
+	var rec *EnhancedService
+	if r.Enhanced != nil {
+		rec = r.Enhanced.Get(id)
+	}
+	if rec == nil {
+		return errors.New("service has not registered a manifest")
+	}
+	action := findAction(rec.Manifest.Actions, actionID)
+	if action == nil {
+		return fmt.Errorf("action %q is not declared in the service's manifest", actionID)
+	}
+	path, err := buildActionPath(action, nil)
+	if err != nil {
+		return err
+	}
+	// No one is there to fill in a form: an action with inputs only works
+	// as a hook when none of them is required.
+	body, err := actionBody(action, nil)
+	if err != nil {
+		return err
+	}
+	client := NewServiceStatusClient(rec.InternalSocket, rec.InternalToken)
+	defer client.CloseIdleConnections()
+	client.http.Timeout = 0 // ctx carries the pre-stop timeout
+	_, err = client.DoAction(ctx, action.Method, path, body)
+	return err
+}
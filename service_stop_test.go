@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"relaygo/bridge"
+)
+
+func TestStopSettings_Validate(t *testing.T) {
+	for name, want := range map[string]syscall.Signal{"": syscall.SIGTERM, "INT": syscall.SIGINT, "sigquit": syscall.SIGQUIT, "SIGUSR2": syscall.SIGUSR2} {
+		if got, err := parseStopSignal(name); err != nil || got != want {
+			t.Errorf("parseStopSignal(%q) = %v, %v", name, got, err)
+		}
+	}
+	for _, bad := range []string{"KILL", "STOP", "9"} {
+		if _, err := parseStopSignal(bad); err == nil {
+			t.Errorf("stop signal %q accepted", bad)
+		}
+	}
+
+	for _, h := range []*PreStopHook{
+		{},
+		{HTTP: "/drain", Action: "drain"},
+		{HTTP: "drain"},
+		{Action: "drain", Method: "PUT"},
+		{HTTP: "/drain", TimeoutSec: -1},
+	} {
+		if err := h.validate(); err == nil {
+			t.Errorf("pre_stop %+v validated", *h)
+		}
+	}
+	if err := (&PreStopHook{HTTP: "http://127.0.0.1:9/flush", Method: "put"}).validate(); err != nil {
+		t.Errorf("valid pre_stop: %v", err)
+	}
+
+	svc := ServiceConfig{ID: "web", DisplayName: "Web", Command: "/bin/true", StopSignal: "KILL"}
+	if err := svc.Validate(); err == nil {
+		t.Error("service with stop_signal KILL validated")
+	}
+
+	if got := formatStop(&ServiceConfig{}); got != "-" {
+		t.Errorf("default formatStop = %q", got)
+	}
+	got := formatStop(&ServiceConfig{StopSignal: "int", StopTimeoutSec: 30, PreStop: &PreStopHook{HTTP: "/drain"}})
+	if got != "SIGINT 30s, pre-stop POST /drain" {
+		t.Errorf("formatStop = %q", got)
+	}
+}
+
+// trapService runs a shell that handles sig by noting it in the returned
+// file and exiting, after lingering for delay.
+func trapService(t *testing.T, id, sig, delay string) (ServiceConfig, string) {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "signals")
+	script := `trap 'echo ` + sig + ` >> "$OUT"; sleep ` + delay + `; exit 0' ` + sig + `; while :; do sleep 0.1; done`
+	return ServiceConfig{ID: id, DisplayName: id, Command: "/bin/sh", Args: []string{"-c", script},
+		Env: map[string]string{"OUT": out}}, out
+}
+
+func TestServiceRegistry_StopUsesStopSignal(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	cfg, out := trapService(t, "svc-int", "INT", "0")
+	cfg.StopSignal = "INT"
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond) // let the shell install its trap
+	reg.Stop(cfg.ID)
+
+	if data, _ := os.ReadFile(out); strings.TrimSpace(string(data)) != "INT" {
+		t.Fatalf("service saw %q, want INT", data)
+	}
+	if exit, _ := reg.LastExit(cfg.ID); exit.Status != "exited: status 0" {
+		t.Errorf("last exit = %q", exit.Status)
+	}
+}
+
+// A service gets its full stop timeout to shut down, and one that overstays
+// it is SIGKILLed with the escalation on record.
+func TestServiceRegistry_StopTimeoutAndEscalation(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+
+	// Needs 1.5s to wrap up: fine with a 3s timeout, not with the default 1s.
+	slow, out := trapService(t, "svc-slow", "TERM", "1.5")
+	slow.StopTimeoutSec = 3
+	if err := reg.Start(&slow); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	reg.Stop(slow.ID)
+	if exit, _ := reg.LastExit(slow.ID); exit.Status != "exited: status 0" {
+		t.Errorf("slow service last exit = %q, want a clean exit", exit.Status)
+	}
+	if data, _ := os.ReadFile(out); len(data) == 0 {
+		t.Error("slow service never saw SIGTERM")
+	}
+
+	stubborn := ServiceConfig{ID: "svc-stubborn", DisplayName: "Stubborn", Command: "/bin/sh",
+		Args: []string{"-c", `trap '' TERM; while :; do sleep 0.1; done`}, StopTimeoutSec: 1}
+	if err := reg.Start(&stubborn); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	begin := time.Now()
+	reg.Stop(stubborn.ID)
+	if took := time.Since(begin); took < time.Second || took > 5*time.Second {
+		t.Errorf("stop took %v, want the 1s timeout then a kill", took)
+	}
+	exit, _ := reg.LastExit(stubborn.ID)
+	if exit.Status != "killed: SIGKILL after SIGTERM (did not stop within 1s)" {
+		t.Fatalf("last exit = %q", exit.Status)
+	}
+	if reg.IsRunning(stubborn.ID) {
+		t.Fatal("stubborn service still running")
+	}
+}
+
+// The pre-stop call reaches the service while it is still running, before
+// the stop signal.
+func TestServiceRegistry_PreStopHTTP(t *testing.T) {
+	_, reg := startSandboxBridge(t, NewEnhancedServiceRegistry(nil))
+	cfg, out := trapService(t, "svc-drain", "TERM", "0")
+
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signalled, _ := os.ReadFile(out)
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path+" signalled="+strings.TrimSpace(string(signalled)))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	cfg.URL = srv.URL
+	cfg.PreStop = &PreStopHook{HTTP: "/drain"}
+
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	reg.Stop(cfg.ID)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 1 || calls[0] != "POST /drain signalled=" {
+		t.Fatalf("pre-stop calls = %q", calls)
+	}
+	if data, _ := os.ReadFile(out); strings.TrimSpace(string(data)) != "TERM" {
+		t.Errorf("service not signalled after pre-stop: %q", data)
+	}
+}
+
+// A pre-stop action is looked up in the registered manifest and called over
+// the internal socket; a hook that fails doesn't stop the stop.
+func TestServiceRegistry_PreStopAction(t *testing.T) {
+	enhanced := NewEnhancedServiceRegistry(nil)
+	_, reg := startSandboxBridge(t, enhanced)
+	manifest := newManifest("/api/q/")
+	manifest.Actions = []bridge.ActionDecl{{ID: "flush", Label: "Flush", Method: "POST", PathTemplate: "/admin/flush"}}
+	fake := NewFakeService(t, FakeServiceOptions{ServiceID: "svc-q", Manifest: manifest})
+
+	cfg := ServiceConfig{ID: "svc-q", DisplayName: "Queue", Command: "/bin/sleep", Args: []string{"30"},
+		PreStop: &PreStopHook{Action: "flush"}}
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := enhanced.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()); err != nil {
+		t.Fatal(err)
+	}
+	reg.Stop(cfg.ID)
+	got := fake.LastRequest()
+	if got == nil || got.Method != "POST" || got.Path != "/admin/flush" || got.Headers.Get("Authorization") != "Bearer "+fake.Token() {
+		t.Fatalf("pre-stop action request = %+v", got)
+	}
+
+	// Undeclared action: logged, and the service is stopped regardless.
+	cfg.PreStop = &PreStopHook{Action: "nope"}
+	if err := reg.Start(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := enhanced.RegisterManifest(fake.ServiceID(), fake.Socket(), fake.Token(), fake.Manifest()); err != nil {
+		t.Fatal(err)
+	}
+	reg.Stop(cfg.ID)
+	if reg.IsRunning(cfg.ID) {
+		t.Fatal("service still running after a failed pre-stop")
+	}
+}
@@ -36,6 +36,20 @@ type Settings struct {
 	// open a network socket. omitempty keeps every install that has not enabled
 	// one byte-identical to the one it had before this field existed.
 	Remote *RemoteConfig `json:"remote,omitempty"`
+
+	// Frontend configures the optional TCP listener the frontend API serves
+	// on beside its Unix socket, and which browser origins may call it
+	// (frontend_tcp.go). Absent means no TCP listener, like Remote.
+	Frontend *FrontendConfig `json:"frontend,omitempty"`
+
+	// FrontendCredentials are the scoped bearers for the frontend API
+	// besides the frontend channel's own token (frontend_credentials.go).
+	FrontendCredentials []FrontendCredential `json:"frontend_credentials,omitempty"`
+
+	// EnvProfiles are named sets of env vars services share by listing
+	// them in their own env_profiles (service_env.go). omitempty like the
+	// blocks above.
+	EnvProfiles map[string]map[string]string `json:"env_profiles,omitempty"`
 }
 
 // ---------------------------------------------------------------------------
@@ -168,6 +182,12 @@ func (s *Settings) MergeServiceDefaults(cfg *ServiceConfig) {
 	if cfg.Env == nil {
 		cfg.Env = existing.Env
 	}
+	if cfg.EnvFiles == nil {
+		cfg.EnvFiles = existing.EnvFiles
+	}
+	if cfg.EnvProfiles == nil {
+		cfg.EnvProfiles = existing.EnvProfiles
+	}
 	if cfg.Args == nil {
 		cfg.Args = existing.Args
 	}
@@ -180,6 +200,39 @@ func (s *Settings) MergeServiceDefaults(cfg *ServiceConfig) {
 	if cfg.FrontendConsumer == nil {
 		cfg.FrontendConsumer = existing.FrontendConsumer
 	}
+	if cfg.Limits == nil {
+		cfg.Limits = existing.Limits
+	}
+	if cfg.Restart == nil {
+		cfg.Restart = existing.Restart
+	}
+	if cfg.Health == nil {
+		cfg.Health = existing.Health
+	}
+	if cfg.DependsOn == nil {
+		cfg.DependsOn = existing.DependsOn
+	}
+	if cfg.StopSignal == "" {
+		cfg.StopSignal = existing.StopSignal
+	}
+	if cfg.StopTimeoutSec == 0 {
+		cfg.StopTimeoutSec = existing.StopTimeoutSec
+	}
+	if cfg.PreStop == nil {
+		cfg.PreStop = existing.PreStop
+	}
+	if cfg.Kind == "" {
+		cfg.Kind = existing.Kind
+	}
+	if cfg.Job == nil && cfg.isJob() {
+		cfg.Job = existing.Job
+	}
+	if cfg.Sockets == nil && !cfg.isJob() {
+		cfg.Sockets = existing.Sockets
+	}
+	if cfg.Replicas == 0 && !cfg.isJob() {
+		cfg.Replicas = existing.Replicas
+	}
 }
 
 // ResolveServiceID returns the ID of a service found by exact id or display name lookup.
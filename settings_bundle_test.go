@@ -16,6 +16,7 @@ package main
 // the current web/src tree (not the committed web/dist artifact).
 
 import (
+	"regexp"
 	"strings"
 	"testing"
 
@@ -144,6 +145,27 @@ func TestPureScanRequired(t *testing.T) {
 	}
 }
 
+func TestPureActionFlags(t *testing.T) {
+	vm := newPureVM(t)
+	cases := []struct{ name, expr, want string }{
+		{"DELETE is danger", `String(PURE.actionIsDanger({method:'delete'}))`, `true`},
+		{"declared danger", `String(PURE.actionIsDanger({method:'POST', danger:true}))`, `true`},
+		{"plain POST", `String(PURE.actionIsDanger({method:'POST'}))`, `false`},
+		{"inputs open a form", `String(PURE.actionNeedsForm({inputs:[{id:'a',type:'text'}]}))`, `true`},
+		{"confirm opens a form", `String(PURE.actionNeedsForm({confirm:'Sure?'}))`, `true`},
+		{"danger opens a form", `String(PURE.actionNeedsForm({danger:true}))`, `true`},
+		{"DELETE alone runs", `String(PURE.actionNeedsForm({method:'DELETE', inputs:[]}))`, `false`},
+		{"no action", `String(PURE.actionNeedsForm(null))`, `false`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := evalString(t, vm, c.expr); got != c.want {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+}
+
 func TestPureFormatScalar(t *testing.T) {
 	vm := newPureVM(t)
 	cases := []struct{ name, expr, want string }{
@@ -166,6 +188,47 @@ func TestPureFormatScalar(t *testing.T) {
 	}
 }
 
+func TestPureFormatServiceLogLine(t *testing.T) {
+	vm := newPureVM(t)
+	cases := []struct{ name, expr, want string }{
+		{"plain text", `PURE.formatServiceLogLine({text:'listening on :8080'})`, `-  listening on :8080`},
+		{"json line sorted + quoted", `PURE.formatServiceLogLine({text:'{}', level:'WARN', msg:'slow', fields:{table:'users', ms:1500, sql:'select *'}})`, `-  WARN  slow ms=1500 sql="select *" table=users`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := evalString(t, vm, c.expr); got != c.want {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+	// A stamped line leads with a local HH:MM:SS.mmm.
+	if got := evalString(t, vm, `PURE.formatServiceLogLine({time:'2026-03-01T12:00:00.250Z', text:'hi'})`); !regexp.MustCompile(`^\d\d:\d\d:\d\d\.250  hi$`).MatchString(got) {
+		t.Errorf("stamped line = %q", got)
+	}
+}
+
+func TestPureFormatJobSchedule(t *testing.T) {
+	vm := newPureVM(t)
+	cases := []struct{ name, expr, want string }{
+		{"one-shot", `PURE.formatJobSchedule(null)`, `one-shot`},
+		{"cron", `PURE.formatJobSchedule({schedule:'0 3 * * *'})`, `0 3 * * *`},
+		{"interval + extras", `PURE.formatJobSchedule({interval_sec:5400, timeout_sec:90, overlap:'queue'})`, `every 1h30m, timeout 1m30s, overlap queue`},
+		{"default overlap hidden", `PURE.formatJobSchedule({interval_sec:600, overlap:'skip'})`, `every 10m`},
+		{"duration units", `PURE.formatDuration(45) + ' ' + PURE.formatDuration(3600) + ' ' + PURE.formatDuration(187200)`, `45s 1h 2d4h`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := evalString(t, vm, c.expr); got != c.want {
+				t.Errorf("got %q want %q", got, c.want)
+			}
+		})
+	}
+	got := evalString(t, vm, `PURE.formatJobRun({start:'2026-03-01T12:00:00Z', duration_ms:1500, exit_code:0, status:'exited: status 0', trigger:'schedule'})`)
+	if !regexp.MustCompile(`^\d+/\d+ \d\d:\d\d:00  exited: status 0 in 2s \(schedule\)$`).MatchString(got) {
+		t.Errorf("formatJobRun = %q", got)
+	}
+}
+
 // domShim is a minimal document/window/navigator surface so the full app bundle
 // can load and run its bootstrap render() without a real browser.
 const domShim = `
@@ -395,6 +458,67 @@ func TestActionPendingKeyCanonical(t *testing.T) {
 	}
 }
 
+// An action with inputs or a confirmation opens a form instead of running:
+// the inputs render through the config renderer, a missing required field
+// keeps it open, and Run sends the draft as inputs with confirmed set. A
+// plain action still runs on the click.
+func TestActionFormCollectsInputs(t *testing.T) {
+	vm := newAppVM(t)
+	script := `(function(){
+		var sent = [];
+		window.webkit = { messageHandlers: { ipc: { postMessage: function(m){ sent.push(JSON.parse(m)); } } } };
+		window.showPage('inspector');
+		window.onServiceStatusBatch([{serviceId:'relay-llm', ok:true, fetchedAt:1, status:{sessions:[{id:'s1'}]},
+			manifest:{routes:['/x'], actions:[
+				{id:'rename', label:'Rename', method:'POST', pathTemplate:'/s/{id}/rename', forEach:'sessions',
+				 inputs:[{id:'title', type:'text', label:'Title', required:true}, {id:'pin', type:'bool', label:'Pin'}]},
+				{id:'wipe', label:'Wipe', method:'POST', pathTemplate:'/wipe', danger:true},
+				{id:'ping', label:'Ping', method:'POST', pathTemplate:'/ping'}]}}]);
+
+		window.startServiceAction('relay-llm', 'ping', null);
+		var ping = sent[sent.length-1];
+
+		window.startServiceAction('relay-llm', 'rename', {id:'s1'});
+		var sentBefore = sent.length;
+		var form = window.renderActionForm('relay-llm');
+		var region = document.getElementById('content').innerHTML.indexOf('svc-actform-relay-llm') >= 0;
+		window.runActionForm();
+		var heldBack = sent.length === sentBefore;
+		var missing = window.state.actionForm && window.state.actionForm.error;
+		var b = window.state._cfgBind.findIndex(function(x){ return x.path[0] === 'title'; });
+		window.cfgEdit(b, {value:'Planning'});
+		window.runActionForm();
+		var rename = sent[sent.length-1];
+		var closed = window.state.actionForm === null;
+
+		window.startServiceAction('relay-llm', 'wipe', null);
+		var wipeForm = window.renderActionForm('relay-llm');
+		window.cancelActionForm();
+		return JSON.stringify({
+			ping: ping.actionId + ':' + ('confirmed' in ping),
+			region: region,
+			title: form.indexOf('Title *') >= 0, pin: form.indexOf('Pin') >= 0,
+			heldBack: heldBack,
+			missing: missing,
+			rename: rename,
+			closed: closed,
+			wipeAsks: wipeForm.indexOf('Run Wipe?') >= 0 && wipeForm.indexOf('btn-danger') >= 0,
+			cancelled: window.state.actionForm === null
+		});
+	})()`
+	got := evalString(t, vm, script)
+	for _, want := range []string{
+		`"ping":"ping:false"`, `"region":true`, `"title":true`, `"pin":true`, `"heldBack":true`,
+		`"missing":"Required field missing: Title"`,
+		`"rename":{"type":"service_action","serviceId":"relay-llm","actionId":"rename","row":{"id":"s1"},"inputs":{"title":"Planning"},"confirmed":true}`,
+		`"closed":true`, `"wipeAsks":true`, `"cancelled":true`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("action form: missing %s in %s", want, got)
+		}
+	}
+}
+
 // itoaTest is a tiny int->string for building JS literals in tests.
 func itoaTest(n int) string {
 	if n == 0 {
@@ -407,3 +531,77 @@ func itoaTest(n int) string {
 	}
 	return string(b)
 }
+
+// TestServiceLogPaneFollows covers the Services tab log pane: opening it asks
+// for history, a reply fills the pane, and the 2s status poll then follows
+// with the reply's cursor — appending, not replacing.
+func TestServiceLogPaneFollows(t *testing.T) {
+	vm := newAppVM(t)
+	script := `(function(){
+		var sent = [];
+		window.webkit = { messageHandlers: { ipc: { postMessage: function(m){ sent.push(JSON.parse(m)); } } } };
+		window.state.services = [{id:'svc-web', display_name:'Web', command:'/bin/web', autostart:false}];
+		window.toggleServiceLogs('svc-web');
+		var first = sent[sent.length-1];
+		var html = window.renderServices();
+		window.onServiceLogs({id:'svc-web', lines:[{text:'one'}], cursor:10, append:false});
+		window.onServiceStatus(['svc-web']);
+		var follow = sent[sent.length-1];
+		window.onServiceLogs({id:'svc-web', lines:[{text:'two'}], cursor:20, append:true});
+		window.onServiceLogs({id:'svc-other', lines:[{text:'stray'}], cursor:5, append:false});
+		return JSON.stringify({
+			firstType: first.type, firstCursor: 'cursor' in first,
+			pane: html.indexOf('svc-logs-svc-web') >= 0 && html.indexOf('Hide Logs') >= 0,
+			followCursor: follow.cursor,
+			text: document.getElementById('svc-logs-svc-web').innerHTML
+		});
+	})()`
+	got := evalString(t, vm, script)
+	for _, want := range []string{
+		`"firstType":"service_logs"`, `"firstCursor":false`, `"pane":true`,
+		`"followCursor":10`, `"text":"-  one\n-  two"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log pane: missing %s in %s", want, got)
+		}
+	}
+}
+
+// A job's card gets a Run Now button and its recent runs, refreshed in place
+// from onJobStatus, which the status poll asks for while jobs are listed.
+func TestJobCardShowsRuns(t *testing.T) {
+	vm := newAppVM(t)
+	script := `(function(){
+		var sent = [];
+		window.webkit = { messageHandlers: { ipc: { postMessage: function(m){ sent.push(JSON.parse(m)); } } } };
+		window.state.services = [
+			{id:'svc-web', display_name:'Web', command:'/bin/web', autostart:false},
+			{id:'backup', display_name:'Backup', command:'/bin/backup', autostart:true, kind:'job', job:{schedule:'0 3 * * *'}}
+		];
+		var html = window.renderServices();
+		window.onServiceStatus(['backup']);
+		var poll = sent[sent.length-1];
+		window.onJobStatus([{id:'backup', scheduled:true, runs:[
+			{start:'2026-03-01T03:00:00Z', duration_ms:2000, exit_code:0, status:'exited: status 0', trigger:'schedule'},
+			{start:'2026-03-02T03:00:00Z', duration_ms:0, exit_code:-1, status:'skipped: previous run still going', trigger:'schedule'}
+		]}]);
+		window.runJobNow('backup');
+		return JSON.stringify({
+			runNow: (html.match(/Run Now/g) || []).length,
+			scheduled: html.indexOf('Scheduled') >= 0,
+			schedule: html.indexOf('job: 0 3 * * *') >= 0,
+			poll: poll.type,
+			run: sent[sent.length-1],
+			runs: document.getElementById('job-runs-backup').innerHTML
+		});
+	})()`
+	got := evalString(t, vm, script)
+	for _, want := range []string{
+		`"runNow":1`, `"scheduled":true`, `"schedule":true`, `"poll":"job_status"`,
+		`"run":{"type":"run_job","id":"backup"}`, `skipped: previous run still going (schedule)<br>`, `exited: status 0 in 2s (schedule)`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("job card: missing %s in %s", want, got)
+		}
+	}
+}
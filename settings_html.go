@@ -30,15 +30,20 @@ func mustMarshalJSON(label string, v interface{}) string {
 // renderSettingsHTML produces the initial WebView document. toolCache is the
 // per-MCP tool list (mcpID → []ToolInfo) used by the Projects tab's tri-state
 // picker; it's preseeded so the first paint of a project edit form doesn't
-// have to round-trip an IPC for every allowed MCP. Pass nil in tests that
-// don't exercise the picker.
-func renderSettingsHTML(settings *Settings, runningIDs []string, toolCache map[string][]ToolInfo) string {
+// have to round-trip an IPC for every allowed MCP. authStates is the live
+// McpAuthState of each connected HTTP MCP, so the auth badges are right on
+// first paint rather than guessed from the persisted tokens. Pass nil in
+// tests that don't exercise either.
+func renderSettingsHTML(settings *Settings, runningIDs []string, toolCache map[string][]ToolInfo, authStates map[string]McpAuthState) string {
 	if runningIDs == nil {
 		runningIDs = []string{}
 	}
 	if toolCache == nil {
 		toolCache = map[string][]ToolInfo{}
 	}
+	if authStates == nil {
+		authStates = map[string]McpAuthState{}
+	}
 	projects := settings.Projects
 	if projects == nil {
 		projects = []Project{}
@@ -56,6 +61,10 @@ func renderSettingsHTML(settings *Settings, runningIDs []string, toolCache map[s
 	// edits and what NewRemoteServer's refusal is phrased in terms of; the IPC
 	// handlers, which do hold the recorder, pass its live answer instead (see
 	// remoteConfigViewOf).
+	frontendCreds := settings.FrontendCredentials
+	if frontendCreds == nil {
+		frontendCreds = []FrontendCredential{}
+	}
 	remote := remoteConfigViewOf(settings, settings.Audit.resolve().Enabled)
 	return strings.NewReplacer(
 		"__EXTERNAL_MCPS_JSON__", mustMarshalJSON("external_mcps", settings.ExternalMcps),
@@ -63,8 +72,10 @@ func renderSettingsHTML(settings *Settings, runningIDs []string, toolCache map[s
 		"__RUNNING_IDS_JSON__", mustMarshalJSON("running_ids", runningIDs),
 		"__PROJECTS_JSON__", mustMarshalJSON("projects", projects),
 		"__MCP_TOOL_CACHE_JSON__", mustMarshalJSON("mcp_tool_cache", toolCache),
+		"__MCP_AUTH_STATES_JSON__", mustMarshalJSON("mcp_auth_states", authStates),
 		"__ENROLMENTS_JSON__", mustMarshalJSON("enrolments", enrolments),
 		"__REMOTE_JSON__", mustMarshalJSON("remote", remote),
 		"__ENROLMENT_BUDGET_DEFAULTS_JSON__", mustMarshalJSON("enrolment_budget_defaults", enrolmentBudgetDefaults()),
+		"__FRONTEND_CREDENTIALS_JSON__", mustMarshalJSON("frontend_credentials", frontendCreds),
 	).Replace(settingsHTML)
 }
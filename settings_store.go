@@ -34,18 +34,33 @@ type FileSettingsStore struct {
 	cache       *Settings
 	lastModTime int64
 	dir         string // config directory (injected for testability)
+
+	// keyPath is the secret-store master key (see secret_store.go). Empty
+	// means <dir>/secrets.key, which is what struct-literal test stores get.
+	keyPath string
+	// secretRefs records, for the settings last loaded, which credential
+	// fields were `secret://` references and to which entry, so save writes
+	// the same references back instead of inventing canonical ones.
+	secretRefs map[string]string
 }
 
 // NewSettingsStore creates a new file-backed settings store using the default
 // platform config directory.
+//
+// RELAY_SECRETS_KEY_FILE, if set, relocates the secret-store master key.
 func NewSettingsStore() *FileSettingsStore {
-	return &FileSettingsStore{dir: bridge.ConfigDir()}
+	return NewSettingsStoreAt(bridge.ConfigDir())
 }
 
 // NewSettingsStoreAt creates a file-backed settings store rooted at dir.
 // Useful for testing without touching the real config directory.
+//
+// It honours RELAY_SECRETS_KEY_FILE just as NewSettingsStore does: a store
+// that looked for the key in dir while the user keeps it elsewhere would
+// resolve every reference to "" and then refuse to save. (TestMain clears
+// the variable so tests never see a developer's real key.)
 func NewSettingsStoreAt(dir string) *FileSettingsStore {
-	return &FileSettingsStore{dir: dir}
+	return &FileSettingsStore{dir: dir, keyPath: defaultSecretKeyPath(dir)}
 }
 
 // path returns the full path to settings.json.
@@ -53,6 +68,14 @@ func (ss *FileSettingsStore) path() string {
 	return filepath.Join(ss.dir, "settings.json")
 }
 
+// secretKeyPath returns the secret-store master key location.
+func (ss *FileSettingsStore) secretKeyPath() string {
+	if ss.keyPath != "" {
+		return ss.keyPath
+	}
+	return filepath.Join(ss.dir, secretKeyFileName)
+}
+
 const currentSettingsVersion = 1
 
 func defaultSettings() *Settings {
@@ -85,9 +108,30 @@ func (ss *FileSettingsStore) load() *Settings {
 		return defaultSettings()
 	}
 	s.normalize()
+	ss.resolveSecrets(&s)
 	return &s
 }
 
+// resolveSecrets swaps `secret://` references in freshly loaded settings for
+// their plaintext. Caller must hold the mutex.
+//
+// A store that fails to open (bad key permissions, tampered file) is logged
+// and treated like a missing one: every reference resolves to "" — the
+// affected MCPs fail to authenticate and say so, which beats refusing to load
+// settings at all. The references themselves survive in ss.secretRefs, and
+// save refuses to run while the store is unreadable, so nothing is lost.
+func (ss *FileSettingsStore) resolveSecrets(s *Settings) {
+	st, err := openSecretStore(ss.dir, ss.secretKeyPath())
+	if err != nil {
+		slog.Error("failed to open secret store", "error", err)
+	}
+	refs, errs := resolveSecretRefs(s, st)
+	for _, e := range errs {
+		slog.Warn("unresolved secret reference", "error", e)
+	}
+	ss.secretRefs = refs
+}
+
 // ensureSlice replaces a nil slice with an empty one of the same type.
 func ensureSlice[T any](s *[]T) {
 	if *s == nil {
@@ -171,7 +215,16 @@ func (ss *FileSettingsStore) save(s *Settings) error {
 		return fmt.Errorf("create settings dir: %w", err)
 	}
 
-	data, err := json.MarshalIndent(s, "", "  ")
+	// Secrets are written first so a newly externalized credential is on disk
+	// before settings.json points at it. A crash between the two writes
+	// leaves settings.json one save behind: at worst the references of
+	// something just removed dangle, and load resolves those to "".
+	out, err := ss.externalizeSecrets(s)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
 	if err != nil {
 		return fmt.Errorf("serialize settings: %w", err)
 	}
@@ -186,6 +239,40 @@ func (ss *FileSettingsStore) save(s *Settings) error {
 	return nil
 }
 
+// externalizeSecrets returns the copy of s to write to settings.json, with
+// credentials moved into the secret store when it is enabled. s itself (the
+// cache-to-be) keeps its plaintext. Caller must hold the mutex.
+//
+// The store is re-opened from disk on every save rather than cached, so a
+// `relay secrets set` from the CLI is never overwritten by a stale copy in the
+// tray. If it exists but can't be opened, save fails: writing plaintext over
+// the references — or dropping them — would be worse than not saving.
+func (ss *FileSettingsStore) externalizeSecrets(s *Settings) (*Settings, error) {
+	st, err := openSecretStore(ss.dir, ss.secretKeyPath())
+	if err != nil {
+		return nil, fmt.Errorf("open secret store: %w", err)
+	}
+	out := deepCopySettings(s)
+	refs, err := externalizeSecrets(out, st, ss.secretRefs)
+	if err != nil {
+		return nil, fmt.Errorf("%w (key: %s)", err, ss.secretKeyPath())
+	}
+	if st != nil {
+		if err := st.save(); err != nil {
+			return nil, err
+		}
+	}
+	ss.secretRefs = refs
+	// A mutation may have written a reference by hand (an env value typed as
+	// secret://openai). Resolve it in s too, so the cache never hands a
+	// literal reference to a spawn or a bearer header.
+	_, errs := resolveSecretRefs(s, st)
+	for _, e := range errs {
+		slog.Warn("unresolved secret reference", "error", e)
+	}
+	return out, nil
+}
+
 // ensureAdminSecret generates an AdminSecret if one is not already set.
 func ensureAdminSecret(s *Settings) error {
 	if s.AdminSecret != "" {
@@ -220,10 +307,19 @@ func deepCopySettings(s *Settings) *Settings {
 
 // EnsureInitialized loads settings from disk, generates an admin secret if
 // missing, and saves. Call once at startup before using the store.
+//
+// An admin secret that is a `secret://` reference the store can't resolve is
+// not missing: minting a new one would lock every paired client out, and
+// the key is usually just somewhere relay isn't looking. Startup fails and
+// says so instead.
 func (ss *FileSettingsStore) EnsureInitialized() error {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 	s := ss.load()
+	if name, ok := ss.secretRefs["admin_secret"]; ok && s.AdminSecret == "" {
+		return fmt.Errorf("admin_secret references %s, which can't be resolved; restore the secret store key (%s) or point %s at it",
+			secretRef(name), ss.secretKeyPath(), envSecretsKeyFile)
+	}
 	if err := ensureAdminSecret(s); err != nil {
 		return err
 	}
@@ -337,4 +433,23 @@ func (ss *FileSettingsStore) With(fn func(s *Settings)) error {
 	return nil
 }
 
+// secretStore opens the secret store this settings store resolves against.
+// Returns (nil, nil) when the store has not been enabled.
+func (ss *FileSettingsStore) secretStore() (*SecretStore, error) {
+	return openSecretStore(ss.dir, ss.secretKeyPath())
+}
 
+// secretReferences returns field → entry name for every `secret://`
+// reference in the current settings.
+func (ss *FileSettingsStore) secretReferences() map[string]string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.cache == nil {
+		ss.cache = ss.load()
+	}
+	out := make(map[string]string, len(ss.secretRefs))
+	for k, v := range ss.secretRefs {
+		out[k] = v
+	}
+	return out
+}
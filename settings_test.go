@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -916,6 +917,37 @@ func TestMergeServiceDefaults(t *testing.T) {
 	})
 }
 
+// Re-registering a service from the CLI passes only the flags given; each
+// optional setting the others leave zero must survive the merge unchanged.
+func TestMergeServiceDefaults_KeepsUnsetSettings(t *testing.T) {
+	cases := []struct {
+		name     string
+		existing ServiceConfig
+	}{
+		{"limits", ServiceConfig{Limits: &ResourceLimits{MemoryMB: 256}}},
+		{"restart policy", ServiceConfig{Restart: &RestartPolicy{Policy: RestartOnFailure, MaxRetries: 3}}},
+		{"health check", ServiceConfig{Health: &HealthCheck{Exec: []string{"/usr/bin/test", "-e", "/tmp/ready"}}}},
+		{"dependencies", ServiceConfig{DependsOn: []ServiceDependency{{Service: "llm", Condition: DependsRegistered}}}},
+		{"stop settings", ServiceConfig{StopSignal: "INT", StopTimeoutSec: 30, PreStop: &PreStopHook{HTTP: "/drain"}}},
+		{"job", ServiceConfig{Kind: KindJob, Job: &JobSpec{Schedule: "0 3 * * *", Overlap: OverlapKill}}},
+		{"sockets", ServiceConfig{Sockets: &SocketActivation{Listeners: []SocketListener{{Address: "tcp:127.0.0.1:8080"}}, OnDemand: true}}},
+		{"env sources", ServiceConfig{EnvProfiles: []string{"dev"}, EnvFiles: []string{".env"}}},
+		{"replicas", ServiceConfig{Replicas: 3}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			existing := tc.existing
+			existing.ID, existing.DisplayName, existing.Command = "svc", "S", "/bin/x"
+			s := &Settings{Services: []ServiceConfig{existing}}
+			cfg := ServiceConfig{ID: "svc", DisplayName: "S", Command: "/bin/x"} // no optional flags
+			s.MergeServiceDefaults(&cfg)
+			if !reflect.DeepEqual(cfg, existing) {
+				t.Errorf("merged = %+v, want %+v", cfg, existing)
+			}
+		})
+	}
+}
+
 func TestResolveMcpID(t *testing.T) {
 	s := newTestSettings(t, []ExternalMcp{
 		{ID: "mcp1", DisplayName: "My MCP"},
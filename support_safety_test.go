@@ -23,6 +23,10 @@ import (
 //   - SetConfigDirForTest("") was called too early (clearing the override
 //     mid-test) so a later write landed in the real dir.
 func TestMain(m *testing.M) {
+	// NewSettingsStoreAt honours RELAY_SECRETS_KEY_FILE; a developer's real
+	// key must never reach a test's temp config dir.
+	os.Unsetenv(envSecretsKeyFile)
+
 	// Capture the REAL ConfigDir (override is empty at this point) so the
 	// snapshot is meaningful even if a stray Set call below leaks.
 	bridge.SetConfigDirForTest("")
@@ -12,6 +12,13 @@ import "time"
 // shorten it to exercise the request-timeout path deterministically.
 var MCPRequestTimeout = 5 * time.Minute
 
+// OAuthRefreshQueueTimeout bounds how long a request to an HTTP MCP waits for
+// another caller's in-flight token refresh before failing. Long enough to
+// ride out a normal refresh round-trip, short enough that a hung token
+// endpoint surfaces as an error rather than a stalled tool call. A var for
+// the same reason as MCPRequestTimeout.
+var OAuthRefreshQueueTimeout = 10 * time.Second
+
 const (
 	// MCPDiscoveryTimeout is the maximum time for a one-shot MCP discovery
 	// handshake (spawn, initialize, tools/list, kill).
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -54,6 +55,15 @@ type App struct {
 	// loaded map without copying.
 	rssByID atomic.Pointer[map[string]uint64]
 
+	// metrics is the per-service and per-MCP CPU/memory history the status
+	// poller feeds, served to `relay service status` over the bridge and to
+	// Eve over the frontend API. Shared with the router and frontend server.
+	metrics *MetricsHistory
+
+	// events is the relay event bus (event_bus.go), streamed by the
+	// frontend server at GET /api/events.
+	events *EventBus
+
 	// lastMenuJSON caches the most recently dispatched menu JSON so the poller
 	// can skip platform.UpdateMenu calls when nothing has changed. macOS
 	// rebuilds NSMenu via removeAllItems; suppressing no-op updates avoids
@@ -122,7 +132,15 @@ func runTrayApp() {
 		platform: platform,
 		extMgr:   extMgr,
 		registry: registry,
+		metrics:  NewMetricsHistory(0),
+		events:   NewEventBus(),
 	}
+	// The event bus (event_bus.go) hears about projects, MCPs and services
+	// from the components that change them. Seeded with the projects as
+	// they are now, so the first edit is told apart from the startup state.
+	app.events.ObserveProjects(freshSettings(store).Projects)
+	registry.Events = app.events
+	extMgr.Events = app.events
 
 	// Event-driven menu updates: rebuild tray status dots immediately when
 	// any managed process exits, instead of waiting for the next settings
@@ -139,11 +157,33 @@ func runTrayApp() {
 			app.pushServiceStatus()
 		})
 	}
+	// A health change (starting → ready, say) moves the same status dots.
+	registry.OnHealthChange = registry.OnProcessExit
+
+	// Push each HTTP MCP auth transition (refreshing, needs_reauth, ...) to an
+	// open settings window so the badge tracks reality. Called from whichever
+	// request goroutine drove the transition; same shutdown guard as above.
+	extMgr.OnAuthStateChange = func(mcpID string, state McpAuthState) {
+		if ctx.Err() != nil {
+			return
+		}
+		app.events.Publish(EventMcpAuthState, eventSourceRelay, "", mcpEventData{MCP: mcpID, State: state})
+		app.platform.DispatchToMain(func() {
+			app.emitSettingsEvent("onMcpAuthState", mcpID, state)
+		})
+	}
+	extMgr.SandboxProjectPaths = func(mcpID string) []string {
+		return sandboxProjectPaths(freshSettings(store), mcpID)
+	}
+	registry.EnvProfiles = func() map[string]map[string]string {
+		return freshSettings(store).EnvProfiles
+	}
 	appInstance = app
 
 	// Enhanced-services registry: bridge handler writes on RegisterManifest;
 	// service_registry calls Forget on exit; the front-door dispatcher reads.
 	enhancedRegistry := NewEnhancedServiceRegistry(nil)
+	enhancedRegistry.Events = app.events
 	registry.Enhanced = enhancedRegistry
 
 	app.ipcCtx = &IPCContext{
@@ -159,6 +199,7 @@ func runTrayApp() {
 		NotifyReconcile:        bridge.SendReconcile,
 		NotifyReloadMcp:        bridge.SendReloadMcp,
 		Tools:                  extMgr,
+		Events:                 app.events,
 	}
 
 	// Tool-call audit log. A failure here is logged and auditing stays off
@@ -176,6 +217,7 @@ func runTrayApp() {
 		enhanced: enhancedRegistry,
 		onChange: app.onExternalChange,
 		audit:    audit,
+		metrics:  app.metrics,
 	}
 	// router implements SkillLister (ListTools); set it on the IPC context
 	// now that it exists so the Projects-tab "Regen Now" button can run.
@@ -216,18 +258,22 @@ func runTrayApp() {
 	// tab in sync with edits made elsewhere.
 	onProjectsChanged := func() {
 		if app != nil {
+			app.events.ObserveProjects(freshSettings(store).Projects)
 			// Fires on an HTTP-server goroutine (Eve/scheduler/CLI). pushFullProjects
 			// calls WKWebView's evaluateJavaScript, which is main-thread-only, so hop
 			// to main rather than touching the WebView off-thread.
 			app.platform.DispatchToMain(app.pushFullProjects)
 		}
 	}
-	frontend, err := NewFrontendServer(store, extMgr, extMgr, frontendEndpoint, enhancedRegistry, router, onProjectsChanged)
+	frontend, err := NewFrontendServer(store, extMgr, extMgr, frontendEndpoint, enhancedRegistry, router, app.metrics, app.events, onProjectsChanged)
 	if err != nil {
 		slog.Error("failed to start frontend server", "error", err)
 		os.Exit(1)
 	}
 	app.frontendServer = frontend
+	// The optional TCP listener (frontend_tcp.go) follows settings from here
+	// on, on the same poll as the remote listener.
+	frontend.Reconcile() // logs its own failure; the Unix socket serves regardless
 	app.goFunc(func() {
 		if err := frontend.Serve(); err != nil {
 			slog.Error("frontend server exited with error", "error", err)
@@ -321,7 +367,10 @@ func (a *App) onExternalChange() {
 	// been TOLD, so acting on it costs nothing. In a tracked goroutine because
 	// a bind must not run on the main thread, and because the caller is a
 	// bridge handler that should not wait on a socket.
-	a.goFunc(func() { a.remote.Reconcile() })
+	a.goFunc(func() {
+		a.remote.Reconcile()
+		a.frontendServer.Reconcile()
+	})
 	a.platform.DispatchToMain(func() {
 		a.pushFullSettings()
 		a.updateMenu()
@@ -329,10 +378,11 @@ func (a *App) onExternalChange() {
 }
 
 // statusPoller periodically re-reads settings from disk (when the file's
-// modtime changes) to pick up CLI-driven changes, samples per-service memory
-// usage, and pushes service status to the settings WebView. The tray menu is
-// also rebuilt every tick so the memory readout stays fresh; updateMenu
-// short-circuits on the platform when nothing changed.
+// modtime changes) to pick up CLI-driven changes, samples per-service and
+// per-MCP resource usage, and pushes service status to the settings
+// WebView. The tray menu is also rebuilt every tick so the memory readout
+// stays fresh; updateMenu short-circuits on the platform when nothing
+// changed.
 //
 // Process-exit menu updates are still event-driven via
 // ServiceRegistry.OnProcessExit (see runTrayApp) so a stopped service's
@@ -350,21 +400,17 @@ func (a *App) statusPoller() {
 
 		a.registry.CleanupDead()
 
-		// Sample memory off the main thread; ps takes ~5ms and we don't want
-		// to block the UI dispatch behind it.
-		pidByID := a.registry.PIDsByServiceID()
-		roots := make([]int, 0, len(pidByID))
-		for _, pid := range pidByID {
-			roots = append(roots, pid)
-		}
-		rssByPID := SampleRSSByRoot(roots)
-		rssByID := make(map[string]uint64, len(pidByID))
-		for id, pid := range pidByID {
-			rssByID[id] = rssByPID[pid]
-		}
-		a.rssByID.Store(&rssByID)
+		// Sample usage off the main thread; reading the process table takes
+		// a few ms and we don't want to block the UI dispatch behind it.
+		a.sampleResources(time.Now())
 
 		s := a.store.ReloadIfChanged()
+		if s != nil {
+			// An out-of-process edit (the CLI, a hand-edited file) reaches
+			// the event stream here; in-process ones were observed as they
+			// were made.
+			a.events.ObserveProjects(s.Projects)
+		}
 
 		// Converge the remote listener on the same tick that picks up settings
 		// changes, and off the main thread because it may bind a socket. This
@@ -374,6 +420,7 @@ func (a *App) statusPoller() {
 		// only writer. Cheap and silent when nothing changed; see
 		// RemoteSupervisor.Reconcile for what "nothing changed" means.
 		a.remote.Reconcile()
+		a.frontendServer.Reconcile()
 
 		a.platform.DispatchToMain(func() {
 			// store.Get() deep-copies, so prefer the already-loaded snapshot
@@ -391,6 +438,60 @@ func (a *App) statusPoller() {
 	}
 }
 
+// sampleResources reads the process table once for every running service
+// and stdio MCP, records the result in the metrics history, and publishes
+// the services' memory for the tray menu.
+func (a *App) sampleResources(now time.Time) {
+	svcPIDs := a.registry.PIDsByServiceID()
+	var mcpPIDs map[string]int
+	if a.extMgr != nil {
+		mcpPIDs = a.extMgr.PIDsByMcpID()
+	}
+	roots := make([]int, 0, len(svcPIDs)+len(mcpPIDs))
+	for _, pid := range svcPIDs {
+		roots = append(roots, pid)
+	}
+	for _, pid := range mcpPIDs {
+		roots = append(roots, pid)
+	}
+	stats := SampleProcessStats(roots)
+	a.metrics.Record(metricsKindService, svcPIDs, stats, now)
+	a.metrics.Record(metricsKindMcp, mcpPIDs, stats, now)
+
+	rssByID := make(map[string]uint64, len(svcPIDs))
+	for id, pid := range svcPIDs {
+		rssByID[id] = stats[pid].RSS
+	}
+	a.rssByID.Store(&rssByID)
+}
+
+// serviceMenuAux annotates a service's menu item with why it is down — a
+// pending restart, a crash loop, a resource-limit kill — or, while it runs,
+// whether it is not yet (or no longer) ready and how often its restart
+// policy has had to bring it back.
+func serviceMenuAux(src serviceStatusSource, id string, running bool, aux string) string {
+	rs, _ := src.RestartStatus(id)
+	if running {
+		if hs, ok := src.Health(id); ok && hs.State != HealthReady {
+			aux = string(hs.State)
+		}
+		if rs.Restarts > 0 {
+			aux += " · " + strconv.Itoa(rs.Restarts) + " restarts"
+		}
+		return aux
+	}
+	switch {
+	case rs.Pending:
+		return "restarting"
+	case rs.GaveUp:
+		return "crash loop"
+	}
+	if exit, ok := src.LastExit(id); ok && exit.Limit != "" {
+		return exit.Limit + " limit"
+	}
+	return aux
+}
+
 // updateMenu rebuilds the tray menu JSON and pushes it to the platform.
 func (a *App) updateMenu() {
 	a.updateMenuWithSettings(a.store.Get())
@@ -427,12 +528,23 @@ func (a *App) updateMenuWithSettings(s *Settings) {
 		if running {
 			aux = formatBytes(rss[svc.ID])
 		}
+		if src, ok := a.registry.(serviceStatusSource); ok {
+			aux = serviceMenuAux(src, svc.ID, running, aux)
+		}
+		// An on-demand service waiting for a connection is on (clicking
+		// stops it), just not running yet.
+		on := running
+		if src, ok := a.registry.(socketStatusSource); ok && !running {
+			if st, ok := src.SocketStatus(svc.ID); ok && st.Awaiting {
+				on, aux = true, "on demand"
+			}
+		}
 		items = append(items, menuItem{
 			Title:   svc.DisplayName,
 			ID:      menuID,
 			Enabled: true,
 			Toggle:  true,
-			On:      running,
+			On:      on,
 			URL:     svc.URL,
 			Aux:     aux,
 		})
@@ -11,6 +11,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -107,6 +108,7 @@ type menuEntry struct {
 	ID    int    `json:"id"`
 	On    bool   `json:"on"`
 	URL   string `json:"url"`
+	Aux   string `json:"aux"`
 }
 
 func parseMenu(t *testing.T, jsonStr string) []menuEntry {
@@ -162,6 +164,127 @@ func TestUpdateMenuWithSettings_BuildsServiceItemsAndMapping(t *testing.T) {
 	}
 }
 
+// exitingRegistry adds recorded exits to trayRegistry, like ServiceRegistry.
+type exitingRegistry struct {
+	*trayRegistry
+	exits    map[string]childExit
+	restarts map[string]serviceRestartStatus
+	health   map[string]serviceHealthStatus
+}
+
+func (r exitingRegistry) LastExit(id string) (childExit, bool) {
+	e, ok := r.exits[id]
+	return e, ok
+}
+
+func (r exitingRegistry) RestartStatus(id string) (serviceRestartStatus, bool) {
+	rs, ok := r.restarts[id]
+	return rs, ok
+}
+
+func (r exitingRegistry) Health(id string) (serviceHealthStatus, bool) {
+	hs, ok := r.health[id]
+	return hs, ok
+}
+
+func TestUpdateMenuWithSettings_ShowsLimitKill(t *testing.T) {
+	rp := &recordingPlatform{}
+	reg := exitingRegistry{trayRegistry: &trayRegistry{}, exits: map[string]childExit{
+		"svc-oom":   {Status: "killed: memory limit exceeded", Limit: "memory"},
+		"svc-crash": {Status: "exited: status 1"},
+	}}
+	app := &App{platform: rp, registry: reg}
+	app.updateMenuWithSettings(&Settings{Services: []ServiceConfig{
+		{ID: "svc-oom", DisplayName: "OOM"},
+		{ID: "svc-crash", DisplayName: "Crash"},
+	}})
+
+	items := parseMenu(t, rp.lastMenu())
+	byID := map[int]menuEntry{}
+	for _, it := range items {
+		byID[it.ID] = it
+	}
+	if got := byID[menuIDSvcBase+0].Aux; got != "memory limit" {
+		t.Errorf("limit-killed service aux = %q, want \"memory limit\"", got)
+	}
+	// An ordinary crash isn't annotated; the menu only calls out limits.
+	if got := byID[menuIDSvcBase+1].Aux; got != "" {
+		t.Errorf("crashed service aux = %q, want empty", got)
+	}
+}
+
+func TestUpdateMenuWithSettings_ShowsRestartState(t *testing.T) {
+	rp := &recordingPlatform{}
+	reg := exitingRegistry{
+		trayRegistry: &trayRegistry{running: map[string]bool{"svc-flaky": true}},
+		exits: map[string]childExit{
+			"svc-waiting": {Status: "exited: status 1"},
+			// A crash loop outranks the limit that caused it: the service
+			// won't come back on its own, which is what the user must know.
+			"svc-looping": {Status: "killed: memory limit exceeded", Limit: "memory"},
+		},
+		restarts: map[string]serviceRestartStatus{
+			"svc-waiting": {Policy: RestartOnFailure, Restarts: 1, Pending: true},
+			"svc-looping": {Policy: RestartAlways, Restarts: 5, GaveUp: true},
+			"svc-flaky":   {Policy: RestartOnFailure, Restarts: 3},
+		},
+	}
+	app := &App{platform: rp, registry: reg}
+	app.updateMenuWithSettings(&Settings{Services: []ServiceConfig{
+		{ID: "svc-waiting", DisplayName: "Waiting"},
+		{ID: "svc-looping", DisplayName: "Looping"},
+		{ID: "svc-flaky", DisplayName: "Flaky"},
+	}})
+
+	byID := map[int]menuEntry{}
+	for _, it := range parseMenu(t, rp.lastMenu()) {
+		byID[it.ID] = it
+	}
+	if got := byID[menuIDSvcBase+0].Aux; got != "restarting" {
+		t.Errorf("pending restart aux = %q, want restarting", got)
+	}
+	if got := byID[menuIDSvcBase+1].Aux; got != "crash loop" {
+		t.Errorf("crash loop aux = %q, want \"crash loop\"", got)
+	}
+	if got := byID[menuIDSvcBase+2].Aux; !strings.HasSuffix(got, " · 3 restarts") {
+		t.Errorf("running service aux = %q, want restart count", got)
+	}
+}
+
+func TestUpdateMenuWithSettings_ShowsHealth(t *testing.T) {
+	rp := &recordingPlatform{}
+	reg := exitingRegistry{
+		trayRegistry: &trayRegistry{running: map[string]bool{"svc-boot": true, "svc-sick": true, "svc-fine": true}},
+		health: map[string]serviceHealthStatus{
+			"svc-boot": {State: HealthStarting},
+			"svc-sick": {State: HealthUnhealthy},
+			"svc-fine": {State: HealthReady},
+		},
+		restarts: map[string]serviceRestartStatus{"svc-sick": {Policy: RestartAlways, Restarts: 2}},
+	}
+	app := &App{platform: rp, registry: reg}
+	app.updateMenuWithSettings(&Settings{Services: []ServiceConfig{
+		{ID: "svc-boot", DisplayName: "Boot"},
+		{ID: "svc-sick", DisplayName: "Sick"},
+		{ID: "svc-fine", DisplayName: "Fine"},
+	}})
+
+	byID := map[int]menuEntry{}
+	for _, it := range parseMenu(t, rp.lastMenu()) {
+		byID[it.ID] = it
+	}
+	if got := byID[menuIDSvcBase+0].Aux; got != "starting" {
+		t.Errorf("starting service aux = %q", got)
+	}
+	if got := byID[menuIDSvcBase+1].Aux; got != "unhealthy · 2 restarts" {
+		t.Errorf("unhealthy service aux = %q", got)
+	}
+	// A ready service shows its memory as usual, not its health.
+	if got := byID[menuIDSvcBase+2].Aux; strings.Contains(got, "ready") {
+		t.Errorf("ready service aux = %q", got)
+	}
+}
+
 func TestUpdateMenuWithSettings_SuppressesNoOpUpdate(t *testing.T) {
 	rp := &recordingPlatform{}
 	app := &App{platform: rp, registry: &trayRegistry{}}
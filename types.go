@@ -66,6 +66,18 @@ type ExternalMcp struct {
 	// then spawns the MCP with --check-permissions for a final status
 	// summary. See mcp_permissions.go.
 	TccServices []string `json:"tcc_services,omitempty"`
+
+	// LinuxServices is the Linux analogue of TccServices: what the MCP needs
+	// from the desktop ("display", "audio", "dbus", "gpu", "camera",
+	// "network"). It only has an effect under a Sandbox profile, where each
+	// entry exposes the matching sockets and device nodes. See sandbox.go.
+	LinuxServices []string `json:"linux_services,omitempty"`
+	// Sandbox opts a stdio MCP into namespace/Landlock/seccomp confinement
+	// on Linux. Nil or disabled runs it unconfined, as before.
+	Sandbox *SandboxProfile `json:"sandbox,omitempty"`
+	// Limits bounds a stdio MCP's memory, CPU, open files and process
+	// count. See resource_limits.go.
+	Limits *ResourceLimits `json:"limits,omitempty"`
 }
 
 // IsHTTP returns true if this MCP uses the HTTP Streamable transport.
@@ -90,7 +102,10 @@ func (m *ExternalMcp) Validate() error {
 			return fmt.Errorf("command is required for stdio transport")
 		}
 	}
-	return nil
+	if err := m.Limits.validate(); err != nil {
+		return err
+	}
+	return validateSandbox(m)
 }
 
 // ServiceConfig describes a background service managed by Relay.
@@ -111,6 +126,12 @@ type ServiceConfig struct {
 	Autostart   bool              `json:"autostart"`
 	URL         string            `json:"url,omitempty"`
 
+	// EnvFiles are dotenv files (relative to WorkingDir) and EnvProfiles
+	// names of the settings' env_profiles, both layered under Env in the
+	// order listed. See service_env.go.
+	EnvFiles    []string `json:"env_files,omitempty"`
+	EnvProfiles []string `json:"env_profiles,omitempty"`
+
 	// FrontendConsumer controls whether relay injects its front-door creds
 	// (RELAY_FRONTEND_SOCKET/TOKEN) into the spawned service. Only a frontend
 	// consumer (eve) dials the front door; backends never do. Three-state:
@@ -119,6 +140,46 @@ type ServiceConfig struct {
 	// lands in their env, and thus never leaks into a spawned shell); true =
 	// inject explicitly. Set false via `service register --no-frontend-creds`.
 	FrontendConsumer *bool `json:"frontend_consumer,omitempty"`
+
+	// Limits bounds the service's memory, CPU, open files and process count
+	// (the whole tree the login shell starts). See resource_limits.go.
+	Limits *ResourceLimits `json:"limits,omitempty"`
+
+	// Restart brings the service back when it exits on its own; nil means
+	// never. See service_restart.go.
+	Restart *RestartPolicy `json:"restart,omitempty"`
+
+	// Health probes the running service for readiness; nil means it is
+	// routed to as soon as it registers. See service_health.go.
+	Health *HealthCheck `json:"health,omitempty"`
+
+	// DependsOn lists the services this one needs, and when each counts as
+	// up, for ordered autostart and shutdown. See service_deps.go.
+	DependsOn []ServiceDependency `json:"depends_on,omitempty"`
+
+	// StopSignal is sent to the service's process group to stop it: TERM
+	// (the default), INT, QUIT, HUP, USR1 or USR2. StopTimeoutSec is how
+	// long it then has before SIGKILL; 0 means 1. PreStop is called before
+	// the signal. See service_stop.go.
+	StopSignal     string       `json:"stop_signal,omitempty"`
+	StopTimeoutSec int          `json:"stop_timeout_sec,omitempty"`
+	PreStop        *PreStopHook `json:"pre_stop,omitempty"`
+
+	// Kind is "service" (the default: kept running) or "job" (run to
+	// completion on a schedule or on demand). Job says when a job runs, and
+	// is set only for one; nil means a one-shot job. See service_jobs.go.
+	Kind string   `json:"kind,omitempty"`
+	Job  *JobSpec `json:"job,omitempty"`
+
+	// Sockets are listeners relay binds and passes to the service as
+	// inherited file descriptors, optionally starting it on the first
+	// connection; nil means it binds its own. See service_sockets.go.
+	Sockets *SocketActivation `json:"sockets,omitempty"`
+
+	// Replicas runs the service as this many processes, which the front
+	// door balances requests across; 0 and 1 both mean one. See
+	// service_replicas.go.
+	Replicas int `json:"replicas,omitempty"`
 }
 
 // ChatTemplate defines a reusable session preset within a project.
@@ -306,6 +367,29 @@ func (e *Enrolment) GrantsProject(projectID string) bool {
 	return slices.Contains(e.ProjectIDs, projectID)
 }
 
+// FrontendCredential is a named bearer for the frontend API, limited to
+// route prefixes, methods and projects (frontend_credentials.go). Only the
+// token's hash is stored; the token is shown once, when it is created.
+type FrontendCredential struct {
+	// Name identifies the credential for listing and revocation.
+	Name string `json:"name"`
+	// TokenHash is the hex SHA-256 of the token (hashToken).
+	TokenHash string `json:"token_hash"`
+	// Routes are the path prefixes the credential may reach, matched on
+	// whole segments. At least one; "/" is every route.
+	Routes []string `json:"routes"`
+	// Methods limits the HTTP methods; empty means any.
+	Methods []string `json:"methods,omitempty"`
+	// ProjectIDs are the projects it may see and create sessions in. Empty
+	// means none.
+	ProjectIDs []string `json:"project_ids,omitempty"`
+	// Limit replaces the frontend block's rate limit for this credential,
+	// and can lower its body cap (frontend_limits.go). nil means the
+	// block's limits apply as they are.
+	Limit     *FrontendLimit `json:"limit,omitempty"`
+	CreatedAt string         `json:"created_at"`
+}
+
 // IsRemote reports whether this project is a remote capability grant rather
 // than a host-directory project. This is the ONLY place that decision should
 // be made — see the comment on Kind for why the zero value must always read
@@ -345,5 +429,37 @@ func (c *ServiceConfig) Validate() error {
 	if c.Command == "" {
 		return fmt.Errorf("service command is required")
 	}
-	return nil
+	if err := c.validateEnvSources(); err != nil {
+		return err
+	}
+	if err := c.Limits.validate(); err != nil {
+		return err
+	}
+	if err := c.Restart.validate(); err != nil {
+		return err
+	}
+	if err := c.Health.validate(); err != nil {
+		return err
+	}
+	for _, d := range c.DependsOn {
+		if err := d.validate(c.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := parseStopSignal(c.StopSignal); err != nil {
+		return err
+	}
+	if c.StopTimeoutSec < 0 {
+		return fmt.Errorf("stop timeout must not be negative")
+	}
+	if err := c.PreStop.validate(); err != nil {
+		return err
+	}
+	if err := c.Sockets.validate(); err != nil {
+		return err
+	}
+	if err := c.validateReplicas(); err != nil {
+		return err
+	}
+	return c.validateKind()
 }
@@ -2,7 +2,7 @@
 // renderer, IPC bridge, and all event handlers. Pure helpers live in
 // ./lib/pure.js. Bundled (esbuild) and inlined into web/dist/settings.html.
 import {
-    esc, formatScalar, cfgParseConfigText, cfgGetAt, cfgSetAt, cfgDefaultFor, cfgCoerce, cfgKvCoerce, cfgKvDisplay, cfgScanRequired, cfgSummary, cfgFormatStringMap, cfgFormatJson, oneLineProj
+    esc, formatScalar, cfgParseConfigText, cfgGetAt, cfgSetAt, cfgDefaultFor, cfgCoerce, cfgKvCoerce, cfgKvDisplay, cfgScanRequired, cfgSummary, cfgFormatStringMap, cfgFormatJson, formatServiceLogLine, formatJobSchedule, formatJobRun, actionIsDanger, actionNeedsForm, oneLineProj
 } from './lib/pure.js';
 
 // Initial data injected by relay's renderSettingsHTML via the shell template.
@@ -11,12 +11,14 @@ const SERVICES_INIT = window.__RELAY_INIT__.services;
 const RUNNING_IDS_INIT = window.__RELAY_INIT__.runningIds;
 const PROJECTS_INIT = window.__RELAY_INIT__.projects;
 const MCP_TOOL_CACHE_INIT = window.__RELAY_INIT__.mcpToolCache;
+const MCP_AUTH_STATES_INIT = window.__RELAY_INIT__.mcpAuthStates || {};
 const ENROLMENTS_INIT = window.__RELAY_INIT__.enrolments || [];
 const REMOTE_INIT = window.__RELAY_INIT__.remote || null;
 // The conservative per-enrolment budget defaults, shipped from Go so the
 // create form's placeholders name the real numbers instead of a second copy
 // of them that can rot apart from normalizeEnrolmentBudget.
 const ENROLMENT_BUDGET_DEFAULTS_INIT = window.__RELAY_INIT__.enrolmentBudgetDefaults || {};
+const FRONTEND_CREDENTIALS_INIT = window.__RELAY_INIT__.frontendCredentials || [];
 
 function ipc(msg) {
     if (window.webkit && window.webkit.messageHandlers && window.webkit.messageHandlers.ipc)
@@ -37,12 +39,25 @@ let state = {
     services: SERVICES_INIT,
     runningServices: RUNNING_IDS_INIT.reduce(function(m, id) { m[id] = true; return m; }, {}),
     editingServiceId: null,             // null = list, 'new' = add form, '<id>' = edit form
+    // Log pane on the Services tab. One service at a time; it follows the log
+    // by passing the last reply's cursor back on each status poll.
+    serviceLogsOpen: null,    // svcId whose pane is open, or null
+    serviceLogLines: [],      // lines shown, oldest first (capped)
+    serviceLogCursor: null,   // cursor from the last onServiceLogs, null until loaded
+    serviceLogGrep: '',       // filter text, applied by relay
+    serviceLogError: '',
+    jobStatus: {},            // job svcId -> onJobStatus entry (schedule, runs)
     // Service Inspector state. Each snapshot in serviceStatuses carries
     // its own manifest, so we derive button layouts from the snapshot —
     // no separate manifest map to keep in sync.
     serviceStatuses: {},      // serviceId -> ServiceStatusSnapshot
     serviceActionPending: {}, // key "svc|action|rowKey" -> true while in flight
     serviceActionError: {},   // serviceId -> last error string (cleared on next ok)
+    // The one open action form (an action with inputs or a confirmation):
+    // { key, svcId, actionId, row, draft, error }. key stands in for a
+    // service ID in the config renderer's bindings, so the form's inputs are
+    // drawn and edited by the same code as a config file's.
+    actionForm: null,
 
     // Per-service config editor (manifest.config). The service advertises a
     // file path + a recursive schema; relay ships the raw file text, we parse
@@ -65,6 +80,7 @@ let state = {
     // Projects tab.
     projects: PROJECTS_INIT,
     mcpToolCache: MCP_TOOL_CACHE_INIT,     // mcpId -> [{name, description, category}]
+    mcpAuthStates: MCP_AUTH_STATES_INIT,   // mcpId -> 'none' | 'authenticated' | 'refreshing' | 'needs_reauth' (HTTP MCPs only)
     editingProjectId: null,                 // null = list, 'new' = create form, '<id>' = edit
     projectForm: null,                      // in-flight form values (kept out of state.projects until Save)
     projectFormError: null,
@@ -89,6 +105,13 @@ let state = {
     remoteDirty: false,
     remoteError: null,
 
+    // Frontend Access tab: scoped bearers for the frontend API. Only hashes
+    // are stored, so the token exists here once, right after creation.
+    frontendCreds: FRONTEND_CREDENTIALS_INIT,
+    frontendCredForm: null,                 // null = list, object = create form
+    frontendCredError: null,
+    frontendCredToken: null,                // {name, token} shown once after create
+
     // Tool Calls tab. Events arrive newest-first from the recorder's ring (or
     // from a deep query over the log file); `auditFilter` mirrors AuditQuery
     // on the Go side so it can be sent verbatim.
@@ -108,7 +131,7 @@ const AUDIT_MAX_ROWS = 500;
 
 function showPage(page) {
     state.page = page;
-    const pages = ['services', 'mcps', 'projects', 'remote', 'inspector', 'audit'];
+    const pages = ['services', 'mcps', 'projects', 'remote', 'frontend', 'inspector', 'audit'];
     document.querySelectorAll('.sidebar-item').forEach((el, i) => {
         el.classList.toggle('active', pages[i] === page);
     });
@@ -147,6 +170,9 @@ function render(source) {
         // Projects tab does: an external change must not eat keystrokes.
         if (fromPush && (state.enrolForm || state.remoteDirty)) return;
         el.innerHTML = renderEnrolments();
+    } else if (state.page === 'frontend') {
+        if (fromPush && state.frontendCredForm) return;
+        el.innerHTML = renderFrontendCreds();
     } else if (state.page === 'audit') {
         el.innerHTML = renderAudit();
         restoreAuditFocus();
@@ -182,13 +208,7 @@ function renderMcpServers() {
         html += '<div class="mcp-card-header">';
         html += `<span class="mcp-card-name">${esc(mcp.display_name)}</span>`;
         html += '<div style="display:flex;gap:4px;align-items:center">';
-        if (isHTTP) {
-            if (mcp.oauth_state && mcp.oauth_state.access_token) {
-                html += '<span style="font-size:11px;color:#22c55e;border:1px solid #22c55e;border-radius:3px;padding:2px 6px">Authenticated</span>';
-            } else {
-                html += '<span style="font-size:11px;color:#f59e0b;border:1px solid #f59e0b;border-radius:3px;padding:2px 6px">Not authenticated</span>';
-            }
-        }
+        if (isHTTP) html += mcpAuthBadge(mcp);
         if (mcp.tcc_services && mcp.tcc_services.length > 0) {
             const busy = state.resettingMcpPermissions === mcp.id;
             const label = busy ? 'Resetting…' : 'Reset Permissions';
@@ -205,6 +225,9 @@ function renderMcpServers() {
             } else {
                 html += `<button class="btn btn-sm" onclick="authenticateMcp('${esc(mcp.id)}')">Authenticate</button>`;
             }
+            if (mcp.oauth_state) {
+                html += `<button class="btn btn-sm" onclick="resetMcpCredentials('${esc(mcp.id)}')">Reset Credentials</button>`;
+            }
             html += '</div>';
         } else {
             const cmd = mcp.command || '';
@@ -218,6 +241,24 @@ function renderMcpServers() {
     return html;
 }
 
+// MCP_AUTH_BADGES maps a live McpAuthState to its badge label + colour.
+const MCP_AUTH_BADGES = {
+    authenticated: ['Authenticated', '#22c55e'],
+    refreshing:    ['Refreshing…', '#3b82f6'],
+    needs_reauth:  ['Re-authentication required', '#ef4444'],
+    none:          ['Not authenticated', '#f59e0b'],
+};
+
+// mcpAuthBadge renders an HTTP MCP's auth badge. The live state pushed by the
+// tray wins; before the MCP has connected (or if the tray predates auth
+// states) fall back to whether settings hold a token at all.
+function mcpAuthBadge(mcp) {
+    let st = state.mcpAuthStates[mcp.id];
+    if (!MCP_AUTH_BADGES[st]) st = (mcp.oauth_state && mcp.oauth_state.access_token) ? 'authenticated' : 'none';
+    const [label, color] = MCP_AUTH_BADGES[st];
+    return `<span style="font-size:11px;color:${color};border:1px solid ${color};border-radius:3px;padding:2px 6px">${label}</span>`;
+}
+
 // Form view for adding an MCP server. There is no edit flow today — MCPs are
 // add-or-remove; editingMcpId is always 'new' while this is rendered.
 function renderMcpForm() {
@@ -401,6 +442,31 @@ function removeExternalMcp(id) {
     ipc(JSON.stringify({ type: 'remove_external_mcp', id }));
 }
 
+// Drop an HTTP MCP's stored OAuth tokens and revoke them at the provider. The
+// registration stays; the MCP reloads unauthenticated until the user signs in
+// again with Authenticate.
+function resetMcpCredentials(id) {
+    const mcp = state.externalMcps.find(m => m.id === id);
+    if (!mcp) return;
+    if (!confirm('Reset credentials for "' + mcp.display_name + '"?\n\n' +
+        'Relay forgets its OAuth tokens and asks the provider to revoke them. ' +
+        'Tools stay unavailable until you authenticate again.')) return;
+    ipc(JSON.stringify({ type: 'reset_mcp_credentials', id }));
+}
+
+window.onMcpCredentialsReset = function(id) {
+    const mcp = state.externalMcps.find(m => m.id === id);
+    if (mcp) delete mcp.oauth_state;
+    state.mcpAuthStates[id] = 'none';
+    renderMcpPush(false);
+};
+
+// Live auth transitions from the tray (refresh started/settled, grant rejected).
+window.onMcpAuthState = function(id, authState) {
+    state.mcpAuthStates[id] = authState;
+    renderMcpPush(false);
+};
+
 window.onOAuthRequired = function(id) {
     // Server needs auth -- badge already shown from the added MCP data.
 };
@@ -427,6 +493,7 @@ window.onOAuthComplete = function(id) {
         if (!mcp.oauth_state) mcp.oauth_state = {};
         mcp.oauth_state.access_token = 'authenticated'; // UI placeholder only
     }
+    state.mcpAuthStates[id] = 'authenticated';
     renderMcpPush(false);
 };
 
@@ -517,10 +584,15 @@ function renderServices() {
     for (const svc of state.services) {
         const cmdDisplay = svc.command.length > 40 ? '...' + svc.command.slice(-37) : svc.command;
         const argsDisplay = svc.args && svc.args.length > 0 ? ' ' + svc.args.join(' ') : '';
+        const isJob = svc.kind === 'job';
+        // An armed schedule counts as running (see service_jobs.go).
+        const runningLabel = isJob && svc.job && (svc.job.schedule || svc.job.interval_sec) ? 'Scheduled' : 'Running';
         html += `<div class="mcp-card">
             <div class="mcp-card-header">
                 <span class="mcp-card-name">${esc(svc.display_name)}</span>
                 <div style="display:flex;gap:4px">
+                    ${isJob ? `<button class="btn btn-sm" onclick="runJobNow('${esc(svc.id)}')">Run Now</button>` : ''}
+                    <button class="btn btn-sm" onclick="toggleServiceLogs('${esc(svc.id)}')">${state.serviceLogsOpen === svc.id ? 'Hide Logs' : 'Logs'}</button>
                     <button class="btn btn-sm" onclick="editService('${esc(svc.id)}')">Edit</button>
                     <button class="btn btn-sm btn-danger" onclick="removeService('${esc(svc.id)}')">Remove</button>
                 </div>
@@ -528,8 +600,10 @@ function renderServices() {
             <div class="mcp-card-cmd">${esc(cmdDisplay + argsDisplay)}</div>
             ${svc.working_dir ? `<div class="mcp-card-tools">cwd: ${esc(svc.working_dir)}</div>` : ''}
             ${svc.url ? `<div class="mcp-card-tools">url: ${esc(svc.url)}</div>` : ''}
+            ${isJob ? `<div class="mcp-card-tools">job: ${esc(formatJobSchedule(svc.job))}</div>
+            <div class="mcp-card-tools" id="job-runs-${esc(svc.id)}">${jobRunsHTML(svc.id)}</div>` : ''}
             <div class="toggle-row" style="margin-bottom:0;padding:6px 0 0">
-                <span style="font-size:12px;color:var(--text-2)">Running</span>
+                <span style="font-size:12px;color:var(--text-2)">${runningLabel}</span>
                 <label class="switch switch-running">
                     <input type="checkbox" data-svc-running="${esc(svc.id)}" ${state.runningServices[svc.id] ? 'checked' : ''} onchange="toggleServiceRunning('${esc(svc.id)}', this.checked)" />
                     <span class="slider"></span>
@@ -542,11 +616,106 @@ function renderServices() {
                     <span class="slider"></span>
                 </label>
             </div>
+            ${state.serviceLogsOpen === svc.id ? renderServiceLogs(svc.id) : ''}
         </div>`;
     }
     return html;
 }
 
+// JOB_RUNS_SHOWN is how many recent runs a job's card lists; the CLI's
+// `service list --history` has the rest.
+const JOB_RUNS_SHOWN = 5;
+
+// jobRunsHTML is a job card's next run and recent runs, newest first. Filled
+// in from onJobStatus, which the status poll requests while jobs are shown.
+function jobRunsHTML(id) {
+    const st = state.jobStatus[id];
+    if (!st) return 'Loading…';
+    let html = st.next_run ? 'next run: ' + esc(new Date(st.next_run).toLocaleString()) : (st.scheduled ? '' : 'not scheduled');
+    const runs = (st.runs || []).slice(-JOB_RUNS_SHOWN).reverse();
+    if (runs.length === 0) return html + (html ? ' · ' : '') + 'no runs yet';
+    for (const run of runs) html += '<br>' + esc(formatJobRun(run));
+    return html;
+}
+
+function runJobNow(id) {
+    ipc(JSON.stringify({ type: 'run_job', id: id }));
+}
+
+window.onJobStatus = function(list) {
+    const m = {};
+    for (const st of list || []) m[st.id] = st;
+    state.jobStatus = m;
+    if (state.page !== 'services') return;
+    // In place, like the running toggles: this arrives with every status poll.
+    for (const id of Object.keys(m)) {
+        const el = document.getElementById('job-runs-' + id);
+        if (el) el.innerHTML = jobRunsHTML(id);
+    }
+};
+
+// Log pane for the open service. The <pre> is refilled in place as lines
+// arrive (updateServiceLogsDOM), so following the log doesn't re-render the
+// page under the filter input.
+function renderServiceLogs(id) {
+    return `<div style="margin-top:8px">
+        <input type="text" placeholder="Filter (case-insensitive)" value="${esc(state.serviceLogGrep)}" onchange="setServiceLogGrep(this.value)" />
+        <pre id="svc-logs-${esc(id)}" style="max-height:280px;overflow:auto;font-size:11px;margin:6px 0 0;white-space:pre-wrap">${serviceLogsText()}</pre>
+    </div>`;
+}
+
+function serviceLogsText() {
+    if (state.serviceLogError) return esc('Error: ' + state.serviceLogError);
+    if (state.serviceLogCursor === null) return 'Loading…';
+    if (state.serviceLogLines.length === 0) return state.serviceLogGrep ? 'No matching output.' : 'No output yet.';
+    return esc(state.serviceLogLines.map(formatServiceLogLine).join('\n'));
+}
+
+function updateServiceLogsDOM() {
+    const pre = document.getElementById('svc-logs-' + state.serviceLogsOpen);
+    if (!pre) return;
+    // Stay pinned to the bottom unless the user has scrolled up to read.
+    const atBottom = pre.scrollTop + pre.clientHeight >= pre.scrollHeight - 4;
+    pre.innerHTML = serviceLogsText();
+    if (atBottom) pre.scrollTop = pre.scrollHeight;
+}
+
+// SERVICE_LOG_PANE_MAX bounds the lines kept in the pane; the CLI has the rest.
+const SERVICE_LOG_PANE_MAX = 2000;
+
+function loadServiceLogs() {
+    state.serviceLogLines = [];
+    state.serviceLogCursor = null;
+    state.serviceLogError = '';
+    ipc(JSON.stringify({ type: 'service_logs', id: state.serviceLogsOpen, grep: state.serviceLogGrep }));
+}
+
+function toggleServiceLogs(id) {
+    state.serviceLogsOpen = state.serviceLogsOpen === id ? null : id;
+    if (state.serviceLogsOpen) loadServiceLogs();
+    render();
+}
+
+function setServiceLogGrep(text) {
+    state.serviceLogGrep = text.trim();
+    loadServiceLogs();
+    updateServiceLogsDOM();
+}
+
+window.onServiceLogs = function(reply) {
+    if (!reply || reply.id !== state.serviceLogsOpen) return;
+    // A follow-up that crossed a reload (grep change) in flight is stale.
+    if (reply.append && state.serviceLogCursor === null) return;
+    state.serviceLogError = reply.error || '';
+    const lines = reply.lines || [];
+    state.serviceLogLines = reply.append ? state.serviceLogLines.concat(lines) : lines;
+    if (state.serviceLogLines.length > SERVICE_LOG_PANE_MAX) {
+        state.serviceLogLines = state.serviceLogLines.slice(-SERVICE_LOG_PANE_MAX);
+    }
+    state.serviceLogCursor = reply.cursor;
+    if (state.page === 'services') updateServiceLogsDOM();
+};
+
 // Form view for adding or editing a service. Mirrors the Projects pattern:
 // state.editingServiceId === 'new' for add, '<id>' for edit.
 function renderServiceForm() {
@@ -712,6 +881,7 @@ window.onServiceRemoved = function(id) {
     state.services = state.services.filter(s => s.id !== id);
     // If the user happened to be editing the removed service, bail out.
     if (state.editingServiceId === id) state.editingServiceId = null;
+    if (state.serviceLogsOpen === id) state.serviceLogsOpen = null;
     if (state.page === 'services') render('push');
 };
 
@@ -734,6 +904,15 @@ window.onServiceStatus = function(runningIds) {
         var cb = document.querySelector('[data-svc-running="' + svc.id + '"]');
         if (cb) cb.checked = !!m[svc.id];
     }
+    // Jobs' schedules and run histories ride the same poll.
+    if (state.services.some(function(s) { return s.kind === 'job'; })) {
+        ipc(JSON.stringify({ type: 'job_status' }));
+    }
+    // The same poll drives an open log pane: ask for what's been written
+    // since the last reply.
+    if (state.serviceLogsOpen && state.serviceLogCursor !== null && !state.serviceLogError) {
+        ipc(JSON.stringify({ type: 'service_logs', id: state.serviceLogsOpen, grep: state.serviceLogGrep, cursor: state.serviceLogCursor }));
+    }
 };
 
 window.onSettingsError = function(msg) {
@@ -751,7 +930,9 @@ window.onSettingsReloaded = function(data) {
     state.runningServices = data.running_ids.reduce(function(m, id) { m[id] = true; return m; }, {});
     if (data.projects) state.projects = data.projects;
     if (data.mcp_tool_cache) state.mcpToolCache = data.mcp_tool_cache;
+    if (data.mcp_auth_states) state.mcpAuthStates = data.mcp_auth_states;
     if (data.enrolments) state.enrolments = data.enrolments;
+    if (data.frontend_credentials) state.frontendCreds = data.frontend_credentials;
     if (data.remote) {
         state.remote = data.remote;
         // Re-seed the listener draft from the server's answer unless the user
@@ -1898,6 +2079,199 @@ window.onRemoteConfigError = function(msg) {
     if (state.page === 'remote') render('push');
 };
 
+// ---------------------------------------------------------------------------
+// Frontend Access tab — scoped credentials for the frontend API
+// (frontend_credentials.go). Each card shows what the credential reaches so
+// the revoke decision can be made from the card alone; the create form
+// shows the token once, since settings.json only keeps its hash.
+// ---------------------------------------------------------------------------
+
+const FRONTEND_CRED_METHODS = ['GET', 'HEAD', 'POST', 'PUT', 'PATCH', 'DELETE', 'OPTIONS'];
+
+function renderFrontendCreds() {
+    if (state.frontendCredForm) return renderFrontendCredForm();
+
+    let html = '<div class="page-header"><h2>Frontend Access</h2>';
+    html += '<button class="btn btn-primary" onclick="newFrontendCred()">+ New Credential</button></div>';
+    html += '<p class="page-intro">Eve uses the frontend channel\'s own token, which reaches every route. Anything else that calls the frontend API — a chat bridge, a script, a phone — should get a credential of its own, limited to the routes, methods and projects it needs, and revocable on its own.</p>';
+
+    if (state.frontendCredToken) {
+        const t = state.frontendCredToken;
+        html += '<div class="enrol-bundle">Created <strong>' + esc(t.name) + '</strong>. Its token is shown this once — relay stores only its hash:';
+        html += '<div style="margin-top:6px"><code>' + esc(t.token) + '</code></div>';
+        html += '<div style="margin-top:8px"><button class="btn btn-sm" onclick="copyProjectToken(state.frontendCredToken.token)">Copy</button> ';
+        html += '<button class="btn btn-sm" onclick="dismissFrontendCredToken()">Done</button></div></div>';
+    }
+    if (state.frontendCredError) html += '<div class="proj-error">' + esc(state.frontendCredError) + '</div>';
+
+    const list = state.frontendCreds || [];
+    if (!list.length) {
+        html += '<div class="empty-state">No frontend credentials. Click <strong>+ New Credential</strong>, or run <code>relay frontend-cred create</code>.</div>';
+    }
+    for (const c of list) {
+        html += '<div class="enrol-card">';
+        html += '<div class="enrol-card-header">';
+        html += '<span class="enrol-card-name">' + esc(c.name) + '</span>';
+        html += '<button class="btn btn-sm btn-danger" onclick="revokeFrontendCred(\'' + esc(c.name) + '\')">Revoke</button>';
+        html += '</div>';
+        html += '<div class="enrol-grants">';
+        for (const r of (c.routes || [])) html += '<span class="enrol-grant"><code>' + esc(r) + '</code></span>';
+        html += '</div>';
+        html += '<div class="enrol-grants" style="margin-top:5px">';
+        const projects = frontendCredProjectNames(c);
+        if (!projects.length) html += '<span class="enrol-grant none">no projects</span>';
+        for (const g of projects) {
+            if (g.name) html += '<span class="enrol-grant" title="' + esc(g.id) + '">' + esc(g.name) + '</span>';
+            else html += '<span class="enrol-grant dangling" title="No project carries this id">' + esc(g.id) + ' — unknown project</span>';
+        }
+        html += '</div>';
+        html += '<div class="enrol-meta">';
+        html += '<span>Methods: <strong>' + esc((c.methods && c.methods.length) ? c.methods.join(', ') : 'any') + '</strong></span>';
+        html += '<span>Created: <strong>' + esc(c.created_at || '—') + '</strong></span>';
+        html += '</div>';
+        html += '</div>';
+    }
+    return html;
+}
+
+// frontendCredProjectNames resolves a credential's project ids to {id, name}
+// pairs; name is empty for an id no project carries.
+function frontendCredProjectNames(c) {
+    return (c.project_ids || []).map(id => {
+        const p = (state.projects || []).find(x => x.id === id);
+        return { id, name: p ? p.name : '' };
+    });
+}
+
+function renderFrontendCredForm() {
+    const f = state.frontendCredForm;
+    let html = '<h2>New Frontend Credential</h2>';
+    if (state.frontendCredError) html += '<div class="proj-error">' + esc(state.frontendCredError) + '</div>';
+
+    html += '<div class="proj-section">';
+    html += '<div class="proj-section-title">Name</div>';
+    html += '<input type="text" id="frontendCredName" value="' + esc(f.name) + '" placeholder="telegram" />';
+    html += '</div>';
+
+    html += '<div class="proj-section">';
+    html += '<div class="proj-section-title">Routes</div>';
+    html += '<p class="proj-section-help">One path prefix per line, matched on whole segments: <code>/api/sessions</code> covers <code>/api/sessions/abc</code>. Use <code>/</code> for every route.</p>';
+    html += '<textarea id="frontendCredRoutes" rows="3" placeholder="/api/sessions">' + esc(f.routes) + '</textarea>';
+    html += '</div>';
+
+    html += '<div class="proj-section">';
+    html += '<div class="proj-section-title">Methods</div>';
+    html += '<p class="proj-section-help">None selected allows any method.</p>';
+    for (const m of FRONTEND_CRED_METHODS) {
+        const checked = f.methods.indexOf(m) >= 0;
+        html += '<label class="proj-tool-row"><input type="checkbox" ' + (checked ? 'checked' : '') + ' onchange="toggleFrontendCredItem(\'methods\', \'' + m + '\', this.checked)" /><div>' + m + '</div></label>';
+    }
+    html += '</div>';
+
+    html += '<div class="proj-section">';
+    html += '<div class="proj-section-title">Projects</div>';
+    html += '<p class="proj-section-help">The projects it can list and read, and the only ones it can create sessions in. None selected means no project at all.</p>';
+    const projects = state.projects || [];
+    if (!projects.length) html += '<div class="proj-tool-empty">No projects exist yet.</div>';
+    for (const p of projects) {
+        const checked = f.project_ids.indexOf(p.id) >= 0;
+        html += '<label class="proj-tool-row">';
+        html += '<input type="checkbox" ' + (checked ? 'checked' : '') + ' onchange="toggleFrontendCredItem(\'project_ids\', \'' + esc(p.id) + '\', this.checked)" />';
+        html += '<div><div>' + esc(p.name) + '</div><div class="desc">' + esc(p.id) + '</div></div>';
+        html += '</label>';
+    }
+    html += '</div>';
+
+    html += '<div class="proj-form-actions">';
+    html += '<button class="btn btn-primary" onclick="saveFrontendCred()">Create</button>';
+    html += '<button class="btn btn-danger" onclick="cancelFrontendCred()">Cancel</button>';
+    html += '</div>';
+    return html;
+}
+
+function newFrontendCred() {
+    state.frontendCredForm = { name: '', routes: '', methods: [], project_ids: [] };
+    state.frontendCredError = null;
+    state.frontendCredToken = null;
+    render();
+}
+
+function cancelFrontendCred() {
+    state.frontendCredForm = null;
+    state.frontendCredError = null;
+    render();
+}
+
+// harvestFrontendCredForm copies the text inputs into the form state, so a
+// checkbox repaint doesn't lose them.
+function harvestFrontendCredForm() {
+    const f = state.frontendCredForm;
+    if (!f) return;
+    f.name = (((document.getElementById('frontendCredName') || {}).value) || '').trim();
+    f.routes = ((document.getElementById('frontendCredRoutes') || {}).value) || '';
+}
+
+function toggleFrontendCredItem(key, value, checked) {
+    const f = state.frontendCredForm;
+    if (!f) return;
+    harvestFrontendCredForm();
+    const list = f[key];
+    const i = list.indexOf(value);
+    if (checked && i < 0) list.push(value);
+    if (!checked && i >= 0) list.splice(i, 1);
+    render();
+}
+
+function saveFrontendCred() {
+    const f = state.frontendCredForm;
+    if (!f) return;
+    harvestFrontendCredForm();
+    if (!f.name) {
+        state.frontendCredError = 'name is required';
+        render();
+        return;
+    }
+    state.frontendCredError = null;
+    ipc(JSON.stringify({
+        type: 'create_frontend_credential',
+        name: f.name,
+        routes: f.routes.split('\n').map(r => r.trim()).filter(Boolean),
+        methods: f.methods,
+        project_ids: f.project_ids,
+    }));
+}
+
+function revokeFrontendCred(name) {
+    if (!confirm('Revoke frontend credential "' + name + '"?\n\nIts next request is refused, and any WebSocket session it has open closes within a few seconds.')) return;
+    ipc(JSON.stringify({ type: 'revoke_frontend_credential', name: name }));
+}
+
+function dismissFrontendCredToken() {
+    state.frontendCredToken = null;
+    render();
+}
+
+window.onFrontendCredentialCreated = function(c, token) {
+    if (!c || !c.name) return;
+    state.frontendCreds = (state.frontendCreds || []).filter(x => x.name !== c.name).concat(c);
+    state.frontendCredForm = null;
+    state.frontendCredError = null;
+    state.frontendCredToken = { name: c.name, token: token || '' };
+    if (state.page === 'frontend') render('push');
+};
+
+window.onFrontendCredentialRevoked = function(name) {
+    state.frontendCreds = (state.frontendCreds || []).filter(x => x.name !== name);
+    state.frontendCredError = null;
+    if (state.frontendCredToken && state.frontendCredToken.name === name) state.frontendCredToken = null;
+    if (state.page === 'frontend') render('push');
+};
+
+window.onFrontendCredentialError = function(msg) {
+    state.frontendCredError = msg || 'frontend credential change failed';
+    if (state.page === 'frontend') render('push');
+};
+
 // Service Inspector — generic renderer driven by each service's manifest
 // (carried inside its status snapshot) plus the snapshot itself.
 
@@ -1941,6 +2315,9 @@ function renderServicePanel(serviceId) {
     const manifest = (snap && snap.manifest) || {};
     let html = '<div class="svc-card">';
     html += `<div id="svc-status-${esc(serviceId)}">${renderServiceStatus(serviceId, snap, manifest)}</div>`;
+    // Outside the status region, like the config editor, so the 2s poll
+    // can't wipe a half-filled form.
+    html += `<div id="svc-actform-${esc(serviceId)}">${renderActionForm(serviceId)}</div>`;
     const configHTML = manifest.config ? renderConfigSection(serviceId, manifest.config) : '';
     html += `<div id="svc-config-${esc(serviceId)}">${configHTML}</div>`;
     html += '</div>';
@@ -2006,12 +2383,30 @@ function updateServiceStatusDOM(serviceId, snap) {
 // re-render (preserving the caret); structural edits re-render.
 // ---------------------------------------------------------------------------
 
-function cfgGetDraft(svcId) { return state.serviceConfigDraft[svcId]; }
+function cfgGetDraft(svcId) {
+    const form = state.actionForm;
+    if (form && svcId === form.key) return form.draft;
+    return state.serviceConfigDraft[svcId];
+}
+
+// cfgSchemaFor returns the top-level fields a binding key edits: the open
+// action form's inputs, or the service's config schema.
+function cfgSchemaFor(svcId) {
+    const form = state.actionForm;
+    if (form && svcId === form.key) {
+        const action = findManifestAction(form.svcId, form.actionId);
+        return action ? (action.inputs || []) : null;
+    }
+    const snap = state.serviceStatuses[svcId];
+    const config = snap && snap.manifest && snap.manifest.config;
+    return config ? (config.schema || []) : null;
+}
 
 // anyConfigEditorOpen reports whether any service's config panel is expanded, so
 // a push-driven full inspector re-render (onSettingsReloaded, etc.) can skip the
 // rebuild and not disturb an open editor's focus / in-flight text.
 function anyConfigEditorOpen() {
+    if (state.actionForm) return true;
     for (const id of Object.keys(state.serviceConfigOpen)) {
         if (state.serviceConfigOpen[id]) return true;
     }
@@ -2536,10 +2931,8 @@ function cfgMapRename(bindIdx, keyIndex, el) {
 // add/remove know the item schema for defaults. Numeric steps descend an
 // array's item; a key step under a map descends the map's item.
 function cfgFieldAt(svcId, path) {
-    const snap = state.serviceStatuses[svcId];
-    const config = snap && snap.manifest && snap.manifest.config;
-    if (!config) return null;
-    let fields = config.schema || [];
+    let fields = cfgSchemaFor(svcId);
+    if (!fields) return null;
     let field = null;
     for (const step of path) {
         if (typeof step === 'number') {
@@ -2641,6 +3034,7 @@ window.onServiceConfigApplied = function(p) {
     if (!p) return;
     let msg = 'Saved.';
     if (p.mode === 'restarting') msg = 'Restarting service to apply…';
+    else if (p.mode === 'applied') msg = 'Saved and applied.';
     else if (p.mode === 'error') msg = p.error || 'Restart failed.';
     state.serviceConfigApplyMsg[p.serviceId] = msg;
     if (state.page === 'inspector') render();
@@ -2747,7 +3141,7 @@ function canonRowKey(row) {
 function renderActionButton(serviceId, action, row) {
     const rowJson = row ? JSON.stringify(row) : '';
     const pending = !!state.serviceActionPending[serviceId + '|' + action.id + '|' + canonRowKey(row)];
-    const danger = String(action.method || '').toUpperCase() === 'DELETE';
+    const danger = actionIsDanger(action);
     const cls = 'btn btn-sm' + (danger ? ' btn-danger' : '');
     const label = pending ? '<span class="spinner"></span>' + esc(action.label) : esc(action.label);
     return `<button class="${cls} svc-action-btn"`
@@ -2775,7 +3169,7 @@ document.addEventListener('click', function(e) {
                 return;
             }
         }
-        dispatchServiceAction(btn.dataset.svc, btn.dataset.action, row);
+        startServiceAction(btn.dataset.svc, btn.dataset.action, row);
     } catch (err) {
         console.error('svc-action-btn click handler failed', err);
     }
@@ -2788,7 +3182,28 @@ function isAnyActionPending(serviceId, actions, rowKey) {
     return false;
 }
 
-function dispatchServiceAction(serviceId, actionId, row) {
+function findManifestAction(serviceId, actionId) {
+    const snap = state.serviceStatuses[serviceId];
+    const actions = (snap && snap.manifest && snap.manifest.actions) || [];
+    return actions.find(a => a.id === actionId) || null;
+}
+
+// startServiceAction is a button click: an action with inputs or a
+// confirmation opens its form, anything else runs at once.
+function startServiceAction(serviceId, actionId, row) {
+    const action = findManifestAction(serviceId, actionId);
+    if (!actionNeedsForm(action)) {
+        dispatchServiceAction(serviceId, actionId, row);
+        return;
+    }
+    state.actionForm = {
+        key: 'action:' + serviceId, svcId: serviceId, actionId: actionId,
+        row: row, draft: {}, error: null,
+    };
+    if (state.page === 'inspector') render();
+}
+
+function dispatchServiceAction(serviceId, actionId, row, inputs, confirmed) {
     const rowKey = canonRowKey(row);
     state.serviceActionPending[serviceId + '|' + actionId + '|' + rowKey] = true;
     // Show the pending spinner immediately by re-rendering only this service's
@@ -2799,9 +3214,76 @@ function dispatchServiceAction(serviceId, actionId, row) {
         serviceId: serviceId,
         actionId: actionId,
         row: row || undefined,
+        inputs: inputs || undefined,
+        confirmed: confirmed || undefined,
     }));
 }
 
+// renderActionForm draws the open action form for a service, if it has one:
+// the action's question, its inputs (through the config renderer, bound to
+// the form's draft) and Run / Cancel. Running it is the confirmation.
+function renderActionForm(serviceId) {
+    const form = state.actionForm;
+    if (!form || form.svcId !== serviceId) return '';
+    const action = findManifestAction(serviceId, form.actionId);
+    if (!action) return '';
+    const danger = actionIsDanger(action);
+    const inputs = action.inputs || [];
+    let html = '<div class="svc-resource"><div class="svc-resource-body">';
+    html += `<div class="svc-resource-title">${esc(action.label)}</div>`;
+    if (form.row) {
+        const sub = Object.keys(form.row).map(k => k + ' ' + formatScalar(form.row[k])).join(', ');
+        html += `<div class="svc-resource-help">${esc(sub)}</div>`;
+    }
+    if (action.confirm || (danger && inputs.length === 0)) {
+        const question = action.confirm || ('Run ' + action.label + '?');
+        html += `<div class="svc-action-confirm${danger ? ' danger' : ''}">${esc(question)}</div>`;
+    }
+    if (inputs.length > 0) {
+        html += '<div class="svc-resource-form">';
+        for (const field of inputs) {
+            html += renderConfigNode(form.key, [field.id], field, cfgGetAt(form.draft, [field.id]));
+        }
+        html += '</div>';
+    }
+    if (form.error) html += `<div class="svc-resource-error">${esc(form.error)}</div>`;
+    html += '<div class="cfg-actions">';
+    html += `<button class="btn ${danger ? 'btn-danger' : 'btn-primary'}" onclick="runActionForm()">${esc(action.label)}</button>`;
+    html += '<button class="btn" onclick="cancelActionForm()">Cancel</button>';
+    html += '</div></div></div>';
+    return html;
+}
+
+// runActionForm checks the form the way the config editor checks a save —
+// required fields, parseable JSON leaves — then runs the action with the
+// draft as its inputs. Relay checks them again against the schema.
+function runActionForm() {
+    const form = state.actionForm;
+    if (!form) return;
+    const action = findManifestAction(form.svcId, form.actionId);
+    if (!action) { cancelActionForm(); return; }
+    const inputs = action.inputs || [];
+    if (cfgHasBadJson(form.key)) {
+        form.error = 'Fix invalid JSON first.';
+        render();
+        return;
+    }
+    const missing = cfgScanRequired(inputs, form.draft);
+    if (missing) {
+        form.error = 'Required field missing: ' + missing;
+        render();
+        return;
+    }
+    state.actionForm = null;
+    dispatchServiceAction(form.svcId, form.actionId, form.row, inputs.length > 0 ? form.draft : null, true);
+    if (state.page === 'inspector') render();
+}
+
+function cancelActionForm() {
+    state.actionForm = null;
+    if (state.page === 'inspector') render();
+}
+
 
 
 
@@ -2900,7 +3382,7 @@ function auditMatches(ev) {
     if (f.text) {
         const a = ev.actor || {};
         const hay = [ev.tool, ev.mcp_id, ev.error, a.project_name, a.proc, a.parent,
-                     a.client_id, a.remote_addr,
+                     a.client_id, a.remote_addr, ev.request_id,
                      typeof ev.args === 'string' ? ev.args : JSON.stringify(ev.args || '')]
             .join('\u0000').toLowerCase();
         if (hay.indexOf(f.text.toLowerCase()) === -1) return false;
@@ -3057,6 +3539,8 @@ function renderAuditDetail(ev) {
     if (ev.result_bytes) add('Result', ev.result_bytes + ' bytes' + (ev.result_is_error ? ' (isError)' : ''));
     if (ev.tool_count) add('Tools visible', ev.tool_count);
     add('Event id', ev.id);
+    // Joins the call to its line in logs/frontend-access.log.
+    add('Request id', ev.request_id);
 
     let html = '<tr class="audit-expand"><td colspan="8">';
     html += '<dl class="audit-kv">';
@@ -3197,6 +3681,8 @@ render();
 // classic <script> had.
 Object.assign(window, {
     auditCaller, auditDetail, auditFmtTime, auditMatches, auditPretty, auditSelect, auditVisible, exportAudit, queryAudit, renderAudit, renderAuditDetail, renderAuditRow, restoreAuditFocus, revealAuditLog, setAuditFilter, toggleAuditFollow, toggleAuditRow,
+    cancelFrontendCred, dismissFrontendCredToken, frontendCredProjectNames, harvestFrontendCredForm, newFrontendCred, renderFrontendCredForm, renderFrontendCreds, revokeFrontendCred, saveFrontendCred, toggleFrontendCredItem,
     cancelEnrolment, dismissEnrolBundle, enrolBudgetText, enrolBytes, enrolGrantNames, enrolGrantSummary, newEnrolment, remoteDraft, remoteDraftSet, remoteGrantableProjects, remoteListenIsLoopback, removeRemoteConfig, renderEnrolBundleBanner, renderEnrolmentForm, renderEnrolments, renderRemoteListener, revokeEnrolment, saveEnrolment, saveRemoteConfig, toggleEnrolGrant,
-    addExternalMcp, addExternalMcpFromJson, addExternalMcpHttp, addService, authenticateMcp, blankProjectForm, cancelMcpEdit, cancelProjectEdit, cancelServiceEdit, cfgArrayAdd, cfgArrayRemove, cfgBind, cfgChevron, cfgDirty, cfgEdit, cfgEditJson, cfgExpandKey, cfgFieldAt, cfgFirstMissingRequired, cfgGetDraft, cfgHasBadJson, cfgIsExpanded, cfgKvAdd, cfgKvRemove, cfgKvRename, cfgKvSetVal, cfgKvState, cfgMapAdd, cfgMapRemove, cfgMapRename, cfgNodeLabel, cfgRefreshChrome, cfgRerender, cfgSetExpanded, cfgToggleExpand, copyProjectToken, dispatchConfigOp, dispatchServiceAction, editProject, editService, harvestProjectForm, ipc, isAnyActionPending, isProjMcpWildcard, isProjModelsWildcard, isRemoteForm, isRemoteProject, newMcp, newProject, newService, projMcpState, projectFormFromExisting, pruneStaleDisabledTool, regenProjectSkill, removeExternalMcp, removeProject, removeService, render, renderActionButton, renderArrayBlock, renderConfigArray, renderConfigItem, renderConfigKeyValue, renderConfigLeaf, renderConfigMap, renderConfigNode, renderConfigObject, renderConfigSection, renderMcpForm, renderMcpPush, renderMcpServers, renderObjectFields, renderProjToolPicker, renderProjectForm, renderProjects, renderServiceForm, renderServiceInspector, renderServicePanel, renderServiceStatus, renderServices, renderStatusPayload, resetMcpPermissions, revertConfig, rotateProjectToken, saveConfig, saveProjectForm, saveServiceEdit, serviceBadgeHTML, setMcpAddMode, setMcpTransport, setProjKind, setProjMcpState, setProjMcpWildcard, setProjModelsWildcard, setsEqual, showPage, svcFormValues, toggleConfigSection, toggleProjTool, toggleProjectTokenVisible, toggleServiceRunning, updateServiceAutostart, updateServiceStatusDOM});
+    cancelActionForm, cfgSchemaFor, findManifestAction, renderActionForm, runActionForm, startServiceAction,
+    addExternalMcp, addExternalMcpFromJson, addExternalMcpHttp, addService, authenticateMcp, blankProjectForm, cancelMcpEdit, cancelProjectEdit, cancelServiceEdit, cfgArrayAdd, cfgArrayRemove, cfgBind, cfgChevron, cfgDirty, cfgEdit, cfgEditJson, cfgExpandKey, cfgFieldAt, cfgFirstMissingRequired, cfgGetDraft, cfgHasBadJson, cfgIsExpanded, cfgKvAdd, cfgKvRemove, cfgKvRename, cfgKvSetVal, cfgKvState, cfgMapAdd, cfgMapRemove, cfgMapRename, cfgNodeLabel, cfgRefreshChrome, cfgRerender, cfgSetExpanded, cfgToggleExpand, copyProjectToken, dispatchConfigOp, dispatchServiceAction, editProject, editService, harvestProjectForm, ipc, isAnyActionPending, isProjMcpWildcard, isProjModelsWildcard, isRemoteForm, isRemoteProject, mcpAuthBadge, newMcp, newProject, newService, projMcpState, projectFormFromExisting, pruneStaleDisabledTool, regenProjectSkill, removeExternalMcp, removeProject, removeService, render, renderActionButton, renderArrayBlock, renderConfigArray, renderConfigItem, renderConfigKeyValue, renderConfigLeaf, renderConfigMap, renderConfigNode, renderConfigObject, renderConfigSection, renderMcpForm, renderMcpPush, renderMcpServers, renderObjectFields, renderProjToolPicker, renderProjectForm, renderProjects, renderServiceForm, renderServiceInspector, renderServiceLogs, renderServicePanel, renderServiceStatus, renderServices, renderStatusPayload, resetMcpCredentials, resetMcpPermissions, revertConfig, rotateProjectToken, runJobNow, saveConfig, saveProjectForm, saveServiceEdit, serviceBadgeHTML, setMcpAddMode, setServiceLogGrep, setMcpTransport, setProjKind, setProjMcpState, setProjMcpWildcard, setProjModelsWildcard, setsEqual, showPage, svcFormValues, toggleConfigSection, toggleProjTool, toggleProjectTokenVisible, toggleServiceLogs, toggleServiceRunning, updateServiceAutostart, updateServiceStatusDOM});
 window.state = state;
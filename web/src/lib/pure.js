@@ -203,10 +203,83 @@ function cfgFormatJson(v) {
     try { return JSON.stringify(v, null, 2); } catch (e) { return ''; }
 }
 
+// formatServiceLogLine renders one onServiceLogs line the way `relay service
+// logs` prints it: local time, then "LEVEL msg key=value ..." for a JSON line
+// (keys sorted) or the text as written.
+function formatServiceLogLine(l) {
+    const pad = (n, w) => String(n).padStart(w || 2, '0');
+    let stamp = '-';
+    if (l.time) {
+        const d = new Date(l.time);
+        stamp = pad(d.getHours()) + ':' + pad(d.getMinutes()) + ':' + pad(d.getSeconds()) + '.' + pad(d.getMilliseconds(), 3);
+    }
+    if (!l.level && !l.msg && !l.fields) return stamp + '  ' + l.text;
+    let out = l.level ? l.level.padEnd(5) + ' ' : '';
+    out += l.msg || '';
+    for (const k of Object.keys(l.fields || {}).sort()) {
+        const v = l.fields[k];
+        let s = typeof v === 'string' ? v : JSON.stringify(v);
+        if (typeof v === 'string' && (v === '' || /[ \t"=]/.test(v))) s = JSON.stringify(v);
+        out += ' ' + k + '=' + s;
+    }
+    return stamp + '  ' + out;
+}
+
+// formatDuration renders seconds compactly, in at most two units: "45s",
+// "10m", "1h30m", "2d3h".
+function formatDuration(sec) {
+    sec = Math.round(sec);
+    if (sec < 60) return sec + 's';
+    let out = '', units = 0;
+    for (const [n, unit] of [[86400, 'd'], [3600, 'h'], [60, 'm'], [1, 's']]) {
+        if (sec >= n && units < 2) {
+            out += Math.floor(sec / n) + unit;
+            sec %= n;
+            units++;
+        }
+    }
+    return out;
+}
+
+// formatJobSchedule renders when a job runs: the cron expression, "every 10m"
+// or "one-shot", then a timeout and a non-default overlap policy.
+function formatJobSchedule(job) {
+    job = job || {};
+    let out = job.schedule ? job.schedule : job.interval_sec ? 'every ' + formatDuration(job.interval_sec) : 'one-shot';
+    if (job.timeout_sec) out += ', timeout ' + formatDuration(job.timeout_sec);
+    if (job.overlap && job.overlap !== 'skip') out += ', overlap ' + job.overlap;
+    return out;
+}
+
+// formatJobRun renders one onJobStatus run: local start time, how it ended,
+// how long it took (when it ran) and what started it.
+function formatJobRun(run) {
+    const pad = n => String(n).padStart(2, '0');
+    const d = new Date(run.start);
+    let out = (d.getMonth() + 1) + '/' + d.getDate() + ' ' + pad(d.getHours()) + ':' + pad(d.getMinutes()) + ':' + pad(d.getSeconds());
+    out += '  ' + run.status;
+    if (run.duration_ms > 0) out += ' in ' + (run.duration_ms < 1000 ? run.duration_ms + 'ms' : formatDuration(run.duration_ms / 1000));
+    return out + ' (' + run.trigger + ')';
+}
+
+// actionIsDanger reports whether a manifest action is styled as destructive:
+// declared danger, or a DELETE (which always was).
+function actionIsDanger(action) {
+    return !!(action && (action.danger || String(action.method || '').toUpperCase() === 'DELETE'));
+}
+
+// actionNeedsForm reports whether clicking an action opens its form instead
+// of running it: it has inputs to fill in, or a question to answer first.
+// Relay refuses an unconfirmed confirm/danger action, so this must agree
+// with ActionDecl.NeedsConfirmation.
+function actionNeedsForm(action) {
+    return !!(action && ((action.inputs && action.inputs.length > 0) || action.confirm || action.danger));
+}
+
 function oneLineProj(s) {
     return String(s).replace(/\s+/g, ' ').slice(0, 140);
 }
 
 export {
-    esc, formatScalar, formatRelativeTime, cfgStripJsonComments, cfgParseConfigText, cfgGetAt, cfgSetAt, cfgDefaultFor, cfgCoerce, cfgKvCoerce, cfgKvDisplay, cfgScanRequired, cfgSummary, cfgFormatStringMap, cfgFormatJson, oneLineProj, ISO_8601_RE
+    esc, formatScalar, formatRelativeTime, cfgStripJsonComments, cfgParseConfigText, cfgGetAt, cfgSetAt, cfgDefaultFor, cfgCoerce, cfgKvCoerce, cfgKvDisplay, cfgScanRequired, cfgSummary, cfgFormatStringMap, cfgFormatJson, formatServiceLogLine, formatDuration, formatJobSchedule, formatJobRun, actionIsDanger, actionNeedsForm, oneLineProj, ISO_8601_RE
 };